@@ -0,0 +1,69 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/jchauncey/TheDeeps/server/models"
+)
+
+// Authorization errors
+var (
+	ErrUnauthenticated = errors.New("authentication required")
+	ErrNotOwner        = errors.New("character belongs to another account")
+	ErrNotAdmin        = errors.New("admin access required")
+)
+
+// contextKey is the type used for values stored in a request context
+type contextKey string
+
+const accountKey contextKey = "account"
+
+// WithAccount returns a copy of ctx carrying the account
+func WithAccount(ctx context.Context, account *models.Account) context.Context {
+	return context.WithValue(ctx, accountKey, account)
+}
+
+// AccountFromContext returns the account attached to a request context, if any
+func AccountFromContext(ctx context.Context) (*models.Account, bool) {
+	account, ok := ctx.Value(accountKey).(*models.Account)
+	return account, ok && account != nil
+}
+
+// CheckOwner verifies that the account in ctx owns the character
+func CheckOwner(ctx context.Context, character *models.Character) error {
+	account, ok := AccountFromContext(ctx)
+	if !ok {
+		return ErrUnauthenticated
+	}
+
+	if !account.Owns(character) {
+		return ErrNotOwner
+	}
+
+	return nil
+}
+
+// CheckAdmin verifies that the account in ctx is one of the admin account IDs.
+// IDs are used rather than usernames, which anyone could register first.
+func CheckAdmin(ctx context.Context, admins map[string]bool) error {
+	account, ok := AccountFromContext(ctx)
+	if !ok {
+		return ErrUnauthenticated
+	}
+
+	if !admins[account.ID] {
+		return ErrNotAdmin
+	}
+
+	return nil
+}
+
+// StatusCode returns the HTTP status for an authorization error
+func StatusCode(err error) int {
+	if errors.Is(err, ErrUnauthenticated) {
+		return http.StatusUnauthorized
+	}
+	return http.StatusForbidden
+}
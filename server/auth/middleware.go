@@ -0,0 +1,51 @@
+package auth
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/jchauncey/TheDeeps/server/log"
+	"github.com/jchauncey/TheDeeps/server/repositories"
+)
+
+// Middleware attaches the account identified by the request's session token.
+// The token is read from an "Authorization: Bearer" header, or from the "token"
+// query parameter for WebSocket connections where browsers can't set headers.
+// Requests without a token pass through unauthenticated; handlers decide whether
+// an account is required. Requests with a bad token are rejected.
+func Middleware(tokens *TokenManager, accounts repositories.AccountStore) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			token := tokenFromRequest(r)
+			if token == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			accountID, err := tokens.Verify(token)
+			if err != nil {
+				log.Debug("Rejected session token: %v", err)
+				http.Error(w, err.Error(), http.StatusUnauthorized)
+				return
+			}
+
+			account, err := accounts.GetByID(accountID)
+			if err != nil {
+				http.Error(w, ErrInvalidToken.Error(), http.StatusUnauthorized)
+				return
+			}
+
+			next.ServeHTTP(w, r.WithContext(WithAccount(r.Context(), account)))
+		})
+	}
+}
+
+// tokenFromRequest extracts the session token from a request
+func tokenFromRequest(r *http.Request) string {
+	if header := r.Header.Get("Authorization"); header != "" {
+		if token, found := strings.CutPrefix(header, "Bearer "); found {
+			return strings.TrimSpace(token)
+		}
+	}
+	return r.URL.Query().Get("token")
+}
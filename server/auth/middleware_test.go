@@ -0,0 +1,113 @@
+package auth
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/jchauncey/TheDeeps/server/models"
+	"github.com/jchauncey/TheDeeps/server/repositories"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// serveWithMiddleware runs a request through the middleware and reports the account it attached
+func serveWithMiddleware(tokens *TokenManager, accounts repositories.AccountStore, req *http.Request) (*httptest.ResponseRecorder, *models.Account) {
+	var attached *models.Account
+	handler := Middleware(tokens, accounts)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attached, _ = AccountFromContext(r.Context())
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	return rr, attached
+}
+
+func TestMiddlewareAttachesAccount(t *testing.T) {
+	tokens := NewTokenManager([]byte("secret"))
+	accounts := repositories.NewAccountRepository()
+	account := models.NewAccount("player", "hash")
+	require.NoError(t, accounts.Save(account))
+	token := tokens.Issue(account.ID)
+
+	// Bearer header
+	req := httptest.NewRequest("GET", "/characters", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	rr, attached := serveWithMiddleware(tokens, accounts, req)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	require.NotNil(t, attached)
+	assert.Equal(t, account.ID, attached.ID)
+
+	// Query parameter for WebSockets
+	req = httptest.NewRequest("GET", "/ws/game?characterId=abc&token="+token, nil)
+	rr, attached = serveWithMiddleware(tokens, accounts, req)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	require.NotNil(t, attached)
+	assert.Equal(t, account.ID, attached.ID)
+}
+
+func TestMiddlewareWithoutToken(t *testing.T) {
+	tokens := NewTokenManager([]byte("secret"))
+	accounts := repositories.NewAccountRepository()
+
+	req := httptest.NewRequest("GET", "/dungeons", nil)
+	rr, attached := serveWithMiddleware(tokens, accounts, req)
+	assert.Equal(t, http.StatusOK, rr.Code, "Anonymous requests should pass through")
+	assert.Nil(t, attached)
+}
+
+func TestMiddlewareRejectsBadTokens(t *testing.T) {
+	tokens := NewTokenManager([]byte("secret"))
+	accounts := repositories.NewAccountRepository()
+
+	// Forged token
+	req := httptest.NewRequest("GET", "/characters", nil)
+	req.Header.Set("Authorization", "Bearer forged.token")
+	rr, attached := serveWithMiddleware(tokens, accounts, req)
+	assert.Equal(t, http.StatusUnauthorized, rr.Code)
+	assert.Nil(t, attached)
+
+	// Valid signature for an account that doesn't exist
+	req = httptest.NewRequest("GET", "/characters", nil)
+	req.Header.Set("Authorization", "Bearer "+tokens.Issue("deleted-account"))
+	rr, attached = serveWithMiddleware(tokens, accounts, req)
+	assert.Equal(t, http.StatusUnauthorized, rr.Code)
+	assert.Nil(t, attached)
+}
+
+func TestCheckOwner(t *testing.T) {
+	account := models.NewAccount("player", "hash")
+	character := models.NewCharacter("Hero", models.Warrior)
+	character.OwnerID = account.ID
+
+	err := CheckOwner(context.Background(), character)
+	assert.ErrorIs(t, err, ErrUnauthenticated)
+	assert.Equal(t, http.StatusUnauthorized, StatusCode(err))
+
+	err = CheckOwner(WithAccount(context.Background(), models.NewAccount("other", "hash")), character)
+	assert.ErrorIs(t, err, ErrNotOwner)
+	assert.Equal(t, http.StatusForbidden, StatusCode(err))
+
+	assert.NoError(t, CheckOwner(WithAccount(context.Background(), account), character))
+}
+
+func TestCheckAdmin(t *testing.T) {
+	designer := models.NewAccount("designer", "hash")
+	admins := map[string]bool{designer.ID: true}
+
+	err := CheckAdmin(context.Background(), admins)
+	assert.ErrorIs(t, err, ErrUnauthenticated)
+	assert.Equal(t, http.StatusUnauthorized, StatusCode(err))
+
+	err = CheckAdmin(WithAccount(context.Background(), models.NewAccount("player", "hash")), admins)
+	assert.ErrorIs(t, err, ErrNotAdmin)
+	assert.Equal(t, http.StatusForbidden, StatusCode(err))
+
+	// Another account registered with the admin's username isn't an admin
+	err = CheckAdmin(WithAccount(context.Background(), models.NewAccount("designer", "hash")), admins)
+	assert.ErrorIs(t, err, ErrNotAdmin)
+
+	assert.NoError(t, CheckAdmin(WithAccount(context.Background(), designer), admins))
+}
@@ -0,0 +1,23 @@
+package auth
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHashPassword(t *testing.T) {
+	hash, err := HashPassword("correct horse")
+	require.NoError(t, err, "HashPassword should not return an error")
+	assert.NotEqual(t, "correct horse", hash, "The password should not be stored in plain text")
+
+	assert.True(t, CheckPassword(hash, "correct horse"), "The right password should match")
+	assert.False(t, CheckPassword(hash, "wrong horse"), "The wrong password should not match")
+	assert.False(t, CheckPassword("not a hash", "correct horse"), "A malformed hash should not match")
+}
+
+func TestHashPasswordTooShort(t *testing.T) {
+	_, err := HashPassword("short")
+	assert.ErrorIs(t, err, ErrPasswordTooShort)
+}
@@ -0,0 +1,95 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultTokenTTL is how long a session token stays valid
+const DefaultTokenTTL = 24 * time.Hour
+
+// Token errors
+var (
+	ErrInvalidToken = errors.New("invalid token")
+	ErrExpiredToken = errors.New("token expired")
+)
+
+// TokenManager issues and verifies signed session tokens.
+// A token is "<payload>.<signature>" where the payload holds the account ID and
+// expiry time and the signature is an HMAC-SHA256 of the payload.
+type TokenManager struct {
+	secret []byte
+	TTL    time.Duration
+	now    func() time.Time
+}
+
+// NewTokenManager creates a token manager that signs tokens with the given secret
+func NewTokenManager(secret []byte) *TokenManager {
+	return &TokenManager{
+		secret: secret,
+		TTL:    DefaultTokenTTL,
+		now:    time.Now,
+	}
+}
+
+// GenerateSecret creates a random signing secret
+func GenerateSecret() ([]byte, error) {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return nil, err
+	}
+	return secret, nil
+}
+
+// Issue creates a token for an account
+func (m *TokenManager) Issue(accountID string) string {
+	expires := m.now().Add(m.TTL).Unix()
+	payload := base64.RawURLEncoding.EncodeToString([]byte(accountID + "|" + strconv.FormatInt(expires, 10)))
+	return payload + "." + m.sign(payload)
+}
+
+// Verify checks a token's signature and expiry and returns its account ID
+func (m *TokenManager) Verify(token string) (string, error) {
+	payload, signature, found := strings.Cut(token, ".")
+	if !found {
+		return "", ErrInvalidToken
+	}
+
+	if !hmac.Equal([]byte(signature), []byte(m.sign(payload))) {
+		return "", ErrInvalidToken
+	}
+
+	decoded, err := base64.RawURLEncoding.DecodeString(payload)
+	if err != nil {
+		return "", ErrInvalidToken
+	}
+
+	accountID, expiresText, found := strings.Cut(string(decoded), "|")
+	if !found || accountID == "" {
+		return "", ErrInvalidToken
+	}
+
+	expires, err := strconv.ParseInt(expiresText, 10, 64)
+	if err != nil {
+		return "", ErrInvalidToken
+	}
+
+	if m.now().Unix() >= expires {
+		return "", ErrExpiredToken
+	}
+
+	return accountID, nil
+}
+
+// sign returns the encoded HMAC of a payload
+func (m *TokenManager) sign(payload string) string {
+	mac := hmac.New(sha256.New, m.secret)
+	mac.Write([]byte(payload))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
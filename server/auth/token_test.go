@@ -0,0 +1,67 @@
+package auth
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTokenRoundTrip(t *testing.T) {
+	tokens := NewTokenManager([]byte("secret"))
+
+	token := tokens.Issue("account-1")
+	accountID, err := tokens.Verify(token)
+	require.NoError(t, err, "A freshly issued token should verify")
+	assert.Equal(t, "account-1", accountID)
+}
+
+func TestTokenRejectsTampering(t *testing.T) {
+	tokens := NewTokenManager([]byte("secret"))
+	token := tokens.Issue("account-1")
+
+	// Signed with a different secret
+	other := NewTokenManager([]byte("other secret"))
+	_, err := other.Verify(token)
+	assert.ErrorIs(t, err, ErrInvalidToken)
+
+	// Payload swapped for another account
+	payload, _, _ := strings.Cut(tokens.Issue("account-2"), ".")
+	_, signature, _ := strings.Cut(token, ".")
+	_, err = tokens.Verify(payload + "." + signature)
+	assert.ErrorIs(t, err, ErrInvalidToken)
+
+	// Garbage
+	for _, bad := range []string{"", "no-dot", "a.b", "."} {
+		_, err = tokens.Verify(bad)
+		assert.ErrorIs(t, err, ErrInvalidToken, "Token %q should be rejected", bad)
+	}
+}
+
+func TestTokenExpires(t *testing.T) {
+	tokens := NewTokenManager([]byte("secret"))
+	now := time.Now()
+	tokens.now = func() time.Time { return now }
+
+	token := tokens.Issue("account-1")
+
+	now = now.Add(DefaultTokenTTL - time.Minute)
+	_, err := tokens.Verify(token)
+	assert.NoError(t, err, "The token should still be valid before the TTL")
+
+	now = now.Add(2 * time.Minute)
+	_, err = tokens.Verify(token)
+	assert.ErrorIs(t, err, ErrExpiredToken)
+}
+
+func TestGenerateSecret(t *testing.T) {
+	first, err := GenerateSecret()
+	require.NoError(t, err)
+	second, err := GenerateSecret()
+	require.NoError(t, err)
+
+	assert.Len(t, first, 32)
+	assert.NotEqual(t, first, second, "Secrets should be random")
+}
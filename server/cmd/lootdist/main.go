@@ -0,0 +1,124 @@
+// Command lootdist prints the expected drops of a loot table, so designers can
+// check a table's balance without playing through it.
+//
+//	go run ./cmd/lootdist -table treasure -depth 5
+//	go run ./cmd/lootdist -mob goblin -variant boss -depth 3
+//	go run ./cmd/lootdist -room treasure -theme crypt -depth 5
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"text/tabwriter"
+
+	"github.com/jchauncey/TheDeeps/server/models"
+)
+
+func main() {
+	table := flag.String("table", "", "loot table to inspect")
+	room := flag.String("room", "", "room type whose loot table to inspect")
+	theme := flag.String("theme", "", "dungeon theme whose finds to add, used with -room")
+	mob := flag.String("mob", "", "mob type whose drops to inspect")
+	variant := flag.String("variant", string(models.VariantNormal), "mob variant, used with -mob")
+	depth := flag.Int("depth", 1, "floor the loot drops on")
+	lootPath := flag.String("loot", "", "JSON file of loot tables (defaults to the built-in set)")
+	monstersPath := flag.String("monsters", "", "JSON file of monster definitions (defaults to the built-in set)")
+	flag.Parse()
+
+	catalog := models.Loot()
+	if *lootPath != "" {
+		loaded, err := models.LoadLootCatalog(*lootPath)
+		if err != nil {
+			fail(err)
+		}
+		catalog = loaded
+	}
+	monsters := models.Monsters()
+	if *monstersPath != "" {
+		loaded, err := models.LoadMonsterCatalog(*monstersPath)
+		if err != nil {
+			fail(err)
+		}
+		monsters = loaded
+	}
+
+	// Work out which tables are rolled
+	var tables []string
+	switch {
+	case *table != "":
+		tables = []string{*table}
+	case *room != "":
+		name, exists := catalog.Rooms[models.RoomType(*room)]
+		if !exists {
+			fail(fmt.Errorf("room type %q has no loot table", *room))
+		}
+		tables = []string{name}
+		if *theme != "" {
+			themed, exists := catalog.Themes[models.Theme(*theme)]
+			if !exists {
+				fail(fmt.Errorf("theme %q has no loot table", *theme))
+			}
+			// Themes only add their finds to standard and treasure rooms
+			if models.RoomType(*room) == models.RoomStandard || models.RoomType(*room) == models.RoomTreasure {
+				tables = append(tables, themed)
+			}
+		}
+	case *mob != "":
+		definition, exists := monsters.Definition(models.MobType(*mob))
+		if !exists {
+			fail(fmt.Errorf("mob type %q is not defined", *mob))
+		}
+		if definition.LootTable != "" {
+			tables = append(tables, definition.LootTable)
+		}
+		if name, exists := catalog.Variants[models.MobVariant(*variant)]; exists {
+			tables = append(tables, name)
+		}
+	default:
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	// Add up the expected drops of every table
+	expected := make(map[models.LootOdds]float64)
+	for _, name := range tables {
+		odds, err := catalog.Expected(name, *depth)
+		if err != nil {
+			fail(err)
+		}
+		for _, odd := range odds {
+			expected[models.LootOdds{Item: odd.Item, Rarity: odd.Rarity}] += odd.Expected
+		}
+	}
+
+	odds := make([]models.LootOdds, 0, len(expected))
+	total := 0.0
+	for key, count := range expected {
+		key.Expected = count
+		odds = append(odds, key)
+		total += count
+	}
+	sort.Slice(odds, func(i, j int) bool {
+		if odds[i].Expected != odds[j].Expected {
+			return odds[i].Expected > odds[j].Expected
+		}
+		return odds[i].Item+string(odds[i].Rarity) < odds[j].Item+string(odds[j].Rarity)
+	})
+
+	fmt.Printf("Tables %v on floor %d drop %.3f items on average\n\n", tables, *depth, total)
+
+	writer := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(writer, "Item\tRarity\tExpected\tShare\t")
+	for _, odd := range odds {
+		fmt.Fprintf(writer, "%s\t%s\t%.4f\t%.1f%%\t\n", odd.Item, odd.Rarity, odd.Expected, 100*odd.Expected/total)
+	}
+	writer.Flush()
+}
+
+// fail prints an error and exits
+func fail(err error) {
+	fmt.Fprintln(os.Stderr, err)
+	os.Exit(1)
+}
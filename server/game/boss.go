@@ -0,0 +1,232 @@
+package game
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/jchauncey/TheDeeps/server/models"
+)
+
+const bossSummonRadius = 3 // How far from a boss its minions appear
+
+// BossHit is a boss's special attack landing on a character
+type BossHit struct {
+	CharacterID string               `json:"characterId"`
+	Damage      int                  `json:"damage"`
+	Effect      *models.StatusEffect `json:"effect,omitempty"` // Status effect the special attack applied
+	Died        bool                 `json:"died,omitempty"`
+}
+
+// BossAction describes what a boss's phases, enrage timer and special attacks did on its turn
+type BossAction struct {
+	MobID     string        `json:"mobId"`
+	Phase     string        `json:"phase,omitempty"`     // Phase the boss entered this turn
+	Enraged   bool          `json:"enraged,omitempty"`   // The boss enraged this turn
+	Telegraph string        `json:"telegraph,omitempty"` // Special attack the boss started winding up; it lands next turn
+	Special   string        `json:"special,omitempty"`   // Special attack the boss unleashed
+	Hits      []BossHit     `json:"hits,omitempty"`      // Characters the special attack hit
+	Summoned  []*models.Mob `json:"summoned,omitempty"`  // Minions that joined the fight
+	Message   string        `json:"message,omitempty"`
+	TurnTaken bool          `json:"turnTaken,omitempty"` // The boss spent its turn and doesn't attack
+}
+
+// BossTurn runs a boss's fight against the characters facing it before it attacks.
+// Bosses move into a new phase as their HP falls, which can raise their damage and
+// summon minions; enrage after fighting for too long; and spend whole turns winding
+// up and then unleashing their phase's special attack on everyone within its radius.
+// Characters can step out of reach while a special attack is telegraphed.
+func BossTurn(floor *models.Floor, boss *models.Mob, characters []*models.Character) BossAction {
+	action := BossAction{MobID: boss.ID}
+	state := boss.Boss
+	if state == nil {
+		return action
+	}
+	definition := models.Monsters().Boss(boss.Type)
+	state.Turns++
+
+	// Phases only move forward, and a big hit still runs through every phase it skips
+	for target := definition.PhaseAt(boss.HP, boss.MaxHP); state.Phase < target; {
+		state.Phase++
+		enterPhase(floor, boss, definition.Phases[state.Phase], characters, &action)
+	}
+
+	if !state.Enraged && definition.EnrageTurns > 0 && state.Turns >= definition.EnrageTurns {
+		state.Enraged = true
+		boss.Damage += boss.Damage * definition.EnrageBonus / 100
+		action.Enraged = true
+		action.Message = joinSentences(action.Message, fmt.Sprintf("%s becomes enraged!", boss.Name))
+	}
+
+	if state.Charging != "" {
+		special, exists := definition.Special(state.Charging)
+		state.Charging = ""
+		if exists {
+			unleashSpecial(boss, special, characters, &action)
+			state.Cooldown = special.Cooldown
+		}
+	} else if state.Cooldown > 0 {
+		state.Cooldown--
+	} else if special := definition.Phases[state.Phase].Special; special != nil {
+		state.Charging = special.Name
+		action.Telegraph = special.Name
+		action.TurnTaken = true
+		action.Message = joinSentences(action.Message, fmt.Sprintf("%s %s!", boss.Name, special.Telegraph))
+	}
+
+	floor.MarkMobs(boss.ID)
+	return action
+}
+
+// enterPhase starts a boss's next phase
+func enterPhase(floor *models.Floor, boss *models.Mob, phase models.BossPhase, characters []*models.Character, action *BossAction) {
+	action.Phase = phase.Name
+	boss.Damage += boss.Damage * phase.DamageBonus / 100
+
+	if phase.Message != "" {
+		action.Message = joinSentences(action.Message, fmt.Sprintf("%s %s!", boss.Name, phase.Message))
+	} else {
+		action.Message = joinSentences(action.Message, fmt.Sprintf("%s enters its %s phase!", boss.Name, phase.Name))
+	}
+
+	if phase.Summon != "" {
+		minions := summonMinions(floor, boss, phase.Summon, phase.SummonCount, characters)
+		action.Summoned = append(action.Summoned, minions...)
+		if len(minions) > 0 {
+			action.Message = joinSentences(action.Message, fmt.Sprintf("%d %s join the fight!", len(minions), minions[0].Name))
+		}
+	}
+}
+
+// unleashSpecial lands a telegraphed special attack on every character still within its radius
+func unleashSpecial(boss *models.Mob, special *models.BossSpecial, characters []*models.Character, action *BossAction) {
+	action.Special = special.Name
+	action.TurnTaken = true
+
+	damage := special.DamageAt(boss.Level)
+	for _, character := range characters {
+		if character.IsDead() || chebyshevDistance(boss.Position, character.Position) > special.Radius {
+			continue
+		}
+
+		hit := BossHit{CharacterID: character.ID, Damage: damage}
+		hit.Died = damageCharacter(character, damage)
+		if special.Effect != nil && !hit.Died {
+			effect := *special.Effect
+			effect.Source = boss.Name
+			applied := character.StatusEffects.Apply(effect)
+			hit.Effect = &applied
+		}
+		action.Hits = append(action.Hits, hit)
+	}
+
+	message := fmt.Sprintf("%s unleashes %s!", boss.Name, special.Name)
+	if len(action.Hits) == 0 {
+		message += " It hits nothing."
+	}
+	action.Message = joinSentences(action.Message, message)
+}
+
+// summonMinions places up to count new mobs on free tiles the boss can see, nearest first
+func summonMinions(floor *models.Floor, boss *models.Mob, mobType models.MobType, count int, characters []*models.Character) []*models.Mob {
+	minions := make([]*models.Mob, 0, count)
+	visible := ComputeFOV(floor, boss.Position, bossSummonRadius)
+
+	for radius := 1; radius <= bossSummonRadius; radius++ {
+		for y := boss.Position.Y - radius; y <= boss.Position.Y+radius; y++ {
+			for x := boss.Position.X - radius; x <= boss.Position.X+radius; x++ {
+				pos := models.Position{X: x, Y: y}
+				if chebyshevDistance(boss.Position, pos) != radius || !visible[pos] || !canMobEnter(floor, pos, characters) {
+					continue
+				}
+
+				minion := models.NewMob(mobType, models.VariantNormal, boss.Level)
+				minion.Position = pos
+				floor.Mobs[minion.ID] = minion
+				floor.Tiles[pos.Y][pos.X].MobID = minion.ID
+				floor.MarkTiles(pos)
+				floor.MarkMobs(minion.ID)
+
+				minions = append(minions, minion)
+				if len(minions) == count {
+					return minions
+				}
+			}
+		}
+	}
+	return minions
+}
+
+// SealBossRooms shuts the doors of every boss room where a living boss is fighting
+// a character inside it, and opens them again once the boss is dead or nobody is
+// left in the room. Doorways with something in them are sealed once they clear.
+// It returns the doors it sealed and the doors it opened.
+func SealBossRooms(floor *models.Floor, characters []*models.Character) ([]*models.Door, []*models.Door) {
+	sealed := make([]*models.Door, 0)
+	opened := make([]*models.Door, 0)
+
+	for _, room := range floor.Rooms {
+		if room.Type != models.RoomBoss {
+			continue
+		}
+		fighting := bossInRoom(floor, room) && characterInRoom(room, characters)
+
+		for _, door := range roomDoors(floor, room) {
+			tile := &floor.Tiles[door.Position.Y][door.Position.X]
+			switch {
+			case fighting && !door.Sealed:
+				if tile.Character != "" || tile.MobID != "" || tile.ItemID != "" || tile.CorpseID != "" {
+					continue
+				}
+				door.Sealed = true
+				door.Open = false
+				tile.Walkable = false
+				sealed = append(sealed, door)
+			case !fighting && door.Sealed:
+				door.Sealed = false
+				door.Open = true
+				tile.Walkable = true
+				opened = append(opened, door)
+			default:
+				continue
+			}
+			floor.MarkTiles(door.Position)
+		}
+	}
+
+	return sealed, opened
+}
+
+// bossInRoom checks if a living boss is inside a room
+func bossInRoom(floor *models.Floor, room models.Room) bool {
+	for _, mob := range floor.Mobs {
+		if mob.Variant == models.VariantBoss && mob.HP > 0 && inRoom(room, mob.Position) {
+			return true
+		}
+	}
+	return false
+}
+
+// characterInRoom checks if a living character is inside a room
+func characterInRoom(room models.Room, characters []*models.Character) bool {
+	for _, character := range characters {
+		if !character.IsDead() && inRoom(room, character.Position) {
+			return true
+		}
+	}
+	return false
+}
+
+// roomDoors returns the doors in a room's doorways, in ID order
+func roomDoors(floor *models.Floor, room models.Room) []*models.Door {
+	doors := make([]*models.Door, 0)
+	for _, door := range floor.Doors {
+		pos := door.Position
+		alongX := pos.X >= room.X && pos.X < room.X+room.Width && (pos.Y == room.Y-1 || pos.Y == room.Y+room.Height)
+		alongY := pos.Y >= room.Y && pos.Y < room.Y+room.Height && (pos.X == room.X-1 || pos.X == room.X+room.Width)
+		if alongX || alongY {
+			doors = append(doors, door)
+		}
+	}
+	sort.Slice(doors, func(i, j int) bool { return doors[i].ID < doors[j].ID })
+	return doors
+}
@@ -0,0 +1,266 @@
+package game
+
+import (
+	"testing"
+
+	"github.com/jchauncey/TheDeeps/server/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// addBoss places a level 1 boss ogre on the floor
+func addBoss(floor *models.Floor, x, y int) *models.Mob {
+	boss := models.NewMob(models.MobOgre, models.VariantBoss, 1)
+	addMob(floor, boss, x, y)
+	return boss
+}
+
+func TestBossTurnPhasesAndSpecials(t *testing.T) {
+	floor := newOpenFloor(20, 20)
+	boss := addBoss(floor, 5, 5)
+	damage := boss.Damage
+
+	near := models.NewCharacter("Near", models.Warrior)
+	near.Position = models.Position{X: 6, Y: 5}
+	near.MaxHP, near.CurrentHP = 100, 100
+	far := models.NewCharacter("Far", models.Rogue)
+	far.Position = models.Position{X: 8, Y: 5}
+	characters := []*models.Character{near, far}
+
+	// At full HP the ogre just fights
+	action := BossTurn(floor, boss, characters)
+	assert.Empty(t, action.Message)
+	assert.False(t, action.TurnTaken)
+
+	// Wearing it down starts the next phase, which winds up its special attack
+	boss.HP = boss.MaxHP * 60 / 100
+	action = BossTurn(floor, boss, characters)
+	assert.Equal(t, "Quake", action.Phase)
+	assert.Equal(t, damage+damage*20/100, boss.Damage)
+	assert.Equal(t, "Ground Slam", action.Telegraph)
+	assert.True(t, action.TurnTaken)
+	assert.Contains(t, action.Message, "raises its club high overhead")
+	assert.Equal(t, "Ground Slam", boss.Boss.Charging)
+
+	// The slam lands on the next turn, only on characters still in reach
+	action = BossTurn(floor, boss, characters)
+	assert.Equal(t, "Ground Slam", action.Special)
+	assert.True(t, action.TurnTaken)
+	require.Len(t, action.Hits, 1)
+	assert.Equal(t, near.ID, action.Hits[0].CharacterID)
+	assert.Equal(t, 90, near.CurrentHP)
+	require.NotNil(t, action.Hits[0].Effect)
+	assert.Equal(t, models.StatusStun, action.Hits[0].Effect.Type)
+	assert.Equal(t, far.MaxHP, far.CurrentHP)
+
+	// It has to recover before winding up again
+	for i := 0; i < 3; i++ {
+		action = BossTurn(floor, boss, characters)
+		assert.Empty(t, action.Message)
+		assert.False(t, action.TurnTaken)
+	}
+	action = BossTurn(floor, boss, characters)
+	assert.Equal(t, "Ground Slam", action.Telegraph)
+}
+
+func TestBossTurnSummonsAndEnrages(t *testing.T) {
+	floor := newOpenFloor(20, 20)
+	boss := addBoss(floor, 5, 5)
+	damage := boss.Damage
+
+	character := models.NewCharacter("Fighter", models.Warrior)
+	character.Position = models.Position{X: 6, Y: 5}
+	characters := []*models.Character{character}
+
+	// A big hit runs through every phase it skips
+	boss.HP = boss.MaxHP / 10
+	action := BossTurn(floor, boss, characters)
+	assert.Equal(t, "Warband", action.Phase)
+	assert.Equal(t, 2, boss.Boss.Phase)
+	assert.Contains(t, action.Message, "bellows and pounds the floor")
+	assert.Contains(t, action.Message, "roars for its warband")
+	afterQuake := damage + damage*20/100
+	assert.Equal(t, afterQuake+afterQuake*20/100, boss.Damage)
+
+	// Minions appear next to the boss
+	require.Len(t, action.Summoned, 3)
+	for _, minion := range action.Summoned {
+		assert.Equal(t, models.MobGoblin, minion.Type)
+		assert.Equal(t, 1, chebyshevDistance(boss.Position, minion.Position))
+		assert.NotEqual(t, character.Position, minion.Position)
+		assert.Equal(t, minion.ID, floor.Tiles[minion.Position.Y][minion.Position.X].MobID)
+	}
+	assert.Len(t, floor.Mobs, 4)
+
+	// Fighting for too long enrages it
+	boss.Boss.Turns = models.Monsters().Boss(models.MobOgre).EnrageTurns - 1
+	boss.Boss.Cooldown = 5
+	before := boss.Damage
+	action = BossTurn(floor, boss, characters)
+	assert.True(t, action.Enraged)
+	assert.True(t, boss.Boss.Enraged)
+	assert.Equal(t, before+before/2, boss.Damage)
+	assert.Contains(t, action.Message, "becomes enraged")
+
+	action = BossTurn(floor, boss, characters)
+	assert.False(t, action.Enraged, "A boss only enrages once")
+}
+
+func TestSealBossRooms(t *testing.T) {
+	floor := newOpenFloor(20, 20)
+	floor.Rooms = []models.Room{{ID: "lair", Type: models.RoomBoss, X: 5, Y: 5, Width: 5, Height: 5}}
+	door := addDoor(floor, 4, 7, nil)
+	door.Open = true
+	floor.Tiles[7][4].Walkable = true
+	other := addDoor(floor, 15, 15, nil)
+	boss := addBoss(floor, 7, 7)
+
+	character := models.NewCharacter("Challenger", models.Warrior)
+	character.Position = models.Position{X: 2, Y: 2}
+	characters := []*models.Character{character}
+
+	// Nobody is fighting the boss from outside its room
+	sealed, opened := SealBossRooms(floor, characters)
+	assert.Empty(t, sealed)
+	assert.Empty(t, opened)
+
+	// Someone in the doorway holds it open
+	character.Position = models.Position{X: 5, Y: 7}
+	floor.Tiles[7][4].Character = "straggler"
+	sealed, _ = SealBossRooms(floor, characters)
+	assert.Empty(t, sealed)
+
+	floor.Tiles[7][4].Character = ""
+	sealed, opened = SealBossRooms(floor, characters)
+	assert.Equal(t, []*models.Door{door}, sealed)
+	assert.Empty(t, opened)
+	assert.True(t, door.Sealed)
+	assert.False(t, door.Open)
+	assert.False(t, floor.Tiles[7][4].Walkable)
+	assert.False(t, other.Sealed, "Only the boss room's doors seal")
+
+	_, err := Interact(floor, character, door.ID, nil)
+	assert.ErrorIs(t, err, ErrDoorSealed)
+
+	// The doors open again once the boss is dead
+	boss.HP = 0
+	sealed, opened = SealBossRooms(floor, characters)
+	assert.Empty(t, sealed)
+	assert.Equal(t, []*models.Door{door}, opened)
+	assert.False(t, door.Sealed)
+	assert.True(t, door.Open)
+	assert.True(t, floor.Tiles[7][4].Walkable)
+}
+
+func TestMobAIBossSpecialAttack(t *testing.T) {
+	ai := NewMobAI(1)
+	floor := newOpenFloor(20, 20)
+	boss := addBoss(floor, 5, 5)
+	boss.HP = boss.MaxHP / 2
+
+	character := models.NewCharacter("Target", models.Warrior)
+	character.Position = models.Position{X: 6, Y: 5}
+	character.MaxHP, character.CurrentHP = 1000, 1000
+
+	// Winding up the special attack takes the boss's turn
+	result := ai.Tick(floor, []*models.Character{character})
+	require.Len(t, result.Bosses, 1)
+	assert.Equal(t, "Ground Slam", result.Bosses[0].Telegraph)
+	assert.Empty(t, result.Attacks)
+
+	result = ai.Tick(floor, []*models.Character{character})
+	require.Len(t, result.Bosses, 1)
+	assert.Equal(t, "Ground Slam", result.Bosses[0].Special)
+	assert.Len(t, result.Bosses[0].Hits, 1)
+	assert.Empty(t, result.Attacks)
+}
+
+func TestEncounterBossAction(t *testing.T) {
+	world := newTestWorld(t, 10, 10)
+	floor := world.floor
+	manager, events := newTestEncounters(world)
+	character := world.addCharacter(t, "Fighter", 5, 5)
+	character.MaxHP, character.CurrentHP = 1000, 1000
+	goblin := models.NewMob(models.MobGoblin, models.VariantNormal, 1)
+	goblin.Damage = 1
+	addMob(floor, goblin, 6, 5)
+	boss := addBoss(floor, 4, 5)
+	boss.HP = boss.MaxHP / 2
+	boss.Damage = 1
+
+	manager.Engage(character.CurrentDungeon, floor, character, boss)
+	manager.EndTurn(character.ID)
+	manager.EndTurn(character.ID)
+
+	actions := make([]*BossAction, 0)
+	for _, event := range events.events[character.ID] {
+		if event.Type == EventBossAction {
+			actions = append(actions, event.Boss)
+		}
+	}
+	require.GreaterOrEqual(t, len(actions), 2, "The boss winds up and then unleashes its special attack")
+	assert.Equal(t, "Ground Slam", actions[0].Telegraph)
+	assert.Equal(t, "Ground Slam", actions[1].Special)
+	require.Len(t, actions[1].Hits, 1)
+	assert.Less(t, character.CurrentHP, character.MaxHP)
+}
+
+func TestBossKillRecorded(t *testing.T) {
+	manager, client, floor, dungeonID := newTestManager(t)
+	boss := addBoss(floor, 6, 10)
+
+	result := CombatResult{}
+	manager.Combat.defeatMob(client.Character, boss, &result)
+
+	dungeon, err := manager.DungeonRepo.GetByID(dungeonID)
+	require.NoError(t, err)
+	require.Len(t, dungeon.BossKills, 1)
+	assert.Equal(t, boss.Name, dungeon.BossKills[0].Name)
+	assert.Equal(t, client.Character.ID, dungeon.BossKills[0].CharacterID)
+	assert.Equal(t, 1, dungeon.BossKills[0].Floor)
+
+	// The last drop is the boss's guaranteed rare one
+	require.NotEmpty(t, result.ItemsDropped)
+	assert.True(t, result.ItemsDropped[len(result.ItemsDropped)-1].Rarity.AtLeast(models.RarityRare))
+
+	// Other kills aren't recorded
+	manager.Combat.defeatMob(client.Character, models.NewMob(models.MobGoblin, models.VariantHard, 1), &CombatResult{})
+	assert.Len(t, dungeon.BossKills, 1)
+}
+
+func TestSendMobTickResultBoss(t *testing.T) {
+	manager, client, floor, _ := newTestManager(t)
+	manager.Clients[client.ID] = client
+	manager.CharacterToClient[client.Character.ID] = client.ID
+	client.Send = make(chan Message, 32)
+
+	boss := addBoss(floor, 6, 10)
+	door := addDoor(floor, 3, 10, nil)
+	door.Sealed = true
+
+	manager.sendMobTickResult([]*Client{client}, floor, MobTickResult{
+		Bosses: []BossAction{{
+			MobID:   boss.ID,
+			Special: "Ground Slam",
+			Hits:    []BossHit{{CharacterID: client.Character.ID, Damage: 5}},
+			Message: "Boss ogre unleashes Ground Slam!",
+		}},
+		Sealed: []*models.Door{door},
+	})
+
+	var hit, sealed, diff bool
+	for _, msg := range drainMessages(client) {
+		switch {
+		case msg.Type == MsgNotification && msg.Boss != nil:
+			hit = true
+			assert.Equal(t, "Boss ogre unleashes Ground Slam! It hits you for 5 damage!", msg.Text)
+		case msg.Type == MsgNotification && msg.Text == "Stone slabs slam down over the doorways!":
+			sealed = true
+		case msg.Type == MsgFloorDiff:
+			diff = true
+		}
+	}
+	assert.True(t, hit, "The character hit by the special attack should hear about it")
+	assert.True(t, sealed, "Everyone on the floor should hear the doors seal")
+	assert.True(t, diff, "The sealed doors should be synced")
+}
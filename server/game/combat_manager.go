@@ -3,6 +3,8 @@ package game
 import (
 	"fmt"
 	"math/rand"
+	"sort"
+	"strings"
 	"time"
 
 	"github.com/jchauncey/TheDeeps/server/models"
@@ -14,15 +16,42 @@ type CombatResult struct {
 	Message      string        `json:"message"`
 	DamageDealt  int           `json:"damageDealt,omitempty"`
 	DamageTaken  int           `json:"damageTaken,omitempty"`
+	HPHealed     int           `json:"hpHealed,omitempty"` // Healed by lifesteal or abilities
 	CriticalHit  bool          `json:"criticalHit,omitempty"`
 	Killed       bool          `json:"killed,omitempty"`
 	ExpGained    int           `json:"expGained,omitempty"`
 	GoldGained   int           `json:"goldGained,omitempty"`
 	ItemsDropped []models.Item `json:"itemsDropped,omitempty"`
+	Died         bool          `json:"died,omitempty"` // The character was brought to 0 HP
+
+	StatusDamage     int                   `json:"statusDamage,omitempty"`     // Taken from the character's status effects this turn
+	StatusHealing    int                   `json:"statusHealing,omitempty"`    // Healed by the character's status effects this turn
+	EffectsApplied   []models.StatusEffect `json:"effectsApplied,omitempty"`   // Effects put on the character this turn
+	StatusEffects    models.StatusEffects  `json:"statusEffects,omitempty"`    // The character's active effects after the turn
+	MobStatusEffects models.StatusEffects  `json:"mobStatusEffects,omitempty"` // The mob's active effects after the turn
+
+	Ability   models.AbilityID `json:"ability,omitempty"`   // Ability that was cast
+	ManaSpent int              `json:"manaSpent,omitempty"` // Mana the ability cost
+	Hits      []AbilityHit     `json:"hits,omitempty"`      // Mobs the ability hit
+
+	TurnTaken bool `json:"turnTaken,omitempty"` // The action used up the character's turn
+}
+
+// AbilityHit is the damage an ability did to one mob
+type AbilityHit struct {
+	MobID        string        `json:"mobId"`
+	Damage       int           `json:"damage"`
+	Killed       bool          `json:"killed,omitempty"`
+	ItemsDropped []models.Item `json:"itemsDropped,omitempty"` // Loot placed where the mob fell
 }
 
 // CombatManager handles combat mechanics
 type CombatManager struct {
+	Parties *PartyManager // Shares the experience and loot from kills made by party members
+
+	// OnBossDefeated records a character slaying a boss
+	OnBossDefeated func(character *models.Character, mob *models.Mob)
+
 	rng *rand.Rand
 }
 
@@ -33,11 +62,53 @@ func NewCombatManager() *CombatManager {
 	}
 }
 
-// AttackMob handles a character attacking a mob
+// AttackMob handles a one-on-one exchange: the character attacks a mob, which
+// counterattacks if the attack hit without killing it
 func (cm *CombatManager) AttackMob(character *models.Character, mob *models.Mob) CombatResult {
+	result, counter := cm.strike(character, mob)
+	if counter {
+		cm.mobTurn(character, mob, &result)
+	}
+	return withStatusEffects(result, character, mob)
+}
+
+// Strike handles a character's turn attacking a mob in an encounter, where the
+// mob acts on its own turn instead of counterattacking
+func (cm *CombatManager) Strike(character *models.Character, mob *models.Mob) CombatResult {
+	result, _ := cm.strike(character, mob)
+	return withStatusEffects(result, character, mob)
+}
+
+// MobTurn handles a mob's turn in an encounter: its status effects run and then it
+// attacks the character unless it is stunned
+func (cm *CombatManager) MobTurn(character *models.Character, mob *models.Mob) CombatResult {
 	result := CombatResult{
 		Success: true,
 	}
+	cm.mobTurn(character, mob, &result)
+	result.Message = strings.TrimSpace(result.Message)
+	return withStatusEffects(result, character, mob)
+}
+
+// strike resolves a character attacking a mob and reports whether the mob gets to strike back
+func (cm *CombatManager) strike(character *models.Character, mob *models.Mob) (CombatResult, bool) {
+	result := CombatResult{
+		Success: true,
+	}
+
+	// Status effects and cooldowns run at the start of the character's turn
+	died, stunned := cm.startTurn(character, &result)
+	if died {
+		result.Success = false
+		result.Message = "You succumb to your wounds!"
+		return result, false
+	}
+
+	if stunned {
+		result.Success = false
+		result.Message = "You are stunned and can't attack!"
+		return result, true
+	}
 
 	// Calculate hit chance using the new AC system
 	mobAC := mob.CalculateAC()
@@ -51,15 +122,15 @@ func (cm *CombatManager) AttackMob(character *models.Character, mob *models.Mob)
 	if hitRoll > hitChancePercent {
 		result.Success = false
 		result.Message = fmt.Sprintf("Attack missed! (Needed %d or less, rolled %d)", hitChancePercent, hitRoll)
-		return result
+		return result, false
 	}
 
 	// Calculate damage
 	damage := character.CalculateAttackPower()
 
-	// Check for critical hit (natural 20 or 5% chance)
+	// Check for critical hit (5% chance plus affixes)
 	criticalRoll := cm.rng.Intn(100) + 1
-	if criticalRoll <= 5 {
+	if criticalRoll <= character.CalculateCritPercent() {
 		damage *= 2
 		result.CriticalHit = true
 		result.Message = "Critical hit!"
@@ -73,59 +144,293 @@ func (cm *CombatManager) AttackMob(character *models.Character, mob *models.Mob)
 		damage = 1 // Minimum damage is 1
 	}
 
+	// Elemental damage ignores defense
+	damage += character.CalculateElementalDamage()
+
 	// Apply damage to mob
 	mob.HP -= damage
 	result.DamageDealt = damage
 
+	// Lifesteal heals a share of the damage dealt
+	if healed := damage * character.CalculateLifesteal() / 100; healed > 0 {
+		healed = min(healed, character.MaxHP-character.CurrentHP)
+		character.CurrentHP += healed
+		result.HPHealed = healed
+	}
+
 	// Check if mob is killed
 	if mob.HP <= 0 {
-		mob.HP = 0
-		result.Killed = true
-		result.Message = fmt.Sprintf("%s defeated!", mob.Name)
-
-		// Calculate experience gain
-		expGain := calculateExpGain(mob, character.Level)
-		result.ExpGained = expGain
-
-		// Add experience to character
-		leveledUp := character.AddExperience(expGain)
-		if leveledUp {
-			result.Message += " Level up!"
-		}
+		cm.defeatMob(character, mob, &result)
+		return result, false
+	}
 
-		// Add gold to character
-		character.Gold += mob.GoldValue
-		result.GoldGained = mob.GoldValue
-	} else {
-		// Mob counterattack
-		characterAC := character.CalculateTotalAC()
-		mobHitChance := mob.CalculateHitChance(characterAC)
-
-		// Convert hit chance to percentage for roll
-		mobHitChancePercent := int(mobHitChance * 100)
-		mobHitRoll := cm.rng.Intn(100) + 1
-
-		// Check if mob's attack hits
-		if mobHitRoll <= mobHitChancePercent {
-			// Calculate mob damage
-			mobDamage := calculateMobDamage(mob, character)
-
-			// Apply damage to character
-			character.CurrentHP -= mobDamage
-			if character.CurrentHP < 0 {
-				character.CurrentHP = 0
-			}
+	return result, true
+}
+
+// defeatMob awards the experience, gold and loot for killing a mob
+func (cm *CombatManager) defeatMob(character *models.Character, mob *models.Mob, result *CombatResult) {
+	mob.HP = 0
+	result.Killed = true
+	result.Message = strings.TrimSpace(fmt.Sprintf("%s %s defeated!", result.Message, mob.Name))
+
+	// Calculate experience gain; party members nearby take their share
+	expGain := calculateExpGain(mob, character.Level)
+	if cm.Parties != nil {
+		expGain = cm.Parties.ShareExperience(character, expGain)
+	}
+	result.ExpGained += expGain
+
+	// Add experience to character
+	leveledUp := character.AddExperience(expGain)
+	if leveledUp {
+		result.Message += " Level up!"
+	}
 
-			result.DamageTaken = mobDamage
-			result.Message += fmt.Sprintf(" %s counterattacks for %d damage!", mob.Name, mobDamage)
+	// Add gold to character
+	character.Gold += mob.GoldValue
+	result.GoldGained += mob.GoldValue
+
+	// Roll the mob's loot under the party's loot rule; the caller places it on the floor
+	dropped := len(result.ItemsDropped)
+	for _, item := range models.Loot().RollMob(cm.rng, mob) {
+		result.ItemsDropped = append(result.ItemsDropped, *item)
+	}
+	if cm.Parties != nil {
+		cm.Parties.DistributeLoot(character, result.ItemsDropped[dropped:])
+	}
+
+	if mob.Variant == models.VariantBoss && cm.OnBossDefeated != nil {
+		cm.OnBossDefeated(character, mob)
+	}
+}
+
+// mobTurn runs the mob's status effects and then its counterattack. A stun costs
+// the mob the turn it is active at the start of, even if it runs out during it.
+func (cm *CombatManager) mobTurn(character *models.Character, mob *models.Mob, result *CombatResult) {
+	stunned := mob.StatusEffects.SkipsTurn()
+	turn := mob.StatusEffects.Tick()
+	mob.HP = min(mob.HP-turn.Damage+turn.Healing, mob.MaxHP)
+	if turn.Damage > 0 {
+		result.Message += fmt.Sprintf(" %s takes %d damage from its wounds!", mob.Name, turn.Damage)
+	}
+	if mob.HP <= 0 {
+		cm.defeatMob(character, mob, result)
+		return
+	}
+
+	if stunned {
+		result.Message += fmt.Sprintf(" %s is stunned!", mob.Name)
+		return
+	}
+
+	// Mob counterattack
+	characterAC := character.CalculateTotalAC()
+	mobHitChance := mob.CalculateHitChance(characterAC)
+
+	// Convert hit chance to percentage for roll
+	mobHitChancePercent := int(mobHitChance * 100)
+	mobHitRoll := cm.rng.Intn(100) + 1
+
+	// Check if mob's attack hits
+	if mobHitRoll <= mobHitChancePercent {
+		// Calculate mob damage
+		mobDamage := calculateMobDamage(mob, character)
+
+		// Apply damage to character
+		result.Died = damageCharacter(character, mobDamage)
+
+		result.DamageTaken = mobDamage
+		result.Message += fmt.Sprintf(" %s counterattacks for %d damage!", mob.Name, mobDamage)
+		if result.Died {
+			result.Message += fmt.Sprintf(" You have been slain by %s!", mob.Name)
 		} else {
-			result.Message += fmt.Sprintf(" %s's counterattack missed!", mob.Name)
+			cm.inflictOnHit(character, mob, result)
 		}
+	} else {
+		result.Message += fmt.Sprintf(" %s's counterattack missed!", mob.Name)
 	}
+}
+
+// ApplyToCharacter puts a status effect on a character
+func (cm *CombatManager) ApplyToCharacter(character *models.Character, effect models.StatusEffect) models.StatusEffect {
+	return character.StatusEffects.Apply(effect)
+}
 
+// ApplyToMob puts a status effect on a mob
+func (cm *CombatManager) ApplyToMob(mob *models.Mob, effect models.StatusEffect) models.StatusEffect {
+	return mob.StatusEffects.Apply(effect)
+}
+
+// startTurn runs the character's status effects and counts their cooldowns down.
+// It reports whether they died, and whether they were stunned as the turn began,
+// which costs them the turn even if the stun runs out now.
+func (cm *CombatManager) startTurn(character *models.Character, result *CombatResult) (died, stunned bool) {
+	result.TurnTaken = true
+	character.TickCooldowns()
+	stunned = character.StatusEffects.SkipsTurn()
+	turn := character.StatusEffects.Tick()
+	if turn.Healing > 0 {
+		healed := min(turn.Healing, character.MaxHP-character.CurrentHP)
+		character.CurrentHP += healed
+		result.StatusHealing = healed
+	}
+	if turn.Damage > 0 {
+		result.StatusDamage = turn.Damage
+		result.Died = damageCharacter(character, turn.Damage)
+	}
+	return result.Died, stunned
+}
+
+// inflictOnHit rolls the status effect a mob's hits can inflict on the character
+func (cm *CombatManager) inflictOnHit(character *models.Character, mob *models.Mob, result *CombatResult) {
+	effect, inflicted := models.Monsters().RollOnHit(cm.rng, mob)
+	if !inflicted {
+		return
+	}
+	applied := cm.ApplyToCharacter(character, effect)
+	result.EffectsApplied = append(result.EffectsApplied, applied)
+	result.Message += fmt.Sprintf(" You are afflicted with %s!", applied.Type)
+}
+
+// Cast handles a character using one of their class abilities. Enemy and area
+// abilities are aimed at the mob with the given ID; area abilities with no range
+// are centered on the character instead. Mobs killed by the ability are taken
+// off the floor and their loot is dropped where they fell.
+func (cm *CombatManager) Cast(character *models.Character, abilityID models.AbilityID, floor *models.Floor, targetID string) CombatResult {
+	result := CombatResult{
+		Ability: abilityID,
+	}
+
+	ability, err := character.CanCast(abilityID)
+	if err != nil {
+		result.Message = capitalize(err.Error()) + "!"
+		result.StatusEffects = character.StatusEffects
+		return result
+	}
+
+	// Find what the ability is aimed at before spending anything on it
+	target, exists := floor.Mobs[targetID]
+	if ability.Target == models.TargetEnemy || (ability.Target == models.TargetArea && ability.Range > 0) {
+		if !exists {
+			result.Message = "No target!"
+			result.StatusEffects = character.StatusEffects
+			return result
+		}
+		if !inAbilityRange(floor, character, ability, target) {
+			result.Message = fmt.Sprintf("%s is out of range!", target.Name)
+			result.StatusEffects = character.StatusEffects
+			return withStatusEffects(result, character, target)
+		}
+	}
+
+	// A target the character is fighting hand to hand gets to strike back
+	var opponent *models.Mob
+	if exists && chebyshevDistance(character.Position, target.Position) <= 1 {
+		opponent = target
+	}
+
+	died, stunned := cm.startTurn(character, &result)
+	if died {
+		result.Message = "You succumb to your wounds!"
+		result.StatusEffects = character.StatusEffects
+		return result
+	}
+
+	if stunned {
+		result.Message = fmt.Sprintf("You are stunned and can't use %s!", ability.Name)
+		if opponent != nil {
+			cm.mobTurn(character, opponent, &result)
+			return withStatusEffects(result, character, opponent)
+		}
+		result.StatusEffects = character.StatusEffects
+		return result
+	}
+
+	character.SpendAbility(ability)
+	result.Success = true
+	result.ManaSpent = ability.ManaCost
+	result.Message = fmt.Sprintf("You use %s!", ability.Name)
+
+	switch ability.Target {
+	case models.TargetSelf:
+		cm.castOnSelf(character, ability, &result)
+	case models.TargetEnemy:
+		cm.castOnMob(character, ability, floor, target, &result)
+	case models.TargetArea:
+		center := character.Position
+		if ability.Range > 0 {
+			center = target.Position
+		}
+		for _, mob := range mobsWithin(floor, center, ability.Radius) {
+			cm.castOnMob(character, ability, floor, mob, &result)
+		}
+		if len(result.Hits) == 0 {
+			result.Message += " It hits nothing."
+		}
+	}
+
+	if opponent != nil && opponent.HP > 0 {
+		dropped := len(result.ItemsDropped)
+		cm.mobTurn(character, opponent, &result)
+		if opponent.HP <= 0 {
+			placeKill(floor, opponent, &result, dropped)
+		}
+		return withStatusEffects(result, character, opponent)
+	}
+
+	result.StatusEffects = character.StatusEffects
 	return result
 }
 
+// castOnSelf applies a self ability's healing and effect to the caster
+func (cm *CombatManager) castOnSelf(character *models.Character, ability models.Ability, result *CombatResult) {
+	if healing := character.AbilityPower(ability); healing > 0 {
+		healed := min(healing, character.MaxHP-character.CurrentHP)
+		character.CurrentHP += healed
+		result.HPHealed += healed
+		result.Message += fmt.Sprintf(" You heal %d HP.", healed)
+	}
+
+	if ability.Effect != nil {
+		effect := *ability.Effect
+		effect.Source = ability.Name
+		result.EffectsApplied = append(result.EffectsApplied, cm.ApplyToCharacter(character, effect))
+	}
+}
+
+// castOnMob deals an ability's damage to a mob and applies its effect
+func (cm *CombatManager) castOnMob(character *models.Character, ability models.Ability, floor *models.Floor, mob *models.Mob, result *CombatResult) {
+	damage := character.AbilityPower(ability)
+	if ability.WeaponDamage {
+		// Weapon abilities are blunted by defense like a normal attack
+		damage = max(damage-mob.Defense, 1) + character.CalculateElementalDamage()
+	}
+
+	mob.HP -= damage
+	result.DamageDealt += damage
+	result.Hits = append(result.Hits, AbilityHit{MobID: mob.ID, Damage: damage})
+	result.Message += fmt.Sprintf(" %s takes %d damage.", mob.Name, damage)
+
+	if mob.HP <= 0 {
+		cm.killOnFloor(character, floor, mob, result)
+		return
+	}
+
+	if ability.Effect != nil {
+		effect := *ability.Effect
+		effect.Source = character.Name
+		cm.ApplyToMob(mob, effect)
+	}
+	floor.MarkMobs(mob.ID)
+}
+
+// killOnFloor awards a kill by an ability, takes the mob off the floor and drops its loot where it fell
+func (cm *CombatManager) killOnFloor(character *models.Character, floor *models.Floor, mob *models.Mob, result *CombatResult) {
+	dropped := len(result.ItemsDropped)
+	cm.defeatMob(character, mob, result)
+	placeKill(floor, mob, result, dropped)
+}
+
 // UseItem handles a character using an item during combat
 func (cm *CombatManager) UseItem(character *models.Character, item models.Item) CombatResult {
 	result := CombatResult{
@@ -142,21 +447,40 @@ func (cm *CombatManager) UseItem(character *models.Character, item models.Item)
 				character.CurrentHP = character.MaxHP
 			}
 			result.Message = fmt.Sprintf("Used %s and healed %d HP!", item.Name, healAmount)
+		} else if item.Effect != nil {
+			result.Message = fmt.Sprintf("Used %s!", item.Name)
 		} else {
 			result.Success = false
 			result.Message = "Already at full health!"
 		}
+	case models.ItemScroll:
+		// Scrolls are only useful in combat for their effect
+		if item.Effect != nil {
+			result.Message = fmt.Sprintf("Read %s!", item.Name)
+		} else {
+			result.Success = false
+			result.Message = "Cannot use this item in combat!"
+		}
 	default:
 		result.Success = false
 		result.Message = "Cannot use this item in combat!"
 	}
 
+	if result.Success && item.Effect != nil {
+		effect := *item.Effect
+		effect.Source = item.Name
+		result.EffectsApplied = append(result.EffectsApplied, cm.ApplyToCharacter(character, effect))
+	}
+	result.StatusEffects = character.StatusEffects
+
 	return result
 }
 
 // Flee handles a character attempting to flee from combat
 func (cm *CombatManager) Flee(character *models.Character, mob *models.Mob) CombatResult {
-	result := CombatResult{}
+	result := CombatResult{
+		TurnTaken: true,
+	}
 
 	// Calculate flee chance (base 50% + dexterity modifier - mob level)
 	fleeChance := 50 + models.GetModifier(character.Attributes.Dexterity)*5 - mob.Level
@@ -178,62 +502,89 @@ func (cm *CombatManager) Flee(character *models.Character, mob *models.Mob) Comb
 		// Mob gets a free attack
 		mobDamage := calculateMobDamage(mob, character)
 		result.DamageTaken = mobDamage
-		character.CurrentHP -= mobDamage
-		if character.CurrentHP < 0 {
-			character.CurrentHP = 0
+		result.Died = damageCharacter(character, mobDamage)
+		if result.Died {
+			result.Message += fmt.Sprintf(" You have been slain by %s!", mob.Name)
+		} else {
+			cm.inflictOnHit(character, mob, &result)
 		}
 	}
 
-	return result
+	return withStatusEffects(result, character, mob)
 }
 
 // Helper functions
 
-// calculateExpGain calculates experience gained from defeating a mob
-func calculateExpGain(mob *models.Mob, characterLevel int) int {
-	baseExp := 0
-
-	// Base experience based on mob type
-	switch mob.Type {
-	case models.MobSkeleton:
-		baseExp = 10
-	case models.MobGoblin:
-		baseExp = 15
-	case models.MobTroll:
-		baseExp = 25
-	case models.MobOrc:
-		baseExp = 20
-	case models.MobOgre:
-		baseExp = 30
-	case models.MobWraith:
-		baseExp = 35
-	case models.MobLich:
-		baseExp = 50
-	case models.MobOoze:
-		baseExp = 20
-	case models.MobRatman:
-		baseExp = 12
-	case models.MobDrake:
-		baseExp = 40
-	case models.MobDragon:
-		baseExp = 100
-	case models.MobElemental:
-		baseExp = 45
-	default:
-		baseExp = 10
+// placeKill takes a killed mob off the floor and drops the loot it added to the result from index dropped on
+func placeKill(floor *models.Floor, mob *models.Mob, result *CombatResult, dropped int) {
+	removeMob(floor, mob)
+	items := DropItems(floor, mob.Position, result.ItemsDropped[dropped:])
+	result.ItemsDropped = append(result.ItemsDropped[:dropped], items...)
+
+	for i := range result.Hits {
+		if result.Hits[i].MobID == mob.ID {
+			result.Hits[i].Killed = true
+			result.Hits[i].ItemsDropped = items
+		}
 	}
+}
 
-	// Adjust based on variant
-	switch mob.Variant {
-	case models.VariantEasy:
-		baseExp = int(float64(baseExp) * 0.7)
-	case models.VariantNormal:
-		// No adjustment
-	case models.VariantHard:
-		baseExp = int(float64(baseExp) * 1.5)
-	case models.VariantBoss:
-		baseExp = int(float64(baseExp) * 3.0)
+// inAbilityRange checks if a mob is within an ability's range and in the character's sight
+func inAbilityRange(floor *models.Floor, character *models.Character, ability models.Ability, mob *models.Mob) bool {
+	if chebyshevDistance(character.Position, mob.Position) > ability.Range {
+		return false
 	}
+	return ComputeFOV(floor, character.Position, ability.Range)[mob.Position]
+}
+
+// mobsWithin returns the living mobs within radius tiles of center, in ID order
+func mobsWithin(floor *models.Floor, center models.Position, radius int) []*models.Mob {
+	mobs := make([]*models.Mob, 0)
+	for _, mob := range floor.Mobs {
+		if mob.HP > 0 && chebyshevDistance(center, mob.Position) <= radius {
+			mobs = append(mobs, mob)
+		}
+	}
+	sort.Slice(mobs, func(i, j int) bool { return mobs[i].ID < mobs[j].ID })
+	return mobs
+}
+
+// capitalize upper-cases the first letter of a message
+func capitalize(text string) string {
+	if text == "" {
+		return text
+	}
+	return strings.ToUpper(text[:1]) + text[1:]
+}
+
+// withStatusEffects records the active effects of both sides of a fight in the result
+func withStatusEffects(result CombatResult, character *models.Character, mob *models.Mob) CombatResult {
+	result.StatusEffects = character.StatusEffects
+	result.MobStatusEffects = mob.StatusEffects
+	return result
+}
+
+// damageCharacter lowers a character's HP, stopping at 0, and reports whether they died
+func damageCharacter(character *models.Character, damage int) bool {
+	character.CurrentHP -= damage
+	if character.CurrentHP < 0 {
+		character.CurrentHP = 0
+	}
+	return character.IsDead()
+}
+
+// DeathCause describes a character being killed by a mob, or by their wounds when there is no mob
+func DeathCause(mob *models.Mob) string {
+	if mob == nil {
+		return "succumbed to their wounds"
+	}
+	return "slain by " + mob.Name
+}
+
+// calculateExpGain calculates experience gained from defeating a mob
+func calculateExpGain(mob *models.Mob, characterLevel int) int {
+	// Base experience from the mob's definition, scaled for its variant
+	baseExp := models.Monsters().Experience(mob.Type, mob.Variant)
 
 	// Level difference adjustment
 	levelDiff := mob.Level - characterLevel
@@ -250,8 +601,8 @@ func calculateExpGain(mob *models.Mob, characterLevel int) int {
 
 // calculateMobDamage calculates damage dealt by a mob to a character
 func calculateMobDamage(mob *models.Mob, character *models.Character) int {
-	// Base damage from mob
-	damage := mob.Damage
+	// Base damage from mob, including status effects
+	damage := mob.CalculateDamage()
 
 	// Apply character defense from equipment
 	defense := character.CalculateDefensePower()
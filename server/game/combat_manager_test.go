@@ -6,6 +6,7 @@ import (
 
 	"github.com/jchauncey/TheDeeps/server/models"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestAttackMob(t *testing.T) {
@@ -77,6 +78,64 @@ func TestAttackMob(t *testing.T) {
 	assert.True(t, mobKilled, "Mob should be killed with 1 HP remaining")
 }
 
+func TestAttackMobDropsLoot(t *testing.T) {
+	combatManager := NewCombatManager()
+
+	character := models.NewCharacter("TestWarrior", models.Warrior)
+	character.Attributes.Strength = 18
+	character.Attributes.Dexterity = 18
+
+	// Bosses always roll their variant's loot table
+	mob := models.NewMob(models.MobGoblin, models.VariantBoss, 3)
+	mob.AC = 1 // Easy to hit so the test doesn't depend on lucky rolls
+
+	var result CombatResult
+	for i := 0; i < 50; i++ {
+		mob.HP = 1
+		character.CurrentHP = character.MaxHP
+		result = combatManager.AttackMob(character, mob)
+		if result.Killed {
+			break
+		}
+	}
+
+	assert.True(t, result.Killed, "Mob should be killed with 1 HP remaining")
+	assert.GreaterOrEqual(t, len(result.ItemsDropped), 2, "A boss should drop at least two items")
+	for _, item := range result.ItemsDropped {
+		assert.NotEmpty(t, item.Rarity)
+	}
+}
+
+func TestAttackMobAffixes(t *testing.T) {
+	combatManager := NewCombatManager()
+
+	character := models.NewCharacter("TestWarrior", models.Warrior)
+	sword := models.NewWeapon("Sword", 1, 10, 1, nil)
+	sword.Affixes = []models.Affix{
+		{Name: "Flaming", Kind: models.AffixPrefix, Effect: models.EffectFire, Value: 10},
+		{Name: "of the Leech", Kind: models.AffixSuffix, Effect: models.EffectLifesteal, Value: 50},
+	}
+	character.AddToInventory(sword)
+	character.EquipItem(sword.ID)
+
+	mob := models.NewMob(models.MobSkeleton, models.VariantNormal, 1)
+	mob.AC = 1
+	mob.Defense = 100 // Only the elemental damage gets through
+
+	var result CombatResult
+	for i := 0; i < 50; i++ {
+		mob.HP = 100
+		character.CurrentHP = 1
+		result = combatManager.AttackMob(character, mob)
+		if result.DamageDealt > 0 {
+			break
+		}
+	}
+
+	assert.Equal(t, 11, result.DamageDealt, "Minimum damage plus fire damage")
+	assert.Equal(t, 5, result.HPHealed, "Half the damage dealt should be healed")
+}
+
 func TestUseItem(t *testing.T) {
 	// Create a combat manager
 	combatManager := NewCombatManager()
@@ -107,6 +166,88 @@ func TestUseItem(t *testing.T) {
 	assert.NotEmpty(t, result.Message, "Message should not be empty")
 }
 
+func TestUseItemAppliesEffect(t *testing.T) {
+	combatManager := NewCombatManager()
+	character := models.NewCharacter("TestWarrior", models.Warrior)
+
+	// Scrolls with an effect can be read in combat, even at full health
+	scroll := models.NewScroll("Scroll of Haste", 0, 30)
+	scroll.Effect = &models.StatusEffect{Type: models.StatusHaste, Duration: 3}
+
+	result := combatManager.UseItem(character, *scroll)
+	assert.True(t, result.Success)
+	require.Len(t, result.EffectsApplied, 1)
+	assert.Equal(t, "Scroll of Haste", result.EffectsApplied[0].Source)
+	assert.True(t, character.StatusEffects.Has(models.StatusHaste))
+	assert.Equal(t, character.StatusEffects, result.StatusEffects)
+}
+
+func TestAttackMobStatusEffects(t *testing.T) {
+	combatManager := NewCombatManager()
+
+	t.Run("poison ticks at the start of the turn", func(t *testing.T) {
+		character := models.NewCharacter("TestWarrior", models.Warrior)
+		character.StatusEffects.Apply(models.StatusEffect{Type: models.StatusPoison, Duration: 1, Potency: 3})
+		mob := models.NewMob(models.MobSkeleton, models.VariantNormal, 1)
+		mob.StatusEffects.Apply(models.StatusEffect{Type: models.StatusStun, Duration: 5})
+		startHP := character.CurrentHP
+
+		result := combatManager.AttackMob(character, mob)
+		assert.Equal(t, 3, result.StatusDamage)
+		assert.Equal(t, startHP-3, character.CurrentHP, "The stunned mob can't counterattack")
+		assert.Empty(t, result.StatusEffects, "Poison should have run out")
+		assert.True(t, result.MobStatusEffects.Has(models.StatusStun))
+	})
+
+	t.Run("status damage can kill the character", func(t *testing.T) {
+		character := models.NewCharacter("TestWarrior", models.Warrior)
+		character.CurrentHP = 2
+		character.StatusEffects.Apply(models.StatusEffect{Type: models.StatusBurn, Duration: 2, Potency: 5})
+		mob := models.NewMob(models.MobSkeleton, models.VariantNormal, 1)
+
+		result := combatManager.AttackMob(character, mob)
+		assert.True(t, result.Died)
+		assert.False(t, result.Success)
+		assert.Equal(t, mob.MaxHP, mob.HP, "A dead character doesn't attack")
+	})
+
+	t.Run("stunned characters lose their attack", func(t *testing.T) {
+		character := models.NewCharacter("TestWarrior", models.Warrior)
+		character.StatusEffects.Apply(models.StatusEffect{Type: models.StatusStun, Duration: 2})
+		mob := models.NewMob(models.MobSkeleton, models.VariantNormal, 1)
+
+		result := combatManager.AttackMob(character, mob)
+		assert.False(t, result.Success)
+		assert.Contains(t, result.Message, "stunned")
+		assert.Equal(t, mob.MaxHP, mob.HP)
+	})
+
+	t.Run("a one turn stun costs the character their attack", func(t *testing.T) {
+		character := models.NewCharacter("TestWarrior", models.Warrior)
+		character.StatusEffects.Apply(models.StatusEffect{Type: models.StatusStun, Duration: 1})
+		mob := models.NewMob(models.MobSkeleton, models.VariantNormal, 1)
+
+		result := combatManager.AttackMob(character, mob)
+		assert.False(t, result.Success)
+		assert.Contains(t, result.Message, "stunned")
+		assert.Equal(t, mob.MaxHP, mob.HP)
+		assert.False(t, character.StatusEffects.Has(models.StatusStun))
+	})
+
+	t.Run("status damage can kill the mob", func(t *testing.T) {
+		character := models.NewCharacter("TestWarrior", models.Warrior)
+		character.StatusEffects.Apply(models.StatusEffect{Type: models.StatusStun, Duration: 2})
+		mob := models.NewMob(models.MobSkeleton, models.VariantNormal, 1)
+		mob.HP = 1
+		mob.StatusEffects.Apply(models.StatusEffect{Type: models.StatusPoison, Duration: 2, Potency: 1})
+
+		result := combatManager.AttackMob(character, mob)
+		assert.True(t, result.Killed)
+		assert.Equal(t, 0, mob.HP)
+		assert.Greater(t, result.ExpGained, 0)
+	})
+}
+
 func TestFlee(t *testing.T) {
 	// Create a combat manager
 	combatManager := NewCombatManager()
@@ -130,6 +271,31 @@ func TestFlee(t *testing.T) {
 	}
 }
 
+func TestFleeCanKillCharacter(t *testing.T) {
+	combatManager := NewCombatManager()
+
+	character := models.NewCharacter("TestWarrior", models.Warrior)
+	character.Attributes.Dexterity = 3 // Low dexterity so fleeing usually fails
+
+	mob := models.NewMob(models.MobSkeleton, models.VariantNormal, 1)
+	mob.Damage = 50
+
+	// Flee until the mob gets its free attack
+	var result CombatResult
+	for i := 0; i < 100; i++ {
+		character.CurrentHP = 1
+		result = combatManager.Flee(character, mob)
+		if !result.Success {
+			break
+		}
+	}
+
+	assert.False(t, result.Success, "At least one flee attempt should fail")
+	assert.True(t, result.Died, "Taking the last hit point should kill the character")
+	assert.Equal(t, 0, character.CurrentHP, "HP should not go below 0")
+	assert.Contains(t, result.Message, "slain")
+}
+
 func TestHitChanceCalculation(t *testing.T) {
 	// Test cases with different hit chances and roll values
 	testCases := []struct {
@@ -388,3 +554,119 @@ func TestCalculateExpGain(t *testing.T) {
 		})
 	}
 }
+
+func TestCastFireball(t *testing.T) {
+	combatManager := NewCombatManager()
+	floor := newOpenFloor(20, 20)
+
+	mage := models.NewCharacter("TestMage", models.Mage)
+	mage.Position = models.Position{X: 2, Y: 2}
+
+	target := models.NewMob(models.MobSkeleton, models.VariantNormal, 1)
+	target.HP, target.MaxHP = 100, 100
+	addMob(floor, target, 6, 2)
+	neighbor := models.NewMob(models.MobGoblin, models.VariantNormal, 1)
+	neighbor.HP = 1
+	addMob(floor, neighbor, 7, 3)
+	distant := models.NewMob(models.MobOrc, models.VariantNormal, 1)
+	addMob(floor, distant, 15, 15)
+
+	result := combatManager.Cast(mage, models.AbilityFireball, floor, target.ID)
+	require.True(t, result.Success, result.Message)
+	assert.Equal(t, 8, result.ManaSpent)
+	assert.Equal(t, mage.MaxMana-8, mage.CurrentMana)
+	assert.Len(t, result.Hits, 2, "The target and the mob next to it should be hit")
+
+	// The target burns, the neighbor is killed and the distant mob is untouched
+	assert.Less(t, target.HP, 100)
+	assert.True(t, target.StatusEffects.Has(models.StatusBurn))
+	assert.True(t, result.Killed)
+	assert.NotContains(t, floor.Mobs, neighbor.ID, "Killed mobs should be taken off the floor")
+	assert.Empty(t, floor.Tiles[3][7].MobID)
+	assert.Equal(t, distant.MaxHP, distant.HP)
+
+	// Fireball is on cooldown now
+	result = combatManager.Cast(mage, models.AbilityFireball, floor, target.ID)
+	assert.False(t, result.Success)
+	assert.Contains(t, result.Message, "cooldown")
+}
+
+func TestCastTargeting(t *testing.T) {
+	combatManager := NewCombatManager()
+	floor := newOpenFloor(20, 20)
+
+	rogue := models.NewCharacter("TestRogue", models.Rogue)
+	rogue.Position = models.Position{X: 2, Y: 2}
+	mob := models.NewMob(models.MobSkeleton, models.VariantNormal, 1)
+	addMob(floor, mob, 5, 2)
+
+	// Backstab needs the target next to the rogue
+	result := combatManager.Cast(rogue, models.AbilityBackstab, floor, mob.ID)
+	assert.False(t, result.Success)
+	assert.Contains(t, result.Message, "out of range")
+	assert.Equal(t, rogue.MaxMana, rogue.CurrentMana, "Nothing should be spent on a failed cast")
+
+	result = combatManager.Cast(rogue, models.AbilityBackstab, floor, "missing")
+	assert.False(t, result.Success)
+
+	result = combatManager.Cast(rogue, models.AbilityHeal, floor, mob.ID)
+	assert.False(t, result.Success, "Rogues can't heal")
+}
+
+func TestCastCleave(t *testing.T) {
+	combatManager := NewCombatManager()
+	floor := newOpenFloor(10, 10)
+
+	warrior := models.NewCharacter("TestWarrior", models.Warrior)
+	warrior.Position = models.Position{X: 5, Y: 5}
+	for _, pos := range []models.Position{{X: 4, Y: 4}, {X: 6, Y: 5}, {X: 8, Y: 8}} {
+		mob := models.NewMob(models.MobSkeleton, models.VariantNormal, 1)
+		mob.HP, mob.MaxHP = 100, 100
+		addMob(floor, mob, pos.X, pos.Y)
+	}
+
+	result := combatManager.Cast(warrior, models.AbilityCleave, floor, "")
+	require.True(t, result.Success, result.Message)
+	assert.Len(t, result.Hits, 2, "Cleave should hit the adjacent mobs only")
+	assert.Equal(t, 0, result.ManaSpent)
+	assert.Equal(t, result.Hits[0].Damage+result.Hits[1].Damage, result.DamageDealt)
+}
+
+func TestCastStunningStrike(t *testing.T) {
+	combatManager := NewCombatManager()
+	floor := newOpenFloor(10, 10)
+
+	monk := models.NewCharacter("TestMonk", models.Monk)
+	monk.Position = models.Position{X: 5, Y: 5}
+	mob := models.NewMob(models.MobSkeleton, models.VariantNormal, 1)
+	mob.HP, mob.MaxHP = 100, 100
+	addMob(floor, mob, 6, 5)
+	startHP := monk.CurrentHP
+
+	// The stun lasts one turn, which is the counterattack it just cost the mob
+	result := combatManager.Cast(monk, models.AbilityStunningStrike, floor, mob.ID)
+	require.True(t, result.Success, result.Message)
+	assert.Contains(t, result.Message, "is stunned")
+	assert.Equal(t, 0, result.DamageTaken)
+	assert.Equal(t, startHP, monk.CurrentHP)
+	assert.False(t, mob.StatusEffects.Has(models.StatusStun), "The stun should have run out")
+}
+
+func TestCastHeal(t *testing.T) {
+	combatManager := NewCombatManager()
+	floor := newOpenFloor(10, 10)
+
+	cleric := models.NewCharacter("TestCleric", models.Cleric)
+	cleric.CurrentHP = 1
+
+	result := combatManager.Cast(cleric, models.AbilityHeal, floor, "")
+	require.True(t, result.Success, result.Message)
+	assert.Greater(t, result.HPHealed, 0)
+	assert.Equal(t, 1+result.HPHealed, cleric.CurrentHP)
+	assert.Equal(t, 2, cleric.Cooldowns[models.AbilityHeal])
+
+	// A turn spent attacking counts the cooldown down
+	mob := models.NewMob(models.MobSkeleton, models.VariantNormal, 1)
+	combatManager.AttackMob(cleric, mob)
+	assert.Equal(t, 1, cleric.Cooldowns[models.AbilityHeal])
+}
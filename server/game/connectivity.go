@@ -0,0 +1,82 @@
+package game
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/jchauncey/TheDeeps/server/models"
+)
+
+// CheckConnectivity checks that both staircases and every walkable tile and door
+// of a floor can be reached from where characters arrive: the up stairs, or the
+// first room on floors without them. Doors count as open, since every door can be
+// opened one way or another.
+func CheckConnectivity(floor *models.Floor) error {
+	start, found := arrivalPosition(floor)
+	if !found {
+		return errors.New("floor has nowhere to arrive")
+	}
+	reached := passableFrom(floor, start)
+
+	var errs []error
+	for _, pos := range append(append([]models.Position(nil), floor.UpStairs...), floor.DownStairs...) {
+		if !reached[pos] {
+			errs = append(errs, fmt.Errorf("stairs at (%d, %d) can't be reached", pos.X, pos.Y))
+		}
+	}
+
+	unreached := 0
+	var first models.Position
+	for y := 0; y < floor.Height; y++ {
+		for x := 0; x < floor.Width; x++ {
+			pos := models.Position{X: x, Y: y}
+			if passable(floor.Tiles[y][x]) && !reached[pos] {
+				if unreached == 0 {
+					first = pos
+				}
+				unreached++
+			}
+		}
+	}
+	if unreached > 0 {
+		errs = append(errs, fmt.Errorf("%d tiles can't be reached, the first at (%d, %d)", unreached, first.X, first.Y))
+	}
+
+	return errors.Join(errs...)
+}
+
+// arrivalPosition returns where characters arrive on a floor
+func arrivalPosition(floor *models.Floor) (models.Position, bool) {
+	if len(floor.UpStairs) > 0 {
+		return floor.UpStairs[0], true
+	}
+	if len(floor.Rooms) > 0 {
+		return roomCenter(floor.Rooms[0]), true
+	}
+	return models.Position{}, false
+}
+
+// passableFrom flood-fills the tiles reachable from a position, moving orthogonally
+// through walkable tiles and doors
+func passableFrom(floor *models.Floor, start models.Position) map[models.Position]bool {
+	reached := map[models.Position]bool{start: true}
+	queue := []models.Position{start}
+	for len(queue) > 0 {
+		pos := queue[0]
+		queue = queue[1:]
+		for _, dir := range []models.Position{{X: 0, Y: -1}, {X: 1, Y: 0}, {X: 0, Y: 1}, {X: -1, Y: 0}} {
+			next := models.Position{X: pos.X + dir.X, Y: pos.Y + dir.Y}
+			if reached[next] || !hasTile(floor, next) || !passable(floor.Tiles[next.Y][next.X]) {
+				continue
+			}
+			reached[next] = true
+			queue = append(queue, next)
+		}
+	}
+	return reached
+}
+
+// passable checks if characters can get through a tile, opening it if it is a door
+func passable(tile models.Tile) bool {
+	return tile.Walkable || tile.DoorID != ""
+}
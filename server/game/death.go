@@ -0,0 +1,230 @@
+package game
+
+import (
+	"time"
+
+	"github.com/jchauncey/TheDeeps/server/models"
+)
+
+// DeathPenalty configures what a character loses when they die
+type DeathPenalty struct {
+	XPLossPercent   int  // Share of the experience earned toward the next level that is lost
+	GoldLossPercent int  // Share of carried gold left on the corpse
+	DropInventory   bool // Whether unequipped items are left on the corpse
+}
+
+// DefaultDeathPenalty is used unless the server is configured otherwise
+var DefaultDeathPenalty = DeathPenalty{
+	XPLossPercent:   10,
+	GoldLossPercent: 25,
+	DropInventory:   true,
+}
+
+// DeathEvent describes a character's death and respawn
+type DeathEvent struct {
+	CharacterID   string          `json:"characterId"`
+	CharacterName string          `json:"characterName"`
+	Cause         string          `json:"cause"`
+	Floor         int             `json:"floor"`
+	Position      models.Position `json:"position"`
+	CorpseID      string          `json:"corpseId,omitempty"`
+	ExpLost       int             `json:"expLost"`
+	GoldLost      int             `json:"goldLost"`
+	ItemsDropped  int             `json:"itemsDropped"`
+	Deaths        int             `json:"deaths"`
+	Respawn       models.Position `json:"respawn"`
+}
+
+// KillCharacter handles a character dying on a floor: it applies the penalty,
+// leaves a corpse with the dropped gold and items, records the death and
+// respawns the character at full health in the floor's safe or entrance room.
+func KillCharacter(floor *models.Floor, dungeonID string, character *models.Character, cause string, penalty DeathPenalty) DeathEvent {
+	event := DeathEvent{
+		CharacterID:   character.ID,
+		CharacterName: character.Name,
+		Cause:         cause,
+		Floor:         floor.Level,
+		Position:      character.Position,
+	}
+
+	// Experience is lost without ever dropping a level
+	event.ExpLost = character.CurrentLevelExperience() * penalty.XPLossPercent / 100
+	character.Experience -= event.ExpLost
+
+	corpse := models.NewCorpse(character, cause)
+	event.GoldLost = character.Gold * penalty.GoldLossPercent / 100
+	character.Gold -= event.GoldLost
+	corpse.Gold = event.GoldLost
+
+	if penalty.DropInventory {
+		for _, item := range append([]*models.Item(nil), character.Inventory...) {
+			if item.Equipped {
+				continue
+			}
+			if dropped, ok := character.RemoveFromInventory(item.ID); ok {
+				dropped.Position = corpse.Position
+				corpse.Items = append(corpse.Items, *dropped)
+			}
+		}
+	}
+	event.ItemsDropped = len(corpse.Items)
+
+	if !corpse.IsEmpty() && hasTile(floor, corpse.Position) {
+		event.CorpseID = placeCorpse(floor, corpse)
+	}
+
+	character.RecordDeath(models.DeathRecord{
+		Cause:     cause,
+		DungeonID: dungeonID,
+		Floor:     floor.Level,
+		Position:  character.Position,
+		Time:      time.Now(),
+	})
+	event.Deaths = character.Deaths
+
+	// Move the character to the respawn point
+	if hasTile(floor, character.Position) && floor.Tiles[character.Position.Y][character.Position.X].Character == character.ID {
+		floor.Tiles[character.Position.Y][character.Position.X].Character = ""
+	}
+	respawn := RespawnPosition(floor, character.Position)
+	if hasTile(floor, respawn) {
+		floor.Tiles[respawn.Y][respawn.X].Character = character.ID
+	}
+	floor.MarkTiles(event.Position, respawn)
+
+	character.Position = respawn
+	character.CurrentHP = character.MaxHP
+	character.CurrentMana = character.MaxMana
+	event.Respawn = respawn
+
+	return event
+}
+
+// placeCorpse leaves a corpse on the floor and returns the ID of the corpse holding
+// its loot. A corpse never covers another: dying on your own corpse adds to it, and
+// otherwise the corpse is moved to the closest tile without one.
+func placeCorpse(floor *models.Floor, corpse *models.Corpse) string {
+	if floor.Corpses == nil {
+		floor.Corpses = make(map[string]*models.Corpse)
+	}
+
+	if existing, exists := floor.Corpses[floor.Tiles[corpse.Position.Y][corpse.Position.X].CorpseID]; exists {
+		pos, found := freeCorpseTile(floor, corpse.Position)
+		if existing.CharacterID == corpse.CharacterID || !found {
+			existing.Gold += corpse.Gold
+			existing.Items = append(existing.Items, corpse.Items...)
+			floor.MarkTiles(existing.Position)
+			return existing.ID
+		}
+
+		corpse.Position = pos
+		for i := range corpse.Items {
+			corpse.Items[i].Position = pos
+		}
+	}
+
+	floor.Corpses[corpse.ID] = corpse
+	floor.Tiles[corpse.Position.Y][corpse.Position.X].CorpseID = corpse.ID
+	floor.MarkTiles(corpse.Position)
+	return corpse.ID
+}
+
+// freeCorpseTile finds the closest walkable tile without a corpse
+func freeCorpseTile(floor *models.Floor, origin models.Position) (models.Position, bool) {
+	for distance := 1; distance <= floor.Width+floor.Height; distance++ {
+		for dy := -distance; dy <= distance; dy++ {
+			for dx := -distance; dx <= distance; dx++ {
+				if abs(dx)+abs(dy) != distance {
+					continue
+				}
+
+				pos := models.Position{X: origin.X + dx, Y: origin.Y + dy}
+				if hasTile(floor, pos) && floor.Tiles[pos.Y][pos.X].Walkable && floor.Tiles[pos.Y][pos.X].CorpseID == "" {
+					return pos, true
+				}
+			}
+		}
+	}
+
+	return models.Position{}, false
+}
+
+// RespawnPosition picks a free tile in the floor's safe room, or its entrance
+// room if there is no safe room. It returns fallback if neither has space.
+func RespawnPosition(floor *models.Floor, fallback models.Position) models.Position {
+	for _, roomType := range []models.RoomType{models.RoomSafe, models.RoomEntrance} {
+		for _, room := range floor.Rooms {
+			if room.Type != roomType {
+				continue
+			}
+			if pos, ok := freeTileInRoom(floor, room); ok {
+				return pos
+			}
+		}
+	}
+
+	if len(floor.UpStairs) > 0 {
+		return floor.UpStairs[0]
+	}
+	return fallback
+}
+
+// freeTileInRoom finds the free tile closest to the center of a room
+func freeTileInRoom(floor *models.Floor, room models.Room) (models.Position, bool) {
+	center := models.Position{X: room.X + room.Width/2, Y: room.Y + room.Height/2}
+
+	best := models.Position{}
+	found := false
+	for y := room.Y; y < room.Y+room.Height; y++ {
+		for x := room.X; x < room.X+room.Width; x++ {
+			pos := models.Position{X: x, Y: y}
+			if !hasTile(floor, pos) {
+				continue
+			}
+
+			tile := floor.Tiles[y][x]
+			if !tile.Walkable || tile.MobID != "" || tile.Character != "" ||
+				tile.Type == models.TileUpStairs || tile.Type == models.TileDownStairs {
+				continue
+			}
+
+			if !found || manhattanDistance(pos, center) < manhattanDistance(best, center) {
+				best = pos
+				found = true
+			}
+		}
+	}
+
+	return best, found
+}
+
+// LootCorpse moves as much of a corpse's gold and items to the character as they
+// can carry. Empty corpses are removed from the floor. It returns the number of
+// items and gold taken.
+func LootCorpse(floor *models.Floor, corpse *models.Corpse, character *models.Character) (int, int) {
+	gold := corpse.Gold
+	character.Gold += gold
+	corpse.Gold = 0
+
+	taken := 0
+	remaining := make([]models.Item, 0, len(corpse.Items))
+	for _, item := range corpse.Items {
+		item := item
+		if character.CanAddItem(&item) && character.AddToInventory(&item) {
+			taken++
+			continue
+		}
+		remaining = append(remaining, item)
+	}
+	corpse.Items = remaining
+
+	if corpse.IsEmpty() {
+		delete(floor.Corpses, corpse.ID)
+		if hasTile(floor, corpse.Position) && floor.Tiles[corpse.Position.Y][corpse.Position.X].CorpseID == corpse.ID {
+			floor.Tiles[corpse.Position.Y][corpse.Position.X].CorpseID = ""
+		}
+	}
+	floor.MarkTiles(corpse.Position)
+
+	return taken, gold
+}
@@ -0,0 +1,296 @@
+package game
+
+import (
+	"testing"
+
+	"github.com/jchauncey/TheDeeps/server/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newDeathFloor creates an open floor with an entrance room and a safe room
+func newDeathFloor() *models.Floor {
+	floor := newOpenFloor(40, 20)
+	floor.Rooms = []models.Room{
+		{ID: "entrance", Type: models.RoomEntrance, X: 2, Y: 2, Width: 5, Height: 5},
+		{ID: "safe", Type: models.RoomSafe, X: 30, Y: 10, Width: 5, Height: 5},
+	}
+	return floor
+}
+
+// newDyingCharacter creates a character with 0 HP standing on the floor
+func newDyingCharacter(floor *models.Floor, x, y int) *models.Character {
+	character := models.NewCharacter("Fallen", models.Warrior)
+	character.Level = 2
+	character.Experience = 1500
+	character.Gold = 100
+	character.CurrentHP = 0
+	character.CurrentMana = 0
+	character.Position = models.Position{X: x, Y: y}
+	floor.Tiles[y][x].Character = character.ID
+	return character
+}
+
+func TestKillCharacter(t *testing.T) {
+	floor := newDeathFloor()
+	character := newDyingCharacter(floor, 15, 10)
+
+	potion := models.NewPotion("Health Potion", 20, 5)
+	require.True(t, character.AddToInventory(potion))
+	sword := models.NewWeapon("Sword", 5, 10, 1, nil)
+	require.True(t, character.AddToInventory(sword))
+	require.True(t, character.EquipItem(sword.ID))
+
+	event := KillCharacter(floor, "dungeon", character, "slain by Goblin", DeathPenalty{
+		XPLossPercent:   10,
+		GoldLossPercent: 25,
+		DropInventory:   true,
+	})
+
+	// Penalties
+	assert.Equal(t, 50, event.ExpLost, "10% of the 500 experience earned this level should be lost")
+	assert.Equal(t, 1450, character.Experience)
+	assert.Equal(t, 2, character.Level, "Dying should never cost a level")
+	assert.Equal(t, 25, event.GoldLost)
+	assert.Equal(t, 75, character.Gold)
+
+	// The corpse keeps the dropped gold and unequipped items
+	require.NotEmpty(t, event.CorpseID)
+	corpse := floor.Corpses[event.CorpseID]
+	require.NotNil(t, corpse)
+	assert.Equal(t, models.Position{X: 15, Y: 10}, corpse.Position)
+	assert.Equal(t, 25, corpse.Gold)
+	require.Len(t, corpse.Items, 1)
+	assert.Equal(t, potion.ID, corpse.Items[0].ID)
+	assert.Equal(t, event.CorpseID, floor.Tiles[10][15].CorpseID)
+	_, kept := character.GetInventoryItem(sword.ID)
+	assert.True(t, kept, "Equipped items should be kept")
+	_, kept = character.GetInventoryItem(potion.ID)
+	assert.False(t, kept, "Unequipped items should be dropped")
+
+	// Death statistics
+	assert.Equal(t, 1, character.Deaths)
+	assert.Equal(t, 1, event.Deaths)
+	require.NotNil(t, character.LastDeath)
+	assert.Equal(t, "slain by Goblin", character.LastDeath.Cause)
+	assert.Equal(t, models.Position{X: 15, Y: 10}, character.LastDeath.Position)
+
+	// Respawn in the safe room at full health
+	assert.Equal(t, models.Position{X: 32, Y: 12}, character.Position, "The character should respawn at the center of the safe room")
+	assert.Equal(t, event.Respawn, character.Position)
+	assert.Equal(t, character.MaxHP, character.CurrentHP)
+	assert.Equal(t, character.MaxMana, character.CurrentMana)
+	assert.Empty(t, floor.Tiles[10][15].Character)
+	assert.Equal(t, character.ID, floor.Tiles[12][32].Character)
+
+	// Both tiles are sent to clients
+	floor.Commit()
+	changes, ok := floor.ChangesSince(0)
+	require.True(t, ok)
+	assert.ElementsMatch(t, []models.Position{{X: 15, Y: 10}, {X: 32, Y: 12}}, changes.Tiles)
+}
+
+func TestKillCharacterWithoutPenalty(t *testing.T) {
+	floor := newDeathFloor()
+	character := newDyingCharacter(floor, 15, 10)
+	require.True(t, character.AddToInventory(models.NewPotion("Health Potion", 20, 5)))
+
+	event := KillCharacter(floor, "dungeon", character, "slain by Goblin", DeathPenalty{})
+
+	assert.Zero(t, event.ExpLost)
+	assert.Zero(t, event.GoldLost)
+	assert.Equal(t, 1500, character.Experience)
+	assert.Equal(t, 100, character.Gold)
+	assert.Len(t, character.Inventory, 1)
+	assert.Empty(t, event.CorpseID, "Nothing was dropped, so no corpse should be left")
+	assert.Empty(t, floor.Corpses)
+	assert.Equal(t, 1, character.Deaths)
+}
+
+func TestKillCharacterOnCorpse(t *testing.T) {
+	floor := newDeathFloor()
+	first := newDyingCharacter(floor, 15, 10)
+	firstDeath := KillCharacter(floor, "dungeon", first, "slain by Goblin", DefaultDeathPenalty)
+
+	// Someone else dying on the same tile leaves their corpse on the closest free tile
+	second := newDyingCharacter(floor, 15, 10)
+	secondDeath := KillCharacter(floor, "dungeon", second, "slain by Goblin", DefaultDeathPenalty)
+	require.Len(t, floor.Corpses, 2)
+	assert.Equal(t, firstDeath.CorpseID, floor.Tiles[10][15].CorpseID, "The first corpse should stay where it fell")
+	moved := floor.Corpses[secondDeath.CorpseID]
+	require.NotNil(t, moved)
+	assert.Equal(t, 1, manhattanDistance(moved.Position, models.Position{X: 15, Y: 10}))
+	assert.Equal(t, moved.ID, floor.Tiles[moved.Position.Y][moved.Position.X].CorpseID)
+
+	// Dying on your own corpse adds to it
+	first.CurrentHP = 0
+	first.Gold = 100
+	first.Position = models.Position{X: 15, Y: 10}
+	again := KillCharacter(floor, "dungeon", first, "slain by Goblin", DefaultDeathPenalty)
+	assert.Equal(t, firstDeath.CorpseID, again.CorpseID)
+	assert.Len(t, floor.Corpses, 2)
+	assert.Equal(t, firstDeath.GoldLost+again.GoldLost, floor.Corpses[firstDeath.CorpseID].Gold)
+}
+
+func TestRespawnPosition(t *testing.T) {
+	floor := newDeathFloor()
+	fallback := models.Position{X: 20, Y: 10}
+
+	// The safe room is preferred, skipping occupied tiles
+	floor.Tiles[12][32].MobID = "mob"
+	pos := RespawnPosition(floor, fallback)
+	assert.NotEqual(t, models.Position{X: 32, Y: 12}, pos)
+	assert.True(t, pos.X >= 30 && pos.X < 35 && pos.Y >= 10 && pos.Y < 15, "The respawn should be in the safe room")
+
+	// Without a safe room the entrance is used
+	floor.Rooms = floor.Rooms[:1]
+	assert.Equal(t, models.Position{X: 4, Y: 4}, RespawnPosition(floor, fallback))
+
+	// Without either the up stairs are used, then the fallback
+	floor.Rooms = nil
+	floor.UpStairs = []models.Position{{X: 10, Y: 10}}
+	assert.Equal(t, models.Position{X: 10, Y: 10}, RespawnPosition(floor, fallback))
+	floor.UpStairs = nil
+	assert.Equal(t, fallback, RespawnPosition(floor, fallback))
+}
+
+func TestLootCorpse(t *testing.T) {
+	floor := newDeathFloor()
+	character := newDyingCharacter(floor, 15, 10)
+	potion := models.NewPotion("Health Potion", 20, 5)
+	require.True(t, character.AddToInventory(potion))
+
+	event := KillCharacter(floor, "dungeon", character, "slain by Goblin", DefaultDeathPenalty)
+	corpse := floor.Corpses[event.CorpseID]
+	require.NotNil(t, corpse)
+	floor.Commit()
+
+	items, gold := LootCorpse(floor, corpse, character)
+	assert.Equal(t, 1, items)
+	assert.Equal(t, event.GoldLost, gold)
+	assert.Equal(t, 100, character.Gold, "All the dropped gold should be recovered")
+	_, recovered := character.GetInventoryItem(potion.ID)
+	assert.True(t, recovered)
+
+	// The empty corpse is removed
+	assert.Empty(t, floor.Corpses)
+	assert.Empty(t, floor.Tiles[10][15].CorpseID)
+	floor.Commit()
+	changes, ok := floor.ChangesSince(1)
+	require.True(t, ok)
+	assert.Contains(t, changes.Tiles, models.Position{X: 15, Y: 10})
+}
+
+// drainMessages returns every message queued for a client
+func drainMessages(client *Client) []Message {
+	messages := make([]Message, 0)
+	for {
+		select {
+		case msg := <-client.Send:
+			messages = append(messages, msg)
+		default:
+			return messages
+		}
+	}
+}
+
+func TestMobTickKillsCharacter(t *testing.T) {
+	manager, client, floor, dungeonID := newTestManager(t)
+	manager.Clients[client.ID] = client
+	manager.CharacterToClient[client.Character.ID] = client.ID
+	client.Send = make(chan Message, 32)
+
+	floor.Rooms = []models.Room{{ID: "safe", Type: models.RoomSafe, X: 30, Y: 10, Width: 5, Height: 5}}
+	mob := models.NewMob(models.MobGoblin, models.VariantNormal, 1)
+	addMob(floor, mob, 6, 10)
+
+	client.Character.CurrentHP = 0
+	manager.sendMobTickResult([]*Client{client}, floor, MobTickResult{
+		Attacks: []MobAttack{{MobID: mob.ID, CharacterID: client.Character.ID, Hit: true, Damage: 5}},
+	})
+
+	var death *DeathEvent
+	for _, msg := range drainMessages(client) {
+		if msg.Type == MsgDeath {
+			death = msg.Death
+		}
+	}
+	require.NotNil(t, death, "The floor should be told about the death")
+	assert.Equal(t, DeathCause(mob), death.Cause)
+	assert.Equal(t, models.Position{X: 5, Y: 10}, death.Position)
+	assert.Equal(t, models.Position{X: 32, Y: 12}, death.Respawn)
+	assert.Equal(t, client.Character.MaxHP, client.Character.CurrentHP)
+	assert.Equal(t, 1, client.Character.Deaths)
+
+	saved, err := manager.CharacterRepo.GetByID(client.Character.ID)
+	require.NoError(t, err)
+	assert.Equal(t, 1, saved.Deaths, "The death should be saved")
+
+	savedFloor, err := manager.DungeonRepo.GetFloor(dungeonID, 1)
+	require.NoError(t, err)
+	assert.Equal(t, client.Character.ID, savedFloor.Tiles[12][32].Character)
+}
+
+func TestMobTickDeathLeavesEncounter(t *testing.T) {
+	manager, client, floor, dungeonID := newTestManager(t)
+	manager.Clients[client.ID] = client
+	manager.CharacterToClient[client.Character.ID] = client.ID
+	client.Send = make(chan Message, 32)
+
+	fighting := models.NewMob(models.MobSkeleton, models.VariantNormal, 1)
+	fighting.HP, fighting.MaxHP, fighting.Damage = 1000, 1000, 1
+	addMob(floor, fighting, 6, 10)
+	manager.Encounters.Engage(dungeonID, floor, client.Character, fighting)
+	require.True(t, manager.Encounters.InEncounter(client.Character.ID))
+
+	// A mob outside the fight lands the killing blow
+	killer := models.NewMob(models.MobGoblin, models.VariantNormal, 1)
+	addMob(floor, killer, 4, 10)
+	client.Character.CurrentHP = 0
+	manager.sendMobTickResult([]*Client{client}, floor, MobTickResult{
+		Attacks: []MobAttack{{MobID: killer.ID, CharacterID: client.Character.ID, Hit: true, Damage: 5}},
+	})
+
+	assert.Equal(t, 1, client.Character.Deaths)
+	assert.False(t, manager.Encounters.InEncounter(client.Character.ID), "Dying should leave the encounter")
+}
+
+func TestHandleLoot(t *testing.T) {
+	manager, client, floor, dungeonID := newTestManager(t)
+	client.Send = make(chan Message, 32)
+	floor.Rooms = []models.Room{{ID: "safe", Type: models.RoomSafe, X: 30, Y: 10, Width: 5, Height: 5}}
+	character := client.Character
+	character.Gold = 100
+	character.CurrentHP = 0
+
+	event := manager.HandleDeath(dungeonID, floor, character, "slain by Goblin")
+	require.NotEmpty(t, event.CorpseID)
+	drainMessages(client)
+
+	// Looting away from the corpse fails
+	manager.HandleMessage(client, Message{Type: MsgLoot})
+	msg := <-client.Send
+	assert.Equal(t, MsgError, msg.Type)
+	assert.Equal(t, "There is no corpse here", msg.Error)
+
+	// Someone else's corpse can't be looted
+	other := models.NewCorpse(models.NewCharacter("Other", models.Rogue), "slain by Orc")
+	other.Gold = 10
+	other.Position = character.Position
+	floor.Corpses[other.ID] = other
+	floor.Tiles[character.Position.Y][character.Position.X].CorpseID = other.ID
+	manager.HandleMessage(client, Message{Type: MsgLoot})
+	msg = <-client.Send
+	assert.Equal(t, "You can only loot your own corpse", msg.Error)
+	floor.Tiles[character.Position.Y][character.Position.X].CorpseID = ""
+
+	// Walking back to the corpse recovers the gold
+	floor.Tiles[character.Position.Y][character.Position.X].Character = ""
+	character.Position = event.Position
+	floor.Tiles[event.Position.Y][event.Position.X].Character = character.ID
+	manager.HandleMessage(client, Message{Type: MsgLoot})
+	msg = <-client.Send
+	assert.Equal(t, MsgNotification, msg.Type)
+	assert.Equal(t, 100, character.Gold)
+	assert.NotContains(t, floor.Corpses, event.CorpseID)
+}
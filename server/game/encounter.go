@@ -0,0 +1,645 @@
+package game
+
+import (
+	"errors"
+	"math/rand"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jchauncey/TheDeeps/server/log"
+	"github.com/jchauncey/TheDeeps/server/models"
+	"github.com/jchauncey/TheDeeps/server/repositories"
+)
+
+const defaultTurnTimeout = 30 * time.Second // How long a player has to act before their turn is skipped
+
+var (
+	// ErrNotYourTurn is returned when a character acts out of turn in an encounter
+	ErrNotYourTurn = errors.New("it's not your turn")
+	// ErrEncounterOver is returned when the mobs' first turns end a fight before the character acts
+	ErrEncounterOver = errors.New("the fight ended before you could act")
+)
+
+// CombatantKind tells characters and mobs apart in an encounter
+type CombatantKind string
+
+const (
+	CombatantCharacter CombatantKind = "character"
+	CombatantMob       CombatantKind = "mob"
+)
+
+// EncounterEventType is the kind of event streamed to the characters in an encounter
+type EncounterEventType string
+
+const (
+	EventEncounterStart EncounterEventType = "encounterStart"
+	EventTurnChange     EncounterEventType = "turnChange"
+	EventMobAction      EncounterEventType = "mobAction"
+	EventBossAction     EncounterEventType = "bossAction"
+	EventEncounterEnd   EncounterEventType = "encounterEnd"
+)
+
+// Reasons an encounter ends
+const (
+	EndMobsDefeated  = "mobsDefeated"
+	EndCharactersOut = "charactersOut"
+)
+
+// Combatant is a character or mob taking part in an encounter
+type Combatant struct {
+	ID         string        `json:"id"`
+	Kind       CombatantKind `json:"kind"`
+	Name       string        `json:"name"`
+	Initiative int           `json:"initiative"`
+	Dexterity  int           `json:"-"`             // Breaks initiative ties
+	Out        bool          `json:"out,omitempty"` // Killed, fled or disconnected; their turns are passed over
+}
+
+// Encounter is a fight between characters and mobs taking turns in initiative order
+type Encounter struct {
+	ID           string      `json:"id"`
+	DungeonID    string      `json:"dungeonId"`
+	FloorLevel   int         `json:"floorLevel"`
+	Order        []Combatant `json:"order"`
+	Turn         int         `json:"turn"` // Index in Order of whoever is acting
+	Round        int         `json:"round"`
+	TurnDeadline time.Time   `json:"turnDeadline,omitempty"` // When an idle character's turn is skipped
+
+	turns int // Counts turns so stale timeouts can tell they are too late
+	timer *time.Timer
+}
+
+// EncounterEvent tells a character what happened in their encounter
+type EncounterEvent struct {
+	Type      EncounterEventType `json:"type"`
+	Encounter Encounter          `json:"encounter"`
+	Current   *Combatant         `json:"current,omitempty"` // Whose turn it is now
+	Skipped   string             `json:"skipped,omitempty"` // Combatant whose turn timed out
+	MobID     string             `json:"mobId,omitempty"`   // Mob that acted, for mobAction
+	Result    *CombatResult      `json:"result,omitempty"`  // What the mob's action did, for mobAction
+	Boss      *BossAction        `json:"boss,omitempty"`    // What the boss's fight did, for bossAction
+	Reason    string             `json:"reason,omitempty"`  // Why the encounter ended
+}
+
+// Current returns the combatant whose turn it is
+func (e *Encounter) Current() Combatant {
+	return e.Order[e.Turn]
+}
+
+// snapshot copies the encounter so it can be sent while the original keeps changing
+func (e *Encounter) snapshot() Encounter {
+	return Encounter{
+		ID:           e.ID,
+		DungeonID:    e.DungeonID,
+		FloorLevel:   e.FloorLevel,
+		Order:        append([]Combatant(nil), e.Order...),
+		Turn:         e.Turn,
+		Round:        e.Round,
+		TurnDeadline: e.TurnDeadline,
+	}
+}
+
+// living counts the combatants of a kind that are still in the fight
+func (e *Encounter) living(kind CombatantKind) int {
+	count := 0
+	for _, combatant := range e.Order {
+		if combatant.Kind == kind && !combatant.Out {
+			count++
+		}
+	}
+	return count
+}
+
+// index returns the position of a combatant in the turn order
+func (e *Encounter) index(id string) int {
+	for i, combatant := range e.Order {
+		if combatant.ID == id {
+			return i
+		}
+	}
+	return -1
+}
+
+// sortOrder puts the combatants in initiative order, keeping the turn on whoever is acting
+func (e *Encounter) sortOrder() {
+	current := ""
+	if len(e.Order) > 0 {
+		current = e.Current().ID
+	}
+	sort.SliceStable(e.Order, func(i, j int) bool {
+		a, b := e.Order[i], e.Order[j]
+		if a.Initiative != b.Initiative {
+			return a.Initiative > b.Initiative
+		}
+		if a.Dexterity != b.Dexterity {
+			return a.Dexterity > b.Dexterity
+		}
+		return a.ID < b.ID
+	})
+	if i := e.index(current); i >= 0 {
+		e.Turn = i
+	}
+}
+
+// next moves the turn to the next combatant still in the fight, starting a new round after the last
+func (e *Encounter) next() {
+	for range e.Order {
+		e.Turn++
+		if e.Turn >= len(e.Order) {
+			e.Turn = 0
+			e.Round++
+		}
+		if !e.Order[e.Turn].Out {
+			break
+		}
+	}
+	e.turns++
+}
+
+// EncounterManager runs turn-based encounters. Mobs take their turns as soon as
+// they come up; characters act through the combat handler and are skipped if they
+// don't act within TurnTimeout. Mob turns change floors and characters, so callers
+// hold the World lock, which idle timeouts take for themselves.
+type EncounterManager struct {
+	CharacterRepo repositories.CharacterStore
+	DungeonRepo   repositories.DungeonStore
+	Combat        *CombatManager
+	TurnTimeout   time.Duration
+	World         *sync.Mutex // The game's world lock
+
+	// Notify streams an event to a character in an encounter
+	Notify func(characterID string, event EncounterEvent)
+	// OnDeath handles a character killed by a mob's turn
+	OnDeath func(dungeonID string, floor *models.Floor, character *models.Character, mob *models.Mob)
+
+	rng         *rand.Rand
+	encounters  map[string]*Encounter
+	byCombatant map[string]string
+	mutex       sync.Mutex
+
+	// engagedMutex also guards byCombatant, so InEncounter can be called by code
+	// holding locks that encounter callbacks take
+	engagedMutex sync.RWMutex
+}
+
+// NewEncounterManager creates a new encounter manager
+func NewEncounterManager(characterRepo repositories.CharacterStore, dungeonRepo repositories.DungeonStore, combat *CombatManager) *EncounterManager {
+	return &EncounterManager{
+		CharacterRepo: characterRepo,
+		DungeonRepo:   dungeonRepo,
+		Combat:        combat,
+		TurnTimeout:   defaultTurnTimeout,
+		World:         &sync.Mutex{},
+		rng:           rand.New(rand.NewSource(time.Now().UnixNano())),
+		encounters:    make(map[string]*Encounter),
+		byCombatant:   make(map[string]string),
+	}
+}
+
+// Get returns a copy of the encounter a character or mob is in
+func (m *EncounterManager) Get(id string) (Encounter, bool) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	encounter, exists := m.encounters[m.byCombatant[id]]
+	if !exists {
+		return Encounter{}, false
+	}
+	return encounter.snapshot(), true
+}
+
+// InEncounter checks if a character or mob is fighting in an encounter
+func (m *EncounterManager) InEncounter(id string) bool {
+	m.engagedMutex.RLock()
+	defer m.engagedMutex.RUnlock()
+
+	_, exists := m.byCombatant[id]
+	return exists
+}
+
+// Engage puts a character and the mob they are attacking into an encounter. A new
+// encounter also pulls in the other mobs next to the character; joining an existing
+// one adds whichever of the two isn't in it yet. Mobs whose turns come up before the
+// character's act right away.
+func (m *EncounterManager) Engage(dungeonID string, floor *models.Floor, character *models.Character, mob *models.Mob) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	encounterID, inEncounter := m.byCombatant[character.ID]
+	if !inEncounter {
+		encounterID, inEncounter = m.byCombatant[mob.ID]
+	}
+
+	if inEncounter {
+		encounter := m.encounters[encounterID]
+		joined := m.join(encounter, m.characterCombatant(character))
+		joined = m.join(encounter, m.mobCombatant(mob)) || joined
+		if joined {
+			encounter.sortOrder()
+			m.notifyAll(encounter, EncounterEvent{Type: EventEncounterStart, Encounter: encounter.snapshot()})
+		}
+		return
+	}
+
+	encounter := &Encounter{
+		ID:         uuid.New().String(),
+		DungeonID:  dungeonID,
+		FloorLevel: floor.Level,
+		Round:      1,
+	}
+	m.encounters[encounter.ID] = encounter
+	m.join(encounter, m.characterCombatant(character))
+	m.join(encounter, m.mobCombatant(mob))
+	for _, other := range mobsWithin(floor, character.Position, 1) {
+		if other.Type != models.MobShopkeeper {
+			m.join(encounter, m.mobCombatant(other))
+		}
+	}
+	encounter.sortOrder()
+	encounter.Turn = 0
+
+	m.notifyAll(encounter, EncounterEvent{Type: EventEncounterStart, Encounter: encounter.snapshot()})
+	m.runTurns(encounter)
+}
+
+// CheckTurn returns ErrNotYourTurn if the character is in an encounter and someone else is acting
+func (m *EncounterManager) CheckTurn(characterID string) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	encounter, exists := m.encounters[m.byCombatant[characterID]]
+	if exists && encounter.Current().ID != characterID {
+		return ErrNotYourTurn
+	}
+	return nil
+}
+
+// EndTurn finishes a character's turn and runs the turns that follow until it's a character's turn again
+func (m *EncounterManager) EndTurn(characterID string) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	encounter, exists := m.encounters[m.byCombatant[characterID]]
+	if !exists || encounter.Current().ID != characterID {
+		return
+	}
+
+	encounter.next()
+	m.runTurns(encounter)
+}
+
+// Leave takes a character out of their encounter after they fled, died or disconnected
+func (m *EncounterManager) Leave(characterID string) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	encounter, exists := m.encounters[m.byCombatant[characterID]]
+	if !exists {
+		return
+	}
+
+	m.markOut(encounter, characterID)
+	if encounter.Current().ID == characterID {
+		encounter.next()
+	}
+	m.runTurns(encounter)
+}
+
+// Disengage takes a character out of their encounter once they have moved out of
+// reach of every mob still fighting in it, and reports whether they left
+func (m *EncounterManager) Disengage(floor *models.Floor, character *models.Character) bool {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	encounter, exists := m.encounters[m.byCombatant[character.ID]]
+	if !exists {
+		return false
+	}
+	if encounter.DungeonID == character.CurrentDungeon && encounter.FloorLevel == character.CurrentFloor {
+		for _, combatant := range encounter.Order {
+			if combatant.Kind != CombatantMob || combatant.Out {
+				continue
+			}
+			if mob, exists := floor.Mobs[combatant.ID]; exists && chebyshevDistance(mob.Position, character.Position) <= 1 {
+				return false
+			}
+		}
+	}
+
+	m.markOut(encounter, character.ID)
+	if encounter.Current().ID == character.ID {
+		encounter.next()
+	}
+	m.runTurns(encounter)
+	return true
+}
+
+// join adds a combatant to an encounter and reports whether they were new to it
+func (m *EncounterManager) join(encounter *Encounter, combatant Combatant) bool {
+	if _, exists := m.byCombatant[combatant.ID]; exists {
+		return false
+	}
+	m.engagedMutex.Lock()
+	m.byCombatant[combatant.ID] = encounter.ID
+	m.engagedMutex.Unlock()
+
+	// Someone who left comes back at their old place in the order
+	if i := encounter.index(combatant.ID); i >= 0 {
+		encounter.Order[i].Out = false
+		return true
+	}
+	encounter.Order = append(encounter.Order, combatant)
+	return true
+}
+
+// characterCombatant rolls a character's initiative: a d20 plus their Dexterity modifier
+func (m *EncounterManager) characterCombatant(character *models.Character) Combatant {
+	dexterity := character.EffectiveAttributes().Dexterity
+	return Combatant{
+		ID:         character.ID,
+		Kind:       CombatantCharacter,
+		Name:       character.Name,
+		Initiative: m.rng.Intn(20) + 1 + models.GetModifier(dexterity),
+		Dexterity:  dexterity,
+	}
+}
+
+// mobCombatant rolls a mob's initiative: a d20 plus its Dexterity modifier
+func (m *EncounterManager) mobCombatant(mob *models.Mob) Combatant {
+	return Combatant{
+		ID:         mob.ID,
+		Kind:       CombatantMob,
+		Name:       mob.Name,
+		Initiative: m.rng.Intn(20) + 1 + models.GetModifier(mob.Dexterity),
+		Dexterity:  mob.Dexterity,
+	}
+}
+
+// markOut takes a combatant out of the fight; they stay in the order so everyone can see what happened
+func (m *EncounterManager) markOut(encounter *Encounter, id string) {
+	if i := encounter.index(id); i >= 0 {
+		encounter.Order[i].Out = true
+	}
+	m.engagedMutex.Lock()
+	delete(m.byCombatant, id)
+	m.engagedMutex.Unlock()
+}
+
+// runTurns plays mob turns until it's a character's turn or the encounter is over.
+// The caller must hold the manager's lock.
+func (m *EncounterManager) runTurns(encounter *Encounter) {
+	if encounter.timer != nil {
+		encounter.timer.Stop()
+		encounter.timer = nil
+	}
+
+	floor, err := m.DungeonRepo.GetFloor(encounter.DungeonID, encounter.FloorLevel)
+	if err != nil {
+		log.Error("Failed to get floor for encounter %s: %v", encounter.ID, err)
+		m.end(encounter, EndCharactersOut)
+		return
+	}
+
+	for {
+		// Mobs killed since the last turn drop out
+		for _, combatant := range encounter.Order {
+			if combatant.Kind == CombatantMob && !combatant.Out {
+				if mob, exists := floor.Mobs[combatant.ID]; !exists || mob.HP <= 0 {
+					m.markOut(encounter, combatant.ID)
+				}
+			}
+		}
+
+		if encounter.living(CombatantMob) == 0 {
+			m.end(encounter, EndMobsDefeated)
+			return
+		}
+		if encounter.living(CombatantCharacter) == 0 {
+			m.end(encounter, EndCharactersOut)
+			return
+		}
+		if encounter.Current().Out {
+			encounter.next()
+			continue
+		}
+
+		current := encounter.Current()
+		if current.Kind == CombatantCharacter {
+			m.startCharacterTurn(encounter)
+			return
+		}
+
+		encounter.TurnDeadline = time.Time{}
+		m.notifyTurn(encounter, "")
+		m.takeMobTurn(encounter, floor, floor.Mobs[current.ID])
+		encounter.next()
+	}
+}
+
+// startCharacterTurn tells everyone whose turn it is and starts the timeout for idle players
+func (m *EncounterManager) startCharacterTurn(encounter *Encounter) {
+	encounter.TurnDeadline = time.Now().Add(m.TurnTimeout)
+	m.notifyTurn(encounter, "")
+
+	turn := encounter.turns
+	encounter.timer = time.AfterFunc(m.TurnTimeout, func() {
+		m.skipIdle(encounter.ID, turn)
+	})
+}
+
+// skipIdle passes over a character who didn't act in time
+func (m *EncounterManager) skipIdle(encounterID string, turn int) {
+	m.World.Lock()
+	defer m.World.Unlock()
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	encounter, exists := m.encounters[encounterID]
+	if !exists || encounter.turns != turn {
+		return
+	}
+
+	skipped := encounter.Current().ID
+	log.Info("Skipping idle character %s in encounter %s", skipped, encounter.ID)
+	encounter.next()
+	encounter.TurnDeadline = time.Time{}
+	m.notifyTurn(encounter, skipped)
+	m.runTurns(encounter)
+}
+
+// takeMobTurn has a mob attack the weakest character next to it. A mob with nobody
+// in reach only has its status effects run. Bosses run their fight first and may
+// spend the turn on it.
+func (m *EncounterManager) takeMobTurn(encounter *Encounter, floor *models.Floor, mob *models.Mob) {
+	if mob.Boss != nil && m.takeBossTurn(encounter, floor, mob) {
+		return
+	}
+
+	var target *models.Character
+	var fallback *models.Character
+	for _, combatant := range encounter.Order {
+		if combatant.Kind != CombatantCharacter || combatant.Out {
+			continue
+		}
+		character, err := m.CharacterRepo.GetByID(combatant.ID)
+		if err != nil {
+			continue
+		}
+		if fallback == nil {
+			fallback = character
+		}
+		if chebyshevDistance(mob.Position, character.Position) > 1 {
+			continue
+		}
+		if target == nil || character.CurrentHP < target.CurrentHP {
+			target = character
+		}
+	}
+
+	var result CombatResult
+	switch {
+	case target != nil:
+		result = m.Combat.MobTurn(target, mob)
+		if mob.HP <= 0 {
+			placeKill(floor, mob, &result, 0)
+		}
+		if err := m.CharacterRepo.Save(target); err != nil {
+			log.Error("Failed to save character %s: %v", target.ID, err)
+		}
+	case fallback != nil:
+		// Out of reach: the mob's effects still run, and a kill goes to the first character
+		turn := mob.StatusEffects.Tick()
+		mob.HP = min(mob.HP-turn.Damage+turn.Healing, mob.MaxHP)
+		result = CombatResult{Success: false, Message: mob.Name + " can't reach anyone."}
+		if mob.HP <= 0 {
+			m.Combat.defeatMob(fallback, mob, &result)
+			placeKill(floor, mob, &result, 0)
+			if err := m.CharacterRepo.Save(fallback); err != nil {
+				log.Error("Failed to save character %s: %v", fallback.ID, err)
+			}
+		}
+		result.MobStatusEffects = mob.StatusEffects
+	default:
+		return
+	}
+
+	floor.MarkMobs(mob.ID)
+	if err := m.DungeonRepo.SaveFloor(encounter.DungeonID, encounter.FloorLevel, floor); err != nil {
+		log.Error("Failed to save floor %d of dungeon %s: %v", encounter.FloorLevel, encounter.DungeonID, err)
+	}
+
+	m.notifyAll(encounter, EncounterEvent{
+		Type:      EventMobAction,
+		Encounter: encounter.snapshot(),
+		MobID:     mob.ID,
+		Result:    &result,
+	})
+
+	if result.Died && target != nil {
+		m.markOut(encounter, target.ID)
+		if m.OnDeath != nil {
+			m.OnDeath(encounter.DungeonID, floor, target, mob)
+		}
+	}
+}
+
+// takeBossTurn runs a boss's fight against the characters in its encounter and
+// reports whether that used up the boss's turn. Summoned minions join the encounter.
+func (m *EncounterManager) takeBossTurn(encounter *Encounter, floor *models.Floor, boss *models.Mob) bool {
+	characters := make([]*models.Character, 0)
+	for _, combatant := range encounter.Order {
+		if combatant.Kind != CombatantCharacter || combatant.Out {
+			continue
+		}
+		if character, err := m.CharacterRepo.GetByID(combatant.ID); err == nil {
+			characters = append(characters, character)
+		}
+	}
+
+	action := BossTurn(floor, boss, characters)
+	if action.Message == "" {
+		return false
+	}
+
+	for _, minion := range action.Summoned {
+		m.join(encounter, m.mobCombatant(minion))
+	}
+	encounter.sortOrder()
+
+	hit := make(map[string]bool, len(action.Hits))
+	for _, h := range action.Hits {
+		hit[h.CharacterID] = true
+	}
+	for _, character := range characters {
+		if !hit[character.ID] {
+			continue
+		}
+		if err := m.CharacterRepo.Save(character); err != nil {
+			log.Error("Failed to save character %s: %v", character.ID, err)
+		}
+	}
+	if err := m.DungeonRepo.SaveFloor(encounter.DungeonID, encounter.FloorLevel, floor); err != nil {
+		log.Error("Failed to save floor %d of dungeon %s: %v", encounter.FloorLevel, encounter.DungeonID, err)
+	}
+
+	m.notifyAll(encounter, EncounterEvent{
+		Type:      EventBossAction,
+		Encounter: encounter.snapshot(),
+		MobID:     boss.ID,
+		Boss:      &action,
+	})
+
+	for _, character := range characters {
+		if character.IsDead() && hit[character.ID] {
+			m.markOut(encounter, character.ID)
+			if m.OnDeath != nil {
+				m.OnDeath(encounter.DungeonID, floor, character, boss)
+			}
+		}
+	}
+	return action.TurnTaken
+}
+
+// end finishes an encounter and tells everyone who took part
+func (m *EncounterManager) end(encounter *Encounter, reason string) {
+	if encounter.timer != nil {
+		encounter.timer.Stop()
+		encounter.timer = nil
+	}
+	m.engagedMutex.Lock()
+	for _, combatant := range encounter.Order {
+		if m.byCombatant[combatant.ID] == encounter.ID {
+			delete(m.byCombatant, combatant.ID)
+		}
+	}
+	m.engagedMutex.Unlock()
+	delete(m.encounters, encounter.ID)
+
+	encounter.TurnDeadline = time.Time{}
+	m.notifyAll(encounter, EncounterEvent{Type: EventEncounterEnd, Encounter: encounter.snapshot(), Reason: reason})
+}
+
+// notifyTurn tells everyone in the encounter whose turn it is
+func (m *EncounterManager) notifyTurn(encounter *Encounter, skipped string) {
+	current := encounter.Current()
+	m.notifyAll(encounter, EncounterEvent{
+		Type:      EventTurnChange,
+		Encounter: encounter.snapshot(),
+		Current:   &current,
+		Skipped:   skipped,
+	})
+}
+
+// notifyAll sends an event to every character that took part in the encounter
+func (m *EncounterManager) notifyAll(encounter *Encounter, event EncounterEvent) {
+	if m.Notify == nil {
+		return
+	}
+	for _, combatant := range encounter.Order {
+		if combatant.Kind == CombatantCharacter {
+			m.Notify(combatant.ID, event)
+		}
+	}
+}
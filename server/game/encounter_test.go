@@ -0,0 +1,267 @@
+package game
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jchauncey/TheDeeps/server/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// encounterEvents records the events an encounter manager streams to each character
+type encounterEvents struct {
+	events map[string][]EncounterEvent
+	mutex  sync.Mutex
+}
+
+func (e *encounterEvents) notify(characterID string, event EncounterEvent) {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	e.events[characterID] = append(e.events[characterID], event)
+}
+
+// types lists the event types a character got, in order
+func (e *encounterEvents) types(characterID string) []EncounterEventType {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	types := make([]EncounterEventType, 0, len(e.events[characterID]))
+	for _, event := range e.events[characterID] {
+		types = append(types, event.Type)
+	}
+	return types
+}
+
+// last returns the latest event a character got
+func (e *encounterEvents) last(characterID string) EncounterEvent {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	events := e.events[characterID]
+	return events[len(events)-1]
+}
+
+// newTestEncounters creates an encounter manager for a test world, recording the events it streams
+func newTestEncounters(world *testWorld) (*EncounterManager, *encounterEvents) {
+	events := &encounterEvents{events: make(map[string][]EncounterEvent)}
+	manager := NewEncounterManager(world.characterRepo, world.dungeonRepo, NewCombatManager())
+	manager.Notify = events.notify
+	return manager, events
+}
+
+func TestEngageStartsEncounter(t *testing.T) {
+	world := newTestWorld(t, 10, 10)
+	floor := world.floor
+	manager, events := newTestEncounters(world)
+	character := world.addCharacter(t, "Fighter", 5, 5)
+	character.MaxHP, character.CurrentHP = 1000, 1000
+	mob := models.NewMob(models.MobGoblin, models.VariantNormal, 1)
+	mob.Damage = 1
+	addMob(floor, mob, 6, 5)
+
+	// Mobs next to the character join the fight, shopkeepers don't
+	other := models.NewMob(models.MobRatman, models.VariantNormal, 1)
+	addMob(floor, other, 4, 4)
+	shopkeeper := models.NewMob(models.MobShopkeeper, models.VariantNormal, 1)
+	addMob(floor, shopkeeper, 5, 4)
+	far := models.NewMob(models.MobOoze, models.VariantNormal, 1)
+	addMob(floor, far, 1, 1)
+
+	manager.Engage(character.CurrentDungeon, floor, character, mob)
+
+	encounter, exists := manager.Get(character.ID)
+	require.True(t, exists)
+	require.Len(t, encounter.Order, 3)
+	for i := 1; i < len(encounter.Order); i++ {
+		assert.GreaterOrEqual(t, encounter.Order[i-1].Initiative, encounter.Order[i].Initiative, "Combatants act in initiative order")
+	}
+	assert.True(t, manager.InEncounter(mob.ID))
+	assert.True(t, manager.InEncounter(other.ID))
+	assert.False(t, manager.InEncounter(shopkeeper.ID))
+	assert.False(t, manager.InEncounter(far.ID))
+
+	// Mobs ahead of the character have already acted, so it's the character's turn
+	assert.Equal(t, character.ID, encounter.Current().ID)
+	assert.NoError(t, manager.CheckTurn(character.ID))
+	assert.False(t, encounter.TurnDeadline.IsZero())
+
+	types := events.types(character.ID)
+	require.NotEmpty(t, types)
+	assert.Equal(t, EventEncounterStart, types[0])
+	assert.Equal(t, EventTurnChange, types[len(types)-1])
+}
+
+func TestEndTurnRunsMobTurns(t *testing.T) {
+	world := newTestWorld(t, 10, 10)
+	floor := world.floor
+	manager, events := newTestEncounters(world)
+	character := world.addCharacter(t, "Fighter", 5, 5)
+	character.MaxHP, character.CurrentHP = 1000, 1000
+	mob := models.NewMob(models.MobGoblin, models.VariantNormal, 1)
+	mob.Damage = 1
+	addMob(floor, mob, 6, 5)
+	manager.Engage(character.CurrentDungeon, floor, character, mob)
+
+	before := len(events.types(character.ID))
+	manager.EndTurn(character.ID)
+
+	encounter, exists := manager.Get(character.ID)
+	require.True(t, exists)
+	assert.Equal(t, 2, encounter.Round)
+	assert.Equal(t, character.ID, encounter.Current().ID)
+
+	// The mob's turn came and went before the character's came back around
+	types := events.types(character.ID)[before:]
+	assert.Contains(t, types, EventMobAction)
+	assert.Equal(t, EventTurnChange, types[len(types)-1])
+
+	// Ending a turn that isn't yours does nothing
+	manager.EndTurn(mob.ID)
+	encounter, _ = manager.Get(character.ID)
+	assert.Equal(t, 2, encounter.Round)
+}
+
+func TestCheckTurnOutOfTurn(t *testing.T) {
+	world := newTestWorld(t, 10, 10)
+	floor := world.floor
+	manager, _ := newTestEncounters(world)
+	character := world.addCharacter(t, "Fighter", 5, 5)
+	character.MaxHP, character.CurrentHP = 1000, 1000
+	mob := models.NewMob(models.MobGoblin, models.VariantNormal, 1)
+	mob.Damage = 1
+	addMob(floor, mob, 6, 5)
+	manager.Engage(character.CurrentDungeon, floor, character, mob)
+
+	// A second character joins the fight but has to wait for their turn
+	second := models.NewCharacter("Latecomer", models.Rogue)
+	second.CurrentDungeon = character.CurrentDungeon
+	second.CurrentFloor = 1
+	second.Position = models.Position{X: 7, Y: 5}
+	require.NoError(t, manager.CharacterRepo.Save(second))
+	manager.Engage(second.CurrentDungeon, floor, second, mob)
+
+	encounter, exists := manager.Get(second.ID)
+	require.True(t, exists)
+	assert.Len(t, encounter.Order, 3)
+	assert.Equal(t, character.ID, encounter.Current().ID)
+	assert.ErrorIs(t, manager.CheckTurn(second.ID), ErrNotYourTurn)
+
+	// Characters outside any encounter can always act
+	assert.NoError(t, manager.CheckTurn("someone-else"))
+}
+
+func TestTurnTimeoutSkipsIdleCharacter(t *testing.T) {
+	world := newTestWorld(t, 10, 10)
+	floor := world.floor
+	manager, events := newTestEncounters(world)
+	character := world.addCharacter(t, "Fighter", 5, 5)
+	character.MaxHP, character.CurrentHP = 1000, 1000
+	mob := models.NewMob(models.MobGoblin, models.VariantNormal, 1)
+	mob.Damage = 1
+	addMob(floor, mob, 6, 5)
+	manager.TurnTimeout = 20 * time.Millisecond
+	manager.Engage(character.CurrentDungeon, floor, character, mob)
+	defer manager.Leave(character.ID)
+
+	assert.Eventually(t, func() bool {
+		encounter, exists := manager.Get(character.ID)
+		return exists && encounter.Round > 1
+	}, time.Second, 5*time.Millisecond, "The idle character's turn should be skipped")
+
+	skipped := false
+	events.mutex.Lock()
+	for _, event := range events.events[character.ID] {
+		if event.Type == EventTurnChange && event.Skipped == character.ID {
+			skipped = true
+		}
+	}
+	events.mutex.Unlock()
+	assert.True(t, skipped)
+}
+
+func TestTurnTimeoutWaitsForWorld(t *testing.T) {
+	world := newTestWorld(t, 10, 10)
+	floor := world.floor
+	manager, _ := newTestEncounters(world)
+	character := world.addCharacter(t, "Fighter", 5, 5)
+	character.MaxHP, character.CurrentHP = 1000, 1000
+	mob := models.NewMob(models.MobGoblin, models.VariantNormal, 1)
+	mob.Damage = 1
+	addMob(floor, mob, 6, 5)
+	manager.TurnTimeout = 10 * time.Millisecond
+	manager.Engage(character.CurrentDungeon, floor, character, mob)
+	defer manager.Leave(character.ID)
+
+	// Mob turns change the floor, so a timeout waits while anything else holds the world lock
+	manager.World.Lock()
+	time.Sleep(50 * time.Millisecond)
+	encounter, _ := manager.Get(character.ID)
+	assert.Equal(t, 1, encounter.Round, "The timeout should wait for the world lock")
+	manager.World.Unlock()
+
+	assert.Eventually(t, func() bool {
+		encounter, exists := manager.Get(character.ID)
+		return exists && encounter.Round > 1
+	}, time.Second, 5*time.Millisecond, "The idle character's turn should be skipped once the lock is free")
+}
+
+func TestDisengage(t *testing.T) {
+	world := newTestWorld(t, 10, 10)
+	floor := world.floor
+	manager, events := newTestEncounters(world)
+	character := world.addCharacter(t, "Fighter", 5, 5)
+	character.MaxHP, character.CurrentHP = 1000, 1000
+	mob := models.NewMob(models.MobGoblin, models.VariantNormal, 1)
+	mob.Damage = 1
+	addMob(floor, mob, 6, 5)
+	manager.Engage(character.CurrentDungeon, floor, character, mob)
+
+	// Stepping around a mob keeps the character in the fight
+	character.Position = models.Position{X: 6, Y: 6}
+	assert.False(t, manager.Disengage(floor, character))
+	assert.True(t, manager.InEncounter(character.ID))
+
+	// Walking out of reach leaves it, ending a fight nobody else is in
+	character.Position = models.Position{X: 2, Y: 2}
+	assert.True(t, manager.Disengage(floor, character))
+	assert.False(t, manager.InEncounter(character.ID))
+	assert.False(t, manager.InEncounter(mob.ID), "The mob should go back to acting in real time")
+	assert.Equal(t, EndCharactersOut, events.last(character.ID).Reason)
+
+	assert.False(t, manager.Disengage(floor, character), "Nothing to leave outside a fight")
+}
+
+func TestEncounterEnds(t *testing.T) {
+	world := newTestWorld(t, 10, 10)
+	floor := world.floor
+	manager, events := newTestEncounters(world)
+	character := world.addCharacter(t, "Fighter", 5, 5)
+	character.MaxHP, character.CurrentHP = 1000, 1000
+	mob := models.NewMob(models.MobGoblin, models.VariantNormal, 1)
+	mob.Damage = 1
+	addMob(floor, mob, 6, 5)
+	manager.Engage(character.CurrentDungeon, floor, character, mob)
+
+	// The mob dies on the character's turn
+	delete(floor.Mobs, mob.ID)
+	manager.EndTurn(character.ID)
+
+	assert.False(t, manager.InEncounter(character.ID))
+	assert.False(t, manager.InEncounter(mob.ID))
+	end := events.last(character.ID)
+	assert.Equal(t, EventEncounterEnd, end.Type)
+	assert.Equal(t, EndMobsDefeated, end.Reason)
+
+	// Leaving ends a fight nobody else is in
+	mob = models.NewMob(models.MobGoblin, models.VariantNormal, 1)
+	addMob(floor, mob, 6, 5)
+	manager.Engage(character.CurrentDungeon, floor, character, mob)
+	require.True(t, manager.InEncounter(character.ID))
+
+	manager.Leave(character.ID)
+	assert.False(t, manager.InEncounter(character.ID))
+	assert.False(t, manager.InEncounter(mob.ID))
+	end = events.last(character.ID)
+	assert.Equal(t, EventEncounterEnd, end.Type)
+	assert.Equal(t, EndCharactersOut, end.Reason)
+}
@@ -0,0 +1,283 @@
+package game
+
+import (
+	"sort"
+	"sync"
+
+	"github.com/jchauncey/TheDeeps/server/models"
+)
+
+// maxUnackedVersions is how far a client's acknowledged version may trail the
+// floor before it is sent a full resync instead of a diff
+const maxUnackedVersions = 64
+
+// TileDiff is a changed tile in a floor diff
+type TileDiff struct {
+	X    int         `json:"x"`
+	Y    int         `json:"y"`
+	Tile models.Tile `json:"tile"`
+}
+
+// FloorDiff brings a client's view of a floor from BaseVersion up to Version.
+// Everything listed is sent with its current state, so a diff can be applied
+// to any view between BaseVersion and Version.
+type FloorDiff struct {
+	Level        int              `json:"level"`
+	BaseVersion  uint64           `json:"baseVersion"`
+	Version      uint64           `json:"version"`
+	Tiles        []TileDiff       `json:"tiles,omitempty"`
+	Rooms        []models.Room    `json:"rooms,omitempty"` // Explored rooms containing changed tiles
+	Mobs         []*models.Mob    `json:"mobs,omitempty"`
+	RemovedMobs  []string         `json:"removedMobs,omitempty"`
+	Items        []models.Item    `json:"items,omitempty"`
+	RemovedItems []string         `json:"removedItems,omitempty"`
+	Corpses      []*models.Corpse `json:"corpses,omitempty"` // Corpses on changed tiles
+	Traps        []*models.Trap   `json:"traps,omitempty"`   // Revealed traps on changed tiles
+	Doors        []*models.Door   `json:"doors,omitempty"`   // Doors on changed tiles
+	Chests       []*models.Chest  `json:"chests,omitempty"`  // Chests on changed tiles
+	Puzzles      []*models.Puzzle `json:"puzzles,omitempty"` // Puzzles with a lever or plate on a changed tile
+}
+
+// empty checks if the diff changes nothing on the client
+func (d *FloorDiff) empty() bool {
+	return len(d.Tiles) == 0 && len(d.Mobs) == 0 && len(d.RemovedMobs) == 0 &&
+		len(d.Items) == 0 && len(d.RemovedItems) == 0
+}
+
+// sort orders the diff so identical changes always encode the same way
+func (d *FloorDiff) sort() {
+	sort.Slice(d.Tiles, func(i, j int) bool {
+		if d.Tiles[i].Y != d.Tiles[j].Y {
+			return d.Tiles[i].Y < d.Tiles[j].Y
+		}
+		return d.Tiles[i].X < d.Tiles[j].X
+	})
+	sort.Slice(d.Mobs, func(i, j int) bool { return d.Mobs[i].ID < d.Mobs[j].ID })
+	sort.Slice(d.Items, func(i, j int) bool { return d.Items[i].ID < d.Items[j].ID })
+	sort.Slice(d.Corpses, func(i, j int) bool { return d.Corpses[i].ID < d.Corpses[j].ID })
+	sort.Slice(d.Traps, func(i, j int) bool { return d.Traps[i].ID < d.Traps[j].ID })
+	sort.Slice(d.Doors, func(i, j int) bool { return d.Doors[i].ID < d.Doors[j].ID })
+	sort.Slice(d.Chests, func(i, j int) bool { return d.Chests[i].ID < d.Chests[j].ID })
+	sort.Slice(d.Puzzles, func(i, j int) bool { return d.Puzzles[i].ID < d.Puzzles[j].ID })
+	sort.Strings(d.RemovedMobs)
+	sort.Strings(d.RemovedItems)
+}
+
+// floorSync tracks what a client has acknowledged of the floor it is on
+type floorSync struct {
+	mutex        sync.Mutex
+	key          floorKey
+	ackedVersion uint64
+	visibility   map[uint64]Visibility // What the client was shown as visible at each sent version
+}
+
+// syncFloor returns the message that brings a client up to date with a floor:
+// a diff from the version it acknowledged, or a full view if it is too far behind.
+// It returns false when the client is already up to date.
+func (manager *GameManager) syncFloor(client *Client, dungeonID string, floor *models.Floor) (Message, bool) {
+	floor.Commit()
+
+	client.sync.mutex.Lock()
+	defer client.sync.mutex.Unlock()
+
+	diff, ok := client.sync.diff(dungeonID, floor, client.Character)
+	if !ok {
+		return client.sync.resync(dungeonID, floor, client.Character), true
+	}
+	if diff.empty() {
+		return Message{}, false
+	}
+	return Message{Type: MsgFloorDiff, Diff: diff}, true
+}
+
+// fullSync returns a full view of a floor for a client and makes it the client's new base
+func (manager *GameManager) fullSync(client *Client, dungeonID string, floor *models.Floor) Message {
+	floor.Commit()
+
+	client.sync.mutex.Lock()
+	defer client.sync.mutex.Unlock()
+
+	return client.sync.resync(dungeonID, floor, client.Character)
+}
+
+// handleAck records the floor version a client has applied
+func (manager *GameManager) handleAck(client *Client, message Message) {
+	client.sync.mutex.Lock()
+	defer client.sync.mutex.Unlock()
+
+	// Only versions we actually sent can become the base for later diffs
+	if _, sent := client.sync.visibility[message.Version]; !sent || message.Version <= client.sync.ackedVersion {
+		return
+	}
+
+	client.sync.ackedVersion = message.Version
+	for version := range client.sync.visibility {
+		if version < message.Version {
+			delete(client.sync.visibility, version)
+		}
+	}
+}
+
+// handleResync sends a client the full view of its floor. Like every reply sent
+// while the world lock is held, it is dropped if the client's queue is full; the
+// client's next resync or ack brings it up to date.
+func (manager *GameManager) handleResync(client *Client, message Message) {
+	if client.Character == nil || client.Character.CurrentDungeon == "" {
+		queueMessage(client, Message{
+			Type:  MsgError,
+			Error: "Character not in a dungeon",
+		})
+		return
+	}
+
+	floor, err := manager.DungeonRepo.GetFloor(client.Character.CurrentDungeon, client.Character.CurrentFloor)
+	if err != nil {
+		queueMessage(client, Message{
+			Type:  MsgError,
+			Error: "Floor not found",
+		})
+		return
+	}
+
+	queueMessage(client, manager.fullSync(client, client.Character.CurrentDungeon, floor))
+}
+
+// resync builds a full view of the floor and resets the client's base to it
+func (s *floorSync) resync(dungeonID string, floor *models.Floor, character *models.Character) Message {
+	visible := UpdateExploration(floor, dungeonID, character)
+
+	s.key = floorKey{dungeonID: dungeonID, level: floor.Level}
+	s.ackedVersion = floor.Version
+	s.visibility = map[uint64]Visibility{floor.Version: visible}
+
+	return Message{
+		Type:  MsgFloorChange,
+		Floor: FloorView(floor, character.ExploredFloor(dungeonID, floor), visible),
+	}
+}
+
+// diff builds the changes between the client's acknowledged view and its current
+// view. It returns false when the client needs a full resync instead.
+func (s *floorSync) diff(dungeonID string, floor *models.Floor, character *models.Character) (*FloorDiff, bool) {
+	if s.key != (floorKey{dungeonID: dungeonID, level: floor.Level}) || floor.Version-s.ackedVersion > maxUnackedVersions {
+		return nil, false
+	}
+
+	changes, ok := floor.ChangesSince(s.ackedVersion)
+	if !ok {
+		return nil, false
+	}
+	baseVisible, ok := s.visibility[s.ackedVersion]
+	if !ok {
+		return nil, false
+	}
+
+	visible := UpdateExploration(floor, dungeonID, character)
+	explored := character.ExploredFloor(dungeonID, floor)
+	diff := &FloorDiff{
+		Level:       floor.Level,
+		BaseVersion: s.ackedVersion,
+		Version:     floor.Version,
+	}
+
+	// Tiles that changed, plus tiles that came into or went out of sight
+	tiles := make(map[models.Position]bool)
+	for _, pos := range changes.Tiles {
+		tiles[pos] = true
+	}
+	for pos := range visible {
+		if !baseVisible[pos] {
+			tiles[pos] = true
+		}
+	}
+	for pos := range baseVisible {
+		if !visible[pos] {
+			tiles[pos] = true
+		}
+	}
+
+	rooms := make(map[string]bool)
+	puzzles := make(map[string]bool)
+	for pos := range tiles {
+		if !explored.Has(pos.X, pos.Y) {
+			continue
+		}
+		tile := viewTile(floor, explored, visible, pos)
+		diff.Tiles = append(diff.Tiles, TileDiff{X: pos.X, Y: pos.Y, Tile: tile})
+		if tile.RoomID != "" {
+			rooms[tile.RoomID] = true
+		}
+		if corpse, exists := floor.Corpses[tile.CorpseID]; exists {
+			diff.Corpses = append(diff.Corpses, corpse)
+		}
+		if trap, exists := floor.Traps[tile.TrapID]; exists {
+			diff.Traps = append(diff.Traps, trap)
+		}
+		if door, exists := floor.Doors[tile.DoorID]; exists {
+			diff.Doors = append(diff.Doors, doorView(door))
+		}
+		if chest, exists := floor.Chests[tile.ChestID]; exists {
+			diff.Chests = append(diff.Chests, chestView(chest))
+		}
+		if puzzle, exists := floor.Puzzles[tile.PuzzleID]; exists && !puzzles[puzzle.ID] {
+			puzzles[puzzle.ID] = true
+			diff.Puzzles = append(diff.Puzzles, puzzleView(puzzle))
+		}
+	}
+	for _, room := range floor.Rooms {
+		if rooms[room.ID] {
+			room.Explored = true
+			diff.Rooms = append(diff.Rooms, room)
+		}
+	}
+
+	// Mobs that changed, plus mobs standing on tiles that came into or went out of sight
+	mobs := make(map[string]bool)
+	for _, id := range changes.Mobs {
+		mobs[id] = true
+	}
+	for id, mob := range floor.Mobs {
+		if visible[mob.Position] != baseVisible[mob.Position] {
+			mobs[id] = true
+		}
+	}
+	for id := range mobs {
+		if mob, exists := floor.Mobs[id]; exists && visible[mob.Position] {
+			diff.Mobs = append(diff.Mobs, mob)
+		} else {
+			diff.RemovedMobs = append(diff.RemovedMobs, id)
+		}
+	}
+
+	items := make(map[string]bool)
+	for _, id := range changes.Items {
+		items[id] = true
+	}
+	for id, item := range floor.Items {
+		if visible[item.Position] != baseVisible[item.Position] {
+			items[id] = true
+		}
+	}
+	for id := range items {
+		if item, exists := floor.Items[id]; exists && visible[item.Position] {
+			diff.Items = append(diff.Items, item)
+		} else {
+			diff.RemovedItems = append(diff.RemovedItems, id)
+		}
+	}
+
+	diff.sort()
+
+	if diff.empty() {
+		// Nothing the client can see changed, so its view is already current
+		s.ackedVersion = floor.Version
+		s.visibility = map[uint64]Visibility{floor.Version: visible}
+		return diff, true
+	}
+
+	// A diff without a new version is resent from the same base until the floor moves on
+	if floor.Version != s.ackedVersion {
+		s.visibility[floor.Version] = visible
+	}
+	return diff, true
+}
@@ -0,0 +1,244 @@
+package game
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/jchauncey/TheDeeps/server/models"
+	"github.com/jchauncey/TheDeeps/server/repositories"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// addItem places an item on the floor and marks the change
+func addItem(floor *models.Floor, x, y int) models.Item {
+	item := *models.NewPotion("Health Potion", 20, 5)
+	item.Position = models.Position{X: x, Y: y}
+	floor.Items[item.ID] = item
+	floor.Tiles[y][x].ItemID = item.ID
+	floor.MarkItems(item.ID)
+	floor.MarkTiles(item.Position)
+	return item
+}
+
+func TestSyncFloorSendsDiff(t *testing.T) {
+	manager, client, floor, dungeonID := newTestManager(t)
+
+	item := addItem(floor, 7, 10)
+	msg, ok := manager.syncFloor(client, dungeonID, floor)
+	require.True(t, ok)
+	require.Equal(t, MsgFloorDiff, msg.Type)
+	require.NotNil(t, msg.Diff)
+
+	assert.Equal(t, uint64(0), msg.Diff.BaseVersion)
+	assert.Equal(t, floor.Version, msg.Diff.Version)
+	require.Len(t, msg.Diff.Items, 1)
+	assert.Equal(t, item.ID, msg.Diff.Items[0].ID)
+	require.Len(t, msg.Diff.Tiles, 1)
+	assert.Equal(t, item.ID, msg.Diff.Tiles[0].Tile.ItemID)
+
+	// Once acknowledged there is nothing left to send
+	manager.handleAck(client, Message{Type: MsgAck, Version: msg.Diff.Version})
+	_, ok = manager.syncFloor(client, dungeonID, floor)
+	assert.False(t, ok, "An up to date client should not be sent anything")
+}
+
+func TestSyncFloorResendsUnackedChanges(t *testing.T) {
+	manager, client, floor, dungeonID := newTestManager(t)
+
+	first := addItem(floor, 7, 10)
+	msg, ok := manager.syncFloor(client, dungeonID, floor)
+	require.True(t, ok)
+
+	// The client never acknowledged the first diff, so the next one repeats it
+	second := addItem(floor, 8, 10)
+	msg, ok = manager.syncFloor(client, dungeonID, floor)
+	require.True(t, ok)
+	assert.Equal(t, uint64(0), msg.Diff.BaseVersion, "Diffs should be built from the acknowledged version")
+	require.Len(t, msg.Diff.Items, 2)
+	ids := []string{msg.Diff.Items[0].ID, msg.Diff.Items[1].ID}
+	assert.ElementsMatch(t, []string{first.ID, second.ID}, ids)
+
+	// Acknowledging an older diff still moves the base forward
+	manager.handleAck(client, Message{Type: MsgAck, Version: 1})
+	third := addItem(floor, 9, 10)
+	msg, ok = manager.syncFloor(client, dungeonID, floor)
+	require.True(t, ok)
+	assert.Equal(t, uint64(1), msg.Diff.BaseVersion)
+	ids = make([]string, 0)
+	for _, item := range msg.Diff.Items {
+		ids = append(ids, item.ID)
+	}
+	assert.ElementsMatch(t, []string{second.ID, third.ID}, ids)
+}
+
+func TestSyncFloorIgnoresUnknownAcks(t *testing.T) {
+	manager, client, floor, dungeonID := newTestManager(t)
+
+	addItem(floor, 7, 10)
+	_, ok := manager.syncFloor(client, dungeonID, floor)
+	require.True(t, ok)
+
+	manager.handleAck(client, Message{Type: MsgAck, Version: 42})
+	assert.Equal(t, uint64(0), client.sync.ackedVersion, "Versions that were never sent can't be acknowledged")
+}
+
+func TestSyncFloorResyncsClientsThatFallBehind(t *testing.T) {
+	manager, client, floor, dungeonID := newTestManager(t)
+
+	for i := 0; i <= maxUnackedVersions; i++ {
+		addItem(floor, 7, 10)
+		floor.Commit()
+	}
+
+	msg, ok := manager.syncFloor(client, dungeonID, floor)
+	require.True(t, ok)
+	assert.Equal(t, MsgFloorChange, msg.Type, "A client too far behind should get the whole view")
+	require.NotNil(t, msg.Floor)
+	assert.Equal(t, floor.Version, msg.Floor.Version)
+	assert.Equal(t, floor.Version, client.sync.ackedVersion, "The resync becomes the new base")
+
+	// Changing floors also forces a resync
+	client.sync.key.level = 2
+	msg, ok = manager.syncFloor(client, dungeonID, floor)
+	require.True(t, ok)
+	assert.Equal(t, MsgFloorChange, msg.Type)
+}
+
+func TestResyncWithFullQueue(t *testing.T) {
+	manager, client, _, _ := newTestManager(t)
+	for len(client.Send) < cap(client.Send) {
+		client.Send <- Message{Type: MsgNotification}
+	}
+
+	// A client that can't keep up misses the resync instead of stalling the world
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		manager.HandleMessage(client, Message{Type: MsgResync})
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Resync blocked on a full queue")
+	}
+
+	// Once the queue drains, the next resync gets through
+	drainMessages(client)
+	manager.HandleMessage(client, Message{Type: MsgResync})
+	msg := <-client.Send
+	assert.Equal(t, MsgFloorChange, msg.Type)
+	assert.NotNil(t, msg.Floor)
+}
+
+func TestSyncFloorRespectsFogOfWar(t *testing.T) {
+	manager, client, floor, dungeonID := newTestManager(t)
+
+	// Changes far out of sight are not sent
+	hiddenItem := addItem(floor, 35, 10)
+	mob := models.NewMob(models.MobGoblin, models.VariantNormal, 1)
+	addMob(floor, mob, 30, 5)
+	floor.MarkMobs(mob.ID)
+
+	msg, ok := manager.syncFloor(client, dungeonID, floor)
+	require.True(t, ok)
+	assert.Empty(t, msg.Diff.Tiles, "Unexplored tiles should not be sent")
+	assert.Empty(t, msg.Diff.Mobs, "Mobs out of sight should not be sent")
+	assert.Empty(t, msg.Diff.Items, "Items out of sight should not be sent")
+	assert.Contains(t, msg.Diff.RemovedMobs, mob.ID)
+	assert.Contains(t, msg.Diff.RemovedItems, hiddenItem.ID)
+	manager.handleAck(client, Message{Type: MsgAck, Version: msg.Diff.Version})
+
+	// Walking toward them reveals the new tiles along with what is on them
+	floor.Tiles[10][5].Character = ""
+	floor.Tiles[10][30].Character = client.Character.ID
+	floor.MarkTiles(models.Position{X: 5, Y: 10}, models.Position{X: 30, Y: 10})
+	client.Character.Position = models.Position{X: 30, Y: 10}
+
+	msg, ok = manager.syncFloor(client, dungeonID, floor)
+	require.True(t, ok)
+	require.Len(t, msg.Diff.Mobs, 1)
+	assert.Equal(t, mob.ID, msg.Diff.Mobs[0].ID)
+	require.Len(t, msg.Diff.Items, 1)
+	assert.Equal(t, hiddenItem.ID, msg.Diff.Items[0].ID)
+
+	tiles := make(map[models.Position]models.Tile)
+	for _, tile := range msg.Diff.Tiles {
+		tiles[models.Position{X: tile.X, Y: tile.Y}] = tile.Tile
+	}
+	assert.True(t, tiles[models.Position{X: 30, Y: 10}].Visible, "Newly visible tiles should be sent")
+	assert.False(t, tiles[models.Position{X: 5, Y: 10}].Visible, "Tiles that went out of sight should be sent")
+	assert.Empty(t, tiles[models.Position{X: 5, Y: 10}].Character)
+}
+
+// newBenchmarkFloor generates a full size floor with a character standing in its first room
+func newBenchmarkFloor(b *testing.B) (*GameManager, *Client, *models.Floor, string) {
+	characterRepo := repositories.NewCharacterRepository()
+	dungeonRepo := repositories.NewDungeonRepository()
+	manager := NewGameManager(characterRepo, dungeonRepo)
+
+	dungeon := models.NewDungeon("Benchmark", 1, 12345)
+	floor := dungeon.GenerateFloor(1)
+	NewMapGenerator(12345).GenerateFloor(floor, 1, false)
+	dungeonRepo.Save(dungeon)
+
+	room := floor.Rooms[0]
+	character := models.NewCharacter("Benchmark", models.Warrior)
+	character.CurrentDungeon = dungeon.ID
+	character.CurrentFloor = 1
+	character.Position = models.Position{X: room.X + room.Width/2, Y: room.Y + room.Height/2}
+	characterRepo.Save(character)
+
+	client := &Client{ID: "benchmark", Character: character, Manager: manager, Send: make(chan Message, 1)}
+	manager.fullSync(client, dungeon.ID, floor)
+
+	return manager, client, floor, dungeon.ID
+}
+
+// pickUpNearbyItem drops an item next to the character and picks it up again,
+// marking the same changes handlePickup does
+func pickUpNearbyItem(floor *models.Floor, character *models.Character) {
+	item := *models.NewPotion("Health Potion", 20, 5)
+	item.Position = character.Position
+	floor.Items[item.ID] = item
+	floor.MarkItems(item.ID)
+	floor.MarkTiles(item.Position)
+	floor.Commit()
+
+	delete(floor.Items, item.ID)
+	floor.MarkItems(item.ID)
+	floor.MarkTiles(item.Position)
+}
+
+// BenchmarkFloorUpdateFullFloor measures the payload of sending the whole floor
+// after a pickup, which is what BroadcastFloorUpdate used to do
+func BenchmarkFloorUpdateFullFloor(b *testing.B) {
+	_, client, floor, _ := newBenchmarkFloor(b)
+
+	var size int
+	for i := 0; i < b.N; i++ {
+		pickUpNearbyItem(floor, client.Character)
+		data, err := json.Marshal(Message{Type: MsgFloorChange, Floor: floor})
+		require.NoError(b, err)
+		size = len(data)
+	}
+	b.ReportMetric(float64(size), "payload-bytes")
+}
+
+// BenchmarkFloorUpdateDiff measures the payload of the diff sent after a pickup
+func BenchmarkFloorUpdateDiff(b *testing.B) {
+	manager, client, floor, dungeonID := newBenchmarkFloor(b)
+
+	var size int
+	for i := 0; i < b.N; i++ {
+		pickUpNearbyItem(floor, client.Character)
+		msg, ok := manager.syncFloor(client, dungeonID, floor)
+		require.True(b, ok)
+		data, err := json.Marshal(msg)
+		require.NoError(b, err)
+		size = len(data)
+		manager.handleAck(client, Message{Type: MsgAck, Version: msg.Diff.Version})
+	}
+	b.ReportMetric(float64(size), "payload-bytes")
+}
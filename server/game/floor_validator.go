@@ -0,0 +1,173 @@
+package game
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/jchauncey/TheDeeps/server/models"
+)
+
+// maxFloorRetries is how many times a floor that fails validation is generated
+// again from a derived seed before the last attempt is kept anyway
+const maxFloorRetries = 5
+
+// validateFloor validates generated floors; tests replace it to fail floors on purpose
+var validateFloor = ValidateFloor
+
+// FloorStats describes how playable a generated floor is
+type FloorStats struct {
+	Valid             bool              `json:"valid"`
+	Problems          []string          `json:"problems,omitempty"`
+	Retries           int               `json:"retries"`
+	WalkableTiles     int               `json:"walkableTiles"`
+	ReachableTiles    int               `json:"reachableTiles"`
+	RoomTiles         int               `json:"roomTiles"`
+	CorridorTiles     int               `json:"corridorTiles"`
+	CorridorRatio     float64           `json:"corridorRatio"`    // Corridor tiles for every room tile
+	DeadEnds          int               `json:"deadEnds"`         // Corridor tiles with only one way out
+	OverlappingTiles  int               `json:"overlappingTiles"` // Tiles inside more than one room
+	UnreachableRooms  []string          `json:"unreachableRooms,omitempty"`
+	UnreachableItems  []string          `json:"unreachableItems,omitempty"`
+	UnreachableStairs []models.Position `json:"unreachableStairs,omitempty"`
+}
+
+// Err returns the floor's problems as an error, or nil if it is valid
+func (s FloorStats) Err() error {
+	errs := make([]error, 0, len(s.Problems))
+	for _, problem := range s.Problems {
+		errs = append(errs, errors.New(problem))
+	}
+	return errors.Join(errs...)
+}
+
+// ValidateFloor flood-fills a floor from where characters arrive and checks that
+// every room, staircase and item can be reached, measuring the floor's layout
+// along the way. Floors above the final one must lead further down.
+func ValidateFloor(floor *models.Floor, isFinalFloor bool) FloorStats {
+	stats := FloorStats{Retries: floor.Retries}
+
+	start, found := arrivalPosition(floor)
+	if !found {
+		stats.Problems = append(stats.Problems, "floor has nowhere to arrive")
+		return stats
+	}
+	reached := passableFrom(floor, start)
+
+	for y := 0; y < floor.Height; y++ {
+		for x := 0; x < floor.Width; x++ {
+			pos := models.Position{X: x, Y: y}
+			if !passable(floor.Tiles[y][x]) {
+				continue
+			}
+			stats.WalkableTiles++
+			if reached[pos] {
+				stats.ReachableTiles++
+			}
+
+			rooms := roomsAt(floor.Rooms, pos)
+			switch {
+			case rooms == 0:
+				stats.CorridorTiles++
+				if passableNeighbours(floor, pos) == 1 {
+					stats.DeadEnds++
+				}
+			case rooms > 1:
+				stats.OverlappingTiles++
+				fallthrough
+			default:
+				stats.RoomTiles++
+			}
+		}
+	}
+	if stats.RoomTiles > 0 {
+		stats.CorridorRatio = float64(stats.CorridorTiles) / float64(stats.RoomTiles)
+	}
+
+	for _, room := range floor.Rooms {
+		if !roomReached(room, reached) {
+			stats.UnreachableRooms = append(stats.UnreachableRooms, room.ID)
+		}
+	}
+	for id, item := range floor.Items {
+		if !reached[item.Position] {
+			stats.UnreachableItems = append(stats.UnreachableItems, id)
+		}
+	}
+	sort.Strings(stats.UnreachableItems)
+	for _, pos := range append(append([]models.Position(nil), floor.UpStairs...), floor.DownStairs...) {
+		if !reached[pos] {
+			stats.UnreachableStairs = append(stats.UnreachableStairs, pos)
+		}
+	}
+
+	if !isFinalFloor && len(floor.DownStairs) == 0 {
+		stats.Problems = append(stats.Problems, "floor has no down stairs")
+	}
+	if unreached := stats.WalkableTiles - stats.ReachableTiles; unreached > 0 {
+		stats.Problems = append(stats.Problems, fmt.Sprintf("%d tiles can't be reached", unreached))
+	}
+	if len(stats.UnreachableRooms) > 0 {
+		stats.Problems = append(stats.Problems, fmt.Sprintf("%d rooms can't be reached", len(stats.UnreachableRooms)))
+	}
+	if len(stats.UnreachableItems) > 0 {
+		stats.Problems = append(stats.Problems, fmt.Sprintf("%d items can't be reached", len(stats.UnreachableItems)))
+	}
+	if len(stats.UnreachableStairs) > 0 {
+		stats.Problems = append(stats.Problems, fmt.Sprintf("%d stairs can't be reached", len(stats.UnreachableStairs)))
+	}
+	stats.Valid = len(stats.Problems) == 0
+
+	return stats
+}
+
+// roomsAt counts the rooms a position is inside
+func roomsAt(rooms []models.Room, pos models.Position) int {
+	count := 0
+	for _, room := range rooms {
+		if pos.X >= room.X && pos.X < room.X+room.Width && pos.Y >= room.Y && pos.Y < room.Y+room.Height {
+			count++
+		}
+	}
+	return count
+}
+
+// roomReached checks if any tile of a room was reached
+func roomReached(room models.Room, reached map[models.Position]bool) bool {
+	for y := room.Y; y < room.Y+room.Height; y++ {
+		for x := room.X; x < room.X+room.Width; x++ {
+			if reached[models.Position{X: x, Y: y}] {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// passableNeighbours counts the orthogonal neighbours of a position characters can get through
+func passableNeighbours(floor *models.Floor, pos models.Position) int {
+	count := 0
+	for _, dir := range []models.Position{{X: 0, Y: -1}, {X: 1, Y: 0}, {X: 0, Y: 1}, {X: -1, Y: 0}} {
+		next := models.Position{X: pos.X + dir.X, Y: pos.Y + dir.Y}
+		if hasTile(floor, next) && passable(floor.Tiles[next.Y][next.X]) {
+			count++
+		}
+	}
+	return count
+}
+
+// resetFloor clears what a failed attempt at generating a floor left on it
+func resetFloor(floor *models.Floor) {
+	*floor = models.Floor{
+		Level:      floor.Level,
+		Width:      floor.Width,
+		Height:     floor.Height,
+		Tiles:      floor.Tiles,
+		Rooms:      []models.Room{},
+		UpStairs:   []models.Position{},
+		DownStairs: []models.Position{},
+		Mobs:       make(map[string]*models.Mob),
+		Items:      make(map[string]models.Item),
+		Retries:    floor.Retries,
+	}
+}
@@ -0,0 +1,121 @@
+package game
+
+import (
+	"testing"
+
+	"github.com/jchauncey/TheDeeps/server/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// carveArea opens up a rectangle of floor tiles, corners included
+func carveArea(floor *models.Floor, x1, y1, x2, y2 int) {
+	for y := y1; y <= y2; y++ {
+		for x := x1; x <= x2; x++ {
+			floor.Tiles[y][x] = models.Tile{Type: models.TileFloor, Walkable: true}
+		}
+	}
+}
+
+func TestValidateFloor(t *testing.T) {
+	floor := newOpenFloor(20, 10)
+	for y := range floor.Tiles {
+		for x := range floor.Tiles[y] {
+			floor.Tiles[y][x] = models.Tile{Type: models.TileWall}
+		}
+	}
+
+	// Two overlapping rooms and a corridor leading nowhere
+	floor.Rooms = []models.Room{
+		{ID: "west", X: 1, Y: 1, Width: 4, Height: 4},
+		{ID: "east", X: 4, Y: 1, Width: 4, Height: 4},
+	}
+	carveArea(floor, 1, 1, 7, 4)
+	carveArea(floor, 8, 2, 12, 2)
+	floor.UpStairs = []models.Position{{X: 2, Y: 2}}
+	floor.DownStairs = []models.Position{{X: 6, Y: 3}}
+	floor.Items["gem"] = models.Item{ID: "gem", Position: models.Position{X: 12, Y: 2}}
+
+	stats := ValidateFloor(floor, false)
+	assert.True(t, stats.Valid, "Problems: %v", stats.Problems)
+	assert.NoError(t, stats.Err())
+	assert.Equal(t, 33, stats.WalkableTiles)
+	assert.Equal(t, 33, stats.ReachableTiles)
+	assert.Equal(t, 28, stats.RoomTiles)
+	assert.Equal(t, 5, stats.CorridorTiles)
+	assert.InDelta(t, 5.0/28.0, stats.CorridorRatio, 0.0001)
+	assert.Equal(t, 1, stats.DeadEnds)
+	assert.Equal(t, 4, stats.OverlappingTiles)
+
+	// Only floors above the last need down stairs
+	floor.DownStairs = nil
+	assert.Equal(t, []string{"floor has no down stairs"}, ValidateFloor(floor, false).Problems)
+	assert.True(t, ValidateFloor(floor, true).Valid)
+
+	// A room walled off from the rest takes its stairs and items with it
+	floor.Rooms = append(floor.Rooms, models.Room{ID: "vault", X: 15, Y: 6, Width: 3, Height: 3})
+	carveArea(floor, 15, 6, 17, 8)
+	floor.DownStairs = []models.Position{{X: 16, Y: 7}}
+	floor.Items["crown"] = models.Item{ID: "crown", Position: models.Position{X: 15, Y: 6}}
+
+	stats = ValidateFloor(floor, false)
+	assert.False(t, stats.Valid)
+	assert.Equal(t, []string{"vault"}, stats.UnreachableRooms)
+	assert.Equal(t, []string{"crown"}, stats.UnreachableItems)
+	assert.Equal(t, []models.Position{{X: 16, Y: 7}}, stats.UnreachableStairs)
+	assert.Equal(t, []string{
+		"9 tiles can't be reached",
+		"1 rooms can't be reached",
+		"1 items can't be reached",
+		"1 stairs can't be reached",
+	}, stats.Problems)
+	assert.EqualError(t, stats.Err(), "9 tiles can't be reached\n1 rooms can't be reached\n1 items can't be reached\n1 stairs can't be reached")
+}
+
+// rejectFloors makes floor validation fail the given number of times before
+// validating floors as usual
+func rejectFloors(t *testing.T, times int) {
+	original := validateFloor
+	validateFloor = func(floor *models.Floor, isFinalFloor bool) FloorStats {
+		if times > 0 {
+			times--
+			return FloorStats{Problems: []string{"rejected"}}
+		}
+		return original(floor, isFinalFloor)
+	}
+	t.Cleanup(func() { validateFloor = original })
+}
+
+func TestGenerateDungeonFloorRetries(t *testing.T) {
+	dungeon := models.NewDungeon("Retries", 3, 99)
+	first := dungeon.GenerateFloor(2)
+	GenerateDungeonFloor(dungeon, first)
+	assert.Zero(t, first.Retries)
+
+	// A rejected floor is generated again from a derived seed, with nothing left
+	// over from the attempts thrown away
+	rejectFloors(t, 2)
+	floor := dungeon.GenerateFloor(2)
+	GenerateDungeonFloor(dungeon, floor)
+	assert.Equal(t, 2, floor.Retries)
+	assert.NotEqual(t, first.Rooms, floor.Rooms)
+	assert.Len(t, floor.UpStairs, 1)
+	assert.Len(t, floor.DownStairs, 1)
+	stats := ValidateFloor(floor, false)
+	assert.True(t, stats.Valid, "Problems: %v", stats.Problems)
+	assert.Equal(t, 2, stats.Retries)
+
+	// Retries are as repeatable as first attempts
+	rejectFloors(t, 2)
+	again := dungeon.GenerateFloor(2)
+	GenerateDungeonFloor(dungeon, again)
+	assert.Equal(t, floor.Rooms, again.Rooms)
+
+	// A floor that never validates is kept after the last retry
+	rejectFloors(t, maxFloorRetries+1)
+	kept := dungeon.GenerateFloor(2)
+	GenerateDungeonFloor(dungeon, kept)
+	assert.Equal(t, maxFloorRetries, kept.Retries)
+	require.NotEmpty(t, kept.Rooms)
+	assert.Len(t, kept.DownStairs, 1)
+}
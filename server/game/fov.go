@@ -0,0 +1,264 @@
+package game
+
+import (
+	"github.com/jchauncey/TheDeeps/server/models"
+)
+
+const (
+	baseViewRadius = 5  // View radius before the Perception skill is added
+	maxViewRadius  = 12 // Upper bound so high Perception can't reveal whole floors
+)
+
+// Visibility is the set of tiles currently in a character's line of sight
+type Visibility map[models.Position]bool
+
+// octants holds the transforms that map the first octant onto the other seven
+var octants = [8][4]int{
+	{1, 0, 0, 1}, {0, 1, 1, 0}, {0, -1, 1, 0}, {-1, 0, 0, 1},
+	{-1, 0, 0, -1}, {0, -1, -1, 0}, {0, 1, -1, 0}, {1, 0, 0, -1},
+}
+
+// ViewRadius returns how far a character can see, scaled by their Perception skill
+func ViewRadius(character *models.Character) int {
+	return min(baseViewRadius+character.GetSkillLevel(models.SkillPerception), maxViewRadius)
+}
+
+// ComputeFOV returns the tiles visible from origin using recursive shadowcasting.
+// Tiles that can't be walked through block line of sight but are themselves visible.
+func ComputeFOV(floor *models.Floor, origin models.Position, radius int) Visibility {
+	visible := Visibility{}
+	if !hasTile(floor, origin) {
+		return visible
+	}
+
+	visible[origin] = true
+	for _, octant := range octants {
+		castLight(floor, visible, origin, radius, 1, 1.0, 0.0, octant)
+	}
+
+	return visible
+}
+
+// castLight scans one octant row by row, recursing around each blocking tile
+func castLight(floor *models.Floor, visible Visibility, origin models.Position, radius, row int, start, end float64, t [4]int) {
+	if start < end {
+		return
+	}
+
+	radiusSquared := radius * radius
+	newStart := 0.0
+	for distance := row; distance <= radius; distance++ {
+		dy := -distance
+		blocked := false
+
+		for dx := -distance; dx <= 0; dx++ {
+			pos := models.Position{
+				X: origin.X + dx*t[0] + dy*t[1],
+				Y: origin.Y + dx*t[2] + dy*t[3],
+			}
+			leftSlope := (float64(dx) - 0.5) / (float64(dy) + 0.5)
+			rightSlope := (float64(dx) + 0.5) / (float64(dy) - 0.5)
+
+			if start < rightSlope {
+				continue
+			}
+			if end > leftSlope {
+				break
+			}
+
+			if dx*dx+dy*dy <= radiusSquared && hasTile(floor, pos) {
+				visible[pos] = true
+			}
+
+			if blocked {
+				if blocksSight(floor, pos) {
+					newStart = rightSlope
+					continue
+				}
+				blocked = false
+				start = newStart
+			} else if blocksSight(floor, pos) && distance < radius {
+				blocked = true
+				castLight(floor, visible, origin, radius, distance+1, start, leftSlope, t)
+				newStart = rightSlope
+			}
+		}
+
+		if blocked {
+			break
+		}
+	}
+}
+
+// blocksSight checks if a tile stops line of sight
+func blocksSight(floor *models.Floor, pos models.Position) bool {
+	if !hasTile(floor, pos) {
+		return true
+	}
+	// Chests can be seen past
+	tile := floor.Tiles[pos.Y][pos.X]
+	return !tile.Walkable && tile.Type != models.TileChest
+}
+
+// hasTile checks if a position is inside the floor and its tile grid
+func hasTile(floor *models.Floor, pos models.Position) bool {
+	return inBounds(floor, pos) && pos.Y < len(floor.Tiles) && pos.X < len(floor.Tiles[pos.Y])
+}
+
+// UpdateExploration computes what a character can see on a floor, records it as
+// explored and returns the visible tiles
+func UpdateExploration(floor *models.Floor, dungeonID string, character *models.Character) Visibility {
+	visible := ComputeFOV(floor, character.Position, ViewRadius(character))
+
+	explored := character.ExploredFloor(dungeonID, floor)
+	for pos := range visible {
+		explored.Add(pos.X, pos.Y)
+	}
+
+	return visible
+}
+
+// FloorView builds the copy of a floor a character is allowed to see. Unexplored
+// tiles are blank, explored tiles keep their terrain, and mobs, items and other
+// characters are only included while they are in sight. Traps are left out until
+// someone has revealed them, chests hide their contents until they are opened, and
+// puzzles hide their solutions.
+func FloorView(floor *models.Floor, explored *models.ExploredSet, visible Visibility) *models.Floor {
+	view := &models.Floor{
+		Level:      floor.Level,
+		Width:      floor.Width,
+		Height:     floor.Height,
+		Version:    floor.Version,
+		Theme:      floor.Theme,
+		Palette:    floor.Palette,
+		Tiles:      make([][]models.Tile, floor.Height),
+		Rooms:      make([]models.Room, 0),
+		UpStairs:   make([]models.Position, 0),
+		DownStairs: make([]models.Position, 0),
+		Mobs:       make(map[string]*models.Mob),
+		Items:      make(map[string]models.Item),
+	}
+
+	exploredRooms := make(map[string]bool)
+	for y := 0; y < floor.Height; y++ {
+		view.Tiles[y] = make([]models.Tile, floor.Width)
+		for x := 0; x < floor.Width; x++ {
+			tile := viewTile(floor, explored, visible, models.Position{X: x, Y: y})
+			view.Tiles[y][x] = tile
+
+			if tile.Explored && tile.RoomID != "" {
+				exploredRooms[tile.RoomID] = true
+			}
+		}
+	}
+
+	for _, room := range floor.Rooms {
+		if exploredRooms[room.ID] || roomExplored(room, explored) {
+			room.Explored = true
+			view.Rooms = append(view.Rooms, room)
+		}
+	}
+
+	for _, pos := range floor.UpStairs {
+		if explored.Has(pos.X, pos.Y) {
+			view.UpStairs = append(view.UpStairs, pos)
+		}
+	}
+	for _, pos := range floor.DownStairs {
+		if explored.Has(pos.X, pos.Y) {
+			view.DownStairs = append(view.DownStairs, pos)
+		}
+	}
+
+	for id, mob := range floor.Mobs {
+		if visible[mob.Position] {
+			view.Mobs[id] = mob
+		}
+	}
+	for id, item := range floor.Items {
+		if visible[item.Position] {
+			view.Items[id] = item
+		}
+	}
+	for id, corpse := range floor.Corpses {
+		if explored.Has(corpse.Position.X, corpse.Position.Y) {
+			if view.Corpses == nil {
+				view.Corpses = make(map[string]*models.Corpse)
+			}
+			view.Corpses[id] = corpse
+		}
+	}
+	for id, trap := range floor.Traps {
+		if trap.Revealed && explored.Has(trap.Position.X, trap.Position.Y) {
+			if view.Traps == nil {
+				view.Traps = make(map[string]*models.Trap)
+			}
+			view.Traps[id] = trap
+		}
+	}
+	for id, puzzle := range floor.Puzzles {
+		if exploredRooms[puzzle.RoomID] {
+			if view.Puzzles == nil {
+				view.Puzzles = make(map[string]*models.Puzzle)
+			}
+			view.Puzzles[id] = puzzleView(puzzle)
+		}
+	}
+	for id, door := range floor.Doors {
+		if explored.Has(door.Position.X, door.Position.Y) {
+			if view.Doors == nil {
+				view.Doors = make(map[string]*models.Door)
+			}
+			view.Doors[id] = doorView(door)
+		}
+	}
+	for id, chest := range floor.Chests {
+		if explored.Has(chest.Position.X, chest.Position.Y) {
+			if view.Chests == nil {
+				view.Chests = make(map[string]*models.Chest)
+			}
+			view.Chests[id] = chestView(chest)
+		}
+	}
+
+	return view
+}
+
+// viewTile returns a tile as a character sees it: blank if unexplored, and
+// without its occupants if it isn't currently in sight
+func viewTile(floor *models.Floor, explored *models.ExploredSet, visible Visibility, pos models.Position) models.Tile {
+	if !explored.Has(pos.X, pos.Y) || !hasTile(floor, pos) {
+		return models.Tile{}
+	}
+
+	tile := floor.Tiles[pos.Y][pos.X]
+	tile.Explored = true
+	tile.Visible = visible[pos]
+	if !tile.Visible {
+		tile.MobID = ""
+		tile.ItemID = ""
+		tile.Character = ""
+	}
+	if trap, exists := floor.Traps[tile.TrapID]; !exists || !trap.Revealed {
+		tile.TrapID = ""
+	}
+	return tile
+}
+
+// CharacterFloorView updates a character's exploration and returns their view of the floor
+func CharacterFloorView(floor *models.Floor, dungeonID string, character *models.Character) *models.Floor {
+	visible := UpdateExploration(floor, dungeonID, character)
+	return FloorView(floor, character.ExploredFloor(dungeonID, floor), visible)
+}
+
+// roomExplored checks if any tile inside a room has been explored
+func roomExplored(room models.Room, explored *models.ExploredSet) bool {
+	for y := room.Y; y < room.Y+room.Height; y++ {
+		for x := room.X; x < room.X+room.Width; x++ {
+			if explored.Has(x, y) {
+				return true
+			}
+		}
+	}
+	return false
+}
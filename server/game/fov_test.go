@@ -0,0 +1,151 @@
+package game
+
+import (
+	"testing"
+
+	"github.com/jchauncey/TheDeeps/server/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// addWallColumn turns a column of tiles into walls
+func addWallColumn(floor *models.Floor, x int) {
+	for y := 0; y < floor.Height; y++ {
+		floor.Tiles[y][x] = models.Tile{Type: models.TileWall}
+	}
+}
+
+func TestComputeFOVOpenRoom(t *testing.T) {
+	floor := newOpenFloor(21, 21)
+	origin := models.Position{X: 10, Y: 10}
+
+	visible := ComputeFOV(floor, origin, 3)
+
+	assert.True(t, visible[origin], "The origin should always be visible")
+	assert.True(t, visible[models.Position{X: 10, Y: 7}], "Tiles at the radius should be visible")
+	assert.True(t, visible[models.Position{X: 12, Y: 12}], "Diagonals inside the radius should be visible")
+	assert.False(t, visible[models.Position{X: 10, Y: 6}], "Tiles past the radius should not be visible")
+	assert.False(t, visible[models.Position{X: 13, Y: 13}], "The view should be round, not square")
+
+	// Every visible tile should be within the radius
+	for pos := range visible {
+		dx, dy := pos.X-origin.X, pos.Y-origin.Y
+		assert.LessOrEqual(t, dx*dx+dy*dy, 9, "Visible tile %v is outside the radius", pos)
+	}
+}
+
+func TestComputeFOVWallsBlockSight(t *testing.T) {
+	floor := newOpenFloor(21, 21)
+	addWallColumn(floor, 12)
+
+	visible := ComputeFOV(floor, models.Position{X: 10, Y: 10}, 8)
+
+	assert.True(t, visible[models.Position{X: 12, Y: 10}], "The wall itself should be visible")
+	assert.False(t, visible[models.Position{X: 13, Y: 10}], "Tiles behind the wall should be hidden")
+	assert.False(t, visible[models.Position{X: 15, Y: 12}], "Tiles behind the wall should be hidden")
+	assert.True(t, visible[models.Position{X: 5, Y: 10}], "Tiles on the open side should be visible")
+}
+
+func TestComputeFOVSeesAroundPillar(t *testing.T) {
+	floor := newOpenFloor(21, 21)
+	floor.Tiles[10][12] = models.Tile{Type: models.TileWall}
+
+	visible := ComputeFOV(floor, models.Position{X: 10, Y: 10}, 8)
+
+	assert.False(t, visible[models.Position{X: 14, Y: 10}], "A pillar should cast a shadow")
+	assert.True(t, visible[models.Position{X: 14, Y: 12}], "A pillar should not hide tiles off its shadow")
+}
+
+func TestComputeFOVOutsideFloor(t *testing.T) {
+	floor := newOpenFloor(5, 5)
+	assert.Empty(t, ComputeFOV(floor, models.Position{X: 10, Y: 10}, 5), "Nothing is visible from outside the floor")
+
+	// Floors without tile data should not panic
+	empty := &models.Floor{Level: 1, Width: 5, Height: 5}
+	assert.Empty(t, ComputeFOV(empty, models.Position{X: 2, Y: 2}, 5))
+}
+
+func TestViewRadius(t *testing.T) {
+	character := models.NewCharacter("Scout", models.Warrior)
+	assert.Equal(t, baseViewRadius+character.GetSkillLevel(models.SkillPerception), ViewRadius(character))
+
+	character.Skills.SkillList[models.SkillPerception].Level = 50
+	assert.Equal(t, maxViewRadius, ViewRadius(character), "The radius should be capped")
+
+	character.Skills = nil
+	assert.Equal(t, baseViewRadius, ViewRadius(character))
+}
+
+func TestCharacterFloorView(t *testing.T) {
+	floor := newOpenFloor(30, 15)
+	addWallColumn(floor, 15)
+	floor.Tiles[7][15] = models.Tile{Type: models.TileFloor, Walkable: true} // A gap in the wall
+	floor.Rooms = []models.Room{
+		{ID: "west", X: 1, Y: 1, Width: 14, Height: 13},
+		{ID: "east", X: 16, Y: 1, Width: 13, Height: 13},
+	}
+	floor.DownStairs = []models.Position{{X: 26, Y: 10}}
+	floor.Tiles[10][26].Type = models.TileDownStairs
+
+	nearby := models.NewMob(models.MobGoblin, models.VariantNormal, 1)
+	addMob(floor, nearby, 8, 7)
+	hidden := models.NewMob(models.MobGoblin, models.VariantNormal, 1)
+	addMob(floor, hidden, 25, 3)
+
+	potion := models.NewPotion("Health Potion", 20, 5)
+	potion.Position = models.Position{X: 6, Y: 6}
+	floor.Items[potion.ID] = *potion
+	floor.Tiles[6][6].ItemID = potion.ID
+
+	character := models.NewCharacter("Scout", models.Warrior)
+	character.Position = models.Position{X: 5, Y: 7}
+
+	view := CharacterFloorView(floor, "dungeon", character)
+
+	require.Len(t, view.Tiles, floor.Height)
+	assert.True(t, view.Tiles[7][5].Visible, "The character's tile should be visible")
+	assert.Equal(t, models.Tile{}, view.Tiles[3][25], "Unexplored tiles should be blank")
+	assert.Contains(t, view.Mobs, nearby.ID, "Mobs in sight should be sent")
+	assert.NotContains(t, view.Mobs, hidden.ID, "Mobs out of sight should not be sent")
+	assert.Contains(t, view.Items, potion.ID, "Items in sight should be sent")
+	assert.Empty(t, view.DownStairs, "Unexplored stairs should not be sent")
+	require.Len(t, view.Rooms, 1, "Only explored rooms should be sent")
+	assert.Equal(t, "west", view.Rooms[0].ID)
+	assert.True(t, view.Rooms[0].Explored)
+
+	// The source floor should not be modified
+	assert.False(t, floor.Tiles[7][5].Explored)
+	assert.Equal(t, nearby.ID, floor.Tiles[7][8].MobID)
+
+	// Walk through the gap; the west room stays explored but its contents are no longer tracked
+	character.Position = models.Position{X: 22, Y: 7}
+	view = CharacterFloorView(floor, "dungeon", character)
+
+	assert.True(t, view.Tiles[7][5].Explored, "Explored tiles should be remembered")
+	assert.False(t, view.Tiles[7][5].Visible, "Remembered tiles should not be visible")
+	assert.Empty(t, view.Tiles[7][8].MobID, "Mobs on remembered tiles should be hidden")
+	assert.NotContains(t, view.Mobs, nearby.ID)
+	assert.Contains(t, view.Mobs, hidden.ID, "The mob in the east room should now be visible")
+	assert.Len(t, view.Rooms, 2)
+	assert.Equal(t, []models.Position{{X: 26, Y: 10}}, view.DownStairs, "Seen stairs should be sent")
+
+	// Traps are hidden until someone reveals them
+	trap := models.NewTrap(models.TrapSpike, 1)
+	trap.Position = models.Position{X: 23, Y: 7}
+	floor.Traps = map[string]*models.Trap{trap.ID: trap}
+	floor.Tiles[7][23].TrapID = trap.ID
+	view = CharacterFloorView(floor, "dungeon", character)
+	assert.Empty(t, view.Tiles[7][23].TrapID, "Hidden traps should not be sent")
+	assert.Empty(t, view.Traps)
+
+	trap.Revealed = true
+	floor.Tiles[7][23].Type = models.TileTrap
+	view = CharacterFloorView(floor, "dungeon", character)
+	assert.Equal(t, trap.ID, view.Tiles[7][23].TrapID)
+	assert.Contains(t, view.Traps, trap.ID, "Revealed traps should be sent")
+
+	explored := character.Exploration[models.ExplorationKey("dungeon", 1)]
+	require.NotNil(t, explored, "Exploration should be stored on the character")
+	assert.True(t, explored.Has(5, 7))
+	assert.True(t, explored.Has(22, 7))
+}
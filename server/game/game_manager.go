@@ -1,12 +1,17 @@
 package game
 
 import (
+	"encoding/json"
+	"fmt"
+	"math/rand"
 	"net/http"
+	"sort"
 	"strconv"
 	"sync"
 	"time"
 
 	"github.com/gorilla/websocket"
+	"github.com/jchauncey/TheDeeps/server/auth"
 	"github.com/jchauncey/TheDeeps/server/log"
 	"github.com/jchauncey/TheDeeps/server/models"
 	"github.com/jchauncey/TheDeeps/server/repositories"
@@ -21,6 +26,9 @@ const (
 	pongWait       = 60 * time.Second    // Time allowed to read the next pong message from the peer
 	pingPeriod     = (pongWait * 9) / 10 // Send pings to peer with this period. Must be less than pongWait
 	maxMessageSize = 512 * 1024          // Maximum message size allowed from peer (512KB)
+	maxBatchSize   = 64                  // Maximum number of queued messages written in a single frame
+
+	defaultMobTickInterval = 1 * time.Second // How often mobs act
 
 	// Client to server message types
 	MsgMove        MessageType = "move"
@@ -32,6 +40,18 @@ const (
 	MsgUnequipItem MessageType = "unequipItem"
 	MsgAscend      MessageType = "ascend"
 	MsgDescend     MessageType = "descend"
+	MsgAck         MessageType = "ack"       // Acknowledges the floor version the client has applied
+	MsgResync      MessageType = "resync"    // Requests a full view of the current floor
+	MsgLoot        MessageType = "loot"      // Loots the character's corpse they are standing on
+	MsgCast        MessageType = "cast"      // Uses one of the character's class abilities
+	MsgPartyChat   MessageType = "partyChat" // Talks to the character's party; also relayed to every member
+	MsgLootRoll    MessageType = "lootRoll"  // Rolls need, greed or pass for a party item; also sent when a roll starts
+	MsgShop        MessageType = "shop"      // Asks for the shop the character is standing in; answered with the shop
+	MsgBuy         MessageType = "buy"       // Buys an item from the shop
+	MsgSell        MessageType = "sell"      // Sells an item from the character's inventory to the shop
+	MsgHaggle      MessageType = "haggle"    // Tries a Persuasion check for a discount at the shop
+	MsgDisarm      MessageType = "disarm"    // Tries a Traps check to disarm the revealed trap named by TargetID
+	MsgInteract    MessageType = "interact"  // Uses the door, chest or lever named by TargetID
 
 	// Server to client message types
 	MsgUpdateMap    MessageType = "updateMap"
@@ -43,8 +63,21 @@ const (
 	MsgNotification MessageType = "notification"
 	MsgFloorUpdate  MessageType = "floorUpdate"
 	MsgFloorChange  MessageType = "floorChange"
+	MsgFloorDiff    MessageType = "floorDiff"
+	MsgDeath        MessageType = "death"
 	MsgError        MessageType = "error"
 	MsgInitialState MessageType = "initialState"
+	MsgBatch        MessageType = "batch"
+	MsgPartyUpdate  MessageType = "partyUpdate" // The character's party changed, or they left it
+	MsgPartyInvite  MessageType = "partyInvite" // The character was invited to a party
+)
+
+// Error codes sent in the Code field of MsgError replies
+const (
+	ErrCodeInvalidJSON      = "invalid_json"
+	ErrCodeMissingType      = "missing_type"
+	ErrCodeUnknownType      = "unknown_type"
+	ErrCodeUnsupportedFrame = "unsupported_frame"
 )
 
 // Direction represents a movement direction
@@ -70,6 +103,21 @@ type Message struct {
 	Item        *models.Item      `json:"item,omitempty"`
 	Text        string            `json:"text,omitempty"`
 	Error       string            `json:"error,omitempty"`
+	Code        string            `json:"code,omitempty"`        // Machine-readable error code for MsgError
+	Messages    []Message         `json:"messages,omitempty"`    // Batched messages for MsgBatch
+	Diff        *FloorDiff        `json:"diff,omitempty"`        // Floor changes for MsgFloorDiff
+	Version     uint64            `json:"version,omitempty"`     // Floor version for MsgAck
+	Death       *DeathEvent       `json:"death,omitempty"`       // Death details for MsgDeath
+	AbilityID   models.AbilityID  `json:"abilityId,omitempty"`   // Ability to use for MsgCast
+	Combat      *CombatResult     `json:"combat,omitempty"`      // What a MsgCast did
+	Party       *PartyView        `json:"party,omitempty"`       // The party for MsgPartyUpdate and MsgPartyInvite
+	From        string            `json:"from,omitempty"`        // Name of who sent a MsgPartyChat
+	Choice      LootChoice        `json:"choice,omitempty"`      // Need, greed or pass for MsgLootRoll
+	Shop        *ShopView         `json:"shop,omitempty"`        // The shop for MsgShop and replies to shop actions
+	Trap        *TrapResult       `json:"trap,omitempty"`        // What a trap did, for the notification when one goes off or is disarmed
+	Interaction *Interaction      `json:"interaction,omitempty"` // What happened, for the notification answering an interact
+	Puzzle      *PuzzleResult     `json:"puzzle,omitempty"`      // What stepping on a pressure plate did
+	Boss        *BossAction       `json:"boss,omitempty"`        // What a boss did, for the notification when it changes phase or uses a special attack
 }
 
 // Client represents a connected WebSocket client
@@ -79,6 +127,7 @@ type Client struct {
 	Character  *models.Character
 	Send       chan Message
 	Manager    *GameManager
+	sync       floorSync
 }
 
 // GameManager handles the game state and WebSocket connections
@@ -89,15 +138,29 @@ type GameManager struct {
 	Register          chan *Client
 	Unregister        chan *Client
 	Broadcast         chan Message
-	CharacterRepo     *repositories.CharacterRepository
-	DungeonRepo       *repositories.DungeonRepository
-	MapGenerator      *MapGenerator
-	mutex             sync.RWMutex
+	CharacterRepo     repositories.CharacterStore
+	DungeonRepo       repositories.DungeonStore
+	MobAI             *MobAI
+	TickInterval      time.Duration
+	DeathPenalty      DeathPenalty
+	Combat            *CombatManager
+	Encounters        *EncounterManager
+	Parties           *PartyManager
+	Shops             *ShopManager
+
+	// World is held by whatever changes the floors in play or the characters on
+	// them, so the mob tick, game socket messages and encounter turns take turns.
+	// It is taken before any of the managers' own locks.
+	World sync.Mutex
+
+	mutex  sync.RWMutex
+	rng    *rand.Rand                 // Rolls for traps, disarming and interacting; used under the world lock
+	ticked map[floorKey]*models.Floor // Floors the last mob tick ran on
 }
 
 // NewGameManager creates a new game manager
-func NewGameManager(characterRepo *repositories.CharacterRepository, dungeonRepo *repositories.DungeonRepository) *GameManager {
-	return &GameManager{
+func NewGameManager(characterRepo repositories.CharacterStore, dungeonRepo repositories.DungeonStore) *GameManager {
+	manager := &GameManager{
 		Clients:           make(map[string]*Client),
 		Characters:        make(map[string]*models.Character),
 		CharacterToClient: make(map[string]string),
@@ -106,14 +169,50 @@ func NewGameManager(characterRepo *repositories.CharacterRepository, dungeonRepo
 		Broadcast:         make(chan Message),
 		CharacterRepo:     characterRepo,
 		DungeonRepo:       dungeonRepo,
-		MapGenerator:      NewMapGenerator(time.Now().UnixNano()),
-	}
+		MobAI:             NewMobAI(time.Now().UnixNano()),
+		TickInterval:      defaultMobTickInterval,
+		DeathPenalty:      DefaultDeathPenalty,
+		Combat:            NewCombatManager(),
+		Parties:           NewPartyManager(characterRepo, dungeonRepo),
+		Shops:             NewShopManager(characterRepo, dungeonRepo),
+		rng:               rand.New(rand.NewSource(time.Now().UnixNano())),
+	}
+
+	// Party kills share experience and loot, party and shop messages go out over the game
+	// connection and boss kills are recorded with the dungeon
+	manager.Combat.Parties = manager.Parties
+	manager.Parties.Notify = manager.SendToCharacter
+	manager.Shops.Notify = manager.SendToCharacter
+	manager.Parties.OnLootAssigned = manager.BroadcastFloorUpdate
+	manager.Combat.OnBossDefeated = manager.recordBossKill
+
+	// Loot rolls, turns that time out and shop trades over HTTP take the world lock,
+	// and mobs in an encounter wait for their turns instead of acting in real time
+	manager.Encounters = NewEncounterManager(characterRepo, dungeonRepo, manager.Combat)
+	manager.Parties.World = &manager.World
+	manager.Shops.World = &manager.World
+	manager.Encounters.World = &manager.World
+	manager.MobAI.Engaged = manager.Encounters.InEncounter
+	manager.Encounters.OnDeath = func(dungeonID string, floor *models.Floor, character *models.Character, mob *models.Mob) {
+		manager.HandleDeath(dungeonID, floor, character, DeathCause(mob))
+	}
+
+	return manager
 }
 
 // Start starts the game manager
 func (manager *GameManager) Start() {
+	tickInterval := manager.TickInterval
+	if tickInterval <= 0 {
+		tickInterval = defaultMobTickInterval
+	}
+	ticker := time.NewTicker(tickInterval)
+	defer ticker.Stop()
+
 	for {
 		select {
+		case <-ticker.C:
+			manager.tickMobs()
 		case client := <-manager.Register:
 			manager.registerClient(client)
 		case client := <-manager.Unregister:
@@ -126,6 +225,8 @@ func (manager *GameManager) Start() {
 
 // registerClient registers a new client
 func (manager *GameManager) registerClient(client *Client) {
+	manager.World.Lock()
+	defer manager.World.Unlock()
 	manager.mutex.Lock()
 	defer manager.mutex.Unlock()
 
@@ -141,17 +242,14 @@ func (manager *GameManager) registerClient(client *Client) {
 			floorLevel := client.Character.CurrentFloor
 			floor, err := manager.DungeonRepo.GetFloor(client.Character.CurrentDungeon, floorLevel)
 			if err == nil {
-				// Send the floor data
-				client.Send <- Message{
-					Type:  MsgFloorChange,
-					Floor: floor,
-				}
+				// Send the part of the floor the character has seen
+				queueMessage(client, manager.fullSync(client, client.Character.CurrentDungeon, floor))
 
 				// Send the character data
-				client.Send <- Message{
+				queueMessage(client, Message{
 					Type:      MsgUpdatePlayer,
 					Character: client.Character,
-				}
+				})
 			}
 		}
 	}
@@ -159,6 +257,8 @@ func (manager *GameManager) registerClient(client *Client) {
 
 // unregisterClient unregisters a client
 func (manager *GameManager) unregisterClient(client *Client) {
+	manager.World.Lock()
+	defer manager.World.Unlock()
 	manager.mutex.Lock()
 	defer manager.mutex.Unlock()
 
@@ -171,10 +271,29 @@ func (manager *GameManager) unregisterClient(client *Client) {
 
 			// Save character state
 			manager.CharacterRepo.Save(client.Character)
+
+			// Save the floor they left so mob and item changes survive a restart
+			manager.saveCharacterFloor(client.Character)
 		}
 	}
 }
 
+// saveCharacterFloor saves the floor a character is currently on
+func (manager *GameManager) saveCharacterFloor(character *models.Character) {
+	if character.CurrentDungeon == "" {
+		return
+	}
+
+	floor, err := manager.DungeonRepo.GetFloor(character.CurrentDungeon, character.CurrentFloor)
+	if err != nil {
+		return
+	}
+
+	if err := manager.DungeonRepo.SaveFloor(character.CurrentDungeon, character.CurrentFloor, floor); err != nil {
+		log.Error("Failed to save floor %d of dungeon %s: %v", character.CurrentFloor, character.CurrentDungeon, err)
+	}
+}
+
 // broadcastMessage broadcasts a message to all clients
 func (manager *GameManager) broadcastMessage(message Message) {
 	manager.mutex.RLock()
@@ -190,14 +309,303 @@ func (manager *GameManager) broadcastMessage(message Message) {
 	}
 }
 
-// HandleMessage handles a message from a client
+// floorKey identifies a floor within a dungeon
+type floorKey struct {
+	dungeonID string
+	level     int
+}
+
+// tickMobs advances the mobs on every floor that has a connected player
+func (manager *GameManager) tickMobs() {
+	if manager.MobAI == nil {
+		return
+	}
+
+	manager.World.Lock()
+	defer manager.World.Unlock()
+	manager.mutex.RLock()
+	defer manager.mutex.RUnlock()
+
+	// Group connected clients by the floor they are on
+	floors := make(map[floorKey][]*Client)
+	for _, client := range manager.Clients {
+		if client.Character == nil || client.Character.CurrentDungeon == "" {
+			continue
+		}
+		key := floorKey{dungeonID: client.Character.CurrentDungeon, level: client.Character.CurrentFloor}
+		floors[key] = append(floors[key], client)
+	}
+
+	// Visit floors in a stable order so a seeded MobAI is deterministic
+	keys := make([]floorKey, 0, len(floors))
+	for key := range floors {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].dungeonID != keys[j].dungeonID {
+			return keys[i].dungeonID < keys[j].dungeonID
+		}
+		return keys[i].level < keys[j].level
+	})
+
+	ticked := make(map[floorKey]*models.Floor, len(keys))
+	for _, key := range keys {
+		floor, err := manager.DungeonRepo.GetFloor(key.dungeonID, key.level)
+		if err != nil {
+			log.Error("Failed to get floor for mob tick: %v", err)
+			continue
+		}
+
+		clients := floors[key]
+		characters := make([]*models.Character, 0, len(clients))
+		for _, client := range clients {
+			characters = append(characters, client.Character)
+		}
+
+		manager.tickStatusEffects(clients, floor)
+		result := manager.MobAI.Tick(floor, characters)
+		manager.sendMobTickResult(clients, floor, result)
+		ticked[key] = floor
+	}
+
+	// Floors everyone has left, or that were replaced, are dropped from the AI's caches
+	for key, floor := range manager.ticked {
+		if ticked[key] != floor {
+			manager.MobAI.Forget(floor)
+		}
+	}
+	manager.ticked = ticked
+}
+
+// tickStatusEffects runs the status effects of the characters on a floor who
+// aren't in an encounter, which runs them on their turns instead. The caller
+// must hold the manager's lock.
+func (manager *GameManager) tickStatusEffects(clients []*Client, floor *models.Floor) {
+	for _, client := range clients {
+		character := client.Character
+		if len(character.StatusEffects) == 0 || character.IsDead() {
+			continue
+		}
+		if manager.Encounters != nil && manager.Encounters.InEncounter(character.ID) {
+			continue
+		}
+
+		turn := character.StatusEffects.Tick()
+		character.CurrentHP += min(turn.Healing, character.MaxHP-character.CurrentHP)
+		died := turn.Damage > 0 && damageCharacter(character, turn.Damage)
+		manager.CharacterRepo.Save(character)
+
+		if turn.Damage > 0 {
+			queueMessage(client, Message{
+				Type: MsgNotification,
+				Text: fmt.Sprintf("You take %d damage from your wounds!", turn.Damage),
+			})
+		}
+		queueMessage(client, Message{Type: MsgUpdatePlayer, Character: character})
+		if died {
+			manager.leaveEncounter(character)
+			manager.handleDeath(character.CurrentDungeon, floor, character, DeathCause(nil))
+		}
+	}
+}
+
+// sendMobTickResult notifies the clients on a floor about what the mobs did
+func (manager *GameManager) sendMobTickResult(clients []*Client, floor *models.Floor, result MobTickResult) {
+	// Clients only hear about mobs their character can currently see
+	visibility := make(map[string]Visibility, len(clients))
+	for _, client := range clients {
+		visibility[client.ID] = ComputeFOV(floor, client.Character.Position, ViewRadius(client.Character))
+	}
+
+	// Mobs that moved and had their effects run are only sent once
+	updated := make(map[string]bool, len(result.Moved)+len(result.Affected))
+	for _, mob := range append(append([]*models.Mob(nil), result.Moved...), result.Affected...) {
+		if updated[mob.ID] {
+			continue
+		}
+		updated[mob.ID] = true
+		mobCopy := *mob
+		for _, client := range clients {
+			if visibility[client.ID][mob.Position] {
+				queueMessage(client, Message{Type: MsgUpdateMob, Mob: &mobCopy})
+			}
+		}
+	}
+
+	for _, mob := range result.Removed {
+		mobCopy := *mob
+		for _, client := range clients {
+			if visibility[client.ID][mob.Position] {
+				queueMessage(client, Message{Type: MsgRemoveMob, Mob: &mobCopy})
+			}
+		}
+	}
+
+	killers := make(map[string]*models.Mob)
+	for _, attack := range result.Attacks {
+		mob := floor.Mobs[attack.MobID]
+		for _, client := range clients {
+			if client.Character.ID != attack.CharacterID {
+				continue
+			}
+
+			text := fmt.Sprintf("The %s misses you.", mob.Name)
+			if attack.Hit {
+				text = fmt.Sprintf("The %s hits you for %d damage!", mob.Name, attack.Damage)
+				if attack.Effect != nil {
+					text += fmt.Sprintf(" You are afflicted with %s!", attack.Effect.Type)
+				}
+				manager.CharacterRepo.Save(client.Character)
+				if client.Character.IsDead() && killers[client.Character.ID] == nil {
+					killers[client.Character.ID] = mob
+				}
+			}
+
+			queueMessage(client, Message{Type: MsgNotification, Text: text})
+			queueMessage(client, Message{Type: MsgUpdatePlayer, Character: client.Character})
+		}
+	}
+
+	for _, action := range result.Bosses {
+		boss := floor.Mobs[action.MobID]
+		for _, client := range clients {
+			hit, wasHit := bossHitOn(action, client.Character.ID)
+			if !wasHit && !visibility[client.ID][boss.Position] {
+				continue
+			}
+
+			text := action.Message
+			if wasHit {
+				text += fmt.Sprintf(" It hits you for %d damage!", hit.Damage)
+				manager.CharacterRepo.Save(client.Character)
+				if hit.Died && killers[client.Character.ID] == nil {
+					killers[client.Character.ID] = boss
+				}
+			}
+
+			actionCopy := action
+			queueMessage(client, Message{Type: MsgNotification, Text: text, Boss: &actionCopy})
+			if wasHit {
+				queueMessage(client, Message{Type: MsgUpdatePlayer, Character: client.Character})
+			}
+		}
+	}
+
+	// Sealed and opened boss rooms show up as floor changes
+	if len(result.Sealed) > 0 || len(result.Opened) > 0 {
+		text := "Stone slabs slam down over the doorways!"
+		if len(result.Sealed) == 0 {
+			text = "The sealed doors grind open."
+		}
+		for _, client := range clients {
+			queueMessage(client, Message{Type: MsgNotification, Text: text})
+		}
+		manager.syncFloorClients(clients, clients[0].Character.CurrentDungeon, floor)
+	}
+
+	for _, client := range clients {
+		if mob, killed := killers[client.Character.ID]; killed {
+			manager.leaveEncounter(client.Character)
+			manager.handleDeath(client.Character.CurrentDungeon, floor, client.Character, DeathCause(mob))
+		}
+	}
+}
+
+// bossHitOn returns the hit a boss's special attack landed on a character, if it hit them
+func bossHitOn(action BossAction, characterID string) (BossHit, bool) {
+	for _, hit := range action.Hits {
+		if hit.CharacterID == characterID {
+			return hit, true
+		}
+	}
+	return BossHit{}, false
+}
+
+// recordBossKill records a character slaying a boss in their current dungeon
+func (manager *GameManager) recordBossKill(character *models.Character, mob *models.Mob) {
+	dungeon, err := manager.DungeonRepo.GetByID(character.CurrentDungeon)
+	if err != nil {
+		log.Error("Failed to record boss kill in dungeon %s: %v", character.CurrentDungeon, err)
+		return
+	}
+
+	dungeon.RecordBossKill(mob, character.CurrentFloor, character)
+	log.Info("Character %s slew %s on floor %d of dungeon %s", character.ID, mob.Name, character.CurrentFloor, dungeon.ID)
+	if err := manager.DungeonRepo.Save(dungeon); err != nil {
+		log.Error("Failed to save dungeon %s: %v", dungeon.ID, err)
+	}
+}
+
+// HandleDeath kills a character on a floor, applying the manager's death penalty,
+// and tells everyone on the floor. The caller must hold the world lock. It leaves
+// the character's encounter alone, since encounters report deaths during their own
+// turns; every other death calls leaveEncounter first.
+func (manager *GameManager) HandleDeath(dungeonID string, floor *models.Floor, character *models.Character, cause string) DeathEvent {
+	manager.mutex.RLock()
+	defer manager.mutex.RUnlock()
+
+	return manager.handleDeath(dungeonID, floor, character, cause)
+}
+
+// handleDeath kills a character and notifies the floor. The caller must hold the manager's lock.
+func (manager *GameManager) handleDeath(dungeonID string, floor *models.Floor, character *models.Character, cause string) DeathEvent {
+	event := KillCharacter(floor, dungeonID, character, cause, manager.DeathPenalty)
+	log.Info("Character %s died on floor %d of dungeon %s: %s", character.ID, floor.Level, dungeonID, cause)
+
+	if err := manager.CharacterRepo.Save(character); err != nil {
+		log.Error("Failed to save character %s after death: %v", character.ID, err)
+	}
+	if err := manager.DungeonRepo.SaveFloor(dungeonID, floor.Level, floor); err != nil {
+		log.Error("Failed to save floor %d of dungeon %s: %v", floor.Level, dungeonID, err)
+	}
+
+	clients := manager.floorClients(dungeonID, floor.Level)
+	for _, client := range clients {
+		eventCopy := event
+		queueMessage(client, Message{Type: MsgDeath, Death: &eventCopy})
+	}
+	manager.syncFloorClients(clients, dungeonID, floor)
+
+	if clientID, ok := manager.CharacterToClient[character.ID]; ok {
+		if client, exists := manager.Clients[clientID]; exists {
+			queueMessage(client, Message{Type: MsgUpdatePlayer, Character: character})
+		}
+	}
+
+	return event
+}
+
+// SendToCharacter queues a message for a character's client, if they are connected
+func (manager *GameManager) SendToCharacter(characterID string, message Message) {
+	manager.mutex.RLock()
+	defer manager.mutex.RUnlock()
+
+	if client, exists := manager.Clients[manager.CharacterToClient[characterID]]; exists {
+		queueMessage(client, message)
+	}
+}
+
+// queueMessage sends a message to a client without blocking the caller.
+// Messages for clients whose queue is full are dropped.
+func queueMessage(client *Client, message Message) {
+	select {
+	case client.Send <- message:
+	default:
+		log.Warn("Dropping %s message for client %s: send queue full", message.Type, client.ID)
+	}
+}
+
+// HandleMessage handles a message from a client, holding the world lock while it does
 func (manager *GameManager) HandleMessage(client *Client, message Message) {
+	manager.World.Lock()
+	defer manager.World.Unlock()
+
 	// Validate that the character ID in the message matches the client's character
 	if message.CharacterID != "" && client.Character != nil && message.CharacterID != client.Character.ID {
-		client.Send <- Message{
+		queueMessage(client, Message{
 			Type:  MsgError,
 			Error: "Invalid character ID",
-		}
+		})
 		return
 	}
 
@@ -221,40 +629,63 @@ func (manager *GameManager) HandleMessage(client *Client, message Message) {
 		manager.handleEquipItem(client, message)
 	case MsgUnequipItem:
 		manager.handleUnequipItem(client, message)
+	case MsgAck:
+		manager.handleAck(client, message)
+	case MsgResync:
+		manager.handleResync(client, message)
+	case MsgLoot:
+		manager.handleLoot(client, message)
+	case MsgCast:
+		manager.handleCast(client, message)
+	case MsgPartyChat:
+		manager.handlePartyChat(client, message)
+	case MsgLootRoll:
+		manager.handleLootRoll(client, message)
+	case MsgShop:
+		manager.handleShop(client, message)
+	case MsgBuy, MsgSell:
+		manager.handleTrade(client, message)
+	case MsgHaggle:
+		manager.handleHaggle(client, message)
+	case MsgDisarm:
+		manager.handleDisarm(client, message)
+	case MsgInteract:
+		manager.handleInteract(client, message)
 	default:
-		client.Send <- Message{
+		queueMessage(client, Message{
 			Type:  MsgError,
 			Error: "Unknown message type",
-		}
+			Code:  ErrCodeUnknownType,
+		})
 	}
 }
 
 // handleMove handles a move message
 func (manager *GameManager) handleMove(client *Client, message Message) {
 	if client.Character == nil || client.Character.CurrentDungeon == "" {
-		client.Send <- Message{
+		queueMessage(client, Message{
 			Type:  MsgError,
 			Error: "Character not in a dungeon",
-		}
+		})
 		return
 	}
 
 	// Get the current floor
 	_, err := manager.DungeonRepo.GetByID(client.Character.CurrentDungeon)
 	if err != nil {
-		client.Send <- Message{
+		queueMessage(client, Message{
 			Type:  MsgError,
 			Error: "Dungeon not found",
-		}
+		})
 		return
 	}
 
 	floor, err := manager.DungeonRepo.GetFloor(client.Character.CurrentDungeon, client.Character.CurrentFloor)
 	if err != nil {
-		client.Send <- Message{
+		queueMessage(client, Message{
 			Type:  MsgError,
 			Error: "Floor not found",
-		}
+		})
 		return
 	}
 
@@ -274,28 +705,28 @@ func (manager *GameManager) handleMove(client *Client, message Message) {
 
 	// Check if the new position is valid
 	if newX < 0 || newX >= floor.Width || newY < 0 || newY >= floor.Height {
-		client.Send <- Message{
+		queueMessage(client, Message{
 			Type:  MsgError,
 			Error: "Invalid move: out of bounds",
-		}
+		})
 		return
 	}
 
 	// Check if the tile is walkable
 	if !floor.Tiles[newY][newX].Walkable {
-		client.Send <- Message{
+		queueMessage(client, Message{
 			Type:  MsgError,
 			Error: "Invalid move: tile not walkable",
-		}
+		})
 		return
 	}
 
 	// Check if there's a mob on the tile
 	if floor.Tiles[newY][newX].MobID != "" {
-		client.Send <- Message{
+		queueMessage(client, Message{
 			Type:  MsgError,
 			Error: "Invalid move: tile occupied by mob",
-		}
+		})
 		return
 	}
 
@@ -305,221 +736,714 @@ func (manager *GameManager) handleMove(client *Client, message Message) {
 
 	// Update the new tile
 	floor.Tiles[newY][newX].Character = client.Character.ID
+	floor.MarkTiles(models.Position{X: oldX, Y: oldY}, models.Position{X: newX, Y: newY})
 
 	// Update character position
 	client.Character.Position.X = newX
 	client.Character.Position.Y = newY
 
-	// Save the character
-	manager.CharacterRepo.Save(client.Character)
+	// A hidden trap on the new tile goes off, and passive Perception may spot the traps nearby
+	var trapResult *TrapResult
+	if trap, exists := TrapAt(floor, client.Character.Position); exists {
+		result := TriggerTrap(floor, trap, client.Character, manager.rng)
+		trapResult = &result
+	}
+	spotted := DetectTraps(floor, client.Character)
+	plate, pressed := StepOnPlate(floor, client.Character)
 
 	// Notify the client
-	client.Send <- Message{
+	queueMessage(client, Message{
 		Type:      MsgUpdatePlayer,
 		Character: client.Character,
+	})
+
+	// Send everyone on the floor the change, including the tiles the move revealed
+	manager.BroadcastFloorUpdate(client.Character.CurrentDungeon, client.Character.CurrentFloor)
+
+	// Save the character
+	manager.CharacterRepo.Save(client.Character)
+
+	// Show the character's party where they are
+	manager.Parties.Update(client.Character.ID)
+
+	if trapResult != nil {
+		queueMessage(client, Message{
+			Type:      MsgNotification,
+			Text:      trapResult.Message,
+			Character: client.Character,
+			Trap:      trapResult,
+		})
+		if trapResult.Died {
+			manager.leaveEncounter(client.Character)
+			manager.HandleDeath(client.Character.CurrentDungeon, floor, client.Character, "killed by a "+trapResult.Trap.Name())
+			return
+		}
 	}
 
+	// Walking out of reach of the mobs in a fight leaves it
+	if manager.Encounters != nil {
+		manager.Encounters.Disengage(floor, client.Character)
+	}
+	for _, trap := range spotted {
+		queueMessage(client, Message{
+			Type: MsgNotification,
+			Text: "You spot a " + trap.Name() + ".",
+		})
+	}
+	if pressed {
+		queueMessage(client, Message{
+			Type:      MsgNotification,
+			Text:      plate.Message,
+			Character: client.Character,
+			Puzzle:    &plate,
+		})
+	}
+
+	// A teleport trap may have moved the character
+	newX, newY = client.Character.Position.X, client.Character.Position.Y
+
 	// Check if the character is on stairs
 	if floor.Tiles[newY][newX].Type == models.TileUpStairs {
-		client.Send <- Message{
+		queueMessage(client, Message{
 			Type: MsgNotification,
 			Text: "You are standing on stairs leading up. Press 'u' to ascend.",
-		}
+		})
 	} else if floor.Tiles[newY][newX].Type == models.TileDownStairs {
-		client.Send <- Message{
+		queueMessage(client, Message{
 			Type: MsgNotification,
 			Text: "You are standing on stairs leading down. Press 'd' to descend.",
+		})
+	}
+
+	// Check if there's an item on the tile
+	if floor.Tiles[newY][newX].ItemID != "" {
+		item := floor.Items[floor.Tiles[newY][newX].ItemID]
+		queueMessage(client, Message{
+			Type: MsgNotification,
+			Text: "You see a " + item.Name + " here. Press 'g' to pick it up.",
+		})
+	}
+}
+
+// MoveCharacter puts a character on a tile of their floor as if they had walked
+// there: whatever lies on the tile goes off and everyone on the floor is sent the
+// change. It returns the character's death if a trap kills them. The caller must
+// hold the world lock.
+func (manager *GameManager) MoveCharacter(floor *models.Floor, character *models.Character, to models.Position) *DeathEvent {
+	from := character.Position
+	if hasTile(floor, from) && floor.Tiles[from.Y][from.X].Character == character.ID {
+		floor.Tiles[from.Y][from.X].Character = ""
+	}
+	floor.Tiles[to.Y][to.X].Character = character.ID
+	floor.MarkTiles(from, to)
+	character.Position = to
+
+	dungeonID := character.CurrentDungeon
+	if trap, exists := TrapAt(floor, to); exists {
+		if result := TriggerTrap(floor, trap, character, manager.rng); result.Died {
+			manager.leaveEncounter(character)
+			event := manager.HandleDeath(dungeonID, floor, character, "killed by a "+trap.Name())
+			return &event
+		}
+	}
+	StepOnPlate(floor, character)
+
+	// Walking out of reach of the mobs in a fight leaves it
+	if manager.Encounters != nil {
+		manager.Encounters.Disengage(floor, character)
+	}
+
+	if err := manager.DungeonRepo.SaveFloor(dungeonID, floor.Level, floor); err != nil {
+		log.Error("Failed to save floor %d of dungeon %s: %v", floor.Level, dungeonID, err)
+	}
+	manager.BroadcastFloorUpdate(dungeonID, floor.Level)
+	manager.SendToCharacter(character.ID, Message{
+		Type:      MsgUpdatePlayer,
+		Character: character,
+	})
+	manager.Parties.Update(character.ID)
+
+	return nil
+}
+
+// handleAttack handles an attack message
+func (manager *GameManager) handleAttack(client *Client, message Message) {
+	// This is a placeholder for the attack logic
+	// In a real implementation, you would check if the target is valid,
+	// calculate damage, update mob health, etc.
+	queueMessage(client, Message{
+		Type: MsgNotification,
+		Text: "Attack not implemented yet",
+	})
+}
+
+// handlePickup handles a pickup message
+func (manager *GameManager) handlePickup(client *Client, message Message) {
+	// Get the character
+	character := client.Character
+	if character == nil {
+		queueMessage(client, Message{
+			Type:  MsgError,
+			Error: "Character not found",
+		})
+		return
+	}
+
+	// Get the item ID from the message
+	itemID := message.ItemID
+	if itemID == "" {
+		queueMessage(client, Message{
+			Type:  MsgError,
+			Error: "No item specified",
+		})
+		return
+	}
+
+	// Get the current floor
+	dungeon, err := manager.DungeonRepo.GetByID(character.CurrentDungeon)
+	if err != nil {
+		queueMessage(client, Message{
+			Type:  MsgError,
+			Error: "Dungeon not found",
+		})
+		return
+	}
+
+	floor := dungeon.FloorData[character.CurrentFloor]
+	if floor == nil {
+		queueMessage(client, Message{
+			Type:  MsgError,
+			Error: "Floor not found",
+		})
+		return
+	}
+
+	// Find the item on the floor
+	item, exists := floor.Items[itemID]
+	if !exists {
+		queueMessage(client, Message{
+			Type:  MsgError,
+			Error: "Item not found on this floor",
+		})
+		return
+	}
+
+	// Check if the character is at the same position as the item
+	if character.Position.X != item.Position.X || character.Position.Y != item.Position.Y {
+		queueMessage(client, Message{
+			Type:  MsgError,
+			Error: "Item is not at your position",
+		})
+		return
+	}
+
+	// Party loot rules may keep the item for someone else
+	if err := manager.Parties.CanPickUp(character.ID, item); err != nil {
+		queueMessage(client, Message{
+			Type:  MsgError,
+			Error: "Cannot pick up item: " + err.Error(),
+		})
+		return
+	}
+	item.ReservedFor = ""
+
+	// Create a pointer to the item for adding to inventory
+	itemPtr := &item
+
+	// Check if adding this item would exceed the character's weight limit
+	if !character.CanAddItem(itemPtr) {
+		queueMessage(client, Message{
+			Type:  MsgError,
+			Error: "Cannot pick up item: weight limit exceeded",
+		})
+		return
+	}
+
+	// Add the item to the character's inventory
+	success := character.AddToInventory(itemPtr)
+	if !success {
+		queueMessage(client, Message{
+			Type:  MsgError,
+			Error: "Failed to add item to inventory",
+		})
+		return
+	}
+
+	// Remove the item from the floor
+	delete(floor.Items, itemID)
+	floor.MarkItems(itemID)
+	floor.MarkTiles(item.Position)
+
+	// Save the updated character
+	err = manager.CharacterRepo.Save(character)
+	if err != nil {
+		queueMessage(client, Message{
+			Type:  MsgError,
+			Error: "Failed to save character",
+		})
+		return
+	}
+
+	// Save the updated dungeon
+	err = manager.DungeonRepo.Save(dungeon)
+	if err != nil {
+		queueMessage(client, Message{
+			Type:  MsgError,
+			Error: "Failed to save dungeon",
+		})
+		return
+	}
+
+	// Send success message to the client
+	queueMessage(client, Message{
+		Type:      MsgNotification,
+		Text:      "You picked up " + item.Name,
+		Character: character,
+		Item:      itemPtr,
+	})
+
+	// Broadcast the floor update to all clients on this floor
+	manager.BroadcastFloorUpdate(character.CurrentDungeon, character.CurrentFloor)
+}
+
+// handleLoot handles a loot message, taking back what the character left on their corpse
+func (manager *GameManager) handleLoot(client *Client, message Message) {
+	character := client.Character
+	if character == nil || character.CurrentDungeon == "" {
+		queueMessage(client, Message{
+			Type:  MsgError,
+			Error: "Character not in a dungeon",
+		})
+		return
+	}
+
+	floor, err := manager.DungeonRepo.GetFloor(character.CurrentDungeon, character.CurrentFloor)
+	if err != nil || !hasTile(floor, character.Position) {
+		queueMessage(client, Message{
+			Type:  MsgError,
+			Error: "Floor not found",
+		})
+		return
+	}
+
+	// The character must be standing on their own corpse
+	corpse, exists := floor.Corpses[floor.Tiles[character.Position.Y][character.Position.X].CorpseID]
+	if !exists {
+		queueMessage(client, Message{
+			Type:  MsgError,
+			Error: "There is no corpse here",
+		})
+		return
+	}
+	if corpse.CharacterID != character.ID {
+		queueMessage(client, Message{
+			Type:  MsgError,
+			Error: "You can only loot your own corpse",
+		})
+		return
+	}
+
+	items, gold := LootCorpse(floor, corpse, character)
+
+	if err := manager.CharacterRepo.Save(character); err != nil {
+		queueMessage(client, Message{
+			Type:  MsgError,
+			Error: "Failed to save character",
+		})
+		return
+	}
+	if err := manager.DungeonRepo.SaveFloor(character.CurrentDungeon, character.CurrentFloor, floor); err != nil {
+		log.Error("Failed to save floor %d of dungeon %s: %v", character.CurrentFloor, character.CurrentDungeon, err)
+	}
+
+	text := fmt.Sprintf("You recover %d items and %d gold from your corpse.", items, gold)
+	if !corpse.IsEmpty() {
+		text += " You can't carry everything."
+	}
+	queueMessage(client, Message{
+		Type:      MsgNotification,
+		Text:      text,
+		Character: character,
+	})
+
+	manager.BroadcastFloorUpdate(character.CurrentDungeon, character.CurrentFloor)
+}
+
+// handleCast handles a cast message, using one of the character's abilities on the mob named by TargetID
+func (manager *GameManager) handleCast(client *Client, message Message) {
+	character := client.Character
+	if character == nil || character.CurrentDungeon == "" {
+		queueMessage(client, Message{
+			Type:  MsgError,
+			Error: "Character not in a dungeon",
+		})
+		return
+	}
+
+	floor, err := manager.DungeonRepo.GetFloor(character.CurrentDungeon, character.CurrentFloor)
+	if err != nil {
+		queueMessage(client, Message{
+			Type:  MsgError,
+			Error: "Floor not found",
+		})
+		return
+	}
+
+	// Casting at a mob joins the fight with it, and fights are taken in turns
+	target := floor.Mobs[message.TargetID]
+	if err := manager.engage(floor, character, target); err != nil {
+		queueMessage(client, Message{
+			Type:  MsgError,
+			Error: capitalize(err.Error()),
+		})
+		return
+	}
+
+	result := manager.Combat.Cast(character, message.AbilityID, floor, message.TargetID)
+
+	if err := manager.CharacterRepo.Save(character); err != nil {
+		log.Error("Failed to save character %s: %v", character.ID, err)
+	}
+	if err := manager.DungeonRepo.SaveFloor(character.CurrentDungeon, character.CurrentFloor, floor); err != nil {
+		log.Error("Failed to save floor %d of dungeon %s: %v", character.CurrentFloor, character.CurrentDungeon, err)
+	}
+
+	queueMessage(client, Message{
+		Type:      MsgNotification,
+		Text:      result.Message,
+		Character: character,
+		Combat:    &result,
+	})
+
+	if result.Died {
+		manager.leaveEncounter(character)
+		manager.HandleDeath(character.CurrentDungeon, floor, character, DeathCause(target))
+		return
+	}
+	if result.TurnTaken && manager.Encounters != nil {
+		manager.Encounters.EndTurn(character.ID)
+	}
+	if result.Success {
+		manager.BroadcastFloorUpdate(character.CurrentDungeon, character.CurrentFloor)
+	}
+}
+
+// engage puts the character into an encounter with the mob they act against, if
+// there is one, and checks it's their turn in whatever fight they are in
+func (manager *GameManager) engage(floor *models.Floor, character *models.Character, mob *models.Mob) error {
+	if manager.Encounters == nil {
+		return nil
+	}
+	if mob != nil {
+		manager.Encounters.Engage(character.CurrentDungeon, floor, character, mob)
+		if !manager.Encounters.InEncounter(character.ID) {
+			return ErrEncounterOver
 		}
 	}
+	return manager.Encounters.CheckTurn(character.ID)
+}
+
+// leaveEncounter takes the character out of any fight they are in
+func (manager *GameManager) leaveEncounter(character *models.Character) {
+	if manager.Encounters != nil {
+		manager.Encounters.Leave(character.ID)
+	}
+}
+
+// handlePartyChat handles a party chat message, relaying its text to the character's party
+func (manager *GameManager) handlePartyChat(client *Client, message Message) {
+	if client.Character == nil {
+		queueMessage(client, Message{
+			Type:  MsgError,
+			Error: "Character not found",
+		})
+		return
+	}
 
-	// Check if there's an item on the tile
-	if floor.Tiles[newY][newX].ItemID != "" {
-		item := floor.Items[floor.Tiles[newY][newX].ItemID]
-		client.Send <- Message{
-			Type: MsgNotification,
-			Text: "You see a " + item.Name + " here. Press 'g' to pick it up.",
-		}
+	if err := manager.Parties.Chat(client.Character.ID, message.Text); err != nil {
+		queueMessage(client, Message{
+			Type:  MsgError,
+			Error: capitalize(err.Error()),
+		})
 	}
 }
 
-// handleAttack handles an attack message
-func (manager *GameManager) handleAttack(client *Client, message Message) {
-	// This is a placeholder for the attack logic
-	// In a real implementation, you would check if the target is valid,
-	// calculate damage, update mob health, etc.
-	client.Send <- Message{
-		Type: MsgNotification,
-		Text: "Attack not implemented yet",
+// handleLootRoll handles a loot roll message, rolling for the party item named by ItemID
+func (manager *GameManager) handleLootRoll(client *Client, message Message) {
+	if client.Character == nil {
+		queueMessage(client, Message{
+			Type:  MsgError,
+			Error: "Character not found",
+		})
+		return
+	}
+
+	if err := manager.Parties.Roll(client.Character.ID, message.ItemID, message.Choice); err != nil {
+		queueMessage(client, Message{
+			Type:  MsgError,
+			Error: capitalize(err.Error()),
+		})
 	}
 }
 
-// handlePickup handles a pickup message
-func (manager *GameManager) handlePickup(client *Client, message Message) {
-	// Get the character
-	character := client.Character
-	if character == nil {
-		client.Send <- Message{
+// handleShop handles a shop message, sending the shop the character is standing in
+func (manager *GameManager) handleShop(client *Client, message Message) {
+	if client.Character == nil {
+		queueMessage(client, Message{
 			Type:  MsgError,
 			Error: "Character not found",
-		}
+		})
 		return
 	}
 
-	// Get the item ID from the message
-	itemID := message.ItemID
-	if itemID == "" {
-		client.Send <- Message{
+	shop, err := manager.Shops.viewShop(client.Character)
+	if err != nil {
+		queueMessage(client, Message{
 			Type:  MsgError,
-			Error: "No item specified",
-		}
+			Error: capitalize(err.Error()),
+		})
 		return
 	}
 
-	// Get the current floor
-	dungeon, err := manager.DungeonRepo.GetByID(character.CurrentDungeon)
-	if err != nil {
-		client.Send <- Message{
+	queueMessage(client, Message{
+		Type: MsgShop,
+		Shop: &shop,
+	})
+}
+
+// handleTrade handles a buy or sell message for the item named by ItemID
+func (manager *GameManager) handleTrade(client *Client, message Message) {
+	if client.Character == nil {
+		queueMessage(client, Message{
 			Type:  MsgError,
-			Error: "Dungeon not found",
-		}
+			Error: "Character not found",
+		})
 		return
 	}
 
-	floor := dungeon.FloorData[character.CurrentFloor]
-	if floor == nil {
-		client.Send <- Message{
+	var trade Trade
+	var err error
+	if message.Type == MsgBuy {
+		trade, err = manager.Shops.buy(client.Character, message.ItemID)
+	} else {
+		trade, err = manager.Shops.sell(client.Character, message.ItemID)
+	}
+	if err != nil {
+		queueMessage(client, Message{
 			Type:  MsgError,
-			Error: "Floor not found",
-		}
+			Error: capitalize(err.Error()),
+		})
 		return
 	}
 
-	// Find the item on the floor
-	item, exists := floor.Items[itemID]
-	if !exists {
-		client.Send <- Message{
+	text := fmt.Sprintf("You buy %s for %d gold", trade.Item.Name, trade.Price)
+	if message.Type == MsgSell {
+		text = fmt.Sprintf("You sell %s for %d gold", trade.Item.Name, trade.Price)
+	}
+	queueMessage(client, Message{
+		Type:      MsgNotification,
+		Text:      text,
+		Character: client.Character,
+		Item:      trade.Item,
+		Shop:      &trade.Shop,
+	})
+}
+
+// handleHaggle handles a haggle message, trying for a discount at the shop the character is standing in
+func (manager *GameManager) handleHaggle(client *Client, message Message) {
+	if client.Character == nil {
+		queueMessage(client, Message{
 			Type:  MsgError,
-			Error: "Item not found on this floor",
-		}
+			Error: "Character not found",
+		})
 		return
 	}
 
-	// Check if the character is at the same position as the item
-	if character.Position.X != item.Position.X || character.Position.Y != item.Position.Y {
-		client.Send <- Message{
+	success, shop, err := manager.Shops.haggle(client.Character)
+	if err != nil {
+		queueMessage(client, Message{
 			Type:  MsgError,
-			Error: "Item is not at your position",
-		}
+			Error: capitalize(err.Error()),
+		})
 		return
 	}
 
-	// Create a pointer to the item for adding to inventory
-	itemPtr := &item
+	text := "The shopkeeper won't budge on their prices"
+	if success {
+		text = fmt.Sprintf("The shopkeeper agrees to take %d%% off", shop.Discount)
+	}
+	queueMessage(client, Message{
+		Type:      MsgNotification,
+		Text:      text,
+		Character: client.Character,
+		Shop:      &shop,
+	})
+}
 
-	// Check if adding this item would exceed the character's weight limit
-	if !character.CanAddItem(itemPtr) {
-		client.Send <- Message{
+// handleDisarm handles a disarm message, trying to disarm the trap named by TargetID
+func (manager *GameManager) handleDisarm(client *Client, message Message) {
+	character := client.Character
+	if character == nil || character.CurrentDungeon == "" {
+		queueMessage(client, Message{
 			Type:  MsgError,
-			Error: "Cannot pick up item: weight limit exceeded",
-		}
+			Error: "Character not in a dungeon",
+		})
 		return
 	}
 
-	// Add the item to the character's inventory
-	success := character.AddToInventory(itemPtr)
-	if !success {
-		client.Send <- Message{
+	floor, err := manager.DungeonRepo.GetFloor(character.CurrentDungeon, character.CurrentFloor)
+	if err != nil {
+		queueMessage(client, Message{
 			Type:  MsgError,
-			Error: "Failed to add item to inventory",
-		}
+			Error: "Floor not found",
+		})
 		return
 	}
 
-	// Remove the item from the floor
-	delete(floor.Items, itemID)
+	// Characters can only disarm traps they know about
+	trap, exists := floor.Traps[message.TargetID]
+	if !exists || !trap.Revealed {
+		queueMessage(client, Message{
+			Type:  MsgError,
+			Error: "There is no trap there",
+		})
+		return
+	}
+	if chebyshevDistance(character.Position, trap.Position) > trapDisarmRange {
+		queueMessage(client, Message{
+			Type:  MsgError,
+			Error: "You are too far away to disarm that trap",
+		})
+		return
+	}
 
-	// Save the updated character
-	err = manager.CharacterRepo.Save(character)
+	_, result := DisarmTrap(floor, trap, character, manager.rng)
+
+	if err := manager.CharacterRepo.Save(character); err != nil {
+		log.Error("Failed to save character %s: %v", character.ID, err)
+	}
+	if err := manager.DungeonRepo.SaveFloor(character.CurrentDungeon, character.CurrentFloor, floor); err != nil {
+		log.Error("Failed to save floor %d of dungeon %s: %v", character.CurrentFloor, character.CurrentDungeon, err)
+	}
+
+	queueMessage(client, Message{
+		Type:      MsgNotification,
+		Text:      result.Message,
+		Character: character,
+		Trap:      &result,
+	})
+
+	if result.Died {
+		manager.leaveEncounter(character)
+		manager.HandleDeath(character.CurrentDungeon, floor, character, "killed by a "+trap.Name())
+		return
+	}
+	manager.BroadcastFloorUpdate(character.CurrentDungeon, character.CurrentFloor)
+}
+
+// handleInteract handles an interact message, using the door or chest named by TargetID
+func (manager *GameManager) handleInteract(client *Client, message Message) {
+	character := client.Character
+	if character == nil || character.CurrentDungeon == "" {
+		queueMessage(client, Message{
+			Type:  MsgError,
+			Error: "Character not in a dungeon",
+		})
+		return
+	}
+
+	floor, err := manager.DungeonRepo.GetFloor(character.CurrentDungeon, character.CurrentFloor)
 	if err != nil {
-		client.Send <- Message{
+		queueMessage(client, Message{
 			Type:  MsgError,
-			Error: "Failed to save character",
-		}
+			Error: "Floor not found",
+		})
 		return
 	}
 
-	// Save the updated dungeon
-	err = manager.DungeonRepo.Save(dungeon)
+	result, err := Interact(floor, character, message.TargetID, manager.rng)
 	if err != nil {
-		client.Send <- Message{
+		queueMessage(client, Message{
 			Type:  MsgError,
-			Error: "Failed to save dungeon",
-		}
+			Error: capitalize(err.Error()),
+		})
 		return
 	}
 
-	// Send success message to the client
-	client.Send <- Message{
-		Type:      MsgNotification,
-		Text:      "You picked up " + item.Name,
-		Character: character,
-		Item:      itemPtr,
+	if err := manager.CharacterRepo.Save(character); err != nil {
+		log.Error("Failed to save character %s: %v", character.ID, err)
+	}
+	if err := manager.DungeonRepo.SaveFloor(character.CurrentDungeon, character.CurrentFloor, floor); err != nil {
+		log.Error("Failed to save floor %d of dungeon %s: %v", character.CurrentFloor, character.CurrentDungeon, err)
 	}
 
-	// Broadcast the floor update to all clients on this floor
+	queueMessage(client, Message{
+		Type:        MsgNotification,
+		Text:        result.Message,
+		Character:   character,
+		Interaction: &result,
+	})
+
+	if result.Trap != nil && result.Trap.Died {
+		manager.leaveEncounter(character)
+		manager.HandleDeath(character.CurrentDungeon, floor, character, "killed by a "+result.Trap.Trap.Name())
+		return
+	}
 	manager.BroadcastFloorUpdate(character.CurrentDungeon, character.CurrentFloor)
 }
 
 // handleAscend handles an ascend message
 func (manager *GameManager) handleAscend(client *Client, message Message) {
 	if client.Character == nil || client.Character.CurrentDungeon == "" {
-		client.Send <- Message{
+		queueMessage(client, Message{
 			Type:  MsgError,
 			Error: "Character not in a dungeon",
-		}
+		})
 		return
 	}
 
 	// Get the current floor
-	_, err := manager.DungeonRepo.GetByID(client.Character.CurrentDungeon)
+	dungeon, err := manager.DungeonRepo.GetByID(client.Character.CurrentDungeon)
 	if err != nil {
-		client.Send <- Message{
+		queueMessage(client, Message{
 			Type:  MsgError,
 			Error: "Dungeon not found",
-		}
+		})
 		return
 	}
 
 	floor, err := manager.DungeonRepo.GetFloor(client.Character.CurrentDungeon, client.Character.CurrentFloor)
 	if err != nil {
-		client.Send <- Message{
+		queueMessage(client, Message{
 			Type:  MsgError,
 			Error: "Floor not found",
-		}
+		})
 		return
 	}
 
 	// Check if the character is on up stairs
 	x, y := client.Character.Position.X, client.Character.Position.Y
 	if floor.Tiles[y][x].Type != models.TileUpStairs {
-		client.Send <- Message{
+		queueMessage(client, Message{
 			Type:  MsgError,
 			Error: "You are not on stairs leading up",
-		}
+		})
 		return
 	}
 
 	// Check if we're already at the top floor
 	if client.Character.CurrentFloor == 1 {
-		client.Send <- Message{
+		queueMessage(client, Message{
 			Type:  MsgError,
 			Error: "You are already at the top floor",
-		}
+		})
 		return
 	}
 
-	// Update the old tile
+	// Update the old tile, leaving any fight behind
 	floor.Tiles[y][x].Character = ""
+	floor.MarkTiles(models.Position{X: x, Y: y})
+	manager.leaveEncounter(client.Character)
 
 	// Update character floor
 	client.Character.CurrentFloor--
@@ -527,12 +1451,13 @@ func (manager *GameManager) handleAscend(client *Client, message Message) {
 	// Get the new floor
 	newFloor, err := manager.DungeonRepo.GetFloor(client.Character.CurrentDungeon, client.Character.CurrentFloor)
 	if err != nil {
-		client.Send <- Message{
+		queueMessage(client, Message{
 			Type:  MsgError,
 			Error: "Floor not found",
-		}
+		})
 		return
 	}
+	manager.generateFloorIfNeeded(dungeon, newFloor)
 
 	// Check if we're going to floor 1 (entrance floor)
 	if client.Character.CurrentFloor == 1 {
@@ -621,10 +1546,10 @@ func (manager *GameManager) handleAscend(client *Client, message Message) {
 		// For other floors, find a room with down stairs
 		// First try to find the down stairs that correspond to our up stairs
 		if len(newFloor.DownStairs) == 0 {
-			client.Send <- Message{
+			queueMessage(client, Message{
 				Type:  MsgError,
 				Error: "No down stairs found on the floor above",
-			}
+			})
 			return
 		}
 
@@ -683,80 +1608,87 @@ func (manager *GameManager) handleAscend(client *Client, message Message) {
 
 	// Update the new tile
 	newFloor.Tiles[client.Character.Position.Y][client.Character.Position.X].Character = client.Character.ID
+	newFloor.MarkTiles(client.Character.Position)
 
 	// Update the character's floor in the dungeon
 	manager.DungeonRepo.SetCharacterFloor(client.Character.CurrentDungeon, client.Character.ID, client.Character.CurrentFloor)
 
+	// Reveal the area around the arrival point before saving the character
+	floorChange := manager.fullSync(client, client.Character.CurrentDungeon, newFloor)
+
 	// Save the character
 	manager.CharacterRepo.Save(client.Character)
 
-	// Notify the client
-	client.Send <- Message{
-		Type:  MsgFloorChange,
-		Floor: newFloor,
-	}
+	// Notify the client, and the players on both floors
+	queueMessage(client, floorChange)
+	manager.BroadcastFloorUpdate(client.Character.CurrentDungeon, floor.Level)
+	manager.BroadcastFloorUpdate(client.Character.CurrentDungeon, newFloor.Level)
 
-	client.Send <- Message{
+	queueMessage(client, Message{
 		Type:      MsgUpdatePlayer,
 		Character: client.Character,
-	}
+	})
 
-	client.Send <- Message{
+	queueMessage(client, Message{
 		Type: MsgNotification,
 		Text: "You ascend to floor " + strconv.Itoa(client.Character.CurrentFloor),
-	}
+	})
+
+	manager.Parties.Update(client.Character.ID)
 }
 
 // handleDescend handles a descend message
 func (manager *GameManager) handleDescend(client *Client, message Message) {
 	if client.Character == nil || client.Character.CurrentDungeon == "" {
-		client.Send <- Message{
+		queueMessage(client, Message{
 			Type:  MsgError,
 			Error: "Character not in a dungeon",
-		}
+		})
 		return
 	}
 
 	// Get the current floor
 	dungeon, err := manager.DungeonRepo.GetByID(client.Character.CurrentDungeon)
 	if err != nil {
-		client.Send <- Message{
+		queueMessage(client, Message{
 			Type:  MsgError,
 			Error: "Dungeon not found",
-		}
+		})
 		return
 	}
 
 	floor, err := manager.DungeonRepo.GetFloor(client.Character.CurrentDungeon, client.Character.CurrentFloor)
 	if err != nil {
-		client.Send <- Message{
+		queueMessage(client, Message{
 			Type:  MsgError,
 			Error: "Floor not found",
-		}
+		})
 		return
 	}
 
 	// Check if the character is on down stairs
 	x, y := client.Character.Position.X, client.Character.Position.Y
 	if floor.Tiles[y][x].Type != models.TileDownStairs {
-		client.Send <- Message{
+		queueMessage(client, Message{
 			Type:  MsgError,
 			Error: "You are not on stairs leading down",
-		}
+		})
 		return
 	}
 
 	// Check if we're already at the bottom floor
 	if client.Character.CurrentFloor == dungeon.Floors {
-		client.Send <- Message{
+		queueMessage(client, Message{
 			Type:  MsgError,
 			Error: "You are already at the bottom floor",
-		}
+		})
 		return
 	}
 
-	// Update the old tile
+	// Update the old tile, leaving any fight behind
 	floor.Tiles[y][x].Character = ""
+	floor.MarkTiles(models.Position{X: x, Y: y})
+	manager.leaveEncounter(client.Character)
 
 	// Update character floor
 	client.Character.CurrentFloor++
@@ -764,12 +1696,13 @@ func (manager *GameManager) handleDescend(client *Client, message Message) {
 	// Get the new floor
 	newFloor, err := manager.DungeonRepo.GetFloor(client.Character.CurrentDungeon, client.Character.CurrentFloor)
 	if err != nil {
-		client.Send <- Message{
+		queueMessage(client, Message{
 			Type:  MsgError,
 			Error: "Floor not found",
-		}
+		})
 		return
 	}
+	manager.generateFloorIfNeeded(dungeon, newFloor)
 
 	// Find a safe room with up stairs if possible
 	var safeRoom *models.Room
@@ -857,64 +1790,82 @@ func (manager *GameManager) handleDescend(client *Client, message Message) {
 
 	// Update the new tile
 	newFloor.Tiles[client.Character.Position.Y][client.Character.Position.X].Character = client.Character.ID
+	newFloor.MarkTiles(client.Character.Position)
 
 	// Update the character's floor in the dungeon
 	manager.DungeonRepo.SetCharacterFloor(client.Character.CurrentDungeon, client.Character.ID, client.Character.CurrentFloor)
 
+	// Reveal the area around the arrival point before saving the character
+	floorChange := manager.fullSync(client, client.Character.CurrentDungeon, newFloor)
+
 	// Save the character
 	manager.CharacterRepo.Save(client.Character)
 
-	// Notify the client
-	client.Send <- Message{
-		Type:  MsgFloorChange,
-		Floor: newFloor,
-	}
+	// Notify the client, and the players on both floors
+	queueMessage(client, floorChange)
+	manager.BroadcastFloorUpdate(client.Character.CurrentDungeon, floor.Level)
+	manager.BroadcastFloorUpdate(client.Character.CurrentDungeon, newFloor.Level)
 
-	client.Send <- Message{
+	queueMessage(client, Message{
 		Type:      MsgUpdatePlayer,
 		Character: client.Character,
-	}
+	})
 
-	client.Send <- Message{
+	queueMessage(client, Message{
 		Type: MsgNotification,
 		Text: "You descend to floor " + strconv.Itoa(client.Character.CurrentFloor),
+	})
+
+	manager.Parties.Update(client.Character.ID)
+}
+
+// generateFloorIfNeeded populates a floor that the repository created as a blank
+// placeholder, so stairs always lead somewhere playable
+func (manager *GameManager) generateFloorIfNeeded(dungeon *models.Dungeon, floor *models.Floor) {
+	if len(floor.Rooms) > 0 {
+		return
+	}
+
+	GenerateDungeonFloor(dungeon, floor)
+	if err := manager.DungeonRepo.SaveFloor(dungeon.ID, floor.Level, floor); err != nil {
+		log.Error("Failed to save generated floor %d of dungeon %s: %v", floor.Level, dungeon.ID, err)
 	}
 }
 
 // handleUseItem handles a use item message
 func (manager *GameManager) handleUseItem(client *Client, message Message) {
 	// This is a placeholder for the use item logic
-	client.Send <- Message{
+	queueMessage(client, Message{
 		Type: MsgNotification,
 		Text: "Use item not implemented yet",
-	}
+	})
 }
 
 // handleDropItem handles a drop item message
 func (manager *GameManager) handleDropItem(client *Client, message Message) {
 	// This is a placeholder for the drop item logic
-	client.Send <- Message{
+	queueMessage(client, Message{
 		Type: MsgNotification,
 		Text: "Drop item not implemented yet",
-	}
+	})
 }
 
 // handleEquipItem handles an equip item message
 func (manager *GameManager) handleEquipItem(client *Client, message Message) {
 	// This is a placeholder for the equip item logic
-	client.Send <- Message{
+	queueMessage(client, Message{
 		Type: MsgNotification,
 		Text: "Equip item not implemented yet",
-	}
+	})
 }
 
 // handleUnequipItem handles an unequip item message
 func (manager *GameManager) handleUnequipItem(client *Client, message Message) {
 	// This is a placeholder for the unequip item logic
-	client.Send <- Message{
+	queueMessage(client, Message{
 		Type: MsgNotification,
 		Text: "Unequip item not implemented yet",
-	}
+	})
 }
 
 // Run starts the client's read and write pumps
@@ -938,7 +1889,7 @@ func (c *Client) readPump() {
 	})
 
 	for {
-		_, _, err := c.Connection.ReadMessage()
+		messageType, data, err := c.Connection.ReadMessage()
 		if err != nil {
 			if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseAbnormalClosure) {
 				log.Error("error: %v", err)
@@ -946,12 +1897,39 @@ func (c *Client) readPump() {
 			break
 		}
 
-		// Process the message
-		// TODO: Parse and handle the message
-		// ...
+		// Only JSON text frames are part of the protocol
+		if messageType != websocket.TextMessage {
+			c.sendError(ErrCodeUnsupportedFrame, "Only text frames are supported")
+			continue
+		}
+
+		// Parse the message
+		var message Message
+		if err := json.Unmarshal(data, &message); err != nil {
+			log.Warn("Invalid message from client %s: %v", c.ID, err)
+			c.sendError(ErrCodeInvalidJSON, "Invalid message format: "+err.Error())
+			continue
+		}
+
+		if message.Type == "" {
+			c.sendError(ErrCodeMissingType, "Message type is required")
+			continue
+		}
+
+		// Hand the message off to the game manager
+		c.Manager.HandleMessage(c, message)
 	}
 }
 
+// sendError queues a structured error reply for the client, dropping it if the queue is full
+func (c *Client) sendError(code string, text string) {
+	queueMessage(c, Message{
+		Type:  MsgError,
+		Error: text,
+		Code:  code,
+	})
+}
+
 // writePump pumps messages from the hub to the websocket connection
 func (c *Client) writePump() {
 	ticker := time.NewTicker(pingPeriod)
@@ -962,7 +1940,7 @@ func (c *Client) writePump() {
 
 	for {
 		select {
-		case _, ok := <-c.Send:
+		case message, ok := <-c.Send:
 			c.Connection.SetWriteDeadline(time.Now().Add(writeWait))
 			if !ok {
 				// The manager closed the channel.
@@ -970,9 +1948,23 @@ func (c *Client) writePump() {
 				return
 			}
 
+			// Batch any messages that queued up behind this one so bursts
+			// (e.g. a floor change followed by a player update) go out in one frame
+			if queued := len(c.Send); queued > 0 {
+				message = c.batchMessages(message, queued)
+			}
+
 			// Write the message to the websocket
-			// TODO: Implement message writing
-			// ...
+			data, err := c.marshal(message)
+			if err != nil {
+				log.Error("Failed to marshal message for client %s: %v", c.ID, err)
+				continue
+			}
+
+			if err := c.Connection.WriteMessage(websocket.TextMessage, data); err != nil {
+				log.Error("Failed to write message to client %s: %v", c.ID, err)
+				return
+			}
 
 		case <-ticker.C:
 			c.Connection.SetWriteDeadline(time.Now().Add(writeWait))
@@ -983,7 +1975,46 @@ func (c *Client) writePump() {
 	}
 }
 
-// BroadcastFloorUpdate broadcasts a floor update to all clients on the specified floor
+// marshal encodes a message under the world lock, since messages point at
+// characters and mobs that keep changing after they are queued
+func (c *Client) marshal(message Message) ([]byte, error) {
+	if c.Manager != nil {
+		c.Manager.World.Lock()
+		defer c.Manager.World.Unlock()
+	}
+	return json.Marshal(message)
+}
+
+// batchMessages drains up to queued pending messages and wraps them, along with
+// first, in a single MsgBatch message
+func (c *Client) batchMessages(first Message, queued int) Message {
+	if queued > maxBatchSize-1 {
+		queued = maxBatchSize - 1
+	}
+
+	batch := make([]Message, 0, queued+1)
+	batch = append(batch, first)
+	for i := 0; i < queued; i++ {
+		message, ok := <-c.Send
+		if !ok {
+			// Channel closed mid-drain; the next read in writePump sends the close frame
+			break
+		}
+		batch = append(batch, message)
+	}
+
+	if len(batch) == 1 {
+		return first
+	}
+
+	return Message{
+		Type:     MsgBatch,
+		Messages: batch,
+	}
+}
+
+// BroadcastFloorUpdate sends every client on the specified floor the changes
+// since the floor version it last acknowledged. The caller must hold the world lock.
 func (gm *GameManager) BroadcastFloorUpdate(dungeonID string, floorLevel int) {
 	// Get the floor using the repository
 	floor, err := gm.DungeonRepo.GetFloor(dungeonID, floorLevel)
@@ -996,16 +2027,28 @@ func (gm *GameManager) BroadcastFloorUpdate(dungeonID string, floorLevel int) {
 	gm.mutex.RLock()
 	defer gm.mutex.RUnlock()
 
+	gm.syncFloorClients(gm.floorClients(dungeonID, floorLevel), dungeonID, floor)
+}
+
+// floorClients returns the clients whose character is on a floor. The caller must hold the manager's lock.
+func (gm *GameManager) floorClients(dungeonID string, floorLevel int) []*Client {
+	clients := make([]*Client, 0)
 	for _, client := range gm.Clients {
 		if client.Character != nil &&
 			client.Character.CurrentDungeon == dungeonID &&
 			client.Character.CurrentFloor == floorLevel {
+			clients = append(clients, client)
+		}
+	}
+	return clients
+}
 
-			// Send floor update to this client
-			client.Send <- Message{
-				Type:  MsgFloorChange,
-				Floor: floor,
-			}
+// syncFloorClients queues floor updates for clients on a floor
+func (gm *GameManager) syncFloorClients(clients []*Client, dungeonID string, floor *models.Floor) {
+	for _, client := range clients {
+		// Dropped updates are safe; the next one is built from the last acknowledged version
+		if message, ok := gm.syncFloor(client, dungeonID, floor); ok {
+			queueMessage(client, message)
 		}
 	}
 }
@@ -1043,6 +2086,16 @@ func (gm *GameManager) HandleConnection(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
+	// Only the owner may play a character
+	if err := auth.CheckOwner(r.Context(), character); err != nil {
+		log.Warn("Rejected connection for character %s: %v", characterID, err)
+		conn.WriteControl(websocket.CloseMessage,
+			websocket.FormatCloseMessage(websocket.ClosePolicyViolation, err.Error()),
+			time.Now().Add(writeWait))
+		conn.Close()
+		return
+	}
+
 	// Create a new client
 	client := &Client{
 		ID:         characterID,
@@ -1064,4 +2117,12 @@ func (gm *GameManager) HandleConnection(w http.ResponseWriter, r *http.Request)
 		Type:      MsgInitialState,
 		Character: character,
 	}
+
+	// Along with the character's party, if they are in one
+	if party, ok := gm.Parties.View(characterID); ok {
+		client.Send <- Message{
+			Type:  MsgPartyUpdate,
+			Party: &party,
+		}
+	}
 }
@@ -31,9 +31,9 @@ func TestNewGameManager(t *testing.T) {
 	assert.NotNil(t, manager.Register, "Register channel should not be nil")
 	assert.NotNil(t, manager.Unregister, "Unregister channel should not be nil")
 	assert.NotNil(t, manager.Broadcast, "Broadcast channel should not be nil")
+	assert.NotNil(t, manager.rng, "Random number generator should not be nil")
 	assert.Equal(t, characterRepo, manager.CharacterRepo, "Character repository should match")
 	assert.Equal(t, dungeonRepo, manager.DungeonRepo, "Dungeon repository should match")
-	assert.NotNil(t, manager.MapGenerator, "Map generator should not be nil")
 }
 
 // TestRegisterAndUnregisterClient tests the registration and unregistration of clients
@@ -1181,3 +1181,141 @@ func TestHandleDescendWithObstaclesInSafeRoom(t *testing.T) {
 	// Verify the old tile no longer has the character
 	assert.Equal(t, "", floor1.Tiles[downStairsY][downStairsX].Character)
 }
+
+func TestHandleCast(t *testing.T) {
+	manager, client, floor, _ := newTestManager(t)
+	client.Send = make(chan Message, 32)
+
+	mob := models.NewMob(models.MobSkeleton, models.VariantNormal, 1)
+	mob.HP, mob.MaxHP = 100, 100
+	addMob(floor, mob, 6, 10)
+
+	manager.HandleMessage(client, Message{Type: MsgCast, AbilityID: models.AbilityCleave, TargetID: mob.ID})
+	msg := <-client.Send
+	assert.Equal(t, MsgNotification, msg.Type)
+	require.NotNil(t, msg.Combat)
+	assert.True(t, msg.Combat.Success, msg.Text)
+	require.Len(t, msg.Combat.Hits, 1)
+	assert.Equal(t, mob.ID, msg.Combat.Hits[0].MobID)
+	assert.Less(t, mob.HP, 100)
+
+	// Unknown abilities are refused
+	drainMessages(client)
+	manager.HandleMessage(client, Message{Type: MsgCast, AbilityID: models.AbilityFireball, TargetID: mob.ID})
+	msg = <-client.Send
+	require.NotNil(t, msg.Combat)
+	assert.False(t, msg.Combat.Success)
+	assert.Equal(t, "You don't know that ability!", msg.Text)
+}
+
+// TestHandleMoveDuringMobTick moves a character while the mobs on their floor act.
+// Run with -race to check the game socket and the mob tick take turns with the floor.
+func TestHandleMoveDuringMobTick(t *testing.T) {
+	manager, client, floor, _ := newTestManager(t)
+	manager.MobAI = NewMobAI(1)
+	manager.Clients[client.ID] = client
+	manager.CharacterToClient[client.Character.ID] = client.ID
+	client.Character.MaxHP, client.Character.CurrentHP = 10000, 10000
+
+	for i := 0; i < 4; i++ {
+		addMob(floor, models.NewMob(models.MobGoblin, models.VariantNormal, 1), 10+i*3, 5)
+	}
+
+	// Keep the client's queue from filling up
+	done := make(chan struct{})
+	drained := make(chan struct{})
+	go func() {
+		defer close(drained)
+		for {
+			select {
+			case <-client.Send:
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	ticked := make(chan struct{})
+	go func() {
+		defer close(ticked)
+		for i := 0; i < 50; i++ {
+			manager.tickMobs()
+		}
+	}()
+
+	for i := 0; i < 50; i++ {
+		direction := DirRight
+		if i%2 == 1 {
+			direction = DirLeft
+		}
+		manager.HandleMessage(client, Message{Type: MsgMove, Direction: direction})
+	}
+
+	<-ticked
+	close(done)
+	<-drained
+
+	pos := client.Character.Position
+	assert.Equal(t, client.Character.ID, floor.Tiles[pos.Y][pos.X].Character, "The character's tile should know they are there")
+}
+
+func TestHandleCastTakesTurns(t *testing.T) {
+	manager, client, floor, dungeonID := newTestManager(t)
+	client.Send = make(chan Message, 32)
+
+	mob := models.NewMob(models.MobSkeleton, models.VariantNormal, 1)
+	mob.HP, mob.MaxHP, mob.Damage = 1000, 1000, 1
+	addMob(floor, mob, 6, 10)
+
+	// A second character joins the fight while it's the first one's turn
+	second := models.NewCharacter("Second", models.Warrior)
+	second.CurrentDungeon = dungeonID
+	second.CurrentFloor = 1
+	second.Position = models.Position{X: 7, Y: 10}
+	require.NoError(t, manager.CharacterRepo.Save(second))
+	other := &Client{ID: "other-client", Character: second, Manager: manager, Send: make(chan Message, 32)}
+
+	manager.Encounters.Engage(dungeonID, floor, client.Character, mob)
+	manager.Encounters.Engage(dungeonID, floor, second, mob)
+	encounter, _ := manager.Encounters.Get(second.ID)
+	require.Equal(t, client.Character.ID, encounter.Current().ID)
+
+	// Casting out of turn is refused
+	hp := mob.HP
+	drainMessages(other)
+	manager.HandleMessage(other, Message{Type: MsgCast, AbilityID: models.AbilityCleave, TargetID: mob.ID})
+	msg := <-other.Send
+	assert.Equal(t, MsgError, msg.Type)
+	assert.Equal(t, "It's not your turn", msg.Error)
+	assert.Equal(t, hp, mob.HP)
+
+	// Casting in turn ends the turn, and the encounter moves on to the other character
+	drainMessages(client)
+	manager.HandleMessage(client, Message{Type: MsgCast, AbilityID: models.AbilityCleave, TargetID: mob.ID})
+	msg = <-client.Send
+	require.NotNil(t, msg.Combat)
+	assert.True(t, msg.Combat.TurnTaken)
+	assert.NoError(t, manager.Encounters.CheckTurn(second.ID))
+	assert.ErrorIs(t, manager.Encounters.CheckTurn(client.Character.ID), ErrNotYourTurn)
+}
+
+func TestHandleMoveLeavesEncounter(t *testing.T) {
+	manager, client, floor, dungeonID := newTestManager(t)
+	client.Send = make(chan Message, 32)
+
+	mob := models.NewMob(models.MobSkeleton, models.VariantNormal, 1)
+	mob.HP, mob.MaxHP, mob.Damage = 1000, 1000, 1
+	addMob(floor, mob, 6, 10)
+	manager.Encounters.Engage(dungeonID, floor, client.Character, mob)
+	require.True(t, manager.Encounters.InEncounter(client.Character.ID))
+
+	// Stepping around the mob stays in the fight
+	manager.HandleMessage(client, Message{Type: MsgMove, Direction: DirDown})
+	assert.True(t, manager.Encounters.InEncounter(client.Character.ID))
+
+	// Walking away leaves it, and the mob goes back to acting in real time
+	manager.HandleMessage(client, Message{Type: MsgMove, Direction: DirLeft})
+	manager.HandleMessage(client, Message{Type: MsgMove, Direction: DirLeft})
+	assert.False(t, manager.Encounters.InEncounter(client.Character.ID))
+	assert.False(t, manager.Encounters.InEncounter(mob.ID))
+}
@@ -0,0 +1,372 @@
+package game
+
+import (
+	"github.com/jchauncey/TheDeeps/server/models"
+)
+
+const (
+	layoutMinRoomSize = 5 // Smallest width and height of a room
+	layoutMaxRoomSize = 10
+	arrivalRoomSize   = 8 // Width and height of the room characters arrive in
+
+	bspMinLeaf     = 12 // Partitions narrower or shorter than twice this aren't split
+	bspMaxDepth    = 4  // Times the floor is split, making at most 16 rooms
+	bspMaxRoomSize = 12
+
+	caveFillChance  = 45 // Percent of a cave that starts out as wall
+	caveSmoothSteps = 5  // Passes of the cellular automaton over the cave
+	caveMinRegion   = 12 // Pockets of open floor smaller than this are filled in rather than joined up
+
+	tunnelBias     = 60   // Percent of a tunnel's steps taken toward the room it is heading for
+	maxTunnelSteps = 2000 // Steps a tunnel wanders before being dug straight to its room
+)
+
+// Layout carves a floor's rooms and the passages joining them. The first room
+// returned is where characters arrive; the second is the shop on the first floor
+// and the boss room on the final floor. Every walkable tile a layout leaves must
+// be reachable from the first room.
+type Layout interface {
+	Carve(g *MapGenerator, floor *models.Floor, level int, isFinalFloor bool) []models.Room
+}
+
+// layouts holds the layout for each layout type
+var layouts = map[models.Layout]Layout{
+	models.LayoutRooms:   roomsLayout{},
+	models.LayoutBSP:     bspLayout{},
+	models.LayoutCaves:   caveLayout{},
+	models.LayoutTunnels: tunnelLayout{},
+}
+
+// floorLayout returns the generator's layout, or its theme's when it has none
+func (g *MapGenerator) floorLayout() Layout {
+	if layout, exists := layouts[g.Layout]; exists {
+		return layout
+	}
+	if layout, exists := layouts[g.Theme.Definition().Layout]; exists {
+		return layout
+	}
+	return roomsLayout{}
+}
+
+// roomsLayout scatters rectangular rooms at random and joins them in order with
+// L-shaped corridors
+type roomsLayout struct{}
+
+// Carve lays out the floor's rooms
+func (roomsLayout) Carve(g *MapGenerator, floor *models.Floor, level int, isFinalFloor bool) []models.Room {
+	rooms := g.generateRooms(floor, g.roomCount(level), level, isFinalFloor)
+	g.connectRooms(floor, rooms)
+	return rooms
+}
+
+// bspLayout splits the floor into a tree of partitions, places a room in each
+// leaf, and joins sibling partitions with corridors
+type bspLayout struct{}
+
+// partition is an area of the floor a BSP layout splits up
+type partition struct {
+	x, y, width, height int
+}
+
+// Carve lays out the floor's rooms
+func (l bspLayout) Carve(g *MapGenerator, floor *models.Floor, level int, isFinalFloor bool) []models.Room {
+	rooms := make([]models.Room, 0)
+	l.split(g, floor, partition{x: 1, y: 1, width: floor.Width - 2, height: floor.Height - 2}, 0, level, isFinalFloor, &rooms)
+	return rooms
+}
+
+// split places a room in a partition too small to split, or splits it in two and
+// joins the halves. It returns the center of a room in the partition for the
+// partition's sibling to join up with.
+func (l bspLayout) split(g *MapGenerator, floor *models.Floor, area partition, depth int, level int, isFinalFloor bool, rooms *[]models.Room) models.Position {
+	canSplitX := area.width >= 2*bspMinLeaf
+	canSplitY := area.height >= 2*bspMinLeaf
+	if depth >= bspMaxDepth || (!canSplitX && !canSplitY) {
+		width := layoutMinRoomSize + g.rng.Intn(min(area.width-2, bspMaxRoomSize)-layoutMinRoomSize+1)
+		height := layoutMinRoomSize + g.rng.Intn(min(area.height-2, bspMaxRoomSize)-layoutMinRoomSize+1)
+		x := area.x + 1 + g.rng.Intn(area.width-width-1)
+		y := area.y + 1 + g.rng.Intn(area.height-height-1)
+
+		room := g.newRoom(len(*rooms), x, y, width, height, level, isFinalFloor)
+		g.carveRoom(floor, room)
+		*rooms = append(*rooms, room)
+		return roomCenter(room)
+	}
+
+	// Cut across the longer side, or either way when they are close
+	splitX := canSplitX && (!canSplitY || area.width*4 > area.height*5 || (area.height*4 <= area.width*5 && g.rng.Intn(2) == 0))
+	first, second := area, area
+	if splitX {
+		cut := bspMinLeaf + g.rng.Intn(area.width-2*bspMinLeaf+1)
+		first.width = cut
+		second.x += cut
+		second.width -= cut
+	} else {
+		cut := bspMinLeaf + g.rng.Intn(area.height-2*bspMinLeaf+1)
+		first.height = cut
+		second.y += cut
+		second.height -= cut
+	}
+
+	a := l.split(g, floor, first, depth+1, level, isFinalFloor, rooms)
+	b := l.split(g, floor, second, depth+1, level, isFinalFloor, rooms)
+	g.digCorridor(floor, a, b)
+	if g.rng.Intn(2) == 0 {
+		return a
+	}
+	return b
+}
+
+// caveLayout grows caverns with a cellular automaton, clears rooms in them and
+// joins every pocket of cave big enough to explore
+type caveLayout struct{}
+
+// Carve lays out the floor's rooms
+func (caveLayout) Carve(g *MapGenerator, floor *models.Floor, level int, isFinalFloor bool) []models.Room {
+	// Start from noise, keeping the floor's edge solid
+	wall := make([][]bool, floor.Height)
+	for y := range wall {
+		wall[y] = make([]bool, floor.Width)
+		for x := range wall[y] {
+			wall[y][x] = x == 0 || y == 0 || x == floor.Width-1 || y == floor.Height-1 || g.rng.Intn(100) < caveFillChance
+		}
+	}
+
+	// Smooth it out: tiles mostly surrounded by wall fill in, and the rest open up
+	for step := 0; step < caveSmoothSteps; step++ {
+		next := make([][]bool, floor.Height)
+		for y := range next {
+			next[y] = make([]bool, floor.Width)
+			for x := range next[y] {
+				if x == 0 || y == 0 || x == floor.Width-1 || y == floor.Height-1 {
+					next[y][x] = true
+					continue
+				}
+				walls := 0
+				for dy := -1; dy <= 1; dy++ {
+					for dx := -1; dx <= 1; dx++ {
+						if (dx != 0 || dy != 0) && wall[y+dy][x+dx] {
+							walls++
+						}
+					}
+				}
+				next[y][x] = walls >= 5 || (wall[y][x] && walls >= 4)
+			}
+		}
+		wall = next
+	}
+
+	for y := range wall {
+		for x := range wall[y] {
+			if !wall[y][x] {
+				floor.Tiles[y][x] = models.Tile{Type: models.TileFloor, Walkable: true}
+			}
+		}
+	}
+
+	rooms := g.scatterRooms(floor, level, isFinalFloor)
+	for _, room := range rooms {
+		g.carveRoom(floor, room)
+	}
+	g.connectRooms(floor, rooms)
+	g.joinRegions(floor, rooms)
+	return rooms
+}
+
+// tunnelLayout scatters rooms and joins them in order with tunnels dug by a
+// drunkard's walk that staggers toward the next room
+type tunnelLayout struct{}
+
+// Carve lays out the floor's rooms
+func (tunnelLayout) Carve(g *MapGenerator, floor *models.Floor, level int, isFinalFloor bool) []models.Room {
+	rooms := g.scatterRooms(floor, level, isFinalFloor)
+	for i := 0; i < len(rooms)-1; i++ {
+		g.digTunnel(floor, roomCenter(rooms[i]), roomCenter(rooms[i+1]))
+	}
+	for _, room := range rooms {
+		g.carveRoom(floor, room)
+	}
+	g.joinRegions(floor, rooms)
+	return rooms
+}
+
+// digTunnel wanders from one position to another, digging out every tile it
+// steps on. It usually steps toward where it is heading and otherwise staggers
+// in any direction, and is dug straight the rest of the way if it wanders too long.
+func (g *MapGenerator) digTunnel(floor *models.Floor, from, to models.Position) {
+	pos := from
+	directions := []models.Position{{X: 0, Y: -1}, {X: 1, Y: 0}, {X: 0, Y: 1}, {X: -1, Y: 0}}
+	for step := 0; pos != to; step++ {
+		if step == maxTunnelSteps {
+			g.digCorridor(floor, pos, to)
+			return
+		}
+		floor.Tiles[pos.Y][pos.X] = models.Tile{Type: models.TileFloor, Walkable: true}
+
+		var dir models.Position
+		switch {
+		case g.rng.Intn(100) >= tunnelBias:
+			dir = directions[g.rng.Intn(len(directions))]
+		case pos.X != to.X && (pos.Y == to.Y || g.rng.Intn(2) == 0):
+			dir.X = sign(to.X - pos.X)
+		default:
+			dir.Y = sign(to.Y - pos.Y)
+		}
+
+		next := models.Position{X: pos.X + dir.X, Y: pos.Y + dir.Y}
+		if next.X >= 1 && next.Y >= 1 && next.X < floor.Width-1 && next.Y < floor.Height-1 {
+			pos = next
+		}
+	}
+	floor.Tiles[to.Y][to.X] = models.Tile{Type: models.TileFloor, Walkable: true}
+}
+
+// roomCount picks how many rooms a floor has, more on deeper floors
+func (g *MapGenerator) roomCount(level int) int {
+	minRooms := 5
+	maxRooms := min(10+level, 20)
+	return minRooms + g.rng.Intn(maxRooms-minRooms+1)
+}
+
+// roomTypeAt picks the type of the room a layout places at an index: the first
+// is where characters arrive, the second is the shop on the first floor and the
+// boss room on the final floor, and the rest are picked at random
+func (g *MapGenerator) roomTypeAt(index int, level int, isFinalFloor bool) models.RoomType {
+	switch {
+	case index == 0 && level == 1:
+		return models.RoomEntrance
+	case index == 0:
+		return models.RoomSafe
+	case index == 1 && level == 1:
+		return models.RoomShop
+	case index == 1 && isFinalFloor:
+		return models.RoomBoss
+	}
+	return g.randomRoomType(level)
+}
+
+// newRoom creates the room a layout places at an index. The room characters
+// arrive in starts explored.
+func (g *MapGenerator) newRoom(index int, x, y, width, height int, level int, isFinalFloor bool) models.Room {
+	return models.Room{
+		ID:       g.newID(),
+		Type:     g.roomTypeAt(index, level, isFinalFloor),
+		X:        x,
+		Y:        y,
+		Width:    width,
+		Height:   height,
+		Explored: index == 0,
+	}
+}
+
+// scatterRooms picks spots for a floor's rooms at random without carving them,
+// the first the size of the room characters arrive in
+func (g *MapGenerator) scatterRooms(floor *models.Floor, level int, isFinalFloor bool) []models.Room {
+	numRooms := g.roomCount(level)
+	rooms := make([]models.Room, 0, numRooms)
+
+	for i := 0; i < numRooms*3 && len(rooms) < numRooms; i++ {
+		width, height := arrivalRoomSize, arrivalRoomSize
+		if len(rooms) > 0 {
+			width = layoutMinRoomSize + g.rng.Intn(layoutMaxRoomSize-layoutMinRoomSize+1)
+			height = layoutMinRoomSize + g.rng.Intn(layoutMaxRoomSize-layoutMinRoomSize+1)
+		}
+		x := 1 + g.rng.Intn(floor.Width-width-2)
+		y := 1 + g.rng.Intn(floor.Height-height-2)
+
+		overlaps := false
+		for _, room := range rooms {
+			if x+width > room.X-2 && x < room.X+room.Width+2 &&
+				y+height > room.Y-2 && y < room.Y+room.Height+2 {
+				overlaps = true
+				break
+			}
+		}
+		if !overlaps {
+			rooms = append(rooms, g.newRoom(len(rooms), x, y, width, height, level, isFinalFloor))
+		}
+	}
+
+	return rooms
+}
+
+// carveRoom clears a room's tiles and reshapes it for the theme
+func (g *MapGenerator) carveRoom(floor *models.Floor, room models.Room) {
+	for y := room.Y; y < room.Y+room.Height; y++ {
+		for x := room.X; x < room.X+room.Width; x++ {
+			floor.Tiles[y][x] = models.Tile{
+				Type:     models.TileFloor,
+				Walkable: true,
+				Explored: room.Explored,
+				RoomID:   room.ID,
+			}
+		}
+	}
+	if room.Type == models.RoomStandard {
+		g.shapeRoom(floor, room)
+	}
+}
+
+// digCorridor digs an L-shaped corridor between two positions
+func (g *MapGenerator) digCorridor(floor *models.Floor, from, to models.Position) {
+	g.createHorizontalCorridor(floor, from.X, to.X, from.Y)
+	g.createVerticalCorridor(floor, from.Y, to.Y, to.X)
+}
+
+// joinRegions digs a corridor from every pocket of open floor that can't be
+// reached from the first room to the nearest tile that can, and fills in the
+// pockets too small to be worth it, so the whole floor can be walked
+func (g *MapGenerator) joinRegions(floor *models.Floor, rooms []models.Room) {
+	for {
+		reached := make(map[models.Position]bool)
+		for _, pos := range reachableTiles(floor, roomCenter(rooms[0])) {
+			reached[pos] = true
+		}
+
+		start, found := unreachedTile(floor, reached)
+		if !found {
+			return
+		}
+
+		region := reachableTiles(floor, start)
+		if len(region) < caveMinRegion {
+			for _, pos := range region {
+				floor.Tiles[pos.Y][pos.X] = models.Tile{Type: models.TileWall}
+			}
+			continue
+		}
+
+		nearest := roomCenter(rooms[0])
+		for pos := range reached {
+			if manhattanDistance(start, pos) < manhattanDistance(start, nearest) ||
+				(manhattanDistance(start, pos) == manhattanDistance(start, nearest) && (pos.Y < nearest.Y || (pos.Y == nearest.Y && pos.X < nearest.X))) {
+				nearest = pos
+			}
+		}
+		g.digCorridor(floor, start, nearest)
+	}
+}
+
+// unreachedTile finds the first walkable tile, in reading order, that isn't in the reached set
+func unreachedTile(floor *models.Floor, reached map[models.Position]bool) (models.Position, bool) {
+	for y := 0; y < floor.Height; y++ {
+		for x := 0; x < floor.Width; x++ {
+			pos := models.Position{X: x, Y: y}
+			if floor.Tiles[y][x].Walkable && !reached[pos] {
+				return pos, true
+			}
+		}
+	}
+	return models.Position{}, false
+}
+
+// sign returns -1, 0 or 1 for the sign of n
+func sign(n int) int {
+	switch {
+	case n < 0:
+		return -1
+	case n > 0:
+		return 1
+	}
+	return 0
+}
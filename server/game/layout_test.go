@@ -0,0 +1,95 @@
+package game
+
+import (
+	"math/rand"
+	"testing"
+	"testing/quick"
+
+	"github.com/jchauncey/TheDeeps/server/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// layoutFloors is how many floors deep the dungeons in the layout tests go
+const layoutFloors = 10
+
+func TestLayoutsAreConnected(t *testing.T) {
+	for _, layout := range models.Layouts {
+		t.Run(string(layout), func(t *testing.T) {
+			config := &quick.Config{MaxCount: 30, Rand: rand.New(rand.NewSource(1))}
+			property := func(seed int64, depth uint8) bool {
+				level := int(depth)%layoutFloors + 1
+				dungeon := models.NewDungeon("Layout", layoutFloors, seed)
+				dungeon.Layouts = map[int]models.Layout{level: layout}
+				floor := dungeon.GenerateFloor(level)
+				GenerateDungeonFloor(dungeon, floor)
+
+				if err := CheckConnectivity(floor); err != nil {
+					t.Logf("Seed %d floor %d: %v", seed, level, err)
+					return false
+				}
+				if stats := ValidateFloor(floor, level == layoutFloors); !stats.Valid || stats.Retries > 0 {
+					t.Logf("Seed %d floor %d took %d retries: %v", seed, level, stats.Retries, stats.Err())
+					return false
+				}
+				return floorKeepsRoomOrder(t, floor, level)
+			}
+			assert.NoError(t, quick.Check(property, config))
+		})
+	}
+}
+
+// floorKeepsRoomOrder checks that a floor's rooms and stairs are where the rest
+// of the generator expects them
+func floorKeepsRoomOrder(t *testing.T, floor *models.Floor, level int) bool {
+	ok := len(floor.Rooms) >= 2
+	if level == 1 {
+		ok = ok && len(floor.UpStairs) == 0 && floor.Rooms[0].Type == models.RoomEntrance && floor.Rooms[1].Type == models.RoomShop
+	} else {
+		ok = ok && len(floor.UpStairs) == 1 && floor.Rooms[0].Type == models.RoomSafe && floor.UpStairs[0] == roomCenter(floor.Rooms[0])
+	}
+	if level == layoutFloors {
+		ok = ok && len(floor.DownStairs) == 0 && floor.Rooms[1].Type == models.RoomBoss
+	} else {
+		ok = ok && len(floor.DownStairs) == 1
+	}
+	if !ok {
+		t.Logf("Floor %d has %d rooms, up stairs %v and down stairs %v", level, len(floor.Rooms), floor.UpStairs, floor.DownStairs)
+	}
+	return ok
+}
+
+func TestLayoutSelection(t *testing.T) {
+	dungeon := models.NewDungeon("Layout", 3, 42)
+	dungeon.Theme = models.ThemeCaverns
+	dungeon.Layouts = map[int]models.Layout{2: models.LayoutBSP}
+
+	// Floors follow their theme unless the dungeon picks a layout for them
+	assert.Equal(t, caveLayout{}, NewFloorGenerator(dungeon, 1).floorLayout())
+	assert.Equal(t, bspLayout{}, NewFloorGenerator(dungeon, 2).floorLayout())
+
+	// Generators without a theme lay floors out as the classic dungeon does
+	assert.Equal(t, roomsLayout{}, NewMapGenerator(42).floorLayout())
+}
+
+func TestCheckConnectivity(t *testing.T) {
+	floor := newOpenFloor(10, 10)
+	floor.Rooms = []models.Room{{ID: "start", X: 1, Y: 1, Width: 3, Height: 3}}
+	floor.UpStairs = []models.Position{{X: 2, Y: 2}}
+	floor.DownStairs = []models.Position{{X: 7, Y: 7}}
+	require.NoError(t, CheckConnectivity(floor))
+
+	// A closed door doesn't cut anything off
+	for y := 0; y < floor.Height; y++ {
+		floor.Tiles[y][5] = models.Tile{Type: models.TileWall}
+	}
+	addDoor(floor, 5, 4, nil)
+	require.NoError(t, CheckConnectivity(floor))
+
+	// A wall does
+	floor.Tiles[4][5] = models.Tile{Type: models.TileWall}
+	err := CheckConnectivity(floor)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "stairs at (7, 7) can't be reached")
+	assert.Contains(t, err.Error(), "can't be reached, the first at (6, 1)")
+}
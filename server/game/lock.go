@@ -0,0 +1,214 @@
+package game
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"strings"
+
+	"github.com/jchauncey/TheDeeps/server/models"
+)
+
+const (
+	interactRange = 1  // How close a character must be to open a door or chest
+	lockJamChance = 25 // Percent chance a failed pick of an untrapped lock jams it
+)
+
+// Errors returned when interacting with doors and chests
+var (
+	ErrNothingToOpen = errors.New("there is nothing there to open")
+	ErrTooFarToReach = errors.New("you are too far away to reach that")
+	ErrDoorBlocked   = errors.New("something is in the way of the door")
+	ErrDoorSealed    = errors.New("the door is sealed by some mechanism")
+	ErrLockJammed    = errors.New("the lock is jammed; only its key will open it")
+)
+
+// Interaction describes what happened when a character opened, closed or
+// unlocked a door or chest
+type Interaction struct {
+	Door    *models.Door   `json:"door,omitempty"`
+	Chest   *models.Chest  `json:"chest,omitempty"`
+	Key     *models.Item   `json:"key,omitempty"`    // Key used up to open the lock
+	Picked  bool           `json:"picked,omitempty"` // The lock was picked
+	Jammed  bool           `json:"jammed,omitempty"` // A failed pick jammed the lock
+	Trap    *TrapResult    `json:"trap,omitempty"`   // A trap set off by a failed pick
+	Items   []*models.Item `json:"items,omitempty"`  // Items taken from a chest
+	Puzzle  *PuzzleResult  `json:"puzzle,omitempty"` // What pulling a lever did
+	Message string         `json:"message"`
+}
+
+// Interact has a character use the door, chest or lever with the given ID. Closed
+// doors open and open ones close; chests open and hand over whatever the character
+// can carry; levers are pulled. Locks are opened with their key if the character has it, otherwise with
+// a Lockpicking check. A failed pick sets off the lock's trap if it has one, or
+// may jam the lock.
+func Interact(floor *models.Floor, character *models.Character, targetID string, rng *rand.Rand) (Interaction, error) {
+	var pos models.Position
+	var lock *models.Lock
+	door, isDoor := floor.Doors[targetID]
+	chest, isChest := floor.Chests[targetID]
+	puzzle, lever, isLever := findLever(floor, targetID)
+	switch {
+	case isDoor:
+		pos, lock = door.Position, door.Lock
+	case isChest:
+		pos, lock = chest.Position, chest.Lock
+	case isLever:
+		pos = puzzle.Levers[lever].Position
+	default:
+		return Interaction{}, ErrNothingToOpen
+	}
+	if chebyshevDistance(character.Position, pos) > interactRange {
+		return Interaction{}, ErrTooFarToReach
+	}
+
+	if isLever {
+		pulled := PullLever(floor, puzzle, lever, character)
+		return Interaction{Puzzle: &pulled, Message: pulled.Message}, nil
+	}
+	if isDoor && door.Sealed {
+		return Interaction{Door: doorView(door)}, ErrDoorSealed
+	}
+
+	var result Interaction
+	var err error
+	opened := true
+	if lock.IsLocked() {
+		opened, err = unlock(floor, lock, targetID, character, rng, &result)
+	}
+	if opened && isDoor {
+		err = toggleDoor(floor, door, &result)
+	} else if opened {
+		openChest(floor, chest, character, &result)
+	}
+
+	// Players see the door or chest as it is now, without its lock's trap
+	if door != nil {
+		result.Door = doorView(door)
+	}
+	if chest != nil {
+		result.Chest = chestView(chest)
+	}
+	return result, err
+}
+
+// unlock opens a lock with its key or a Lockpicking check, describing the attempt in the result
+func unlock(floor *models.Floor, lock *models.Lock, lockID string, character *models.Character, rng *rand.Rand, result *Interaction) (bool, error) {
+	if key, exists := character.FindKey(lockID); exists {
+		character.RemoveFromInventory(key.ID)
+		lock.Locked = false
+		result.Key = key
+		result.Message = fmt.Sprintf("You unlock it with the %s.", key.Name)
+		return true, nil
+	}
+	if lock.Jammed {
+		return false, ErrLockJammed
+	}
+
+	if skillCheck(character, models.SkillLockpicking, lock.DC) {
+		lock.Locked = false
+		result.Picked = true
+		result.Message = "You pick the lock."
+		return true, nil
+	}
+
+	switch {
+	case lock.Trap != nil:
+		// The trap goes off once and is spent
+		trap := lock.Trap
+		lock.Trap = nil
+		trapResult := triggerTrap(floor, trap, character, rng, fmt.Sprintf("Your fumbling sets off a %s!", trap.Name()))
+		result.Trap = &trapResult
+		result.Message = trapResult.Message
+	case rng.Intn(100) < lockJamChance:
+		lock.Jammed = true
+		result.Jammed = true
+		result.Message = "Your pick snaps off in the lock, jamming it."
+	default:
+		result.Message = "You fail to pick the lock."
+	}
+	return false, nil
+}
+
+// toggleDoor opens a closed door or closes an open one
+func toggleDoor(floor *models.Floor, door *models.Door, result *Interaction) error {
+	tile := &floor.Tiles[door.Position.Y][door.Position.X]
+	if door.Open {
+		if tile.Character != "" || tile.MobID != "" || tile.ItemID != "" || tile.CorpseID != "" {
+			return ErrDoorBlocked
+		}
+		door.Open = false
+		tile.Walkable = false
+		result.Message = "You close the door."
+	} else {
+		door.Open = true
+		tile.Walkable = true
+		result.Message = joinSentences(result.Message, "The door swings open.")
+	}
+
+	floor.MarkTiles(door.Position)
+	return nil
+}
+
+// openChest opens a chest and moves as much of its loot as the character can carry into their inventory
+func openChest(floor *models.Floor, chest *models.Chest, character *models.Character, result *Interaction) {
+	chest.Open = true
+
+	names := make([]string, 0, len(chest.Items))
+	for _, item := range append([]*models.Item(nil), chest.Items...) {
+		if character.AddToInventory(item) {
+			chest.Take(item.ID)
+			result.Items = append(result.Items, item)
+			names = append(names, item.Name)
+		}
+	}
+
+	switch {
+	case len(names) > 0 && len(chest.Items) > 0:
+		result.Message = joinSentences(result.Message, fmt.Sprintf("You take %s from the chest but can't carry the rest.", strings.Join(names, ", ")))
+	case len(names) > 0:
+		result.Message = joinSentences(result.Message, fmt.Sprintf("You take %s from the chest.", strings.Join(names, ", ")))
+	case len(chest.Items) > 0:
+		result.Message = joinSentences(result.Message, "You can't carry anything in the chest.")
+	default:
+		result.Message = joinSentences(result.Message, "The chest is empty.")
+	}
+
+	floor.MarkTiles(chest.Position)
+}
+
+// joinSentences appends a sentence to a message
+func joinSentences(message, sentence string) string {
+	if message == "" {
+		return sentence
+	}
+	return message + " " + sentence
+}
+
+// doorView returns a door as players see it, without its lock's trap
+func doorView(door *models.Door) *models.Door {
+	view := *door
+	view.Lock = lockView(door.Lock)
+	return &view
+}
+
+// chestView returns a chest as players see it: without its lock's trap, and
+// without its contents until it is open
+func chestView(chest *models.Chest) *models.Chest {
+	view := *chest
+	view.Lock = lockView(chest.Lock)
+	if !chest.Open {
+		view.Items = nil
+	}
+	return &view
+}
+
+// lockView returns a copy of a lock without its trap
+func lockView(lock *models.Lock) *models.Lock {
+	if lock == nil {
+		return nil
+	}
+	view := *lock
+	view.Trap = nil
+	return &view
+}
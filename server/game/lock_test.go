@@ -0,0 +1,196 @@
+package game
+
+import (
+	"math/rand"
+	"testing"
+
+	"github.com/jchauncey/TheDeeps/server/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// addDoor hangs a closed door on the floor
+func addDoor(floor *models.Floor, x, y int, lock *models.Lock) *models.Door {
+	door := models.NewDoor(models.Position{X: x, Y: y})
+	door.Lock = lock
+	if floor.Doors == nil {
+		floor.Doors = make(map[string]*models.Door)
+	}
+	floor.Doors[door.ID] = door
+	floor.Tiles[y][x] = models.Tile{Type: models.TileDoor, DoorID: door.ID}
+	return door
+}
+
+// addChest places a closed chest on the floor
+func addChest(floor *models.Floor, x, y int, lock *models.Lock, items ...*models.Item) *models.Chest {
+	chest := models.NewChest(models.Position{X: x, Y: y}, items)
+	chest.Lock = lock
+	if floor.Chests == nil {
+		floor.Chests = make(map[string]*models.Chest)
+	}
+	floor.Chests[chest.ID] = chest
+	floor.Tiles[y][x] = models.Tile{Type: models.TileChest, ChestID: chest.ID}
+	return chest
+}
+
+func TestInteractDoor(t *testing.T) {
+	floor := newOpenFloor(10, 10)
+	door := addDoor(floor, 4, 4, nil)
+	character := models.NewCharacter("Opener", models.Warrior)
+	character.Position = models.Position{X: 8, Y: 8}
+	rng := rand.New(rand.NewSource(1))
+
+	_, err := Interact(floor, character, "missing", rng)
+	assert.ErrorIs(t, err, ErrNothingToOpen)
+	_, err = Interact(floor, character, door.ID, rng)
+	assert.ErrorIs(t, err, ErrTooFarToReach)
+
+	character.Position = models.Position{X: 3, Y: 4}
+	result, err := Interact(floor, character, door.ID, rng)
+	require.NoError(t, err)
+	assert.Equal(t, "The door swings open.", result.Message)
+	assert.True(t, door.Open)
+	assert.True(t, floor.Tiles[4][4].Walkable)
+	require.NotNil(t, result.Door)
+	assert.True(t, result.Door.Open)
+
+	// Doors can't be closed on whatever is standing in them
+	floor.Tiles[4][4].MobID = "mob"
+	_, err = Interact(floor, character, door.ID, rng)
+	assert.ErrorIs(t, err, ErrDoorBlocked)
+
+	floor.Tiles[4][4].MobID = ""
+	result, err = Interact(floor, character, door.ID, rng)
+	require.NoError(t, err)
+	assert.Equal(t, "You close the door.", result.Message)
+	assert.False(t, floor.Tiles[4][4].Walkable)
+	assert.True(t, blocksSight(floor, door.Position), "Closed doors block sight")
+}
+
+func TestInteractWithKey(t *testing.T) {
+	floor := newOpenFloor(10, 10)
+	door := addDoor(floor, 4, 4, models.NewLock(1))
+	character := models.NewCharacter("Opener", models.Warrior)
+	character.Position = models.Position{X: 3, Y: 4}
+	key := models.NewKey("Iron Key", door.ID)
+	require.True(t, character.AddToInventory(key))
+
+	// The key works even when a pick would fail
+	stubSkillCheck(t, false)
+	result, err := Interact(floor, character, door.ID, rand.New(rand.NewSource(1)))
+	require.NoError(t, err)
+	assert.Equal(t, "You unlock it with the Iron Key. The door swings open.", result.Message)
+	assert.Equal(t, key, result.Key)
+	assert.False(t, door.Lock.Locked)
+	assert.True(t, door.Open)
+	_, kept := character.GetInventoryItem(key.ID)
+	assert.False(t, kept, "Keys are used up")
+}
+
+func TestInteractPicksLock(t *testing.T) {
+	floor := newOpenFloor(10, 10)
+	potion := models.NewPotion("Health Potion", 10, 10)
+	chest := addChest(floor, 4, 4, models.NewLock(1), potion)
+	character := models.NewCharacter("Opener", models.Rogue)
+	character.Position = models.Position{X: 4, Y: 5}
+
+	stubSkillCheck(t, true)
+	result, err := Interact(floor, character, chest.ID, rand.New(rand.NewSource(1)))
+	require.NoError(t, err)
+	assert.True(t, result.Picked)
+	assert.Equal(t, "You pick the lock. You take Health Potion from the chest.", result.Message)
+	assert.Equal(t, []*models.Item{potion}, result.Items)
+	_, owned := character.GetInventoryItem(potion.ID)
+	assert.True(t, owned)
+	assert.True(t, chest.Open)
+	assert.Empty(t, chest.Items)
+
+	result, err = Interact(floor, character, chest.ID, rand.New(rand.NewSource(1)))
+	require.NoError(t, err)
+	assert.Equal(t, "The chest is empty.", result.Message)
+}
+
+func TestInteractFailedPick(t *testing.T) {
+	floor := newOpenFloor(10, 10)
+	character := models.NewCharacter("Opener", models.Rogue)
+	character.Position = models.Position{X: 4, Y: 5}
+	stubSkillCheck(t, false)
+
+	// A trapped lock goes off once
+	lock := models.NewLock(1)
+	lock.Trap = models.NewTrap(models.TrapSpike, 1)
+	chest := addChest(floor, 4, 4, lock, models.NewPotion("Health Potion", 10, 10))
+	hp := character.CurrentHP
+
+	result, err := Interact(floor, character, chest.ID, rand.New(rand.NewSource(1)))
+	require.NoError(t, err)
+	require.NotNil(t, result.Trap)
+	assert.Equal(t, "Your fumbling sets off a spike trap! Spikes deal 6 damage.", result.Message)
+	assert.Equal(t, hp-6, character.CurrentHP)
+	assert.Nil(t, lock.Trap)
+	assert.True(t, lock.Locked)
+	assert.False(t, chest.Open)
+	assert.Equal(t, models.TileChest, floor.Tiles[4][4].Type, "Lock traps don't take over the tile")
+	assert.Empty(t, result.Chest.Items, "Closed chests don't show what they hold")
+
+	// Untrapped locks may jam, after which only the key opens them
+	jammed := false
+	for i := 0; i < 50 && !jammed; i++ {
+		result, err = Interact(floor, character, chest.ID, rand.New(rand.NewSource(int64(i))))
+		require.NoError(t, err)
+		jammed = result.Jammed
+	}
+	require.True(t, jammed)
+	assert.True(t, lock.Jammed)
+
+	_, err = Interact(floor, character, chest.ID, rand.New(rand.NewSource(1)))
+	assert.ErrorIs(t, err, ErrLockJammed)
+
+	require.True(t, character.AddToInventory(models.NewKey("Brass Key", chest.ID)))
+	result, err = Interact(floor, character, chest.ID, rand.New(rand.NewSource(1)))
+	require.NoError(t, err)
+	assert.True(t, chest.Open)
+	assert.Len(t, result.Items, 1)
+}
+
+func TestFloorViewHidesLockTraps(t *testing.T) {
+	floor := newOpenFloor(10, 10)
+	lock := models.NewLock(1)
+	lock.Trap = models.NewTrap(models.TrapPoison, 1)
+	chest := addChest(floor, 4, 4, lock, models.NewPotion("Health Potion", 10, 10))
+	door := addDoor(floor, 6, 4, lock)
+
+	character := models.NewCharacter("Looker", models.Warrior)
+	character.Position = models.Position{X: 2, Y: 4}
+	view := CharacterFloorView(floor, "dungeon", character)
+
+	require.Contains(t, view.Chests, chest.ID, "Chests don't block sight")
+	assert.Nil(t, view.Chests[chest.ID].Lock.Trap)
+	assert.Empty(t, view.Chests[chest.ID].Items)
+	require.Contains(t, view.Doors, door.ID)
+	assert.Nil(t, view.Doors[door.ID].Lock.Trap)
+	assert.NotNil(t, lock.Trap, "The floor keeps the trap")
+}
+
+func TestHandleInteract(t *testing.T) {
+	manager, client, floor, _ := newTestManager(t)
+	door := addDoor(floor, 6, 10, nil)
+
+	manager.HandleMessage(client, Message{Type: MsgInteract, TargetID: "missing"})
+	msg := <-client.Send
+	require.Equal(t, MsgError, msg.Type)
+	assert.Equal(t, "There is nothing there to open", msg.Error)
+
+	manager.HandleMessage(client, Message{Type: MsgInteract, TargetID: door.ID})
+	msg = <-client.Send
+	require.Equal(t, MsgNotification, msg.Type, msg.Error)
+	assert.Equal(t, "The door swings open.", msg.Text)
+	require.NotNil(t, msg.Interaction)
+	assert.True(t, msg.Interaction.Door.Open)
+
+	// The character can walk through the open door
+	manager.HandleMessage(client, Message{Type: MsgMove, Direction: DirRight})
+	msg = <-client.Send
+	require.Equal(t, MsgUpdatePlayer, msg.Type, msg.Error)
+	assert.Equal(t, models.Position{X: 6, Y: 10}, client.Character.Position)
+}
@@ -0,0 +1,59 @@
+package game
+
+import (
+	"github.com/jchauncey/TheDeeps/server/models"
+)
+
+// maxDropDistance is how far from where they fell dropped items may land
+const maxDropDistance = 3
+
+// DropItems places items on the free tiles nearest to origin, one item per tile,
+// and returns the items as placed. Items that don't fit are not placed.
+func DropItems(floor *models.Floor, origin models.Position, items []models.Item) []models.Item {
+	placed := make([]models.Item, 0, len(items))
+	if floor.Items == nil {
+		floor.Items = make(map[string]models.Item)
+	}
+
+	for _, item := range items {
+		pos, ok := freeDropTile(floor, origin)
+		if !ok {
+			break
+		}
+
+		item.Position = pos
+		floor.Items[item.ID] = item
+		floor.Tiles[pos.Y][pos.X].ItemID = item.ID
+		floor.MarkItems(item.ID)
+		floor.MarkTiles(pos)
+		placed = append(placed, item)
+	}
+
+	return placed
+}
+
+// freeDropTile finds the closest walkable tile without an item or stairs
+func freeDropTile(floor *models.Floor, origin models.Position) (models.Position, bool) {
+	for distance := 0; distance <= maxDropDistance; distance++ {
+		for dy := -distance; dy <= distance; dy++ {
+			for dx := -distance; dx <= distance; dx++ {
+				if abs(dx)+abs(dy) != distance {
+					continue
+				}
+
+				pos := models.Position{X: origin.X + dx, Y: origin.Y + dy}
+				if !hasTile(floor, pos) {
+					continue
+				}
+
+				tile := floor.Tiles[pos.Y][pos.X]
+				if tile.Walkable && tile.ItemID == "" &&
+					tile.Type != models.TileUpStairs && tile.Type != models.TileDownStairs {
+					return pos, true
+				}
+			}
+		}
+	}
+
+	return models.Position{}, false
+}
@@ -0,0 +1,56 @@
+package game
+
+import (
+	"testing"
+
+	"github.com/jchauncey/TheDeeps/server/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDropItems(t *testing.T) {
+	floor := newOpenFloor(20, 20)
+	origin := models.Position{X: 10, Y: 10}
+
+	// Stairs and tiles that already hold an item are skipped
+	floor.Tiles[10][10].Type = models.TileDownStairs
+	existing := models.NewPotion("Health Potion", 10, 5)
+	existing.Position = models.Position{X: 11, Y: 10}
+	floor.Items[existing.ID] = *existing
+	floor.Tiles[10][11].ItemID = existing.ID
+
+	items := []models.Item{
+		*models.NewWeapon("Sword", 5, 10, 1, nil),
+		*models.NewArmor("Shield", 2, 10, 1, nil),
+	}
+	placed := DropItems(floor, origin, items)
+	require.Len(t, placed, 2)
+
+	for _, item := range placed {
+		assert.Equal(t, 1, manhattanDistance(origin, item.Position), "Items should land next to where the mob fell")
+		assert.NotEqual(t, existing.Position, item.Position)
+		assert.Equal(t, item.ID, floor.Tiles[item.Position.Y][item.Position.X].ItemID)
+		assert.Equal(t, item.Position, floor.Items[item.ID].Position)
+	}
+	assert.NotEqual(t, placed[0].Position, placed[1].Position, "Only one item fits on a tile")
+
+	// The drops are synced to clients
+	version := floor.Commit()
+	changes, ok := floor.ChangesSince(version - 1)
+	require.True(t, ok)
+	assert.ElementsMatch(t, []string{placed[0].ID, placed[1].ID}, changes.Items)
+}
+
+func TestDropItemsWithoutRoom(t *testing.T) {
+	floor := newOpenFloor(3, 3)
+	origin := models.Position{X: 1, Y: 1}
+
+	items := []models.Item{
+		*models.NewPotion("Health Potion", 10, 5),
+		*models.NewPotion("Mana Potion", 10, 5),
+	}
+	placed := DropItems(floor, origin, items)
+	require.Len(t, placed, 1, "Items that don't fit are not placed")
+	assert.Equal(t, origin, placed[0].Position)
+	assert.Len(t, floor.Items, 1)
+}
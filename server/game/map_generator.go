@@ -1,14 +1,29 @@
 package game
 
 import (
+	"maps"
 	"math/rand"
 
 	"github.com/google/uuid"
+	"github.com/jchauncey/TheDeeps/server/log"
 	"github.com/jchauncey/TheDeeps/server/models"
 )
 
+const (
+	maxTrapAttempts  = 20  // Random tiles of a room tried when hiding a trap
+	maxChestAttempts = 20  // Random tiles of a room tried when placing a chest
+	maxPlaceAttempts = 100 // Random tiles of a room tried when placing stairs, a mob or an item
+	minPuzzleParts   = 2   // Fewest levers or plates a puzzle is made of
+
+	caveErosionChance = 35 // Percent of a cave room's edge tiles worn away
+	minPillaredSize   = 7  // Smallest width and height of a room that gets pillars
+)
+
 // MapGenerator handles the procedural generation of dungeon maps
 type MapGenerator struct {
+	Theme  models.Theme  // Theme of the floors it generates; classic when unset
+	Layout models.Layout // Layout of the floors it generates in place of the theme's
+
 	rng *rand.Rand
 }
 
@@ -19,6 +34,47 @@ func NewMapGenerator(seed int64) *MapGenerator {
 	}
 }
 
+// NewFloorGenerator creates a map generator seeded, themed and laid out for one floor of a dungeon
+func NewFloorGenerator(dungeon *models.Dungeon, level int) *MapGenerator {
+	generator := NewMapGenerator(dungeon.FloorSeed(level))
+	generator.Theme = dungeon.Theme
+	generator.Layout = dungeon.Layouts[level]
+	return generator
+}
+
+// GenerateDungeonFloor generates a floor from the dungeon's seed, so the same
+// seed always produces the same floor. A floor that fails validation is thrown
+// away and generated again from a seed derived from its own.
+func GenerateDungeonFloor(dungeon *models.Dungeon, floor *models.Floor) {
+	isFinalFloor := floor.Level == dungeon.Floors
+	generator := NewFloorGenerator(dungeon, floor.Level)
+	for {
+		generator.GenerateFloorWithDifficulty(floor, floor.Level, isFinalFloor, dungeon.Difficulty)
+		stats := validateFloor(floor, isFinalFloor)
+		if stats.Valid || floor.Retries == maxFloorRetries {
+			if !stats.Valid {
+				log.Warn("Keeping floor %d of dungeon %s after %d retries: %v", floor.Level, dungeon.ID, floor.Retries, stats.Err())
+			}
+			return
+		}
+
+		retries := floor.Retries + 1
+		resetFloor(floor)
+		floor.Retries = retries
+		generator.rng = rand.New(rand.NewSource(models.DeriveSeed(dungeon.FloorSeed(floor.Level), retries)))
+	}
+}
+
+// newID returns a UUID drawn from the generator's random stream
+func (g *MapGenerator) newID() string {
+	id, err := uuid.NewRandomFromReader(g.rng)
+	if err != nil {
+		// Reading from a math/rand source never fails
+		panic(err)
+	}
+	return id.String()
+}
+
 // GenerateFloor generates a complete floor for a dungeon
 func (g *MapGenerator) GenerateFloor(floor *models.Floor, level int, isFinalFloor bool) {
 	// Initialize the floor with walls
@@ -31,23 +87,12 @@ func (g *MapGenerator) GenerateFloor(floor *models.Floor, level int, isFinalFloo
 			}
 		}
 	}
+	g.applyTheme(floor)
 
-	// Determine number of rooms based on floor level
-	minRooms := 5
-	maxRooms := 10 + level
-	if maxRooms > 20 {
-		maxRooms = 20
-	}
-
-	numRooms := minRooms + g.rng.Intn(maxRooms-minRooms+1)
-
-	// Generate rooms
-	rooms := g.generateRooms(floor, numRooms, level, isFinalFloor)
+	// Carve rooms and the passages joining them
+	rooms := g.floorLayout().Carve(g, floor, level, isFinalFloor)
 	floor.Rooms = rooms
 
-	// Connect rooms with corridors
-	g.connectRooms(floor, rooms)
-
 	// Place stairs
 	g.placeStairs(floor, rooms, level, isFinalFloor)
 
@@ -56,6 +101,16 @@ func (g *MapGenerator) GenerateFloor(floor *models.Floor, level int, isFinalFloo
 
 	// Place items
 	g.placeItems(floor, rooms, level)
+
+	// Hang doors and place chests, with keys for their locks
+	g.placeDoors(floor, rooms, level)
+	g.placeChests(floor, rooms, level)
+
+	// Set up puzzles guarding reward alcoves
+	g.placePuzzles(floor, rooms, level)
+
+	// Hide traps
+	g.placeTraps(floor, rooms, level)
 }
 
 // GenerateFloorWithDifficulty generates a complete floor for a dungeon with the specified difficulty
@@ -70,23 +125,12 @@ func (g *MapGenerator) GenerateFloorWithDifficulty(floor *models.Floor, level in
 			}
 		}
 	}
+	g.applyTheme(floor)
 
-	// Determine number of rooms based on floor level
-	minRooms := 5
-	maxRooms := 10 + level
-	if maxRooms > 20 {
-		maxRooms = 20
-	}
-
-	numRooms := minRooms + g.rng.Intn(maxRooms-minRooms+1)
-
-	// Generate rooms
-	rooms := g.generateRooms(floor, numRooms, level, isFinalFloor)
+	// Carve rooms and the passages joining them
+	rooms := g.floorLayout().Carve(g, floor, level, isFinalFloor)
 	floor.Rooms = rooms
 
-	// Connect rooms with corridors
-	g.connectRooms(floor, rooms)
-
 	// Place stairs
 	g.placeStairs(floor, rooms, level, isFinalFloor)
 
@@ -95,6 +139,23 @@ func (g *MapGenerator) GenerateFloorWithDifficulty(floor *models.Floor, level in
 
 	// Place items
 	g.placeItems(floor, rooms, level)
+
+	// Hang doors and place chests, with keys for their locks
+	g.placeDoors(floor, rooms, level)
+	g.placeChests(floor, rooms, level)
+
+	// Set up puzzles guarding reward alcoves
+	g.placePuzzles(floor, rooms, level)
+
+	// Hide traps
+	g.placeTraps(floor, rooms, level)
+}
+
+// applyTheme records the floor's theme and the palette clients draw it with
+func (g *MapGenerator) applyTheme(floor *models.Floor) {
+	theme := g.Theme.Definition()
+	floor.Theme = theme.Theme
+	floor.Palette = maps.Clone(theme.Palette)
 }
 
 // generateRooms creates a set of rooms for the floor
@@ -139,7 +200,7 @@ func (g *MapGenerator) generateRooms(floor *models.Floor, numRooms int, level in
 
 		// Create the entrance room
 		entranceRoom := models.Room{
-			ID:       uuid.New().String(),
+			ID:       g.newID(),
 			Type:     models.RoomEntrance,
 			X:        entranceX,
 			Y:        entranceY,
@@ -186,7 +247,7 @@ func (g *MapGenerator) generateRooms(floor *models.Floor, numRooms int, level in
 			if !overlaps {
 				// Create the shop room
 				shopRoom := models.Room{
-					ID:       uuid.New().String(),
+					ID:       g.newID(),
 					Type:     models.RoomShop,
 					X:        x,
 					Y:        y,
@@ -223,7 +284,7 @@ func (g *MapGenerator) generateRooms(floor *models.Floor, numRooms int, level in
 
 		// Create the safe room
 		safeRoom := models.Room{
-			ID:       uuid.New().String(),
+			ID:       g.newID(),
 			Type:     models.RoomSafe,
 			X:        safeX,
 			Y:        safeY,
@@ -278,20 +339,13 @@ func (g *MapGenerator) generateRooms(floor *models.Floor, numRooms int, level in
 			} else if isFinalFloor && len(rooms) == 1 {
 				// First room on final floor is the boss room (after the safe room with up stairs)
 				roomType = models.RoomBoss
-			} else if g.rng.Float64() < 0.1 {
-				// 10% chance for treasure room
-				roomType = models.RoomTreasure
-			} else if g.rng.Float64() < 0.05 {
-				// 5% chance for safe room
-				roomType = models.RoomSafe
-			} else if level > 1 && g.rng.Float64() < 0.05 && level > 2 {
-				// 5% chance for additional shop room on deeper floors
-				roomType = models.RoomShop
+			} else {
+				roomType = g.randomRoomType(level)
 			}
 
 			// Create the room
 			room := models.Room{
-				ID:       uuid.New().String(),
+				ID:       g.newID(),
 				Type:     roomType,
 				X:        x,
 				Y:        y,
@@ -311,6 +365,9 @@ func (g *MapGenerator) generateRooms(floor *models.Floor, numRooms int, level in
 					}
 				}
 			}
+			if roomType == models.RoomStandard {
+				g.shapeRoom(floor, room)
+			}
 
 			rooms = append(rooms, room)
 		}
@@ -319,6 +376,51 @@ func (g *MapGenerator) generateRooms(floor *models.Floor, numRooms int, level in
 	return rooms
 }
 
+// randomRoomType picks the type of a room that isn't required on the floor
+func (g *MapGenerator) randomRoomType(level int) models.RoomType {
+	if g.rng.Float64() < 0.1 {
+		// 10% chance for treasure room
+		return models.RoomTreasure
+	} else if level > 1 && g.rng.Float64() < 0.08 {
+		// 8% chance for puzzle room below the first floor
+		return models.RoomPuzzle
+	} else if g.rng.Float64() < 0.05 {
+		// 5% chance for safe room
+		return models.RoomSafe
+	} else if level > 1 && g.rng.Float64() < 0.05 && level > 2 {
+		// 5% chance for additional shop room on deeper floors
+		return models.RoomShop
+	}
+	return models.RoomStandard
+}
+
+// shapeRoom reshapes a freshly carved room for the theme. Only the room's edge is
+// eroded and pillars stand apart, so every floor tile left stays connected.
+func (g *MapGenerator) shapeRoom(floor *models.Floor, room models.Room) {
+	switch g.Theme.Definition().Shape {
+	case models.ShapeCave:
+		for y := room.Y; y < room.Y+room.Height; y++ {
+			for x := room.X; x < room.X+room.Width; x++ {
+				edgeX := x == room.X || x == room.X+room.Width-1
+				edgeY := y == room.Y || y == room.Y+room.Height-1
+				// Corners always go, since they only touch the edge
+				if (edgeX && edgeY) || ((edgeX || edgeY) && g.rng.Intn(100) < caveErosionChance) {
+					floor.Tiles[y][x] = models.Tile{Type: models.TileWall}
+				}
+			}
+		}
+	case models.ShapePillared:
+		if room.Width < minPillaredSize || room.Height < minPillaredSize {
+			return
+		}
+		for y := room.Y + 2; y < room.Y+room.Height-2; y += 3 {
+			for x := room.X + 2; x < room.X+room.Width-2; x += 3 {
+				floor.Tiles[y][x] = models.Tile{Type: models.TileWall, RoomID: room.ID}
+			}
+		}
+	}
+}
+
 // connectRooms connects rooms with corridors
 func (g *MapGenerator) connectRooms(floor *models.Floor, rooms []models.Room) {
 	// Connect each room to the next one
@@ -416,9 +518,17 @@ func (g *MapGenerator) placeStairs(floor *models.Floor, rooms []models.Room, lev
 		} else {
 			// For all other floors, place stairs in the last room
 			room = rooms[len(rooms)-1]
-			// Random position for other rooms
-			x = room.X + g.rng.Intn(room.Width)
-			y = room.Y + g.rng.Intn(room.Height)
+			// Random position for other rooms, off any walls the theme put in it.
+			// Without one the floor fails validation and is generated again.
+			found := false
+			for i := 0; i < maxPlaceAttempts && !found; i++ {
+				x = room.X + g.rng.Intn(room.Width)
+				y = room.Y + g.rng.Intn(room.Height)
+				found = floor.Tiles[y][x].Walkable
+			}
+			if !found {
+				return
+			}
 		}
 
 		floor.Tiles[y][x] = models.Tile{
@@ -442,24 +552,9 @@ func (g *MapGenerator) placeMobs(floor *models.Floor, rooms []models.Room, level
 func (g *MapGenerator) placeMobsWithDifficulty(floor *models.Floor, rooms []models.Room, level int, isFinalFloor bool, difficulty string) {
 	floor.Mobs = make(map[string]*models.Mob)
 
-	// Determine mob types based on floor level
-	mobTypes := []models.MobType{models.MobSkeleton, models.MobGoblin, models.MobRatman}
-
-	if level >= 3 {
-		mobTypes = append(mobTypes, models.MobOrc, models.MobOoze)
-	}
-
-	if level >= 5 {
-		mobTypes = append(mobTypes, models.MobTroll, models.MobWraith)
-	}
-
-	if level >= 8 {
-		mobTypes = append(mobTypes, models.MobOgre, models.MobDrake)
-	}
-
-	if level >= 10 {
-		mobTypes = append(mobTypes, models.MobLich, models.MobElemental)
-	}
+	// Determine mob types based on floor level and theme
+	theme := g.Theme.Definition()
+	mobTypes := theme.MobsAt(models.Monsters(), level)
 
 	// Place mobs in each room
 	for i, room := range rooms {
@@ -472,12 +567,8 @@ func (g *MapGenerator) placeMobsWithDifficulty(floor *models.Floor, rooms []mode
 		// Boss room gets a boss
 		if room.Type == models.RoomBoss {
 			// Create a boss mob
-			mobType := models.MobDragon
-			if level < 10 {
-				mobType = models.MobOgre
-			}
-
-			mob := models.NewMob(mobType, models.VariantBoss, level)
+			mob := models.NewMob(theme.BossAt(level), models.VariantBoss, level)
+			mob.ID = g.newID()
 
 			// Place in center of room
 			x := room.X + room.Width/2
@@ -495,6 +586,7 @@ func (g *MapGenerator) placeMobsWithDifficulty(floor *models.Floor, rooms []mode
 		if room.Type == models.RoomShop {
 			// Create a shopkeeper
 			mob := models.NewMob(models.MobShopkeeper, models.VariantNormal, level)
+			mob.ID = g.newID()
 
 			// Place in center of room
 			x := room.X + room.Width/2
@@ -509,6 +601,9 @@ func (g *MapGenerator) placeMobsWithDifficulty(floor *models.Floor, rooms []mode
 		}
 
 		// Regular rooms get random mobs
+		if len(mobTypes) == 0 {
+			continue
+		}
 		numMobs := 1 + g.rng.Intn(3) // 1-3 mobs per room
 
 		// Adjust based on room size
@@ -578,19 +673,22 @@ func (g *MapGenerator) placeMobsWithDifficulty(floor *models.Floor, rooms []mode
 
 			// Create the mob
 			mob := models.NewMob(mobType, variant, level)
+			mob.ID = g.newID()
 
-			// Find a valid position
+			// Find a valid position, leaving the mob out of a room too full for it
 			var x, y int
-			for {
+			found := false
+			for i := 0; i < maxPlaceAttempts && !found; i++ {
 				x = room.X + g.rng.Intn(room.Width)
 				y = room.Y + g.rng.Intn(room.Height)
 
 				// Check if the tile is walkable and doesn't have a mob
-				if floor.Tiles[y][x].Walkable && floor.Tiles[y][x].MobID == "" &&
+				found = floor.Tiles[y][x].Walkable && floor.Tiles[y][x].MobID == "" &&
 					floor.Tiles[y][x].Type != models.TileUpStairs &&
-					floor.Tiles[y][x].Type != models.TileDownStairs {
-					break
-				}
+					floor.Tiles[y][x].Type != models.TileDownStairs
+			}
+			if !found {
+				continue
 			}
 
 			mob.Position = models.Position{X: x, Y: y}
@@ -606,60 +704,516 @@ func (g *MapGenerator) placeMobsWithDifficulty(floor *models.Floor, rooms []mode
 func (g *MapGenerator) placeItems(floor *models.Floor, rooms []models.Room, level int) {
 	floor.Items = make(map[string]models.Item)
 
-	// Place items in each room
+	// Place items in each room from the loot table for its type, with the
+	// theme's own finds in standard and treasure rooms
 	for _, room := range rooms {
-		// Determine number of items based on room type
-		numItems := 0
+		items := models.Loot().RollRoom(g.rng, room.Type, level)
+		if room.Type == models.RoomStandard || room.Type == models.RoomTreasure {
+			items = append(items, models.Loot().RollTheme(g.rng, g.Theme.Definition().Theme, level)...)
+		}
+		for _, item := range items {
+			item.ID = g.newID()
+
+			// Find a valid position, leaving the item out of a room too full for it
+			var x, y int
+			found := false
+			for i := 0; i < maxPlaceAttempts && !found; i++ {
+				x = room.X + g.rng.Intn(room.Width)
+				y = room.Y + g.rng.Intn(room.Height)
+
+				// Check if the tile is walkable and doesn't have an item or mob
+				found = floor.Tiles[y][x].Walkable && floor.Tiles[y][x].ItemID == "" &&
+					floor.Tiles[y][x].MobID == "" &&
+					floor.Tiles[y][x].Type != models.TileUpStairs &&
+					floor.Tiles[y][x].Type != models.TileDownStairs
+			}
+			if !found {
+				continue
+			}
+
+			item.Position = models.Position{X: x, Y: y}
 
+			// Add to floor
+			floor.Items[item.ID] = *item
+			floor.Tiles[y][x].ItemID = item.ID
+		}
+	}
+}
+
+// placeTraps hides the theme's traps in standard and treasure rooms. Deeper floors
+// have more traps, with harder checks and more kinds of trap.
+func (g *MapGenerator) placeTraps(floor *models.Floor, rooms []models.Room, level int) {
+	floor.Traps = make(map[string]*models.Trap)
+
+	theme := g.Theme.Definition()
+	trapTypes := theme.HazardsAt(level)
+	trapChance := min(20+3*level, 60) + theme.TrapBonus
+	if len(trapTypes) == 0 {
+		return
+	}
+
+	for _, room := range rooms {
+		numTraps := 0
 		switch room.Type {
+		case models.RoomStandard:
+			if g.rng.Intn(100) < trapChance {
+				numTraps = 1
+			}
 		case models.RoomTreasure:
-			numItems = 3 + g.rng.Intn(3) // 3-5 items
+			// Treasure is guarded
+			numTraps = 1 + level/5
+		}
+
+		for i := 0; i < numTraps; i++ {
+			trap := models.NewTrap(trapTypes[g.rng.Intn(len(trapTypes))], level)
+			trap.ID = g.newID()
+
+			// Give up on crowded rooms rather than searching forever
+			for attempt := 0; attempt < maxTrapAttempts; attempt++ {
+				x := room.X + g.rng.Intn(room.Width)
+				y := room.Y + g.rng.Intn(room.Height)
+
+				tile := &floor.Tiles[y][x]
+				if tile.Type != models.TileFloor || tile.TrapID != "" || tile.ItemID != "" || tile.MobID != "" {
+					continue
+				}
+
+				trap.Position = models.Position{X: x, Y: y}
+				floor.Traps[trap.ID] = trap
+				tile.TrapID = trap.ID
+				break
+			}
+		}
+	}
+}
+
+// placeDoors hangs a door in every doorway into a room. Some doors are locked,
+// and always those into treasure rooms, but never in a way that cuts the stairs,
+// a shop or another lock's key off from where characters arrive. Each locked
+// door's key is dropped somewhere reachable.
+func (g *MapGenerator) placeDoors(floor *models.Floor, rooms []models.Room, level int) {
+	floor.Doors = make(map[string]*models.Door)
+	lockChance := min(15+3*level, 50)
+
+	for _, room := range rooms {
+		for _, pos := range doorways(floor, rooms, room) {
+			door := models.NewDoor(pos)
+			door.ID = g.newID()
+			floor.Doors[door.ID] = door
+			tile := &floor.Tiles[pos.Y][pos.X]
+			tile.Type = models.TileDoor
+			tile.Walkable = false
+			tile.DoorID = door.ID
+
+			// Safe places stay open to everyone
+			if room.Type == models.RoomSafe || room.Type == models.RoomEntrance || room.Type == models.RoomShop {
+				continue
+			}
+			if room.Type != models.RoomTreasure && g.rng.Intn(100) >= lockChance {
+				continue
+			}
+
+			door.Lock = g.newLock(level)
+			if !essentialsReachable(floor, rooms) || !g.placeKey(floor, rooms, "Iron Key", door.ID) {
+				door.Lock = nil
+			}
+		}
+	}
+}
+
+// placeChests puts a chest in every treasure and boss room and in some standard
+// rooms. Chests hold loot from the loot catalog and are often locked, with their
+// key dropped somewhere reachable.
+func (g *MapGenerator) placeChests(floor *models.Floor, rooms []models.Room, level int) {
+	floor.Chests = make(map[string]*models.Chest)
+	chestChance := min(10+2*level, 30)
+
+	for _, room := range rooms {
+		switch room.Type {
+		case models.RoomTreasure, models.RoomBoss:
 		case models.RoomStandard:
-			if g.rng.Float64() < 0.3 { // 30% chance for an item
-				numItems = 1
-			}
-		case models.RoomBoss:
-			numItems = 2 + g.rng.Intn(3) // 2-4 items
-		case models.RoomEntrance:
-			if level == 1 {
-				// First floor entrance might have a starter item
-				if g.rng.Float64() < 0.5 { // 50% chance for a starter item
-					numItems = 1
+			if g.rng.Intn(100) >= chestChance {
+				continue
+			}
+		default:
+			continue
+		}
+
+		// Chests go where they can't block the way through the room
+		for attempt := 0; attempt < maxChestAttempts; attempt++ {
+			pos := models.Position{X: room.X + 1 + g.rng.Intn(room.Width-2), Y: room.Y + 1 + g.rng.Intn(room.Height-2)}
+			if !openAround(floor, pos) {
+				continue
+			}
+
+			items := models.Loot().RollChest(g.rng, level)
+			for _, item := range items {
+				item.ID = g.newID()
+				item.Position = pos
+			}
+			chest := models.NewChest(pos, items)
+			chest.ID = g.newID()
+			floor.Chests[chest.ID] = chest
+			tile := &floor.Tiles[pos.Y][pos.X]
+			tile.Type = models.TileChest
+			tile.Walkable = false
+			tile.ChestID = chest.ID
+
+			if room.Type == models.RoomTreasure || g.rng.Intn(2) == 0 {
+				chest.Lock = g.newLock(level)
+				if !g.placeKey(floor, rooms, "Brass Key", chest.ID) {
+					chest.Lock = nil
 				}
 			}
+			break
+		}
+	}
+}
+
+// placePuzzles sets up a puzzle in every puzzle room. Puzzle rooms too cramped
+// for one become standard rooms.
+func (g *MapGenerator) placePuzzles(floor *models.Floor, rooms []models.Room, level int) {
+	floor.Puzzles = make(map[string]*models.Puzzle)
+	for i := range rooms {
+		if rooms[i].Type == models.RoomPuzzle && !g.placePuzzle(floor, rooms[i], level) {
+			rooms[i].Type = models.RoomStandard
+		}
+	}
+}
+
+// placePuzzle walls off a corner of a room as a reward alcove holding a chest,
+// seals it with a door, and fills the room with levers or pressure plates that
+// open the door once they are solved. Levers start scrambled by pulling them at
+// random, so they can always be put back.
+func (g *MapGenerator) placePuzzle(floor *models.Floor, room models.Room, level int) bool {
+	alcove, seal, walls, found := g.alcoveCorner(floor, room)
+	if !found {
+		return false
+	}
+	for _, pos := range walls {
+		floor.Tiles[pos.Y][pos.X] = models.Tile{Type: models.TileWall}
+	}
+
+	door := models.NewDoor(seal)
+	door.ID = g.newID()
+	door.Sealed = true
+	floor.Doors[door.ID] = door
+	floor.Tiles[seal.Y][seal.X] = models.Tile{Type: models.TileDoor, RoomID: room.ID, DoorID: door.ID}
+
+	items := models.Loot().RollChest(g.rng, level)
+	for _, item := range items {
+		item.ID = g.newID()
+		item.Position = alcove
+	}
+	chest := models.NewChest(alcove, items)
+	chest.ID = g.newID()
+	floor.Chests[chest.ID] = chest
+	floor.Tiles[alcove.Y][alcove.X] = models.Tile{Type: models.TileChest, RoomID: room.ID, ChestID: chest.ID}
+
+	kind := models.PuzzleLevers
+	if g.rng.Intn(2) == 0 {
+		kind = models.PuzzlePlates
+	}
+	puzzle := models.NewPuzzle(kind, room.ID, level)
+	puzzle.ID = g.newID()
+	puzzle.DoorID = door.ID
+
+	// Cramped rooms fall back to pressure plates, which fit anywhere
+	if kind == models.PuzzleLevers && !g.placeLevers(floor, room, puzzle) {
+		puzzle.Kind = models.PuzzlePlates
+	}
+	if puzzle.Kind == models.PuzzlePlates {
+		g.placePlates(floor, room, puzzle)
+	}
+
+	floor.Puzzles[puzzle.ID] = puzzle
+	return true
+}
+
+// alcoveCorner picks a corner of a room that can be walled off without blocking
+// a way into the room. It returns the alcove tile, the doorway sealing it and
+// the two tiles to wall up.
+func (g *MapGenerator) alcoveCorner(floor *models.Floor, room models.Room) (models.Position, models.Position, []models.Position, bool) {
+	corners := []struct{ x, y, dx, dy int }{
+		{room.X, room.Y, 1, 1},
+		{room.X + room.Width - 1, room.Y, -1, 1},
+		{room.X, room.Y + room.Height - 1, 1, -1},
+		{room.X + room.Width - 1, room.Y + room.Height - 1, -1, -1},
+	}
+
+	for _, i := range g.rng.Perm(len(corners)) {
+		c := corners[i]
+		alcove := models.Position{X: c.x, Y: c.y}
+		seal := models.Position{X: c.x + c.dx, Y: c.y}
+		walls := []models.Position{{X: c.x, Y: c.y + c.dy}, {X: c.x + c.dx, Y: c.y + c.dy}}
+
+		usable := true
+		for _, pos := range append([]models.Position{alcove, seal}, walls...) {
+			tile := floor.Tiles[pos.Y][pos.X]
+			if tile.Type != models.TileFloor || tile.ItemID != "" || tile.MobID != "" {
+				usable = false
+			}
 		}
+		// Nothing may lead into the corner from outside the room
+		outside := []models.Position{
+			{X: c.x - c.dx, Y: c.y}, {X: c.x - c.dx, Y: c.y + c.dy},
+			{X: c.x, Y: c.y - c.dy}, {X: c.x + c.dx, Y: c.y - c.dy},
+		}
+		for _, pos := range outside {
+			if !isWall(floor, pos) {
+				usable = false
+			}
+		}
+
+		if usable {
+			return alcove, seal, walls, true
+		}
+	}
+	return models.Position{}, models.Position{}, nil, false
+}
+
+// placeLevers places three to five levers where they don't block the way through
+// the room, links some of them together and scrambles them. Returns false, leaving
+// the room as it was, if too few levers fit.
+func (g *MapGenerator) placeLevers(floor *models.Floor, room models.Room, puzzle *models.Puzzle) bool {
+	count := 3 + g.rng.Intn(3)
+	positions := make([]models.Position, 0, count)
+	for _, pos := range g.interiorTiles(room) {
+		if len(positions) == count {
+			break
+		}
+		// Levers can't be next to each other, so each one can be walked around
+		if openAround(floor, pos) && !nearAny(positions, pos) {
+			positions = append(positions, pos)
+		}
+	}
+	if len(positions) < minPuzzleParts {
+		return false
+	}
+
+	for _, pos := range positions {
+		lever := &models.Lever{ID: g.newID(), Position: pos, Up: true}
+		puzzle.Levers = append(puzzle.Levers, lever)
+		floor.Tiles[pos.Y][pos.X].Type = models.TileLever
+		floor.Tiles[pos.Y][pos.X].Walkable = false
+		floor.Tiles[pos.Y][pos.X].PuzzleID = puzzle.ID
+	}
+	for i, lever := range puzzle.Levers {
+		for _, other := range g.rng.Perm(len(puzzle.Levers))[:g.rng.Intn(3)] {
+			if other != i {
+				lever.Links = append(lever.Links, other)
+			}
+		}
+	}
+
+	// Pulling levers from the solved state guarantees there is a way back
+	for pulls := 1 + g.rng.Intn(len(puzzle.Levers)); pulls > 0 || puzzle.IsSolved(); pulls-- {
+		puzzle.PullLever(g.rng.Intn(len(puzzle.Levers)))
+	}
+	return true
+}
 
-		// Skip if no items
-		if numItems == 0 {
+// placePlates places three or four pressure plates and picks the hidden order
+// they must be stepped on in
+func (g *MapGenerator) placePlates(floor *models.Floor, room models.Room, puzzle *models.Puzzle) {
+	count := 3 + g.rng.Intn(2)
+	for _, pos := range g.interiorTiles(room) {
+		if len(puzzle.Plates) == count {
+			break
+		}
+		if floor.Tiles[pos.Y][pos.X].Type != models.TileFloor {
 			continue
 		}
 
-		for j := 0; j < numItems; j++ {
-			// Generate a random item
-			item := models.GenerateRandomItem(level)
+		plate := &models.PressurePlate{ID: g.newID(), Position: pos}
+		puzzle.Plates = append(puzzle.Plates, plate)
+		floor.Tiles[pos.Y][pos.X].Type = models.TilePlate
+		floor.Tiles[pos.Y][pos.X].PuzzleID = puzzle.ID
+	}
+	puzzle.Sequence = g.rng.Perm(len(puzzle.Plates))
+}
 
-			// Find a valid position
-			var x, y int
-			for {
-				x = room.X + g.rng.Intn(room.Width)
-				y = room.Y + g.rng.Intn(room.Height)
+// interiorTiles returns the tiles of a room away from its walls, in random order
+func (g *MapGenerator) interiorTiles(room models.Room) []models.Position {
+	tiles := make([]models.Position, 0)
+	for y := room.Y + 1; y < room.Y+room.Height-1; y++ {
+		for x := room.X + 1; x < room.X+room.Width-1; x++ {
+			tiles = append(tiles, models.Position{X: x, Y: y})
+		}
+	}
+	g.rng.Shuffle(len(tiles), func(i, j int) { tiles[i], tiles[j] = tiles[j], tiles[i] })
+	return tiles
+}
 
-				// Check if the tile is walkable and doesn't have an item or mob
-				if floor.Tiles[y][x].Walkable && floor.Tiles[y][x].ItemID == "" &&
-					floor.Tiles[y][x].MobID == "" &&
-					floor.Tiles[y][x].Type != models.TileUpStairs &&
-					floor.Tiles[y][x].Type != models.TileDownStairs {
-					break
+// nearAny checks if a position is next to any of the others
+func nearAny(positions []models.Position, pos models.Position) bool {
+	for _, other := range positions {
+		if chebyshevDistance(other, pos) <= 1 {
+			return true
+		}
+	}
+	return false
+}
+
+// newLock creates a lock for a floor, rigging some of them with a trap
+func (g *MapGenerator) newLock(level int) *models.Lock {
+	lock := models.NewLock(level)
+	if g.rng.Intn(100) < min(10+2*level, 40) {
+		trapType := models.TrapSpike
+		if level >= 2 && g.rng.Intn(2) == 0 {
+			trapType = models.TrapPoison
+		}
+		lock.Trap = models.NewTrap(trapType, level)
+		lock.Trap.ID = g.newID()
+	}
+	return lock
+}
+
+// placeKey drops the key for a door or chest on a random room tile that can be
+// reached from the first room without opening a locked door
+func (g *MapGenerator) placeKey(floor *models.Floor, rooms []models.Room, name string, lockID string) bool {
+	candidates := make([]models.Position, 0)
+	for _, pos := range reachableTiles(floor, roomCenter(rooms[0])) {
+		tile := floor.Tiles[pos.Y][pos.X]
+		if tile.Type == models.TileFloor && tile.RoomID != "" && tile.ItemID == "" && tile.MobID == "" {
+			candidates = append(candidates, pos)
+		}
+	}
+	if len(candidates) == 0 {
+		return false
+	}
+
+	key := models.NewKey(name, lockID)
+	key.ID = g.newID()
+	key.Position = candidates[g.rng.Intn(len(candidates))]
+	floor.Items[key.ID] = *key
+	floor.Tiles[key.Position.Y][key.Position.X].ItemID = key.ID
+	return true
+}
+
+// doorways returns the openings in the wall around a room that a door fits in:
+// single floor tiles just outside the room with wall on either side
+func doorways(floor *models.Floor, rooms []models.Room, room models.Room) []models.Position {
+	doorways := make([]models.Position, 0)
+	check := func(pos, side models.Position) {
+		if !hasTile(floor, pos) || inAnyRoom(rooms, pos) {
+			return
+		}
+		tile := floor.Tiles[pos.Y][pos.X]
+		if tile.Type != models.TileFloor || !tile.Walkable || tile.ItemID != "" || tile.MobID != "" {
+			return
+		}
+		before := models.Position{X: pos.X - side.X, Y: pos.Y - side.Y}
+		after := models.Position{X: pos.X + side.X, Y: pos.Y + side.Y}
+		if isWall(floor, before) && isWall(floor, after) {
+			doorways = append(doorways, pos)
+		}
+	}
+
+	for x := room.X; x < room.X+room.Width; x++ {
+		check(models.Position{X: x, Y: room.Y - 1}, models.Position{X: 1})
+		check(models.Position{X: x, Y: room.Y + room.Height}, models.Position{X: 1})
+	}
+	for y := room.Y; y < room.Y+room.Height; y++ {
+		check(models.Position{X: room.X - 1, Y: y}, models.Position{Y: 1})
+		check(models.Position{X: room.X + room.Width, Y: y}, models.Position{Y: 1})
+	}
+	return doorways
+}
+
+// essentialsReachable checks if the stairs, every shop and every key can still be
+// reached from the first room without opening a locked door
+func essentialsReachable(floor *models.Floor, rooms []models.Room) bool {
+	reachable := make(map[models.Position]bool)
+	for _, pos := range reachableTiles(floor, roomCenter(rooms[0])) {
+		reachable[pos] = true
+	}
+
+	essentials := append(append([]models.Position(nil), floor.UpStairs...), floor.DownStairs...)
+	for _, room := range rooms {
+		if room.Type == models.RoomShop {
+			essentials = append(essentials, roomCenter(room))
+		}
+	}
+	for _, item := range floor.Items {
+		if item.Type == models.ItemKey {
+			essentials = append(essentials, item.Position)
+		}
+	}
+	for _, pos := range essentials {
+		if !reachable[pos] {
+			return false
+		}
+	}
+	return true
+}
+
+// reachableTiles returns the tiles that can be walked to from a position, treating
+// closed doors as passable unless they are locked or sealed
+func reachableTiles(floor *models.Floor, start models.Position) []models.Position {
+	visited := map[models.Position]bool{start: true}
+	reachable := []models.Position{start}
+	for i := 0; i < len(reachable); i++ {
+		pos := reachable[i]
+		for _, dir := range []models.Position{{X: 0, Y: -1}, {X: 1, Y: 0}, {X: 0, Y: 1}, {X: -1, Y: 0}} {
+			next := models.Position{X: pos.X + dir.X, Y: pos.Y + dir.Y}
+			if visited[next] || !hasTile(floor, next) {
+				continue
+			}
+			visited[next] = true
+
+			tile := floor.Tiles[next.Y][next.X]
+			if door, exists := floor.Doors[tile.DoorID]; exists {
+				if door.Lock.IsLocked() || door.Sealed {
+					continue
 				}
+			} else if !tile.Walkable {
+				continue
+			}
+			reachable = append(reachable, next)
+		}
+	}
+	return reachable
+}
+
+// openAround checks if a tile and the eight around it are plain floor with nothing on them
+func openAround(floor *models.Floor, pos models.Position) bool {
+	for dy := -1; dy <= 1; dy++ {
+		for dx := -1; dx <= 1; dx++ {
+			p := models.Position{X: pos.X + dx, Y: pos.Y + dy}
+			if !hasTile(floor, p) {
+				return false
+			}
+			tile := floor.Tiles[p.Y][p.X]
+			if tile.Type != models.TileFloor || !tile.Walkable {
+				return false
+			}
+			if dx == 0 && dy == 0 && (tile.ItemID != "" || tile.MobID != "") {
+				return false
 			}
+		}
+	}
+	return true
+}
 
-			item.Position = models.Position{X: x, Y: y}
+// isWall checks if a position is off the floor or a wall
+func isWall(floor *models.Floor, pos models.Position) bool {
+	return !hasTile(floor, pos) || floor.Tiles[pos.Y][pos.X].Type == models.TileWall
+}
 
-			// Add to floor
-			floor.Items[item.ID] = *item
-			floor.Tiles[y][x].ItemID = item.ID
+// inAnyRoom checks if a position is inside any of the rooms
+func inAnyRoom(rooms []models.Room, pos models.Position) bool {
+	for _, room := range rooms {
+		if inRoom(room, pos) {
+			return true
 		}
 	}
+	return false
+}
+
+// roomCenter returns the tile in the middle of a room
+func roomCenter(room models.Room) models.Position {
+	return models.Position{X: room.X + room.Width/2, Y: room.Y + room.Height/2}
 }
 
 // Helper functions
@@ -1,13 +1,24 @@
 package game
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
 	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 
 	"github.com/jchauncey/TheDeeps/server/models"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
+// updateGolden rewrites the golden files instead of comparing against them
+var updateGolden = flag.Bool("update", false, "update golden files")
+
 func TestNewMapGenerator(t *testing.T) {
 	// Test with a specific seed
 	seed := int64(12345)
@@ -664,6 +675,95 @@ func TestPlaceItems(t *testing.T) {
 	}
 }
 
+func TestPlaceTraps(t *testing.T) {
+	generator := NewMapGenerator(42)
+
+	for _, level := range []int{1, 5, 10} {
+		t.Run(fmt.Sprintf("Level %d", level), func(t *testing.T) {
+			floor := newOpenFloor(60, 20)
+			floor.Level = level
+			rooms := []models.Room{
+				{ID: "standard", Type: models.RoomStandard, X: 2, Y: 2, Width: 10, Height: 10},
+				{ID: "treasure", Type: models.RoomTreasure, X: 20, Y: 2, Width: 10, Height: 10},
+				{ID: "safe", Type: models.RoomSafe, X: 40, Y: 2, Width: 10, Height: 10},
+			}
+
+			generator.placeTraps(floor, rooms, level)
+
+			perRoom := make(map[string]int)
+			for id, trap := range floor.Traps {
+				tile := floor.Tiles[trap.Position.Y][trap.Position.X]
+				assert.Equal(t, id, tile.TrapID, "Traps should be referenced by their tile")
+				assert.Equal(t, models.TileFloor, tile.Type, "Hidden traps look like floor")
+				assert.False(t, trap.Revealed)
+				assert.Equal(t, level, trap.Level)
+				if level < 3 {
+					assert.NotEqual(t, models.TrapTeleport, trap.Type, "Teleport traps only appear from the third floor")
+				}
+
+				for _, room := range rooms {
+					if inRoom(room, trap.Position) {
+						perRoom[room.ID]++
+					}
+				}
+			}
+
+			assert.Equal(t, 1+level/5, perRoom["treasure"], "Treasure rooms are always trapped")
+			assert.LessOrEqual(t, perRoom["standard"], 1)
+			assert.Zero(t, perRoom["safe"], "Safe rooms are never trapped")
+		})
+	}
+}
+
+func TestPlaceDoorsAndChests(t *testing.T) {
+	generator := NewMapGenerator(7)
+
+	locks := 0
+	for level := 1; level <= 10; level++ {
+		floor := &models.Floor{Level: level, Width: 80, Height: 40, Tiles: make([][]models.Tile, 40)}
+		for y := range floor.Tiles {
+			floor.Tiles[y] = make([]models.Tile, floor.Width)
+		}
+		generator.GenerateFloor(floor, level, level == 10)
+
+		reachable := make(map[models.Position]bool)
+		for _, pos := range reachableTiles(floor, roomCenter(floor.Rooms[0])) {
+			reachable[pos] = true
+		}
+		keys := make(map[string]models.Item)
+		for _, item := range floor.Items {
+			if item.Type == models.ItemKey {
+				keys[item.LockID] = item
+				assert.True(t, reachable[item.Position], "Keys should be reachable without opening a locked door")
+			}
+		}
+		for _, pos := range append(floor.UpStairs, floor.DownStairs...) {
+			assert.True(t, reachable[pos], "Locked doors should never cut off the stairs")
+		}
+
+		for id, door := range floor.Doors {
+			tile := floor.Tiles[door.Position.Y][door.Position.X]
+			assert.Equal(t, id, tile.DoorID)
+			assert.Equal(t, models.TileDoor, tile.Type)
+			assert.False(t, tile.Walkable, "Doors start closed")
+			if door.Lock != nil {
+				locks++
+				assert.Contains(t, keys, id, "Every locked door should have a key")
+			}
+		}
+		for id, chest := range floor.Chests {
+			tile := floor.Tiles[chest.Position.Y][chest.Position.X]
+			assert.Equal(t, id, tile.ChestID)
+			assert.Equal(t, models.TileChest, tile.Type)
+			if chest.Lock != nil {
+				locks++
+				assert.Contains(t, keys, id, "Every locked chest should have a key")
+			}
+		}
+	}
+	assert.Positive(t, locks, "Some doors and chests should be locked")
+}
+
 func TestHelperFunctions(t *testing.T) {
 	// Test min function
 	assert.Equal(t, 5, min(5, 10))
@@ -857,3 +957,112 @@ func TestEntranceRoom(t *testing.T) {
 	// We don't assert a specific number since it's random (50% chance)
 	t.Logf("Entrance room has %d items", itemsInEntranceRoom)
 }
+
+// generateSeededFloor generates one floor of a dungeon from a seed and returns its JSON
+func generateSeededFloor(t *testing.T, seed int64, floors, level int) []byte {
+	dungeon := models.NewDungeon("Golden", floors, seed)
+	floor := dungeon.GenerateFloor(level)
+	GenerateDungeonFloor(dungeon, floor)
+
+	data, err := json.Marshal(floor)
+	require.NoError(t, err)
+	return data
+}
+
+func TestGenerateDungeonFloorIsDeterministic(t *testing.T) {
+	for level := 1; level <= 3; level++ {
+		first := generateSeededFloor(t, 12345, 3, level)
+		second := generateSeededFloor(t, 12345, 3, level)
+		assert.Equal(t, string(first), string(second), "Floor %d should be byte-identical for the same seed", level)
+	}
+
+	// Floors don't depend on which floors were generated before them
+	dungeon := models.NewDungeon("Golden", 3, 12345)
+	floor3 := dungeon.GenerateFloor(3)
+	GenerateDungeonFloor(dungeon, floor3)
+	data, err := json.Marshal(floor3)
+	require.NoError(t, err)
+	assert.Equal(t, string(generateSeededFloor(t, 12345, 3, 3)), string(data), "Generation order should not matter")
+
+	assert.NotEqual(t, string(generateSeededFloor(t, 12345, 3, 1)), string(generateSeededFloor(t, 54321, 3, 1)),
+		"Different seeds should give different floors")
+}
+
+// TestGenerateDungeonFloorGolden pins the floors generated from a seed, so a seed in a
+// bug report keeps reproducing the same dungeon. Run with -update after intended
+// changes to generation.
+func TestGenerateDungeonFloorGolden(t *testing.T) {
+	path := filepath.Join("testdata", "seed_12345_floors.golden")
+
+	var lines []string
+	for level := 1; level <= 3; level++ {
+		data := generateSeededFloor(t, 12345, 3, level)
+		sum := sha256.Sum256(data)
+		lines = append(lines, fmt.Sprintf("floor %d: %d bytes sha256 %s", level, len(data), hex.EncodeToString(sum[:])))
+	}
+	got := strings.Join(lines, "\n") + "\n"
+
+	if *updateGolden {
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+		require.NoError(t, os.WriteFile(path, []byte(got), 0644))
+	}
+
+	want, err := os.ReadFile(path)
+	require.NoError(t, err, "Golden file missing; run go test ./game -run Golden -update")
+	assert.Equal(t, string(want), got, "Generated floors changed for seed 12345")
+}
+
+func TestGenerateThemedFloors(t *testing.T) {
+	for _, theme := range models.Themes {
+		t.Run(string(theme), func(t *testing.T) {
+			definition := theme.Definition()
+			dungeon := models.NewDungeon("Themed", 6, 777)
+			dungeon.Theme = theme
+
+			var shaped bool
+			for level := 1; level <= dungeon.Floors; level++ {
+				floor := dungeon.GenerateFloor(level)
+				GenerateDungeonFloor(dungeon, floor)
+				assert.Equal(t, theme, floor.Theme)
+				assert.Equal(t, definition.Palette, floor.Palette)
+
+				// Monsters and traps come from the theme
+				mobTypes := definition.MobsAt(models.Monsters(), level)
+				for _, mob := range floor.Mobs {
+					switch {
+					case mob.Type == models.MobShopkeeper:
+					case mob.Variant == models.VariantBoss:
+						assert.Equal(t, definition.BossAt(level), mob.Type, "Floor %d boss", level)
+					default:
+						assert.Contains(t, mobTypes, mob.Type, "Floor %d", level)
+					}
+				}
+				for _, trap := range floor.Traps {
+					assert.Contains(t, definition.HazardsAt(level), trap.Type, "Floor %d", level)
+				}
+
+				// Reshaped rooms never cut the stairs off
+				assert.NoError(t, CheckConnectivity(floor), "Floor %d", level)
+
+				for _, room := range floor.Rooms {
+					if room.Type != models.RoomStandard {
+						continue
+					}
+					corner := floor.Tiles[room.Y][room.X]
+					pillar := floor.Tiles[room.Y+2][room.X+2]
+					switch definition.Shape {
+					case models.ShapeCave:
+						shaped = shaped || corner.Type == models.TileWall
+					case models.ShapePillared:
+						shaped = shaped || pillar.Type == models.TileWall
+					default:
+						assert.NotEqual(t, models.TileWall, pillar.Type, "Rectangular rooms are left whole")
+					}
+				}
+			}
+			if definition.Shape != models.ShapeRectangle {
+				assert.True(t, shaped, "Rooms should be carved as %s", definition.Shape)
+			}
+		})
+	}
+}
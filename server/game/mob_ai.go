@@ -0,0 +1,356 @@
+package game
+
+import (
+	"math/rand"
+	"sort"
+
+	"github.com/jchauncey/TheDeeps/server/models"
+	"github.com/jchauncey/TheDeeps/server/pathfinding"
+)
+
+const (
+	defaultSightRadius  = 6   // Tiles within which a mob notices a player
+	defaultWanderChance = 0.3 // Chance an idle mob takes a random step each tick
+	maxChaseCost        = 30  // Longest path a mob follows to reach a player it can see
+)
+
+// MobAttack describes a mob attacking a character during a tick
+type MobAttack struct {
+	MobID       string `json:"mobId"`
+	CharacterID string `json:"characterId"`
+	Hit         bool   `json:"hit"`
+	Damage      int    `json:"damage,omitempty"`
+
+	Effect *models.StatusEffect `json:"effect,omitempty"` // Status effect the hit inflicted
+}
+
+// MobTickResult collects everything that changed on a floor during a tick
+type MobTickResult struct {
+	Moved    []*models.Mob
+	Removed  []*models.Mob
+	Affected []*models.Mob // Mobs whose status effects ran
+	Attacks  []MobAttack
+	Bosses   []BossAction   // Boss phases, enrages and special attacks
+	Sealed   []*models.Door // Boss room doors shut for a fight
+	Opened   []*models.Door // Boss room doors opened after a fight
+}
+
+// MobAI runs the real-time behaviour of mobs on a floor
+type MobAI struct {
+	rng          *rand.Rand
+	paths        *pathfinding.Cache // Dijkstra maps to the alarms mobs are answering
+	SightRadius  int
+	WanderChance float64
+
+	// Engaged reports mobs that are fighting a turn-based encounter and are left alone
+	Engaged func(mobID string) bool
+}
+
+// NewMobAI creates a new mob AI with the given seed
+func NewMobAI(seed int64) *MobAI {
+	return &MobAI{
+		rng:          rand.New(rand.NewSource(seed)),
+		paths:        pathfinding.NewCache(),
+		SightRadius:  defaultSightRadius,
+		WanderChance: defaultWanderChance,
+	}
+}
+
+// Tick advances every mob on the floor by one step. Mobs that can see a player
+// move toward the closest one and attack when adjacent, mobs called by an alarm
+// head for it, and the rest wander. Bosses run their fight first and boss rooms
+// seal while a boss is fighting inside them.
+// Mobs and characters are processed in ID order so results are deterministic
+// for a given seed.
+func (ai *MobAI) Tick(floor *models.Floor, characters []*models.Character) MobTickResult {
+	result := MobTickResult{}
+
+	players := make([]*models.Character, 0, len(characters))
+	for _, character := range characters {
+		if character.CurrentHP > 0 {
+			players = append(players, character)
+		}
+	}
+	sort.Slice(players, func(i, j int) bool { return players[i].ID < players[j].ID })
+	result.Sealed, result.Opened = SealBossRooms(floor, players)
+
+	mobIDs := make([]string, 0, len(floor.Mobs))
+	for id := range floor.Mobs {
+		mobIDs = append(mobIDs, id)
+	}
+	sort.Strings(mobIDs)
+
+	for _, id := range mobIDs {
+		mob := floor.Mobs[id]
+
+		// Clear out mobs that were killed since the last tick
+		if mob.HP <= 0 {
+			removeMob(floor, mob)
+			result.Removed = append(result.Removed, mob)
+			continue
+		}
+
+		// Mobs in an encounter act on their turn instead
+		if ai.Engaged != nil && ai.Engaged(mob.ID) {
+			continue
+		}
+
+		// Status effects run every tick, and a mob stunned as the tick began loses it
+		stunned := mob.StatusEffects.SkipsTurn()
+		if len(mob.StatusEffects) > 0 {
+			turn := mob.StatusEffects.Tick()
+			mob.HP = min(mob.HP-turn.Damage+turn.Healing, mob.MaxHP)
+			if mob.HP <= 0 {
+				mob.HP = 0
+				removeMob(floor, mob)
+				result.Removed = append(result.Removed, mob)
+				continue
+			}
+			floor.MarkMobs(mob.ID)
+			result.Affected = append(result.Affected, mob)
+		}
+
+		// Shopkeepers mind their shop and stunned mobs lose their turn
+		if mob.Type == models.MobShopkeeper || stunned {
+			continue
+		}
+
+		target := ai.findTarget(mob, players)
+		if target == nil && mob.Alerted != nil {
+			// Mobs called by an alarm head for it until they get there or are blocked
+			if chebyshevDistance(mob.Position, *mob.Alerted) > 1 && ai.answerAlarm(floor, mob, players) {
+				result.Moved = append(result.Moved, mob)
+			} else {
+				mob.Alerted = nil
+			}
+			continue
+		}
+		if target == nil {
+			if ai.rng.Float64() < ai.WanderChance && ai.wander(floor, mob, players) {
+				result.Moved = append(result.Moved, mob)
+			}
+			continue
+		}
+		mob.Alerted = nil
+
+		// Bosses may spend their turn on a special attack instead
+		if mob.Boss != nil {
+			action := BossTurn(floor, mob, players)
+			result.Moved = append(result.Moved, action.Summoned...)
+			if action.Message != "" {
+				result.Bosses = append(result.Bosses, action)
+			}
+			if action.TurnTaken {
+				continue
+			}
+		}
+
+		if chebyshevDistance(mob.Position, target.Position) <= 1 {
+			result.Attacks = append(result.Attacks, ai.attack(mob, target))
+			continue
+		}
+
+		if ai.stepToward(floor, mob, target.Position, players) {
+			result.Moved = append(result.Moved, mob)
+		}
+	}
+
+	return result
+}
+
+// Forget drops what the AI worked out for a floor, once nobody is on it
+func (ai *MobAI) Forget(floor *models.Floor) {
+	ai.paths.Forget(floor)
+}
+
+// findTarget returns the closest living player within sight, or nil
+func (ai *MobAI) findTarget(mob *models.Mob, players []*models.Character) *models.Character {
+	var target *models.Character
+	bestDistance := ai.SightRadius + 1
+
+	for _, player := range players {
+		distance := chebyshevDistance(mob.Position, player.Position)
+		if distance < bestDistance {
+			target = player
+			bestDistance = distance
+		}
+	}
+
+	return target
+}
+
+// attack resolves a single mob attack against a character
+func (ai *MobAI) attack(mob *models.Mob, character *models.Character) MobAttack {
+	attack := MobAttack{
+		MobID:       mob.ID,
+		CharacterID: character.ID,
+	}
+
+	hitChancePercent := int(mob.CalculateHitChance(character.CalculateTotalAC()) * 100)
+	if ai.rng.Intn(100)+1 > hitChancePercent {
+		return attack
+	}
+
+	damage := calculateMobDamage(mob, character)
+	died := damageCharacter(character, damage)
+
+	attack.Hit = true
+	attack.Damage = damage
+	if effect, inflicted := models.Monsters().RollOnHit(ai.rng, mob); inflicted && !died {
+		applied := character.StatusEffects.Apply(effect)
+		attack.Effect = &applied
+	}
+	return attack
+}
+
+// stepToward moves the mob one tile along the cheapest path to the target. When
+// there is no such path it steps to a free tile closer to the target, if there is one.
+func (ai *MobAI) stepToward(floor *models.Floor, mob *models.Mob, target models.Position, players []*models.Character) bool {
+	path, found := pathfinding.FindPath(floor, mob.Position, target, mobPathOptions(players, maxChaseCost))
+	if found && len(path) > 0 && canMobEnter(floor, path[0], players) {
+		moveMob(floor, mob, path[0])
+		return true
+	}
+
+	current := manhattanDistance(mob.Position, target)
+
+	best := mob.Position
+	for _, dir := range mobDirections {
+		next := models.Position{X: mob.Position.X + dir.X, Y: mob.Position.Y + dir.Y}
+		if !canMobEnter(floor, next, players) {
+			continue
+		}
+
+		if distance := manhattanDistance(next, target); distance < current {
+			best = next
+			current = distance
+		}
+	}
+
+	if best == mob.Position {
+		return false
+	}
+
+	moveMob(floor, mob, best)
+	return true
+}
+
+// answerAlarm moves the mob one tile downhill on the Dijkstra map to the alarm it
+// was called by. Every mob answering the same alarm shares the map.
+func (ai *MobAI) answerAlarm(floor *models.Floor, mob *models.Mob, players []*models.Character) bool {
+	paths := ai.paths.Map(floor, []models.Position{*mob.Alerted}, mobPathOptions(players, 0))
+	next, found := paths.Next(mob.Position, func(pos models.Position) bool { return canMobEnter(floor, pos, players) })
+	if !found {
+		return false
+	}
+
+	moveMob(floor, mob, next)
+	return true
+}
+
+// mobPathOptions sets how mobs find their way: around closed doors, stairs and
+// whoever is in the way
+func mobPathOptions(players []*models.Character, maxCost int) pathfinding.Options {
+	return pathfinding.Options{
+		AvoidStairs: true,
+		MaxCost:     maxCost,
+		Blocked: func(pos models.Position) bool {
+			for _, player := range players {
+				if player.Position == pos {
+					return true
+				}
+			}
+			return false
+		},
+	}
+}
+
+// wander moves the mob to a random free neighbouring tile
+func (ai *MobAI) wander(floor *models.Floor, mob *models.Mob, players []*models.Character) bool {
+	options := make([]models.Position, 0, len(mobDirections))
+	for _, dir := range mobDirections {
+		next := models.Position{X: mob.Position.X + dir.X, Y: mob.Position.Y + dir.Y}
+		if canMobEnter(floor, next, players) {
+			options = append(options, next)
+		}
+	}
+
+	if len(options) == 0 {
+		return false
+	}
+
+	moveMob(floor, mob, options[ai.rng.Intn(len(options))])
+	return true
+}
+
+// removeMob takes a mob off the floor
+func removeMob(floor *models.Floor, mob *models.Mob) {
+	if inBounds(floor, mob.Position) && floor.Tiles[mob.Position.Y][mob.Position.X].MobID == mob.ID {
+		floor.Tiles[mob.Position.Y][mob.Position.X].MobID = ""
+	}
+	delete(floor.Mobs, mob.ID)
+	floor.MarkTiles(mob.Position)
+	floor.MarkMobs(mob.ID)
+}
+
+// Helper functions
+
+// mobDirections are the steps a mob can take, matching player movement
+var mobDirections = []models.Position{
+	{X: 0, Y: -1}, {X: 1, Y: 0}, {X: 0, Y: 1}, {X: -1, Y: 0},
+}
+
+// canMobEnter checks if a mob can step onto a tile
+func canMobEnter(floor *models.Floor, pos models.Position, players []*models.Character) bool {
+	if !inBounds(floor, pos) {
+		return false
+	}
+
+	tile := floor.Tiles[pos.Y][pos.X]
+	if !tile.Walkable || tile.MobID != "" || tile.Character != "" ||
+		tile.Type == models.TileUpStairs || tile.Type == models.TileDownStairs {
+		return false
+	}
+
+	for _, player := range players {
+		if player.Position == pos {
+			return false
+		}
+	}
+
+	return true
+}
+
+// moveMob moves a mob to a new tile, keeping the tile references in sync
+func moveMob(floor *models.Floor, mob *models.Mob, to models.Position) {
+	if inBounds(floor, mob.Position) && floor.Tiles[mob.Position.Y][mob.Position.X].MobID == mob.ID {
+		floor.Tiles[mob.Position.Y][mob.Position.X].MobID = ""
+	}
+	floor.Tiles[to.Y][to.X].MobID = mob.ID
+	floor.MarkTiles(mob.Position, to)
+	floor.MarkMobs(mob.ID)
+	mob.Position = to
+}
+
+// inBounds checks if a position is on the floor
+func inBounds(floor *models.Floor, pos models.Position) bool {
+	return pos.X >= 0 && pos.X < floor.Width && pos.Y >= 0 && pos.Y < floor.Height
+}
+
+// manhattanDistance returns the number of orthogonal steps between two positions
+func manhattanDistance(a, b models.Position) int {
+	return abs(a.X-b.X) + abs(a.Y-b.Y)
+}
+
+// chebyshevDistance returns the distance between two positions counting diagonals as one step
+func chebyshevDistance(a, b models.Position) int {
+	return max(abs(a.X-b.X), abs(a.Y-b.Y))
+}
+
+// abs returns the absolute value of an integer
+func abs(x int) int {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
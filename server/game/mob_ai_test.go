@@ -0,0 +1,462 @@
+package game
+
+import (
+	"testing"
+	"time"
+
+	"github.com/jchauncey/TheDeeps/server/models"
+	"github.com/jchauncey/TheDeeps/server/repositories"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newOpenFloor creates a floor of walkable tiles surrounded by a wall
+func newOpenFloor(width, height int) *models.Floor {
+	floor := &models.Floor{
+		Level:  1,
+		Width:  width,
+		Height: height,
+		Tiles:  make([][]models.Tile, height),
+		Mobs:   make(map[string]*models.Mob),
+		Items:  make(map[string]models.Item),
+	}
+
+	for y := 0; y < height; y++ {
+		floor.Tiles[y] = make([]models.Tile, width)
+		for x := 0; x < width; x++ {
+			if x == 0 || y == 0 || x == width-1 || y == height-1 {
+				floor.Tiles[y][x] = models.Tile{Type: models.TileWall}
+			} else {
+				floor.Tiles[y][x] = models.Tile{Type: models.TileFloor, Walkable: true}
+			}
+		}
+	}
+
+	return floor
+}
+
+// addMob places a mob on the floor
+func addMob(floor *models.Floor, mob *models.Mob, x, y int) {
+	mob.Position = models.Position{X: x, Y: y}
+	floor.Mobs[mob.ID] = mob
+	floor.Tiles[y][x].MobID = mob.ID
+}
+
+func TestMobAIChasesVisiblePlayer(t *testing.T) {
+	ai := NewMobAI(1)
+	floor := newOpenFloor(20, 20)
+
+	mob := models.NewMob(models.MobGoblin, models.VariantNormal, 1)
+	addMob(floor, mob, 5, 5)
+
+	character := models.NewCharacter("Target", models.Warrior)
+	character.Position = models.Position{X: 9, Y: 5}
+
+	result := ai.Tick(floor, []*models.Character{character})
+
+	require.Len(t, result.Moved, 1, "The mob should move toward the player")
+	assert.Equal(t, models.Position{X: 6, Y: 5}, mob.Position, "The mob should step closer")
+	assert.Equal(t, mob.ID, floor.Tiles[5][6].MobID, "The new tile should reference the mob")
+	assert.Empty(t, floor.Tiles[5][5].MobID, "The old tile should be cleared")
+	assert.Empty(t, result.Attacks, "The mob is not adjacent yet")
+}
+
+func TestMobAIAttacksAdjacentPlayer(t *testing.T) {
+	floor := newOpenFloor(10, 10)
+
+	mob := models.NewMob(models.MobOrc, models.VariantNormal, 1)
+	mob.Damage = 8 // Enough to get through the warrior's defense without killing them
+	addMob(floor, mob, 4, 4)
+
+	character := models.NewCharacter("Target", models.Warrior)
+	character.Position = models.Position{X: 5, Y: 5}
+
+	// Run enough ticks that at least one attack lands
+	ai := NewMobAI(7)
+	hits := 0
+	for i := 0; i < 10; i++ {
+		character.CurrentHP = character.MaxHP
+		result := ai.Tick(floor, []*models.Character{character})
+
+		require.Len(t, result.Attacks, 1, "An adjacent mob should attack every tick")
+		assert.Empty(t, result.Moved, "An attacking mob should not move")
+		assert.Equal(t, models.Position{X: 4, Y: 4}, mob.Position)
+
+		if result.Attacks[0].Hit {
+			hits++
+			assert.Equal(t, character.MaxHP-result.Attacks[0].Damage, character.CurrentHP, "Damage should be applied")
+		}
+	}
+	assert.Greater(t, hits, 0, "At least one attack should hit")
+}
+
+func TestMobAIStunnedMobsLoseTheirTurn(t *testing.T) {
+	floor := newOpenFloor(10, 10)
+
+	mob := models.NewMob(models.MobOrc, models.VariantNormal, 1)
+	mob.StatusEffects.Apply(models.StatusEffect{Type: models.StatusStun, Duration: 1})
+	addMob(floor, mob, 4, 4)
+
+	character := models.NewCharacter("Target", models.Warrior)
+	character.Position = models.Position{X: 5, Y: 5}
+
+	ai := NewMobAI(7)
+	result := ai.Tick(floor, []*models.Character{character})
+	assert.Empty(t, result.Attacks)
+	assert.Empty(t, result.Moved)
+
+	// The stun runs out with the tick it cost, so the mob attacks on the next one
+	assert.False(t, mob.StatusEffects.Has(models.StatusStun))
+	result = ai.Tick(floor, []*models.Character{character})
+	assert.Len(t, result.Attacks, 1)
+}
+
+func TestMobAIStatusEffectsTick(t *testing.T) {
+	floor := newOpenFloor(10, 10)
+	ai := NewMobAI(1)
+	ai.WanderChance = 0
+
+	mob := models.NewMob(models.MobSkeleton, models.VariantNormal, 1)
+	mob.HP = 2
+	mob.StatusEffects.Apply(models.StatusEffect{Type: models.StatusPoison, Duration: 5, Potency: 1})
+	addMob(floor, mob, 4, 4)
+
+	result := ai.Tick(floor, nil)
+	assert.Equal(t, 1, mob.HP)
+	assert.Equal(t, []*models.Mob{mob}, result.Affected)
+
+	// Wounds can kill a mob nobody is fighting
+	result = ai.Tick(floor, nil)
+	assert.Equal(t, []*models.Mob{mob}, result.Removed)
+	assert.NotContains(t, floor.Mobs, mob.ID)
+	assert.Empty(t, floor.Tiles[4][4].MobID)
+
+	// Mobs in an encounter have their effects run on their turns instead
+	engaged := models.NewMob(models.MobSkeleton, models.VariantNormal, 1)
+	engaged.StatusEffects.Apply(models.StatusEffect{Type: models.StatusPoison, Duration: 5, Potency: 1})
+	addMob(floor, engaged, 6, 6)
+	ai.Engaged = func(string) bool { return true }
+	result = ai.Tick(floor, nil)
+	assert.Empty(t, result.Affected)
+	assert.Equal(t, engaged.MaxHP, engaged.HP)
+}
+
+func TestMobAIIgnoresDistantPlayers(t *testing.T) {
+	floor := newOpenFloor(30, 30)
+
+	mob := models.NewMob(models.MobSkeleton, models.VariantNormal, 1)
+	addMob(floor, mob, 2, 2)
+
+	character := models.NewCharacter("Far", models.Warrior)
+	character.Position = models.Position{X: 25, Y: 25}
+
+	// Without wandering a mob that can't see anyone stays put
+	ai := NewMobAI(3)
+	ai.WanderChance = 0
+	result := ai.Tick(floor, []*models.Character{character})
+	assert.Empty(t, result.Moved)
+	assert.Empty(t, result.Attacks)
+	assert.Equal(t, models.Position{X: 2, Y: 2}, mob.Position)
+
+	// With wandering it drifts by at most one tile
+	ai.WanderChance = 1
+	result = ai.Tick(floor, []*models.Character{character})
+	require.Len(t, result.Moved, 1)
+	assert.Equal(t, 1, manhattanDistance(models.Position{X: 2, Y: 2}, mob.Position))
+}
+
+func TestMobAIAnswersAlarm(t *testing.T) {
+	ai := NewMobAI(1)
+	ai.WanderChance = 0
+	floor := newOpenFloor(30, 10)
+
+	mob := models.NewMob(models.MobGoblin, models.VariantNormal, 1)
+	addMob(floor, mob, 20, 5)
+	mob.Alerted = &models.Position{X: 17, Y: 5}
+
+	// The mob heads for the alarm until it gets there
+	result := ai.Tick(floor, nil)
+	require.Len(t, result.Moved, 1)
+	assert.Equal(t, models.Position{X: 19, Y: 5}, mob.Position)
+
+	ai.Tick(floor, nil)
+	assert.Equal(t, models.Position{X: 18, Y: 5}, mob.Position)
+	result = ai.Tick(floor, nil)
+	assert.Empty(t, result.Moved)
+	assert.Nil(t, mob.Alerted, "Mobs stop answering an alarm once they reach it")
+}
+
+func TestMobAIChasesAroundWalls(t *testing.T) {
+	ai := NewMobAI(1)
+	floor := newOpenFloor(20, 20)
+	for y := 1; y <= 7; y++ {
+		floor.Tiles[y][7] = models.Tile{Type: models.TileWall}
+	}
+
+	mob := models.NewMob(models.MobGoblin, models.VariantNormal, 1)
+	addMob(floor, mob, 5, 5)
+
+	character := models.NewCharacter("Target", models.Warrior)
+	character.Position = models.Position{X: 9, Y: 5}
+	character.MaxHP, character.CurrentHP = 1000, 1000
+
+	// Stepping straight at the player would leave the mob stuck against the wall
+	for i := 0; i < 10; i++ {
+		if result := ai.Tick(floor, []*models.Character{character}); len(result.Attacks) > 0 {
+			return
+		}
+	}
+	t.Fatalf("The mob should find its way around the wall, but got stuck at %v", mob.Position)
+}
+
+func TestMobAIAnswersAlarmAroundWalls(t *testing.T) {
+	ai := NewMobAI(1)
+	ai.WanderChance = 0
+	floor := newOpenFloor(30, 12)
+	for y := 1; y <= 7; y++ {
+		floor.Tiles[y][19] = models.Tile{Type: models.TileWall}
+	}
+
+	first := models.NewMob(models.MobGoblin, models.VariantNormal, 1)
+	addMob(floor, first, 20, 5)
+	second := models.NewMob(models.MobGoblin, models.VariantNormal, 1)
+	addMob(floor, second, 22, 3)
+	alarm := models.Position{X: 17, Y: 5}
+	first.Alerted, second.Alerted = &alarm, &alarm
+
+	for i := 0; i < 20 && (first.Alerted != nil || second.Alerted != nil); i++ {
+		ai.Tick(floor, nil)
+	}
+	assert.LessOrEqual(t, chebyshevDistance(first.Position, alarm), 1, "The first mob should reach the alarm")
+	assert.LessOrEqual(t, chebyshevDistance(second.Position, alarm), 2, "The second mob should get as close as the first allows")
+}
+
+func TestMobAIRespectsObstacles(t *testing.T) {
+	ai := NewMobAI(1)
+	ai.WanderChance = 0
+	floor := newOpenFloor(10, 10)
+
+	// Box the mob in with walls and another mob that acts after it
+	mob := models.NewMob(models.MobGoblin, models.VariantNormal, 1)
+	mob.ID = "a"
+	addMob(floor, mob, 1, 1)
+	blocker := models.NewMob(models.MobSkeleton, models.VariantNormal, 1)
+	blocker.ID = "b"
+	addMob(floor, blocker, 2, 1)
+	floor.Tiles[2][1] = models.Tile{Type: models.TileWall}
+
+	character := models.NewCharacter("Target", models.Warrior)
+	character.Position = models.Position{X: 5, Y: 1}
+
+	ai.Tick(floor, []*models.Character{character})
+	assert.Equal(t, models.Position{X: 1, Y: 1}, mob.Position, "The boxed-in mob cannot move")
+}
+
+func TestMobAIRemovesDeadMobsAndSkipsShopkeepers(t *testing.T) {
+	ai := NewMobAI(1)
+	ai.WanderChance = 1
+	floor := newOpenFloor(10, 10)
+
+	dead := models.NewMob(models.MobGoblin, models.VariantNormal, 1)
+	dead.HP = 0
+	addMob(floor, dead, 3, 3)
+
+	shopkeeper := models.NewMob(models.MobShopkeeper, models.VariantNormal, 1)
+	addMob(floor, shopkeeper, 6, 6)
+
+	character := models.NewCharacter("Customer", models.Warrior)
+	character.Position = models.Position{X: 6, Y: 7}
+
+	result := ai.Tick(floor, []*models.Character{character})
+
+	require.Len(t, result.Removed, 1)
+	assert.Equal(t, dead.ID, result.Removed[0].ID)
+	assert.NotContains(t, floor.Mobs, dead.ID, "Dead mobs should be removed from the floor")
+	assert.Empty(t, floor.Tiles[3][3].MobID, "Dead mobs should be removed from their tile")
+	assert.Empty(t, result.Attacks, "Shopkeepers should not attack")
+	assert.Equal(t, models.Position{X: 6, Y: 6}, shopkeeper.Position, "Shopkeepers should not move")
+}
+
+func TestMobAIDeterministic(t *testing.T) {
+	run := func() []models.Position {
+		floor := newOpenFloor(25, 25)
+		mobs := []*models.Mob{}
+		for i := 0; i < 5; i++ {
+			mob := models.NewMob(models.MobGoblin, models.VariantNormal, 1)
+			mob.ID = string(rune('a' + i))
+			addMob(floor, mob, 3+i*4, 3+i*3)
+			mobs = append(mobs, mob)
+		}
+
+		character := models.NewCharacter("Target", models.Warrior)
+		character.ID = "player"
+		character.Position = models.Position{X: 12, Y: 12}
+
+		ai := NewMobAI(42)
+		for i := 0; i < 20; i++ {
+			character.CurrentHP = character.MaxHP
+			ai.Tick(floor, []*models.Character{character})
+		}
+
+		positions := make([]models.Position, len(mobs))
+		for i, mob := range mobs {
+			positions[i] = mob.Position
+		}
+		return positions
+	}
+
+	assert.Equal(t, run(), run(), "The same seed should produce the same simulation")
+}
+
+func TestGameManagerTickMobs(t *testing.T) {
+	characterRepo := repositories.NewCharacterRepository()
+	dungeonRepo := repositories.NewDungeonRepository()
+	manager := NewGameManager(characterRepo, dungeonRepo)
+	manager.MobAI = NewMobAI(1)
+
+	// Create a dungeon with a mob two tiles from the character
+	dungeon := models.NewDungeon("TestDungeon", 1, 12345)
+	floor := newOpenFloor(10, 10)
+	dungeon.FloorData[1] = floor
+	dungeonRepo.Save(dungeon)
+
+	mob := models.NewMob(models.MobGoblin, models.VariantNormal, 1)
+	addMob(floor, mob, 2, 4)
+
+	character := models.NewCharacter("TestCharacter", models.Warrior)
+	character.CurrentDungeon = dungeon.ID
+	character.CurrentFloor = 1
+	character.Position = models.Position{X: 5, Y: 4}
+	characterRepo.Save(character)
+
+	client := &Client{
+		ID:        "test-client",
+		Character: character,
+		Manager:   manager,
+		Send:      make(chan Message, 10),
+	}
+	manager.registerClient(client)
+
+	// Drain the registration messages
+	for len(client.Send) > 0 {
+		<-client.Send
+	}
+
+	// First tick moves the mob next to the character
+	manager.tickMobs()
+	select {
+	case msg := <-client.Send:
+		assert.Equal(t, MsgUpdateMob, msg.Type)
+		require.NotNil(t, msg.Mob)
+		assert.Equal(t, models.Position{X: 3, Y: 4}, msg.Mob.Position)
+	case <-time.After(100 * time.Millisecond):
+		t.Fatal("Expected a mob update")
+	}
+
+	// Second tick the mob is adjacent and attacks
+	manager.tickMobs()
+	manager.tickMobs()
+	found := false
+	for len(client.Send) > 0 {
+		msg := <-client.Send
+		if msg.Type == MsgNotification {
+			found = true
+			assert.Contains(t, msg.Text, mob.Name)
+		}
+	}
+	assert.True(t, found, "The character should be told about the attack")
+
+	// Killed mobs are removed on the next tick
+	mob.HP = 0
+	manager.tickMobs()
+	select {
+	case msg := <-client.Send:
+		assert.Equal(t, MsgRemoveMob, msg.Type)
+		assert.Equal(t, mob.ID, msg.Mob.ID)
+	case <-time.After(100 * time.Millisecond):
+		t.Fatal("Expected a mob removal")
+	}
+
+	manager.unregisterClient(client)
+}
+
+func TestGameManagerTickStatusEffects(t *testing.T) {
+	characterRepo := repositories.NewCharacterRepository()
+	dungeonRepo := repositories.NewDungeonRepository()
+	manager := NewGameManager(characterRepo, dungeonRepo)
+	manager.MobAI = NewMobAI(1)
+	manager.MobAI.WanderChance = 0
+
+	dungeon := models.NewDungeon("TestDungeon", 1, 12345)
+	floor := newOpenFloor(10, 10)
+	dungeon.FloorData[1] = floor
+	dungeonRepo.Save(dungeon)
+
+	character := models.NewCharacter("TestCharacter", models.Warrior)
+	character.CurrentDungeon = dungeon.ID
+	character.CurrentFloor = 1
+	character.Position = models.Position{X: 5, Y: 4}
+	character.StatusEffects.Apply(models.StatusEffect{Type: models.StatusPoison, Duration: 5, Potency: 2})
+	characterRepo.Save(character)
+
+	client := &Client{
+		ID:        "test-client",
+		Character: character,
+		Manager:   manager,
+		Send:      make(chan Message, 10),
+	}
+	manager.registerClient(client)
+	drainMessages(client)
+
+	// Out of a fight, effects run on the mob tick
+	manager.tickMobs()
+	assert.Equal(t, character.MaxHP-2, character.CurrentHP)
+	msg := <-client.Send
+	assert.Equal(t, MsgNotification, msg.Type)
+	assert.Contains(t, msg.Text, "2 damage")
+
+	// In a fight, they wait for the character's turns
+	mob := models.NewMob(models.MobSkeleton, models.VariantNormal, 1)
+	addMob(floor, mob, 6, 4)
+	manager.Encounters.Engage(dungeon.ID, floor, character, mob)
+	require.True(t, manager.Encounters.InEncounter(character.ID))
+	hp := character.CurrentHP
+	manager.tickMobs()
+	assert.Equal(t, hp, character.CurrentHP)
+
+	manager.unregisterClient(client)
+}
+
+func TestGameManagerTickForgetsFloors(t *testing.T) {
+	characterRepo := repositories.NewCharacterRepository()
+	dungeonRepo := repositories.NewDungeonRepository()
+	manager := NewGameManager(characterRepo, dungeonRepo)
+	manager.MobAI = NewMobAI(1)
+
+	dungeon := models.NewDungeon("TestDungeon", 2, 12345)
+	floor := newOpenFloor(10, 10)
+	dungeon.FloorData[1] = floor
+	dungeon.FloorData[2] = newOpenFloor(10, 10)
+	dungeonRepo.Save(dungeon)
+
+	character := models.NewCharacter("TestCharacter", models.Warrior)
+	character.CurrentDungeon = dungeon.ID
+	character.CurrentFloor = 1
+	character.Position = models.Position{X: 5, Y: 4}
+	characterRepo.Save(character)
+
+	client := &Client{ID: "test-client", Character: character, Manager: manager, Send: make(chan Message, 32)}
+	manager.registerClient(client)
+	drainMessages(client)
+
+	manager.MobAI.paths.Map(floor, []models.Position{{X: 1, Y: 1}}, mobPathOptions(nil, 0))
+	manager.tickMobs()
+	assert.Equal(t, 1, manager.MobAI.paths.Floors(), "Floors someone is on are kept")
+
+	// Once everyone has left, the floor's maps are dropped
+	character.CurrentFloor = 2
+	manager.tickMobs()
+	assert.Equal(t, 0, manager.MobAI.paths.Floors())
+
+	manager.unregisterClient(client)
+}
@@ -0,0 +1,617 @@
+package game
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jchauncey/TheDeeps/server/log"
+	"github.com/jchauncey/TheDeeps/server/models"
+	"github.com/jchauncey/TheDeeps/server/repositories"
+)
+
+const (
+	defaultLootRollTimeout = 30 * time.Second // How long party members have to roll for an item
+	maxChatLength          = 500              // Longest party chat message, in characters
+)
+
+// LootChoice is a party member's roll for an item under the need/greed loot rule
+type LootChoice string
+
+const (
+	LootNeed  LootChoice = "need"  // Beats every greed roll
+	LootGreed LootChoice = "greed" // Wins only if nobody needs the item
+	LootPass  LootChoice = "pass"  // Doesn't want the item
+)
+
+// Errors returned by party actions
+var (
+	ErrLootReserved      = errors.New("that item is reserved for another party member")
+	ErrLootRolling       = errors.New("your party is still rolling for that item")
+	ErrNotRolling        = errors.New("nobody is rolling for that item")
+	ErrUnknownLootChoice = errors.New("choose need, greed or pass")
+	ErrEmptyChat         = errors.New("message is empty")
+	ErrKickSelf          = errors.New("leave the party instead of kicking yourself")
+)
+
+// PartyMember is what a character sees of a fellow party member
+type PartyMember struct {
+	ID        string                `json:"id"`
+	Name      string                `json:"name"`
+	Class     models.CharacterClass `json:"class"`
+	Level     int                   `json:"level"`
+	CurrentHP int                   `json:"currentHp"`
+	MaxHP     int                   `json:"maxHp"`
+	Floor     int                   `json:"floor"`
+	Position  *models.Position      `json:"position,omitempty"` // Only for members on the viewer's floor
+}
+
+// PartyView is a party as one of its members sees it
+type PartyView struct {
+	ID       string          `json:"id"`
+	LeaderID string          `json:"leaderId"`
+	LootRule models.LootRule `json:"lootRule"`
+	Members  []PartyMember   `json:"members"`
+	Invites  []string        `json:"invites"`
+}
+
+// lootRoll is a need/greed roll in progress for a dropped item
+type lootRoll struct {
+	itemID     string
+	itemName   string
+	dungeonID  string
+	floorLevel int
+	eligible   []string              // Members who may roll, in party order
+	choices    map[string]LootChoice // What each member chose
+	rolls      map[string]int        // Each need or greed roll, from 1 to 100
+	timer      *time.Timer
+}
+
+// PartyManager keeps track of parties, shares experience between their members
+// and hands out the loot from their kills.
+type PartyManager struct {
+	CharacterRepo repositories.CharacterStore
+	DungeonRepo   repositories.DungeonStore
+	RollTimeout   time.Duration
+
+	// Notify sends a message to a character's game connection
+	Notify func(characterID string, message Message)
+	// OnLootAssigned is called after a roll reserved an item on a floor
+	OnLootAssigned func(dungeonID string, floorLevel int)
+	// World is the game's world lock, held while a roll that timed out reserves its item
+	World *sync.Mutex
+
+	rng         *rand.Rand
+	parties     map[string]*models.Party
+	byCharacter map[string]string
+	rolls       map[string]*lootRoll
+	mutex       sync.Mutex
+}
+
+// NewPartyManager creates a new party manager
+func NewPartyManager(characterRepo repositories.CharacterStore, dungeonRepo repositories.DungeonStore) *PartyManager {
+	return &PartyManager{
+		CharacterRepo: characterRepo,
+		DungeonRepo:   dungeonRepo,
+		RollTimeout:   defaultLootRollTimeout,
+		rng:           rand.New(rand.NewSource(time.Now().UnixNano())),
+		parties:       make(map[string]*models.Party),
+		byCharacter:   make(map[string]string),
+		rolls:         make(map[string]*lootRoll),
+	}
+}
+
+// Get returns a copy of the party a character is in
+func (m *PartyManager) Get(characterID string) (models.Party, bool) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	party, exists := m.parties[m.byCharacter[characterID]]
+	if !exists {
+		return models.Party{}, false
+	}
+	return party.Copy(), true
+}
+
+// View returns the party a character is in as they see it
+func (m *PartyManager) View(characterID string) (PartyView, bool) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	party, exists := m.parties[m.byCharacter[characterID]]
+	if !exists {
+		return PartyView{}, false
+	}
+	return m.view(party, characterID), true
+}
+
+// Invite invites a character to the leader's party, starting a party if the leader isn't in one
+func (m *PartyManager) Invite(leaderID string, characterID string) (PartyView, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if leaderID == characterID {
+		return PartyView{}, models.ErrInviteSelf
+	}
+	if _, inParty := m.byCharacter[characterID]; inParty {
+		return PartyView{}, models.ErrAlreadyInParty
+	}
+	leader, err := m.CharacterRepo.GetByID(leaderID)
+	if err != nil {
+		return PartyView{}, err
+	}
+	if _, err := m.CharacterRepo.GetByID(characterID); err != nil {
+		return PartyView{}, err
+	}
+
+	party, exists := m.parties[m.byCharacter[leaderID]]
+	if !exists {
+		party = models.NewParty(leaderID)
+		m.parties[party.ID] = party
+		m.byCharacter[leaderID] = party.ID
+	}
+	if party.LeaderID != leaderID {
+		return PartyView{}, models.ErrNotPartyLeader
+	}
+	if err := party.Invite(characterID); err != nil {
+		return PartyView{}, err
+	}
+
+	m.notify(characterID, Message{
+		Type: MsgPartyInvite,
+		Text: leader.Name + " invited you to their party.",
+		Party: &PartyView{
+			ID:       party.ID,
+			LeaderID: party.LeaderID,
+			LootRule: party.LootRule,
+			Members:  m.members(party, characterID),
+			Invites:  append([]string(nil), party.Invites...),
+		},
+	})
+	m.notifyParty(party, "")
+	return m.view(party, leaderID), nil
+}
+
+// Accept joins a party the character was invited to
+func (m *PartyManager) Accept(characterID string, partyID string) (PartyView, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if _, inParty := m.byCharacter[characterID]; inParty {
+		return PartyView{}, models.ErrAlreadyInParty
+	}
+	party, exists := m.parties[partyID]
+	if !exists {
+		return PartyView{}, models.ErrNotInvited
+	}
+	if err := party.Join(characterID); err != nil {
+		return PartyView{}, err
+	}
+	m.byCharacter[characterID] = party.ID
+
+	m.notifyParty(party, m.name(characterID)+" joined the party.")
+	return m.view(party, characterID), nil
+}
+
+// Leave takes a character out of their party
+func (m *PartyManager) Leave(characterID string) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	party, exists := m.parties[m.byCharacter[characterID]]
+	if !exists {
+		return models.ErrNotInParty
+	}
+
+	m.remove(party, characterID, "You left the party.", m.name(characterID)+" left the party.")
+	return nil
+}
+
+// Kick has the leader remove a member or withdraw an invite
+func (m *PartyManager) Kick(leaderID string, characterID string) (PartyView, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	party, exists := m.parties[m.byCharacter[leaderID]]
+	if !exists {
+		return PartyView{}, models.ErrNotInParty
+	}
+	if party.LeaderID != leaderID {
+		return PartyView{}, models.ErrNotPartyLeader
+	}
+	if leaderID == characterID {
+		return PartyView{}, ErrKickSelf
+	}
+	if !party.IsMember(characterID) && !party.IsInvited(characterID) {
+		return PartyView{}, models.ErrNotInParty
+	}
+
+	m.remove(party, characterID, "You were removed from the party.", m.name(characterID)+" was removed from the party.")
+	if _, exists := m.parties[party.ID]; !exists {
+		return PartyView{}, nil
+	}
+	return m.view(party, leaderID), nil
+}
+
+// SetLootRule has the leader choose how the party's loot is shared
+func (m *PartyManager) SetLootRule(leaderID string, rule models.LootRule) (PartyView, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if !models.IsLootRule(rule) {
+		return PartyView{}, models.ErrUnknownLootRule
+	}
+	party, exists := m.parties[m.byCharacter[leaderID]]
+	if !exists {
+		return PartyView{}, models.ErrNotInParty
+	}
+	if party.LeaderID != leaderID {
+		return PartyView{}, models.ErrNotPartyLeader
+	}
+
+	party.LootRule = rule
+	m.notifyParty(party, fmt.Sprintf("Loot is now shared by %s.", rule))
+	return m.view(party, leaderID), nil
+}
+
+// Chat sends a message from a character to everyone in their party
+func (m *PartyManager) Chat(characterID string, text string) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	party, exists := m.parties[m.byCharacter[characterID]]
+	if !exists {
+		return models.ErrNotInParty
+	}
+	text = strings.TrimSpace(text)
+	if text == "" {
+		return ErrEmptyChat
+	}
+	if runes := []rune(text); len(runes) > maxChatLength {
+		text = string(runes[:maxChatLength])
+	}
+
+	from := m.name(characterID)
+	for _, member := range party.Members {
+		m.notify(member, Message{
+			Type:        MsgPartyChat,
+			CharacterID: characterID,
+			From:        from,
+			Text:        text,
+		})
+	}
+	return nil
+}
+
+// Update sends a character's party their latest view of it, such as after the character moved
+func (m *PartyManager) Update(characterID string) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if party, exists := m.parties[m.byCharacter[characterID]]; exists {
+		m.notifyParty(party, "")
+	}
+}
+
+// ShareExperience splits the experience for a kill between the killer and the party
+// members on their floor, in proportion to their level. It gives the other members
+// their share and returns the killer's.
+func (m *PartyManager) ShareExperience(killer *models.Character, exp int) int {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	party, exists := m.parties[m.byCharacter[killer.ID]]
+	if !exists {
+		return exp
+	}
+
+	characters := []*models.Character{killer}
+	for _, member := range party.Members {
+		if member == killer.ID {
+			continue
+		}
+		if character := m.nearby(killer, member); character != nil {
+			characters = append(characters, character)
+		}
+	}
+
+	shares := models.SplitExperience(exp, characters)
+	for i, character := range characters[1:] {
+		share := shares[i+1]
+		if share == 0 {
+			continue
+		}
+		text := fmt.Sprintf("You gain %d experience from %s's kill.", share, killer.Name)
+		if character.AddExperience(share) {
+			text += " Level up!"
+		}
+		if err := m.CharacterRepo.Save(character); err != nil {
+			log.Error("Failed to save character %s: %v", character.ID, err)
+		}
+		m.notify(character.ID, Message{Type: MsgUpdatePlayer, Character: character})
+		m.notify(character.ID, Message{Type: MsgNotification, Text: text})
+	}
+	return shares[0]
+}
+
+// DistributeLoot applies the killer's party loot rule to the items a kill dropped.
+// Round robin reserves each item for the next member on the floor; need/greed
+// starts a roll for each item among them.
+func (m *PartyManager) DistributeLoot(killer *models.Character, items []models.Item) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	party, exists := m.parties[m.byCharacter[killer.ID]]
+	if !exists || len(items) == 0 {
+		return
+	}
+
+	eligible := func(characterID string) bool {
+		return characterID == killer.ID || m.nearby(killer, characterID) != nil
+	}
+
+	switch party.LootRule {
+	case models.LootRoundRobin:
+		for i := range items {
+			items[i].ReservedFor = party.NextLooter(eligible)
+		}
+
+	case models.LootNeedGreed:
+		members := make([]string, 0, len(party.Members))
+		for _, member := range party.Members {
+			if eligible(member) {
+				members = append(members, member)
+			}
+		}
+		for i := range items {
+			// Nobody to roll against
+			if len(members) == 1 {
+				items[i].ReservedFor = killer.ID
+				continue
+			}
+			m.startRoll(killer, members, items[i])
+		}
+	}
+}
+
+// Roll records a party member's need, greed or pass for an item. The item goes to
+// the best roll once everyone has chosen.
+func (m *PartyManager) Roll(characterID string, itemID string, choice LootChoice) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	roll, exists := m.rolls[itemID]
+	if !exists || !containsID(roll.eligible, characterID) {
+		return ErrNotRolling
+	}
+	if _, chosen := roll.choices[characterID]; chosen {
+		return nil
+	}
+
+	switch choice {
+	case LootNeed, LootGreed:
+		roll.rolls[characterID] = m.rng.Intn(100) + 1
+	case LootPass:
+	default:
+		return ErrUnknownLootChoice
+	}
+	roll.choices[characterID] = choice
+
+	if len(roll.choices) == len(roll.eligible) {
+		m.resolveRoll(roll)
+	}
+	return nil
+}
+
+// CanPickUp checks that party loot rules let a character pick up an item. Items
+// reserved for someone who has since left their party are free for anyone.
+func (m *PartyManager) CanPickUp(characterID string, item models.Item) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if _, rolling := m.rolls[item.ID]; rolling {
+		return ErrLootRolling
+	}
+	if item.ReservedFor != "" && item.ReservedFor != characterID {
+		if _, inParty := m.byCharacter[item.ReservedFor]; inParty {
+			return ErrLootReserved
+		}
+	}
+	return nil
+}
+
+// startRoll opens a need/greed roll for an item and tells the members who can roll.
+// The caller must hold the manager's lock.
+func (m *PartyManager) startRoll(killer *models.Character, members []string, item models.Item) {
+	roll := &lootRoll{
+		itemID:     item.ID,
+		itemName:   item.Name,
+		dungeonID:  killer.CurrentDungeon,
+		floorLevel: killer.CurrentFloor,
+		eligible:   members,
+		choices:    make(map[string]LootChoice),
+		rolls:      make(map[string]int),
+	}
+	m.rolls[item.ID] = roll
+
+	// Members who don't roll in time pass
+	roll.timer = time.AfterFunc(m.RollTimeout, func() {
+		if m.World != nil {
+			m.World.Lock()
+			defer m.World.Unlock()
+		}
+		m.mutex.Lock()
+		defer m.mutex.Unlock()
+		if m.rolls[roll.itemID] == roll {
+			m.resolveRoll(roll)
+		}
+	})
+
+	for _, member := range members {
+		itemCopy := item
+		m.notify(member, Message{
+			Type: MsgLootRoll,
+			Text: fmt.Sprintf("Roll for %s: need, greed or pass?", item.Name),
+			Item: &itemCopy,
+		})
+	}
+}
+
+// resolveRoll gives the item to the highest need roll, or the highest greed roll if
+// nobody needed it, and reserves it on the floor. The caller must hold the manager's lock.
+func (m *PartyManager) resolveRoll(roll *lootRoll) {
+	roll.timer.Stop()
+	delete(m.rolls, roll.itemID)
+
+	winner := ""
+	for _, choice := range []LootChoice{LootNeed, LootGreed} {
+		for _, member := range roll.eligible {
+			if roll.choices[member] == choice && (winner == "" || roll.rolls[member] > roll.rolls[winner]) {
+				winner = member
+			}
+		}
+		if winner != "" {
+			break
+		}
+	}
+
+	text := fmt.Sprintf("Everyone passed on %s; anyone may take it.", roll.itemName)
+	if winner != "" {
+		text = fmt.Sprintf("%s wins %s with a %s roll of %d.", m.name(winner), roll.itemName, roll.choices[winner], roll.rolls[winner])
+
+		floor, err := m.DungeonRepo.GetFloor(roll.dungeonID, roll.floorLevel)
+		if err != nil {
+			log.Error("Failed to get floor for loot roll: %v", err)
+			return
+		}
+		if item, exists := floor.Items[roll.itemID]; exists {
+			item.ReservedFor = winner
+			floor.Items[roll.itemID] = item
+			floor.MarkItems(roll.itemID)
+			if err := m.DungeonRepo.SaveFloor(roll.dungeonID, roll.floorLevel, floor); err != nil {
+				log.Error("Failed to save floor %d of dungeon %s: %v", roll.floorLevel, roll.dungeonID, err)
+			}
+			if m.OnLootAssigned != nil {
+				m.OnLootAssigned(roll.dungeonID, roll.floorLevel)
+			}
+		}
+	}
+
+	for _, member := range roll.eligible {
+		m.notify(member, Message{Type: MsgNotification, Text: text})
+	}
+}
+
+// remove takes a character out of a party, telling them and the rest of the party.
+// A party left with a single member and no invites is disbanded. The caller must
+// hold the manager's lock.
+func (m *PartyManager) remove(party *models.Party, characterID string, toCharacter string, toParty string) {
+	wasMember := party.IsMember(characterID)
+	party.Remove(characterID)
+	if wasMember {
+		delete(m.byCharacter, characterID)
+		m.notify(characterID, Message{Type: MsgPartyUpdate, Text: toCharacter})
+	}
+
+	if len(party.Members) > 1 || len(party.Invites) > 0 {
+		m.notifyParty(party, toParty)
+		return
+	}
+
+	delete(m.parties, party.ID)
+	for _, member := range party.Members {
+		delete(m.byCharacter, member)
+		m.notify(member, Message{Type: MsgPartyUpdate, Text: strings.TrimSpace(toParty + " The party has disbanded.")})
+	}
+}
+
+// notifyParty sends every member their view of the party, with an optional notice.
+// The caller must hold the manager's lock.
+func (m *PartyManager) notifyParty(party *models.Party, text string) {
+	for _, member := range party.Members {
+		view := m.view(party, member)
+		m.notify(member, Message{Type: MsgPartyUpdate, Party: &view, Text: text})
+	}
+}
+
+// notify sends a message to a character if anyone is listening
+func (m *PartyManager) notify(characterID string, message Message) {
+	if m.Notify != nil {
+		m.Notify(characterID, message)
+	}
+}
+
+// view builds the party as a member sees it. The caller must hold the manager's lock.
+func (m *PartyManager) view(party *models.Party, viewerID string) PartyView {
+	return PartyView{
+		ID:       party.ID,
+		LeaderID: party.LeaderID,
+		LootRule: party.LootRule,
+		Members:  m.members(party, viewerID),
+		Invites:  append([]string(nil), party.Invites...),
+	}
+}
+
+// members describes a party's members, with positions for those on the viewer's floor
+func (m *PartyManager) members(party *models.Party, viewerID string) []PartyMember {
+	viewer, _ := m.CharacterRepo.GetByID(viewerID)
+
+	members := make([]PartyMember, 0, len(party.Members))
+	for _, id := range party.Members {
+		character, err := m.CharacterRepo.GetByID(id)
+		if err != nil {
+			continue
+		}
+
+		member := PartyMember{
+			ID:        character.ID,
+			Name:      character.Name,
+			Class:     character.Class,
+			Level:     character.Level,
+			CurrentHP: character.CurrentHP,
+			MaxHP:     character.MaxHP,
+			Floor:     character.CurrentFloor,
+		}
+		if viewer != nil && sameFloor(viewer, character) {
+			position := character.Position
+			member.Position = &position
+		}
+		members = append(members, member)
+	}
+	return members
+}
+
+// nearby returns a living party member on the same floor as the character, or nil
+func (m *PartyManager) nearby(character *models.Character, memberID string) *models.Character {
+	member, err := m.CharacterRepo.GetByID(memberID)
+	if err != nil || member.IsDead() || !sameFloor(character, member) {
+		return nil
+	}
+	return member
+}
+
+// name returns a character's name, or their ID if they can't be found
+func (m *PartyManager) name(characterID string) string {
+	if character, err := m.CharacterRepo.GetByID(characterID); err == nil {
+		return character.Name
+	}
+	return characterID
+}
+
+// sameFloor checks if two characters are on the same floor of the same dungeon
+func sameFloor(a, b *models.Character) bool {
+	return a.CurrentDungeon != "" && a.CurrentDungeon == b.CurrentDungeon && a.CurrentFloor == b.CurrentFloor
+}
+
+// containsID checks if ids contains id
+func containsID(ids []string, id string) bool {
+	for _, other := range ids {
+		if other == id {
+			return true
+		}
+	}
+	return false
+}
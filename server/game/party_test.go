@@ -0,0 +1,328 @@
+package game
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jchauncey/TheDeeps/server/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// partyMessages records the messages a party manager sends to each character
+type partyMessages struct {
+	messages map[string][]Message
+	mutex    sync.Mutex
+}
+
+func (p *partyMessages) notify(characterID string, message Message) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.messages[characterID] = append(p.messages[characterID], message)
+}
+
+// ofType returns the messages of a type a character got
+func (p *partyMessages) ofType(characterID string, messageType MessageType) []Message {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	messages := make([]Message, 0)
+	for _, message := range p.messages[characterID] {
+		if message.Type == messageType {
+			messages = append(messages, message)
+		}
+	}
+	return messages
+}
+
+// newTestParties creates a party manager for a test world, recording the messages it sends
+func newTestParties(world *testWorld) (*PartyManager, *partyMessages) {
+	messages := &partyMessages{messages: make(map[string][]Message)}
+	manager := NewPartyManager(world.characterRepo, world.dungeonRepo)
+	manager.Notify = messages.notify
+	return manager, messages
+}
+
+// formParty has the first character invite the rest, who all accept
+func formParty(t *testing.T, manager *PartyManager, characters []*models.Character) string {
+	partyID := ""
+	for _, character := range characters[1:] {
+		view, err := manager.Invite(characters[0].ID, character.ID)
+		require.NoError(t, err)
+		partyID = view.ID
+		_, err = manager.Accept(character.ID, partyID)
+		require.NoError(t, err)
+	}
+	return partyID
+}
+
+func TestPartyInviteAcceptLeave(t *testing.T) {
+	world := newTestWorld(t, 10, 10)
+	manager, messages := newTestParties(world)
+	characters := []*models.Character{
+		world.addCharacter(t, "Leader", 2, 2),
+		world.addCharacter(t, "Friend", 3, 2),
+		world.addCharacter(t, "Other", 4, 2),
+	}
+	leader, friend, other := characters[0], characters[1], characters[2]
+
+	view, err := manager.Invite(leader.ID, friend.ID)
+	require.NoError(t, err)
+	assert.Equal(t, leader.ID, view.LeaderID)
+	assert.Equal(t, []string{friend.ID}, view.Invites)
+
+	invites := messages.ofType(friend.ID, MsgPartyInvite)
+	require.Len(t, invites, 1)
+	assert.Equal(t, view.ID, invites[0].Party.ID)
+
+	// Only invited characters can join, and only the leader can invite
+	_, err = manager.Accept(other.ID, view.ID)
+	assert.ErrorIs(t, err, models.ErrNotInvited)
+	_, err = manager.Accept(friend.ID, view.ID)
+	require.NoError(t, err)
+	_, err = manager.Invite(friend.ID, other.ID)
+	assert.ErrorIs(t, err, models.ErrNotPartyLeader)
+	_, err = manager.Invite(leader.ID, leader.ID)
+	assert.ErrorIs(t, err, models.ErrInviteSelf)
+
+	party, exists := manager.Get(friend.ID)
+	require.True(t, exists)
+	assert.Equal(t, []string{leader.ID, friend.ID}, party.Members)
+
+	// Members on the same floor see each other's positions
+	update := messages.ofType(leader.ID, MsgPartyUpdate)
+	require.NotEmpty(t, update)
+	members := update[len(update)-1].Party.Members
+	require.Len(t, members, 2)
+	require.NotNil(t, members[1].Position)
+	assert.Equal(t, friend.Position, *members[1].Position)
+
+	// The leader leaving a party of two disbands it
+	require.NoError(t, manager.Leave(leader.ID))
+	_, exists = manager.Get(friend.ID)
+	assert.False(t, exists)
+	assert.ErrorIs(t, manager.Leave(leader.ID), models.ErrNotInParty)
+}
+
+func TestPartyKickAndLootRule(t *testing.T) {
+	world := newTestWorld(t, 10, 10)
+	manager, _ := newTestParties(world)
+	characters := []*models.Character{
+		world.addCharacter(t, "Leader", 2, 2),
+		world.addCharacter(t, "Friend", 3, 2),
+		world.addCharacter(t, "Other", 4, 2),
+	}
+	leader, friend, other := characters[0], characters[1], characters[2]
+	formParty(t, manager, characters)
+
+	_, err := manager.Kick(friend.ID, other.ID)
+	assert.ErrorIs(t, err, models.ErrNotPartyLeader)
+	_, err = manager.Kick(leader.ID, leader.ID)
+	assert.ErrorIs(t, err, ErrKickSelf)
+
+	view, err := manager.Kick(leader.ID, other.ID)
+	require.NoError(t, err)
+	assert.Len(t, view.Members, 2)
+	_, exists := manager.Get(other.ID)
+	assert.False(t, exists)
+
+	_, err = manager.SetLootRule(friend.ID, models.LootRoundRobin)
+	assert.ErrorIs(t, err, models.ErrNotPartyLeader)
+	_, err = manager.SetLootRule(leader.ID, "finders keepers")
+	assert.ErrorIs(t, err, models.ErrUnknownLootRule)
+	view, err = manager.SetLootRule(leader.ID, models.LootRoundRobin)
+	require.NoError(t, err)
+	assert.Equal(t, models.LootRoundRobin, view.LootRule)
+}
+
+func TestPartyChat(t *testing.T) {
+	world := newTestWorld(t, 10, 10)
+	manager, messages := newTestParties(world)
+	characters := []*models.Character{
+		world.addCharacter(t, "Leader", 2, 2),
+		world.addCharacter(t, "Friend", 3, 2),
+		world.addCharacter(t, "Other", 4, 2),
+	}
+	formParty(t, manager, characters[:2])
+
+	assert.ErrorIs(t, manager.Chat(characters[2].ID, "hello?"), models.ErrNotInParty)
+	assert.ErrorIs(t, manager.Chat(characters[0].ID, "   "), ErrEmptyChat)
+
+	require.NoError(t, manager.Chat(characters[0].ID, " Watch out! "))
+	for _, member := range characters[:2] {
+		chat := messages.ofType(member.ID, MsgPartyChat)
+		require.Len(t, chat, 1)
+		assert.Equal(t, "Watch out!", chat[0].Text)
+		assert.Equal(t, "Leader", chat[0].From)
+		assert.Equal(t, characters[0].ID, chat[0].CharacterID)
+	}
+	assert.Empty(t, messages.ofType(characters[2].ID, MsgPartyChat))
+}
+
+func TestPartyShareExperience(t *testing.T) {
+	world := newTestWorld(t, 10, 10)
+	manager, _ := newTestParties(world)
+	characters := []*models.Character{
+		world.addCharacter(t, "Leader", 2, 2),
+		world.addCharacter(t, "Friend", 3, 2),
+		world.addCharacter(t, "Other", 4, 2),
+	}
+	leader, friend, away := characters[0], characters[1], characters[2]
+	formParty(t, manager, characters)
+
+	// Members on other floors don't share
+	away.CurrentFloor = 2
+	friend.Level = 3
+
+	share := manager.ShareExperience(leader, 100)
+	assert.Equal(t, 25, share)
+	assert.Equal(t, 75, friend.Experience)
+	assert.Zero(t, away.Experience)
+
+	// Characters outside a party keep everything
+	solo := models.NewCharacter("Solo", models.Rogue)
+	assert.Equal(t, 100, manager.ShareExperience(solo, 100))
+}
+
+func TestPartyRoundRobinLoot(t *testing.T) {
+	world := newTestWorld(t, 10, 10)
+	manager, _ := newTestParties(world)
+	characters := []*models.Character{
+		world.addCharacter(t, "Leader", 2, 2),
+		world.addCharacter(t, "Friend", 3, 2),
+		world.addCharacter(t, "Other", 4, 2),
+	}
+	leader, friend := characters[0], characters[1]
+	formParty(t, manager, characters[:2])
+	_, err := manager.SetLootRule(leader.ID, models.LootRoundRobin)
+	require.NoError(t, err)
+
+	items := []models.Item{
+		*models.NewPotion("Health Potion", 10, 5),
+		*models.NewPotion("Health Potion", 10, 5),
+		*models.NewPotion("Health Potion", 10, 5),
+	}
+	manager.DistributeLoot(friend, items)
+	assert.Equal(t, leader.ID, items[0].ReservedFor)
+	assert.Equal(t, friend.ID, items[1].ReservedFor)
+	assert.Equal(t, leader.ID, items[2].ReservedFor)
+
+	assert.NoError(t, manager.CanPickUp(leader.ID, items[0]))
+	assert.ErrorIs(t, manager.CanPickUp(friend.ID, items[0]), ErrLootReserved)
+
+	// Reservations lapse once the member leaves the party
+	require.NoError(t, manager.Leave(leader.ID))
+	assert.NoError(t, manager.CanPickUp(friend.ID, items[0]))
+}
+
+func TestPartyNeedGreedLoot(t *testing.T) {
+	world := newTestWorld(t, 10, 10)
+	floor := world.floor
+	manager, messages := newTestParties(world)
+	characters := []*models.Character{
+		world.addCharacter(t, "Leader", 2, 2),
+		world.addCharacter(t, "Friend", 3, 2),
+		world.addCharacter(t, "Other", 4, 2),
+	}
+	leader, friend, other := characters[0], characters[1], characters[2]
+	formParty(t, manager, characters)
+	_, err := manager.SetLootRule(leader.ID, models.LootNeedGreed)
+	require.NoError(t, err)
+
+	items := []models.Item{*models.NewPotion("Health Potion", 10, 5)}
+	manager.DistributeLoot(leader, items)
+	DropItems(floor, models.Position{X: 5, Y: 5}, items)
+
+	rolls := messages.ofType(friend.ID, MsgLootRoll)
+	require.Len(t, rolls, 1)
+	assert.Equal(t, items[0].ID, rolls[0].Item.ID)
+	assert.ErrorIs(t, manager.CanPickUp(leader.ID, items[0]), ErrLootRolling)
+
+	// Need beats greed, whatever the dice say
+	assert.ErrorIs(t, manager.Roll(leader.ID, items[0].ID, "mine!"), ErrUnknownLootChoice)
+	require.NoError(t, manager.Roll(leader.ID, items[0].ID, LootGreed))
+	require.NoError(t, manager.Roll(friend.ID, items[0].ID, LootNeed))
+	require.NoError(t, manager.Roll(other.ID, items[0].ID, LootPass))
+
+	assert.Equal(t, friend.ID, floor.Items[items[0].ID].ReservedFor)
+	assert.NoError(t, manager.CanPickUp(friend.ID, floor.Items[items[0].ID]))
+	assert.ErrorIs(t, manager.Roll(leader.ID, items[0].ID, LootNeed), ErrNotRolling)
+}
+
+func TestPartyNeedGreedTimeout(t *testing.T) {
+	world := newTestWorld(t, 10, 10)
+	floor := world.floor
+	manager, _ := newTestParties(world)
+	characters := []*models.Character{
+		world.addCharacter(t, "Leader", 2, 2),
+		world.addCharacter(t, "Friend", 3, 2),
+		world.addCharacter(t, "Other", 4, 2),
+	}
+	leader, friend := characters[0], characters[1]
+	formParty(t, manager, characters[:2])
+	_, err := manager.SetLootRule(leader.ID, models.LootNeedGreed)
+	require.NoError(t, err)
+	manager.RollTimeout = 10 * time.Millisecond
+
+	assigned := make(chan int, 1)
+	manager.OnLootAssigned = func(dungeonID string, floorLevel int) {
+		assigned <- floorLevel
+	}
+
+	items := []models.Item{*models.NewPotion("Health Potion", 10, 5)}
+	manager.DistributeLoot(leader, items)
+	DropItems(floor, models.Position{X: 5, Y: 5}, items)
+
+	// The friend never rolls, so the leader's greed wins when time runs out
+	require.NoError(t, manager.Roll(leader.ID, items[0].ID, LootGreed))
+	select {
+	case level := <-assigned:
+		assert.Equal(t, 1, level)
+	case <-time.After(time.Second):
+		t.Fatal("The roll should resolve when it times out")
+	}
+	assert.Equal(t, leader.ID, floor.Items[items[0].ID].ReservedFor)
+	assert.ErrorIs(t, manager.CanPickUp(friend.ID, floor.Items[items[0].ID]), ErrLootReserved)
+}
+
+func TestHandlePickupRespectsPartyLoot(t *testing.T) {
+	manager, client, floor, dungeonID := newTestManager(t)
+
+	friend := models.NewCharacter("Friend", models.Mage)
+	friend.CurrentDungeon = dungeonID
+	friend.CurrentFloor = 1
+	require.NoError(t, manager.CharacterRepo.Save(friend))
+
+	_, err := manager.Parties.Invite(client.Character.ID, friend.ID)
+	require.NoError(t, err)
+	_, err = manager.Parties.Accept(friend.ID, "missing")
+	require.ErrorIs(t, err, models.ErrNotInvited)
+	party, _ := manager.Parties.Get(client.Character.ID)
+	_, err = manager.Parties.Accept(friend.ID, party.ID)
+	require.NoError(t, err)
+
+	// An item reserved for the friend stays where it is
+	item := addItem(floor, client.Character.Position.X, client.Character.Position.Y)
+	item.ReservedFor = friend.ID
+	floor.Items[item.ID] = item
+	drainMessages(client)
+
+	manager.handlePickup(client, Message{Type: MsgPickup, ItemID: item.ID})
+	messages := drainMessages(client)
+	require.NotEmpty(t, messages)
+	assert.Equal(t, MsgError, messages[0].Type)
+	assert.Contains(t, messages[0].Error, ErrLootReserved.Error())
+	assert.Contains(t, floor.Items, item.ID)
+
+	// Party chat comes back over the game connection
+	manager.Clients[client.ID] = client
+	manager.CharacterToClient[client.Character.ID] = client.ID
+	manager.HandleMessage(client, Message{Type: MsgPartyChat, Text: "That one's yours"})
+	manager.HandleMessage(client, Message{Type: MsgLootRoll, ItemID: item.ID, Choice: LootNeed})
+	messages = drainMessages(client)
+	require.Len(t, messages, 2)
+	assert.Equal(t, MsgPartyChat, messages[0].Type)
+	assert.Equal(t, "That one's yours", messages[0].Text)
+	assert.Equal(t, MsgError, messages[1].Type)
+	assert.Equal(t, "Nobody is rolling for that item", messages[1].Error)
+}
@@ -0,0 +1,119 @@
+package game
+
+import (
+	"fmt"
+
+	"github.com/jchauncey/TheDeeps/server/models"
+)
+
+// PuzzleResult describes what pulling a lever or stepping on a pressure plate did
+type PuzzleResult struct {
+	Puzzle     *models.Puzzle `json:"puzzle"`
+	Solved     bool           `json:"solved,omitempty"`     // This action solved the puzzle
+	Experience int            `json:"experience,omitempty"` // Experience the character gained for solving it
+	Message    string         `json:"message"`
+}
+
+// PullLever has a character pull one of a puzzle's levers, opening the
+// reward alcove if that solves the puzzle
+func PullLever(floor *models.Floor, puzzle *models.Puzzle, index int, character *models.Character) PuzzleResult {
+	if puzzle.Solved {
+		return PuzzleResult{Puzzle: puzzleView(puzzle), Message: "The lever won't budge."}
+	}
+
+	puzzle.PullLever(index)
+	for _, lever := range puzzle.Levers {
+		floor.MarkTiles(lever.Position)
+	}
+
+	result := PuzzleResult{Message: "You pull the lever. Somewhere, gears turn."}
+	if puzzle.IsSolved() {
+		solvePuzzle(floor, puzzle, character, &result)
+	}
+	result.Puzzle = puzzleView(puzzle)
+	return result
+}
+
+// StepOnPlate presses the pressure plate under a character, if there is one,
+// opening the reward alcove if that solves its puzzle
+func StepOnPlate(floor *models.Floor, character *models.Character) (PuzzleResult, bool) {
+	puzzle, exists := puzzleAt(floor, character.Position)
+	if !exists || puzzle.Solved {
+		return PuzzleResult{}, false
+	}
+	index, exists := puzzle.PlateAt(character.Position)
+	if !exists || puzzle.Plates[index].Pressed {
+		return PuzzleResult{}, false
+	}
+
+	result := PuzzleResult{Message: "A pressure plate clicks down."}
+	if !puzzle.PressPlate(index) {
+		result.Message = "The pressure plates clatter back up."
+	}
+	for _, plate := range puzzle.Plates {
+		floor.MarkTiles(plate.Position)
+	}
+
+	if puzzle.IsSolved() {
+		solvePuzzle(floor, puzzle, character, &result)
+	}
+	result.Puzzle = puzzleView(puzzle)
+	return result, true
+}
+
+// solvePuzzle unseals a solved puzzle's alcove and rewards the character who solved it
+func solvePuzzle(floor *models.Floor, puzzle *models.Puzzle, character *models.Character, result *PuzzleResult) {
+	puzzle.Solved = true
+	if door, exists := floor.Doors[puzzle.DoorID]; exists {
+		door.Sealed = false
+		door.Open = true
+		floor.Tiles[door.Position.Y][door.Position.X].Walkable = true
+		floor.MarkTiles(door.Position)
+	}
+
+	exp := puzzle.Experience()
+	character.AddExperience(exp)
+	result.Solved = true
+	result.Experience = exp
+	result.Message += fmt.Sprintf(" With a grinding of stone, a sealed door slides open. You gain %d experience.", exp)
+}
+
+// puzzleAt returns the puzzle a lever or pressure plate on a tile belongs to
+func puzzleAt(floor *models.Floor, pos models.Position) (*models.Puzzle, bool) {
+	if !hasTile(floor, pos) {
+		return nil, false
+	}
+	puzzle, exists := floor.Puzzles[floor.Tiles[pos.Y][pos.X].PuzzleID]
+	return puzzle, exists
+}
+
+// findLever finds the puzzle and index of the lever with the given ID
+func findLever(floor *models.Floor, leverID string) (*models.Puzzle, int, bool) {
+	for _, puzzle := range floor.Puzzles {
+		for i, lever := range puzzle.Levers {
+			if lever.ID == leverID {
+				return puzzle, i, true
+			}
+		}
+	}
+	return nil, 0, false
+}
+
+// puzzleView returns a puzzle as players see it, without the lever links or
+// plate sequence that give away the solution
+func puzzleView(puzzle *models.Puzzle) *models.Puzzle {
+	view := *puzzle
+	view.Sequence = nil
+	view.Levers = make([]*models.Lever, len(puzzle.Levers))
+	for i, lever := range puzzle.Levers {
+		leverView := *lever
+		leverView.Links = nil
+		view.Levers[i] = &leverView
+	}
+	view.Plates = make([]*models.PressurePlate, len(puzzle.Plates))
+	for i, plate := range puzzle.Plates {
+		plateView := *plate
+		view.Plates[i] = &plateView
+	}
+	return &view
+}
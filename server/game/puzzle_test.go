@@ -0,0 +1,189 @@
+package game
+
+import (
+	"testing"
+
+	"github.com/jchauncey/TheDeeps/server/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newPuzzleFloor generates a puzzle in a 9x9 room from a seed
+func newPuzzleFloor(t *testing.T, seed int64) (*models.Floor, *models.Puzzle) {
+	floor := newOpenFloor(20, 20)
+	floor.Doors = make(map[string]*models.Door)
+	floor.Chests = make(map[string]*models.Chest)
+	floor.Puzzles = make(map[string]*models.Puzzle)
+
+	// Wall off everything but the room
+	room := models.Room{ID: "puzzle", Type: models.RoomPuzzle, X: 5, Y: 5, Width: 9, Height: 9}
+	for y := range floor.Tiles {
+		for x := range floor.Tiles[y] {
+			if !inRoom(room, models.Position{X: x, Y: y}) {
+				floor.Tiles[y][x] = models.Tile{Type: models.TileWall}
+			} else {
+				floor.Tiles[y][x].RoomID = room.ID
+			}
+		}
+	}
+	floor.Rooms = []models.Room{room}
+
+	require.True(t, NewMapGenerator(seed).placePuzzle(floor, room, 3))
+	require.Len(t, floor.Puzzles, 1)
+	for _, puzzle := range floor.Puzzles {
+		return floor, puzzle
+	}
+	return nil, nil
+}
+
+// puzzleSeed finds the first seed that generates a puzzle of the given kind
+func puzzleSeed(t *testing.T, kind models.PuzzleKind) int64 {
+	for seed := int64(1); seed < 100; seed++ {
+		if _, puzzle := newPuzzleFloor(t, seed); puzzle.Kind == kind {
+			return seed
+		}
+	}
+	t.Fatalf("No seed generates a %s puzzle", kind)
+	return 0
+}
+
+// leverSolution finds which levers to pull to solve a lever puzzle
+func leverSolution(puzzle *models.Puzzle) []int {
+	for mask := 0; mask < 1<<len(puzzle.Levers); mask++ {
+		up := make([]bool, len(puzzle.Levers))
+		for i, lever := range puzzle.Levers {
+			up[i] = lever.Up
+		}
+
+		pulls := make([]int, 0)
+		for i, lever := range puzzle.Levers {
+			if mask&(1<<i) == 0 {
+				continue
+			}
+			pulls = append(pulls, i)
+			up[i] = !up[i]
+			for _, link := range lever.Links {
+				up[link] = !up[link]
+			}
+		}
+
+		solved := true
+		for _, u := range up {
+			solved = solved && u
+		}
+		if solved {
+			return pulls
+		}
+	}
+	return nil
+}
+
+func TestPuzzleGenerationIsDeterministic(t *testing.T) {
+	floor, puzzle := newPuzzleFloor(t, 42)
+	again, repeat := newPuzzleFloor(t, 42)
+	assert.Equal(t, puzzle, repeat, "The same seed should set up the same puzzle")
+	assert.Equal(t, floor.Tiles, again.Tiles)
+
+	assert.False(t, puzzle.Solved)
+	assert.False(t, puzzle.IsSolved(), "Puzzles start unsolved")
+	door := floor.Doors[puzzle.DoorID]
+	require.NotNil(t, door)
+	assert.True(t, door.Sealed)
+	assert.False(t, floor.Tiles[door.Position.Y][door.Position.X].Walkable)
+	require.Len(t, floor.Chests, 1, "The alcove holds a chest")
+	for _, chest := range floor.Chests {
+		assert.Equal(t, 1, chebyshevDistance(chest.Position, door.Position))
+	}
+
+	// The rest of the room can still be walked through
+	reachable := make(map[models.Position]bool)
+	for _, pos := range reachableTiles(floor, models.Position{X: 9, Y: 9}) {
+		reachable[pos] = true
+	}
+	for _, plate := range puzzle.Plates {
+		assert.True(t, reachable[plate.Position])
+	}
+	for _, lever := range puzzle.Levers {
+		near := false
+		for _, pos := range []models.Position{{X: 1}, {X: -1}, {Y: 1}, {Y: -1}} {
+			near = near || reachable[models.Position{X: lever.Position.X + pos.X, Y: lever.Position.Y + pos.Y}]
+		}
+		assert.True(t, near, "Levers should be reachable")
+	}
+}
+
+func TestSolveLeverPuzzle(t *testing.T) {
+	floor, puzzle := newPuzzleFloor(t, puzzleSeed(t, models.PuzzleLevers))
+	door := floor.Doors[puzzle.DoorID]
+	character := models.NewCharacter("Solver", models.Mage)
+
+	// The alcove stays sealed until the puzzle is solved
+	character.Position = door.Position
+	_, err := Interact(floor, character, door.ID, nil)
+	assert.ErrorIs(t, err, ErrDoorSealed)
+
+	pulls := leverSolution(puzzle)
+	require.NotEmpty(t, pulls, "Generated lever puzzles should be solvable")
+
+	var result PuzzleResult
+	for _, index := range pulls {
+		result = PullLever(floor, puzzle, index, character)
+	}
+	assert.True(t, result.Solved)
+	assert.Equal(t, puzzle.Experience(), result.Experience)
+	assert.Equal(t, puzzle.Experience(), character.Experience)
+	assert.Contains(t, result.Message, "a sealed door slides open")
+	assert.True(t, door.Open)
+	assert.False(t, door.Sealed)
+	assert.True(t, floor.Tiles[door.Position.Y][door.Position.X].Walkable)
+	for _, lever := range result.Puzzle.Levers {
+		assert.Empty(t, lever.Links, "Players shouldn't see how the levers are linked")
+	}
+
+	// Solved puzzles stay solved
+	result = PullLever(floor, puzzle, 0, character)
+	assert.Equal(t, "The lever won't budge.", result.Message)
+	assert.True(t, puzzle.IsSolved())
+}
+
+func TestSolvePlatePuzzle(t *testing.T) {
+	floor, puzzle := newPuzzleFloor(t, puzzleSeed(t, models.PuzzlePlates))
+	door := floor.Doors[puzzle.DoorID]
+	character := models.NewCharacter("Solver", models.Mage)
+
+	// Stepping on the wrong plate first lets it back up
+	character.Position = puzzle.Plates[puzzle.Sequence[len(puzzle.Sequence)-1]].Position
+	result, pressed := StepOnPlate(floor, character)
+	require.True(t, pressed)
+	assert.Equal(t, "The pressure plates clatter back up.", result.Message)
+	assert.Empty(t, result.Puzzle.Sequence, "Players shouldn't see the sequence")
+
+	for _, index := range puzzle.Sequence {
+		character.Position = puzzle.Plates[index].Position
+		result, pressed = StepOnPlate(floor, character)
+		require.True(t, pressed)
+	}
+	assert.True(t, result.Solved)
+	assert.True(t, door.Open)
+
+	// Plates do nothing once the puzzle is solved
+	_, pressed = StepOnPlate(floor, character)
+	assert.False(t, pressed)
+}
+
+func TestHandleInteractLever(t *testing.T) {
+	manager, client, floor, _ := newTestManager(t)
+	puzzle := models.NewPuzzle(models.PuzzleLevers, "room", 1)
+	puzzle.Levers = []*models.Lever{{ID: "lever", Position: models.Position{X: 6, Y: 10}}}
+	floor.Puzzles = map[string]*models.Puzzle{puzzle.ID: puzzle}
+	floor.Tiles[10][6] = models.Tile{Type: models.TileLever, PuzzleID: puzzle.ID}
+
+	manager.HandleMessage(client, Message{Type: MsgInteract, TargetID: "lever"})
+	msg := <-client.Send
+	require.Equal(t, MsgNotification, msg.Type, msg.Error)
+	require.NotNil(t, msg.Interaction)
+	require.NotNil(t, msg.Interaction.Puzzle)
+	assert.True(t, msg.Interaction.Puzzle.Solved)
+	assert.True(t, puzzle.Levers[0].Up)
+	assert.Equal(t, puzzle.Experience(), client.Character.Experience)
+}
@@ -0,0 +1,319 @@
+package game
+
+import (
+	"errors"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/jchauncey/TheDeeps/server/log"
+	"github.com/jchauncey/TheDeeps/server/models"
+	"github.com/jchauncey/TheDeeps/server/repositories"
+)
+
+// defaultRestockInterval is how long a shop sells the same stock
+const defaultRestockInterval = 10 * time.Minute
+
+// Errors returned by shop actions
+var (
+	ErrNotInShop    = errors.New("you aren't in a shop")
+	ErrNoShopkeeper = errors.New("there is nobody here to trade with")
+)
+
+// ShopItem is a stocked item and what the viewer would pay for it
+type ShopItem struct {
+	Item  *models.Item `json:"item"`
+	Price int          `json:"price"`
+}
+
+// ShopView is a shop as one character sees it
+type ShopView struct {
+	RoomID      string     `json:"roomId"`
+	Stock       []ShopItem `json:"stock"`
+	Discount    int        `json:"discount"`    // Percent off the viewer's prices
+	CanHaggle   bool       `json:"canHaggle"`   // The viewer hasn't haggled since the last restock
+	SellPercent int        `json:"sellPercent"` // Share of an item's value the shopkeeper pays for it
+	RestocksAt  time.Time  `json:"restocksAt"`
+}
+
+// Trade is the result of buying or selling an item
+type Trade struct {
+	Item  *models.Item `json:"item"`
+	Price int          `json:"price"`
+	Gold  int          `json:"gold"` // The character's gold after the trade
+	Shop  ShopView     `json:"shop"`
+}
+
+// ShopManager runs the shops on every floor, stocking them from the loot
+// catalog and restocking them once RestockInterval has passed. Trades change
+// floors and characters, so the exported methods take the World lock; the game
+// socket, which already holds it, uses the unexported ones.
+type ShopManager struct {
+	CharacterRepo   repositories.CharacterStore
+	DungeonRepo     repositories.DungeonStore
+	RestockInterval time.Duration
+	World           *sync.Mutex // The game's world lock
+
+	// Notify sends a message to a character's game connection
+	Notify func(characterID string, message Message)
+
+	rng   *rand.Rand
+	mutex sync.Mutex
+}
+
+// NewShopManager creates a new shop manager
+func NewShopManager(characterRepo repositories.CharacterStore, dungeonRepo repositories.DungeonStore) *ShopManager {
+	return &ShopManager{
+		CharacterRepo:   characterRepo,
+		DungeonRepo:     dungeonRepo,
+		RestockInterval: defaultRestockInterval,
+		World:           &sync.Mutex{},
+		rng:             rand.New(rand.NewSource(time.Now().UnixNano())),
+	}
+}
+
+// View returns the shop the character is standing in
+func (m *ShopManager) View(character *models.Character) (ShopView, error) {
+	m.World.Lock()
+	defer m.World.Unlock()
+
+	return m.viewShop(character)
+}
+
+// Buy buys an item from the shop the character is standing in
+func (m *ShopManager) Buy(character *models.Character, itemID string) (Trade, error) {
+	m.World.Lock()
+	defer m.World.Unlock()
+
+	return m.buy(character, itemID)
+}
+
+// Sell sells an item from the character's inventory to the shop they are standing in.
+// The shopkeeper pays SellBackPercent of its value and stocks it until the next restock.
+func (m *ShopManager) Sell(character *models.Character, itemID string) (Trade, error) {
+	m.World.Lock()
+	defer m.World.Unlock()
+
+	return m.sell(character, itemID)
+}
+
+// Haggle has the character try to talk down the prices of the shop they are standing in
+func (m *ShopManager) Haggle(character *models.Character) (bool, ShopView, error) {
+	m.World.Lock()
+	defer m.World.Unlock()
+
+	return m.haggle(character)
+}
+
+// viewShop returns the shop the character is standing in. The caller must hold the world lock.
+func (m *ShopManager) viewShop(character *models.Character) (ShopView, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	_, shop, err := m.shop(character)
+	if err != nil {
+		return ShopView{}, err
+	}
+	return m.view(shop, character.ID), nil
+}
+
+// buy buys an item for a character. The caller must hold the world lock.
+func (m *ShopManager) buy(character *models.Character, itemID string) (Trade, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	floor, shop, err := m.shop(character)
+	if err != nil {
+		return Trade{}, err
+	}
+
+	item, exists := shop.Find(itemID)
+	if !exists {
+		return Trade{}, models.ErrNotInStock
+	}
+	price := shop.BuyPrice(item, character.ID)
+	if character.Gold < price {
+		return Trade{}, models.ErrNotEnoughGold
+	}
+	if !character.CanAddItem(item) {
+		return Trade{}, models.ErrTooHeavy
+	}
+
+	shop.Take(itemID)
+	character.AddToInventory(item)
+	character.Gold -= price
+
+	m.save(character, floor)
+	m.notifyShoppers(floor, shop, character.ID)
+	return Trade{Item: item, Price: price, Gold: character.Gold, Shop: m.view(shop, character.ID)}, nil
+}
+
+// sell sells an item for a character. The caller must hold the world lock.
+func (m *ShopManager) sell(character *models.Character, itemID string) (Trade, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	floor, shop, err := m.shop(character)
+	if err != nil {
+		return Trade{}, err
+	}
+
+	item, exists := character.GetInventoryItem(itemID)
+	if !exists {
+		return Trade{}, models.ErrNotInInventory
+	}
+	if item.Equipped {
+		return Trade{}, models.ErrItemEquipped
+	}
+	price := models.SellPrice(item)
+	if price < 1 {
+		return Trade{}, models.ErrWorthlessItem
+	}
+
+	character.RemoveFromInventory(itemID)
+	character.Gold += price
+	shop.Add(item)
+
+	m.save(character, floor)
+	m.notifyShoppers(floor, shop, character.ID)
+	return Trade{Item: item, Price: price, Gold: character.Gold, Shop: m.view(shop, character.ID)}, nil
+}
+
+// haggle has a character try for a discount. The caller must hold the world lock.
+func (m *ShopManager) haggle(character *models.Character) (bool, ShopView, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	floor, shop, err := m.shop(character)
+	if err != nil {
+		return false, ShopView{}, err
+	}
+
+	success, err := shop.Haggle(character)
+	if err != nil {
+		return false, ShopView{}, err
+	}
+
+	// The check trains Persuasion
+	m.save(character, floor)
+	return success, m.view(shop, character.ID), nil
+}
+
+// shop returns the floor and shop the character is standing in, stocking
+// the shop if it is new or due a restock
+func (m *ShopManager) shop(character *models.Character) (*models.Floor, *models.Shop, error) {
+	if character.CurrentDungeon == "" {
+		return nil, nil, ErrNotInShop
+	}
+	floor, err := m.DungeonRepo.GetFloor(character.CurrentDungeon, character.CurrentFloor)
+	if err != nil || !hasTile(floor, character.Position) {
+		return nil, nil, ErrNotInShop
+	}
+
+	room, exists := shopRoom(floor, floor.Tiles[character.Position.Y][character.Position.X].RoomID)
+	if !exists {
+		return nil, nil, ErrNotInShop
+	}
+	if !hasShopkeeper(floor, room) {
+		return nil, nil, ErrNoShopkeeper
+	}
+
+	if floor.Shops == nil {
+		floor.Shops = make(map[string]*models.Shop)
+	}
+	shop, exists := floor.Shops[room.ID]
+	if !exists {
+		shop = models.NewShop(room.ID, floor.Level)
+		floor.Shops[room.ID] = shop
+	}
+
+	now := time.Now()
+	if shop.RestockedAt.IsZero() || now.Sub(shop.RestockedAt) >= m.RestockInterval {
+		shop.Restock(models.Loot().RollShop(m.rng, shop.Level), now)
+		if err := m.DungeonRepo.SaveFloor(character.CurrentDungeon, character.CurrentFloor, floor); err != nil {
+			log.Error("Failed to save floor %d of dungeon %s: %v", character.CurrentFloor, character.CurrentDungeon, err)
+		}
+	}
+
+	return floor, shop, nil
+}
+
+// view returns a shop as a character sees it
+func (m *ShopManager) view(shop *models.Shop, characterID string) ShopView {
+	stock := make([]ShopItem, 0, len(shop.Stock))
+	for _, item := range shop.Stock {
+		stock = append(stock, ShopItem{Item: item, Price: shop.BuyPrice(item, characterID)})
+	}
+
+	return ShopView{
+		RoomID:      shop.RoomID,
+		Stock:       stock,
+		Discount:    shop.Discount(characterID),
+		CanHaggle:   !shop.HasHaggled(characterID),
+		SellPercent: models.SellBackPercent,
+		RestocksAt:  shop.RestockedAt.Add(m.RestockInterval),
+	}
+}
+
+// notifyShoppers sends the new stock to everyone else standing in a shop
+func (m *ShopManager) notifyShoppers(floor *models.Floor, shop *models.Shop, traderID string) {
+	room, exists := shopRoom(floor, shop.RoomID)
+	if !exists || m.Notify == nil {
+		return
+	}
+
+	for y := room.Y; y < room.Y+room.Height; y++ {
+		for x := room.X; x < room.X+room.Width; x++ {
+			if !hasTile(floor, models.Position{X: x, Y: y}) {
+				continue
+			}
+			characterID := floor.Tiles[y][x].Character
+			if characterID == "" || characterID == traderID {
+				continue
+			}
+			view := m.view(shop, characterID)
+			m.Notify(characterID, Message{
+				Type: MsgShop,
+				Shop: &view,
+			})
+		}
+	}
+}
+
+// save stores the character and the floor after a trade
+func (m *ShopManager) save(character *models.Character, floor *models.Floor) {
+	if err := m.CharacterRepo.Save(character); err != nil {
+		log.Error("Failed to save character %s: %v", character.ID, err)
+	}
+	if err := m.DungeonRepo.SaveFloor(character.CurrentDungeon, character.CurrentFloor, floor); err != nil {
+		log.Error("Failed to save floor %d of dungeon %s: %v", character.CurrentFloor, character.CurrentDungeon, err)
+	}
+}
+
+// shopRoom returns the shop room with the given ID
+func shopRoom(floor *models.Floor, roomID string) (models.Room, bool) {
+	if roomID == "" {
+		return models.Room{}, false
+	}
+	for _, room := range floor.Rooms {
+		if room.ID == roomID && room.Type == models.RoomShop {
+			return room, true
+		}
+	}
+	return models.Room{}, false
+}
+
+// hasShopkeeper checks if a shopkeeper is still minding a room
+func hasShopkeeper(floor *models.Floor, room models.Room) bool {
+	for _, mob := range floor.Mobs {
+		if mob.Type == models.MobShopkeeper && mob.HP > 0 && inRoom(room, mob.Position) {
+			return true
+		}
+	}
+	return false
+}
+
+// inRoom checks if a position is inside a room
+func inRoom(room models.Room, pos models.Position) bool {
+	return pos.X >= room.X && pos.X < room.X+room.Width && pos.Y >= room.Y && pos.Y < room.Y+room.Height
+}
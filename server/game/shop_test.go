@@ -0,0 +1,256 @@
+package game
+
+import (
+	"testing"
+	"time"
+
+	"github.com/jchauncey/TheDeeps/server/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// addShop makes a room of the floor a shop, minded by a shopkeeper standing at x, y
+func addShop(floor *models.Floor, room models.Room, x, y int) {
+	room.Type = models.RoomShop
+	floor.Rooms = append(floor.Rooms, room)
+	for ry := room.Y; ry < room.Y+room.Height; ry++ {
+		for rx := room.X; rx < room.X+room.Width; rx++ {
+			floor.Tiles[ry][rx].RoomID = room.ID
+		}
+	}
+	addMob(floor, models.NewMob(models.MobShopkeeper, models.VariantNormal, 1), x, y)
+}
+
+// stockShop replaces the stock of the floor's shop
+func stockShop(floor *models.Floor, items ...*models.Item) *models.Shop {
+	shop := models.NewShop("shop", floor.Level)
+	shop.Restock(items, time.Now())
+	floor.Shops = map[string]*models.Shop{shop.RoomID: shop}
+	return shop
+}
+
+func TestShopView(t *testing.T) {
+	world := newTestWorld(t, 20, 20)
+	floor := world.floor
+	addShop(floor, models.Room{ID: "shop", X: 5, Y: 5, Width: 6, Height: 6}, 8, 8)
+	manager := NewShopManager(world.characterRepo, world.dungeonRepo)
+	character := world.addCharacter(t, "Shopper", 6, 6)
+	character.Gold = 100
+
+	view, err := manager.View(character)
+	require.NoError(t, err)
+	assert.Equal(t, "shop", view.RoomID)
+	assert.NotEmpty(t, view.Stock, "New shops are stocked from the loot tables")
+	assert.True(t, view.CanHaggle)
+	assert.Equal(t, models.SellBackPercent, view.SellPercent)
+	for _, stocked := range view.Stock {
+		assert.Equal(t, stocked.Item.Value, stocked.Price)
+	}
+	require.Contains(t, floor.Shops, "shop", "The stock is kept with the floor")
+
+	// The same stock is sold until the restock interval passes
+	again, err := manager.View(character)
+	require.NoError(t, err)
+	assert.Equal(t, view.Stock, again.Stock)
+
+	floor.Shops["shop"].RestockedAt = time.Now().Add(-manager.RestockInterval)
+	floor.Shops["shop"].Haggled[character.ID] = false
+	restocked, err := manager.View(character)
+	require.NoError(t, err)
+	assert.NotEqual(t, view.Stock[0].Item.ID, restocked.Stock[0].Item.ID)
+	assert.True(t, restocked.CanHaggle, "Restocking lets everyone haggle again")
+}
+
+func TestShopRequiresShopkeeper(t *testing.T) {
+	world := newTestWorld(t, 20, 20)
+	floor := world.floor
+	addShop(floor, models.Room{ID: "shop", X: 5, Y: 5, Width: 6, Height: 6}, 8, 8)
+	manager := NewShopManager(world.characterRepo, world.dungeonRepo)
+	character := world.addCharacter(t, "Shopper", 6, 6)
+	character.Gold = 100
+
+	character.Position = models.Position{X: 15, Y: 15}
+	_, err := manager.View(character)
+	assert.ErrorIs(t, err, ErrNotInShop)
+
+	character.Position = models.Position{X: 6, Y: 6}
+	for id := range floor.Mobs {
+		delete(floor.Mobs, id)
+	}
+	_, err = manager.View(character)
+	assert.ErrorIs(t, err, ErrNoShopkeeper)
+}
+
+func TestShopBuy(t *testing.T) {
+	world := newTestWorld(t, 20, 20)
+	floor := world.floor
+	addShop(floor, models.Room{ID: "shop", X: 5, Y: 5, Width: 6, Height: 6}, 8, 8)
+	manager := NewShopManager(world.characterRepo, world.dungeonRepo)
+	character := world.addCharacter(t, "Shopper", 6, 6)
+	character.Gold = 100
+	sword := models.NewWeaponWithWeight("Sword", 5, 60, 3, 1, nil)
+	anvil := models.NewWeaponWithWeight("Anvil", 1, 10, 500, 1, nil)
+	crown := models.NewWeaponWithWeight("Crown", 1, 1000, 1, 1, nil)
+	shop := stockShop(floor, sword, anvil, crown)
+
+	_, err := manager.Buy(character, "missing")
+	assert.ErrorIs(t, err, models.ErrNotInStock)
+	_, err = manager.Buy(character, crown.ID)
+	assert.ErrorIs(t, err, models.ErrNotEnoughGold)
+	_, err = manager.Buy(character, anvil.ID)
+	assert.ErrorIs(t, err, models.ErrTooHeavy)
+	assert.Equal(t, 100, character.Gold, "Failed purchases cost nothing")
+
+	// A haggled discount comes off the price
+	shop.Haggled[character.ID] = true
+	trade, err := manager.Buy(character, sword.ID)
+	require.NoError(t, err)
+	assert.Equal(t, 48, trade.Price)
+	assert.Equal(t, 52, trade.Gold)
+	assert.Equal(t, 52, character.Gold)
+	_, owned := character.GetInventoryItem(sword.ID)
+	assert.True(t, owned)
+	assert.Len(t, trade.Shop.Stock, 2)
+	assert.Equal(t, 20, trade.Shop.Discount)
+}
+
+func TestShopTradeUpdatesOtherShoppers(t *testing.T) {
+	world := newTestWorld(t, 20, 20)
+	floor := world.floor
+	addShop(floor, models.Room{ID: "shop", X: 5, Y: 5, Width: 6, Height: 6}, 8, 8)
+	manager := NewShopManager(world.characterRepo, world.dungeonRepo)
+	character := world.addCharacter(t, "Shopper", 6, 6)
+	character.Gold = 100
+	sword := models.NewWeaponWithWeight("Sword", 5, 60, 3, 1, nil)
+	shield := models.NewWeaponWithWeight("Shield", 5, 40, 3, 1, nil)
+	stockShop(floor, sword, shield)
+
+	other := models.NewCharacter("Browser", models.Mage)
+	floor.Tiles[9][9].Character = other.ID
+	notified := make(map[string]Message)
+	manager.Notify = func(characterID string, message Message) {
+		notified[characterID] = message
+	}
+
+	_, err := manager.Buy(character, sword.ID)
+	require.NoError(t, err)
+	assert.NotContains(t, notified, character.ID, "The buyer gets the stock with their trade")
+	require.Contains(t, notified, other.ID)
+	assert.Equal(t, MsgShop, notified[other.ID].Type)
+	require.Len(t, notified[other.ID].Shop.Stock, 1)
+	assert.Equal(t, shield.ID, notified[other.ID].Shop.Stock[0].Item.ID)
+}
+
+func TestShopTradeWaitsForWorld(t *testing.T) {
+	world := newTestWorld(t, 20, 20)
+	floor := world.floor
+	addShop(floor, models.Room{ID: "shop", X: 5, Y: 5, Width: 6, Height: 6}, 8, 8)
+	manager := NewShopManager(world.characterRepo, world.dungeonRepo)
+	character := world.addCharacter(t, "Shopper", 6, 6)
+	character.Gold = 100
+	sword := models.NewWeaponWithWeight("Sword", 5, 60, 3, 1, nil)
+	stockShop(floor, sword)
+
+	manager.World.Lock()
+	done := make(chan struct{})
+	go func() {
+		manager.Buy(character, sword.ID)
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		t.Fatal("A trade should wait for whoever holds the world lock")
+	case <-time.After(50 * time.Millisecond):
+	}
+	manager.World.Unlock()
+	<-done
+	assert.Equal(t, 40, character.Gold)
+}
+
+func TestShopSell(t *testing.T) {
+	world := newTestWorld(t, 20, 20)
+	floor := world.floor
+	addShop(floor, models.Room{ID: "shop", X: 5, Y: 5, Width: 6, Height: 6}, 8, 8)
+	manager := NewShopManager(world.characterRepo, world.dungeonRepo)
+	character := world.addCharacter(t, "Shopper", 6, 6)
+	character.Gold = 100
+	stockShop(floor)
+
+	sword := models.NewWeapon("Sword", 5, 60, 1, nil)
+	armor := models.NewArmor("Leather Armor", 2, 30, 1, nil)
+	trinket := models.NewPotion("Trinket", 0, 1)
+	for _, item := range []*models.Item{sword, armor, trinket} {
+		require.True(t, character.AddToInventory(item))
+	}
+	require.True(t, character.EquipItem(armor.ID))
+
+	_, err := manager.Sell(character, "missing")
+	assert.ErrorIs(t, err, models.ErrNotInInventory)
+	_, err = manager.Sell(character, armor.ID)
+	assert.ErrorIs(t, err, models.ErrItemEquipped)
+	_, err = manager.Sell(character, trinket.ID)
+	assert.ErrorIs(t, err, models.ErrWorthlessItem)
+
+	trade, err := manager.Sell(character, sword.ID)
+	require.NoError(t, err)
+	assert.Equal(t, 30, trade.Price)
+	assert.Equal(t, 130, character.Gold)
+	_, owned := character.GetInventoryItem(sword.ID)
+	assert.False(t, owned)
+
+	// The shopkeeper sells it back at full price
+	require.Len(t, trade.Shop.Stock, 1)
+	assert.Equal(t, sword.ID, trade.Shop.Stock[0].Item.ID)
+	assert.Equal(t, 60, trade.Shop.Stock[0].Price)
+}
+
+func TestShopHaggle(t *testing.T) {
+	world := newTestWorld(t, 20, 20)
+	floor := world.floor
+	addShop(floor, models.Room{ID: "shop", X: 5, Y: 5, Width: 6, Height: 6}, 8, 8)
+	manager := NewShopManager(world.characterRepo, world.dungeonRepo)
+	character := world.addCharacter(t, "Shopper", 6, 6)
+	character.Gold = 100
+	stockShop(floor)
+
+	_, view, err := manager.Haggle(character)
+	require.NoError(t, err)
+	assert.False(t, view.CanHaggle)
+
+	_, _, err = manager.Haggle(character)
+	assert.ErrorIs(t, err, models.ErrAlreadyHaggled)
+}
+
+func TestHandleShopMessages(t *testing.T) {
+	manager, client, floor, _ := newTestManager(t)
+	addShop(floor, models.Room{ID: "shop", X: 3, Y: 8, Width: 5, Height: 5}, 4, 9)
+
+	potion := models.NewPotion("Health Potion", 10, 10)
+	stockShop(floor, potion)
+	client.Character.Gold = 25
+
+	manager.HandleMessage(client, Message{Type: MsgShop})
+	msg := <-client.Send
+	require.Equal(t, MsgShop, msg.Type)
+	require.NotNil(t, msg.Shop)
+	require.Len(t, msg.Shop.Stock, 1)
+
+	manager.HandleMessage(client, Message{Type: MsgBuy, ItemID: potion.ID})
+	msg = <-client.Send
+	require.Equal(t, MsgNotification, msg.Type, msg.Error)
+	assert.Equal(t, "You buy Health Potion for 10 gold", msg.Text)
+	assert.Equal(t, 15, msg.Character.Gold)
+	assert.Empty(t, msg.Shop.Stock)
+
+	manager.HandleMessage(client, Message{Type: MsgSell, ItemID: potion.ID})
+	msg = <-client.Send
+	require.Equal(t, MsgNotification, msg.Type, msg.Error)
+	assert.Equal(t, "You sell Health Potion for 5 gold", msg.Text)
+	assert.Equal(t, 20, client.Character.Gold)
+
+	manager.HandleMessage(client, Message{Type: MsgBuy, ItemID: "missing"})
+	msg = <-client.Send
+	assert.Equal(t, MsgError, msg.Type)
+	assert.Equal(t, "The shopkeeper doesn't have that item", msg.Error)
+}
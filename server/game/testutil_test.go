@@ -0,0 +1,63 @@
+package game
+
+import (
+	"testing"
+
+	"github.com/jchauncey/TheDeeps/server/models"
+	"github.com/jchauncey/TheDeeps/server/repositories"
+	"github.com/stretchr/testify/require"
+)
+
+// testWorld is a saved dungeon with an open first floor to stand characters and mobs on
+type testWorld struct {
+	characterRepo *repositories.CharacterRepository
+	dungeonRepo   *repositories.DungeonRepository
+	dungeonID     string
+	floor         *models.Floor
+}
+
+// newTestWorld creates repositories holding a dungeon whose first floor is open
+func newTestWorld(t *testing.T, width, height int) *testWorld {
+	world := &testWorld{
+		characterRepo: repositories.NewCharacterRepository(),
+		dungeonRepo:   repositories.NewDungeonRepository(),
+		floor:         newOpenFloor(width, height),
+	}
+
+	dungeon := models.NewDungeon("TestDungeon", 1, 12345)
+	dungeon.FloorData[1] = world.floor
+	require.NoError(t, world.dungeonRepo.Save(dungeon))
+	world.dungeonID = dungeon.ID
+
+	return world
+}
+
+// addCharacter saves a warrior standing on the first floor
+func (w *testWorld) addCharacter(t *testing.T, name string, x, y int) *models.Character {
+	character := models.NewCharacter(name, models.Warrior)
+	character.CurrentDungeon = w.dungeonID
+	character.CurrentFloor = 1
+	character.Position = models.Position{X: x, Y: y}
+	w.floor.Tiles[y][x].Character = character.ID
+	require.NoError(t, w.characterRepo.Save(character))
+	return character
+}
+
+// newTestManager creates a game manager and the client of a character standing on
+// an open floor, already sent the full view of it
+func newTestManager(t *testing.T) (*GameManager, *Client, *models.Floor, string) {
+	world := newTestWorld(t, 40, 20)
+	manager := NewGameManager(world.characterRepo, world.dungeonRepo)
+
+	client := &Client{
+		ID:        "test-client",
+		Character: world.addCharacter(t, "Syncer", 5, 10),
+		Manager:   manager,
+		Send:      make(chan Message, 10),
+	}
+
+	msg := manager.fullSync(client, world.dungeonID, world.floor)
+	require.Equal(t, MsgFloorChange, msg.Type)
+
+	return manager, client, world.floor, world.dungeonID
+}
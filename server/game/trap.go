@@ -0,0 +1,184 @@
+package game
+
+import (
+	"fmt"
+	"math/rand"
+	"sort"
+
+	"github.com/jchauncey/TheDeeps/server/models"
+)
+
+const (
+	trapDetectRadius = 2  // How far away passive Perception can spot a trap
+	trapDisarmRange  = 1  // How close a character must be to disarm a trap
+	alarmRadius      = 10 // Mobs within this many tiles answer an alarm trap
+)
+
+// skillCheck makes a character's skill checks; tests replace it to control the roll
+var skillCheck = (*models.Character).PerformSkillCheck
+
+// TrapResult describes what a trap did to the character who set it off
+type TrapResult struct {
+	Trap       *models.Trap         `json:"trap"`
+	Damage     int                  `json:"damage,omitempty"`
+	Effect     *models.StatusEffect `json:"effect,omitempty"`     // Effect the trap applied
+	Teleported *models.Position     `json:"teleported,omitempty"` // Where the trap sent the character
+	Alerted    []string             `json:"alerted,omitempty"`    // Mobs called by an alarm
+	Died       bool                 `json:"died,omitempty"`
+	Message    string               `json:"message"`
+}
+
+// TrapAt returns the trap hidden on a tile, if there is one
+func TrapAt(floor *models.Floor, pos models.Position) (*models.Trap, bool) {
+	if !hasTile(floor, pos) {
+		return nil, false
+	}
+	trap, exists := floor.Traps[floor.Tiles[pos.Y][pos.X].TrapID]
+	return trap, exists
+}
+
+// TriggerTrap sets off a trap under a character. The trap is revealed and stays armed.
+func TriggerTrap(floor *models.Floor, trap *models.Trap, character *models.Character, rng *rand.Rand) TrapResult {
+	return triggerTrap(floor, trap, character, rng, fmt.Sprintf("You set off a %s!", trap.Name()))
+}
+
+// triggerTrap sets off a trap, describing what it did after the given opening line
+func triggerTrap(floor *models.Floor, trap *models.Trap, character *models.Character, rng *rand.Rand, message string) TrapResult {
+	revealTrap(floor, trap)
+	result := TrapResult{Trap: trap, Message: message}
+
+	switch trap.Type {
+	case models.TrapSpike:
+		result.Damage = trap.Damage
+		result.Died = damageCharacter(character, trap.Damage)
+		result.Message += fmt.Sprintf(" Spikes deal %d damage.", trap.Damage)
+	case models.TrapPoison:
+		if trap.Effect != nil {
+			applied := character.StatusEffects.Apply(*trap.Effect)
+			result.Effect = &applied
+		}
+		result.Message += " You are poisoned."
+	case models.TrapFire:
+		result.Damage = trap.Damage
+		result.Died = damageCharacter(character, trap.Damage)
+		result.Message += fmt.Sprintf(" Flames deal %d damage.", trap.Damage)
+		if trap.Effect != nil && !result.Died {
+			applied := character.StatusEffects.Apply(*trap.Effect)
+			result.Effect = &applied
+			result.Message += " You are burning."
+		}
+	case models.TrapTeleport:
+		if destination, found := teleportDestination(floor, trap.Position, rng); found {
+			moveCharacter(floor, character, destination)
+			result.Teleported = &destination
+			result.Message += " The floor lurches and you are somewhere else."
+		}
+	case models.TrapAlarm:
+		result.Alerted = soundAlarm(floor, trap.Position)
+		result.Message += " A shrill alarm echoes through the halls."
+	}
+
+	return result
+}
+
+// DetectTraps makes a passive Perception check against the hidden traps near a
+// character, revealing the ones they notice
+func DetectTraps(floor *models.Floor, character *models.Character) []*models.Trap {
+	perception := character.PassiveScore(models.SkillPerception)
+
+	spotted := make([]*models.Trap, 0)
+	for _, trap := range floor.Traps {
+		if trap.Revealed || chebyshevDistance(character.Position, trap.Position) > trapDetectRadius {
+			continue
+		}
+		if perception >= trap.DetectDC {
+			revealTrap(floor, trap)
+			spotted = append(spotted, trap)
+		}
+	}
+
+	sort.Slice(spotted, func(i, j int) bool { return spotted[i].ID < spotted[j].ID })
+	return spotted
+}
+
+// DisarmTrap makes a Traps check to disarm a revealed trap. A disarmed trap is
+// removed and the character gains its experience; otherwise the returned
+// result is the trap going off under them.
+func DisarmTrap(floor *models.Floor, trap *models.Trap, character *models.Character, rng *rand.Rand) (bool, TrapResult) {
+	if skillCheck(character, models.SkillTraps, trap.DisarmDC) {
+		removeTrap(floor, trap)
+		exp := trap.Experience()
+		character.AddExperience(exp)
+		return true, TrapResult{Trap: trap, Message: fmt.Sprintf("You disarm the %s and gain %d experience.", trap.Name(), exp)}
+	}
+
+	return false, triggerTrap(floor, trap, character, rng, fmt.Sprintf("Your fumbling sets off the %s!", trap.Name()))
+}
+
+// revealTrap shows a trap to everyone on the floor
+func revealTrap(floor *models.Floor, trap *models.Trap) {
+	if trap.Revealed {
+		return
+	}
+	trap.Revealed = true
+
+	// Traps rigged to locks aren't on a tile of their own
+	tile := &floor.Tiles[trap.Position.Y][trap.Position.X]
+	if tile.TrapID == trap.ID {
+		tile.Type = models.TileTrap
+		floor.MarkTiles(trap.Position)
+	}
+}
+
+// removeTrap takes a disarmed trap off the floor
+func removeTrap(floor *models.Floor, trap *models.Trap) {
+	tile := &floor.Tiles[trap.Position.Y][trap.Position.X]
+	tile.TrapID = ""
+	tile.Type = models.TileFloor
+	delete(floor.Traps, trap.ID)
+	floor.MarkTiles(trap.Position)
+}
+
+// teleportDestination picks a random free floor tile that can be walked to from
+// the trap, so it never lands anyone behind a locked or sealed door
+func teleportDestination(floor *models.Floor, from models.Position, rng *rand.Rand) (models.Position, bool) {
+	candidates := make([]models.Position, 0)
+	for _, pos := range reachableTiles(floor, from) {
+		tile := floor.Tiles[pos.Y][pos.X]
+		if tile.Type == models.TileFloor && tile.Walkable && tile.MobID == "" && tile.Character == "" && tile.TrapID == "" {
+			candidates = append(candidates, pos)
+		}
+	}
+	if len(candidates) == 0 {
+		return models.Position{}, false
+	}
+	return candidates[rng.Intn(len(candidates))], true
+}
+
+// moveCharacter moves a character to another tile on their floor
+func moveCharacter(floor *models.Floor, character *models.Character, pos models.Position) {
+	old := character.Position
+	if hasTile(floor, old) && floor.Tiles[old.Y][old.X].Character == character.ID {
+		floor.Tiles[old.Y][old.X].Character = ""
+	}
+	floor.Tiles[pos.Y][pos.X].Character = character.ID
+	character.Position = pos
+	floor.MarkTiles(old, pos)
+}
+
+// soundAlarm calls every mob near a position to it and returns their IDs
+func soundAlarm(floor *models.Floor, pos models.Position) []string {
+	alerted := make([]string, 0)
+	for id, mob := range floor.Mobs {
+		if mob.Type == models.MobShopkeeper || chebyshevDistance(mob.Position, pos) > alarmRadius {
+			continue
+		}
+		target := pos
+		mob.Alerted = &target
+		alerted = append(alerted, id)
+	}
+
+	sort.Strings(alerted)
+	floor.MarkMobs(alerted...)
+	return alerted
+}
@@ -0,0 +1,259 @@
+package game
+
+import (
+	"math/rand"
+	"testing"
+
+	"github.com/jchauncey/TheDeeps/server/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// addTrap hides a trap on the floor
+func addTrap(floor *models.Floor, trap *models.Trap, x, y int) {
+	trap.Position = models.Position{X: x, Y: y}
+	if floor.Traps == nil {
+		floor.Traps = make(map[string]*models.Trap)
+	}
+	floor.Traps[trap.ID] = trap
+	floor.Tiles[y][x].TrapID = trap.ID
+}
+
+// stubSkillCheck makes every skill check succeed or fail for the rest of the test
+func stubSkillCheck(t *testing.T, success bool) {
+	original := skillCheck
+	skillCheck = func(*models.Character, models.SkillType, int) bool { return success }
+	t.Cleanup(func() { skillCheck = original })
+}
+
+func TestTriggerSpikeTrap(t *testing.T) {
+	floor := newOpenFloor(10, 10)
+	trap := models.NewTrap(models.TrapSpike, 1)
+	addTrap(floor, trap, 3, 3)
+
+	found, exists := TrapAt(floor, models.Position{X: 3, Y: 3})
+	require.True(t, exists)
+	assert.Same(t, trap, found)
+
+	character := models.NewCharacter("Victim", models.Warrior)
+	character.Position = trap.Position
+	hp := character.CurrentHP
+
+	result := TriggerTrap(floor, trap, character, rand.New(rand.NewSource(1)))
+	assert.Equal(t, trap.Damage, result.Damage)
+	assert.Equal(t, hp-trap.Damage, character.CurrentHP)
+	assert.False(t, result.Died)
+	assert.Equal(t, "You set off a spike trap! Spikes deal 6 damage.", result.Message)
+
+	// Triggered traps are revealed and stay armed
+	assert.True(t, trap.Revealed)
+	assert.Equal(t, models.TileTrap, floor.Tiles[3][3].Type)
+	assert.Contains(t, floor.Traps, trap.ID)
+
+	character.CurrentHP = 1
+	result = TriggerTrap(floor, trap, character, rand.New(rand.NewSource(1)))
+	assert.True(t, result.Died)
+}
+
+func TestTriggerPoisonTrap(t *testing.T) {
+	floor := newOpenFloor(10, 10)
+	trap := models.NewTrap(models.TrapPoison, 3)
+	addTrap(floor, trap, 3, 3)
+	character := models.NewCharacter("Victim", models.Warrior)
+
+	result := TriggerTrap(floor, trap, character, rand.New(rand.NewSource(1)))
+	require.NotNil(t, result.Effect)
+	assert.Equal(t, models.StatusPoison, result.Effect.Type)
+	assert.True(t, character.StatusEffects.Has(models.StatusPoison))
+}
+
+func TestTriggerFireTrap(t *testing.T) {
+	floor := newOpenFloor(10, 10)
+	trap := models.NewTrap(models.TrapFire, 4)
+	addTrap(floor, trap, 3, 3)
+	character := models.NewCharacter("Victim", models.Warrior)
+	hp := character.CurrentHP
+
+	result := TriggerTrap(floor, trap, character, rand.New(rand.NewSource(1)))
+	assert.Equal(t, hp-trap.Damage, character.CurrentHP)
+	require.NotNil(t, result.Effect)
+	assert.Equal(t, models.StatusBurn, result.Effect.Type)
+	assert.True(t, character.StatusEffects.Has(models.StatusBurn))
+	assert.Equal(t, "You set off a fire trap! Flames deal 6 damage. You are burning.", result.Message)
+}
+
+func TestTriggerTeleportTrap(t *testing.T) {
+	floor := newOpenFloor(10, 10)
+	trap := models.NewTrap(models.TrapTeleport, 3)
+	addTrap(floor, trap, 3, 3)
+	character := models.NewCharacter("Victim", models.Warrior)
+	character.Position = trap.Position
+	floor.Tiles[3][3].Character = character.ID
+
+	result := TriggerTrap(floor, trap, character, rand.New(rand.NewSource(1)))
+	require.NotNil(t, result.Teleported)
+	assert.Equal(t, *result.Teleported, character.Position)
+	assert.NotEqual(t, trap.Position, character.Position)
+	assert.Empty(t, floor.Tiles[3][3].Character)
+	assert.Equal(t, character.ID, floor.Tiles[character.Position.Y][character.Position.X].Character)
+}
+
+func TestTeleportTrapStaysReachable(t *testing.T) {
+	// A wall splits the floor, with a locked door and a sealed one through it
+	floor := newOpenFloor(20, 10)
+	for y := 1; y < floor.Height-1; y++ {
+		floor.Tiles[y][10] = models.Tile{Type: models.TileWall}
+	}
+	addDoor(floor, 10, 3, models.NewLock(1))
+	addDoor(floor, 10, 6, nil).Sealed = true
+
+	trap := models.NewTrap(models.TrapTeleport, 3)
+	addTrap(floor, trap, 3, 3)
+	character := models.NewCharacter("Victim", models.Warrior)
+	for seed := int64(0); seed < 50; seed++ {
+		character.Position = trap.Position
+		result := TriggerTrap(floor, trap, character, rand.New(rand.NewSource(seed)))
+		require.NotNil(t, result.Teleported)
+		assert.Less(t, result.Teleported.X, 10, "The trap should never send anyone past the doors")
+		floor.Tiles[result.Teleported.Y][result.Teleported.X].Character = ""
+	}
+}
+
+func TestTriggerAlarmTrap(t *testing.T) {
+	floor := newOpenFloor(30, 10)
+	trap := models.NewTrap(models.TrapAlarm, 1)
+	addTrap(floor, trap, 3, 3)
+
+	near := models.NewMob(models.MobGoblin, models.VariantNormal, 1)
+	addMob(floor, near, 10, 5)
+	far := models.NewMob(models.MobGoblin, models.VariantNormal, 1)
+	addMob(floor, far, 25, 5)
+	shopkeeper := models.NewMob(models.MobShopkeeper, models.VariantNormal, 1)
+	addMob(floor, shopkeeper, 5, 5)
+
+	character := models.NewCharacter("Victim", models.Warrior)
+	result := TriggerTrap(floor, trap, character, rand.New(rand.NewSource(1)))
+	assert.Equal(t, []string{near.ID}, result.Alerted)
+	require.NotNil(t, near.Alerted)
+	assert.Equal(t, trap.Position, *near.Alerted)
+	assert.Nil(t, far.Alerted)
+	assert.Nil(t, shopkeeper.Alerted, "Shopkeepers don't leave their shops")
+}
+
+func TestDetectTraps(t *testing.T) {
+	floor := newOpenFloor(20, 10)
+	character := models.NewCharacter("Scout", models.Warrior)
+	character.Position = models.Position{X: 5, Y: 5}
+	perception := character.PassiveScore(models.SkillPerception)
+
+	easy := models.NewTrap(models.TrapSpike, 1)
+	easy.DetectDC = perception
+	addTrap(floor, easy, 6, 6)
+	hard := models.NewTrap(models.TrapSpike, 1)
+	hard.DetectDC = perception + 1
+	addTrap(floor, hard, 4, 4)
+	distant := models.NewTrap(models.TrapSpike, 1)
+	distant.DetectDC = 0
+	addTrap(floor, distant, 15, 5)
+
+	spotted := DetectTraps(floor, character)
+	require.Len(t, spotted, 1)
+	assert.Same(t, easy, spotted[0])
+	assert.True(t, easy.Revealed)
+	assert.False(t, hard.Revealed, "Traps above the passive score stay hidden")
+	assert.False(t, distant.Revealed, "Traps out of range stay hidden")
+
+	assert.Empty(t, DetectTraps(floor, character), "Revealed traps are only spotted once")
+}
+
+func TestDisarmTrap(t *testing.T) {
+	floor := newOpenFloor(10, 10)
+	trap := models.NewTrap(models.TrapSpike, 2)
+	addTrap(floor, trap, 3, 3)
+	character := models.NewCharacter("Rogue", models.Rogue)
+	hp := character.CurrentHP
+
+	stubSkillCheck(t, false)
+	disarmed, result := DisarmTrap(floor, trap, character, rand.New(rand.NewSource(1)))
+	assert.False(t, disarmed)
+	assert.Equal(t, hp-trap.Damage, character.CurrentHP, "A failed disarm sets the trap off")
+	assert.Equal(t, "Your fumbling sets off the spike trap! Spikes deal 8 damage.", result.Message)
+	assert.Contains(t, floor.Traps, trap.ID)
+
+	stubSkillCheck(t, true)
+	disarmed, result = DisarmTrap(floor, trap, character, rand.New(rand.NewSource(1)))
+	assert.True(t, disarmed)
+	assert.Equal(t, trap.Experience(), character.Experience)
+	assert.Equal(t, "You disarm the spike trap and gain 20 experience.", result.Message)
+	assert.NotContains(t, floor.Traps, trap.ID)
+	assert.Empty(t, floor.Tiles[3][3].TrapID)
+	assert.Equal(t, models.TileFloor, floor.Tiles[3][3].Type)
+}
+
+func TestHandleMoveOntoTrap(t *testing.T) {
+	manager, client, floor, _ := newTestManager(t)
+	trap := models.NewTrap(models.TrapSpike, 1)
+	trap.DetectDC = 100
+	addTrap(floor, trap, 6, 10)
+	hp := client.Character.CurrentHP
+
+	manager.HandleMessage(client, Message{Type: MsgMove, Direction: DirRight})
+	msg := <-client.Send
+	require.Equal(t, MsgUpdatePlayer, msg.Type, msg.Error)
+
+	msg = <-client.Send
+	require.Equal(t, MsgNotification, msg.Type)
+	require.NotNil(t, msg.Trap)
+	assert.Equal(t, trap.ID, msg.Trap.Trap.ID)
+	assert.Equal(t, hp-trap.Damage, client.Character.CurrentHP)
+	assert.True(t, trap.Revealed)
+}
+
+func TestMoveCharacterOntoDeadlyTrap(t *testing.T) {
+	manager, client, floor, _ := newTestManager(t)
+	manager.Clients[client.ID] = client
+	manager.CharacterToClient[client.Character.ID] = client.ID
+	manager.DeathPenalty = DeathPenalty{GoldLossPercent: 100}
+	floor.Rooms = []models.Room{{ID: "safe", Type: models.RoomSafe, X: 30, Y: 10, Width: 5, Height: 5}}
+	trap := models.NewTrap(models.TrapSpike, 1)
+	trap.Damage = 999
+	addTrap(floor, trap, 6, 10)
+	client.Character.Gold = 40
+
+	death := manager.MoveCharacter(floor, client.Character, models.Position{X: 6, Y: 10})
+	require.NotNil(t, death)
+	assert.Equal(t, "killed by a "+trap.Name(), death.Cause)
+	assert.Equal(t, 40, death.GoldLost, "The manager's death penalty should apply")
+
+	var told bool
+	for _, msg := range drainMessages(client) {
+		told = told || msg.Type == MsgDeath
+	}
+	assert.True(t, told, "The floor should be told about the death")
+}
+
+func TestHandleDisarm(t *testing.T) {
+	manager, client, floor, _ := newTestManager(t)
+	trap := models.NewTrap(models.TrapAlarm, 1)
+	addTrap(floor, trap, 8, 10)
+
+	// Hidden traps can't be disarmed
+	manager.HandleMessage(client, Message{Type: MsgDisarm, TargetID: trap.ID})
+	msg := <-client.Send
+	require.Equal(t, MsgError, msg.Type)
+	assert.Equal(t, "There is no trap there", msg.Error)
+
+	trap.Revealed = true
+	manager.HandleMessage(client, Message{Type: MsgDisarm, TargetID: trap.ID})
+	msg = <-client.Send
+	require.Equal(t, MsgError, msg.Type)
+	assert.Equal(t, "You are too far away to disarm that trap", msg.Error)
+
+	stubSkillCheck(t, true)
+	client.Character.Position = models.Position{X: 7, Y: 10}
+	manager.HandleMessage(client, Message{Type: MsgDisarm, TargetID: trap.ID})
+	msg = <-client.Send
+	require.Equal(t, MsgNotification, msg.Type, msg.Error)
+	assert.Equal(t, "You disarm the alarm trap and gain 15 experience.", msg.Text)
+	assert.NotContains(t, floor.Traps, trap.ID)
+}
@@ -11,6 +11,7 @@ import (
 	"time"
 
 	"github.com/gorilla/websocket"
+	"github.com/jchauncey/TheDeeps/server/auth"
 	"github.com/jchauncey/TheDeeps/server/models"
 	"github.com/jchauncey/TheDeeps/server/repositories"
 	"github.com/stretchr/testify/assert"
@@ -24,7 +25,9 @@ func TestWebSocketIntegration(t *testing.T) {
 	dungeonRepo := repositories.NewDungeonRepository()
 
 	// Create a test character
+	account := models.NewAccount("tester", "")
 	character := models.NewCharacter("TestCharacter", models.Warrior)
+	character.OwnerID = account.ID
 	characterRepo.Save(character)
 
 	// Create a test dungeon with a floor
@@ -63,7 +66,7 @@ func TestWebSocketIntegration(t *testing.T) {
 
 	// Create a test server
 	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		manager.HandleConnection(w, r)
+		manager.HandleConnection(w, r.WithContext(auth.WithAccount(r.Context(), account)))
 	}))
 	defer server.Close()
 
@@ -100,24 +103,13 @@ func TestWebSocketIntegration(t *testing.T) {
 	go func() {
 		defer wg.Done()
 
-		// Set a read deadline to prevent hanging
-		ws.SetReadDeadline(time.Now().Add(2 * time.Second))
-
-		// Read the message
-		_, message, err := ws.ReadMessage()
+		// Skip the initial state the server sends on registration until the broadcast arrives
+		receivedMsg, err := newMessageReader(ws).next(testMessage.Type, 2*time.Second)
 		if err != nil {
 			t.Logf("Error reading message: %v", err)
 			return
 		}
 
-		// Parse the message
-		var receivedMsg Message
-		err = json.Unmarshal(message, &receivedMsg)
-		if err != nil {
-			t.Logf("Error unmarshaling message: %v", err)
-			return
-		}
-
 		// Send the message to the channel
 		messageCh <- receivedMsg
 	}()
@@ -299,7 +291,9 @@ func TestWebSocketClientRunFunctions(t *testing.T) {
 	dungeonRepo := repositories.NewDungeonRepository()
 
 	// Create a test character
+	account := models.NewAccount("tester", "")
 	character := models.NewCharacter("TestCharacter", models.Warrior)
+	character.OwnerID = account.ID
 	characterRepo.Save(character)
 
 	// Create a game manager
@@ -327,7 +321,7 @@ func TestWebSocketClientRunFunctions(t *testing.T) {
 
 	// Create a test server
 	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		manager.HandleConnection(w, r)
+		manager.HandleConnection(w, r.WithContext(auth.WithAccount(r.Context(), account)))
 	}))
 	defer server.Close()
 
@@ -381,6 +375,279 @@ func TestWebSocketClientRunFunctions(t *testing.T) {
 	cancel()
 }
 
+// TestWebSocketGameplay plays through a move, pickup and descend over a real connection
+func TestWebSocketGameplay(t *testing.T) {
+	// Create repositories
+	characterRepo := repositories.NewCharacterRepository()
+	dungeonRepo := repositories.NewDungeonRepository()
+
+	// Create a dungeon with a small hand-built first floor
+	dungeon := models.NewDungeon("TestDungeon", 2, 12345)
+	floor := dungeon.GenerateFloor(1)
+	for y := 1; y < 6; y++ {
+		for x := 1; x < 8; x++ {
+			floor.Tiles[y][x] = models.Tile{
+				Type:     models.TileFloor,
+				Walkable: true,
+				RoomID:   "test-room",
+			}
+		}
+	}
+	floor.Rooms = []models.Room{{ID: "test-room", Type: models.RoomEntrance, X: 1, Y: 1, Width: 7, Height: 5}}
+
+	// Down stairs two tiles to the right of the character
+	floor.Tiles[3][5].Type = models.TileDownStairs
+	floor.DownStairs = []models.Position{{X: 5, Y: 3}}
+
+	// An item one tile to the right of the character
+	potion := models.NewPotion("Health Potion", 10, 5)
+	potion.Position = models.Position{X: 4, Y: 3}
+	floor.Items[potion.ID] = *potion
+	floor.Tiles[3][4].ItemID = potion.ID
+	dungeonRepo.Save(dungeon)
+
+	// Create a character standing in the room
+	account := models.NewAccount("tester", "")
+	character := models.NewCharacter("TestCharacter", models.Warrior)
+	character.OwnerID = account.ID
+	character.CurrentDungeon = dungeon.ID
+	character.CurrentFloor = 1
+	character.Position = models.Position{X: 3, Y: 3}
+	characterRepo.Save(character)
+	dungeonRepo.AddCharacterToDungeon(dungeon.ID, character.ID)
+
+	// Create and start a game manager
+	manager := NewGameManager(characterRepo, dungeonRepo)
+	go manager.Start()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		manager.HandleConnection(w, r.WithContext(auth.WithAccount(r.Context(), account)))
+	}))
+	defer server.Close()
+
+	wsURL := "ws" + strings.TrimPrefix(server.URL, "http") + "?characterId=" + character.ID
+	ws, _, err := websocket.DefaultDialer.Dial(wsURL, nil)
+	require.NoError(t, err, "Failed to connect to WebSocket server")
+	defer ws.Close()
+
+	// The server sends the initial state once the client is registered
+	reader := newMessageReader(ws)
+	_, err = reader.next(MsgInitialState, 2*time.Second)
+	require.NoError(t, err, "Should receive the initial state")
+
+	t.Run("Bad frames get structured errors", func(t *testing.T) {
+		require.NoError(t, ws.WriteMessage(websocket.TextMessage, []byte("not json")))
+		msg, err := reader.next(MsgError, 2*time.Second)
+		require.NoError(t, err)
+		assert.Equal(t, ErrCodeInvalidJSON, msg.Code, "Invalid JSON should be reported")
+
+		require.NoError(t, ws.WriteMessage(websocket.TextMessage, []byte(`{"direction":"up"}`)))
+		msg, err = reader.next(MsgError, 2*time.Second)
+		require.NoError(t, err)
+		assert.Equal(t, ErrCodeMissingType, msg.Code, "A missing type should be reported")
+
+		require.NoError(t, ws.WriteMessage(websocket.BinaryMessage, []byte{0x01}))
+		msg, err = reader.next(MsgError, 2*time.Second)
+		require.NoError(t, err)
+		assert.Equal(t, ErrCodeUnsupportedFrame, msg.Code, "Binary frames should be rejected")
+
+		require.NoError(t, ws.WriteJSON(Message{Type: "dance"}))
+		msg, err = reader.next(MsgError, 2*time.Second)
+		require.NoError(t, err)
+		assert.Equal(t, ErrCodeUnknownType, msg.Code, "Unknown types should be reported")
+	})
+
+	t.Run("Move onto the item", func(t *testing.T) {
+		require.NoError(t, ws.WriteJSON(Message{Type: MsgMove, Direction: DirRight}))
+		msg, err := reader.next(MsgUpdatePlayer, 2*time.Second)
+		require.NoError(t, err)
+		require.NotNil(t, msg.Character)
+		assert.Equal(t, models.Position{X: 4, Y: 3}, msg.Character.Position, "Character should move right")
+
+		msg, err = reader.next(MsgNotification, 2*time.Second)
+		require.NoError(t, err)
+		assert.Contains(t, msg.Text, "Health Potion", "Character should be told about the item")
+	})
+
+	t.Run("Pick up the item", func(t *testing.T) {
+		require.NoError(t, ws.WriteJSON(Message{Type: MsgPickup, ItemID: potion.ID}))
+		msg, err := reader.next(MsgNotification, 2*time.Second)
+		require.NoError(t, err)
+		assert.Equal(t, "You picked up Health Potion", msg.Text)
+		require.NotNil(t, msg.Character)
+		assert.Len(t, msg.Character.Inventory, 1, "The potion should be in the inventory")
+
+		msg, err = reader.next(MsgFloorDiff, 2*time.Second)
+		require.NoError(t, err)
+		require.NotNil(t, msg.Diff)
+		assert.Contains(t, msg.Diff.RemovedItems, potion.ID, "The potion should be gone from the floor")
+		require.NoError(t, ws.WriteJSON(Message{Type: MsgAck, Version: msg.Diff.Version}))
+	})
+
+	t.Run("Descend the stairs", func(t *testing.T) {
+		require.NoError(t, ws.WriteJSON(Message{Type: MsgMove, Direction: DirRight}))
+		_, err := reader.next(MsgUpdatePlayer, 2*time.Second)
+		require.NoError(t, err)
+		msg, err := reader.next(MsgFloorDiff, 2*time.Second)
+		require.NoError(t, err)
+		assert.Equal(t, 1, msg.Diff.Level, "Moving should send the changes to the current floor")
+		assert.NotEmpty(t, msg.Diff.Tiles, "The tiles the character moved between should be sent")
+
+		require.NoError(t, ws.WriteJSON(Message{Type: MsgDescend}))
+		msg, err = reader.next(MsgFloorChange, 2*time.Second)
+		require.NoError(t, err)
+		require.NotNil(t, msg.Floor)
+		assert.Equal(t, 2, msg.Floor.Level, "Should arrive on floor 2")
+		assert.NotEmpty(t, msg.Floor.Rooms, "Floor 2 should be generated on arrival")
+
+		msg, err = reader.next(MsgUpdatePlayer, 2*time.Second)
+		require.NoError(t, err)
+		require.NotNil(t, msg.Character)
+		assert.Equal(t, 2, msg.Character.CurrentFloor, "Character should be on floor 2")
+	})
+
+	// The saved character should reflect the run
+	saved, err := characterRepo.GetByID(character.ID)
+	require.NoError(t, err)
+	assert.Equal(t, 2, saved.CurrentFloor)
+	assert.Len(t, saved.Inventory, 1)
+}
+
+// TestClientBatchMessages tests that queued messages are combined into one batch
+func TestWebSocketRejectsOtherAccounts(t *testing.T) {
+	characterRepo := repositories.NewCharacterRepository()
+	dungeonRepo := repositories.NewDungeonRepository()
+
+	owner := models.NewAccount("owner", "")
+	intruder := models.NewAccount("intruder", "")
+	character := models.NewCharacter("TestCharacter", models.Warrior)
+	character.OwnerID = owner.ID
+	characterRepo.Save(character)
+
+	manager := NewGameManager(characterRepo, dungeonRepo)
+	go manager.Start()
+
+	tests := []struct {
+		name    string
+		account *models.Account
+	}{
+		{"Anonymous", nil},
+		{"Other Account", intruder},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if tt.account != nil {
+					r = r.WithContext(auth.WithAccount(r.Context(), tt.account))
+				}
+				manager.HandleConnection(w, r)
+			}))
+			defer server.Close()
+
+			wsURL := "ws" + strings.TrimPrefix(server.URL, "http") + "?characterId=" + character.ID
+			ws, _, err := websocket.DefaultDialer.Dial(wsURL, nil)
+			require.NoError(t, err)
+			defer ws.Close()
+
+			// The server closes the connection without sending any game state
+			ws.SetReadDeadline(time.Now().Add(time.Second))
+			_, _, err = ws.ReadMessage()
+			require.Error(t, err)
+			assert.True(t, websocket.IsCloseError(err, websocket.ClosePolicyViolation), "Expected a policy violation close, got %v", err)
+		})
+	}
+}
+
+func TestClientBatchMessages(t *testing.T) {
+	client := &Client{
+		ID:   "test-client",
+		Send: make(chan Message, 10),
+	}
+
+	// A single message is passed through untouched
+	first := Message{Type: MsgNotification, Text: "first"}
+	assert.Equal(t, first, client.batchMessages(first, 0))
+
+	// Queued messages are wrapped in order
+	client.Send <- Message{Type: MsgNotification, Text: "second"}
+	client.Send <- Message{Type: MsgNotification, Text: "third"}
+	batch := client.batchMessages(first, len(client.Send))
+	assert.Equal(t, MsgBatch, batch.Type)
+	require.Len(t, batch.Messages, 3)
+	assert.Equal(t, "first", batch.Messages[0].Text)
+	assert.Equal(t, "third", batch.Messages[2].Text)
+	assert.Empty(t, client.Send, "The queue should be drained")
+
+	// A closed channel stops the drain without losing what was read
+	client.Send <- Message{Type: MsgNotification, Text: "last"}
+	close(client.Send)
+	batch = client.batchMessages(first, 5)
+	assert.Len(t, batch.Messages, 2)
+}
+
+func TestSendErrorWithFullQueue(t *testing.T) {
+	client := &Client{ID: "test-client", Send: make(chan Message, 1)}
+	client.Send <- Message{Type: MsgNotification}
+
+	done := make(chan struct{})
+	go func() {
+		client.sendError(ErrCodeMissingType, "Message type is required")
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("An error reply should be dropped rather than block on a full queue")
+	}
+	assert.Len(t, client.Send, 1)
+}
+
+// messageReader reads game messages from a test connection, unwrapping batches.
+// What is left of a batch after the message asked for is kept for the next read.
+type messageReader struct {
+	ws      *websocket.Conn
+	pending []Message
+}
+
+// newMessageReader creates a message reader for a test connection
+func newMessageReader(ws *websocket.Conn) *messageReader {
+	return &messageReader{ws: ws}
+}
+
+// next reads until a message of the given type arrives or the timeout expires,
+// discarding messages of other types along the way
+func (r *messageReader) next(msgType MessageType, timeout time.Duration) (Message, error) {
+	r.ws.SetReadDeadline(time.Now().Add(timeout))
+	defer r.ws.SetReadDeadline(time.Time{})
+
+	for {
+		for len(r.pending) > 0 {
+			msg := r.pending[0]
+			r.pending = r.pending[1:]
+			if msg.Type == MsgBatch {
+				r.pending = append(msg.Messages, r.pending...)
+				continue
+			}
+			if msg.Type == msgType {
+				return msg, nil
+			}
+		}
+
+		_, data, err := r.ws.ReadMessage()
+		if err != nil {
+			return Message{}, err
+		}
+
+		var msg Message
+		if err := json.Unmarshal(data, &msg); err != nil {
+			return Message{}, err
+		}
+		r.pending = append(r.pending, msg)
+	}
+}
+
 // mockWebSocketConn is a mock implementation of the websocket.Conn interface
 type mockWebSocketConn struct {
 	readMessageFunc  func() (messageType int, p []byte, err error)
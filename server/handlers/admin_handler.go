@@ -0,0 +1,86 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+	"github.com/jchauncey/TheDeeps/server/auth"
+	"github.com/jchauncey/TheDeeps/server/game"
+	"github.com/jchauncey/TheDeeps/server/models"
+	"github.com/jchauncey/TheDeeps/server/repositories"
+)
+
+// AdminHandler serves read-only views of the server's game data to admins
+type AdminHandler struct {
+	admins      map[string]bool
+	dungeonRepo repositories.DungeonStore
+}
+
+// NewAdminHandler creates an admin handler for the given admin account IDs
+func NewAdminHandler(admins []string, dungeonRepo repositories.DungeonStore) *AdminHandler {
+	handler := &AdminHandler{admins: make(map[string]bool, len(admins)), dungeonRepo: dungeonRepo}
+	for _, accountID := range admins {
+		handler.admins[accountID] = true
+	}
+	return handler
+}
+
+// authorizeAdmin writes an error response and returns false unless the caller is an admin
+func (h *AdminHandler) authorizeAdmin(w http.ResponseWriter, r *http.Request) bool {
+	if err := auth.CheckAdmin(r.Context(), h.admins); err != nil {
+		http.Error(w, err.Error(), auth.StatusCode(err))
+		return false
+	}
+	return true
+}
+
+// GetMonsters handles GET /admin/monsters
+func (h *AdminHandler) GetMonsters(w http.ResponseWriter, r *http.Request) {
+	if !h.authorizeAdmin(w, r) {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(models.Monsters())
+}
+
+// GetFloorStats handles GET /admin/dungeons/{id}/floors/{level}/stats, validating
+// a generated floor and measuring its layout
+func (h *AdminHandler) GetFloorStats(w http.ResponseWriter, r *http.Request) {
+	if !h.authorizeAdmin(w, r) {
+		return
+	}
+
+	vars := mux.Vars(r)
+	level, err := strconv.Atoi(vars["level"])
+	if err != nil {
+		http.Error(w, "Invalid floor level", http.StatusBadRequest)
+		return
+	}
+
+	dungeon, err := h.dungeonRepo.GetByID(vars["id"])
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if level < 1 || level > dungeon.Floors {
+		http.Error(w, "Floor level out of range", http.StatusBadRequest)
+		return
+	}
+
+	// Floors are only generated once someone reaches them
+	floor, err := h.dungeonRepo.GetFloor(dungeon.ID, level)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if len(floor.Rooms) == 0 {
+		http.Error(w, "Floor hasn't been generated yet", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(game.ValidateFloor(floor, level == dungeon.Floors))
+}
@@ -0,0 +1,83 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/jchauncey/TheDeeps/server/game"
+	"github.com/jchauncey/TheDeeps/server/models"
+	"github.com/jchauncey/TheDeeps/server/repositories"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetMonsters(t *testing.T) {
+	admin := models.NewAccount("designer", "")
+	handler := NewAdminHandler([]string{admin.ID}, repositories.NewDungeonRepository())
+
+	// Unauthenticated
+	rr := httptest.NewRecorder()
+	handler.GetMonsters(rr, httptest.NewRequest("GET", "/admin/monsters", nil))
+	assert.Equal(t, http.StatusUnauthorized, rr.Code)
+
+	// Not an admin
+	rr = httptest.NewRecorder()
+	handler.GetMonsters(rr, withAccount(httptest.NewRequest("GET", "/admin/monsters", nil), testAccount))
+	assert.Equal(t, http.StatusForbidden, rr.Code)
+
+	// An account that only shares the admin's username
+	rr = httptest.NewRecorder()
+	impostor := models.NewAccount("designer", "")
+	handler.GetMonsters(rr, withAccount(httptest.NewRequest("GET", "/admin/monsters", nil), impostor))
+	assert.Equal(t, http.StatusForbidden, rr.Code)
+
+	// Admin
+	rr = httptest.NewRecorder()
+	handler.GetMonsters(rr, withAccount(httptest.NewRequest("GET", "/admin/monsters", nil), admin))
+	require.Equal(t, http.StatusOK, rr.Code)
+
+	var catalog models.MonsterCatalog
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &catalog))
+	assert.Len(t, catalog.Monsters, len(models.Monsters().Monsters))
+	assert.Contains(t, catalog.Variants, models.VariantBoss)
+}
+
+func TestGetFloorStats(t *testing.T) {
+	dungeonRepo := repositories.NewDungeonRepository()
+	admin := models.NewAccount("designer", "")
+	handler := NewAdminHandler([]string{admin.ID}, dungeonRepo)
+
+	dungeon := models.NewDungeon("Measured", 3, 12345)
+	game.GenerateDungeonFloor(dungeon, dungeon.GenerateFloor(1))
+	require.NoError(t, dungeonRepo.Save(dungeon))
+
+	getStats := func(account *models.Account, dungeonID, level string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", "/admin/dungeons/"+dungeonID+"/floors/"+level+"/stats", nil)
+		req = mux.SetURLVars(req, map[string]string{"id": dungeonID, "level": level})
+		if account != nil {
+			req = withAccount(req, account)
+		}
+		rr := httptest.NewRecorder()
+		handler.GetFloorStats(rr, req)
+		return rr
+	}
+
+	assert.Equal(t, http.StatusUnauthorized, getStats(nil, dungeon.ID, "1").Code)
+	assert.Equal(t, http.StatusForbidden, getStats(testAccount, dungeon.ID, "1").Code)
+	assert.Equal(t, http.StatusNotFound, getStats(admin, "missing", "1").Code)
+	assert.Equal(t, http.StatusBadRequest, getStats(admin, dungeon.ID, "down").Code)
+	assert.Equal(t, http.StatusBadRequest, getStats(admin, dungeon.ID, "4").Code)
+	assert.Equal(t, http.StatusNotFound, getStats(admin, dungeon.ID, "2").Code, "Nobody has reached the second floor")
+
+	rr := getStats(admin, dungeon.ID, "1")
+	require.Equal(t, http.StatusOK, rr.Code)
+	var stats game.FloorStats
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &stats))
+	assert.True(t, stats.Valid, "Problems: %v", stats.Problems)
+	assert.Equal(t, stats.WalkableTiles, stats.ReachableTiles)
+	assert.Positive(t, stats.RoomTiles)
+	assert.Positive(t, stats.CorridorRatio)
+}
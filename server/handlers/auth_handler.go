@@ -0,0 +1,123 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/jchauncey/TheDeeps/server/auth"
+	"github.com/jchauncey/TheDeeps/server/log"
+	"github.com/jchauncey/TheDeeps/server/models"
+	"github.com/jchauncey/TheDeeps/server/repositories"
+)
+
+// AuthHandler handles account registration and login
+type AuthHandler struct {
+	accountRepo repositories.AccountStore
+	tokens      *auth.TokenManager
+}
+
+// NewAuthHandler creates a new auth handler
+func NewAuthHandler(accountRepo repositories.AccountStore, tokens *auth.TokenManager) *AuthHandler {
+	return &AuthHandler{
+		accountRepo: accountRepo,
+		tokens:      tokens,
+	}
+}
+
+// credentials is the request body for register and login
+type credentials struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
+
+// AuthResponse is returned after a successful register or login
+type AuthResponse struct {
+	Token   string          `json:"token"`
+	Account *models.Account `json:"account"`
+}
+
+// Register handles POST /auth/register
+func (h *AuthHandler) Register(w http.ResponseWriter, r *http.Request) {
+	var request credentials
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	request.Username = strings.TrimSpace(request.Username)
+	if request.Username == "" {
+		http.Error(w, "Username is required", http.StatusBadRequest)
+		return
+	}
+
+	if _, err := h.accountRepo.GetByUsername(request.Username); err == nil {
+		http.Error(w, "Username already taken", http.StatusConflict)
+		return
+	}
+
+	hash, err := auth.HashPassword(request.Password)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	account := models.NewAccount(request.Username, hash)
+	if err := h.accountRepo.Save(account); err != nil {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+
+	log.Info("Registered account %s", account.Username)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(AuthResponse{
+		Token:   h.tokens.Issue(account.ID),
+		Account: account.Public(),
+	})
+}
+
+// Login handles POST /auth/login
+func (h *AuthHandler) Login(w http.ResponseWriter, r *http.Request) {
+	var request credentials
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Use the same error for unknown users and wrong passwords
+	account, err := h.accountRepo.GetByUsername(strings.TrimSpace(request.Username))
+	if err != nil || !auth.CheckPassword(account.PasswordHash, request.Password) {
+		http.Error(w, "Invalid username or password", http.StatusUnauthorized)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(AuthResponse{
+		Token:   h.tokens.Issue(account.ID),
+		Account: account.Public(),
+	})
+}
+
+// GetAccount handles GET /auth/me
+func (h *AuthHandler) GetAccount(w http.ResponseWriter, r *http.Request) {
+	account, ok := auth.AccountFromContext(r.Context())
+	if !ok {
+		http.Error(w, auth.ErrUnauthenticated.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(account.Public())
+}
+
+// authorizeCharacter checks that the requesting account owns the character,
+// writing an error response if it doesn't
+func authorizeCharacter(w http.ResponseWriter, r *http.Request, character *models.Character) bool {
+	if err := auth.CheckOwner(r.Context(), character); err != nil {
+		http.Error(w, err.Error(), auth.StatusCode(err))
+		return false
+	}
+	return true
+}
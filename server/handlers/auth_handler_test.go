@@ -0,0 +1,263 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/gorilla/websocket"
+	"github.com/jchauncey/TheDeeps/server/auth"
+	"github.com/jchauncey/TheDeeps/server/game"
+	"github.com/jchauncey/TheDeeps/server/models"
+	"github.com/jchauncey/TheDeeps/server/repositories"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testAccount owns the characters created by handler tests
+var testAccount = models.NewAccount("tester", "")
+
+// withAccount attaches an account to a request the way the auth middleware does
+func withAccount(req *http.Request, account *models.Account) *http.Request {
+	return req.WithContext(auth.WithAccount(req.Context(), account))
+}
+
+// postCredentials sends a register or login request to the handler
+func postCredentials(handlerFunc http.HandlerFunc, username, password string) *httptest.ResponseRecorder {
+	body, _ := json.Marshal(map[string]string{"username": username, "password": password})
+	req := httptest.NewRequest("POST", "/auth", bytes.NewBuffer(body))
+	rr := httptest.NewRecorder()
+	handlerFunc(rr, req)
+	return rr
+}
+
+func TestRegister(t *testing.T) {
+	accountRepo := repositories.NewAccountRepository()
+	tokens := auth.NewTokenManager([]byte("secret"))
+	handler := NewAuthHandler(accountRepo, tokens)
+
+	rr := postCredentials(handler.Register, "player", "password123")
+	require.Equal(t, http.StatusCreated, rr.Code, rr.Body.String())
+
+	var response AuthResponse
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &response))
+	assert.Equal(t, "player", response.Account.Username)
+	assert.Empty(t, response.Account.PasswordHash, "The password hash should not be returned")
+
+	// The token should identify the new account
+	accountID, err := tokens.Verify(response.Token)
+	require.NoError(t, err)
+	assert.Equal(t, response.Account.ID, accountID)
+
+	// The stored password should be hashed
+	account, err := accountRepo.GetByUsername("player")
+	require.NoError(t, err)
+	assert.NotEqual(t, "password123", account.PasswordHash)
+	assert.True(t, auth.CheckPassword(account.PasswordHash, "password123"))
+}
+
+func TestRegisterValidation(t *testing.T) {
+	handler := NewAuthHandler(repositories.NewAccountRepository(), auth.NewTokenManager([]byte("secret")))
+	require.Equal(t, http.StatusCreated, postCredentials(handler.Register, "player", "password123").Code)
+
+	tests := []struct {
+		name           string
+		username       string
+		password       string
+		expectedStatus int
+	}{
+		{"Missing Username", "  ", "password123", http.StatusBadRequest},
+		{"Short Password", "newplayer", "short", http.StatusBadRequest},
+		{"Duplicate Username", "Player", "password123", http.StatusConflict},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := postCredentials(handler.Register, tt.username, tt.password)
+			assert.Equal(t, tt.expectedStatus, rr.Code)
+		})
+	}
+}
+
+func TestLogin(t *testing.T) {
+	tokens := auth.NewTokenManager([]byte("secret"))
+	handler := NewAuthHandler(repositories.NewAccountRepository(), tokens)
+	require.Equal(t, http.StatusCreated, postCredentials(handler.Register, "player", "password123").Code)
+
+	rr := postCredentials(handler.Login, "player", "password123")
+	require.Equal(t, http.StatusOK, rr.Code)
+
+	var response AuthResponse
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &response))
+	_, err := tokens.Verify(response.Token)
+	assert.NoError(t, err, "Login should return a valid token")
+
+	assert.Equal(t, http.StatusUnauthorized, postCredentials(handler.Login, "player", "wrongpassword").Code)
+	assert.Equal(t, http.StatusUnauthorized, postCredentials(handler.Login, "nobody", "password123").Code)
+}
+
+func TestGetAccount(t *testing.T) {
+	handler := NewAuthHandler(repositories.NewAccountRepository(), auth.NewTokenManager([]byte("secret")))
+
+	rr := httptest.NewRecorder()
+	handler.GetAccount(rr, httptest.NewRequest("GET", "/auth/me", nil))
+	assert.Equal(t, http.StatusUnauthorized, rr.Code)
+
+	rr = httptest.NewRecorder()
+	handler.GetAccount(rr, withAccount(httptest.NewRequest("GET", "/auth/me", nil), testAccount))
+	require.Equal(t, http.StatusOK, rr.Code)
+
+	var account models.Account
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &account))
+	assert.Equal(t, testAccount.ID, account.ID)
+}
+
+// TestCharacterOwnership runs every character route through the real middleware
+// and checks that only the owner gets through
+func TestCharacterOwnership(t *testing.T) {
+	accountRepo := repositories.NewAccountRepository()
+	characterRepo := repositories.NewCharacterRepository()
+	dungeonRepo := repositories.NewDungeonRepository()
+	inventoryRepo := repositories.NewInventoryRepository()
+	tokens := auth.NewTokenManager([]byte("secret"))
+
+	owner := models.NewAccount("owner", "")
+	intruder := models.NewAccount("intruder", "")
+	require.NoError(t, accountRepo.Save(owner))
+	require.NoError(t, accountRepo.Save(intruder))
+
+	character := models.NewCharacter("Owned", models.Warrior)
+	character.OwnerID = owner.ID
+	require.NoError(t, characterRepo.Save(character))
+
+	dungeon := models.NewDungeon("Dungeon", 1, 12345)
+	require.NoError(t, dungeonRepo.Save(dungeon))
+
+	characterHandler := NewCharacterHandler(characterRepo, dungeonRepo, nil)
+	dungeonHandler := NewDungeonHandler(dungeonRepo, characterRepo, nil)
+	combatHandler := NewCombatHandler(characterRepo, dungeonRepo, nil)
+	inventoryHandler := NewInventoryHandler(characterRepo, inventoryRepo)
+	partyHandler := NewPartyHandler(characterRepo, game.NewPartyManager(characterRepo, dungeonRepo))
+	shopHandler := NewShopHandler(characterRepo, game.NewShopManager(characterRepo, dungeonRepo))
+
+	router := mux.NewRouter()
+	router.Use(auth.Middleware(tokens, accountRepo))
+	router.HandleFunc("/characters/{id}", characterHandler.GetCharacter).Methods("GET")
+	router.HandleFunc("/characters/{id}", characterHandler.DeleteCharacter).Methods("DELETE")
+	router.HandleFunc("/characters/{id}/checkpoint", characterHandler.Checkpoint).Methods("POST")
+	router.HandleFunc("/characters/{id}/floor", characterHandler.GetCharacterFloor).Methods("GET")
+	router.HandleFunc("/characters/{id}/abilities", characterHandler.GetCharacterAbilities).Methods("GET")
+	router.HandleFunc("/characters/{id}/combat", combatHandler.GetCombatState).Methods("GET")
+	router.HandleFunc("/dungeons/{id}/join", dungeonHandler.JoinDungeon).Methods("POST")
+	router.HandleFunc("/characters/{id}/party", partyHandler.GetParty).Methods("GET")
+	router.HandleFunc("/characters/{id}/party/invite", partyHandler.Invite).Methods("POST")
+	router.HandleFunc("/characters/{id}/party/leave", partyHandler.Leave).Methods("POST")
+	router.HandleFunc("/characters/{id}/party/loot", partyHandler.SetLootRule).Methods("PUT")
+	router.HandleFunc("/characters/{id}/shop", shopHandler.GetShop).Methods("GET")
+	router.HandleFunc("/characters/{id}/shop/buy", shopHandler.Buy).Methods("POST")
+	router.HandleFunc("/characters/{id}/shop/haggle", shopHandler.Haggle).Methods("POST")
+	inventoryHandler.RegisterRoutes(router)
+
+	routes := []struct {
+		method string
+		path   string
+		body   string
+	}{
+		{"GET", "/characters/" + character.ID, ""},
+		{"DELETE", "/characters/" + character.ID, ""},
+		{"POST", "/characters/" + character.ID + "/checkpoint", "{}"},
+		{"GET", "/characters/" + character.ID + "/floor", ""},
+		{"GET", "/characters/" + character.ID + "/abilities", ""},
+		{"GET", "/characters/" + character.ID + "/combat", ""},
+		{"POST", "/dungeons/" + dungeon.ID + "/join", `{"characterId":"` + character.ID + `"}`},
+		{"GET", "/characters/" + character.ID + "/party", ""},
+		{"POST", "/characters/" + character.ID + "/party/invite", `{"characterId":"other"}`},
+		{"POST", "/characters/" + character.ID + "/party/leave", ""},
+		{"PUT", "/characters/" + character.ID + "/party/loot", `{"lootRule":"roundRobin"}`},
+		{"GET", "/characters/" + character.ID + "/shop", ""},
+		{"POST", "/characters/" + character.ID + "/shop/buy", `{"itemId":"item"}`},
+		{"POST", "/characters/" + character.ID + "/shop/haggle", ""},
+		{"GET", "/api/characters/" + character.ID + "/inventory", ""},
+		{"GET", "/api/characters/" + character.ID + "/equipment", ""},
+		{"GET", "/api/characters/" + character.ID + "/weight", ""},
+		{"POST", "/api/characters/" + character.ID + "/inventory/item/use", ""},
+		{"POST", "/api/characters/" + character.ID + "/inventory/add", `{"itemID":"item"}`},
+	}
+
+	for _, route := range routes {
+		t.Run(route.method+" "+route.path, func(t *testing.T) {
+			// No token
+			req := httptest.NewRequest(route.method, route.path, bytes.NewBufferString(route.body))
+			rr := httptest.NewRecorder()
+			router.ServeHTTP(rr, req)
+			assert.Equal(t, http.StatusUnauthorized, rr.Code, "Anonymous requests should be rejected")
+
+			// Someone else's token
+			req = httptest.NewRequest(route.method, route.path, bytes.NewBufferString(route.body))
+			req.Header.Set("Authorization", "Bearer "+tokens.Issue(intruder.ID))
+			rr = httptest.NewRecorder()
+			router.ServeHTTP(rr, req)
+			assert.Equal(t, http.StatusForbidden, rr.Code, "Other accounts should be rejected")
+		})
+	}
+
+	// The owner can still reach the character
+	req := httptest.NewRequest("GET", "/characters/"+character.ID, nil)
+	req.Header.Set("Authorization", "Bearer "+tokens.Issue(owner.ID))
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	_, err := characterRepo.GetByID(character.ID)
+	assert.NoError(t, err, "Rejected deletes should leave the character in place")
+}
+
+func TestGetCharactersOnlyReturnsOwnCharacters(t *testing.T) {
+	repo := repositories.NewCharacterRepository()
+	handler := NewCharacterHandler(repo, repositories.NewDungeonRepository(), nil)
+
+	mine := models.NewCharacter("Mine", models.Warrior)
+	mine.OwnerID = testAccount.ID
+	theirs := models.NewCharacter("Theirs", models.Mage)
+	theirs.OwnerID = "someone-else"
+	repo.Save(mine)
+	repo.Save(theirs)
+
+	rr := httptest.NewRecorder()
+	handler.GetCharacters(rr, withAccount(httptest.NewRequest("GET", "/characters", nil), testAccount))
+	require.Equal(t, http.StatusOK, rr.Code)
+
+	var characters []*models.Character
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &characters))
+	require.Len(t, characters, 1)
+	assert.Equal(t, mine.ID, characters[0].ID)
+}
+
+func TestHandleCombatRejectsOtherAccounts(t *testing.T) {
+	characterRepo := repositories.NewCharacterRepository()
+	dungeonRepo := repositories.NewDungeonRepository()
+	combatHandler := NewCombatHandler(characterRepo, dungeonRepo, nil)
+
+	character := models.NewCharacter("Owned", models.Warrior)
+	character.OwnerID = "someone-else"
+	characterRepo.Save(character)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		combatHandler.HandleCombat(w, withAccount(r, testAccount))
+	}))
+	defer server.Close()
+
+	ws, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http"), nil)
+	require.NoError(t, err)
+	defer ws.Close()
+
+	require.NoError(t, ws.WriteJSON(CombatMessage{Action: "attack", CharacterID: character.ID, MobID: "mob"}))
+
+	var response CombatResponse
+	require.NoError(t, ws.ReadJSON(&response))
+	assert.False(t, response.Success)
+	assert.Equal(t, auth.ErrNotOwner.Error(), response.Message)
+}
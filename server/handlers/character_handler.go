@@ -5,25 +5,51 @@ import (
 	"net/http"
 
 	"github.com/gorilla/mux"
+	"github.com/jchauncey/TheDeeps/server/auth"
+	"github.com/jchauncey/TheDeeps/server/game"
 	"github.com/jchauncey/TheDeeps/server/models"
+	"github.com/jchauncey/TheDeeps/server/pathfinding"
 	"github.com/jchauncey/TheDeeps/server/repositories"
 )
 
+// maxCheckpointSteps is how far a checkpoint can move a character, in steps
+// around walls, closed doors and whoever is in the way
+const maxCheckpointSteps = 5
+
 // CharacterHandler handles character-related HTTP requests
 type CharacterHandler struct {
-	characterRepo *repositories.CharacterRepository
+	characterRepo repositories.CharacterStore
+	dungeonRepo   repositories.DungeonStore
+	gameManager   *game.GameManager // Checkpoints move characters through the game, under its world lock
 }
 
-// NewCharacterHandler creates a new character handler
-func NewCharacterHandler(characterRepo *repositories.CharacterRepository) *CharacterHandler {
+// NewCharacterHandler creates a new character handler. Without a game manager
+// it gets one of its own, so checkpoints still run the game's rules.
+func NewCharacterHandler(characterRepo repositories.CharacterStore, dungeonRepo repositories.DungeonStore, gameManager *game.GameManager) *CharacterHandler {
+	if gameManager == nil {
+		gameManager = game.NewGameManager(characterRepo, dungeonRepo)
+	}
 	return &CharacterHandler{
 		characterRepo: characterRepo,
+		dungeonRepo:   dungeonRepo,
+		gameManager:   gameManager,
 	}
 }
 
-// GetCharacters handles GET /characters
+// GetCharacters handles GET /characters and returns the caller's characters
 func (h *CharacterHandler) GetCharacters(w http.ResponseWriter, r *http.Request) {
-	characters := h.characterRepo.GetAll()
+	account, ok := auth.AccountFromContext(r.Context())
+	if !ok {
+		http.Error(w, auth.ErrUnauthenticated.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	characters := make([]*models.Character, 0)
+	for _, character := range h.characterRepo.GetAll() {
+		if account.Owns(character) {
+			characters = append(characters, character)
+		}
+	}
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(characters)
@@ -40,14 +66,30 @@ func (h *CharacterHandler) GetCharacter(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
+	if !authorizeCharacter(w, r, character) {
+		return
+	}
+
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(character)
 }
 
 // CreateCharacter handles POST /characters
 func (h *CharacterHandler) CreateCharacter(w http.ResponseWriter, r *http.Request) {
-	// Check if we've reached the character limit
-	if h.characterRepo.Count() >= 10 {
+	account, ok := auth.AccountFromContext(r.Context())
+	if !ok {
+		http.Error(w, auth.ErrUnauthenticated.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	// Check if the account has reached the character limit
+	owned := 0
+	for _, character := range h.characterRepo.GetAll() {
+		if account.Owns(character) {
+			owned++
+		}
+	}
+	if owned >= 10 {
 		http.Error(w, "Maximum number of characters reached (10)", http.StatusBadRequest)
 		return
 	}
@@ -72,6 +114,7 @@ func (h *CharacterHandler) CreateCharacter(w http.ResponseWriter, r *http.Reques
 
 	// Create character
 	character := models.NewCharacter(request.Name, request.Class)
+	character.OwnerID = account.ID
 
 	// Apply custom attributes if provided
 	if request.Attributes.Strength > 0 {
@@ -116,6 +159,16 @@ func (h *CharacterHandler) DeleteCharacter(w http.ResponseWriter, r *http.Reques
 	vars := mux.Vars(r)
 	id := vars["id"]
 
+	character, err := h.characterRepo.GetByID(id)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	if !authorizeCharacter(w, r, character) {
+		return
+	}
+
 	if err := h.characterRepo.Delete(id); err != nil {
 		http.Error(w, err.Error(), http.StatusNotFound)
 		return
@@ -124,8 +177,35 @@ func (h *CharacterHandler) DeleteCharacter(w http.ResponseWriter, r *http.Reques
 	w.WriteHeader(http.StatusNoContent)
 }
 
-// SaveCharacter handles POST /characters/{id}/save
-func (h *CharacterHandler) SaveCharacter(w http.ResponseWriter, r *http.Request) {
+// CheckpointRequest is the character state a client asks the server to confirm.
+// Only the position can change through a checkpoint; every other field is
+// optional and, when sent, must match what the server already has.
+type CheckpointRequest struct {
+	Position       *models.Position `json:"position,omitempty"`
+	CurrentHP      *int             `json:"currentHp,omitempty"`
+	CurrentMana    *int             `json:"currentMana,omitempty"`
+	Gold           *int             `json:"gold,omitempty"`
+	Experience     *int             `json:"experience,omitempty"`
+	CurrentFloor   *int             `json:"currentFloor,omitempty"`
+	CurrentDungeon *string          `json:"currentDungeon,omitempty"`
+}
+
+// CheckpointRejection describes a submitted field the server refused
+type CheckpointRejection struct {
+	Field     string      `json:"field"`
+	Submitted interface{} `json:"submitted"`
+	Server    interface{} `json:"server"`
+	Reason    string      `json:"reason"`
+}
+
+// CheckpointErrorResponse is returned when any part of a checkpoint is rejected
+type CheckpointErrorResponse struct {
+	Error    string                `json:"error"`
+	Rejected []CheckpointRejection `json:"rejected"`
+}
+
+// Checkpoint handles POST /characters/{id}/checkpoint
+func (h *CharacterHandler) Checkpoint(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	id := vars["id"]
 
@@ -136,30 +216,35 @@ func (h *CharacterHandler) SaveCharacter(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	// Parse request body
-	var request struct {
-		Position       models.Position `json:"position"`
-		CurrentHP      int             `json:"currentHp"`
-		CurrentMana    int             `json:"currentMana"`
-		Gold           int             `json:"gold"`
-		Experience     int             `json:"experience"`
-		CurrentFloor   int             `json:"currentFloor"`
-		CurrentDungeon string          `json:"currentDungeon"`
+	if !authorizeCharacter(w, r, character) {
+		return
 	}
 
+	var request CheckpointRequest
 	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
-	// Update character
-	character.Position = request.Position
-	character.CurrentHP = request.CurrentHP
-	character.CurrentMana = request.CurrentMana
-	character.Gold = request.Gold
-	character.Experience = request.Experience
-	character.CurrentFloor = request.CurrentFloor
-	character.CurrentDungeon = request.CurrentDungeon
+	// The checkpoint is checked and applied in one turn of the game
+	h.gameManager.World.Lock()
+	defer h.gameManager.World.Unlock()
+
+	// Nothing is applied unless the whole checkpoint is valid
+	rejected, floor := h.validateCheckpoint(character, request)
+	if len(rejected) > 0 {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		json.NewEncoder(w).Encode(CheckpointErrorResponse{
+			Error:    "checkpoint rejected",
+			Rejected: rejected,
+		})
+		return
+	}
+
+	if request.Position != nil && *request.Position != character.Position {
+		h.gameManager.MoveCharacter(floor, character, *request.Position)
+	}
 
 	// Save character
 	if err := h.characterRepo.Save(character); err != nil {
@@ -172,6 +257,86 @@ func (h *CharacterHandler) SaveCharacter(w http.ResponseWriter, r *http.Request)
 	json.NewEncoder(w).Encode(character)
 }
 
+// validateCheckpoint compares a checkpoint with the server's state. It returns
+// every rejected field, and the character's floor when a position was checked.
+func (h *CharacterHandler) validateCheckpoint(character *models.Character, request CheckpointRequest) ([]CheckpointRejection, *models.Floor) {
+	rejected := make([]CheckpointRejection, 0)
+
+	// Stats only change through server-side game actions
+	serverOnly := []struct {
+		field     string
+		submitted *int
+		server    int
+	}{
+		{"currentHp", request.CurrentHP, character.CurrentHP},
+		{"currentMana", request.CurrentMana, character.CurrentMana},
+		{"gold", request.Gold, character.Gold},
+		{"experience", request.Experience, character.Experience},
+		{"currentFloor", request.CurrentFloor, character.CurrentFloor},
+	}
+	for _, stat := range serverOnly {
+		if stat.submitted != nil && *stat.submitted != stat.server {
+			rejected = append(rejected, CheckpointRejection{
+				Field:     stat.field,
+				Submitted: *stat.submitted,
+				Server:    stat.server,
+				Reason:    stat.field + " can only change through game actions",
+			})
+		}
+	}
+
+	if request.CurrentDungeon != nil && *request.CurrentDungeon != character.CurrentDungeon {
+		rejected = append(rejected, CheckpointRejection{
+			Field:     "currentDungeon",
+			Submitted: *request.CurrentDungeon,
+			Server:    character.CurrentDungeon,
+			Reason:    "dungeons can only be changed by joining one",
+		})
+	}
+
+	if request.Position == nil || *request.Position == character.Position {
+		return rejected, nil
+	}
+
+	// The position must be a free tile a few steps from the character on their
+	// real floor. Every refusal gives the same reason, so checkpoints can't be
+	// used to probe the map.
+	reject := func(reason string) {
+		rejected = append(rejected, CheckpointRejection{
+			Field:     "position",
+			Submitted: *request.Position,
+			Server:    character.Position,
+			Reason:    reason,
+		})
+	}
+
+	if character.CurrentDungeon == "" {
+		reject("character is not in a dungeon")
+		return rejected, nil
+	}
+	if character.IsDead() {
+		reject("character is dead")
+		return rejected, nil
+	}
+
+	floor, err := h.dungeonRepo.GetFloor(character.CurrentDungeon, character.CurrentFloor)
+	if err != nil {
+		reject("character's floor not found")
+		return rejected, nil
+	}
+
+	pos := *request.Position
+	path, reachable := pathfinding.FindPath(floor, character.Position, pos, pathfinding.Options{
+		MaxCost: maxCheckpointSteps * pathfinding.TrapCost,
+	})
+	if !reachable || len(path) > maxCheckpointSteps ||
+		floor.Tiles[pos.Y][pos.X].MobID != "" || floor.Tiles[pos.Y][pos.X].Character != "" {
+		reject("position can't be reached from the character's position")
+	}
+
+	return rejected, floor
+}
+
 // GetCharacterFloor handles GET /characters/{id}/floor
 func (h *CharacterHandler) GetCharacterFloor(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
@@ -184,9 +349,49 @@ func (h *CharacterHandler) GetCharacterFloor(w http.ResponseWriter, r *http.Requ
 		return
 	}
 
+	if !authorizeCharacter(w, r, character) {
+		return
+	}
+
 	// Return floor
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]int{
 		"floor": character.CurrentFloor,
 	})
 }
+
+// AbilityStatus is an ability a character knows and whether they can use it now
+type AbilityStatus struct {
+	models.Ability
+	CooldownLeft int  `json:"cooldownLeft"` // Turns before it can be used again
+	Ready        bool `json:"ready"`
+}
+
+// GetCharacterAbilities handles GET /characters/{id}/abilities
+func (h *CharacterHandler) GetCharacterAbilities(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id := vars["id"]
+
+	character, err := h.characterRepo.GetByID(id)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	if !authorizeCharacter(w, r, character) {
+		return
+	}
+
+	abilities := make([]AbilityStatus, 0)
+	for _, ability := range character.KnownAbilities() {
+		_, err := character.CanCast(ability.ID)
+		abilities = append(abilities, AbilityStatus{
+			Ability:      ability,
+			CooldownLeft: character.Cooldowns[ability.ID],
+			Ready:        err == nil,
+		})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(abilities)
+}
@@ -10,6 +10,7 @@ import (
 	"testing"
 
 	"github.com/gorilla/mux"
+	"github.com/jchauncey/TheDeeps/server/game"
 	"github.com/jchauncey/TheDeeps/server/models"
 	"github.com/jchauncey/TheDeeps/server/repositories"
 	"github.com/stretchr/testify/assert"
@@ -72,7 +73,7 @@ func TestCreateCharacter(t *testing.T) {
 	repo := repositories.NewCharacterRepository()
 
 	// Create handler with the repository
-	handler := NewCharacterHandler(repo)
+	handler := NewCharacterHandler(repo, repositories.NewDungeonRepository(), nil)
 
 	tests := []struct {
 		name           string
@@ -161,7 +162,7 @@ func TestCreateCharacter(t *testing.T) {
 			rr := httptest.NewRecorder()
 
 			// Call handler
-			handler.CreateCharacter(rr, req)
+			handler.CreateCharacter(rr, withAccount(req, testAccount))
 
 			// Check status code
 			assert.Equal(t, tt.expectedStatus, rr.Code, "Status code should match expected")
@@ -179,10 +180,11 @@ func TestGetCharacter(t *testing.T) {
 
 	// Create a test character
 	character := models.NewCharacter("Test Character", models.Warrior)
+	character.OwnerID = testAccount.ID
 	repo.Save(character)
 
 	// Create handler with the repository
-	handler := NewCharacterHandler(repo)
+	handler := NewCharacterHandler(repo, repositories.NewDungeonRepository(), nil)
 
 	tests := []struct {
 		name           string
@@ -231,7 +233,7 @@ func TestGetCharacter(t *testing.T) {
 			rr := httptest.NewRecorder()
 
 			// Call handler
-			handler.GetCharacter(rr, req)
+			handler.GetCharacter(rr, withAccount(req, testAccount))
 
 			// Check status code
 			assert.Equal(t, tt.expectedStatus, rr.Code, "Status code should match expected")
@@ -249,12 +251,14 @@ func TestGetCharacters(t *testing.T) {
 
 	// Create test characters
 	character1 := models.NewCharacter("Character 1", models.Warrior)
+	character1.OwnerID = testAccount.ID
 	character2 := models.NewCharacter("Character 2", models.Mage)
+	character2.OwnerID = testAccount.ID
 	repo.Save(character1)
 	repo.Save(character2)
 
 	// Create handler with the repository
-	handler := NewCharacterHandler(repo)
+	handler := NewCharacterHandler(repo, repositories.NewDungeonRepository(), nil)
 
 	// Create request
 	req, err := http.NewRequest("GET", "/characters", nil)
@@ -264,7 +268,7 @@ func TestGetCharacters(t *testing.T) {
 	rr := httptest.NewRecorder()
 
 	// Call handler
-	handler.GetCharacters(rr, req)
+	handler.GetCharacters(rr, withAccount(req, testAccount))
 
 	// Check status code
 	assert.Equal(t, http.StatusOK, rr.Code, "Status code should be OK")
@@ -303,10 +307,11 @@ func TestDeleteCharacter(t *testing.T) {
 
 	// Create a test character
 	character := models.NewCharacter("Test Character", models.Warrior)
+	character.OwnerID = testAccount.ID
 	repo.Save(character)
 
 	// Create handler with the repository
-	handler := NewCharacterHandler(repo)
+	handler := NewCharacterHandler(repo, repositories.NewDungeonRepository(), nil)
 
 	tests := []struct {
 		name           string
@@ -338,7 +343,7 @@ func TestDeleteCharacter(t *testing.T) {
 		t.Run(tt.name, func(t *testing.T) {
 			// Reset repository for each test
 			repo = repositories.NewCharacterRepository()
-			handler = NewCharacterHandler(repo)
+			handler = NewCharacterHandler(repo, repositories.NewDungeonRepository(), nil)
 
 			// Add test character
 			if tt.name == "Valid Character ID" {
@@ -358,7 +363,7 @@ func TestDeleteCharacter(t *testing.T) {
 			rr := httptest.NewRecorder()
 
 			// Call handler
-			handler.DeleteCharacter(rr, req)
+			handler.DeleteCharacter(rr, withAccount(req, testAccount))
 
 			// Check status code
 			assert.Equal(t, tt.expectedStatus, rr.Code, "Status code should match expected")
@@ -375,7 +380,7 @@ func TestNewCharacterHandler(t *testing.T) {
 	repo := repositories.NewCharacterRepository()
 
 	// Create handler using the constructor
-	handler := NewCharacterHandler(repo)
+	handler := NewCharacterHandler(repo, repositories.NewDungeonRepository(), nil)
 
 	// Verify handler is initialized correctly
 	assert.NotNil(t, handler, "Handler should not be nil")
@@ -385,112 +390,296 @@ func TestNewCharacterHandler(t *testing.T) {
 	assert.Same(t, repo, handler.characterRepo, "Character repository should be the same instance")
 }
 
-// TestSaveCharacter tests the SaveCharacter handler
-func TestSaveCharacter(t *testing.T) {
-	// Create a repository
-	repo := repositories.NewCharacterRepository()
-
-	// Create a test character
-	character := models.NewCharacter("Test Character", models.Warrior)
-	repo.Save(character)
-
-	// Create handler with the repository
-	handler := NewCharacterHandler(repo)
-
+// TestCheckpoint tests the Checkpoint handler
+func TestCheckpoint(t *testing.T) {
 	tests := []struct {
 		name           string
-		characterID    string
-		requestBody    interface{}
+		requestBody    string
+		notInDungeon   bool
+		dead           bool
 		expectedStatus int
-		validateFunc   func(t *testing.T, resp *httptest.ResponseRecorder)
+		expectedFields []string
+		expectedPos    models.Position
 	}{
 		{
-			name:        "Valid Save",
-			characterID: character.ID,
-			requestBody: map[string]interface{}{
-				"position": map[string]interface{}{
-					"x": 10,
-					"y": 15,
-				},
-			},
+			name:           "Valid Move",
+			requestBody:    `{"position":{"x":3,"y":4}}`,
 			expectedStatus: http.StatusOK,
-			validateFunc: func(t *testing.T, resp *httptest.ResponseRecorder) {
-				var updatedChar models.Character
-				err := json.Unmarshal(resp.Body.Bytes(), &updatedChar)
-				require.NoError(t, err, "Failed to unmarshal response")
-
-				// Validate updated character properties
-				assert.Equal(t, character.ID, updatedChar.ID, "Character ID should match")
-				assert.Equal(t, 10, updatedChar.Position.X, "X position should be updated")
-				assert.Equal(t, 15, updatedChar.Position.Y, "Y position should be updated")
-			},
+			expectedPos:    models.Position{X: 3, Y: 4},
 		},
 		{
-			name:        "Invalid Character ID",
-			characterID: "invalid-id",
-			requestBody: map[string]interface{}{
-				"position": map[string]interface{}{
-					"x": 10,
-					"y": 15,
-				},
-			},
-			expectedStatus: http.StatusNotFound,
-			validateFunc: func(t *testing.T, resp *httptest.ResponseRecorder) {
-				// Check error message in response body
-				assert.NotEmpty(t, resp.Body.String(), "Expected error message in response")
-			},
+			name:           "Matching Stats Are Accepted",
+			requestBody:    `{"position":{"x":3,"y":4},"gold":10,"currentHp":27,"currentFloor":1}`,
+			expectedStatus: http.StatusOK,
+			expectedPos:    models.Position{X: 3, Y: 4},
+		},
+		{
+			name:           "Gold And Experience Rejected",
+			requestBody:    `{"position":{"x":3,"y":4},"gold":99999,"experience":5000}`,
+			expectedStatus: http.StatusUnprocessableEntity,
+			expectedFields: []string{"gold", "experience"},
+			expectedPos:    models.Position{X: 2, Y: 2},
+		},
+		{
+			name:           "HP And Dungeon Rejected",
+			requestBody:    `{"currentHp":999,"currentDungeon":"elsewhere"}`,
+			expectedStatus: http.StatusUnprocessableEntity,
+			expectedFields: []string{"currentHp", "currentDungeon"},
+			expectedPos:    models.Position{X: 2, Y: 2},
+		},
+		{
+			name:           "Wall Rejected",
+			requestBody:    `{"position":{"x":0,"y":3}}`,
+			expectedStatus: http.StatusUnprocessableEntity,
+			expectedFields: []string{"position"},
+			expectedPos:    models.Position{X: 2, Y: 2},
+		},
+		{
+			name:           "Out Of Bounds Rejected",
+			requestBody:    `{"position":{"x":50,"y":3}}`,
+			expectedStatus: http.StatusUnprocessableEntity,
+			expectedFields: []string{"position"},
+			expectedPos:    models.Position{X: 2, Y: 2},
+		},
+		{
+			name:           "Mob Tile Rejected",
+			requestBody:    `{"position":{"x":5,"y":5}}`,
+			expectedStatus: http.StatusUnprocessableEntity,
+			expectedFields: []string{"position"},
+			expectedPos:    models.Position{X: 2, Y: 2},
+		},
+		{
+			name:           "Too Far Rejected",
+			requestBody:    `{"position":{"x":6,"y":6}}`,
+			expectedStatus: http.StatusUnprocessableEntity,
+			expectedFields: []string{"position"},
+			expectedPos:    models.Position{X: 2, Y: 2},
+		},
+		{
+			name:           "Dead Character Rejected",
+			requestBody:    `{"position":{"x":2,"y":3}}`,
+			dead:           true,
+			expectedStatus: http.StatusUnprocessableEntity,
+			expectedFields: []string{"position"},
+			expectedPos:    models.Position{X: 2, Y: 2},
+		},
+		{
+			name:           "Not In A Dungeon",
+			requestBody:    `{"position":{"x":3,"y":3}}`,
+			notInDungeon:   true,
+			expectedStatus: http.StatusUnprocessableEntity,
+			expectedFields: []string{"position"},
+			expectedPos:    models.Position{X: 2, Y: 2},
 		},
 		{
 			name:           "Invalid Request Body",
-			characterID:    character.ID,
-			requestBody:    nil, // This will cause JSON decoding to fail
+			requestBody:    `{invalid json`,
 			expectedStatus: http.StatusBadRequest,
-			validateFunc: func(t *testing.T, resp *httptest.ResponseRecorder) {
-				// Check error message in response body
-				assert.NotEmpty(t, resp.Body.String(), "Expected error message in response")
-			},
+			expectedPos:    models.Position{X: 2, Y: 2},
 		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			// Create request
-			var reqBody []byte
-			var err error
-
-			if tt.requestBody != nil {
-				reqBody, err = json.Marshal(tt.requestBody)
-				require.NoError(t, err, "Failed to marshal request body")
-			} else {
-				// Create an invalid JSON for the "Invalid Request Body" test
-				reqBody = []byte("{invalid json")
+			characterRepo := repositories.NewCharacterRepository()
+			dungeonRepo := repositories.NewDungeonRepository()
+			floor := newWalledFloor(8, 8)
+			floor.Tiles[5][5].MobID = "mob-1"
+			character := placeCharacter(characterRepo, dungeonRepo, floor, 2, 2)
+			character.Gold = 10
+			if tt.notInDungeon {
+				character.CurrentDungeon = ""
 			}
+			if tt.dead {
+				character.CurrentHP = 0
+			}
+			handler := NewCharacterHandler(characterRepo, dungeonRepo, nil)
 
-			req, err := http.NewRequest("POST", "/characters/"+tt.characterID+"/save", bytes.NewBuffer(reqBody))
+			req, err := http.NewRequest("POST", "/characters/"+character.ID+"/checkpoint", bytes.NewBufferString(tt.requestBody))
 			require.NoError(t, err, "Failed to create request")
+			req = mux.SetURLVars(req, map[string]string{"id": character.ID})
 
-			req.Header.Set("Content-Type", "application/json")
-
-			// Set up router context with character ID
-			req = mux.SetURLVars(req, map[string]string{
-				"id": tt.characterID,
-			})
-
-			// Create response recorder
 			rr := httptest.NewRecorder()
+			handler.Checkpoint(rr, withAccount(req, testAccount))
 
-			// Call handler
-			handler.SaveCharacter(rr, req)
+			assert.Equal(t, tt.expectedStatus, rr.Code, rr.Body.String())
+			assert.Equal(t, tt.expectedPos, character.Position, "Position should only change on success")
+			assert.Equal(t, 10, character.Gold, "Gold should never change through a checkpoint")
 
-			// Check status code
-			assert.Equal(t, tt.expectedStatus, rr.Code, "Status code should match expected")
+			if tt.expectedStatus == http.StatusOK {
+				assert.Empty(t, floor.Tiles[2][2].Character, "The old tile should be cleared")
+				assert.Equal(t, character.ID, floor.Tiles[tt.expectedPos.Y][tt.expectedPos.X].Character, "The new tile should reference the character")
+			}
 
-			// Run validation function
-			tt.validateFunc(t, rr)
+			if len(tt.expectedFields) > 0 {
+				var response CheckpointErrorResponse
+				require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &response))
+				assert.Equal(t, "checkpoint rejected", response.Error)
+
+				fields := make([]string, 0, len(response.Rejected))
+				for _, rejection := range response.Rejected {
+					fields = append(fields, rejection.Field)
+					assert.NotEmpty(t, rejection.Reason)
+				}
+				assert.ElementsMatch(t, tt.expectedFields, fields)
+			}
 		})
 	}
 }
 
+// TestCheckpointRejectionDiff tests that rejections report both values
+func TestCheckpointRejectionDiff(t *testing.T) {
+	characterRepo := repositories.NewCharacterRepository()
+	dungeonRepo := repositories.NewDungeonRepository()
+	floor := newWalledFloor(8, 8)
+	character := placeCharacter(characterRepo, dungeonRepo, floor, 2, 2)
+	character.Gold = 10
+	handler := NewCharacterHandler(characterRepo, dungeonRepo, nil)
+
+	req, err := http.NewRequest("POST", "/characters/"+character.ID+"/checkpoint", bytes.NewBufferString(`{"gold":500}`))
+	require.NoError(t, err)
+	req = mux.SetURLVars(req, map[string]string{"id": character.ID})
+
+	rr := httptest.NewRecorder()
+	handler.Checkpoint(rr, withAccount(req, testAccount))
+	require.Equal(t, http.StatusUnprocessableEntity, rr.Code)
+
+	var response CheckpointErrorResponse
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &response))
+	require.Len(t, response.Rejected, 1)
+	assert.Equal(t, "gold", response.Rejected[0].Field)
+	assert.EqualValues(t, 500, response.Rejected[0].Submitted)
+	assert.EqualValues(t, 10, response.Rejected[0].Server)
+}
+
+// postCheckpoint sends a checkpoint for a character and returns the response
+func postCheckpoint(t *testing.T, handler *CharacterHandler, character *models.Character, body string) *httptest.ResponseRecorder {
+	req, err := http.NewRequest("POST", "/characters/"+character.ID+"/checkpoint", bytes.NewBufferString(body))
+	require.NoError(t, err)
+	req = mux.SetURLVars(req, map[string]string{"id": character.ID})
+
+	rr := httptest.NewRecorder()
+	handler.Checkpoint(rr, withAccount(req, testAccount))
+	return rr
+}
+
+// TestCheckpointDoors tests that checkpoints can't pass through closed doors
+func TestCheckpointDoors(t *testing.T) {
+	characterRepo := repositories.NewCharacterRepository()
+	dungeonRepo := repositories.NewDungeonRepository()
+	floor := newWalledFloor(8, 8)
+	character := placeCharacter(characterRepo, dungeonRepo, floor, 2, 2)
+	handler := NewCharacterHandler(characterRepo, dungeonRepo, nil)
+
+	// Wall the floor in two, with a door between the halves
+	for y := 1; y < floor.Height-1; y++ {
+		floor.Tiles[y][4] = models.Tile{Type: models.TileWall}
+	}
+	door := models.NewDoor(models.Position{X: 4, Y: 2})
+	floor.Doors = map[string]*models.Door{door.ID: door}
+	floor.Tiles[2][4] = models.Tile{Type: models.TileDoor, DoorID: door.ID}
+
+	rr := postCheckpoint(t, handler, character, `{"position":{"x":5,"y":2}}`)
+	assert.Equal(t, http.StatusUnprocessableEntity, rr.Code, "A closed door should block the way")
+	assert.Equal(t, models.Position{X: 2, Y: 2}, character.Position)
+
+	door.Open = true
+	floor.Tiles[2][4].Walkable = true
+	rr = postCheckpoint(t, handler, character, `{"position":{"x":5,"y":2}}`)
+	assert.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+	assert.Equal(t, models.Position{X: 5, Y: 2}, character.Position)
+}
+
+// TestCheckpointHidesMap tests that refused positions all give the same reason
+func TestCheckpointHidesMap(t *testing.T) {
+	characterRepo := repositories.NewCharacterRepository()
+	dungeonRepo := repositories.NewDungeonRepository()
+	floor := newWalledFloor(8, 8)
+	floor.Tiles[5][5].MobID = "mob-1"
+	character := placeCharacter(characterRepo, dungeonRepo, floor, 2, 2)
+	handler := NewCharacterHandler(characterRepo, dungeonRepo, nil)
+
+	reasons := make(map[string]bool)
+	for _, body := range []string{
+		`{"position":{"x":0,"y":3}}`,
+		`{"position":{"x":50,"y":3}}`,
+		`{"position":{"x":5,"y":5}}`,
+		`{"position":{"x":6,"y":6}}`,
+	} {
+		rr := postCheckpoint(t, handler, character, body)
+		require.Equal(t, http.StatusUnprocessableEntity, rr.Code)
+
+		var response CheckpointErrorResponse
+		require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &response))
+		require.Len(t, response.Rejected, 1)
+		reasons[response.Rejected[0].Reason] = true
+	}
+	assert.Len(t, reasons, 1, "Walls, mobs and distance should be indistinguishable")
+}
+
+// TestCheckpointTrap tests that a checkpoint onto a hidden trap sets it off
+func TestCheckpointTrap(t *testing.T) {
+	characterRepo := repositories.NewCharacterRepository()
+	dungeonRepo := repositories.NewDungeonRepository()
+	floor := newWalledFloor(8, 8)
+	character := placeCharacter(characterRepo, dungeonRepo, floor, 2, 2)
+	handler := NewCharacterHandler(characterRepo, dungeonRepo, nil)
+
+	trap := models.NewTrap(models.TrapSpike, 1)
+	trap.Damage = 5
+	trap.Position = models.Position{X: 3, Y: 2}
+	floor.Traps = map[string]*models.Trap{trap.ID: trap}
+	floor.Tiles[2][3].TrapID = trap.ID
+	hp := character.CurrentHP
+
+	rr := postCheckpoint(t, handler, character, `{"position":{"x":3,"y":2}}`)
+	require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+	assert.True(t, trap.Revealed, "The trap should be revealed")
+	assert.Equal(t, hp-5, character.CurrentHP)
+}
+
+// TestCheckpointTrapDeath tests that a checkpoint onto a deadly trap kills the
+// character with the game's death penalty
+func TestCheckpointTrapDeath(t *testing.T) {
+	characterRepo := repositories.NewCharacterRepository()
+	dungeonRepo := repositories.NewDungeonRepository()
+	floor := newWalledFloor(8, 8)
+	character := placeCharacter(characterRepo, dungeonRepo, floor, 2, 2)
+	character.Gold = 10
+	gameManager := game.NewGameManager(characterRepo, dungeonRepo)
+	gameManager.DeathPenalty = game.DeathPenalty{GoldLossPercent: 100}
+	handler := NewCharacterHandler(characterRepo, dungeonRepo, gameManager)
+
+	trap := models.NewTrap(models.TrapSpike, 1)
+	trap.Damage = 999
+	trap.Position = models.Position{X: 3, Y: 2}
+	floor.Traps = map[string]*models.Trap{trap.ID: trap}
+	floor.Tiles[2][3].TrapID = trap.ID
+
+	rr := postCheckpoint(t, handler, character, `{"position":{"x":3,"y":2}}`)
+	require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+	assert.Equal(t, 1, character.Deaths)
+	assert.Equal(t, 0, character.Gold, "The configured penalty should take all the gold")
+	assert.Equal(t, character.MaxHP, character.CurrentHP, "The character should respawn at full health")
+	require.Len(t, floor.Corpses, 1)
+	for _, corpse := range floor.Corpses {
+		assert.Equal(t, 10, corpse.Gold)
+	}
+}
+
+// TestCheckpointCharacterNotFound tests checkpoints for unknown characters
+func TestCheckpointCharacterNotFound(t *testing.T) {
+	handler := NewCharacterHandler(repositories.NewCharacterRepository(), repositories.NewDungeonRepository(), nil)
+
+	req, err := http.NewRequest("POST", "/characters/invalid-id/checkpoint", bytes.NewBufferString(`{}`))
+	require.NoError(t, err)
+	req = mux.SetURLVars(req, map[string]string{"id": "invalid-id"})
+
+	rr := httptest.NewRecorder()
+	handler.Checkpoint(rr, withAccount(req, testAccount))
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+}
+
 // TestGetCharacterFloor tests the GetCharacterFloor handler
 func TestGetCharacterFloor(t *testing.T) {
 	// Create a repository
@@ -498,11 +687,12 @@ func TestGetCharacterFloor(t *testing.T) {
 
 	// Create a test character
 	character := models.NewCharacter("Test Character", models.Warrior)
+	character.OwnerID = testAccount.ID
 	character.CurrentFloor = 3
 	repo.Save(character)
 
 	// Create handler with the repository
-	handler := NewCharacterHandler(repo)
+	handler := NewCharacterHandler(repo, repositories.NewDungeonRepository(), nil)
 
 	tests := []struct {
 		name           string
@@ -539,7 +729,7 @@ func TestGetCharacterFloor(t *testing.T) {
 			rr := httptest.NewRecorder()
 
 			// Call handler
-			handler.GetCharacterFloor(rr, req)
+			handler.GetCharacterFloor(rr, withAccount(req, testAccount))
 
 			// Check status code
 			assert.Equal(t, tt.expectedStatus, rr.Code, "Status code should match expected")
@@ -555,13 +745,38 @@ func TestGetCharacterFloor(t *testing.T) {
 	}
 }
 
+// TestGetCharacterAbilities tests listing a character's abilities and cooldowns
+func TestGetCharacterAbilities(t *testing.T) {
+	repo := repositories.NewCharacterRepository()
+	character := models.NewCharacter("Test Mage", models.Mage)
+	character.OwnerID = testAccount.ID
+	character.Cooldowns = map[models.AbilityID]int{models.AbilityFireball: 2}
+	repo.Save(character)
+
+	handler := NewCharacterHandler(repo, repositories.NewDungeonRepository(), nil)
+
+	req, err := http.NewRequest("GET", "/characters/"+character.ID+"/abilities", nil)
+	require.NoError(t, err)
+	req = mux.SetURLVars(req, map[string]string{"id": character.ID})
+	rr := httptest.NewRecorder()
+	handler.GetCharacterAbilities(rr, withAccount(req, testAccount))
+	require.Equal(t, http.StatusOK, rr.Code)
+
+	var abilities []AbilityStatus
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &abilities))
+	require.Len(t, abilities, 1)
+	assert.Equal(t, models.AbilityFireball, abilities[0].ID)
+	assert.Equal(t, 2, abilities[0].CooldownLeft)
+	assert.False(t, abilities[0].Ready)
+}
+
 // TestCreateCharacterWithCustomAttributes tests creating characters with custom attributes
 func TestCreateCharacterWithCustomAttributes(t *testing.T) {
 	// Create a repository
 	repo := repositories.NewCharacterRepository()
 
 	// Create handler with the repository
-	handler := NewCharacterHandler(repo)
+	handler := NewCharacterHandler(repo, repositories.NewDungeonRepository(), nil)
 
 	tests := []struct {
 		name           string
@@ -751,7 +966,7 @@ func TestCreateCharacterWithCustomAttributes(t *testing.T) {
 			rr := httptest.NewRecorder()
 
 			// Call handler
-			handler.CreateCharacter(rr, req)
+			handler.CreateCharacter(rr, withAccount(req, testAccount))
 
 			// Check status code
 			assert.Equal(t, tt.expectedStatus, rr.Code, "Status code should match expected")
@@ -770,11 +985,12 @@ func TestCreateCharacterLimit(t *testing.T) {
 	// Add MAX_CHARACTERS characters to the repository
 	for i := 0; i < 10; i++ {
 		character := models.NewCharacter(fmt.Sprintf("Character %d", i), models.Warrior)
+		character.OwnerID = testAccount.ID
 		repo.Save(character)
 	}
 
 	// Create handler with the repository
-	handler := NewCharacterHandler(repo)
+	handler := NewCharacterHandler(repo, repositories.NewDungeonRepository(), nil)
 
 	// Now try to create one more character, which should fail
 	reqBody, err := json.Marshal(map[string]interface{}{
@@ -792,7 +1008,7 @@ func TestCreateCharacterLimit(t *testing.T) {
 	rr := httptest.NewRecorder()
 
 	// Call handler
-	handler.CreateCharacter(rr, req)
+	handler.CreateCharacter(rr, withAccount(req, testAccount))
 
 	// Check status code
 	assert.Equal(t, http.StatusBadRequest, rr.Code, "Status code should match expected")
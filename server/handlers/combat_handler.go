@@ -3,31 +3,122 @@ package handlers
 import (
 	"encoding/json"
 	"net/http"
+	"sync"
+	"time"
 
 	"github.com/gorilla/mux"
 	"github.com/gorilla/websocket"
+	"github.com/jchauncey/TheDeeps/server/auth"
 	"github.com/jchauncey/TheDeeps/server/game"
 	"github.com/jchauncey/TheDeeps/server/log"
 	"github.com/jchauncey/TheDeeps/server/models"
+	"github.com/jchauncey/TheDeeps/server/pathfinding"
 	"github.com/jchauncey/TheDeeps/server/repositories"
 )
 
+const (
+	maxSafeDistance = 5                // Furthest walk findSafePosition looks for a tile away from mobs
+	combatWriteWait = 10 * time.Second // Time allowed to write a response to a combat connection
+	combatQueueSize = 64               // Responses queued for a combat connection before more are dropped
+)
+
 // CombatHandler handles combat-related WebSocket messages
 type CombatHandler struct {
-	characterRepo *repositories.CharacterRepository
-	dungeonRepo   *repositories.DungeonRepository
+	characterRepo repositories.CharacterStore
+	dungeonRepo   repositories.DungeonStore
 	gameManager   *game.GameManager
 	combatManager *game.CombatManager
+	encounters    *game.EncounterManager
+	world         *sync.Mutex // Held while acting, so combat takes turns with the mob tick and game socket
 	upgrader      websocket.Upgrader
+
+	connections map[string]*combatConn // Combat connection of each character, for encounter events
+	connMutex   sync.Mutex
+}
+
+// combatConn is a combat WebSocket connection that encounter events can be sent to
+// from outside its message loop. Responses are queued for a writer goroutine, so
+// nobody holding the world lock waits on a slow client.
+type combatConn struct {
+	conn   *websocket.Conn
+	queue  chan []byte
+	closed bool
+	mutex  sync.Mutex
+}
+
+// newCombatConn wraps a connection and starts writing responses to it
+func newCombatConn(conn *websocket.Conn) *combatConn {
+	c := &combatConn{
+		conn:  conn,
+		queue: make(chan []byte, combatQueueSize),
+	}
+	go c.writePump()
+	return c
+}
+
+// send queues a response for the connection. It is encoded straight away, since it
+// points at characters and mobs that keep changing, and dropped if the queue is full.
+func (c *combatConn) send(response CombatResponse) {
+	data, err := json.Marshal(response)
+	if err != nil {
+		log.Error("Failed to marshal response: %v", err)
+		return
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.closed {
+		return
+	}
+	select {
+	case c.queue <- data:
+	default:
+		log.Warn("Dropping %s combat response: send queue full", response.Action)
+	}
+}
+
+// close stops the writer once it has written what is already queued
+func (c *combatConn) close() {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if !c.closed {
+		c.closed = true
+		close(c.queue)
+	}
+}
+
+// writePump writes queued responses to the connection. A client that stops reading
+// is cut off once a write times out, and whatever it is sent after that is thrown away.
+func (c *combatConn) writePump() {
+	for data := range c.queue {
+		c.conn.SetWriteDeadline(time.Now().Add(combatWriteWait))
+		if err := c.conn.WriteMessage(websocket.TextMessage, data); err != nil {
+			log.Error("Failed to send response: %v", err)
+			c.conn.Close()
+			for range c.queue {
+			}
+			return
+		}
+	}
 }
 
 // NewCombatHandler creates a new combat handler
-func NewCombatHandler(characterRepo *repositories.CharacterRepository, dungeonRepo *repositories.DungeonRepository, gameManager *game.GameManager) *CombatHandler {
-	return &CombatHandler{
+func NewCombatHandler(characterRepo repositories.CharacterStore, dungeonRepo repositories.DungeonStore, gameManager *game.GameManager) *CombatHandler {
+	// Encounters are shared with the game socket, which also fights in turns
+	combatManager := game.NewCombatManager()
+	encounters := game.NewEncounterManager(characterRepo, dungeonRepo, combatManager)
+	if gameManager != nil {
+		combatManager.Parties = gameManager.Parties
+		combatManager.OnBossDefeated = gameManager.Combat.OnBossDefeated
+		encounters = gameManager.Encounters
+	}
+	h := &CombatHandler{
 		characterRepo: characterRepo,
 		dungeonRepo:   dungeonRepo,
 		gameManager:   gameManager,
-		combatManager: game.NewCombatManager(),
+		combatManager: combatManager,
+		encounters:    encounters,
+		world:         encounters.World,
 		upgrader: websocket.Upgrader{
 			ReadBufferSize:  1024,
 			WriteBufferSize: 1024,
@@ -35,7 +126,21 @@ func NewCombatHandler(characterRepo *repositories.CharacterRepository, dungeonRe
 				return true // Allow all origins for now
 			},
 		},
+		connections: make(map[string]*combatConn),
 	}
+
+	h.encounters.Notify = h.notifyEncounter
+	h.encounters.OnDeath = func(dungeonID string, floor *models.Floor, character *models.Character, mob *models.Mob) {
+		death := h.handleDeath(game.CombatResult{Died: true}, dungeonID, floor, character, mob)
+		h.send(character.ID, CombatResponse{
+			Action:  "death",
+			Success: true,
+			Message: "You have been slain by " + mob.Name + "!",
+			Death:   death,
+		})
+	}
+
+	return h
 }
 
 // CombatMessage represents a combat action from the client
@@ -44,14 +149,19 @@ type CombatMessage struct {
 	CharacterID string `json:"characterId"`
 	MobID       string `json:"mobId,omitempty"`
 	ItemID      string `json:"itemId,omitempty"`
+	AbilityID   string `json:"abilityId,omitempty"`
 }
 
 // CombatResponse represents the server's response to a combat action
 type CombatResponse struct {
-	Action  string            `json:"action"`
-	Success bool              `json:"success"`
-	Message string            `json:"message"`
-	Result  game.CombatResult `json:"result,omitempty"`
+	Action  string               `json:"action"`
+	Success bool                 `json:"success"`
+	Message string               `json:"message"`
+	Result  game.CombatResult    `json:"result,omitempty"`
+	Death   *game.DeathEvent     `json:"death,omitempty"`
+	Event   *game.EncounterEvent `json:"event,omitempty"` // Encounter start, turn change, mob action or end
+
+	leaves bool // The character is out of their encounter after this action
 }
 
 // HandleCombat handles WebSocket connections for combat
@@ -63,6 +173,16 @@ func (h *CombatHandler) HandleCombat(w http.ResponseWriter, r *http.Request) {
 	}
 	defer conn.Close()
 
+	// Characters that used this connection stop getting encounter events when it closes
+	cc := newCombatConn(conn)
+	characters := make(map[string]bool)
+	defer func() {
+		for characterID := range characters {
+			h.unregister(characterID, cc)
+		}
+		cc.close()
+	}()
+
 	// Main message loop
 	for {
 		_, message, err := conn.ReadMessage()
@@ -87,11 +207,27 @@ func (h *CombatHandler) HandleCombat(w http.ResponseWriter, r *http.Request) {
 				Success: false,
 				Message: "Character not found",
 			}
-			sendResponse(conn, response)
+			cc.send(response)
+			continue
+		}
+
+		// Only the owner may fight with a character
+		if err := auth.CheckOwner(r.Context(), character); err != nil {
+			log.Warn("Rejected combat action for character %s: %v", character.ID, err)
+			cc.send(CombatResponse{
+				Action:  combatMsg.Action,
+				Success: false,
+				Message: err.Error(),
+			})
 			continue
 		}
+		if !characters[character.ID] {
+			characters[character.ID] = true
+			h.register(character.ID, cc)
+		}
 
-		// Handle the combat action
+		// Handle the combat action, taking turns with everything else changing the floor
+		h.world.Lock()
 		var response CombatResponse
 		switch combatMsg.Action {
 		case "attack":
@@ -100,6 +236,8 @@ func (h *CombatHandler) HandleCombat(w http.ResponseWriter, r *http.Request) {
 			response = h.handleUseItem(character, combatMsg.ItemID)
 		case "flee":
 			response = h.handleFlee(character, combatMsg.MobID)
+		case "cast":
+			response = h.handleCast(character, models.AbilityID(combatMsg.AbilityID), combatMsg.MobID)
 		default:
 			response = CombatResponse{
 				Action:  combatMsg.Action,
@@ -108,22 +246,101 @@ func (h *CombatHandler) HandleCombat(w http.ResponseWriter, r *http.Request) {
 			}
 		}
 
-		// Send the response
-		sendResponse(conn, response)
+		// Send the response, then let the encounter move on
+		cc.send(response)
+		h.finishTurn(character.ID, response)
+		h.world.Unlock()
 	}
 }
 
-// sendResponse sends a combat response to the client
-func sendResponse(conn *websocket.Conn, response CombatResponse) {
-	data, err := json.Marshal(response)
-	if err != nil {
-		log.Error("Failed to marshal response: %v", err)
-		return
+// register routes encounter events for a character to a connection
+func (h *CombatHandler) register(characterID string, cc *combatConn) {
+	h.connMutex.Lock()
+	defer h.connMutex.Unlock()
+	h.connections[characterID] = cc
+}
+
+// unregister stops routing encounter events to a closed connection and takes
+// the character out of their encounter
+func (h *CombatHandler) unregister(characterID string, cc *combatConn) {
+	h.connMutex.Lock()
+	if h.connections[characterID] == cc {
+		delete(h.connections, characterID)
 	}
+	h.connMutex.Unlock()
+
+	h.world.Lock()
+	defer h.world.Unlock()
+	h.encounters.Leave(characterID)
+}
+
+// send writes a response to a character's combat connection, if they have one
+func (h *CombatHandler) send(characterID string, response CombatResponse) {
+	h.connMutex.Lock()
+	cc, exists := h.connections[characterID]
+	h.connMutex.Unlock()
 
-	if err := conn.WriteMessage(websocket.TextMessage, data); err != nil {
-		log.Error("Failed to send response: %v", err)
+	if exists {
+		cc.send(response)
+	}
+}
+
+// notifyEncounter streams an encounter event to a character
+func (h *CombatHandler) notifyEncounter(characterID string, event game.EncounterEvent) {
+	response := CombatResponse{
+		Action:  string(event.Type),
+		Success: true,
+		Event:   &event,
+	}
+	switch event.Type {
+	case game.EventEncounterStart:
+		response.Message = "Roll for initiative!"
+	case game.EventTurnChange:
+		if event.Current.ID == characterID {
+			response.Message = "It's your turn!"
+		} else {
+			response.Message = "It's " + event.Current.Name + "'s turn."
+		}
+	case game.EventMobAction:
+		response.Message = event.Result.Message
+		response.Result = *event.Result
+	case game.EventBossAction:
+		response.Message = event.Boss.Message
+	case game.EventEncounterEnd:
+		response.Message = "The fight is over."
+	}
+	h.send(characterID, response)
+}
+
+// finishTurn moves the character's encounter on after an action that used up their turn
+func (h *CombatHandler) finishTurn(characterID string, response CombatResponse) {
+	switch {
+	case response.leaves:
+		h.encounters.Leave(characterID)
+	case response.Result.TurnTaken:
+		h.encounters.EndTurn(characterID)
+	}
+}
+
+// engage puts the character into an encounter with the mob and checks it's their turn.
+// It returns a response to send instead of acting when they can't act now.
+func (h *CombatHandler) engage(action string, dungeonID string, floor *models.Floor, character *models.Character, mob *models.Mob) *CombatResponse {
+	h.encounters.Engage(dungeonID, floor, character, mob)
+	if !h.encounters.InEncounter(character.ID) {
+		return &CombatResponse{
+			Action:  action,
+			Success: false,
+			Message: "The fight ended before you could act",
+		}
+	}
+	if err := h.encounters.CheckTurn(character.ID); err != nil {
+		return &CombatResponse{
+			Action:  action,
+			Success: false,
+			Message: "It's not your turn",
+		}
 	}
+	return nil
 }
 
 // handleAttack processes an attack action
@@ -164,12 +381,25 @@ func (h *CombatHandler) handleAttack(character *models.Character, mobID string)
 		}
 	}
 
-	// Process attack
-	result := h.combatManager.AttackMob(character, mob)
+	// Fights are taken in turns, and mobs quicker than the character act first
+	if response := h.engage("attack", dungeon.ID, floor, character, mob); response != nil {
+		return *response
+	}
+
+	// Process attack; the mob strikes back on its own turn
+	result := h.combatManager.Strike(character, mob)
 
 	// Update mob in floor data
 	if result.Killed {
 		delete(floor.Mobs, mobID)
+		if floor.Tiles[mob.Position.Y][mob.Position.X].MobID == mobID {
+			floor.Tiles[mob.Position.Y][mob.Position.X].MobID = ""
+		}
+		floor.MarkMobs(mobID)
+		floor.MarkTiles(mob.Position)
+
+		// Leave the loot where the mob fell
+		result.ItemsDropped = game.DropItems(floor, mob.Position, result.ItemsDropped)
 	} else {
 		floor.Mobs[mobID] = mob
 	}
@@ -177,6 +407,9 @@ func (h *CombatHandler) handleAttack(character *models.Character, mobID string)
 	// Save character and floor
 	h.characterRepo.Save(character)
 	h.dungeonRepo.SaveFloor(dungeon.ID, floorLevel, floor)
+	if result.Killed && h.gameManager != nil {
+		h.gameManager.BroadcastFloorUpdate(dungeon.ID, floorLevel)
+	}
 
 	// Send response
 	return CombatResponse{
@@ -184,6 +417,64 @@ func (h *CombatHandler) handleAttack(character *models.Character, mobID string)
 		Success: result.Success,
 		Message: result.Message,
 		Result:  result,
+		Death:   h.handleDeath(result, dungeon.ID, floor, character, mob),
+		leaves:  result.Died,
+	}
+}
+
+// handleCast processes a cast action. The mob is the ability's target, if it has one.
+func (h *CombatHandler) handleCast(character *models.Character, abilityID models.AbilityID, mobID string) CombatResponse {
+	// Get dungeon and floor
+	dungeon, err := h.dungeonRepo.GetByID(character.CurrentDungeon)
+	if err != nil {
+		return CombatResponse{
+			Success: false,
+			Message: "Dungeon not found",
+		}
+	}
+
+	// Get floor
+	floorLevel := dungeon.GetCharacterFloor(character.ID)
+	floor, err := h.dungeonRepo.GetFloor(dungeon.ID, floorLevel)
+	if err != nil {
+		return CombatResponse{
+			Success: false,
+			Message: "Floor not found",
+		}
+	}
+
+	// Aiming at a mob joins the fight with it; otherwise the character must wait for their turn
+	mob := floor.Mobs[mobID]
+	if mob != nil {
+		if response := h.engage("cast", dungeon.ID, floor, character, mob); response != nil {
+			return *response
+		}
+	} else if err := h.encounters.CheckTurn(character.ID); err != nil {
+		return CombatResponse{
+			Action:  "cast",
+			Success: false,
+			Message: "It's not your turn",
+		}
+	}
+
+	// Process the ability; killed mobs are taken off the floor by the combat manager
+	result := h.combatManager.Cast(character, abilityID, floor, mobID)
+
+	// Save character and floor
+	h.characterRepo.Save(character)
+	h.dungeonRepo.SaveFloor(dungeon.ID, floorLevel, floor)
+	if result.Success && h.gameManager != nil {
+		h.gameManager.BroadcastFloorUpdate(dungeon.ID, floorLevel)
+	}
+
+	// Send response
+	return CombatResponse{
+		Action:  "cast",
+		Success: result.Success,
+		Message: result.Message,
+		Result:  result,
+		Death:   h.handleDeath(result, dungeon.ID, floor, character, mob),
+		leaves:  result.Died,
 	}
 }
 
@@ -236,6 +527,15 @@ func (h *CombatHandler) handleFlee(character *models.Character, mobID string) Co
 		}
 	}
 
+	// Fleeing takes the character's turn like any other action
+	if err := h.encounters.CheckTurn(character.ID); err != nil {
+		return CombatResponse{
+			Action:  "flee",
+			Success: false,
+			Message: "It's not your turn",
+		}
+	}
+
 	// Process flee attempt
 	result := h.combatManager.Flee(character, mob)
 
@@ -248,9 +548,29 @@ func (h *CombatHandler) handleFlee(character *models.Character, mobID string) Co
 		Success: result.Success,
 		Message: result.Message,
 		Result:  result,
+		Death:   h.handleDeath(result, dungeon.ID, floor, character, mob),
+		leaves:  result.Success || result.Died,
 	}
 }
 
+// handleDeath kills and respawns the character if the combat result says they died
+func (h *CombatHandler) handleDeath(result game.CombatResult, dungeonID string, floor *models.Floor, character *models.Character, mob *models.Mob) *game.DeathEvent {
+	if !result.Died {
+		return nil
+	}
+
+	cause := game.DeathCause(mob)
+	if h.gameManager != nil {
+		event := h.gameManager.HandleDeath(dungeonID, floor, character, cause)
+		return &event
+	}
+
+	event := game.KillCharacter(floor, dungeonID, character, cause, game.DefaultDeathPenalty)
+	h.characterRepo.Save(character)
+	h.dungeonRepo.SaveFloor(dungeonID, floor.Level, floor)
+	return &event
+}
+
 // Helper functions
 
 // isAdjacent checks if two positions are adjacent (including diagonals)
@@ -268,55 +588,23 @@ func abs(x int) int {
 	return x
 }
 
-// findSafePosition finds a safe position not adjacent to any mob
+// findSafePosition finds the closest tile within a few steps' walk that isn't
+// next to any mob, or the current position if there is none
 func findSafePosition(floor *models.Floor, currentPos models.Position) models.Position {
-	// Start with current position
-	pos := currentPos
-
-	// Try to find a safe position within 5 tiles
-	for distance := 1; distance <= 5; distance++ {
-		// Try positions in a spiral pattern
-		for dx := -distance; dx <= distance; dx++ {
-			for dy := -distance; dy <= distance; dy++ {
-				// Skip positions that are not on the edge of the spiral
-				if abs(dx) != distance && abs(dy) != distance {
-					continue
-				}
-
-				// Calculate new position
-				newPos := models.Position{
-					X: pos.X + dx,
-					Y: pos.Y + dy,
-				}
-
-				// Check if position is valid
-				if newPos.X < 0 || newPos.X >= floor.Width || newPos.Y < 0 || newPos.Y >= floor.Height {
-					continue
-				}
-
-				// Check if position is walkable
-				if !floor.Tiles[newPos.Y][newPos.X].Walkable {
-					continue
-				}
-
-				// Check if position is safe (not adjacent to any mob)
-				safe := true
-				for _, mob := range floor.Mobs {
-					if isAdjacent(newPos, mob.Position) {
-						safe = false
-						break
-					}
-				}
-
-				if safe {
-					return newPos
-				}
+	safe := func(pos models.Position) bool {
+		for _, mob := range floor.Mobs {
+			if isAdjacent(pos, mob.Position) {
+				return false
 			}
 		}
+		return true
 	}
 
-	// If no safe position found, return current position
-	return pos
+	path, found := pathfinding.Nearest(floor, currentPos, pathfinding.Options{MaxCost: maxSafeDistance}, safe)
+	if !found {
+		return currentPos
+	}
+	return path[len(path)-1]
 }
 
 // GetCombatState handles GET /characters/{id}/combat
@@ -331,6 +619,10 @@ func (h *CombatHandler) GetCombatState(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if !authorizeCharacter(w, r, character) {
+		return
+	}
+
 	// Get dungeon
 	dungeon, err := h.dungeonRepo.GetByID(character.CurrentDungeon)
 	if err != nil {
@@ -338,6 +630,10 @@ func (h *CombatHandler) GetCombatState(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Read the floor while nothing is changing it; the response is encoded under the lock too
+	h.world.Lock()
+	defer h.world.Unlock()
+
 	// Get floor
 	floorLevel := dungeon.GetCharacterFloor(character.ID)
 	floor, err := h.dungeonRepo.GetFloor(dungeon.ID, floorLevel)
@@ -355,14 +651,19 @@ func (h *CombatHandler) GetCombatState(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Create response
+	encounter, inEncounter := h.encounters.Get(character.ID)
 	response := struct {
 		Character  *models.Character      `json:"character"`
 		NearbyMobs map[string]*models.Mob `json:"nearbyMobs"`
 		InCombat   bool                   `json:"inCombat"`
+		Encounter  *game.Encounter        `json:"encounter,omitempty"`
 	}{
 		Character:  character,
 		NearbyMobs: nearbyMobs,
-		InCombat:   len(nearbyMobs) > 0,
+		InCombat:   len(nearbyMobs) > 0 || inEncounter,
+	}
+	if inEncounter {
+		response.Encounter = &encounter
 	}
 
 	// Send response
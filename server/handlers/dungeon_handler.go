@@ -2,9 +2,9 @@ package handlers
 
 import (
 	"encoding/json"
+	"fmt"
 	"net/http"
 	"strconv"
-	"time"
 
 	"github.com/gorilla/mux"
 	"github.com/jchauncey/TheDeeps/server/game"
@@ -14,17 +14,21 @@ import (
 
 // DungeonHandler handles dungeon-related HTTP requests
 type DungeonHandler struct {
-	dungeonRepo   *repositories.DungeonRepository
-	characterRepo *repositories.CharacterRepository
-	mapGenerator  *game.MapGenerator
+	dungeonRepo   repositories.DungeonStore
+	characterRepo repositories.CharacterStore
+	gameManager   *game.GameManager // Floors in play are changed under its world lock
 }
 
-// NewDungeonHandler creates a new dungeon handler
-func NewDungeonHandler(dungeonRepo *repositories.DungeonRepository, characterRepo *repositories.CharacterRepository) *DungeonHandler {
+// NewDungeonHandler creates a new dungeon handler. Without a game manager it
+// gets one of its own, so floors are still changed one request at a time.
+func NewDungeonHandler(dungeonRepo repositories.DungeonStore, characterRepo repositories.CharacterStore, gameManager *game.GameManager) *DungeonHandler {
+	if gameManager == nil {
+		gameManager = game.NewGameManager(characterRepo, dungeonRepo)
+	}
 	return &DungeonHandler{
 		dungeonRepo:   dungeonRepo,
 		characterRepo: characterRepo,
-		mapGenerator:  game.NewMapGenerator(time.Now().UnixNano()),
+		gameManager:   gameManager,
 	}
 }
 
@@ -40,10 +44,12 @@ func (h *DungeonHandler) GetDungeons(w http.ResponseWriter, r *http.Request) {
 func (h *DungeonHandler) CreateDungeon(w http.ResponseWriter, r *http.Request) {
 	// Parse request body
 	var request struct {
-		Name       string `json:"name"`
-		Floors     int    `json:"floors"`
-		Difficulty string `json:"difficulty"`
-		Seed       int64  `json:"seed,omitempty"`
+		Name       string         `json:"name"`
+		Floors     int            `json:"floors"`
+		Difficulty string         `json:"difficulty"`
+		Theme      string         `json:"theme,omitempty"`
+		Layouts    map[int]string `json:"layouts,omitempty"` // Layouts for floors that shouldn't use the theme's
+		Seed       int64          `json:"seed,omitempty"`
 	}
 
 	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
@@ -66,13 +72,37 @@ func (h *DungeonHandler) CreateDungeon(w http.ResponseWriter, r *http.Request) {
 		request.Difficulty = "normal" // Default difficulty
 	}
 
+	theme, err := models.ParseTheme(request.Theme)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	layouts := make(map[int]models.Layout, len(request.Layouts))
+	for level, value := range request.Layouts {
+		if level < 1 || level > request.Floors {
+			http.Error(w, fmt.Sprintf("floor %d isn't in the dungeon", level), http.StatusBadRequest)
+			return
+		}
+		layout, err := models.ParseLayout(value)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		layouts[level] = layout
+	}
+
 	// Create dungeon
 	dungeon := models.NewDungeon(request.Name, request.Floors, request.Seed)
 	dungeon.Difficulty = request.Difficulty
+	dungeon.Theme = theme
+	if len(layouts) > 0 {
+		dungeon.Layouts = layouts
+	}
 
 	// Generate first floor
 	floor := dungeon.GenerateFloor(1)
-	h.mapGenerator.GenerateFloorWithDifficulty(floor, 1, request.Floors == 1, request.Difficulty)
+	game.GenerateDungeonFloor(dungeon, floor)
 
 	// Save dungeon
 	if err := h.dungeonRepo.Save(dungeon); err != nil {
@@ -121,6 +151,14 @@ func (h *DungeonHandler) JoinDungeon(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if !authorizeCharacter(w, r, character) {
+		return
+	}
+
+	// The character is placed on a floor others may be playing
+	h.gameManager.World.Lock()
+	defer h.gameManager.World.Unlock()
+
 	// Add character to dungeon
 	if err := h.dungeonRepo.AddCharacterToDungeon(dungeonID, request.CharacterID); err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
@@ -231,20 +269,29 @@ func (h *DungeonHandler) JoinDungeon(w http.ResponseWriter, r *http.Request) {
 
 	// Update the tile to mark the character's position
 	floor.Tiles[character.Position.Y][character.Position.X].Character = character.ID
+	floor.MarkTiles(character.Position)
 
 	// Update character
 	character.CurrentFloor = 1
 	character.CurrentDungeon = dungeonID
+	view := game.CharacterFloorView(floor, dungeonID, character)
 
 	// Save character
 	if err := h.characterRepo.Save(character); err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
+	if err := h.dungeonRepo.SaveFloor(dungeonID, 1, floor); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// Show everyone on the floor the new arrival
+	h.gameManager.BroadcastFloorUpdate(dungeonID, 1)
 
-	// Return floor
+	// Return the part of the floor the character can see
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(floor)
+	json.NewEncoder(w).Encode(view)
 }
 
 // GetFloor handles GET /dungeons/{id}/floor/{level}
@@ -273,8 +320,39 @@ func (h *DungeonHandler) GetFloor(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Get floor
-	floor, err := h.dungeonRepo.GetFloor(dungeonID, level)
+	h.writeFloorView(w, r, dungeon, level)
+}
+
+// writeFloorView writes the requesting character's view of a floor, generating the
+// floor if it hasn't been yet. Clients only ever see the tiles their character has
+// explored, so the character is required and must be on the floor before the floor
+// is loaded.
+func (h *DungeonHandler) writeFloorView(w http.ResponseWriter, r *http.Request, dungeon *models.Dungeon, level int) {
+	characterID := r.URL.Query().Get("characterId")
+	if characterID == "" {
+		http.Error(w, "characterId is required", http.StatusBadRequest)
+		return
+	}
+
+	character, err := h.characterRepo.GetByID(characterID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	if !authorizeCharacter(w, r, character) {
+		return
+	}
+
+	if character.CurrentDungeon != dungeon.ID || character.CurrentFloor != level {
+		http.Error(w, "Character is not on this floor", http.StatusForbidden)
+		return
+	}
+
+	h.gameManager.World.Lock()
+	defer h.gameManager.World.Unlock()
+
+	floor, err := h.dungeonRepo.GetFloor(dungeon.ID, level)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
@@ -282,12 +360,23 @@ func (h *DungeonHandler) GetFloor(w http.ResponseWriter, r *http.Request) {
 
 	// If floor hasn't been generated yet, generate it
 	if len(floor.Rooms) == 0 {
-		h.mapGenerator.GenerateFloorWithDifficulty(floor, level, level == dungeon.Floors, dungeon.Difficulty)
+		game.GenerateDungeonFloor(dungeon, floor)
+
+		// Save the floor back to the repository
+		if err := h.dungeonRepo.SaveFloor(dungeon.ID, level, floor); err != nil {
+			http.Error(w, "Failed to save generated floor", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	view := game.CharacterFloorView(floor, dungeon.ID, character)
+	if err := h.characterRepo.Save(character); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
 	}
 
-	// Return floor
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(floor)
+	json.NewEncoder(w).Encode(view)
 }
 
 // GenerateTestRoom handles GET /test/room
@@ -491,26 +580,5 @@ func (h *DungeonHandler) GetFloorByNumber(w http.ResponseWriter, r *http.Request
 		return
 	}
 
-	// Get floor
-	floor, err := h.dungeonRepo.GetFloor(dungeonID, floorNumber)
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
-	}
-
-	// If floor hasn't been generated yet, generate it
-	if len(floor.Rooms) == 0 {
-		h.mapGenerator.GenerateFloorWithDifficulty(floor, floorNumber, floorNumber == dungeon.Floors, dungeon.Difficulty)
-
-		// Save the floor back to the repository
-		err = h.dungeonRepo.SaveFloor(dungeonID, floorNumber, floor)
-		if err != nil {
-			http.Error(w, "Failed to save generated floor", http.StatusInternalServerError)
-			return
-		}
-	}
-
-	// Return floor data
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(floor)
+	h.writeFloorView(w, r, dungeon, floorNumber)
 }
@@ -6,6 +6,7 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 
 	"github.com/gorilla/mux"
 	"github.com/jchauncey/TheDeeps/server/game"
@@ -22,10 +23,7 @@ func TestCreateDungeon(t *testing.T) {
 	characterRepo := repositories.NewCharacterRepository()
 
 	// Create handler using the constructor
-	handler := NewDungeonHandler(dungeonRepo, characterRepo)
-
-	// Override the map generator for deterministic tests
-	handler.mapGenerator = game.NewMapGenerator(12345)
+	handler := NewDungeonHandler(dungeonRepo, characterRepo, nil)
 
 	tests := []struct {
 		name           string
@@ -53,6 +51,7 @@ func TestCreateDungeon(t *testing.T) {
 				assert.NotEmpty(t, dungeon.ID, "Dungeon ID should be generated")
 				// Default difficulty should be "normal"
 				assert.Equal(t, "normal", dungeon.Difficulty, "Default difficulty should be 'normal'")
+				assert.Equal(t, models.ThemeClassic, dungeon.Theme, "Default theme should be 'classic'")
 			},
 		},
 		{
@@ -78,6 +77,82 @@ func TestCreateDungeon(t *testing.T) {
 				assert.Equal(t, "hard", dungeon.Difficulty, "Difficulty should be 'hard'")
 			},
 		},
+		{
+			name: "Dungeon With Theme",
+			requestBody: map[string]interface{}{
+				"name":   "Deep Crypt",
+				"floors": 3,
+				"theme":  "crypt",
+				"seed":   12345,
+			},
+			expectedStatus: http.StatusCreated,
+			validateFunc: func(t *testing.T, resp *httptest.ResponseRecorder) {
+				var dungeon models.Dungeon
+				err := json.Unmarshal(resp.Body.Bytes(), &dungeon)
+				require.NoError(t, err, "Failed to unmarshal response")
+
+				// The first floor is generated with the theme
+				assert.Equal(t, models.ThemeCrypt, dungeon.Theme, "Theme should be 'crypt'")
+				floor, err := dungeonRepo.GetFloor(dungeon.ID, 1)
+				require.NoError(t, err, "First floor should be generated")
+				assert.Equal(t, models.ThemeCrypt, floor.Theme, "First floor should use the theme")
+				assert.NotEmpty(t, floor.Palette, "First floor should have the theme's palette")
+			},
+		},
+		{
+			name: "Unknown Theme",
+			requestBody: map[string]interface{}{
+				"name":   "Odd Dungeon",
+				"floors": 3,
+				"theme":  "candyland",
+			},
+			expectedStatus: http.StatusBadRequest,
+			validateFunc: func(t *testing.T, resp *httptest.ResponseRecorder) {
+				assert.Contains(t, resp.Body.String(), `unknown theme "candyland"`)
+			},
+		},
+		{
+			name: "Dungeon With Layouts",
+			requestBody: map[string]interface{}{
+				"name":    "Winding Deep",
+				"floors":  3,
+				"layouts": map[string]string{"1": "caves", "3": "tunnels"},
+				"seed":    12345,
+			},
+			expectedStatus: http.StatusCreated,
+			validateFunc: func(t *testing.T, resp *httptest.ResponseRecorder) {
+				var dungeon models.Dungeon
+				err := json.Unmarshal(resp.Body.Bytes(), &dungeon)
+				require.NoError(t, err, "Failed to unmarshal response")
+
+				assert.Equal(t, map[int]models.Layout{1: models.LayoutCaves, 3: models.LayoutTunnels}, dungeon.Layouts)
+				assert.Equal(t, models.ThemeClassic, dungeon.Theme, "Layouts don't change the theme")
+			},
+		},
+		{
+			name: "Unknown Layout",
+			requestBody: map[string]interface{}{
+				"name":    "Odd Dungeon",
+				"floors":  3,
+				"layouts": map[string]string{"2": "maze"},
+			},
+			expectedStatus: http.StatusBadRequest,
+			validateFunc: func(t *testing.T, resp *httptest.ResponseRecorder) {
+				assert.Contains(t, resp.Body.String(), `unknown layout "maze"`)
+			},
+		},
+		{
+			name: "Layout Below The Dungeon",
+			requestBody: map[string]interface{}{
+				"name":    "Odd Dungeon",
+				"floors":  3,
+				"layouts": map[string]string{"4": "bsp"},
+			},
+			expectedStatus: http.StatusBadRequest,
+			validateFunc: func(t *testing.T, resp *httptest.ResponseRecorder) {
+				assert.Contains(t, resp.Body.String(), "floor 4 isn't in the dungeon")
+			},
+		},
 		{
 			name: "Missing Name",
 			requestBody: map[string]interface{}{
@@ -120,7 +195,7 @@ func TestCreateDungeon(t *testing.T) {
 			rr := httptest.NewRecorder()
 
 			// Call handler
-			handler.CreateDungeon(rr, req)
+			handler.CreateDungeon(rr, withAccount(req, testAccount))
 
 			// Check status code
 			assert.Equal(t, tt.expectedStatus, rr.Code, "Status code should match expected")
@@ -136,12 +211,7 @@ func TestGetDungeons(t *testing.T) {
 	// Create a new dungeon repository and handler
 	dungeonRepo := repositories.NewDungeonRepository()
 	characterRepo := repositories.NewCharacterRepository()
-	mapGenerator := game.NewMapGenerator(12345)
-	handler := &DungeonHandler{
-		dungeonRepo:   dungeonRepo,
-		characterRepo: characterRepo,
-		mapGenerator:  mapGenerator,
-	}
+	handler := NewDungeonHandler(dungeonRepo, characterRepo, nil)
 
 	// Create test dungeons
 	dungeon1 := models.NewDungeon("Dungeon 1", 3, 12345)
@@ -157,7 +227,7 @@ func TestGetDungeons(t *testing.T) {
 	rr := httptest.NewRecorder()
 
 	// Call handler
-	handler.GetDungeons(rr, req)
+	handler.GetDungeons(rr, withAccount(req, testAccount))
 
 	// Check status code
 	assert.Equal(t, http.StatusOK, rr.Code, "Status code should be OK")
@@ -189,17 +259,46 @@ func TestGetDungeons(t *testing.T) {
 	assert.True(t, foundDungeon2, "Dungeon 2 should be in response")
 }
 
+// TestDungeonsHideFloors tests that listing and creating dungeons never sends
+// their floors, which would show clients everything fog of war hides
+func TestDungeonsHideFloors(t *testing.T) {
+	dungeonRepo := repositories.NewDungeonRepository()
+	characterRepo := repositories.NewCharacterRepository()
+	handler := NewDungeonHandler(dungeonRepo, characterRepo, nil)
+
+	reqBody, err := json.Marshal(map[string]interface{}{"name": "Secret Dungeon", "floors": 3, "seed": 3})
+	require.NoError(t, err)
+	req, err := http.NewRequest("POST", "/dungeons", bytes.NewBuffer(reqBody))
+	require.NoError(t, err)
+	created := httptest.NewRecorder()
+	handler.CreateDungeon(created, withAccount(req, testAccount))
+	require.Equal(t, http.StatusCreated, created.Code)
+
+	var dungeon models.Dungeon
+	require.NoError(t, json.Unmarshal(created.Body.Bytes(), &dungeon))
+	stored, err := dungeonRepo.GetByID(dungeon.ID)
+	require.NoError(t, err)
+	require.NotEmpty(t, stored.FloorData, "The first floor should be generated")
+
+	req, err = http.NewRequest("GET", "/dungeons", nil)
+	require.NoError(t, err)
+	listed := httptest.NewRecorder()
+	handler.GetDungeons(listed, withAccount(req, testAccount))
+	require.Equal(t, http.StatusOK, listed.Code)
+
+	for name, body := range map[string]string{"create": created.Body.String(), "list": listed.Body.String()} {
+		assert.NotContains(t, body, "floorData", "The %s response shouldn't include floors", name)
+		assert.NotContains(t, body, "tiles", "The %s response shouldn't include tiles", name)
+	}
+}
+
 // TestGetFloor tests the GetFloor handler
 func TestGetFloor(t *testing.T) {
 	// Create a new dungeon repository and handler
 	dungeonRepo := repositories.NewDungeonRepository()
 	characterRepo := repositories.NewCharacterRepository()
 	mapGenerator := game.NewMapGenerator(12345)
-	handler := &DungeonHandler{
-		dungeonRepo:   dungeonRepo,
-		characterRepo: characterRepo,
-		mapGenerator:  mapGenerator,
-	}
+	handler := NewDungeonHandler(dungeonRepo, characterRepo, nil)
 
 	// Create a test dungeon
 	testDungeon := models.NewDungeon("Test Dungeon", 5, 12345)
@@ -210,10 +309,27 @@ func TestGetFloor(t *testing.T) {
 
 	dungeonRepo.Save(testDungeon)
 
+	// Create a character standing in the first room of the floor
+	character := models.NewCharacter("Explorer", models.Warrior)
+	character.OwnerID = testAccount.ID
+	character.CurrentDungeon = testDungeon.ID
+	character.CurrentFloor = 1
+	character.Position = models.Position{
+		X: floor.Rooms[0].X + floor.Rooms[0].Width/2,
+		Y: floor.Rooms[0].Y + floor.Rooms[0].Height/2,
+	}
+	characterRepo.Save(character)
+
+	// Create a character that is not on the floor
+	elsewhere := models.NewCharacter("Elsewhere", models.Mage)
+	elsewhere.OwnerID = testAccount.ID
+	characterRepo.Save(elsewhere)
+
 	tests := []struct {
 		name           string
 		dungeonID      string
 		floorLevel     string
+		characterID    string
 		expectedStatus int
 		validateFunc   func(t *testing.T, resp *httptest.ResponseRecorder)
 	}{
@@ -221,17 +337,52 @@ func TestGetFloor(t *testing.T) {
 			name:           "Valid Floor",
 			dungeonID:      testDungeon.ID,
 			floorLevel:     "1",
+			characterID:    character.ID,
 			expectedStatus: http.StatusOK,
 			validateFunc: func(t *testing.T, resp *httptest.ResponseRecorder) {
-				var floor models.Floor
-				err := json.Unmarshal(resp.Body.Bytes(), &floor)
+				var view models.Floor
+				err := json.Unmarshal(resp.Body.Bytes(), &view)
 				require.NoError(t, err, "Failed to unmarshal response")
 
 				// Validate floor properties
-				assert.Equal(t, 1, floor.Level, "Floor level should be 1")
-				assert.Greater(t, floor.Width, 0, "Width should be positive")
-				assert.Greater(t, floor.Height, 0, "Height should be positive")
-				assert.NotEmpty(t, floor.Tiles, "Tiles should be initialized")
+				assert.Equal(t, 1, view.Level, "Floor level should be 1")
+				assert.Greater(t, view.Width, 0, "Width should be positive")
+				assert.Greater(t, view.Height, 0, "Height should be positive")
+				assert.NotEmpty(t, view.Tiles, "Tiles should be initialized")
+
+				// Only the area around the character should be revealed
+				pos := character.Position
+				assert.True(t, view.Tiles[pos.Y][pos.X].Visible, "The character's tile should be visible")
+				explored := 0
+				for y := range view.Tiles {
+					for x := range view.Tiles[y] {
+						if view.Tiles[y][x].Explored {
+							explored++
+						}
+					}
+				}
+				assert.Less(t, explored, view.Width*view.Height, "Unexplored tiles should be hidden")
+				assert.Equal(t, explored, character.ExploredFloor(testDungeon.ID, floor).Count(),
+					"The character should remember what it has seen")
+			},
+		},
+		{
+			name:           "Missing Character",
+			dungeonID:      testDungeon.ID,
+			floorLevel:     "1",
+			expectedStatus: http.StatusBadRequest,
+			validateFunc: func(t *testing.T, resp *httptest.ResponseRecorder) {
+				assert.Contains(t, resp.Body.String(), "characterId is required")
+			},
+		},
+		{
+			name:           "Character Not On Floor",
+			dungeonID:      testDungeon.ID,
+			floorLevel:     "1",
+			characterID:    elsewhere.ID,
+			expectedStatus: http.StatusForbidden,
+			validateFunc: func(t *testing.T, resp *httptest.ResponseRecorder) {
+				assert.Contains(t, resp.Body.String(), "not on this floor")
 			},
 		},
 		{
@@ -269,7 +420,7 @@ func TestGetFloor(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			// Create request
-			req, err := http.NewRequest("GET", "/dungeons/"+tt.dungeonID+"/floor/"+tt.floorLevel, nil)
+			req, err := http.NewRequest("GET", "/dungeons/"+tt.dungeonID+"/floor/"+tt.floorLevel+"?characterId="+tt.characterID, nil)
 			require.NoError(t, err, "Failed to create request")
 
 			// Set up router context with dungeon ID and floor level
@@ -282,7 +433,7 @@ func TestGetFloor(t *testing.T) {
 			rr := httptest.NewRecorder()
 
 			// Call handler
-			handler.GetFloor(rr, req)
+			handler.GetFloor(rr, withAccount(req, testAccount))
 
 			// Check status code
 			assert.Equal(t, tt.expectedStatus, rr.Code, "Status code should match expected")
@@ -293,6 +444,47 @@ func TestGetFloor(t *testing.T) {
 	}
 }
 
+// TestGetFloorGeneratesForCharacterOnFloor tests that a floor is only generated
+// for a character standing on it, and is saved once it is
+func TestGetFloorGeneratesForCharacterOnFloor(t *testing.T) {
+	dungeonRepo := repositories.NewDungeonRepository()
+	characterRepo := repositories.NewCharacterRepository()
+	handler := NewDungeonHandler(dungeonRepo, characterRepo, nil)
+
+	dungeon := models.NewDungeon("Test Dungeon", 3, 12345)
+	dungeonRepo.Save(dungeon)
+
+	elsewhere := models.NewCharacter("Elsewhere", models.Mage)
+	elsewhere.OwnerID = testAccount.ID
+	characterRepo.Save(elsewhere)
+
+	explorer := models.NewCharacter("Explorer", models.Warrior)
+	explorer.OwnerID = testAccount.ID
+	explorer.CurrentDungeon = dungeon.ID
+	explorer.CurrentFloor = 2
+	characterRepo.Save(explorer)
+
+	getFloor := func(characterID string) *httptest.ResponseRecorder {
+		req, err := http.NewRequest("GET", "/dungeons/"+dungeon.ID+"/floor/2?characterId="+characterID, nil)
+		require.NoError(t, err)
+		req = mux.SetURLVars(req, map[string]string{"id": dungeon.ID, "level": "2"})
+		rr := httptest.NewRecorder()
+		handler.GetFloor(rr, withAccount(req, testAccount))
+		return rr
+	}
+
+	assert.Equal(t, http.StatusForbidden, getFloor(elsewhere.ID).Code)
+	floor, err := dungeonRepo.GetFloor(dungeon.ID, 2)
+	require.NoError(t, err)
+	assert.Empty(t, floor.Rooms, "A character who isn't on the floor shouldn't generate it")
+
+	rr := getFloor(explorer.ID)
+	require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+	floor, err = dungeonRepo.GetFloor(dungeon.ID, 2)
+	require.NoError(t, err)
+	assert.NotEmpty(t, floor.Rooms, "The generated floor should be saved")
+}
+
 // TestJoinDungeon tests the JoinDungeon handler
 func TestJoinDungeon(t *testing.T) {
 	// Create repositories
@@ -305,6 +497,7 @@ func TestJoinDungeon(t *testing.T) {
 
 	// Create a test character
 	character := models.NewCharacter("TestCharacter", models.Warrior)
+	character.OwnerID = testAccount.ID
 	characterRepo.Save(character)
 
 	// Generate the first floor with an entrance room
@@ -313,7 +506,7 @@ func TestJoinDungeon(t *testing.T) {
 	mapGenerator.GenerateFloorWithDifficulty(floor, 1, false, "normal")
 
 	// Create the handler
-	handler := NewDungeonHandler(dungeonRepo, characterRepo)
+	handler := NewDungeonHandler(dungeonRepo, characterRepo, nil)
 
 	// Create a request
 	requestBody := map[string]string{
@@ -331,7 +524,7 @@ func TestJoinDungeon(t *testing.T) {
 	rr := httptest.NewRecorder()
 
 	// Serve the request
-	router.ServeHTTP(rr, req)
+	router.ServeHTTP(rr, withAccount(req, testAccount))
 
 	// Check the status code
 	assert.Equal(t, http.StatusOK, rr.Code)
@@ -376,6 +569,47 @@ func TestJoinDungeon(t *testing.T) {
 	assert.Equal(t, character.ID, responseFloor.Tiles[updatedCharacter.Position.Y][updatedCharacter.Position.X].Character)
 }
 
+// TestJoinDungeonWaitsForWorld tests that joining waits for whoever is changing the floors in play
+func TestJoinDungeonWaitsForWorld(t *testing.T) {
+	dungeonRepo := repositories.NewDungeonRepository()
+	characterRepo := repositories.NewCharacterRepository()
+	dungeon := models.NewDungeon("TestDungeon", 3, 12345)
+	floor := dungeon.GenerateFloor(1)
+	game.NewMapGenerator(12345).GenerateFloor(floor, 1, false)
+	dungeonRepo.Save(dungeon)
+
+	character := models.NewCharacter("TestCharacter", models.Warrior)
+	character.OwnerID = testAccount.ID
+	characterRepo.Save(character)
+
+	gameManager := game.NewGameManager(characterRepo, dungeonRepo)
+	handler := NewDungeonHandler(dungeonRepo, characterRepo, gameManager)
+
+	body, _ := json.Marshal(map[string]string{"characterId": character.ID})
+	req, err := http.NewRequest("POST", "/dungeons/"+dungeon.ID+"/join", bytes.NewBuffer(body))
+	require.NoError(t, err)
+	req = mux.SetURLVars(req, map[string]string{"id": dungeon.ID})
+	rr := httptest.NewRecorder()
+
+	gameManager.World.Lock()
+	done := make(chan struct{})
+	go func() {
+		handler.JoinDungeon(rr, withAccount(req, testAccount))
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		t.Fatal("Joining should wait for the world lock")
+	case <-time.After(50 * time.Millisecond):
+	}
+	gameManager.World.Unlock()
+	<-done
+
+	require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+	assert.Equal(t, character.ID, floor.Tiles[character.Position.Y][character.Position.X].Character)
+}
+
 // TestJoinDungeonWithObstaclesInEntranceRoom tests the JoinDungeon handler with obstacles in the entrance room
 func TestJoinDungeonWithObstaclesInEntranceRoom(t *testing.T) {
 	// Create repositories
@@ -388,6 +622,7 @@ func TestJoinDungeonWithObstaclesInEntranceRoom(t *testing.T) {
 
 	// Create a test character
 	character := models.NewCharacter("TestCharacter", models.Warrior)
+	character.OwnerID = testAccount.ID
 	characterRepo.Save(character)
 
 	// Generate the first floor with an entrance room
@@ -423,7 +658,7 @@ func TestJoinDungeonWithObstaclesInEntranceRoom(t *testing.T) {
 	floor.Tiles[centerY][centerX+1].MobID = mobID
 
 	// Create the handler
-	handler := NewDungeonHandler(dungeonRepo, characterRepo)
+	handler := NewDungeonHandler(dungeonRepo, characterRepo, nil)
 
 	// Create a request
 	requestBody := map[string]string{
@@ -441,7 +676,7 @@ func TestJoinDungeonWithObstaclesInEntranceRoom(t *testing.T) {
 	rr := httptest.NewRecorder()
 
 	// Serve the request
-	router.ServeHTTP(rr, req)
+	router.ServeHTTP(rr, withAccount(req, testAccount))
 
 	// Check the status code
 	assert.Equal(t, http.StatusOK, rr.Code)
@@ -492,13 +727,13 @@ func TestNewDungeonHandler(t *testing.T) {
 	characterRepo := repositories.NewCharacterRepository()
 
 	// Create handler using the constructor
-	handler := NewDungeonHandler(dungeonRepo, characterRepo)
+	handler := NewDungeonHandler(dungeonRepo, characterRepo, nil)
 
 	// Verify handler is initialized correctly
 	assert.NotNil(t, handler, "Handler should not be nil")
 	assert.NotNil(t, handler.dungeonRepo, "Dungeon repository should not be nil")
 	assert.NotNil(t, handler.characterRepo, "Character repository should not be nil")
-	assert.NotNil(t, handler.mapGenerator, "Map generator should not be nil")
+	assert.NotNil(t, handler.gameManager, "A game manager should be created when none is given")
 
 	// Verify the repositories are the ones we passed in
 	assert.Same(t, dungeonRepo, handler.dungeonRepo, "Dungeon repository should be the same instance")
@@ -513,6 +748,7 @@ func TestSharedRepositories(t *testing.T) {
 
 	// Create a test character in the character repository
 	character := models.NewCharacter("Test Character", models.Warrior)
+	character.OwnerID = testAccount.ID
 	err := characterRepo.Save(character)
 	assert.NoError(t, err, "Failed to save character")
 
@@ -522,7 +758,7 @@ func TestSharedRepositories(t *testing.T) {
 	assert.NoError(t, err, "Failed to save dungeon")
 
 	// Create handler using the shared repositories
-	handler := NewDungeonHandler(dungeonRepo, characterRepo)
+	handler := NewDungeonHandler(dungeonRepo, characterRepo, nil)
 
 	// Create request to join the dungeon
 	requestBody := map[string]string{
@@ -544,7 +780,7 @@ func TestSharedRepositories(t *testing.T) {
 	rr := httptest.NewRecorder()
 
 	// Call handler directly
-	handler.JoinDungeon(rr, req)
+	handler.JoinDungeon(rr, withAccount(req, testAccount))
 
 	// Check status code
 	assert.Equal(t, http.StatusOK, rr.Code, "Status code should be OK")
@@ -567,7 +803,7 @@ func TestGenerateTestRoom(t *testing.T) {
 	characterRepo := repositories.NewCharacterRepository()
 
 	// Create handler
-	handler := NewDungeonHandler(dungeonRepo, characterRepo)
+	handler := NewDungeonHandler(dungeonRepo, characterRepo, nil)
 
 	// Test cases
 	tests := []struct {
@@ -683,7 +919,7 @@ func TestGenerateTestRoom(t *testing.T) {
 			router.HandleFunc("/test/room", handler.GenerateTestRoom).Methods("GET")
 
 			// Serve request
-			router.ServeHTTP(rr, req)
+			router.ServeHTTP(rr, withAccount(req, testAccount))
 
 			// Check status code
 			assert.Equal(t, tt.expectedStatus, rr.Code)
@@ -713,10 +949,11 @@ func TestJoinDungeonErrorCases(t *testing.T) {
 
 	// Create a test character
 	character := models.NewCharacter("TestCharacter", models.Warrior)
+	character.OwnerID = testAccount.ID
 	characterRepo.Save(character)
 
 	// Create the handler
-	handler := NewDungeonHandler(dungeonRepo, characterRepo)
+	handler := NewDungeonHandler(dungeonRepo, characterRepo, nil)
 
 	// Set up the router
 	router := mux.NewRouter()
@@ -783,7 +1020,7 @@ func TestJoinDungeonErrorCases(t *testing.T) {
 			rr := httptest.NewRecorder()
 
 			// Serve the request
-			router.ServeHTTP(rr, req)
+			router.ServeHTTP(rr, withAccount(req, testAccount))
 
 			// Check the status code
 			assert.Equal(t, tt.expectedStatus, rr.Code)
@@ -798,7 +1035,7 @@ func TestJoinDungeonFallbacks(t *testing.T) {
 	characterRepo := repositories.NewCharacterRepository()
 
 	// Create the handler
-	handler := NewDungeonHandler(dungeonRepo, characterRepo)
+	handler := NewDungeonHandler(dungeonRepo, characterRepo, nil)
 
 	// Set up the router
 	router := mux.NewRouter()
@@ -819,6 +1056,7 @@ func TestJoinDungeonFallbacks(t *testing.T) {
 
 				// Create a test character
 				character := models.NewCharacter("TestCharacter", models.Warrior)
+				character.OwnerID = testAccount.ID
 				characterRepo.Save(character)
 
 				// Generate the first floor WITHOUT an entrance room
@@ -864,6 +1102,7 @@ func TestJoinDungeonFallbacks(t *testing.T) {
 
 				// Create a test character
 				character := models.NewCharacter("TestCharacter", models.Warrior)
+				character.OwnerID = testAccount.ID
 				characterRepo.Save(character)
 
 				// Generate the first floor WITHOUT an entrance room or upstairs
@@ -930,7 +1169,7 @@ func TestJoinDungeonFallbacks(t *testing.T) {
 			rr := httptest.NewRecorder()
 
 			// Serve the request
-			router.ServeHTTP(rr, req)
+			router.ServeHTTP(rr, withAccount(req, testAccount))
 
 			// Check the status code
 			assert.Equal(t, tt.expectedStatus, rr.Code)
@@ -12,7 +12,7 @@ import (
 // GameHandler handles WebSocket connections for real-time game mechanics
 type GameHandler struct {
 	manager       *game.GameManager
-	characterRepo *repositories.CharacterRepository
+	characterRepo repositories.CharacterStore
 	upgrader      websocket.Upgrader
 }
 
@@ -52,6 +52,10 @@ func (h *GameHandler) HandleWebSocket(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if !authorizeCharacter(w, r, character) {
+		return
+	}
+
 	// Now that we've validated the character, let the game manager handle the connection
 	// The game manager will upgrade the connection and manage the WebSocket
 	h.manager.HandleConnection(w, r)
@@ -59,6 +63,6 @@ func (h *GameHandler) HandleWebSocket(w http.ResponseWriter, r *http.Request) {
 
 // StartGameManager starts the game manager
 func (h *GameHandler) StartGameManager() {
-	// Start any background processes for the game manager
-	// This could include things like periodic updates, AI processing, etc.
+	// Runs client registration, broadcasts and the mob AI tick
+	go h.manager.Start()
 }
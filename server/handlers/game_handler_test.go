@@ -61,7 +61,7 @@ func TestHandleWebSocketWithoutCharacterID(t *testing.T) {
 	rr := httptest.NewRecorder()
 
 	// Call the handler
-	handler.HandleWebSocket(rr, req)
+	handler.HandleWebSocket(rr, withAccount(req, testAccount))
 
 	// Check the response
 	assert.Equal(t, http.StatusBadRequest, rr.Code, "Response code should be 400 Bad Request")
@@ -95,7 +95,7 @@ func TestHandleWebSocketWithInvalidCharacterID(t *testing.T) {
 	rr := httptest.NewRecorder()
 
 	// Call the handler
-	handler.HandleWebSocket(rr, req)
+	handler.HandleWebSocket(rr, withAccount(req, testAccount))
 
 	// Check the response
 	assert.Equal(t, http.StatusNotFound, rr.Code, "Response code should be 404 Not Found")
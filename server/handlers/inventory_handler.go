@@ -11,12 +11,12 @@ import (
 
 // InventoryHandler handles inventory-related API endpoints
 type InventoryHandler struct {
-	characterRepo *repositories.CharacterRepository
-	inventoryRepo *repositories.InventoryRepository
+	characterRepo repositories.CharacterStore
+	inventoryRepo repositories.InventoryStore
 }
 
 // NewInventoryHandler creates a new inventory handler
-func NewInventoryHandler(characterRepo *repositories.CharacterRepository, inventoryRepo *repositories.InventoryRepository) *InventoryHandler {
+func NewInventoryHandler(characterRepo repositories.CharacterStore, inventoryRepo repositories.InventoryStore) *InventoryHandler {
 	return &InventoryHandler{
 		characterRepo: characterRepo,
 		inventoryRepo: inventoryRepo,
@@ -48,6 +48,10 @@ func (h *InventoryHandler) GetInventory(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
+	if !authorizeCharacter(w, r, character) {
+		return
+	}
+
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(character.Inventory)
 }
@@ -64,6 +68,10 @@ func (h *InventoryHandler) GetInventoryItem(w http.ResponseWriter, r *http.Reque
 		return
 	}
 
+	if !authorizeCharacter(w, r, character) {
+		return
+	}
+
 	item, found := character.GetInventoryItem(itemID)
 	if !found {
 		http.Error(w, "Item not found in inventory", http.StatusNotFound)
@@ -86,6 +94,10 @@ func (h *InventoryHandler) EquipItem(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if !authorizeCharacter(w, r, character) {
+		return
+	}
+
 	success := character.EquipItem(itemID)
 	if !success {
 		http.Error(w, "Failed to equip item", http.StatusBadRequest)
@@ -111,6 +123,10 @@ func (h *InventoryHandler) UnequipItem(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if !authorizeCharacter(w, r, character) {
+		return
+	}
+
 	// Find the item to determine its type
 	item, found := character.GetInventoryItem(itemID)
 	if !found {
@@ -159,6 +175,10 @@ func (h *InventoryHandler) UseItem(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if !authorizeCharacter(w, r, character) {
+		return
+	}
+
 	success := character.UseItem(itemID)
 	if !success {
 		http.Error(w, "Failed to use item", http.StatusBadRequest)
@@ -183,6 +203,10 @@ func (h *InventoryHandler) GetEquipment(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
+	if !authorizeCharacter(w, r, character) {
+		return
+	}
+
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(character.Equipment)
 }
@@ -239,6 +263,10 @@ func (h *InventoryHandler) AddItemToInventory(w http.ResponseWriter, r *http.Req
 		return
 	}
 
+	if !authorizeCharacter(w, r, character) {
+		return
+	}
+
 	var req AddItemRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		http.Error(w, "Invalid request body", http.StatusBadRequest)
@@ -286,6 +314,10 @@ func (h *InventoryHandler) GetCharacterWeight(w http.ResponseWriter, r *http.Req
 		return
 	}
 
+	if !authorizeCharacter(w, r, character) {
+		return
+	}
+
 	response := WeightResponse{
 		InventoryWeight:  character.CalculateInventoryWeight(),
 		EquipmentWeight:  character.CalculateEquipmentWeight(),
@@ -23,6 +23,7 @@ func TestInventoryHandler(t *testing.T) {
 
 	// Create a test character
 	character := models.NewCharacter("TestCharacter", models.Warrior)
+	character.OwnerID = testAccount.ID
 	characterRepo.Save(character)
 
 	// Create test items
@@ -50,7 +51,7 @@ func TestInventoryHandler(t *testing.T) {
 
 		router := mux.NewRouter()
 		handler.RegisterRoutes(router)
-		router.ServeHTTP(rr, req)
+		router.ServeHTTP(rr, withAccount(req, testAccount))
 
 		assert.Equal(t, http.StatusOK, rr.Code)
 
@@ -66,7 +67,7 @@ func TestInventoryHandler(t *testing.T) {
 
 		router := mux.NewRouter()
 		handler.RegisterRoutes(router)
-		router.ServeHTTP(rr, req)
+		router.ServeHTTP(rr, withAccount(req, testAccount))
 
 		assert.Equal(t, http.StatusOK, rr.Code)
 
@@ -83,7 +84,7 @@ func TestInventoryHandler(t *testing.T) {
 
 		router := mux.NewRouter()
 		handler.RegisterRoutes(router)
-		router.ServeHTTP(rr, req)
+		router.ServeHTTP(rr, withAccount(req, testAccount))
 
 		assert.Equal(t, http.StatusOK, rr.Code)
 
@@ -112,7 +113,7 @@ func TestInventoryHandler(t *testing.T) {
 
 		router := mux.NewRouter()
 		handler.RegisterRoutes(router)
-		router.ServeHTTP(rr, req)
+		router.ServeHTTP(rr, withAccount(req, testAccount))
 
 		assert.Equal(t, http.StatusOK, rr.Code)
 
@@ -146,7 +147,7 @@ func TestInventoryHandler(t *testing.T) {
 
 		router := mux.NewRouter()
 		handler.RegisterRoutes(router)
-		router.ServeHTTP(rr, req)
+		router.ServeHTTP(rr, withAccount(req, testAccount))
 
 		assert.Equal(t, http.StatusOK, rr.Code)
 
@@ -173,7 +174,7 @@ func TestInventoryHandler(t *testing.T) {
 
 		router := mux.NewRouter()
 		handler.RegisterRoutes(router)
-		router.ServeHTTP(rr, req)
+		router.ServeHTTP(rr, withAccount(req, testAccount))
 
 		assert.Equal(t, http.StatusOK, rr.Code)
 
@@ -189,7 +190,7 @@ func TestInventoryHandler(t *testing.T) {
 
 		router := mux.NewRouter()
 		handler.RegisterRoutes(router)
-		router.ServeHTTP(rr, req)
+		router.ServeHTTP(rr, withAccount(req, testAccount))
 
 		assert.Equal(t, http.StatusNotFound, rr.Code)
 		assert.Contains(t, rr.Body.String(), "Character not found")
@@ -202,7 +203,7 @@ func TestInventoryHandler(t *testing.T) {
 
 		router := mux.NewRouter()
 		handler.RegisterRoutes(router)
-		router.ServeHTTP(rr, req)
+		router.ServeHTTP(rr, withAccount(req, testAccount))
 
 		assert.Equal(t, http.StatusNotFound, rr.Code)
 		assert.Contains(t, rr.Body.String(), "Item not found")
@@ -219,7 +220,7 @@ func TestInventoryHandler(t *testing.T) {
 
 		router := mux.NewRouter()
 		handler.RegisterRoutes(router)
-		router.ServeHTTP(rr, req)
+		router.ServeHTTP(rr, withAccount(req, testAccount))
 
 		assert.Equal(t, http.StatusOK, rr.Code)
 
@@ -254,7 +255,7 @@ func TestInventoryHandler(t *testing.T) {
 
 		router := mux.NewRouter()
 		handler.RegisterRoutes(router)
-		router.ServeHTTP(rr, req)
+		router.ServeHTTP(rr, withAccount(req, testAccount))
 
 		assert.Equal(t, http.StatusOK, rr.Code)
 
@@ -278,7 +279,7 @@ func TestInventoryHandler(t *testing.T) {
 
 		router := mux.NewRouter()
 		handler.RegisterRoutes(router)
-		router.ServeHTTP(rr, req)
+		router.ServeHTTP(rr, withAccount(req, testAccount))
 
 		assert.Equal(t, http.StatusOK, rr.Code)
 
@@ -291,6 +292,7 @@ func TestInventoryHandler(t *testing.T) {
 	t.Run("UnequipItem_FailureCase", func(t *testing.T) {
 		// Create a mock character with a special setup that will cause unequip to fail
 		mockCharacter := models.NewCharacter("MockCharacter", models.Warrior)
+		mockCharacter.OwnerID = testAccount.ID
 		characterRepo.Save(mockCharacter)
 
 		// Try to unequip an item type that isn't equipped
@@ -300,7 +302,7 @@ func TestInventoryHandler(t *testing.T) {
 
 		router := mux.NewRouter()
 		handler.RegisterRoutes(router)
-		router.ServeHTTP(rr, req)
+		router.ServeHTTP(rr, withAccount(req, testAccount))
 
 		// Since there's no item to unequip, this should fail
 		assert.Equal(t, http.StatusNotFound, rr.Code)
@@ -311,6 +313,7 @@ func TestInventoryHandler(t *testing.T) {
 	t.Run("UnequipItem_ModelFailure", func(t *testing.T) {
 		// Create a test character
 		mockCharacter := models.NewCharacter("MockForFailure", models.Warrior)
+		mockCharacter.OwnerID = testAccount.ID
 		characterRepo.Save(mockCharacter)
 
 		// Create a test item that's in inventory but not equipped
@@ -326,7 +329,7 @@ func TestInventoryHandler(t *testing.T) {
 
 		router := mux.NewRouter()
 		handler.RegisterRoutes(router)
-		router.ServeHTTP(rr, req)
+		router.ServeHTTP(rr, withAccount(req, testAccount))
 
 		// This should fail with a bad request
 		assert.Equal(t, http.StatusBadRequest, rr.Code)
@@ -344,7 +347,7 @@ func TestInventoryHandler(t *testing.T) {
 
 		router := mux.NewRouter()
 		handler.RegisterRoutes(router)
-		router.ServeHTTP(rr, req)
+		router.ServeHTTP(rr, withAccount(req, testAccount))
 
 		assert.Equal(t, http.StatusOK, rr.Code)
 
@@ -368,7 +371,7 @@ func TestInventoryHandler(t *testing.T) {
 
 		router := mux.NewRouter()
 		handler.RegisterRoutes(router)
-		router.ServeHTTP(rr, req)
+		router.ServeHTTP(rr, withAccount(req, testAccount))
 
 		assert.Equal(t, http.StatusOK, rr.Code)
 
@@ -387,7 +390,7 @@ func TestInventoryHandler(t *testing.T) {
 
 		router := mux.NewRouter()
 		handler.RegisterRoutes(router)
-		router.ServeHTTP(rr, req)
+		router.ServeHTTP(rr, withAccount(req, testAccount))
 
 		assert.Equal(t, http.StatusOK, rr.Code)
 
@@ -410,7 +413,7 @@ func TestInventoryHandler(t *testing.T) {
 
 		router := mux.NewRouter()
 		handler.RegisterRoutes(router)
-		router.ServeHTTP(rr, req)
+		router.ServeHTTP(rr, withAccount(req, testAccount))
 
 		assert.Equal(t, http.StatusOK, rr.Code)
 
@@ -436,7 +439,7 @@ func TestInventoryHandler(t *testing.T) {
 
 		router := mux.NewRouter()
 		handler.RegisterRoutes(router)
-		router.ServeHTTP(rr, req)
+		router.ServeHTTP(rr, withAccount(req, testAccount))
 
 		assert.Equal(t, http.StatusNotFound, rr.Code)
 		assert.Contains(t, rr.Body.String(), "Character not found")
@@ -452,7 +455,7 @@ func TestInventoryHandler(t *testing.T) {
 
 		router := mux.NewRouter()
 		handler.RegisterRoutes(router)
-		router.ServeHTTP(rr, req)
+		router.ServeHTTP(rr, withAccount(req, testAccount))
 
 		assert.Equal(t, http.StatusBadRequest, rr.Code)
 		assert.Contains(t, rr.Body.String(), "Invalid request body")
@@ -468,7 +471,7 @@ func TestInventoryHandler(t *testing.T) {
 
 		router := mux.NewRouter()
 		handler.RegisterRoutes(router)
-		router.ServeHTTP(rr, req)
+		router.ServeHTTP(rr, withAccount(req, testAccount))
 
 		assert.Equal(t, http.StatusNotFound, rr.Code)
 		assert.Contains(t, rr.Body.String(), "Item not found")
@@ -478,6 +481,7 @@ func TestInventoryHandler(t *testing.T) {
 	t.Run("AddItemToInventory_WeightLimitExceeded", func(t *testing.T) {
 		// Create a character with a low weight limit
 		weakCharacter := models.NewCharacter("WeakCharacter", models.Mage)
+		weakCharacter.OwnerID = testAccount.ID
 		weakCharacter.Attributes.Strength = 3 // Very low strength to reduce weight limit
 		characterRepo.Save(weakCharacter)
 
@@ -494,7 +498,7 @@ func TestInventoryHandler(t *testing.T) {
 
 		router := mux.NewRouter()
 		handler.RegisterRoutes(router)
-		router.ServeHTTP(rr, req)
+		router.ServeHTTP(rr, withAccount(req, testAccount))
 
 		assert.Equal(t, http.StatusBadRequest, rr.Code)
 		assert.Contains(t, rr.Body.String(), "weight limit exceeded")
@@ -504,13 +508,13 @@ func TestInventoryHandler(t *testing.T) {
 		// Generate some items first
 		req, _ := http.NewRequest("POST", "/items/generate", bytes.NewBuffer([]byte(`{"count": 5, "floorLevel": 1}`)))
 		rr := httptest.NewRecorder()
-		handler.GenerateItems(rr, req)
+		handler.GenerateItems(rr, withAccount(req, testAccount))
 		assert.Equal(t, http.StatusOK, rr.Code)
 
 		// Now test GetAllItems
 		req, _ = http.NewRequest("GET", "/items", nil)
 		rr = httptest.NewRecorder()
-		handler.GetAllItems(rr, req)
+		handler.GetAllItems(rr, withAccount(req, testAccount))
 
 		// Check response
 		assert.Equal(t, http.StatusOK, rr.Code)
@@ -533,17 +537,18 @@ func TestInventoryHandler(t *testing.T) {
 	t.Run("GetCharacterWeight", func(t *testing.T) {
 		// Create a new character for this test to avoid interference
 		weightTestChar := models.NewCharacter("WeightTestChar", models.Warrior)
+		weightTestChar.OwnerID = testAccount.ID
 		characterRepo.Save(weightTestChar)
 
 		// Generate some items
 		req, _ := http.NewRequest("POST", "/items/generate", bytes.NewBuffer([]byte(`{"count": 2, "floorLevel": 1}`)))
 		rr := httptest.NewRecorder()
-		handler.GenerateItems(rr, req)
+		handler.GenerateItems(rr, withAccount(req, testAccount))
 
 		// Get the generated items
 		req, _ = http.NewRequest("GET", "/items", nil)
 		rr = httptest.NewRecorder()
-		handler.GetAllItems(rr, req)
+		handler.GetAllItems(rr, withAccount(req, testAccount))
 
 		var items []*models.Item
 		err := json.Unmarshal(rr.Body.Bytes(), &items)
@@ -556,7 +561,7 @@ func TestInventoryHandler(t *testing.T) {
 		rr = httptest.NewRecorder()
 
 		// Call the handler
-		handler.GetCharacterWeight(rr, req)
+		handler.GetCharacterWeight(rr, withAccount(req, testAccount))
 
 		// Check response
 		assert.Equal(t, http.StatusOK, rr.Code)
@@ -585,7 +590,7 @@ func TestInventoryHandler(t *testing.T) {
 		rr := httptest.NewRecorder()
 
 		// Call the handler
-		handler.GetCharacterWeight(rr, req)
+		handler.GetCharacterWeight(rr, withAccount(req, testAccount))
 
 		// Check response
 		assert.Equal(t, http.StatusNotFound, rr.Code)
@@ -0,0 +1,170 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"github.com/jchauncey/TheDeeps/server/game"
+	"github.com/jchauncey/TheDeeps/server/models"
+	"github.com/jchauncey/TheDeeps/server/repositories"
+)
+
+// PartyHandler handles party-related HTTP requests
+type PartyHandler struct {
+	characterRepo repositories.CharacterStore
+	parties       *game.PartyManager
+}
+
+// NewPartyHandler creates a new party handler
+func NewPartyHandler(characterRepo repositories.CharacterStore, parties *game.PartyManager) *PartyHandler {
+	return &PartyHandler{
+		characterRepo: characterRepo,
+		parties:       parties,
+	}
+}
+
+// PartyRequest names who a party action is aimed at
+type PartyRequest struct {
+	CharacterID string          `json:"characterId,omitempty"` // Character to invite or kick
+	PartyID     string          `json:"partyId,omitempty"`     // Party to accept an invite from
+	LootRule    models.LootRule `json:"lootRule,omitempty"`    // Loot rule to switch to
+}
+
+// GetParty handles GET /characters/{id}/party
+func (h *PartyHandler) GetParty(w http.ResponseWriter, r *http.Request) {
+	character, ok := h.character(w, r)
+	if !ok {
+		return
+	}
+
+	party, exists := h.parties.View(character.ID)
+	if !exists {
+		http.Error(w, models.ErrNotInParty.Error(), http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(party)
+}
+
+// Invite handles POST /characters/{id}/party/invite
+func (h *PartyHandler) Invite(w http.ResponseWriter, r *http.Request) {
+	character, request, ok := h.characterAndRequest(w, r)
+	if !ok {
+		return
+	}
+
+	party, err := h.parties.Invite(character.ID, request.CharacterID)
+	h.respond(w, party, err)
+}
+
+// Accept handles POST /characters/{id}/party/accept
+func (h *PartyHandler) Accept(w http.ResponseWriter, r *http.Request) {
+	character, request, ok := h.characterAndRequest(w, r)
+	if !ok {
+		return
+	}
+
+	party, err := h.parties.Accept(character.ID, request.PartyID)
+	h.respond(w, party, err)
+}
+
+// Leave handles POST /characters/{id}/party/leave
+func (h *PartyHandler) Leave(w http.ResponseWriter, r *http.Request) {
+	character, ok := h.character(w, r)
+	if !ok {
+		return
+	}
+
+	if err := h.parties.Leave(character.ID); err != nil {
+		http.Error(w, err.Error(), partyErrorStatus(err))
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Kick handles POST /characters/{id}/party/kick
+func (h *PartyHandler) Kick(w http.ResponseWriter, r *http.Request) {
+	character, request, ok := h.characterAndRequest(w, r)
+	if !ok {
+		return
+	}
+
+	// Kicking the last other member disbands the party
+	party, err := h.parties.Kick(character.ID, request.CharacterID)
+	if err == nil && party.ID == "" {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	h.respond(w, party, err)
+}
+
+// SetLootRule handles PUT /characters/{id}/party/loot
+func (h *PartyHandler) SetLootRule(w http.ResponseWriter, r *http.Request) {
+	character, request, ok := h.characterAndRequest(w, r)
+	if !ok {
+		return
+	}
+
+	party, err := h.parties.SetLootRule(character.ID, request.LootRule)
+	h.respond(w, party, err)
+}
+
+// character loads the character named in the URL, writing an error response
+// and returning false if it doesn't exist or the caller doesn't own it
+func (h *PartyHandler) character(w http.ResponseWriter, r *http.Request) (*models.Character, bool) {
+	character, err := h.characterRepo.GetByID(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return nil, false
+	}
+	if !authorizeCharacter(w, r, character) {
+		return nil, false
+	}
+	return character, true
+}
+
+// characterAndRequest loads the character named in the URL and decodes the request body
+func (h *PartyHandler) characterAndRequest(w http.ResponseWriter, r *http.Request) (*models.Character, PartyRequest, bool) {
+	var request PartyRequest
+	character, ok := h.character(w, r)
+	if !ok {
+		return nil, request, false
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return nil, request, false
+	}
+	return character, request, true
+}
+
+// respond writes the party after an action, or the action's error
+func (h *PartyHandler) respond(w http.ResponseWriter, party game.PartyView, err error) {
+	if err != nil {
+		http.Error(w, err.Error(), partyErrorStatus(err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(party)
+}
+
+// partyErrorStatus maps a party error to an HTTP status code
+func partyErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, models.ErrNotPartyLeader):
+		return http.StatusForbidden
+	case errors.Is(err, models.ErrNotInParty):
+		return http.StatusNotFound
+	case errors.Is(err, models.ErrAlreadyInParty), errors.Is(err, models.ErrPartyFull), errors.Is(err, models.ErrNotInvited):
+		return http.StatusConflict
+	case errors.Is(err, models.ErrInviteSelf), errors.Is(err, models.ErrUnknownLootRule), errors.Is(err, game.ErrKickSelf):
+		return http.StatusBadRequest
+	}
+	// The invited character doesn't exist
+	return http.StatusNotFound
+}
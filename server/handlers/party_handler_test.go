@@ -0,0 +1,82 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/jchauncey/TheDeeps/server/game"
+	"github.com/jchauncey/TheDeeps/server/models"
+	"github.com/jchauncey/TheDeeps/server/repositories"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// partyRequest calls a party handler as the test account for the character with the given ID
+func partyRequest(handler http.HandlerFunc, characterID string, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest("POST", "/characters/"+characterID+"/party", bytes.NewBufferString(body))
+	req = mux.SetURLVars(req, map[string]string{"id": characterID})
+	rr := httptest.NewRecorder()
+	handler(rr, withAccount(req, testAccount))
+	return rr
+}
+
+func TestPartyHandler(t *testing.T) {
+	characterRepo := repositories.NewCharacterRepository()
+	handler := NewPartyHandler(characterRepo, game.NewPartyManager(characterRepo, repositories.NewDungeonRepository()))
+
+	leader := models.NewCharacter("Leader", models.Warrior)
+	friend := models.NewCharacter("Friend", models.Cleric)
+	for _, character := range []*models.Character{leader, friend} {
+		character.OwnerID = testAccount.ID
+		characterRepo.Save(character)
+	}
+
+	// Nobody is in a party yet
+	rr := partyRequest(handler.GetParty, leader.ID, "")
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+
+	rr = partyRequest(handler.Invite, leader.ID, `{"characterId":"missing"}`)
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+	rr = partyRequest(handler.Invite, leader.ID, `{"characterId":"`+leader.ID+`"}`)
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+
+	rr = partyRequest(handler.Invite, leader.ID, `{"characterId":"`+friend.ID+`"}`)
+	require.Equal(t, http.StatusOK, rr.Code)
+	var party game.PartyView
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &party))
+	assert.Equal(t, leader.ID, party.LeaderID)
+	assert.Equal(t, []string{friend.ID}, party.Invites)
+
+	rr = partyRequest(handler.Accept, friend.ID, `{"partyId":"`+party.ID+`"}`)
+	require.Equal(t, http.StatusOK, rr.Code)
+	rr = partyRequest(handler.Accept, friend.ID, `{"partyId":"`+party.ID+`"}`)
+	assert.Equal(t, http.StatusConflict, rr.Code)
+
+	rr = partyRequest(handler.GetParty, friend.ID, "")
+	require.Equal(t, http.StatusOK, rr.Code)
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &party))
+	assert.Len(t, party.Members, 2)
+
+	// Only the leader sets the loot rule
+	rr = partyRequest(handler.SetLootRule, friend.ID, `{"lootRule":"needGreed"}`)
+	assert.Equal(t, http.StatusForbidden, rr.Code)
+	rr = partyRequest(handler.SetLootRule, leader.ID, `{"lootRule":"everything"}`)
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+	rr = partyRequest(handler.SetLootRule, leader.ID, `{"lootRule":"needGreed"}`)
+	require.Equal(t, http.StatusOK, rr.Code)
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &party))
+	assert.Equal(t, models.LootNeedGreed, party.LootRule)
+
+	// Kicking the only other member disbands the party
+	rr = partyRequest(handler.Kick, leader.ID, `{"characterId":"`+friend.ID+`"}`)
+	assert.Equal(t, http.StatusNoContent, rr.Code)
+	rr = partyRequest(handler.Leave, leader.ID, "")
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+
+	rr = partyRequest(handler.Invite, leader.ID, "not json")
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+}
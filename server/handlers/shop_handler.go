@@ -0,0 +1,133 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"github.com/jchauncey/TheDeeps/server/game"
+	"github.com/jchauncey/TheDeeps/server/models"
+	"github.com/jchauncey/TheDeeps/server/repositories"
+)
+
+// ShopHandler handles shop-related HTTP requests
+type ShopHandler struct {
+	characterRepo repositories.CharacterStore
+	shops         *game.ShopManager
+}
+
+// NewShopHandler creates a new shop handler
+func NewShopHandler(characterRepo repositories.CharacterStore, shops *game.ShopManager) *ShopHandler {
+	return &ShopHandler{
+		characterRepo: characterRepo,
+		shops:         shops,
+	}
+}
+
+// TradeRequest names the item to buy or sell
+type TradeRequest struct {
+	ItemID string `json:"itemId"`
+}
+
+// HaggleResponse is the result of haggling with a shopkeeper
+type HaggleResponse struct {
+	Success bool          `json:"success"`
+	Shop    game.ShopView `json:"shop"`
+}
+
+// GetShop handles GET /characters/{id}/shop
+func (h *ShopHandler) GetShop(w http.ResponseWriter, r *http.Request) {
+	character, ok := h.character(w, r)
+	if !ok {
+		return
+	}
+
+	shop, err := h.shops.View(character)
+	h.respond(w, shop, err)
+}
+
+// Buy handles POST /characters/{id}/shop/buy
+func (h *ShopHandler) Buy(w http.ResponseWriter, r *http.Request) {
+	character, request, ok := h.characterAndRequest(w, r)
+	if !ok {
+		return
+	}
+
+	trade, err := h.shops.Buy(character, request.ItemID)
+	h.respond(w, trade, err)
+}
+
+// Sell handles POST /characters/{id}/shop/sell
+func (h *ShopHandler) Sell(w http.ResponseWriter, r *http.Request) {
+	character, request, ok := h.characterAndRequest(w, r)
+	if !ok {
+		return
+	}
+
+	trade, err := h.shops.Sell(character, request.ItemID)
+	h.respond(w, trade, err)
+}
+
+// Haggle handles POST /characters/{id}/shop/haggle
+func (h *ShopHandler) Haggle(w http.ResponseWriter, r *http.Request) {
+	character, ok := h.character(w, r)
+	if !ok {
+		return
+	}
+
+	success, shop, err := h.shops.Haggle(character)
+	h.respond(w, HaggleResponse{Success: success, Shop: shop}, err)
+}
+
+// character loads the character named in the URL, writing an error response
+// and returning false if it doesn't exist or the caller doesn't own it
+func (h *ShopHandler) character(w http.ResponseWriter, r *http.Request) (*models.Character, bool) {
+	character, err := h.characterRepo.GetByID(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return nil, false
+	}
+	if !authorizeCharacter(w, r, character) {
+		return nil, false
+	}
+	return character, true
+}
+
+// characterAndRequest loads the character named in the URL and decodes the request body
+func (h *ShopHandler) characterAndRequest(w http.ResponseWriter, r *http.Request) (*models.Character, TradeRequest, bool) {
+	var request TradeRequest
+	character, ok := h.character(w, r)
+	if !ok {
+		return nil, request, false
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return nil, request, false
+	}
+	return character, request, true
+}
+
+// respond writes the result of a shop action, or the action's error
+func (h *ShopHandler) respond(w http.ResponseWriter, result interface{}, err error) {
+	if err != nil {
+		http.Error(w, err.Error(), shopErrorStatus(err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
+
+// shopErrorStatus maps a shop error to an HTTP status code
+func shopErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, models.ErrNotInStock), errors.Is(err, models.ErrNotInInventory):
+		return http.StatusNotFound
+	case errors.Is(err, models.ErrNotEnoughGold), errors.Is(err, models.ErrTooHeavy), errors.Is(err, models.ErrAlreadyHaggled),
+		errors.Is(err, game.ErrNotInShop), errors.Is(err, game.ErrNoShopkeeper):
+		return http.StatusConflict
+	}
+	return http.StatusBadRequest
+}
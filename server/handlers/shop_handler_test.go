@@ -0,0 +1,80 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/jchauncey/TheDeeps/server/game"
+	"github.com/jchauncey/TheDeeps/server/models"
+	"github.com/jchauncey/TheDeeps/server/repositories"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// shopRequest calls a shop handler as the test account for the character with the given ID
+func shopRequest(handler http.HandlerFunc, characterID string, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest("POST", "/characters/"+characterID+"/shop", bytes.NewBufferString(body))
+	req = mux.SetURLVars(req, map[string]string{"id": characterID})
+	rr := httptest.NewRecorder()
+	handler(rr, withAccount(req, testAccount))
+	return rr
+}
+
+func TestShopHandler(t *testing.T) {
+	characterRepo := repositories.NewCharacterRepository()
+	dungeonRepo := repositories.NewDungeonRepository()
+	handler := NewShopHandler(characterRepo, game.NewShopManager(characterRepo, dungeonRepo))
+
+	dungeon := models.NewDungeon("Market", 1, 12345)
+	floor := dungeon.GenerateFloor(1)
+	room := models.Room{ID: "shop", Type: models.RoomShop, X: 1, Y: 1, Width: 3, Height: 3}
+	floor.Rooms = append(floor.Rooms, room)
+	floor.Tiles[2][2] = models.Tile{Type: models.TileFloor, Walkable: true, RoomID: room.ID}
+	shopkeeper := models.NewMob(models.MobShopkeeper, models.VariantNormal, 1)
+	shopkeeper.Position = models.Position{X: 1, Y: 1}
+	floor.Mobs[shopkeeper.ID] = shopkeeper
+	require.NoError(t, dungeonRepo.Save(dungeon))
+
+	character := models.NewCharacter("Shopper", models.Bard)
+	character.OwnerID = testAccount.ID
+	character.CurrentDungeon = dungeon.ID
+	character.CurrentFloor = 1
+	character.Position = models.Position{X: 2, Y: 2}
+	character.Gold = 10000
+	require.NoError(t, characterRepo.Save(character))
+
+	rr := shopRequest(handler.GetShop, character.ID, "")
+	require.Equal(t, http.StatusOK, rr.Code)
+	var shop game.ShopView
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &shop))
+	require.NotEmpty(t, shop.Stock)
+
+	rr = shopRequest(handler.Buy, character.ID, `{"itemId":"`+shop.Stock[0].Item.ID+`"}`)
+	require.Equal(t, http.StatusOK, rr.Code)
+	var trade game.Trade
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &trade))
+	assert.Equal(t, shop.Stock[0].Price, trade.Price)
+	assert.Equal(t, 10000-trade.Price, trade.Gold)
+
+	rr = shopRequest(handler.Buy, character.ID, `{"itemId":"`+shop.Stock[0].Item.ID+`"}`)
+	assert.Equal(t, http.StatusNotFound, rr.Code, "The item was already bought")
+
+	rr = shopRequest(handler.Sell, character.ID, `{"itemId":"`+trade.Item.ID+`"}`)
+	assert.Equal(t, http.StatusOK, rr.Code)
+
+	rr = shopRequest(handler.Haggle, character.ID, "")
+	require.Equal(t, http.StatusOK, rr.Code)
+	rr = shopRequest(handler.Haggle, character.ID, "")
+	assert.Equal(t, http.StatusConflict, rr.Code, "One haggle per restock")
+
+	// Shopping needs a shop
+	character.Position = models.Position{X: 30, Y: 30}
+	rr = shopRequest(handler.GetShop, character.ID, "")
+	assert.Equal(t, http.StatusConflict, rr.Code)
+	rr = shopRequest(handler.Buy, character.ID, "not json")
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+}
@@ -0,0 +1,46 @@
+package handlers
+
+import (
+	"github.com/jchauncey/TheDeeps/server/models"
+	"github.com/jchauncey/TheDeeps/server/repositories"
+)
+
+// newWalledFloor creates a first floor of open tiles surrounded by walls
+func newWalledFloor(width, height int) *models.Floor {
+	floor := &models.Floor{
+		Level:  1,
+		Width:  width,
+		Height: height,
+		Tiles:  make([][]models.Tile, height),
+		Mobs:   make(map[string]*models.Mob),
+		Items:  make(map[string]models.Item),
+	}
+	for y := range floor.Tiles {
+		floor.Tiles[y] = make([]models.Tile, width)
+		for x := range floor.Tiles[y] {
+			if x == 0 || y == 0 || x == width-1 || y == height-1 {
+				floor.Tiles[y][x] = models.Tile{Type: models.TileWall}
+			} else {
+				floor.Tiles[y][x] = models.Tile{Type: models.TileFloor, Walkable: true}
+			}
+		}
+	}
+	return floor
+}
+
+// placeCharacter saves a dungeon holding the floor and a character of the test
+// account standing on it
+func placeCharacter(characterRepo repositories.CharacterStore, dungeonRepo repositories.DungeonStore, floor *models.Floor, x, y int) *models.Character {
+	dungeon := models.NewDungeon("TestDungeon", 1, 12345)
+	dungeon.FloorData[floor.Level] = floor
+	dungeonRepo.Save(dungeon)
+
+	character := models.NewCharacter("Test Character", models.Warrior)
+	character.OwnerID = testAccount.ID
+	character.CurrentDungeon = dungeon.ID
+	character.CurrentFloor = floor.Level
+	character.Position = models.Position{X: x, Y: y}
+	floor.Tiles[y][x].Character = character.ID
+	characterRepo.Save(character)
+	return character
+}
@@ -6,10 +6,14 @@ import (
 	"net/http"
 	"os"
 	"os/signal"
+	"strings"
 	"syscall"
 	"time"
 
+	"github.com/jchauncey/TheDeeps/server/auth"
+	"github.com/jchauncey/TheDeeps/server/game"
 	"github.com/jchauncey/TheDeeps/server/log"
+	"github.com/jchauncey/TheDeeps/server/models"
 	"github.com/rs/cors"
 )
 
@@ -25,11 +29,60 @@ func main() {
 
 	// Parse command line flags
 	port := flag.String("port", "8080", "port to run the server on")
+	storage := flag.String("storage", StorageMemory, "storage backend to use (memory or bolt)")
+	dataPath := flag.String("data", "thedeeps.db", "database file used by the bolt storage backend")
+	secret := flag.String("secret", os.Getenv("THEDEEPS_SECRET"), "secret used to sign session tokens (defaults to $THEDEEPS_SECRET)")
+	monsters := flag.String("monsters", "", "JSON file of monster definitions (defaults to the built-in set)")
+	lootTables := flag.String("loot", "", "JSON file of loot tables (defaults to the built-in set)")
+	admins := flag.String("admins", "", "comma-separated account IDs allowed to use the admin routes")
+	deathXPLoss := flag.Int("death-xp-loss", game.DefaultDeathPenalty.XPLossPercent, "percent of progress toward the next level lost on death")
+	deathGoldLoss := flag.Int("death-gold-loss", game.DefaultDeathPenalty.GoldLossPercent, "percent of carried gold left on the corpse on death")
 	flag.Parse()
 
+	// Without a configured secret, sessions only last until the server restarts
+	tokenSecret := []byte(*secret)
+	if len(tokenSecret) == 0 {
+		generated, err := auth.GenerateSecret()
+		if err != nil {
+			log.Fatal("Could not generate token secret: %v", err)
+		}
+		tokenSecret = generated
+		log.Warn("No token secret configured; sessions will not survive a restart")
+	}
+
+	// Monster definitions and loot tables are validated before anything can spawn
+	if *monsters != "" {
+		catalog, err := models.LoadMonsterCatalog(*monsters)
+		if err != nil {
+			log.Fatal("Could not load monster definitions: %v", err)
+		}
+		models.SetMonsterCatalog(catalog)
+		log.Info("Loaded %d monster definitions from %s", len(catalog.Monsters), *monsters)
+	}
+	if *lootTables != "" {
+		catalog, err := models.LoadLootCatalog(*lootTables)
+		if err != nil {
+			log.Fatal("Could not load loot tables: %v", err)
+		}
+		models.SetLootCatalog(catalog)
+		log.Info("Loaded %d loot tables from %s", len(catalog.Tables), *lootTables)
+	}
+	if err := models.Loot().ValidateMonsters(models.Monsters()); err != nil {
+		log.Fatal("Monster loot tables are invalid: %v", err)
+	}
+
 	// Create and set up server
-	server := NewServer()
-	server.SetupRoutes()
+	server, err := NewServer(StorageOptions{Backend: *storage, Path: *dataPath}, tokenSecret, adminIDs(*admins))
+	if err != nil {
+		log.Fatal("Could not create server: %v", err)
+	}
+	defer server.Close()
+
+	if *deathXPLoss < 0 || *deathXPLoss > 100 || *deathGoldLoss < 0 || *deathGoldLoss > 100 {
+		log.Fatal("Death penalties must be between 0 and 100 percent")
+	}
+	server.gameManager.DeathPenalty.XPLossPercent = *deathXPLoss
+	server.gameManager.DeathPenalty.GoldLossPercent = *deathGoldLoss
 
 	// Set up CORS
 	c := cors.New(cors.Options{
@@ -73,3 +126,14 @@ func main() {
 
 	log.Info("Server exited")
 }
+
+// adminIDs splits the -admins flag into account IDs
+func adminIDs(value string) []string {
+	admins := make([]string, 0)
+	for _, accountID := range strings.Split(value, ",") {
+		if accountID = strings.TrimSpace(accountID); accountID != "" {
+			admins = append(admins, accountID)
+		}
+	}
+	return admins
+}
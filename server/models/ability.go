@@ -0,0 +1,217 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+)
+
+// AbilityID identifies a class ability
+type AbilityID string
+
+const (
+	AbilityCleave         AbilityID = "cleave"
+	AbilityRecklessStrike AbilityID = "recklessStrike"
+	AbilitySmite          AbilityID = "smite"
+	AbilityStunningStrike AbilityID = "stunningStrike"
+	AbilityAimedShot      AbilityID = "aimedShot"
+	AbilityBackstab       AbilityID = "backstab"
+	AbilityFireball       AbilityID = "fireball"
+	AbilityLightningBolt  AbilityID = "lightningBolt"
+	AbilityEldritchBlast  AbilityID = "eldritchBlast"
+	AbilityHeal           AbilityID = "heal"
+	AbilityRegrowth       AbilityID = "regrowth"
+	AbilityInspire        AbilityID = "inspire"
+)
+
+// AbilityTarget decides what an ability can be aimed at
+type AbilityTarget string
+
+const (
+	TargetSelf  AbilityTarget = "self"  // Affects only the caster
+	TargetEnemy AbilityTarget = "enemy" // Hits one mob within range
+	TargetArea  AbilityTarget = "area"  // Hits every mob within the radius of a mob in range, or of the caster when the range is 0
+)
+
+// Errors returned when an ability can't be cast
+var (
+	ErrUnknownAbility  = errors.New("you don't know that ability")
+	ErrNotEnoughMana   = errors.New("not enough mana")
+	ErrAbilityCooldown = errors.New("ability is on cooldown")
+)
+
+// Ability is a class ability or spell
+type Ability struct {
+	ID          AbilityID      `json:"id"`
+	Name        string         `json:"name"`
+	Class       CharacterClass `json:"class"`
+	Level       int            `json:"level"`    // Character level needed to use it
+	ManaCost    int            `json:"manaCost"` // Mana spent on each cast
+	Cooldown    int            `json:"cooldown"` // Turns before it can be used again
+	Target      AbilityTarget  `json:"target"`
+	Range       int            `json:"range,omitempty"`  // Tiles to the target; 1 means adjacent
+	Radius      int            `json:"radius,omitempty"` // Tiles around the center an area ability hits
+	Description string         `json:"description"`
+
+	Power        int           `json:"power,omitempty"`        // Base damage, or healing for self abilities
+	WeaponDamage bool          `json:"weaponDamage,omitempty"` // Adds the caster's attack power and is reduced by defense
+	Attribute    string        `json:"attribute,omitempty"`    // Attribute whose modifier is added twice
+	Skill        SkillType     `json:"skill,omitempty"`        // Skill whose bonus is added twice
+	Effect       *StatusEffect `json:"effect,omitempty"`       // Applied to each target, or to the caster for self abilities
+}
+
+// Abilities holds every class ability in the order they are listed to players
+var Abilities = []Ability{
+	{
+		ID: AbilityCleave, Name: "Cleave", Class: Warrior, Level: 1, Cooldown: 3,
+		Target: TargetArea, Radius: 1, WeaponDamage: true,
+		Description: "Swing at every enemy next to you",
+	},
+	{
+		ID: AbilityRecklessStrike, Name: "Reckless Strike", Class: Barbarian, Level: 1, Cooldown: 3,
+		Target: TargetEnemy, Range: 1, WeaponDamage: true, Attribute: "Strength",
+		Description: "A wild blow that trades caution for strength",
+	},
+	{
+		ID: AbilitySmite, Name: "Smite", Class: Paladin, Level: 1, ManaCost: 4, Cooldown: 2,
+		Target: TargetEnemy, Range: 1, Power: 3, WeaponDamage: true, Attribute: "Charisma",
+		Description: "Channel holy power through your weapon",
+	},
+	{
+		ID: AbilityStunningStrike, Name: "Stunning Strike", Class: Monk, Level: 1, ManaCost: 3, Cooldown: 4,
+		Target: TargetEnemy, Range: 1, WeaponDamage: true,
+		Effect:      &StatusEffect{Type: StatusStun, Duration: 1},
+		Description: "A precise strike that leaves the enemy reeling",
+	},
+	{
+		ID: AbilityAimedShot, Name: "Aimed Shot", Class: Ranger, Level: 1, ManaCost: 2, Cooldown: 2,
+		Target: TargetEnemy, Range: 6, WeaponDamage: true, Attribute: "Dexterity",
+		Description: "A carefully aimed shot at a distant enemy",
+	},
+	{
+		ID: AbilityBackstab, Name: "Backstab", Class: Rogue, Level: 1, ManaCost: 2, Cooldown: 3,
+		Target: TargetEnemy, Range: 1, WeaponDamage: true, Skill: SkillStealth,
+		Description: "Strike where it hurts, for more damage the stealthier you are",
+	},
+	{
+		ID: AbilityFireball, Name: "Fireball", Class: Mage, Level: 1, ManaCost: 8, Cooldown: 2,
+		Target: TargetArea, Range: 6, Radius: 1, Power: 8, Attribute: "Intelligence",
+		Effect:      &StatusEffect{Type: StatusBurn, Duration: 2, Potency: 2},
+		Description: "Hurl a ball of fire that bursts over an enemy and those around it",
+	},
+	{
+		ID: AbilityLightningBolt, Name: "Lightning Bolt", Class: Sorcerer, Level: 1, ManaCost: 6, Cooldown: 1,
+		Target: TargetEnemy, Range: 8, Power: 10, Attribute: "Charisma",
+		Description: "Strike a distant enemy with lightning",
+	},
+	{
+		ID: AbilityEldritchBlast, Name: "Eldritch Blast", Class: Warlock, Level: 1, ManaCost: 4,
+		Target: TargetEnemy, Range: 6, Power: 6, Attribute: "Charisma",
+		Description: "A beam of crackling energy",
+	},
+	{
+		ID: AbilityHeal, Name: "Heal", Class: Cleric, Level: 1, ManaCost: 6, Cooldown: 2,
+		Target: TargetSelf, Power: 10, Attribute: "Wisdom",
+		Description: "Mend your wounds",
+	},
+	{
+		ID: AbilityRegrowth, Name: "Regrowth", Class: Druid, Level: 1, ManaCost: 6, Cooldown: 4,
+		Target:      TargetSelf,
+		Effect:      &StatusEffect{Type: StatusRegeneration, Duration: 5, Potency: 3},
+		Description: "Nature slowly heals you over the next turns",
+	},
+	{
+		ID: AbilityInspire, Name: "Inspire", Class: Bard, Level: 1, ManaCost: 5, Cooldown: 5,
+		Target:      TargetSelf,
+		Effect:      &StatusEffect{Type: StatusHaste, Duration: 4},
+		Description: "A rousing song that quickens your step",
+	},
+}
+
+// GetAbility returns the ability with the given ID
+func GetAbility(id AbilityID) (Ability, bool) {
+	for _, ability := range Abilities {
+		if ability.ID == id {
+			return ability, true
+		}
+	}
+	return Ability{}, false
+}
+
+// GetAbilitiesForClass returns the abilities of a class, whatever their level
+func GetAbilitiesForClass(class CharacterClass) []Ability {
+	abilities := make([]Ability, 0)
+	for _, ability := range Abilities {
+		if ability.Class == class {
+			abilities = append(abilities, ability)
+		}
+	}
+	return abilities
+}
+
+// KnownAbilities returns the abilities the character's class and level allow
+func (c *Character) KnownAbilities() []Ability {
+	abilities := make([]Ability, 0)
+	for _, ability := range GetAbilitiesForClass(c.Class) {
+		if c.Level >= ability.Level {
+			abilities = append(abilities, ability)
+		}
+	}
+	return abilities
+}
+
+// CanCast checks if the character knows an ability and can pay for it now
+func (c *Character) CanCast(id AbilityID) (Ability, error) {
+	ability, exists := GetAbility(id)
+	if !exists || ability.Class != c.Class || c.Level < ability.Level {
+		return Ability{}, ErrUnknownAbility
+	}
+	if turns := c.Cooldowns[id]; turns > 0 {
+		return Ability{}, fmt.Errorf("%w for %d more turns", ErrAbilityCooldown, turns)
+	}
+	if c.CurrentMana < ability.ManaCost {
+		return Ability{}, ErrNotEnoughMana
+	}
+	return ability, nil
+}
+
+// SpendAbility takes the mana for an ability and starts its cooldown
+func (c *Character) SpendAbility(ability Ability) {
+	c.CurrentMana -= ability.ManaCost
+	if ability.Cooldown > 0 {
+		cooldowns := make(map[AbilityID]int, len(c.Cooldowns)+1)
+		for id, turns := range c.Cooldowns {
+			cooldowns[id] = turns
+		}
+		cooldowns[ability.ID] = ability.Cooldown
+		c.Cooldowns = cooldowns
+	}
+}
+
+// TickCooldowns counts every ability cooldown down by a turn
+func (c *Character) TickCooldowns() {
+	if len(c.Cooldowns) == 0 {
+		return
+	}
+	cooldowns := make(map[AbilityID]int, len(c.Cooldowns))
+	for id, turns := range c.Cooldowns {
+		if turns > 1 {
+			cooldowns[id] = turns - 1
+		}
+	}
+	c.Cooldowns = cooldowns
+}
+
+// AbilityPower calculates the damage, or healing for self abilities, of an ability cast by the character
+func (c *Character) AbilityPower(ability Ability) int {
+	power := ability.Power
+	if ability.WeaponDamage {
+		power += c.CalculateAttackPower()
+	}
+	if ability.Attribute != "" {
+		power += GetModifier(GetAttributeValue(c.EffectiveAttributes(), ability.Attribute)) * 2
+	}
+	if ability.Skill != "" {
+		power += c.GetSkillBonus(ability.Skill) * 2
+	}
+	return max(power, 0)
+}
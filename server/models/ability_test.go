@@ -0,0 +1,85 @@
+package models
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEveryClassHasAnAbility(t *testing.T) {
+	for _, class := range []CharacterClass{Warrior, Mage, Rogue, Cleric, Druid, Warlock, Bard, Paladin, Ranger, Monk, Barbarian, Sorcerer} {
+		character := NewCharacter("Test", class)
+		abilities := character.KnownAbilities()
+		require.NotEmpty(t, abilities, "%s should know an ability at level 1", class)
+
+		for _, ability := range abilities {
+			assert.LessOrEqual(t, ability.ManaCost, character.MaxMana, "%s should be able to afford %s", class, ability.ID)
+			if ability.Effect != nil {
+				assert.NoError(t, ability.Effect.validate(), "%s has an invalid effect", ability.ID)
+			}
+		}
+	}
+
+	ids := make(map[AbilityID]bool)
+	for _, ability := range Abilities {
+		assert.False(t, ids[ability.ID], "%s is defined more than once", ability.ID)
+		ids[ability.ID] = true
+	}
+}
+
+func TestCanCast(t *testing.T) {
+	mage := NewCharacter("Mage", Mage)
+
+	ability, err := mage.CanCast(AbilityFireball)
+	require.NoError(t, err)
+	assert.Equal(t, "Fireball", ability.Name)
+
+	_, err = mage.CanCast(AbilityHeal)
+	assert.ErrorIs(t, err, ErrUnknownAbility, "Mages can't cast cleric abilities")
+	_, err = mage.CanCast("nothing")
+	assert.ErrorIs(t, err, ErrUnknownAbility)
+
+	mage.SpendAbility(ability)
+	assert.Equal(t, mage.MaxMana-ability.ManaCost, mage.CurrentMana)
+	_, err = mage.CanCast(AbilityFireball)
+	assert.ErrorIs(t, err, ErrAbilityCooldown)
+
+	// The cooldown runs out after the given number of turns
+	for i := 0; i < ability.Cooldown; i++ {
+		mage.TickCooldowns()
+	}
+	assert.Empty(t, mage.Cooldowns)
+
+	mage.CurrentMana = ability.ManaCost - 1
+	_, err = mage.CanCast(AbilityFireball)
+	assert.True(t, errors.Is(err, ErrNotEnoughMana))
+}
+
+func TestSpendAbilityCopiesCooldowns(t *testing.T) {
+	warrior := NewCharacter("Warrior", Warrior)
+	snapshot := warrior.Cooldowns
+
+	cleave, _ := GetAbility(AbilityCleave)
+	warrior.SpendAbility(cleave)
+	assert.Empty(t, snapshot, "Earlier copies should not change")
+	assert.Equal(t, cleave.Cooldown, warrior.Cooldowns[AbilityCleave])
+	assert.Equal(t, 0, warrior.CurrentMana, "Cleave costs no mana")
+}
+
+func TestAbilityPower(t *testing.T) {
+	rogue := NewCharacter("Rogue", Rogue)
+	backstab, _ := GetAbility(AbilityBackstab)
+
+	withoutStealth := rogue.CalculateAttackPower()
+	assert.Equal(t, withoutStealth+rogue.GetSkillBonus(SkillStealth)*2, rogue.AbilityPower(backstab))
+
+	// Better stealth means a deadlier backstab
+	rogue.Skills.SkillList[SkillStealth].Level += 4
+	assert.Greater(t, rogue.AbilityPower(backstab), withoutStealth+rogue.GetSkillBonus(SkillStealth))
+
+	cleric := NewCharacter("Cleric", Cleric)
+	heal, _ := GetAbility(AbilityHeal)
+	assert.Equal(t, heal.Power+GetModifier(cleric.Attributes.Wisdom)*2, cleric.AbilityPower(heal))
+}
@@ -0,0 +1,37 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Account represents a player account that owns characters
+type Account struct {
+	ID           string    `json:"id"`
+	Username     string    `json:"username"`
+	PasswordHash string    `json:"passwordHash,omitempty"`
+	CreatedAt    time.Time `json:"createdAt"`
+}
+
+// NewAccount creates a new account with an already hashed password
+func NewAccount(username string, passwordHash string) *Account {
+	return &Account{
+		ID:           uuid.New().String(),
+		Username:     username,
+		PasswordHash: passwordHash,
+		CreatedAt:    time.Now(),
+	}
+}
+
+// Public returns a copy of the account that is safe to send to clients
+func (a *Account) Public() *Account {
+	public := *a
+	public.PasswordHash = ""
+	return &public
+}
+
+// Owns checks if the account owns a character
+func (a *Account) Owns(character *Character) bool {
+	return character != nil && character.OwnerID != "" && character.OwnerID == a.ID
+}
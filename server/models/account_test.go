@@ -0,0 +1,41 @@
+package models
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewAccount(t *testing.T) {
+	account := NewAccount("player", "hash")
+
+	assert.NotEmpty(t, account.ID, "Account ID should be generated")
+	assert.Equal(t, "player", account.Username)
+	assert.Equal(t, "hash", account.PasswordHash)
+	assert.False(t, account.CreatedAt.IsZero(), "Creation time should be set")
+}
+
+func TestAccountPublic(t *testing.T) {
+	account := NewAccount("player", "hash")
+	public := account.Public()
+
+	assert.Empty(t, public.PasswordHash, "Public account should not expose the password hash")
+	assert.Equal(t, account.ID, public.ID)
+	assert.Equal(t, "hash", account.PasswordHash, "Original account should be unchanged")
+}
+
+func TestAccountOwns(t *testing.T) {
+	account := NewAccount("player", "hash")
+	other := NewAccount("other", "hash")
+
+	character := NewCharacter("Owned", Warrior)
+	character.OwnerID = account.ID
+
+	assert.True(t, account.Owns(character))
+	assert.False(t, other.Owns(character))
+	assert.False(t, account.Owns(nil))
+
+	// Characters without an owner belong to nobody
+	character.OwnerID = ""
+	assert.False(t, account.Owns(character))
+}
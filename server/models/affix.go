@@ -0,0 +1,201 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"slices"
+	"strings"
+)
+
+// AffixKind is where an affix goes in an item's name
+type AffixKind string
+
+const (
+	AffixPrefix AffixKind = "prefix"
+	AffixSuffix AffixKind = "suffix"
+)
+
+// AffixEffect is what an affix does for the character wielding or wearing the item
+type AffixEffect string
+
+const (
+	EffectStrength     AffixEffect = "strength"
+	EffectDexterity    AffixEffect = "dexterity"
+	EffectConstitution AffixEffect = "constitution"
+	EffectIntelligence AffixEffect = "intelligence"
+	EffectWisdom       AffixEffect = "wisdom"
+	EffectCharisma     AffixEffect = "charisma"
+	EffectDamage       AffixEffect = "damage"    // Added to attack power
+	EffectArmor        AffixEffect = "armor"     // Added to AC
+	EffectAccuracy     AffixEffect = "accuracy"  // Added to the attack bonus for hit chance
+	EffectCrit         AffixEffect = "crit"      // Percent added to the critical hit chance
+	EffectFire         AffixEffect = "fire"      // Fire damage that ignores defense
+	EffectCold         AffixEffect = "cold"      // Cold damage that ignores defense
+	EffectLightning    AffixEffect = "lightning" // Lightning damage that ignores defense
+	EffectLifesteal    AffixEffect = "lifesteal" // Percent of damage dealt healed
+)
+
+// AffixEffects lists every affix effect
+var AffixEffects = []AffixEffect{
+	EffectStrength, EffectDexterity, EffectConstitution, EffectIntelligence, EffectWisdom, EffectCharisma,
+	EffectDamage, EffectArmor, EffectAccuracy, EffectCrit, EffectFire, EffectCold, EffectLightning, EffectLifesteal,
+}
+
+// ElementalEffects lists the effects that deal elemental damage
+var ElementalEffects = []AffixEffect{EffectFire, EffectCold, EffectLightning}
+
+// Affix is a rolled affix on an item
+type Affix struct {
+	Name   string      `json:"name"`
+	Kind   AffixKind   `json:"kind"`
+	Effect AffixEffect `json:"effect"`
+	Value  int         `json:"value"`
+}
+
+// AffixDefinition describes an affix that can be rolled onto loot
+type AffixDefinition struct {
+	Name     string      `json:"name"`
+	Kind     AffixKind   `json:"kind"`
+	Effect   AffixEffect `json:"effect"`
+	Min      int         `json:"min"`
+	Max      int         `json:"max"`
+	PerDepth float64     `json:"perDepth,omitempty"` // Value added for each floor below the first
+	Types    []ItemType  `json:"types"`              // Item types the affix can roll on
+	Weight   int         `json:"weight"`
+	MinDepth int         `json:"minDepth,omitempty"` // Shallowest floor the affix can roll on
+}
+
+// validate checks a single affix definition
+func (d *AffixDefinition) validate() error {
+	var errs []error
+
+	if d.Kind != AffixPrefix && d.Kind != AffixSuffix {
+		errs = append(errs, fmt.Errorf("kind %q must be prefix or suffix", d.Kind))
+	}
+	if !validEffect(d.Effect) {
+		errs = append(errs, fmt.Errorf("effect %q is unknown", d.Effect))
+	}
+	if d.Min <= 0 || d.Max < d.Min || d.PerDepth < 0 {
+		errs = append(errs, errors.New("min must be positive and no more than max"))
+	}
+	if d.Weight <= 0 {
+		errs = append(errs, errors.New("weight must be positive"))
+	}
+	if d.MinDepth < 0 {
+		errs = append(errs, errors.New("minDepth can't be negative"))
+	}
+	if len(d.Types) == 0 {
+		errs = append(errs, errors.New("no item types are given"))
+	}
+	for _, itemType := range d.Types {
+		if itemType != ItemWeapon && itemType != ItemArmor {
+			errs = append(errs, fmt.Errorf("type %q can't have affixes", itemType))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// validEffect checks if an effect is one of the known affix effects
+func validEffect(effect AffixEffect) bool {
+	for _, known := range AffixEffects {
+		if effect == known {
+			return true
+		}
+	}
+	return false
+}
+
+// rollsOn checks if the affix can roll on an item type on a floor
+func (d *AffixDefinition) rollsOn(itemType ItemType, depth int) bool {
+	if depth < d.MinDepth {
+		return false
+	}
+	for _, allowed := range d.Types {
+		if allowed == itemType {
+			return true
+		}
+	}
+	return false
+}
+
+// roll creates an affix from the definition, scaled for the floor and rarity
+func (d *AffixDefinition) roll(rng *rand.Rand, depth int, modifier RarityModifier) Affix {
+	value := float64(d.Min+rng.Intn(d.Max-d.Min+1)) + d.PerDepth*float64(max(depth-1, 0))
+	return Affix{
+		Name:   d.Name,
+		Kind:   d.Kind,
+		Effect: d.Effect,
+		Value:  max(int(value*modifier.Power), 1),
+	}
+}
+
+// rollAffixes gives an item as many affixes as its rarity allows, at most one
+// prefix and one suffix, and names it after them
+func (c *LootCatalog) rollAffixes(rng *rand.Rand, item *Item, depth int) {
+	count := c.Rarities[item.Rarity].Affixes
+	if count == 0 {
+		return
+	}
+
+	// With room for only one affix, prefixes and suffixes compete for the slot
+	kinds := [][]AffixKind{{AffixPrefix, AffixSuffix}}
+	if count >= 2 {
+		kinds = [][]AffixKind{{AffixPrefix}, {AffixSuffix}}
+	}
+
+	for _, allowed := range kinds {
+		candidates := make([]*AffixDefinition, 0)
+		total := 0
+		for _, definition := range c.Affixes {
+			if definition.rollsOn(item.Type, depth) && slices.Contains(allowed, definition.Kind) {
+				candidates = append(candidates, definition)
+				total += definition.Weight
+			}
+		}
+		if total == 0 {
+			continue
+		}
+
+		pick := rng.Intn(total)
+		for _, definition := range candidates {
+			if pick < definition.Weight {
+				item.Affixes = append(item.Affixes, definition.roll(rng, depth, c.Rarities[item.Rarity]))
+				break
+			}
+			pick -= definition.Weight
+		}
+	}
+
+	item.Name = ItemName(item.BaseName, item.Affixes)
+}
+
+// ItemName builds an item's name from its base name and affixes,
+// e.g. "Flaming Sword of the Bear"
+func ItemName(baseName string, affixes []Affix) string {
+	parts := make([]string, 0, len(affixes)+1)
+	for _, affix := range affixes {
+		if affix.Kind == AffixPrefix {
+			parts = append(parts, affix.Name)
+		}
+	}
+	parts = append(parts, baseName)
+	for _, affix := range affixes {
+		if affix.Kind == AffixSuffix {
+			parts = append(parts, affix.Name)
+		}
+	}
+	return strings.Join(parts, " ")
+}
+
+// AffixBonus returns the total value of an item's affixes with an effect
+func (i *Item) AffixBonus(effect AffixEffect) int {
+	bonus := 0
+	for _, affix := range i.Affixes {
+		if affix.Effect == effect {
+			bonus += affix.Value
+		}
+	}
+	return bonus
+}
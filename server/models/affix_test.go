@@ -0,0 +1,130 @@
+package models
+
+import (
+	"math/rand"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testAffixLootJSON is a catalog whose rare swords always roll the same affixes
+const testAffixLootJSON = `{
+  "rarities": {
+    "common": {"power": 1, "value": 1},
+    "uncommon": {"power": 1, "value": 2, "affixes": 1},
+    "rare": {"power": 2, "value": 4, "affixes": 2},
+    "epic": {"power": 3, "value": 8, "affixes": 2},
+    "legendary": {"power": 4, "value": 16, "affixes": 2}
+  },
+  "items": [
+    {"name": "Sword", "type": "weapon", "power": 4, "value": 20, "weight": 3},
+    {"name": "Health Potion", "type": "potion", "power": 10, "value": 10, "weight": 0.5}
+  ],
+  "affixes": [
+    {"name": "Flaming", "kind": "prefix", "effect": "fire", "min": 2, "max": 2, "perDepth": 1, "types": ["weapon"], "weight": 1},
+    {"name": "of the Bear", "kind": "suffix", "effect": "strength", "min": 1, "max": 1, "types": ["weapon"], "weight": 1},
+    {"name": "Sturdy", "kind": "prefix", "effect": "armor", "min": 1, "max": 1, "types": ["armor"], "weight": 1},
+    {"name": "Vampiric", "kind": "prefix", "effect": "lifesteal", "min": 5, "max": 5, "types": ["weapon"], "weight": 100, "minDepth": 10}
+  ],
+  "tables": {
+    "common": {"entries": [{"item": "Sword", "weight": 1}]},
+    "uncommon": {"entries": [{"item": "Sword", "rarity": "uncommon", "weight": 1}]},
+    "rare": {"entries": [{"item": "Sword", "rarity": "rare", "weight": 1}, {"item": "Health Potion", "rarity": "rare", "weight": 1}]}
+  },
+  "random": "common"
+}`
+
+func TestRollAffixes(t *testing.T) {
+	catalog, err := ParseLootCatalog([]byte(testAffixLootJSON))
+	require.NoError(t, err)
+
+	rng := rand.New(rand.NewSource(1))
+	for i := 0; i < 20; i++ {
+		for _, item := range catalog.Roll(rng, "rare", 3) {
+			if item.Type == ItemPotion {
+				assert.Empty(t, item.Affixes, "Only weapons and armor roll affixes")
+				assert.Equal(t, "Health Potion", item.Name)
+				continue
+			}
+
+			// A prefix and a suffix, scaled by depth and rarity; Vampiric is too deep to roll
+			require.Len(t, item.Affixes, 2)
+			assert.Equal(t, Affix{Name: "Flaming", Kind: AffixPrefix, Effect: EffectFire, Value: 8}, item.Affixes[0])
+			assert.Equal(t, Affix{Name: "of the Bear", Kind: AffixSuffix, Effect: EffectStrength, Value: 2}, item.Affixes[1])
+			assert.Equal(t, "Flaming Sword of the Bear", item.Name)
+			assert.Equal(t, "Sword", item.BaseName)
+		}
+	}
+
+	// Uncommon items roll a single prefix or suffix
+	for i := 0; i < 20; i++ {
+		items := catalog.Roll(rng, "uncommon", 1)
+		require.Len(t, items, 1)
+		require.Len(t, items[0].Affixes, 1)
+		assert.Contains(t, []string{"Flaming Sword", "Sword of the Bear"}, items[0].Name)
+	}
+
+	// Common items are plain
+	items := catalog.Roll(rng, "common", 1)
+	require.Len(t, items, 1)
+	assert.Empty(t, items[0].Affixes)
+	assert.Equal(t, "Sword", items[0].Name)
+}
+
+func TestDefaultLootAffixes(t *testing.T) {
+	catalog := DefaultLootCatalog()
+	rng := rand.New(rand.NewSource(3))
+
+	for i := 0; i < 50; i++ {
+		for _, item := range catalog.Roll(rng, "gear", 10) {
+			assert.Len(t, item.Affixes, catalog.Rarities[item.Rarity].Affixes)
+			assert.True(t, strings.Contains(item.Name, item.BaseName))
+			for _, affix := range item.Affixes {
+				assert.Positive(t, affix.Value)
+			}
+		}
+	}
+}
+
+func TestAffixValidation(t *testing.T) {
+	_, err := ParseLootCatalog([]byte(strings.Replace(testAffixLootJSON, `"affixes": [`, `"affixes": [
+	  {"name": "Odd", "kind": "infix", "effect": "luck", "min": 3, "max": 1, "types": ["potion"], "weight": 0},
+	  {"name": "Flaming", "kind": "prefix", "effect": "fire", "min": 1, "max": 1, "types": ["weapon"], "weight": 1},`, 1)))
+	require.Error(t, err)
+	for _, problem := range []string{
+		`kind "infix" must be prefix or suffix`,
+		`effect "luck" is unknown`,
+		"min must be positive and no more than max",
+		"weight must be positive",
+		`type "potion" can't have affixes`,
+		`affix "Flaming" is defined more than once`,
+	} {
+		assert.Contains(t, err.Error(), problem)
+	}
+
+	_, err = ParseLootCatalog([]byte(strings.Replace(testAffixLootJSON, `"affixes": 2}`, `"affixes": 3}`, 1)))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "affixes must be between 0 and 2")
+}
+
+func TestItemName(t *testing.T) {
+	assert.Equal(t, "Sword", ItemName("Sword", nil))
+	assert.Equal(t, "Flaming Sword of the Bear", ItemName("Sword", []Affix{
+		{Name: "of the Bear", Kind: AffixSuffix},
+		{Name: "Flaming", Kind: AffixPrefix},
+	}))
+}
+
+func TestAffixBonus(t *testing.T) {
+	item := NewWeapon("Sword", 5, 10, 1, nil)
+	item.Affixes = []Affix{
+		{Name: "Flaming", Kind: AffixPrefix, Effect: EffectFire, Value: 3},
+		{Name: "of the Bear", Kind: AffixSuffix, Effect: EffectStrength, Value: 2},
+	}
+
+	assert.Equal(t, 3, item.AffixBonus(EffectFire))
+	assert.Equal(t, 2, item.AffixBonus(EffectStrength))
+	assert.Equal(t, 0, item.AffixBonus(EffectCold))
+}
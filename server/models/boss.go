@@ -0,0 +1,154 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// BossSpecial is an attack a boss telegraphs on one turn and unleashes on its next,
+// hitting everyone still within its radius
+type BossSpecial struct {
+	Name      string        `json:"name"`
+	Telegraph string        `json:"telegraph"`        // What the boss is seen doing while it winds up
+	Damage    int           `json:"damage"`           // Damage on the first floor; scales with depth like mob stats
+	Radius    int           `json:"radius"`           // Characters within this many tiles of the boss are hit
+	Cooldown  int           `json:"cooldown"`         // Turns before the boss can wind up another special attack
+	Effect    *StatusEffect `json:"effect,omitempty"` // Status effect put on everyone hit
+}
+
+// BossPhase is a stage of a boss fight, starting once the boss is at or below a share of its HP
+type BossPhase struct {
+	Name        string       `json:"name"`
+	HPPercent   int          `json:"hpPercent"`             // The phase starts at or below this percent of the boss's max HP
+	Message     string       `json:"message,omitempty"`     // What the boss does as the phase starts
+	DamageBonus int          `json:"damageBonus,omitempty"` // Percent added to the boss's damage as the phase starts
+	Special     *BossSpecial `json:"special,omitempty"`     // Special attack the boss uses during the phase
+	Summon      MobType      `json:"summon,omitempty"`      // Minions called as the phase starts
+	SummonCount int          `json:"summonCount,omitempty"`
+}
+
+// BossDefinition describes how a monster fights when it spawns as a boss
+type BossDefinition struct {
+	Phases      []BossPhase `json:"phases"`                // In order, the first starting at 100 percent
+	EnrageTurns int         `json:"enrageTurns,omitempty"` // Turns of fighting before the boss enrages; 0 means never
+	EnrageBonus int         `json:"enrageBonus,omitempty"` // Percent added to the boss's damage when it enrages
+}
+
+// BossState is how far a boss has got through its fight
+type BossState struct {
+	Phase    int    `json:"phase"`              // Index of the phase the boss is in
+	Turns    int    `json:"turns"`              // Turns the boss has spent fighting
+	Enraged  bool   `json:"enraged,omitempty"`  // The boss has fought too long and hits harder
+	Charging string `json:"charging,omitempty"` // Special attack being telegraphed; it lands on the boss's next turn
+	Cooldown int    `json:"cooldown,omitempty"` // Turns until the boss can wind up another special attack
+}
+
+// BossKill records a boss being slain in a dungeon
+type BossKill struct {
+	MobType       MobType   `json:"mobType"`
+	Name          string    `json:"name"`
+	Floor         int       `json:"floor"`
+	CharacterID   string    `json:"characterId"`
+	CharacterName string    `json:"characterName"`
+	KilledAt      time.Time `json:"killedAt"`
+}
+
+// fallbackBoss is how monsters without a boss definition fight as bosses
+var fallbackBoss = BossDefinition{
+	Phases: []BossPhase{
+		{Name: "Wrath", HPPercent: 100},
+		{
+			Name:        "Frenzy",
+			HPPercent:   50,
+			Message:     "flies into a frenzy",
+			DamageBonus: 25,
+			Special:     &BossSpecial{Name: "Crushing Blow", Telegraph: "rears back for a crushing blow", Damage: 8, Radius: 1, Cooldown: 3},
+		},
+	},
+	EnrageTurns: 30,
+	EnrageBonus: 50,
+}
+
+// PhaseAt returns the index of the phase a boss with the given HP is in
+func (d *BossDefinition) PhaseAt(hp, maxHP int) int {
+	phase := 0
+	for i, candidate := range d.Phases {
+		if hp*100 <= candidate.HPPercent*maxHP {
+			phase = i
+		}
+	}
+	return phase
+}
+
+// Special returns the special attack with the given name from any of the phases
+func (d *BossDefinition) Special(name string) (*BossSpecial, bool) {
+	for _, phase := range d.Phases {
+		if phase.Special != nil && phase.Special.Name == name {
+			return phase.Special, true
+		}
+	}
+	return nil, false
+}
+
+// DamageAt returns the special attack's damage on a floor
+func (s *BossSpecial) DamageAt(floorLevel int) int {
+	return int(float64(s.Damage) * floorMultiplier(floorLevel))
+}
+
+// validate checks a boss definition given in a data file
+func (d *BossDefinition) validate() error {
+	var errs []error
+
+	if len(d.Phases) == 0 {
+		errs = append(errs, errors.New("boss needs at least one phase"))
+	} else if d.Phases[0].HPPercent != 100 {
+		errs = append(errs, errors.New("boss's first phase must start at 100 percent"))
+	}
+	specials := make(map[string]bool)
+	for i, phase := range d.Phases {
+		if phase.Name == "" {
+			errs = append(errs, fmt.Errorf("boss phase %d: name is required", i))
+		}
+		if i > 0 && (phase.HPPercent <= 0 || phase.HPPercent >= d.Phases[i-1].HPPercent) {
+			errs = append(errs, fmt.Errorf("boss phase %q: hpPercent must be positive and below the phase before it", phase.Name))
+		}
+		if phase.DamageBonus < 0 || phase.SummonCount < 0 {
+			errs = append(errs, fmt.Errorf("boss phase %q: damageBonus and summonCount can't be negative", phase.Name))
+		}
+		if (phase.Summon == "") != (phase.SummonCount == 0) {
+			errs = append(errs, fmt.Errorf("boss phase %q: summon and summonCount go together", phase.Name))
+		}
+		if phase.Special != nil {
+			if err := phase.Special.validate(); err != nil {
+				errs = append(errs, fmt.Errorf("boss phase %q: %w", phase.Name, err))
+			}
+			if specials[phase.Special.Name] {
+				errs = append(errs, fmt.Errorf("boss phase %q: special attack %q is used by another phase", phase.Name, phase.Special.Name))
+			}
+			specials[phase.Special.Name] = true
+		}
+	}
+	if d.EnrageTurns < 0 || d.EnrageBonus < 0 {
+		errs = append(errs, errors.New("boss enrageTurns and enrageBonus can't be negative"))
+	}
+
+	return errors.Join(errs...)
+}
+
+// validate checks a special attack given in a data file
+func (s *BossSpecial) validate() error {
+	var errs []error
+	if s.Name == "" || s.Telegraph == "" {
+		errs = append(errs, errors.New("special attacks need a name and a telegraph"))
+	}
+	if s.Damage < 0 || s.Radius < 0 || s.Cooldown < 0 {
+		errs = append(errs, fmt.Errorf("special attack %q: damage, radius and cooldown can't be negative", s.Name))
+	}
+	if s.Effect != nil {
+		if err := s.Effect.validate(); err != nil {
+			errs = append(errs, fmt.Errorf("special attack %q: %w", s.Name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,77 @@
+package models
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBossDefinitionPhaseAt(t *testing.T) {
+	boss := Monsters().Boss(MobDragon)
+	require.Len(t, boss.Phases, 3)
+
+	assert.Equal(t, 0, boss.PhaseAt(100, 100))
+	assert.Equal(t, 0, boss.PhaseAt(51, 100))
+	assert.Equal(t, 1, boss.PhaseAt(50, 100), "A phase starts once the boss reaches its threshold")
+	assert.Equal(t, 2, boss.PhaseAt(1, 100))
+	assert.Equal(t, 2, boss.PhaseAt(0, 100))
+
+	special, exists := boss.Special("Inferno")
+	require.True(t, exists)
+	assert.Equal(t, 16, special.DamageAt(1))
+	assert.Equal(t, 32, special.DamageAt(6), "Special attacks scale with depth like mob stats")
+	_, exists = boss.Special("Tail Swipe")
+	assert.False(t, exists)
+}
+
+func TestMonsterCatalogBoss(t *testing.T) {
+	catalog := DefaultMonsterCatalog()
+
+	// The bosses the map generator spawns have their own fights
+	for _, mobType := range []MobType{MobOgre, MobDragon} {
+		definition, exists := catalog.Definition(mobType)
+		require.True(t, exists)
+		assert.NotNil(t, definition.Boss, "%s should have a boss fight", mobType)
+		assert.Same(t, definition.Boss, catalog.Boss(mobType))
+	}
+
+	// Everything else falls back to a generic fight
+	assert.Same(t, &fallbackBoss, catalog.Boss(MobGoblin))
+	assert.NoError(t, fallbackBoss.validate())
+
+	// Only bosses track their fight
+	assert.NotNil(t, catalog.NewMob(MobGoblin, VariantBoss, 1).Boss)
+	assert.Nil(t, catalog.NewMob(MobGoblin, VariantHard, 1).Boss)
+}
+
+func TestParseMonsterCatalogBossValidation(t *testing.T) {
+	_, err := ParseMonsterCatalog([]byte(`{
+	  "variants": {"easy": {"stats": 1}, "normal": {"stats": 1}, "hard": {"stats": 1}, "boss": {"stats": 1}},
+	  "monsters": [
+	    {"type": "goblin", "symbol": "g", "color": "#00FF00", "hp": 5, "ac": 10, "dexterity": 10, "boss": {
+	      "enrageTurns": -1,
+	      "phases": [
+	        {"name": "Opening", "hpPercent": 90, "special": {"name": "Slam", "telegraph": "winds up", "damage": 5, "radius": 1}},
+	        {"name": "Late", "hpPercent": 95, "summon": "dragon", "summonCount": 2},
+	        {"name": "", "hpPercent": 10, "summonCount": 1, "special": {"name": "Slam", "damage": -1, "effect": {"type": "frozen", "duration": 1}}}
+	      ]
+	    }}
+	  ]
+	}`))
+	require.Error(t, err)
+	for _, problem := range []string{
+		"first phase must start at 100 percent",
+		`boss phase "Late": hpPercent must be positive and below the phase before it`,
+		"boss phase 2: name is required",
+		"summon and summonCount go together",
+		"special attacks need a name and a telegraph",
+		`special attack "Slam": damage, radius and cooldown can't be negative`,
+		`status "frozen" is unknown`,
+		`special attack "Slam" is used by another phase`,
+		"enrageTurns and enrageBonus can't be negative",
+		`summons undefined monster "dragon"`,
+	} {
+		assert.Contains(t, err.Error(), problem)
+	}
+}
@@ -35,6 +35,7 @@ type Attributes struct {
 // Character represents a player character
 type Character struct {
 	ID             string         `json:"id"`
+	OwnerID        string         `json:"ownerId,omitempty"`
 	Name           string         `json:"name"`
 	Class          CharacterClass `json:"class"`
 	Level          int            `json:"level"`
@@ -51,6 +52,15 @@ type Character struct {
 	Position       Position       `json:"position"`
 	Inventory      []*Item        `json:"inventory"`
 	Equipment      Equipment      `json:"equipment"`
+
+	// Exploration holds the tiles seen on each floor, keyed by ExplorationKey
+	Exploration map[string]*ExploredSet `json:"exploration,omitempty"`
+
+	Deaths    int          `json:"deaths"`
+	LastDeath *DeathRecord `json:"lastDeath,omitempty"`
+
+	StatusEffects StatusEffects     `json:"statusEffects,omitempty"`
+	Cooldowns     map[AbilityID]int `json:"cooldowns,omitempty"` // Turns left before each ability can be used again
 }
 
 // Position represents a character's position on the map
@@ -338,6 +348,16 @@ func (c *Character) GetInventoryItem(itemID string) (*Item, bool) {
 	return nil, false
 }
 
+// FindKey finds the key in the inventory that opens the door or chest with the given ID
+func (c *Character) FindKey(lockID string) (*Item, bool) {
+	for _, item := range c.Inventory {
+		if item.Type == ItemKey && item.LockID == lockID {
+			return item, true
+		}
+	}
+	return nil, false
+}
+
 // EquipItem equips an item from the inventory
 // Returns true if successful, false otherwise
 func (c *Character) EquipItem(itemID string) bool {
@@ -429,6 +449,7 @@ func (c *Character) UseItem(itemID string) bool {
 		if c.CurrentHP > c.MaxHP {
 			c.CurrentHP = c.MaxHP
 		}
+		c.applyItemEffect(item)
 		// Remove the potion from inventory after use
 		c.RemoveFromInventory(itemID)
 		return true
@@ -438,6 +459,7 @@ func (c *Character) UseItem(itemID string) bool {
 		if c.CurrentMana > c.MaxMana {
 			c.CurrentMana = c.MaxMana
 		}
+		c.applyItemEffect(item)
 		// Remove the scroll from inventory after use
 		c.RemoveFromInventory(itemID)
 		return true
@@ -447,16 +469,73 @@ func (c *Character) UseItem(itemID string) bool {
 	}
 }
 
+// applyItemEffect applies the status effect of a used item to the character
+func (c *Character) applyItemEffect(item *Item) {
+	if item.Effect != nil {
+		effect := *item.Effect
+		effect.Source = item.Name
+		c.StatusEffects.Apply(effect)
+	}
+}
+
+// EquipmentBonus returns the total value of an affix effect across the equipped items
+func (c *Character) EquipmentBonus(effect AffixEffect) int {
+	bonus := 0
+	for _, item := range []*Item{c.Equipment.Weapon, c.Equipment.Armor, c.Equipment.Accessory} {
+		if item != nil {
+			bonus += item.AffixBonus(effect)
+		}
+	}
+	return bonus
+}
+
+// EffectiveAttributes returns the character's attributes including equipment bonuses
+func (c *Character) EffectiveAttributes() Attributes {
+	attributes := c.Attributes
+	attributes.Strength += c.EquipmentBonus(EffectStrength)
+	attributes.Dexterity += c.EquipmentBonus(EffectDexterity)
+	attributes.Constitution += c.EquipmentBonus(EffectConstitution)
+	attributes.Intelligence += c.EquipmentBonus(EffectIntelligence)
+	attributes.Wisdom += c.EquipmentBonus(EffectWisdom)
+	attributes.Charisma += c.EquipmentBonus(EffectCharisma)
+	return attributes
+}
+
 // CalculateAttackPower calculates the character's attack power based on attributes and equipment
 func (c *Character) CalculateAttackPower() int {
-	basePower := GetModifier(c.Attributes.Strength) + c.Level
+	basePower := GetModifier(c.EffectiveAttributes().Strength) + c.Level
 
 	// Add weapon power if equipped
 	if c.Equipment.Weapon != nil {
 		basePower += c.Equipment.Weapon.Power
 	}
 
-	return basePower
+	return basePower + c.EquipmentBonus(EffectDamage) + c.StatusEffects.Modifiers().Damage
+}
+
+// CalculateCritChance calculates the chance an attack is a critical hit
+func (c *Character) CalculateCritChance() float64 {
+	return float64(c.CalculateCritPercent()) / 100
+}
+
+// CalculateCritPercent calculates the percent chance an attack is a critical hit
+func (c *Character) CalculateCritPercent() int {
+	// Everyone crits 5% of the time; affixes add to it, up to 50%
+	return 5 + min(c.EquipmentBonus(EffectCrit), 45)
+}
+
+// CalculateElementalDamage calculates the elemental damage the character's attacks add
+func (c *Character) CalculateElementalDamage() int {
+	damage := 0
+	for _, effect := range ElementalEffects {
+		damage += c.EquipmentBonus(effect)
+	}
+	return damage
+}
+
+// CalculateLifesteal calculates the percent of damage dealt the character heals
+func (c *Character) CalculateLifesteal() int {
+	return min(c.EquipmentBonus(EffectLifesteal), 100)
 }
 
 // CalculateDefensePower calculates the character's defense power based on attributes and equipment
@@ -471,13 +550,13 @@ func (c *Character) CalculateDefensePower() int {
 	return basePower
 }
 
-// CalculateBaseAC calculates the base armor class without equipment
+// CalculateBaseAC calculates the base armor class without armor
 func (c *Character) CalculateBaseAC() int {
 	// Base AC is 10
 	baseAC := 10
 
-	// Add dexterity modifier
-	dexModifier := GetModifier(c.Attributes.Dexterity)
+	// Add dexterity modifier, including dexterity from equipment
+	dexModifier := GetModifier(c.EffectiveAttributes().Dexterity)
 
 	return baseAC + dexModifier
 }
@@ -507,12 +586,16 @@ func (c *Character) CalculateTotalAC() int {
 	// Add armor AC
 	totalAC += c.CalculateArmorAC()
 
+	// Add armor affixes and status effects
+	totalAC += c.EquipmentBonus(EffectArmor) + c.StatusEffects.Modifiers().AC
+
 	// Apply class-specific bonuses
+	attributes := c.EffectiveAttributes()
 	switch c.Class {
 	case Monk:
 		// Monks get additional AC from wisdom when unarmored
 		if c.Equipment.Armor == nil {
-			wisModifier := GetModifier(c.Attributes.Wisdom)
+			wisModifier := GetModifier(attributes.Wisdom)
 			if wisModifier > 0 {
 				totalAC += wisModifier
 			}
@@ -520,7 +603,7 @@ func (c *Character) CalculateTotalAC() int {
 	case Barbarian:
 		// Barbarians get additional AC from constitution when unarmored
 		if c.Equipment.Armor == nil {
-			conModifier := GetModifier(c.Attributes.Constitution)
+			conModifier := GetModifier(attributes.Constitution)
 			if conModifier > 0 {
 				totalAC += conModifier
 			}
@@ -536,8 +619,9 @@ func (c *Character) CalculateHitChance(targetAC int) float64 {
 	baseHitChance := 0.5
 
 	// Calculate attack bonus based on strength or dexterity (whichever is higher)
-	strModifier := GetModifier(c.Attributes.Strength)
-	dexModifier := GetModifier(c.Attributes.Dexterity)
+	attributes := c.EffectiveAttributes()
+	strModifier := GetModifier(attributes.Strength)
+	dexModifier := GetModifier(attributes.Dexterity)
 	attackBonus := strModifier
 	if dexModifier > strModifier {
 		attackBonus = dexModifier
@@ -552,6 +636,9 @@ func (c *Character) CalculateHitChance(targetAC int) float64 {
 		attackBonus += c.Equipment.Weapon.Power / 5
 	}
 
+	// Add accuracy from affixes and status effects
+	attackBonus += c.EquipmentBonus(EffectAccuracy) + c.StatusEffects.Modifiers().Accuracy
+
 	// Calculate hit chance: base + (attack bonus - (targetAC - 10)) * 0.05
 	// This means each point of difference changes hit chance by 5%
 	// We subtract 10 from targetAC because 10 is the base AC
@@ -575,6 +662,14 @@ func (c *Character) PerformSkillCheck(skillType SkillType, difficultyClass int)
 	return c.Skills.PerformSkillCheck(skillType, c.Attributes, difficultyClass)
 }
 
+// PassiveScore returns the character's passive score for a skill
+func (c *Character) PassiveScore(skillType SkillType) int {
+	if c.Skills == nil {
+		return 0
+	}
+	return c.Skills.PassiveScore(skillType, c.Attributes)
+}
+
 // AddSkillExperience adds experience to a skill and returns true if the skill leveled up
 func (c *Character) AddSkillExperience(skillType SkillType, exp int) bool {
 	if c.Skills == nil {
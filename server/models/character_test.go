@@ -4,6 +4,7 @@ import (
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestNewCharacter(t *testing.T) {
@@ -1062,3 +1063,52 @@ func TestAddExperienceManaIncrease(t *testing.T) {
 		})
 	}
 }
+
+func TestEquipmentAffixes(t *testing.T) {
+	character := NewCharacter("TestChar", Warrior)
+	character.Attributes.Strength = 10
+	character.Attributes.Dexterity = 10
+
+	sword := NewWeapon("Sword", 4, 10, 1, nil)
+	sword.Affixes = []Affix{
+		{Name: "Flaming", Kind: AffixPrefix, Effect: EffectFire, Value: 3},
+		{Name: "of the Bear", Kind: AffixSuffix, Effect: EffectStrength, Value: 4},
+	}
+	armor := NewArmor("Leather Armor", 2, 10, 1, nil)
+	armor.Affixes = []Affix{
+		{Name: "Sturdy", Kind: AffixPrefix, Effect: EffectArmor, Value: 2},
+		{Name: "of the Fox", Kind: AffixSuffix, Effect: EffectDexterity, Value: 4},
+	}
+
+	baseAttack := character.CalculateAttackPower()
+	baseAC := character.CalculateTotalAC()
+	baseHit := character.CalculateHitChance(10)
+
+	require.True(t, character.AddToInventory(sword))
+	require.True(t, character.AddToInventory(armor))
+	require.True(t, character.EquipItem(sword.ID))
+	require.True(t, character.EquipItem(armor.ID))
+
+	attributes := character.EffectiveAttributes()
+	assert.Equal(t, 14, attributes.Strength)
+	assert.Equal(t, 14, attributes.Dexterity)
+	assert.Equal(t, 10, character.Attributes.Strength, "Base attributes should not change")
+
+	// +4 weapon power and +2 from the strength modifier
+	assert.Equal(t, baseAttack+6, character.CalculateAttackPower())
+	// +2 armor, +2 from the affix and +2 from the dexterity modifier
+	assert.Equal(t, baseAC+6, character.CalculateTotalAC())
+	assert.Greater(t, character.CalculateHitChance(10), baseHit)
+	assert.Equal(t, 3, character.CalculateElementalDamage())
+
+	assert.InDelta(t, 0.05, character.CalculateCritChance(), 1e-9)
+	sword.Affixes = append(sword.Affixes, Affix{Effect: EffectCrit, Value: 10}, Affix{Effect: EffectLifesteal, Value: 20})
+	assert.InDelta(t, 0.15, character.CalculateCritChance(), 1e-9)
+	assert.Equal(t, 15, character.CalculateCritPercent())
+	sword.Affixes[len(sword.Affixes)-2].Value = 24
+	assert.Equal(t, 29, character.CalculateCritPercent(), "Percents shouldn't be lost to rounding")
+	sword.Affixes[len(sword.Affixes)-2].Value = 60
+	assert.Equal(t, 50, character.CalculateCritPercent())
+	assert.InDelta(t, 0.5, character.CalculateCritChance(), 1e-9)
+	assert.Equal(t, 20, character.CalculateLifesteal())
+}
@@ -0,0 +1,65 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// DeathRecord describes how and where a character died
+type DeathRecord struct {
+	Cause     string    `json:"cause"`
+	DungeonID string    `json:"dungeonId,omitempty"`
+	Floor     int       `json:"floor"`
+	Position  Position  `json:"position"`
+	Time      time.Time `json:"time"`
+}
+
+// Corpse marks where a character died and holds what they dropped
+type Corpse struct {
+	ID            string    `json:"id"`
+	CharacterID   string    `json:"characterId"`
+	CharacterName string    `json:"characterName"`
+	Cause         string    `json:"cause"`
+	Position      Position  `json:"position"`
+	Items         []Item    `json:"items"`
+	Gold          int       `json:"gold"`
+	CreatedAt     time.Time `json:"createdAt"`
+}
+
+// NewCorpse creates an empty corpse at the character's position
+func NewCorpse(character *Character, cause string) *Corpse {
+	return &Corpse{
+		ID:            uuid.New().String(),
+		CharacterID:   character.ID,
+		CharacterName: character.Name,
+		Cause:         cause,
+		Position:      character.Position,
+		Items:         make([]Item, 0),
+		CreatedAt:     time.Now(),
+	}
+}
+
+// IsEmpty checks if the corpse has nothing left to loot
+func (c *Corpse) IsEmpty() bool {
+	return len(c.Items) == 0 && c.Gold == 0
+}
+
+// IsDead checks if the character has run out of HP
+func (c *Character) IsDead() bool {
+	return c.CurrentHP <= 0
+}
+
+// RecordDeath adds a death to the character's statistics
+func (c *Character) RecordDeath(record DeathRecord) {
+	c.Deaths++
+	c.LastDeath = &record
+}
+
+// CurrentLevelExperience returns the experience earned since reaching the current level
+func (c *Character) CurrentLevelExperience() int {
+	if c.Level <= 1 {
+		return c.Experience
+	}
+	return max(c.Experience-CalculateExperienceForNextLevel(c.Level-1), 0)
+}
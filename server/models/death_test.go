@@ -0,0 +1,47 @@
+package models
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCorpseIsEmpty(t *testing.T) {
+	character := NewCharacter("Fallen", Warrior)
+	character.Position = Position{X: 3, Y: 4}
+
+	corpse := NewCorpse(character, "slain by Goblin")
+	assert.Equal(t, character.ID, corpse.CharacterID)
+	assert.Equal(t, Position{X: 3, Y: 4}, corpse.Position)
+	assert.True(t, corpse.IsEmpty())
+
+	corpse.Gold = 5
+	assert.False(t, corpse.IsEmpty())
+	corpse.Gold = 0
+	corpse.Items = append(corpse.Items, *NewPotion("Health Potion", 20, 5))
+	assert.False(t, corpse.IsEmpty())
+}
+
+func TestRecordDeath(t *testing.T) {
+	character := NewCharacter("Fallen", Warrior)
+	assert.False(t, character.IsDead())
+
+	character.CurrentHP = 0
+	assert.True(t, character.IsDead())
+
+	character.RecordDeath(DeathRecord{Cause: "slain by Goblin", Floor: 2})
+	character.RecordDeath(DeathRecord{Cause: "slain by Orc", Floor: 3})
+	assert.Equal(t, 2, character.Deaths)
+	assert.Equal(t, "slain by Orc", character.LastDeath.Cause)
+	assert.Equal(t, 3, character.LastDeath.Floor)
+}
+
+func TestCurrentLevelExperience(t *testing.T) {
+	character := NewCharacter("Learner", Warrior)
+	character.Experience = 400
+	assert.Equal(t, 400, character.CurrentLevelExperience())
+
+	character.Level = 3
+	character.Experience = 2500
+	assert.Equal(t, 500, character.CurrentLevelExperience(), "Only experience past level 3 should count")
+}
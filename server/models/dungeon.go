@@ -18,6 +18,8 @@ const (
 	TileDoor       TileType = "+"
 	TileChest      TileType = "C"
 	TileTrap       TileType = "^"
+	TileLever      TileType = "/"
+	TilePlate      TileType = "_"
 )
 
 // RoomType represents the type of room
@@ -49,23 +51,44 @@ type Tile struct {
 	Type      TileType `json:"type"`
 	Walkable  bool     `json:"walkable"`
 	Explored  bool     `json:"explored"`
+	Visible   bool     `json:"visible,omitempty"` // Set in per-character floor views for tiles currently in sight
 	RoomID    string   `json:"roomId,omitempty"`
 	MobID     string   `json:"mobId,omitempty"`
 	ItemID    string   `json:"itemId,omitempty"`
 	Character string   `json:"character,omitempty"` // Character ID if a player is on this tile
+	CorpseID  string   `json:"corpseId,omitempty"`
+	TrapID    string   `json:"trapId,omitempty"` // Hidden from players until the trap is revealed
+	DoorID    string   `json:"doorId,omitempty"`
+	ChestID   string   `json:"chestId,omitempty"`
+	PuzzleID  string   `json:"puzzleId,omitempty"` // Puzzle a lever or pressure plate belongs to
 }
 
 // Floor represents a single floor of the dungeon
 type Floor struct {
-	Level      int             `json:"level"`
-	Width      int             `json:"width"`
-	Height     int             `json:"height"`
-	Tiles      [][]Tile        `json:"tiles"`
-	Rooms      []Room          `json:"rooms"`
-	UpStairs   []Position      `json:"upStairs"`
-	DownStairs []Position      `json:"downStairs"`
-	Mobs       map[string]*Mob `json:"mobs"`
-	Items      map[string]Item `json:"items"`
+	Level      int                `json:"level"`
+	Width      int                `json:"width"`
+	Height     int                `json:"height"`
+	Tiles      [][]Tile           `json:"tiles"`
+	Rooms      []Room             `json:"rooms"`
+	UpStairs   []Position         `json:"upStairs"`
+	DownStairs []Position         `json:"downStairs"`
+	Mobs       map[string]*Mob    `json:"mobs"`
+	Items      map[string]Item    `json:"items"`
+	Corpses    map[string]*Corpse `json:"corpses,omitempty"`
+	Shops      map[string]*Shop   `json:"shops,omitempty"` // Stock of each shop room, keyed by room ID
+	Traps      map[string]*Trap   `json:"traps,omitempty"`
+	Doors      map[string]*Door   `json:"doors,omitempty"`
+	Chests     map[string]*Chest  `json:"chests,omitempty"`
+	Puzzles    map[string]*Puzzle `json:"puzzles,omitempty"`
+	Theme      Theme              `json:"theme,omitempty"`
+	Palette    Palette            `json:"palette,omitempty"` // How the floor's theme draws its tiles
+	Retries    int                `json:"retries,omitempty"` // Attempts at generating the floor thrown away for failing validation
+	Version    uint64             `json:"version"`           // Bumped each time a batch of changes is committed
+
+	pending     *FloorChange  // Changes marked since the last commit
+	journal     []FloorChange // Recently committed changes, oldest first
+	tileChanges uint64        // Times tiles were marked as changed
+	marked      []markedTiles // Tiles recently marked as changed, oldest first
 }
 
 // Dungeon represents a complete dungeon
@@ -74,11 +97,14 @@ type Dungeon struct {
 	Name        string            `json:"name"`
 	Floors      int               `json:"floors"`
 	Difficulty  string            `json:"difficulty"`
+	Theme       Theme             `json:"theme"`
+	Layouts     map[int]Layout    `json:"layouts,omitempty"` // Layouts of particular floors, in place of the theme's
 	CreatedAt   time.Time         `json:"createdAt"`
-	FloorData   map[int]*Floor    `json:"floorData"`
+	FloorData   map[int]*Floor    `json:"-"`          // Generated floors, kept out of JSON so clients only see what fog of war shows them
 	Characters  map[string]string `json:"characters"` // Map of character ID to floor level
 	Seed        int64             `json:"seed"`
 	PlayerCount int               `json:"playerCount"`
+	BossKills   []BossKill        `json:"bossKills,omitempty"` // Bosses slain in the dungeon, oldest first
 }
 
 // NewDungeon creates a new dungeon with the specified number of floors
@@ -92,6 +118,7 @@ func NewDungeon(name string, floors int, seed int64) *Dungeon {
 		Name:       name,
 		Floors:     floors,
 		Difficulty: "normal", // Default difficulty
+		Theme:      ThemeClassic,
 		CreatedAt:  time.Now(),
 		FloorData:  make(map[int]*Floor),
 		Characters: make(map[string]string),
@@ -99,6 +126,23 @@ func NewDungeon(name string, floors int, seed int64) *Dungeon {
 	}
 }
 
+// FloorSeed derives the seed used to generate one floor of the dungeon. Every floor
+// gets its own stream so a floor generates the same way no matter which floors were
+// generated before it.
+func (d *Dungeon) FloorSeed(level int) int64 {
+	return DeriveSeed(d.Seed, level)
+}
+
+// DeriveSeed derives an independent seed from a seed and a number, such as a
+// floor level or a retry
+func DeriveSeed(seed int64, n int) int64 {
+	// splitmix64 finalizer over the seed and number
+	z := uint64(seed) + uint64(n)*0x9e3779b97f4a7c15
+	z = (z ^ (z >> 30)) * 0xbf58476d1ce4e5b9
+	z = (z ^ (z >> 27)) * 0x94d049bb133111eb
+	return int64(z ^ (z >> 31))
+}
+
 // GenerateFloor generates a new floor for the dungeon
 func (d *Dungeon) GenerateFloor(level int) *Floor {
 	// Floor dimensions based on level (deeper floors can be larger)
@@ -176,3 +220,17 @@ func (d *Dungeon) GetCharacterFloor(characterID string) int {
 func (d *Dungeon) SetCharacterFloor(characterID string, floor int) {
 	d.Characters[characterID] = fmt.Sprintf("%d", floor)
 }
+
+// RecordBossKill records a character slaying a boss on one of the dungeon's floors
+func (d *Dungeon) RecordBossKill(mob *Mob, floor int, character *Character) BossKill {
+	kill := BossKill{
+		MobType:       mob.Type,
+		Name:          mob.Name,
+		Floor:         floor,
+		CharacterID:   character.ID,
+		CharacterName: character.Name,
+		KilledAt:      time.Now(),
+	}
+	d.BossKills = append(d.BossKills, kill)
+	return kill
+}
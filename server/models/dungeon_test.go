@@ -166,3 +166,28 @@ func TestCharacterManagement(t *testing.T) {
 	assert.Equal(t, 0, dungeon.PlayerCount, "Player count should be 0 after removing all characters")
 	assert.Empty(t, dungeon.Characters, "Characters map should be empty")
 }
+
+func TestDungeonFloorSeed(t *testing.T) {
+	dungeon := NewDungeon("Seeded", 5, 12345)
+	same := NewDungeon("Other", 5, 12345)
+
+	assert.Equal(t, dungeon.FloorSeed(1), same.FloorSeed(1), "The same seed should give the same floor seeds")
+	assert.NotEqual(t, dungeon.FloorSeed(1), dungeon.FloorSeed(2), "Each floor should get its own seed")
+	assert.NotEqual(t, dungeon.FloorSeed(1), NewDungeon("Seeded", 5, 12346).FloorSeed(1),
+		"Different dungeon seeds should give different floor seeds")
+}
+
+func TestRecordBossKill(t *testing.T) {
+	dungeon := NewDungeon("Lair", 10, 1)
+	boss := NewMob(MobDragon, VariantBoss, 10)
+	character := NewCharacter("Slayer", Warrior)
+
+	kill := dungeon.RecordBossKill(boss, 10, character)
+	assert.Equal(t, MobDragon, kill.MobType)
+	assert.Equal(t, boss.Name, kill.Name)
+	assert.Equal(t, 10, kill.Floor)
+	assert.Equal(t, character.ID, kill.CharacterID)
+	assert.Equal(t, "Slayer", kill.CharacterName)
+	assert.False(t, kill.KilledAt.IsZero())
+	assert.Equal(t, []BossKill{kill}, dungeon.BossKills)
+}
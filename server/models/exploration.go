@@ -0,0 +1,110 @@
+package models
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"strconv"
+)
+
+// ExploredSet records which tiles of a floor a character has seen.
+// It is stored as a bitset so a fully explored 100x100 floor costs ~1.7KB of JSON.
+type ExploredSet struct {
+	Width  int
+	Height int
+	bits   []byte
+}
+
+// NewExploredSet creates an empty explored set for a floor of the given size
+func NewExploredSet(width, height int) *ExploredSet {
+	return &ExploredSet{
+		Width:  width,
+		Height: height,
+		bits:   make([]byte, (width*height+7)/8),
+	}
+}
+
+// Has reports whether a tile has been explored
+func (e *ExploredSet) Has(x, y int) bool {
+	index, ok := e.index(x, y)
+	return ok && e.bits[index/8]&(1<<(index%8)) != 0
+}
+
+// Add marks a tile as explored
+func (e *ExploredSet) Add(x, y int) {
+	if index, ok := e.index(x, y); ok {
+		e.bits[index/8] |= 1 << (index % 8)
+	}
+}
+
+// Count returns the number of explored tiles
+func (e *ExploredSet) Count() int {
+	count := 0
+	for _, b := range e.bits {
+		for ; b != 0; b &= b - 1 {
+			count++
+		}
+	}
+	return count
+}
+
+// index returns the bit index of a tile
+func (e *ExploredSet) index(x, y int) (int, bool) {
+	if x < 0 || x >= e.Width || y < 0 || y >= e.Height {
+		return 0, false
+	}
+	return y*e.Width + x, true
+}
+
+// exploredSetJSON is the wire format of an explored set
+type exploredSetJSON struct {
+	Width  int    `json:"width"`
+	Height int    `json:"height"`
+	Bits   string `json:"bits"`
+}
+
+// MarshalJSON encodes the explored set with its bits as base64
+func (e *ExploredSet) MarshalJSON() ([]byte, error) {
+	return json.Marshal(exploredSetJSON{
+		Width:  e.Width,
+		Height: e.Height,
+		Bits:   base64.StdEncoding.EncodeToString(e.bits),
+	})
+}
+
+// UnmarshalJSON decodes an explored set written by MarshalJSON
+func (e *ExploredSet) UnmarshalJSON(data []byte) error {
+	var decoded exploredSetJSON
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		return err
+	}
+
+	bits, err := base64.StdEncoding.DecodeString(decoded.Bits)
+	if err != nil {
+		return err
+	}
+
+	*e = *NewExploredSet(decoded.Width, decoded.Height)
+	copy(e.bits, bits)
+	return nil
+}
+
+// ExplorationKey returns the key used for a floor in Character.Exploration
+func ExplorationKey(dungeonID string, level int) string {
+	return dungeonID + "/" + strconv.Itoa(level)
+}
+
+// ExploredFloor returns the character's explored set for a floor, creating it if needed
+func (c *Character) ExploredFloor(dungeonID string, floor *Floor) *ExploredSet {
+	if c.Exploration == nil {
+		c.Exploration = make(map[string]*ExploredSet)
+	}
+
+	key := ExplorationKey(dungeonID, floor.Level)
+	explored, exists := c.Exploration[key]
+	if !exists || explored.Width != floor.Width || explored.Height != floor.Height {
+		explored = NewExploredSet(floor.Width, floor.Height)
+		c.Exploration[key] = explored
+	}
+
+	return explored
+}
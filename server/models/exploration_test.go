@@ -0,0 +1,70 @@
+package models
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExploredSet(t *testing.T) {
+	explored := NewExploredSet(10, 5)
+
+	assert.False(t, explored.Has(3, 2))
+	explored.Add(3, 2)
+	explored.Add(3, 2)
+	explored.Add(9, 4)
+	assert.True(t, explored.Has(3, 2))
+	assert.True(t, explored.Has(9, 4))
+	assert.False(t, explored.Has(2, 3), "Coordinates should not be transposed")
+	assert.Equal(t, 2, explored.Count())
+
+	// Out of bounds tiles are ignored
+	explored.Add(-1, 0)
+	explored.Add(10, 0)
+	assert.False(t, explored.Has(10, 0))
+	assert.Equal(t, 2, explored.Count())
+}
+
+func TestExploredSetJSON(t *testing.T) {
+	explored := NewExploredSet(100, 100)
+	for x := 0; x < 100; x++ {
+		explored.Add(x, x)
+	}
+
+	data, err := json.Marshal(explored)
+	require.NoError(t, err)
+	assert.Less(t, len(data), 2000, "A 100x100 floor should encode compactly")
+
+	var decoded ExploredSet
+	require.NoError(t, json.Unmarshal(data, &decoded))
+	assert.Equal(t, 100, decoded.Width)
+	assert.Equal(t, 100, decoded.Height)
+	assert.Equal(t, 100, decoded.Count())
+	assert.True(t, decoded.Has(42, 42))
+	assert.False(t, decoded.Has(42, 43))
+}
+
+func TestCharacterExploredFloor(t *testing.T) {
+	character := NewCharacter("Explorer", Warrior)
+	floor := &Floor{Level: 2, Width: 10, Height: 10}
+
+	explored := character.ExploredFloor("dungeon", floor)
+	explored.Add(1, 1)
+	assert.Same(t, explored, character.ExploredFloor("dungeon", floor), "The same set should be returned")
+	assert.NotSame(t, explored, character.ExploredFloor("dungeon", &Floor{Level: 3, Width: 10, Height: 10}),
+		"Each floor should have its own set")
+
+	// A regenerated floor with a different size starts unexplored
+	resized := character.ExploredFloor("dungeon", &Floor{Level: 2, Width: 20, Height: 10})
+	assert.Equal(t, 0, resized.Count())
+
+	// Exploration survives a save and load
+	resized.Add(5, 5)
+	data, err := json.Marshal(character)
+	require.NoError(t, err)
+	var loaded Character
+	require.NoError(t, json.Unmarshal(data, &loaded))
+	assert.True(t, loaded.Exploration[ExplorationKey("dungeon", 2)].Has(5, 5))
+}
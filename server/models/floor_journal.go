@@ -0,0 +1,142 @@
+package models
+
+// MaxFloorJournal is the number of committed versions a floor remembers.
+// Clients further behind than this need a full resync.
+const MaxFloorJournal = 128
+
+// MaxMarkedTiles is the number of MarkTiles calls a floor remembers for
+// TilesChangedSince. Anything further behind has to look at every tile.
+const MaxMarkedTiles = 256
+
+// FloorChange lists the tiles, mobs and items that changed in a floor version
+type FloorChange struct {
+	Version uint64
+	Tiles   []Position
+	Mobs    []string
+	Items   []string
+}
+
+// empty checks if the change touches nothing
+func (c *FloorChange) empty() bool {
+	return len(c.Tiles) == 0 && len(c.Mobs) == 0 && len(c.Items) == 0
+}
+
+// markedTiles are the tiles one MarkTiles call marked as changed
+type markedTiles struct {
+	change    uint64 // The floor's tile changes once they were marked
+	positions []Position
+}
+
+// MarkTiles records that tiles changed. The change is published by the next Commit.
+func (f *Floor) MarkTiles(positions ...Position) {
+	f.pendingChange().Tiles = append(f.pendingChange().Tiles, positions...)
+	f.tileChanges++
+
+	f.marked = append(f.marked, markedTiles{change: f.tileChanges, positions: append([]Position(nil), positions...)})
+	if len(f.marked) > MaxMarkedTiles {
+		f.marked = f.marked[len(f.marked)-MaxMarkedTiles:]
+	}
+}
+
+// TileChanges counts the times tiles have been marked as changed, committed or
+// not, so anything worked out from the tiles can tell when it may be stale
+func (f *Floor) TileChanges() uint64 {
+	return f.tileChanges
+}
+
+// TilesChangedSince lists the tiles marked as changed since TileChanges returned
+// the given count. It returns false when the floor no longer remembers that far back.
+func (f *Floor) TilesChangedSince(changes uint64) ([]Position, bool) {
+	if changes == f.tileChanges {
+		return []Position{}, true
+	}
+	if changes > f.tileChanges || len(f.marked) == 0 || f.marked[0].change > changes+1 {
+		return nil, false
+	}
+
+	positions := make([]Position, 0)
+	for _, marked := range f.marked {
+		if marked.change > changes {
+			positions = append(positions, marked.positions...)
+		}
+	}
+	return positions, true
+}
+
+// MarkMobs records that mobs moved, changed or were removed
+func (f *Floor) MarkMobs(ids ...string) {
+	f.pendingChange().Mobs = append(f.pendingChange().Mobs, ids...)
+}
+
+// MarkItems records that items were added, changed or removed
+func (f *Floor) MarkItems(ids ...string) {
+	f.pendingChange().Items = append(f.pendingChange().Items, ids...)
+}
+
+// pendingChange returns the change being built up since the last commit
+func (f *Floor) pendingChange() *FloorChange {
+	if f.pending == nil {
+		f.pending = &FloorChange{}
+	}
+	return f.pending
+}
+
+// Commit publishes the marked changes as a new floor version and returns the
+// current version. Nothing happens if no changes were marked.
+func (f *Floor) Commit() uint64 {
+	if f.pending == nil || f.pending.empty() {
+		return f.Version
+	}
+
+	f.Version++
+	f.pending.Version = f.Version
+	f.journal = append(f.journal, *f.pending)
+	f.pending = nil
+
+	if len(f.journal) > MaxFloorJournal {
+		f.journal = f.journal[len(f.journal)-MaxFloorJournal:]
+	}
+
+	return f.Version
+}
+
+// ChangesSince merges every committed change after a version. It returns false
+// when the journal no longer reaches back that far.
+func (f *Floor) ChangesSince(version uint64) (FloorChange, bool) {
+	merged := FloorChange{Version: f.Version}
+	if version == f.Version {
+		return merged, true
+	}
+	if version > f.Version || len(f.journal) == 0 || f.journal[0].Version > version+1 {
+		return merged, false
+	}
+
+	tiles := make(map[Position]bool)
+	mobs := make(map[string]bool)
+	items := make(map[string]bool)
+	for _, change := range f.journal {
+		if change.Version <= version {
+			continue
+		}
+		for _, pos := range change.Tiles {
+			if !tiles[pos] {
+				tiles[pos] = true
+				merged.Tiles = append(merged.Tiles, pos)
+			}
+		}
+		for _, id := range change.Mobs {
+			if !mobs[id] {
+				mobs[id] = true
+				merged.Mobs = append(merged.Mobs, id)
+			}
+		}
+		for _, id := range change.Items {
+			if !items[id] {
+				items[id] = true
+				merged.Items = append(merged.Items, id)
+			}
+		}
+	}
+
+	return merged, true
+}
@@ -0,0 +1,120 @@
+package models
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFloorCommit(t *testing.T) {
+	floor := &Floor{Level: 1, Width: 10, Height: 10}
+
+	assert.Equal(t, uint64(0), floor.Commit(), "Committing nothing should not bump the version")
+
+	floor.MarkTiles(Position{X: 1, Y: 1})
+	floor.MarkMobs("mob-1")
+	assert.Equal(t, uint64(1), floor.Commit())
+	assert.Equal(t, uint64(1), floor.Version)
+	assert.Equal(t, uint64(1), floor.Commit(), "Changes should only be committed once")
+}
+
+func TestFloorTileChanges(t *testing.T) {
+	floor := &Floor{Level: 1, Width: 10, Height: 10}
+	assert.Equal(t, uint64(0), floor.TileChanges())
+
+	floor.MarkTiles(Position{X: 1, Y: 1}, Position{X: 2, Y: 1})
+	floor.MarkMobs("mob-1")
+	floor.MarkItems("item-1")
+	assert.Equal(t, uint64(1), floor.TileChanges(), "Only marking tiles counts")
+
+	floor.Commit()
+	floor.MarkTiles(Position{X: 3, Y: 3})
+	assert.Equal(t, uint64(2), floor.TileChanges(), "Changes count whether they are committed or not")
+}
+
+func TestFloorTilesChangedSince(t *testing.T) {
+	floor := &Floor{Level: 1, Width: 10, Height: 10}
+
+	floor.MarkTiles(Position{X: 1, Y: 1}, Position{X: 2, Y: 1})
+	floor.Commit()
+	floor.MarkTiles(Position{X: 3, Y: 3})
+
+	positions, ok := floor.TilesChangedSince(0)
+	require.True(t, ok)
+	assert.Equal(t, []Position{{X: 1, Y: 1}, {X: 2, Y: 1}, {X: 3, Y: 3}}, positions, "Committed or not, every marked tile is listed")
+
+	positions, ok = floor.TilesChangedSince(1)
+	require.True(t, ok)
+	assert.Equal(t, []Position{{X: 3, Y: 3}}, positions)
+
+	positions, ok = floor.TilesChangedSince(floor.TileChanges())
+	require.True(t, ok)
+	assert.Empty(t, positions)
+
+	_, ok = floor.TilesChangedSince(floor.TileChanges() + 1)
+	assert.False(t, ok)
+
+	// Only the most recent marks are remembered
+	for i := 0; i < MaxMarkedTiles; i++ {
+		floor.MarkTiles(Position{X: 4, Y: 4})
+	}
+	_, ok = floor.TilesChangedSince(1)
+	assert.False(t, ok)
+	positions, ok = floor.TilesChangedSince(floor.TileChanges() - MaxMarkedTiles)
+	require.True(t, ok)
+	assert.Len(t, positions, MaxMarkedTiles)
+}
+
+func TestFloorChangesSince(t *testing.T) {
+	floor := &Floor{Level: 1, Width: 10, Height: 10}
+
+	floor.MarkTiles(Position{X: 1, Y: 1}, Position{X: 2, Y: 1})
+	floor.MarkMobs("mob-1")
+	floor.Commit()
+	floor.MarkTiles(Position{X: 2, Y: 1}, Position{X: 3, Y: 1})
+	floor.MarkMobs("mob-1")
+	floor.MarkItems("item-1")
+	floor.Commit()
+
+	changes, ok := floor.ChangesSince(0)
+	require.True(t, ok)
+	assert.Equal(t, uint64(2), changes.Version)
+	assert.Equal(t, []Position{{X: 1, Y: 1}, {X: 2, Y: 1}, {X: 3, Y: 1}}, changes.Tiles, "Tiles should be merged without duplicates")
+	assert.Equal(t, []string{"mob-1"}, changes.Mobs)
+	assert.Equal(t, []string{"item-1"}, changes.Items)
+
+	changes, ok = floor.ChangesSince(1)
+	require.True(t, ok)
+	assert.Equal(t, []Position{{X: 2, Y: 1}, {X: 3, Y: 1}}, changes.Tiles, "Only later versions should be included")
+
+	changes, ok = floor.ChangesSince(2)
+	require.True(t, ok)
+	assert.Empty(t, changes.Tiles, "An up to date version has no changes")
+
+	_, ok = floor.ChangesSince(3)
+	assert.False(t, ok, "Future versions can't be diffed")
+
+	// Uncommitted changes are not visible
+	floor.MarkItems("item-2")
+	changes, _ = floor.ChangesSince(0)
+	assert.NotContains(t, changes.Items, "item-2")
+}
+
+func TestFloorJournalIsBounded(t *testing.T) {
+	floor := &Floor{Level: 1, Width: 10, Height: 10}
+	for i := 0; i < MaxFloorJournal+10; i++ {
+		floor.MarkItems("item")
+		floor.Commit()
+	}
+
+	_, ok := floor.ChangesSince(5)
+	assert.False(t, ok, "Versions older than the journal should need a resync")
+	_, ok = floor.ChangesSince(floor.Version - MaxFloorJournal)
+	assert.True(t, ok, "The whole journal should still be available")
+
+	// A floor loaded from storage has a version but no journal
+	loaded := &Floor{Level: 1, Version: 7}
+	_, ok = loaded.ChangesSince(6)
+	assert.False(t, ok)
+}
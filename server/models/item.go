@@ -1,6 +1,8 @@
 package models
 
 import (
+	"math/rand"
+
 	"github.com/google/uuid"
 )
 
@@ -32,6 +34,12 @@ type Item struct {
 	Equipped    bool             `json:"equipped"`
 	ClassReq    []CharacterClass `json:"classReq,omitempty"` // Classes that can use this item
 	LevelReq    int              `json:"levelReq,omitempty"` // Minimum level required to use
+	Rarity      Rarity           `json:"rarity,omitempty"`
+	BaseName    string           `json:"baseName,omitempty"` // Name before affixes were added
+	Affixes     []Affix          `json:"affixes,omitempty"`
+	Effect      *StatusEffect    `json:"effect,omitempty"`      // Applied to whoever uses a potion or scroll
+	ReservedFor string           `json:"reservedFor,omitempty"` // Party member who alone may pick it up
+	LockID      string           `json:"lockId,omitempty"`      // Door or chest a key opens
 }
 
 // NewWeapon creates a new weapon item
@@ -186,11 +194,22 @@ func NewScroll(name string, power int, value int) *Item {
 	}
 }
 
-// GenerateRandomItem creates a random item based on floor level
-func GenerateRandomItem(floorLevel int) *Item {
-	// This is a placeholder for a more sophisticated item generation system
-	// In a real implementation, you would use the floor level to determine item quality
+// NewKey creates a key that opens the door or chest with the given ID
+func NewKey(name string, lockID string) *Item {
+	return &Item{
+		ID:          uuid.New().String(),
+		Type:        ItemKey,
+		Name:        name,
+		Description: "A key that opens a lock on this floor.",
+		Weight:      0.1,
+		Symbol:      "-",
+		Color:       "#DAA520", // Goldenrod
+		Position:    Position{X: 0, Y: 0},
+		LockID:      lockID,
+	}
+}
 
-	// For now, just return a basic weapon
-	return NewWeapon("Sword", 5+floorLevel, 10*floorLevel, floorLevel, nil)
+// GenerateRandomItem creates a random item for a floor level from the loot catalog's random table
+func GenerateRandomItem(floorLevel int) *Item {
+	return Loot().RandomItem(rand.New(rand.NewSource(rand.Int63())), floorLevel)
 }
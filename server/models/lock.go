@@ -0,0 +1,77 @@
+package models
+
+import (
+	"github.com/google/uuid"
+)
+
+const (
+	lockBaseDC = 12 // Lockpicking DC of locks on the first floor
+	maxLockDC  = 25 // Locks never get harder to pick than this
+)
+
+// Lock keeps a door or chest shut until it is opened with its key or picked
+type Lock struct {
+	DC     int   `json:"dc"` // Lockpicking check needed to pick the lock
+	Locked bool  `json:"locked"`
+	Jammed bool  `json:"jammed,omitempty"` // A failed pick broke the lock, so only its key opens it
+	Trap   *Trap `json:"trap,omitempty"`   // Set off by a failed pick; never shown to players
+}
+
+// NewLock creates a locked lock scaled for a floor
+func NewLock(level int) *Lock {
+	return &Lock{
+		DC:     min(lockBaseDC+level/2, maxLockDC),
+		Locked: true,
+	}
+}
+
+// IsLocked checks if a lock is set and still locked
+func (l *Lock) IsLocked() bool {
+	return l != nil && l.Locked
+}
+
+// Door blocks a doorway while it is closed
+type Door struct {
+	ID       string   `json:"id"`
+	Position Position `json:"position"`
+	Open     bool     `json:"open"`
+	Lock     *Lock    `json:"lock,omitempty"`
+	Sealed   bool     `json:"sealed,omitempty"` // Held shut by a puzzle until it is solved
+}
+
+// NewDoor creates a closed door
+func NewDoor(pos Position) *Door {
+	return &Door{
+		ID:       uuid.New().String(),
+		Position: pos,
+	}
+}
+
+// Chest holds loot until someone opens it
+type Chest struct {
+	ID       string   `json:"id"`
+	Position Position `json:"position"`
+	Open     bool     `json:"open"`
+	Lock     *Lock    `json:"lock,omitempty"`
+	Items    []*Item  `json:"items,omitempty"` // Only shown to players once the chest is open
+}
+
+// NewChest creates a closed chest holding items
+func NewChest(pos Position, items []*Item) *Chest {
+	return &Chest{
+		ID:       uuid.New().String(),
+		Position: pos,
+		Items:    items,
+	}
+}
+
+// Take removes an item from the chest
+func (c *Chest) Take(itemID string) (*Item, bool) {
+	for i, item := range c.Items {
+		if item.ID == itemID {
+			c.Items = append(c.Items[:i], c.Items[i+1:]...)
+			return item, true
+		}
+	}
+	return nil, false
+}
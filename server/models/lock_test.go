@@ -0,0 +1,46 @@
+package models
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewLock(t *testing.T) {
+	lock := NewLock(4)
+	assert.Equal(t, 14, lock.DC)
+	assert.True(t, lock.IsLocked())
+	assert.Equal(t, maxLockDC, NewLock(100).DC, "The deepest locks are capped")
+
+	var missing *Lock
+	assert.False(t, missing.IsLocked(), "Doors and chests without a lock are never locked")
+}
+
+func TestChestTake(t *testing.T) {
+	potion := NewPotion("Health Potion", 10, 10)
+	chest := NewChest(Position{X: 1, Y: 1}, []*Item{potion})
+
+	_, exists := chest.Take("missing")
+	assert.False(t, exists)
+
+	item, exists := chest.Take(potion.ID)
+	require.True(t, exists)
+	assert.Same(t, potion, item)
+	assert.Empty(t, chest.Items)
+}
+
+func TestCharacterFindKey(t *testing.T) {
+	character := NewCharacter("Keeper", Rogue)
+	door := NewDoor(Position{X: 1, Y: 1})
+	key := NewKey("Iron Key", door.ID)
+	require.True(t, character.AddToInventory(key))
+	require.True(t, character.AddToInventory(NewKey("Brass Key", "other")))
+
+	found, exists := character.FindKey(door.ID)
+	require.True(t, exists)
+	assert.Same(t, key, found)
+
+	_, exists = character.FindKey("missing")
+	assert.False(t, exists)
+}
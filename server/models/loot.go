@@ -0,0 +1,625 @@
+package models
+
+import (
+	"bytes"
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand"
+	"os"
+	"sort"
+	"sync/atomic"
+)
+
+// defaultLootJSON holds the loot tables the server ships with
+//
+//go:embed data/loot.json
+var defaultLootJSON []byte
+
+// defaultShopStock is how many random items a shop stocks when the catalog has no shop table
+const defaultShopStock = 5
+
+// maxBossRolls is how many times the boss table is rolled looking for a rare drop
+const maxBossRolls = 10
+
+// Rarity is the quality tier of an item
+type Rarity string
+
+const (
+	RarityCommon    Rarity = "common"
+	RarityUncommon  Rarity = "uncommon"
+	RarityRare      Rarity = "rare"
+	RarityEpic      Rarity = "epic"
+	RarityLegendary Rarity = "legendary"
+)
+
+// Rarities lists every rarity from least to most rare
+var Rarities = []Rarity{RarityCommon, RarityUncommon, RarityRare, RarityEpic, RarityLegendary}
+
+// RarityModifier scales an item's power, value and affixes for its rarity
+type RarityModifier struct {
+	Power   float64 `json:"power"` // Also scales affix values
+	Value   float64 `json:"value"`
+	Affixes int     `json:"affixes,omitempty"` // Number of affixes weapons and armor roll, up to 2
+}
+
+// ItemTemplate describes an item that loot tables can drop
+type ItemTemplate struct {
+	Name          string        `json:"name"`
+	Type          ItemType      `json:"type"`
+	Power         int           `json:"power"`
+	PowerPerDepth int           `json:"powerPerDepth,omitempty"` // Power added for each floor below the first
+	Value         int           `json:"value"`
+	ValuePerDepth int           `json:"valuePerDepth,omitempty"` // Value added for each floor below the first
+	Weight        float64       `json:"weight"`
+	Effect        *StatusEffect `json:"effect,omitempty"` // Status effect a potion or scroll applies when used
+}
+
+// LootEntry is one weighted outcome of a loot table: an item, a nested table,
+// or nothing when neither is set
+type LootEntry struct {
+	Item     string `json:"item,omitempty"`
+	Table    string `json:"table,omitempty"`
+	Rarity   Rarity `json:"rarity,omitempty"` // Rarity of the item, or of everything rolled from the table
+	Weight   int    `json:"weight"`
+	MinDepth int    `json:"minDepth,omitempty"` // Shallowest floor the entry can drop on
+	MaxDepth int    `json:"maxDepth,omitempty"` // Deepest floor the entry can drop on; 0 means no limit
+}
+
+// LootTable picks weighted entries a number of times
+type LootTable struct {
+	Chance   float64     `json:"chance,omitempty"`   // Chance the table drops anything; 0 means always
+	MinRolls int         `json:"minRolls,omitempty"` // Defaults to 1
+	MaxRolls int         `json:"maxRolls,omitempty"` // Defaults to MinRolls
+	Entries  []LootEntry `json:"entries"`
+}
+
+// LootCatalog holds the item templates and loot tables loaded at startup
+type LootCatalog struct {
+	Rarities map[Rarity]RarityModifier `json:"rarities"`
+	Items    []*ItemTemplate           `json:"items"`
+	Affixes  []*AffixDefinition        `json:"affixes,omitempty"`
+	Tables   map[string]*LootTable     `json:"tables"`
+	Rooms    map[RoomType]string       `json:"rooms"`            // Table rolled for the items in each room type
+	Variants map[MobVariant]string     `json:"variants"`         // Extra table rolled when a mob of the variant dies
+	Random   string                    `json:"random"`           // Table used for GenerateRandomItem
+	Shop     string                    `json:"shop,omitempty"`   // Table rolled for a shop's stock
+	Chest    string                    `json:"chest,omitempty"`  // Table rolled for what a chest holds
+	Boss     string                    `json:"boss,omitempty"`   // Table a boss's guaranteed rare drop comes from
+	Themes   map[Theme]string          `json:"themes,omitempty"` // Extra table rolled in standard and treasure rooms on floors of a theme
+
+	itemsByName map[string]*ItemTemplate
+}
+
+// loot is the catalog used to roll items
+var loot atomic.Pointer[LootCatalog]
+
+func init() {
+	loot.Store(DefaultLootCatalog())
+}
+
+// Loot returns the loot catalog in use
+func Loot() *LootCatalog {
+	return loot.Load()
+}
+
+// SetLootCatalog replaces the loot catalog used to roll items
+func SetLootCatalog(catalog *LootCatalog) {
+	loot.Store(catalog)
+}
+
+// DefaultLootCatalog returns a fresh copy of the built-in loot tables
+func DefaultLootCatalog() *LootCatalog {
+	catalog, err := ParseLootCatalog(defaultLootJSON)
+	if err != nil {
+		panic(fmt.Sprintf("invalid built-in loot tables: %v", err))
+	}
+	return catalog
+}
+
+// LoadLootCatalog reads and validates loot tables from a JSON file
+func LoadLootCatalog(path string) (*LootCatalog, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	catalog, err := ParseLootCatalog(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return catalog, nil
+}
+
+// ParseLootCatalog decodes and validates loot tables
+func ParseLootCatalog(data []byte) (*LootCatalog, error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+
+	var catalog LootCatalog
+	if err := decoder.Decode(&catalog); err != nil {
+		return nil, fmt.Errorf("invalid loot tables: %w", err)
+	}
+
+	catalog.itemsByName = make(map[string]*ItemTemplate, len(catalog.Items))
+	for _, template := range catalog.Items {
+		if template != nil {
+			catalog.itemsByName[template.Name] = template
+		}
+	}
+
+	if err := catalog.Validate(); err != nil {
+		return nil, err
+	}
+	return &catalog, nil
+}
+
+// Validate checks the templates, tables and references, reporting all problems at once
+func (c *LootCatalog) Validate() error {
+	var errs []error
+
+	for _, rarity := range Rarities {
+		modifier, exists := c.Rarities[rarity]
+		if !exists {
+			errs = append(errs, fmt.Errorf("rarity %q is not defined", rarity))
+		} else if modifier.Power <= 0 || modifier.Value <= 0 {
+			errs = append(errs, fmt.Errorf("rarity %q: power and value must be positive", rarity))
+		}
+		if modifier.Affixes < 0 || modifier.Affixes > 2 {
+			errs = append(errs, fmt.Errorf("rarity %q: affixes must be between 0 and 2", rarity))
+		}
+	}
+	for rarity := range c.Rarities {
+		if !validRarity(rarity) {
+			errs = append(errs, fmt.Errorf("rarity %q is unknown", rarity))
+		}
+	}
+
+	// Boss drops and random items fall back to the first item
+	if len(c.Items) == 0 {
+		errs = append(errs, errors.New("no items are defined"))
+	}
+	seen := make(map[string]bool)
+	for i, template := range c.Items {
+		if template == nil || template.Name == "" {
+			errs = append(errs, fmt.Errorf("item %d: name is required", i))
+			continue
+		}
+		if seen[template.Name] {
+			errs = append(errs, fmt.Errorf("item %q is defined more than once", template.Name))
+		}
+		seen[template.Name] = true
+
+		switch template.Type {
+		case ItemWeapon, ItemArmor, ItemPotion, ItemScroll:
+		default:
+			errs = append(errs, fmt.Errorf("item %q: type %q can't be dropped", template.Name, template.Type))
+		}
+		if template.Power < 0 || template.PowerPerDepth < 0 || template.Value < 0 || template.ValuePerDepth < 0 || template.Weight < 0 {
+			errs = append(errs, fmt.Errorf("item %q: power, value and weight can't be negative", template.Name))
+		}
+		if template.Effect != nil {
+			if template.Type != ItemPotion && template.Type != ItemScroll {
+				errs = append(errs, fmt.Errorf("item %q: only potions and scrolls can have an effect", template.Name))
+			}
+			if err := template.Effect.validate(); err != nil {
+				errs = append(errs, fmt.Errorf("item %q: %w", template.Name, err))
+			}
+		}
+	}
+
+	affixes := make(map[string]bool)
+	for i, definition := range c.Affixes {
+		if definition == nil || definition.Name == "" {
+			errs = append(errs, fmt.Errorf("affix %d: name is required", i))
+			continue
+		}
+		if affixes[definition.Name] {
+			errs = append(errs, fmt.Errorf("affix %q is defined more than once", definition.Name))
+		}
+		affixes[definition.Name] = true
+
+		if err := definition.validate(); err != nil {
+			errs = append(errs, fmt.Errorf("affix %q: %w", definition.Name, err))
+		}
+	}
+
+	names := make([]string, 0, len(c.Tables))
+	for name := range c.Tables {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if err := c.validateTable(c.Tables[name]); err != nil {
+			errs = append(errs, fmt.Errorf("table %q: %w", name, err))
+		}
+		if cycle := c.findCycle(name, nil); cycle != nil {
+			errs = append(errs, fmt.Errorf("table %q nests itself: %v", name, cycle))
+		}
+	}
+
+	for roomType, table := range c.Rooms {
+		if _, exists := c.Tables[table]; !exists {
+			errs = append(errs, fmt.Errorf("room %q: table %q is not defined", roomType, table))
+		}
+	}
+	for variant, table := range c.Variants {
+		if _, exists := c.Tables[table]; !exists {
+			errs = append(errs, fmt.Errorf("variant %q: table %q is not defined", variant, table))
+		}
+	}
+	if _, exists := c.Tables[c.Random]; !exists {
+		errs = append(errs, fmt.Errorf("random: table %q is not defined", c.Random))
+	}
+	if _, exists := c.Tables[c.Shop]; c.Shop != "" && !exists {
+		errs = append(errs, fmt.Errorf("shop: table %q is not defined", c.Shop))
+	}
+	if _, exists := c.Tables[c.Chest]; c.Chest != "" && !exists {
+		errs = append(errs, fmt.Errorf("chest: table %q is not defined", c.Chest))
+	}
+	if _, exists := c.Tables[c.Boss]; c.Boss != "" && !exists {
+		errs = append(errs, fmt.Errorf("boss: table %q is not defined", c.Boss))
+	}
+	for theme, table := range c.Themes {
+		if _, exists := themes[theme]; !exists {
+			errs = append(errs, fmt.Errorf("theme %q is unknown", theme))
+		}
+		if _, exists := c.Tables[table]; !exists {
+			errs = append(errs, fmt.Errorf("theme %q: table %q is not defined", theme, table))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// validateTable checks a single table
+func (c *LootCatalog) validateTable(table *LootTable) error {
+	if table == nil {
+		return errors.New("table is empty")
+	}
+
+	var errs []error
+	if table.Chance < 0 || table.Chance > 1 {
+		errs = append(errs, errors.New("chance must be between 0 and 1"))
+	}
+	if table.MinRolls < 0 || (table.MaxRolls > 0 && table.MaxRolls < table.MinRolls) {
+		errs = append(errs, errors.New("maxRolls can't be less than minRolls"))
+	}
+	if len(table.Entries) == 0 {
+		errs = append(errs, errors.New("no entries are defined"))
+	}
+
+	for i, entry := range table.Entries {
+		if entry.Weight <= 0 {
+			errs = append(errs, fmt.Errorf("entry %d: weight must be positive", i))
+		}
+		if entry.Item != "" && entry.Table != "" {
+			errs = append(errs, fmt.Errorf("entry %d: can't drop both an item and a table", i))
+		}
+		if _, exists := c.itemsByName[entry.Item]; entry.Item != "" && !exists {
+			errs = append(errs, fmt.Errorf("entry %d: item %q is not defined", i, entry.Item))
+		}
+		if _, exists := c.Tables[entry.Table]; entry.Table != "" && !exists {
+			errs = append(errs, fmt.Errorf("entry %d: table %q is not defined", i, entry.Table))
+		}
+		if entry.Rarity != "" && !validRarity(entry.Rarity) {
+			errs = append(errs, fmt.Errorf("entry %d: rarity %q is unknown", i, entry.Rarity))
+		}
+		if entry.MinDepth < 0 || entry.MaxDepth < 0 || (entry.MaxDepth > 0 && entry.MaxDepth < entry.MinDepth) {
+			errs = append(errs, fmt.Errorf("entry %d: maxDepth can't be less than minDepth", i))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// findCycle returns the chain of table names if a table nests itself
+func (c *LootCatalog) findCycle(name string, path []string) []string {
+	for i, visited := range path {
+		if visited == name {
+			return append(path[i:], name)
+		}
+	}
+
+	table, exists := c.Tables[name]
+	if !exists || table == nil {
+		return nil
+	}
+
+	path = append(path, name)
+	for _, entry := range table.Entries {
+		if entry.Table == "" {
+			continue
+		}
+		if cycle := c.findCycle(entry.Table, path); cycle != nil {
+			return cycle
+		}
+	}
+	return nil
+}
+
+// ValidateMonsters checks that every loot table the monsters reference exists
+func (c *LootCatalog) ValidateMonsters(monsters *MonsterCatalog) error {
+	var errs []error
+	for _, definition := range monsters.Monsters {
+		if _, exists := c.Tables[definition.LootTable]; definition.LootTable != "" && !exists {
+			errs = append(errs, fmt.Errorf("monster %q: loot table %q is not defined", definition.Type, definition.LootTable))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// AtLeast checks if a rarity is the same tier as another or rarer
+func (r Rarity) AtLeast(other Rarity) bool {
+	return rarityRank(r) >= rarityRank(other)
+}
+
+// rarityRank returns a rarity's position in Rarities, or -1 if it is unknown
+func rarityRank(rarity Rarity) int {
+	for i, known := range Rarities {
+		if rarity == known {
+			return i
+		}
+	}
+	return -1
+}
+
+// validRarity checks if a rarity is one of the known tiers
+func validRarity(rarity Rarity) bool {
+	for _, known := range Rarities {
+		if rarity == known {
+			return true
+		}
+	}
+	return false
+}
+
+// rolls returns the range of times a table picks an entry
+func (t *LootTable) rolls() (int, int) {
+	minRolls := max(t.MinRolls, 1)
+	maxRolls := max(t.MaxRolls, minRolls)
+	return minRolls, maxRolls
+}
+
+// chance returns the probability the table drops anything
+func (t *LootTable) chance() float64 {
+	if t.Chance == 0 {
+		return 1
+	}
+	return t.Chance
+}
+
+// eligible checks if an entry can drop on a floor
+func (e LootEntry) eligible(depth int) bool {
+	return depth >= e.MinDepth && (e.MaxDepth == 0 || depth <= e.MaxDepth)
+}
+
+// Roll rolls a table for a floor and returns the items it drops
+func (c *LootCatalog) Roll(rng *rand.Rand, name string, depth int) []*Item {
+	return c.roll(rng, name, depth, RarityCommon)
+}
+
+// RollRoom rolls the table for a room type
+func (c *LootCatalog) RollRoom(rng *rand.Rand, roomType RoomType, depth int) []*Item {
+	table, exists := c.Rooms[roomType]
+	if !exists {
+		return nil
+	}
+	return c.Roll(rng, table, depth)
+}
+
+// RollTheme rolls the extra table for a room on a floor of a theme
+func (c *LootCatalog) RollTheme(rng *rand.Rand, theme Theme, depth int) []*Item {
+	table, exists := c.Themes[theme]
+	if !exists {
+		return nil
+	}
+	return c.Roll(rng, table, depth)
+}
+
+// RollMob rolls the loot table of a mob's type and the extra table for its variant.
+// Bosses also always drop a rare or better item.
+func (c *LootCatalog) RollMob(rng *rand.Rand, mob *Mob) []*Item {
+	items := make([]*Item, 0)
+	if definition, exists := Monsters().Definition(mob.Type); exists && definition.LootTable != "" {
+		items = append(items, c.Roll(rng, definition.LootTable, mob.Level)...)
+	}
+	if table, exists := c.Variants[mob.Variant]; exists {
+		items = append(items, c.Roll(rng, table, mob.Level)...)
+	}
+	if mob.Variant == VariantBoss {
+		items = append(items, c.RollBoss(rng, mob.Level))
+	}
+	return items
+}
+
+// RollBoss rolls a boss's guaranteed drop: the first rare or better item the boss
+// table gives in a few tries, or a rare item from the first template if it never does
+func (c *LootCatalog) RollBoss(rng *rand.Rand, depth int) *Item {
+	for i := 0; i < maxBossRolls && c.Boss != ""; i++ {
+		for _, item := range c.roll(rng, c.Boss, depth, RarityRare) {
+			if item.Rarity.AtLeast(RarityRare) {
+				return item
+			}
+		}
+	}
+	return c.Items[0].NewItem(depth, RarityRare, c.Rarities[RarityRare])
+}
+
+// RollShop rolls the stock of a shop on a floor, falling back to random items
+// if the catalog has no shop table
+func (c *LootCatalog) RollShop(rng *rand.Rand, depth int) []*Item {
+	if c.Shop != "" {
+		return c.Roll(rng, c.Shop, depth)
+	}
+
+	items := make([]*Item, 0, defaultShopStock)
+	for i := 0; i < defaultShopStock; i++ {
+		items = append(items, c.RandomItem(rng, depth))
+	}
+	return items
+}
+
+// RollChest rolls what a chest on a floor holds, falling back to the treasure
+// room table if the catalog has no chest table
+func (c *LootCatalog) RollChest(rng *rand.Rand, depth int) []*Item {
+	if c.Chest != "" {
+		return c.Roll(rng, c.Chest, depth)
+	}
+	return c.RollRoom(rng, RoomTreasure, depth)
+}
+
+// RandomItem rolls the random item table, falling back to the first template if it drops nothing
+func (c *LootCatalog) RandomItem(rng *rand.Rand, depth int) *Item {
+	if items := c.Roll(rng, c.Random, depth); len(items) > 0 {
+		return items[0]
+	}
+	return c.Items[0].NewItem(depth, RarityCommon, c.Rarities[RarityCommon])
+}
+
+// roll picks entries from a table, passing its rarity down to nested tables
+func (c *LootCatalog) roll(rng *rand.Rand, name string, depth int, rarity Rarity) []*Item {
+	table, exists := c.Tables[name]
+	if !exists {
+		return nil
+	}
+
+	items := make([]*Item, 0)
+	if rng.Float64() >= table.chance() {
+		return items
+	}
+
+	entries, total := table.eligibleEntries(depth)
+	if total == 0 {
+		return items
+	}
+
+	minRolls, maxRolls := table.rolls()
+	rolls := minRolls + rng.Intn(maxRolls-minRolls+1)
+	for i := 0; i < rolls; i++ {
+		pick := rng.Intn(total)
+		for _, entry := range entries {
+			if pick >= entry.Weight {
+				pick -= entry.Weight
+				continue
+			}
+
+			entryRarity := rarity
+			if entry.Rarity != "" {
+				entryRarity = entry.Rarity
+			}
+			if entry.Item != "" {
+				item := c.itemsByName[entry.Item].NewItem(depth, entryRarity, c.Rarities[entryRarity])
+				c.rollAffixes(rng, item, depth)
+				items = append(items, item)
+			} else if entry.Table != "" {
+				items = append(items, c.roll(rng, entry.Table, depth, entryRarity)...)
+			}
+			break
+		}
+	}
+
+	return items
+}
+
+// eligibleEntries returns the entries that can drop on a floor and their total weight
+func (t *LootTable) eligibleEntries(depth int) ([]LootEntry, int) {
+	entries := make([]LootEntry, 0, len(t.Entries))
+	total := 0
+	for _, entry := range t.Entries {
+		if entry.eligible(depth) {
+			entries = append(entries, entry)
+			total += entry.Weight
+		}
+	}
+	return entries, total
+}
+
+// NewItem creates an item from the template, scaled for the floor and rarity
+func (t *ItemTemplate) NewItem(depth int, rarity Rarity, modifier RarityModifier) *Item {
+	levels := max(depth-1, 0)
+	power := int(float64(t.Power+t.PowerPerDepth*levels) * modifier.Power)
+	value := int(float64(t.Value+t.ValuePerDepth*levels) * modifier.Value)
+
+	var item *Item
+	switch t.Type {
+	case ItemWeapon:
+		item = NewWeaponWithWeight(t.Name, power, value, t.Weight, depth/2, nil)
+	case ItemArmor:
+		item = NewArmorWithWeight(t.Name, power, value, t.Weight, depth/2, nil)
+	case ItemScroll:
+		item = NewScroll(t.Name, power, value)
+		item.Weight = t.Weight
+	default:
+		item = NewPotion(t.Name, power, value)
+		item.Weight = t.Weight
+	}
+	item.Rarity = rarity
+	item.BaseName = t.Name
+	if t.Effect != nil {
+		effect := *t.Effect
+		item.Effect = &effect
+	}
+	return item
+}
+
+// LootOdds is the expected number of an item dropped by one roll of a table
+type LootOdds struct {
+	Item     string  `json:"item"`
+	Rarity   Rarity  `json:"rarity"`
+	Expected float64 `json:"expected"`
+}
+
+// Expected works out the average number of each item a table drops on a floor,
+// most likely first
+func (c *LootCatalog) Expected(name string, depth int) ([]LootOdds, error) {
+	if _, exists := c.Tables[name]; !exists {
+		return nil, fmt.Errorf("table %q is not defined", name)
+	}
+
+	expected := make(map[LootOdds]float64)
+	c.expected(name, depth, RarityCommon, 1, expected)
+
+	odds := make([]LootOdds, 0, len(expected))
+	for key, count := range expected {
+		key.Expected = count
+		odds = append(odds, key)
+	}
+	sort.Slice(odds, func(i, j int) bool {
+		if odds[i].Expected != odds[j].Expected {
+			return odds[i].Expected > odds[j].Expected
+		}
+		if odds[i].Item != odds[j].Item {
+			return odds[i].Item < odds[j].Item
+		}
+		return odds[i].Rarity < odds[j].Rarity
+	})
+	return odds, nil
+}
+
+// expected adds the expected drops of a table, scaled by how often it is rolled
+func (c *LootCatalog) expected(name string, depth int, rarity Rarity, scale float64, expected map[LootOdds]float64) {
+	table := c.Tables[name]
+	entries, total := table.eligibleEntries(depth)
+	if total == 0 {
+		return
+	}
+
+	minRolls, maxRolls := table.rolls()
+	scale *= table.chance() * float64(minRolls+maxRolls) / 2
+
+	for _, entry := range entries {
+		entryScale := scale * float64(entry.Weight) / float64(total)
+		entryRarity := rarity
+		if entry.Rarity != "" {
+			entryRarity = entry.Rarity
+		}
+
+		if entry.Item != "" {
+			expected[LootOdds{Item: entry.Item, Rarity: entryRarity}] += entryScale
+		} else if entry.Table != "" {
+			c.expected(entry.Table, depth, entryRarity, entryScale, expected)
+		}
+	}
+}
@@ -0,0 +1,326 @@
+package models
+
+import (
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testLootJSON is a small valid catalog
+const testLootJSON = `{
+  "rarities": {
+    "common": {"power": 1, "value": 1},
+    "uncommon": {"power": 1.5, "value": 2},
+    "rare": {"power": 2, "value": 4},
+    "epic": {"power": 3, "value": 8},
+    "legendary": {"power": 4, "value": 16}
+  },
+  "items": [
+    {"name": "Sword", "type": "weapon", "power": 4, "powerPerDepth": 1, "value": 20, "valuePerDepth": 10, "weight": 3},
+    {"name": "Health Potion", "type": "potion", "power": 10, "value": 10, "weight": 0.5}
+  ],
+  "tables": {
+    "weapons": {"entries": [{"item": "Sword", "weight": 1}]},
+    "rareWeapons": {"entries": [{"table": "weapons", "rarity": "rare", "weight": 1}]},
+    "mixed": {"entries": [
+      {"item": "Health Potion", "weight": 3},
+      {"table": "weapons", "weight": 1, "minDepth": 3}
+    ]},
+    "sometimes": {"chance": 0.5, "minRolls": 2, "maxRolls": 4, "entries": [{"item": "Health Potion", "weight": 1}, {"weight": 1}]}
+  },
+  "rooms": {"standard": "mixed"},
+  "variants": {"boss": "rareWeapons"},
+  "random": "weapons"
+}`
+
+func TestDefaultLootCatalog(t *testing.T) {
+	catalog := DefaultLootCatalog()
+	require.NoError(t, catalog.Validate())
+
+	// Every loot table a built-in monster drops from must exist
+	assert.NoError(t, catalog.ValidateMonsters(DefaultMonsterCatalog()))
+
+	for _, roomType := range []RoomType{RoomStandard, RoomTreasure, RoomBoss, RoomEntrance} {
+		assert.Contains(t, catalog.Rooms, roomType)
+	}
+
+	// Every theme but classic has its own finds
+	for _, theme := range Themes {
+		if theme != ThemeClassic {
+			assert.Contains(t, catalog.Themes, theme)
+		}
+	}
+}
+
+func TestParseLootCatalog(t *testing.T) {
+	catalog, err := ParseLootCatalog([]byte(testLootJSON))
+	require.NoError(t, err)
+
+	assert.Len(t, catalog.Items, 2)
+	assert.Equal(t, "mixed", catalog.Rooms[RoomStandard])
+	assert.Equal(t, "rareWeapons", catalog.Variants[VariantBoss])
+}
+
+func TestParseLootCatalogValidation(t *testing.T) {
+	_, err := ParseLootCatalog([]byte(`{
+	  "rarities": {"common": {"power": 1, "value": 1}, "shiny": {"power": 1, "value": 1}},
+	  "items": [
+	    {"name": "Sword", "type": "weapon", "power": -1, "value": 1},
+	    {"name": "Sword", "type": "key", "power": 1, "value": 1},
+	    {"name": "Shield", "type": "armor", "power": 1, "value": 1, "effect": {"type": "haste", "duration": 0}}
+	  ],
+	  "tables": {
+	    "a": {"chance": 2, "entries": [{"item": "Axe", "weight": 1}, {"table": "b", "weight": 0}]},
+	    "b": {"entries": [{"table": "a", "weight": 1, "rarity": "mythic"}]},
+	    "c": {"entries": []}
+	  },
+	  "rooms": {"treasure": "missing"},
+	  "random": "nothing",
+	  "shop": "closed",
+	  "themes": {"crypt": "bones", "candyland": "a"}
+	}`))
+	require.Error(t, err)
+	for _, problem := range []string{
+		`rarity "rare" is not defined`,
+		`rarity "shiny" is unknown`,
+		`item "Sword" is defined more than once`,
+		`type "key" can't be dropped`,
+		"power, value and weight can't be negative",
+		`item "Shield": only potions and scrolls can have an effect`,
+		"status duration must be positive",
+		"chance must be between 0 and 1",
+		`item "Axe" is not defined`,
+		"weight must be positive",
+		`rarity "mythic" is unknown`,
+		"no entries are defined",
+		`table "a" nests itself`,
+		`room "treasure": table "missing" is not defined`,
+		`random: table "nothing" is not defined`,
+		`shop: table "closed" is not defined`,
+		`theme "crypt": table "bones" is not defined`,
+		`theme "candyland" is unknown`,
+	} {
+		assert.Contains(t, err.Error(), problem)
+	}
+
+	// Catalogs need an item to fall back on
+	_, err = ParseLootCatalog([]byte(`{"rarities": {}, "items": [], "tables": {}}`))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "no items are defined")
+
+	// Typos in field names are caught instead of silently ignored
+	_, err = ParseLootCatalog([]byte(`{"tables": {"a": {"entires": []}}}`))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "entires")
+}
+
+func TestLoadLootCatalog(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "loot.json")
+	require.NoError(t, os.WriteFile(path, []byte(testLootJSON), 0o644))
+
+	catalog, err := LoadLootCatalog(path)
+	require.NoError(t, err)
+	assert.Len(t, catalog.Tables, 4)
+
+	_, err = LoadLootCatalog(filepath.Join(t.TempDir(), "missing.json"))
+	assert.Error(t, err)
+}
+
+func TestLootCatalogValidateMonsters(t *testing.T) {
+	catalog, err := ParseLootCatalog([]byte(testLootJSON))
+	require.NoError(t, err)
+
+	monsters, err := ParseMonsterCatalog([]byte(testMonstersJSON))
+	require.NoError(t, err)
+	assert.NoError(t, catalog.ValidateMonsters(monsters))
+
+	monsters.Monsters[0].LootTable = "goblinStuff"
+	err = catalog.ValidateMonsters(monsters)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), `monster "goblin": loot table "goblinStuff" is not defined`)
+}
+
+func TestLootCatalogRoll(t *testing.T) {
+	catalog, err := ParseLootCatalog([]byte(testLootJSON))
+	require.NoError(t, err)
+
+	// Items scale with depth
+	items := catalog.Roll(rand.New(rand.NewSource(1)), "weapons", 3)
+	require.Len(t, items, 1)
+	assert.Equal(t, "Sword", items[0].Name)
+	assert.Equal(t, ItemWeapon, items[0].Type)
+	assert.Equal(t, RarityCommon, items[0].Rarity)
+	assert.Equal(t, 6, items[0].Power)
+	assert.Equal(t, 40, items[0].Value)
+	assert.Equal(t, 1, items[0].LevelReq)
+
+	// Rarity passes down to nested tables
+	items = catalog.Roll(rand.New(rand.NewSource(1)), "rareWeapons", 1)
+	require.Len(t, items, 1)
+	assert.Equal(t, RarityRare, items[0].Rarity)
+	assert.Equal(t, 8, items[0].Power)
+	assert.Equal(t, 80, items[0].Value)
+
+	// Entries only drop within their depths
+	for seed := int64(0); seed < 50; seed++ {
+		for _, item := range catalog.Roll(rand.New(rand.NewSource(seed)), "mixed", 1) {
+			assert.Equal(t, "Health Potion", item.Name)
+		}
+	}
+
+	// The same seed always drops the same loot
+	first := catalog.Roll(rand.New(rand.NewSource(42)), "sometimes", 1)
+	second := catalog.Roll(rand.New(rand.NewSource(42)), "sometimes", 1)
+	require.Len(t, second, len(first))
+	for i := range first {
+		assert.Equal(t, first[i].Name, second[i].Name)
+	}
+
+	assert.Empty(t, catalog.Roll(rand.New(rand.NewSource(1)), "missing", 1))
+}
+
+func TestLootCatalogRollMob(t *testing.T) {
+	catalog, err := ParseLootCatalog([]byte(testLootJSON))
+	require.NoError(t, err)
+
+	rng := rand.New(rand.NewSource(1))
+	assert.Empty(t, catalog.RollMob(rng, &Mob{Type: MobGoblin, Variant: VariantNormal, Level: 1}))
+
+	// Bosses always roll their variant's table and add their guaranteed drop
+	items := catalog.RollMob(rng, &Mob{Type: MobGoblin, Variant: VariantBoss, Level: 1})
+	require.Len(t, items, 2)
+	assert.Equal(t, RarityRare, items[0].Rarity)
+	assert.Equal(t, RarityRare, items[1].Rarity)
+}
+
+func TestLootCatalogRollBoss(t *testing.T) {
+	catalog, err := ParseLootCatalog([]byte(testLootJSON))
+	require.NoError(t, err)
+	rng := rand.New(rand.NewSource(1))
+
+	// Items from the boss table are at least rare
+	catalog.Boss = "mixed"
+	item := catalog.RollBoss(rng, 1)
+	assert.Equal(t, "Health Potion", item.Name)
+	assert.Equal(t, RarityRare, item.Rarity)
+
+	// A table that never drops anything rare falls back to a rare first template
+	catalog.Tables["junk"] = &LootTable{Entries: []LootEntry{{Item: "Health Potion", Rarity: RarityCommon, Weight: 1}}}
+	catalog.Boss = "junk"
+	item = catalog.RollBoss(rng, 1)
+	assert.Equal(t, "Sword", item.Name)
+	assert.Equal(t, RarityRare, item.Rarity)
+
+	assert.True(t, RarityEpic.AtLeast(RarityRare))
+	assert.False(t, RarityUncommon.AtLeast(RarityRare))
+}
+
+func TestLootCatalogRollTheme(t *testing.T) {
+	catalog, err := ParseLootCatalog([]byte(testLootJSON))
+	require.NoError(t, err)
+	rng := rand.New(rand.NewSource(1))
+
+	// Themes without a table add nothing
+	assert.Empty(t, catalog.RollTheme(rng, ThemeCrypt, 1))
+
+	catalog.Themes = map[Theme]string{ThemeCrypt: "weapons"}
+	items := catalog.RollTheme(rng, ThemeCrypt, 1)
+	require.Len(t, items, 1)
+	assert.Equal(t, "Sword", items[0].Name)
+	assert.Empty(t, catalog.RollTheme(rng, ThemeCaverns, 1))
+}
+
+func TestLootCatalogRandomItem(t *testing.T) {
+	catalog, err := ParseLootCatalog([]byte(testLootJSON))
+	require.NoError(t, err)
+
+	item := catalog.RandomItem(rand.New(rand.NewSource(1)), 2)
+	assert.Equal(t, "Sword", item.Name)
+	assert.Equal(t, 5, item.Power)
+}
+
+func TestLootCatalogRollShop(t *testing.T) {
+	catalog, err := ParseLootCatalog([]byte(testLootJSON))
+	require.NoError(t, err)
+
+	// Without a shop table, shops stock random items
+	items := catalog.RollShop(rand.New(rand.NewSource(1)), 3)
+	require.Len(t, items, defaultShopStock)
+	assert.Equal(t, 40, items[0].Value, "Stock is scaled for the floor")
+
+	catalog.Shop = "mixed"
+	for _, item := range catalog.RollShop(rand.New(rand.NewSource(1)), 1) {
+		assert.Equal(t, "Health Potion", item.Name, "Weapons in the table only stock from floor 3")
+	}
+
+	// The built-in shops always have something to sell
+	assert.NotEmpty(t, DefaultLootCatalog().RollShop(rand.New(rand.NewSource(1)), 1))
+}
+
+func TestLootCatalogRollChest(t *testing.T) {
+	catalog, err := ParseLootCatalog([]byte(testLootJSON))
+	require.NoError(t, err)
+
+	// Without a chest table, chests hold what a treasure room would
+	assert.Empty(t, catalog.RollChest(rand.New(rand.NewSource(1)), 1), "The test catalog has no treasure table")
+	catalog.Rooms[RoomTreasure] = "weapons"
+	items := catalog.RollChest(rand.New(rand.NewSource(1)), 3)
+	require.Len(t, items, 1)
+	assert.Equal(t, "Sword", items[0].Name)
+
+	catalog.Chest = "mixed"
+	for _, item := range catalog.RollChest(rand.New(rand.NewSource(1)), 1) {
+		assert.Equal(t, "Health Potion", item.Name)
+	}
+
+	assert.NotEmpty(t, DefaultLootCatalog().RollChest(rand.New(rand.NewSource(1)), 1))
+}
+
+func TestLootCatalogExpected(t *testing.T) {
+	catalog, err := ParseLootCatalog([]byte(testLootJSON))
+	require.NoError(t, err)
+
+	odds, err := catalog.Expected("mixed", 3)
+	require.NoError(t, err)
+	require.Len(t, odds, 2)
+	assert.Equal(t, "Health Potion", odds[0].Item)
+	assert.InDelta(t, 0.75, odds[0].Expected, 1e-9)
+	assert.Equal(t, "Sword", odds[1].Item)
+	assert.InDelta(t, 0.25, odds[1].Expected, 1e-9)
+
+	// Half the time it rolls three times on average, and half its entries are empty
+	odds, err = catalog.Expected("sometimes", 1)
+	require.NoError(t, err)
+	require.Len(t, odds, 1)
+	assert.InDelta(t, 0.75, odds[0].Expected, 1e-9)
+
+	odds, err = catalog.Expected("rareWeapons", 1)
+	require.NoError(t, err)
+	assert.Equal(t, []LootOdds{{Item: "Sword", Rarity: RarityRare, Expected: 1}}, odds)
+
+	_, err = catalog.Expected("missing", 1)
+	assert.Error(t, err)
+}
+
+func TestLootCatalogExpectedMatchesRolls(t *testing.T) {
+	catalog := DefaultLootCatalog()
+	odds, err := catalog.Expected("treasure", 5)
+	require.NoError(t, err)
+
+	expected := 0.0
+	for _, odd := range odds {
+		expected += odd.Expected
+	}
+
+	rng := rand.New(rand.NewSource(7))
+	dropped := 0
+	const trials = 2000
+	for i := 0; i < trials; i++ {
+		dropped += len(catalog.Roll(rng, "treasure", 5))
+	}
+	assert.InDelta(t, expected, float64(dropped)/trials, 0.1)
+}
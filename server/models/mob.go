@@ -1,6 +1,8 @@
 package models
 
 import (
+	"strings"
+
 	"github.com/google/uuid"
 )
 
@@ -50,182 +52,32 @@ type Mob struct {
 	Position  Position   `json:"position"`
 	Symbol    string     `json:"symbol"`
 	Color     string     `json:"color"`
+
+	StatusEffects StatusEffects `json:"statusEffects,omitempty"`
+	Alerted       *Position     `json:"alerted,omitempty"` // Where an alarm called the mob to
+	Boss          *BossState    `json:"boss,omitempty"`    // How far a boss has got through its fight
 }
 
-// NewMob creates a new mob based on type, variant, and floor level
+// NewMob creates a new mob based on type, variant, and floor level using the
+// loaded monster definitions
 func NewMob(mobType MobType, variant MobVariant, floorLevel int) *Mob {
-	// Base stats that will be modified by variant and floor level
-	baseHP := 10
-	baseDamage := 2
-	baseDefense := 0
-	baseAC := 10
-	baseDexterity := 10
-	baseGoldValue := 5
-	symbol := "m"
-	color := "#FF0000" // Default red
-
-	// Adjust base stats based on mob type
-	switch mobType {
-	case MobSkeleton:
-		baseHP = 8
-		baseDamage = 3
-		baseAC = 12
-		baseDexterity = 8
-		symbol = "s"
-		color = "#FFFFFF" // White
-	case MobGoblin:
-		baseHP = 6
-		baseDamage = 2
-		baseAC = 11
-		baseDexterity = 14
-		symbol = "g"
-		color = "#00FF00" // Green
-	case MobTroll:
-		baseHP = 20
-		baseDamage = 4
-		baseDefense = 2
-		baseAC = 14
-		baseDexterity = 8
-		symbol = "T"
-		color = "#008000" // Dark green
-	case MobOrc:
-		baseHP = 12
-		baseDamage = 3
-		baseDefense = 1
-		baseAC = 13
-		baseDexterity = 10
-		symbol = "o"
-		color = "#808000" // Olive
-	case MobOgre:
-		baseHP = 25
-		baseDamage = 5
-		baseDefense = 1
-		baseAC = 15
-		baseDexterity = 6
-		symbol = "O"
-		color = "#800080" // Purple
-	case MobWraith:
-		baseHP = 15
-		baseDamage = 6
-		baseAC = 13
-		baseDexterity = 16
-		symbol = "W"
-		color = "#000080" // Navy
-	case MobLich:
-		baseHP = 30
-		baseDamage = 8
-		baseDefense = 3
-		baseAC = 16
-		baseDexterity = 12
-		symbol = "L"
-		color = "#800000" // Maroon
-	case MobOoze:
-		baseHP = 18
-		baseDamage = 3
-		baseDefense = 4
-		baseAC = 8
-		baseDexterity = 4
-		symbol = "j"
-		color = "#008080" // Teal
-	case MobRatman:
-		baseHP = 7
-		baseDamage = 2
-		baseAC = 12
-		baseDexterity = 15
-		symbol = "r"
-		color = "#808080" // Gray
-	case MobDrake:
-		baseHP = 22
-		baseDamage = 6
-		baseDefense = 2
-		baseAC = 15
-		baseDexterity = 12
-		symbol = "d"
-		color = "#FF8000" // Orange
-	case MobDragon:
-		baseHP = 40
-		baseDamage = 10
-		baseDefense = 5
-		baseAC = 18
-		baseDexterity = 10
-		symbol = "D"
-		color = "#FF0000" // Red
-	case MobElemental:
-		baseHP = 20
-		baseDamage = 7
-		baseDefense = 2
-		baseAC = 14
-		baseDexterity = 14
-		symbol = "E"
-		color = "#0000FF" // Blue
-	case MobShopkeeper:
-		baseHP = 10
-		baseDamage = 2
-		baseDefense = 0
-		baseAC = 10
-		baseDexterity = 10
-		baseGoldValue = 5
-		symbol = "S"
-		color = "#FF0000" // Red
-	}
-
-	// Adjust stats based on variant
-	variantMultiplier := 1.0
-	switch variant {
-	case VariantEasy:
-		variantMultiplier = 0.8
-		baseGoldValue = int(float64(baseGoldValue) * 0.7)
-	case VariantNormal:
-		variantMultiplier = 1.0
-	case VariantHard:
-		variantMultiplier = 1.3
-		baseGoldValue = int(float64(baseGoldValue) * 1.5)
-	case VariantBoss:
-		variantMultiplier = 2.0
-		baseGoldValue = int(float64(baseGoldValue) * 3.0)
-		symbol = string([]rune(symbol)[0] - 32) // Convert to uppercase
-	}
-
-	// Adjust stats based on floor level (deeper floors have stronger mobs)
-	floorMultiplier := 1.0 + (float64(floorLevel-1) * 0.2)
-
-	// Calculate final stats
-	finalHP := int(float64(baseHP) * variantMultiplier * floorMultiplier)
-	finalDamage := int(float64(baseDamage) * variantMultiplier * floorMultiplier)
-	finalDefense := int(float64(baseDefense) * variantMultiplier * floorMultiplier)
-	finalAC := int(float64(baseAC) * variantMultiplier)
-	finalDexterity := baseDexterity // Dexterity doesn't scale with level
-	finalGoldValue := int(float64(baseGoldValue) * variantMultiplier * floorMultiplier)
+	return Monsters().NewMob(mobType, variant, floorLevel)
+}
 
-	// Generate a name based on type and variant
-	name := string(mobType)
-	if variant == VariantBoss {
-		name = "Boss " + name
-	}
+// newMobID generates a unique mob ID
+func newMobID() string {
+	return uuid.New().String()
+}
 
-	return &Mob{
-		ID:        uuid.New().String(),
-		Type:      mobType,
-		Variant:   variant,
-		Name:      name,
-		Level:     floorLevel,
-		HP:        finalHP,
-		MaxHP:     finalHP,
-		Damage:    finalDamage,
-		Defense:   finalDefense,
-		AC:        finalAC,
-		Dexterity: finalDexterity,
-		GoldValue: finalGoldValue,
-		Position:  Position{X: 0, Y: 0}, // Will be set when placed on the map
-		Symbol:    symbol,
-		Color:     color,
-	}
+// bossSymbol returns the symbol used for the boss variant of a monster
+func bossSymbol(symbol string) string {
+	return strings.ToUpper(symbol)
 }
 
 // CalculateAC calculates the total armor class of the mob
 func (m *Mob) CalculateAC() int {
-	// Base AC from the mob's natural armor
-	totalAC := m.AC
+	// Base AC from the mob's natural armor, changed by status effects
+	totalAC := m.AC + m.StatusEffects.Modifiers().AC
 
 	// Add dexterity modifier
 	dexModifier := (m.Dexterity - 10) / 2
@@ -247,6 +99,9 @@ func (m *Mob) CalculateHitChance(targetAC int) float64 {
 	// Add damage as a factor (stronger mobs are more accurate)
 	attackBonus += m.Damage / 3
 
+	// Add accuracy from status effects
+	attackBonus += m.StatusEffects.Modifiers().Accuracy
+
 	// Calculate hit chance: base + (attack bonus - (targetAC - 10)) * 0.05
 	// This means each point of difference changes hit chance by 5%
 	// We subtract 10 from targetAC because 10 is the base AC
@@ -261,3 +116,8 @@ func (m *Mob) CalculateHitChance(targetAC int) float64 {
 
 	return hitChance
 }
+
+// CalculateDamage calculates the damage of the mob's attacks including status effects
+func (m *Mob) CalculateDamage() int {
+	return max(m.Damage+m.StatusEffects.Modifiers().Damage, 0)
+}
@@ -0,0 +1,347 @@
+package models
+
+import (
+	"bytes"
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand"
+	"os"
+	"regexp"
+	"sync/atomic"
+	"unicode/utf8"
+)
+
+// defaultMonstersJSON holds the monster definitions the server ships with
+//
+//go:embed data/monsters.json
+var defaultMonstersJSON []byte
+
+// colorPattern matches the #RRGGBB colors the client understands
+var colorPattern = regexp.MustCompile(`^#[0-9A-Fa-f]{6}$`)
+
+// MonsterDefinition describes a type of monster before variant and depth scaling
+type MonsterDefinition struct {
+	Type      MobType `json:"type"`
+	Name      string  `json:"name,omitempty"` // Display name; defaults to the type
+	Symbol    string  `json:"symbol"`
+	Color     string  `json:"color"`
+	HP        int     `json:"hp"`
+	Damage    int     `json:"damage"`
+	Defense   int     `json:"defense"`
+	AC        int     `json:"ac"`
+	Dexterity int     `json:"dexterity"`
+	Gold      int     `json:"gold"`
+	XP        int     `json:"xp"`                  // Experience for killing a normal variant
+	MinDepth  int     `json:"minDepth,omitempty"`  // Shallowest floor it spawns on at random; 0 means never
+	MaxDepth  int     `json:"maxDepth,omitempty"`  // Deepest floor it spawns on at random; 0 means no limit
+	LootTable string  `json:"lootTable,omitempty"` // Loot table rolled when it dies
+
+	OnHit       *StatusEffect `json:"onHit,omitempty"`       // Status effect its hits can inflict
+	OnHitChance float64       `json:"onHitChance,omitempty"` // Chance a hit inflicts it; 0 means always
+
+	Boss *BossDefinition `json:"boss,omitempty"` // How it fights when it spawns as a boss
+}
+
+// VariantModifier scales a monster's stats, gold and experience for a variant
+type VariantModifier struct {
+	Stats float64 `json:"stats"`
+	Gold  float64 `json:"gold"`
+	XP    float64 `json:"xp"`
+}
+
+// MonsterCatalog holds the monster definitions loaded at startup
+type MonsterCatalog struct {
+	Variants map[MobVariant]VariantModifier `json:"variants"`
+	Monsters []*MonsterDefinition           `json:"monsters"`
+
+	byType map[MobType]*MonsterDefinition
+}
+
+// fallbackMonster is used for mob types the catalog doesn't define
+var fallbackMonster = MonsterDefinition{
+	Symbol:    "m",
+	Color:     "#FF0000",
+	HP:        10,
+	Damage:    2,
+	AC:        10,
+	Dexterity: 10,
+	Gold:      5,
+	XP:        10,
+}
+
+// monsters is the catalog NewMob uses
+var monsters atomic.Pointer[MonsterCatalog]
+
+func init() {
+	catalog, err := ParseMonsterCatalog(defaultMonstersJSON)
+	if err != nil {
+		panic(fmt.Sprintf("invalid built-in monster definitions: %v", err))
+	}
+	monsters.Store(catalog)
+}
+
+// Monsters returns the monster catalog in use
+func Monsters() *MonsterCatalog {
+	return monsters.Load()
+}
+
+// SetMonsterCatalog replaces the monster catalog used to create mobs
+func SetMonsterCatalog(catalog *MonsterCatalog) {
+	monsters.Store(catalog)
+}
+
+// DefaultMonsterCatalog returns a fresh copy of the built-in monster definitions
+func DefaultMonsterCatalog() *MonsterCatalog {
+	catalog, err := ParseMonsterCatalog(defaultMonstersJSON)
+	if err != nil {
+		panic(fmt.Sprintf("invalid built-in monster definitions: %v", err))
+	}
+	return catalog
+}
+
+// LoadMonsterCatalog reads and validates monster definitions from a JSON file
+func LoadMonsterCatalog(path string) (*MonsterCatalog, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	catalog, err := ParseMonsterCatalog(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return catalog, nil
+}
+
+// ParseMonsterCatalog decodes and validates monster definitions
+func ParseMonsterCatalog(data []byte) (*MonsterCatalog, error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+
+	var catalog MonsterCatalog
+	if err := decoder.Decode(&catalog); err != nil {
+		return nil, fmt.Errorf("invalid monster definitions: %w", err)
+	}
+
+	if err := catalog.Validate(); err != nil {
+		return nil, err
+	}
+
+	catalog.byType = make(map[MobType]*MonsterDefinition, len(catalog.Monsters))
+	for _, definition := range catalog.Monsters {
+		catalog.byType[definition.Type] = definition
+	}
+	return &catalog, nil
+}
+
+// Validate checks every definition and variant, reporting all problems at once
+func (c *MonsterCatalog) Validate() error {
+	var errs []error
+
+	for _, variant := range []MobVariant{VariantEasy, VariantNormal, VariantHard, VariantBoss} {
+		if _, exists := c.Variants[variant]; !exists {
+			errs = append(errs, fmt.Errorf("variant %q is not defined", variant))
+		}
+	}
+	for variant, modifier := range c.Variants {
+		switch variant {
+		case VariantEasy, VariantNormal, VariantHard, VariantBoss:
+		default:
+			errs = append(errs, fmt.Errorf("variant %q is unknown", variant))
+		}
+		if modifier.Stats <= 0 || modifier.Gold < 0 || modifier.XP < 0 {
+			errs = append(errs, fmt.Errorf("variant %q: stats must be positive and gold and xp can't be negative", variant))
+		}
+	}
+
+	if len(c.Monsters) == 0 {
+		errs = append(errs, errors.New("no monsters are defined"))
+	}
+	seen := make(map[MobType]bool)
+	for i, definition := range c.Monsters {
+		if definition == nil || definition.Type == "" {
+			errs = append(errs, fmt.Errorf("monster %d: type is required", i))
+			continue
+		}
+		if seen[definition.Type] {
+			errs = append(errs, fmt.Errorf("monster %q is defined more than once", definition.Type))
+		}
+		seen[definition.Type] = true
+
+		if err := definition.validate(); err != nil {
+			errs = append(errs, fmt.Errorf("monster %q: %w", definition.Type, err))
+		}
+	}
+
+	// Bosses can only summon monsters the catalog defines
+	for _, definition := range c.Monsters {
+		if definition == nil || definition.Boss == nil {
+			continue
+		}
+		for _, phase := range definition.Boss.Phases {
+			if phase.Summon != "" && !seen[phase.Summon] {
+				errs = append(errs, fmt.Errorf("monster %q: boss phase %q summons undefined monster %q", definition.Type, phase.Name, phase.Summon))
+			}
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// validate checks a single definition
+func (d *MonsterDefinition) validate() error {
+	var errs []error
+
+	if utf8.RuneCountInString(d.Symbol) != 1 {
+		errs = append(errs, errors.New("symbol must be a single character"))
+	}
+	if !colorPattern.MatchString(d.Color) {
+		errs = append(errs, errors.New("color must look like #RRGGBB"))
+	}
+	if d.HP <= 0 {
+		errs = append(errs, errors.New("hp must be positive"))
+	}
+	if d.AC <= 0 || d.Dexterity <= 0 {
+		errs = append(errs, errors.New("ac and dexterity must be positive"))
+	}
+	if d.Damage < 0 || d.Defense < 0 || d.Gold < 0 || d.XP < 0 {
+		errs = append(errs, errors.New("damage, defense, gold and xp can't be negative"))
+	}
+	if d.MinDepth < 0 || d.MaxDepth < 0 {
+		errs = append(errs, errors.New("depths can't be negative"))
+	}
+	if d.MaxDepth > 0 && (d.MinDepth == 0 || d.MaxDepth < d.MinDepth) {
+		errs = append(errs, errors.New("maxDepth needs a minDepth no deeper than it"))
+	}
+	if d.OnHit != nil {
+		if err := d.OnHit.validate(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if d.OnHitChance < 0 || d.OnHitChance > 1 {
+		errs = append(errs, errors.New("onHitChance must be between 0 and 1"))
+	}
+	if d.Boss != nil {
+		if err := d.Boss.validate(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// Definition returns the definition for a mob type
+func (c *MonsterCatalog) Definition(mobType MobType) (*MonsterDefinition, bool) {
+	definition, exists := c.byType[mobType]
+	return definition, exists
+}
+
+// Variant returns the modifier for a variant. Unknown variants are not scaled.
+func (c *MonsterCatalog) Variant(variant MobVariant) VariantModifier {
+	if modifier, exists := c.Variants[variant]; exists {
+		return modifier
+	}
+	return VariantModifier{Stats: 1, Gold: 1, XP: 1}
+}
+
+// SpawnableAt returns the mob types that spawn at random on a floor, in catalog order
+func (c *MonsterCatalog) SpawnableAt(floorLevel int) []MobType {
+	types := make([]MobType, 0)
+	for _, definition := range c.Monsters {
+		if definition.MinDepth == 0 || floorLevel < definition.MinDepth {
+			continue
+		}
+		if definition.MaxDepth > 0 && floorLevel > definition.MaxDepth {
+			continue
+		}
+		types = append(types, definition.Type)
+	}
+	return types
+}
+
+// Experience returns the experience a mob of the given type and variant is worth
+func (c *MonsterCatalog) Experience(mobType MobType, variant MobVariant) int {
+	definition := c.definitionOrFallback(mobType)
+	return int(float64(definition.XP) * c.Variant(variant).XP)
+}
+
+// NewMob creates a mob from its definition, scaled for its variant and floor level
+func (c *MonsterCatalog) NewMob(mobType MobType, variant MobVariant, floorLevel int) *Mob {
+	definition := c.definitionOrFallback(mobType)
+	modifier := c.Variant(variant)
+
+	symbol := definition.Symbol
+	name := definition.Name
+	if name == "" {
+		name = string(mobType)
+	}
+	if variant == VariantBoss {
+		symbol = bossSymbol(symbol)
+		name = "Boss " + name
+	}
+
+	// Deeper floors have stronger mobs
+	floorMultiplier := floorMultiplier(floorLevel)
+	gold := int(float64(definition.Gold) * modifier.Gold)
+
+	mob := &Mob{
+		ID:        newMobID(),
+		Type:      mobType,
+		Variant:   variant,
+		Name:      name,
+		Level:     floorLevel,
+		HP:        int(float64(definition.HP) * modifier.Stats * floorMultiplier),
+		MaxHP:     int(float64(definition.HP) * modifier.Stats * floorMultiplier),
+		Damage:    int(float64(definition.Damage) * modifier.Stats * floorMultiplier),
+		Defense:   int(float64(definition.Defense) * modifier.Stats * floorMultiplier),
+		AC:        int(float64(definition.AC) * modifier.Stats),
+		Dexterity: definition.Dexterity, // Dexterity doesn't scale with level
+		GoldValue: int(float64(gold) * modifier.Stats * floorMultiplier),
+		Position:  Position{X: 0, Y: 0}, // Will be set when placed on the map
+		Symbol:    symbol,
+		Color:     definition.Color,
+	}
+	if variant == VariantBoss {
+		mob.Boss = &BossState{}
+	}
+	return mob
+}
+
+// Boss returns how a mob type fights as a boss, falling back to a generic
+// two-phase fight for monsters without a boss definition
+func (c *MonsterCatalog) Boss(mobType MobType) *BossDefinition {
+	if definition, exists := c.byType[mobType]; exists && definition.Boss != nil {
+		return definition.Boss
+	}
+	return &fallbackBoss
+}
+
+// floorMultiplier scales a monster's stats for the floor it is on
+func floorMultiplier(floorLevel int) float64 {
+	return 1.0 + (float64(floorLevel-1) * 0.2)
+}
+
+// RollOnHit rolls whether a hit by the mob inflicts its definition's status effect
+func (c *MonsterCatalog) RollOnHit(rng *rand.Rand, mob *Mob) (StatusEffect, bool) {
+	definition, exists := c.byType[mob.Type]
+	if !exists || definition.OnHit == nil {
+		return StatusEffect{}, false
+	}
+	if definition.OnHitChance > 0 && rng.Float64() >= definition.OnHitChance {
+		return StatusEffect{}, false
+	}
+
+	effect := *definition.OnHit
+	effect.Source = mob.Name
+	return effect, true
+}
+
+// definitionOrFallback returns the definition for a mob type, or generic stats if there is none
+func (c *MonsterCatalog) definitionOrFallback(mobType MobType) *MonsterDefinition {
+	if definition, exists := c.byType[mobType]; exists {
+		return definition
+	}
+	return &fallbackMonster
+}
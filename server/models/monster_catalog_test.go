@@ -0,0 +1,176 @@
+package models
+
+import (
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testMonstersJSON is a small valid catalog
+const testMonstersJSON = `{
+  "variants": {
+    "easy": {"stats": 0.5, "gold": 0.5, "xp": 0.5},
+    "normal": {"stats": 1.0, "gold": 1.0, "xp": 1.0},
+    "hard": {"stats": 1.5, "gold": 1.5, "xp": 1.5},
+    "boss": {"stats": 2.0, "gold": 3.0, "xp": 4.0}
+  },
+  "monsters": [
+    {"type": "goblin", "name": "Cave Goblin", "symbol": "g", "color": "#00FF00", "hp": 10, "damage": 4, "defense": 1, "ac": 11, "dexterity": 14, "gold": 10, "xp": 20, "minDepth": 1, "maxDepth": 4},
+    {"type": "troll", "symbol": "T", "color": "#008000", "hp": 30, "damage": 6, "defense": 2, "ac": 14, "dexterity": 8, "gold": 20, "xp": 50, "minDepth": 3},
+    {"type": "dragon", "symbol": "D", "color": "#FF0000", "hp": 50, "damage": 10, "defense": 5, "ac": 18, "dexterity": 10, "gold": 50, "xp": 100}
+  ]
+}`
+
+func TestDefaultMonsterCatalog(t *testing.T) {
+	catalog := DefaultMonsterCatalog()
+	require.NoError(t, catalog.Validate())
+
+	for _, mobType := range []MobType{MobSkeleton, MobGoblin, MobTroll, MobOrc, MobOgre, MobWraith, MobLich,
+		MobOoze, MobRatman, MobDrake, MobDragon, MobElemental, MobShopkeeper} {
+		_, exists := catalog.Definition(mobType)
+		assert.True(t, exists, "%s should be defined", mobType)
+	}
+
+	// Shopkeepers and dragons are only placed deliberately
+	assert.NotContains(t, catalog.SpawnableAt(20), MobShopkeeper)
+	assert.NotContains(t, catalog.SpawnableAt(20), MobDragon)
+}
+
+func TestParseMonsterCatalog(t *testing.T) {
+	catalog, err := ParseMonsterCatalog([]byte(testMonstersJSON))
+	require.NoError(t, err)
+
+	goblin, exists := catalog.Definition(MobGoblin)
+	require.True(t, exists)
+	assert.Equal(t, "Cave Goblin", goblin.Name)
+	assert.Equal(t, 14, goblin.Dexterity)
+
+	_, exists = catalog.Definition(MobLich)
+	assert.False(t, exists)
+}
+
+func TestParseMonsterCatalogValidation(t *testing.T) {
+	_, err := ParseMonsterCatalog([]byte(`{"variants": {}, "monsters": []}`))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), `variant "boss" is not defined`)
+	assert.Contains(t, err.Error(), "no monsters are defined")
+
+	// Every problem is reported, not just the first
+	_, err = ParseMonsterCatalog([]byte(`{
+	  "variants": {"easy": {"stats": 1}, "normal": {"stats": 1}, "hard": {"stats": 1}, "boss": {"stats": 0}},
+	  "monsters": [
+	    {"type": "goblin", "symbol": "gg", "color": "green", "hp": 0, "ac": 10, "dexterity": 10},
+	    {"type": "goblin", "symbol": "g", "color": "#00FF00", "hp": 5, "ac": 10, "dexterity": 10, "minDepth": 5, "maxDepth": 2},
+	    {"type": "ooze", "symbol": "j", "color": "#008080", "hp": 5, "ac": 10, "dexterity": 10, "onHit": {"type": "frozen", "duration": 1}, "onHitChance": 2},
+	    {"symbol": "x", "color": "#00FF00", "hp": 5, "ac": 10, "dexterity": 10}
+	  ]
+	}`))
+	require.Error(t, err)
+	for _, problem := range []string{
+		`variant "boss": stats must be positive`,
+		"symbol must be a single character",
+		"color must look like #RRGGBB",
+		"hp must be positive",
+		`monster "goblin" is defined more than once`,
+		"maxDepth needs a minDepth",
+		`status "frozen" is unknown`,
+		"onHitChance must be between 0 and 1",
+		"monster 3: type is required",
+	} {
+		assert.Contains(t, err.Error(), problem)
+	}
+
+	// Typos in field names are caught instead of silently ignored
+	_, err = ParseMonsterCatalog([]byte(`{"variants": {}, "monsters": [{"type": "goblin", "hitpoints": 5}]}`))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "hitpoints")
+}
+
+func TestMonsterCatalogRollOnHit(t *testing.T) {
+	catalog, err := ParseMonsterCatalog([]byte(`{
+	  "variants": {"easy": {"stats": 1}, "normal": {"stats": 1}, "hard": {"stats": 1}, "boss": {"stats": 1}},
+	  "monsters": [
+	    {"type": "ooze", "name": "Acid Ooze", "symbol": "j", "color": "#008080", "hp": 5, "ac": 10, "dexterity": 10, "onHit": {"type": "poison", "duration": 3, "potency": 1}},
+	    {"type": "goblin", "symbol": "g", "color": "#00FF00", "hp": 5, "ac": 10, "dexterity": 10}
+	  ]
+	}`))
+	require.NoError(t, err)
+	rng := rand.New(rand.NewSource(1))
+
+	effect, inflicted := catalog.RollOnHit(rng, catalog.NewMob(MobOoze, VariantNormal, 1))
+	require.True(t, inflicted, "A chance of 0 should always inflict the effect")
+	assert.Equal(t, StatusPoison, effect.Type)
+	assert.Equal(t, "Acid Ooze", effect.Source)
+
+	_, inflicted = catalog.RollOnHit(rng, catalog.NewMob(MobGoblin, VariantNormal, 1))
+	assert.False(t, inflicted)
+}
+
+func TestLoadMonsterCatalog(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "monsters.json")
+	require.NoError(t, os.WriteFile(path, []byte(testMonstersJSON), 0o644))
+
+	catalog, err := LoadMonsterCatalog(path)
+	require.NoError(t, err)
+	assert.Len(t, catalog.Monsters, 3)
+
+	_, err = LoadMonsterCatalog(filepath.Join(t.TempDir(), "missing.json"))
+	assert.Error(t, err)
+}
+
+func TestMonsterCatalogSpawnableAt(t *testing.T) {
+	catalog, err := ParseMonsterCatalog([]byte(testMonstersJSON))
+	require.NoError(t, err)
+
+	assert.Equal(t, []MobType{MobGoblin}, catalog.SpawnableAt(1))
+	assert.Equal(t, []MobType{MobGoblin, MobTroll}, catalog.SpawnableAt(3), "Types should be in catalog order")
+	assert.Equal(t, []MobType{MobTroll}, catalog.SpawnableAt(5), "Goblins stop spawning past their max depth")
+}
+
+func TestMonsterCatalogNewMob(t *testing.T) {
+	catalog, err := ParseMonsterCatalog([]byte(testMonstersJSON))
+	require.NoError(t, err)
+
+	goblin := catalog.NewMob(MobGoblin, VariantNormal, 1)
+	assert.Equal(t, "Cave Goblin", goblin.Name)
+	assert.Equal(t, 10, goblin.HP)
+	assert.Equal(t, 10, goblin.MaxHP)
+	assert.Equal(t, 4, goblin.Damage)
+	assert.Equal(t, 11, goblin.AC)
+	assert.Equal(t, 10, goblin.GoldValue)
+	assert.Equal(t, "g", goblin.Symbol)
+
+	// Variants and depth scale the definition
+	boss := catalog.NewMob(MobGoblin, VariantBoss, 6)
+	assert.Equal(t, "Boss Cave Goblin", boss.Name)
+	assert.Equal(t, "G", boss.Symbol)
+	assert.Equal(t, 40, boss.HP, "10 HP x2 for the boss x2 for floor 6")
+	assert.Equal(t, 22, boss.AC, "AC scales with the variant but not depth")
+	assert.Equal(t, 120, boss.GoldValue)
+
+	// Upper case symbols stay as they are for bosses
+	assert.Equal(t, "T", catalog.NewMob(MobTroll, VariantBoss, 1).Symbol)
+
+	// Types without a definition get generic stats
+	unknown := catalog.NewMob(MobLich, VariantNormal, 1)
+	assert.Equal(t, "lich", unknown.Name)
+	assert.Equal(t, 10, unknown.HP)
+
+	assert.Equal(t, 80, catalog.Experience(MobGoblin, VariantBoss))
+	assert.Equal(t, 10, catalog.Experience(MobLich, VariantNormal))
+}
+
+func TestSetMonsterCatalog(t *testing.T) {
+	original := Monsters()
+	defer SetMonsterCatalog(original)
+
+	catalog, err := ParseMonsterCatalog([]byte(testMonstersJSON))
+	require.NoError(t, err)
+	SetMonsterCatalog(catalog)
+
+	assert.Equal(t, "Cave Goblin", NewMob(MobGoblin, VariantNormal, 1).Name, "NewMob should use the loaded catalog")
+}
@@ -0,0 +1,172 @@
+package models
+
+import (
+	"errors"
+
+	"github.com/google/uuid"
+)
+
+// MaxPartySize is the most characters a party can hold
+const MaxPartySize = 4
+
+// LootRule decides who may pick up the loot from mobs a party kills
+type LootRule string
+
+const (
+	LootFreeForAll LootRule = "freeForAll" // Whoever gets there first
+	LootRoundRobin LootRule = "roundRobin" // Each item goes to the next member in turn
+	LootNeedGreed  LootRule = "needGreed"  // Members roll need, greed or pass for each item
+)
+
+// Errors returned by party actions
+var (
+	ErrAlreadyInParty  = errors.New("character is already in a party")
+	ErrNotInParty      = errors.New("character is not in a party")
+	ErrNotPartyLeader  = errors.New("only the party leader can do that")
+	ErrNotInvited      = errors.New("character has not been invited to this party")
+	ErrPartyFull       = errors.New("party is full")
+	ErrInviteSelf      = errors.New("you can't invite yourself")
+	ErrUnknownLootRule = errors.New("unknown loot rule")
+)
+
+// Party is a group of characters adventuring together
+type Party struct {
+	ID       string   `json:"id"`
+	LeaderID string   `json:"leaderId"`
+	Members  []string `json:"members"` // Character IDs in the order they joined
+	Invites  []string `json:"invites"` // Characters invited but not yet joined
+	LootRule LootRule `json:"lootRule"`
+
+	nextLooter int // Member index that gets the next round-robin item
+}
+
+// NewParty creates a party led by the given character
+func NewParty(leaderID string) *Party {
+	return &Party{
+		ID:       uuid.New().String(),
+		LeaderID: leaderID,
+		Members:  []string{leaderID},
+		Invites:  make([]string, 0),
+		LootRule: LootFreeForAll,
+	}
+}
+
+// IsLootRule checks if a loot rule is one the game knows
+func IsLootRule(rule LootRule) bool {
+	switch rule {
+	case LootFreeForAll, LootRoundRobin, LootNeedGreed:
+		return true
+	}
+	return false
+}
+
+// IsMember checks if a character is in the party
+func (p *Party) IsMember(characterID string) bool {
+	return indexOf(p.Members, characterID) >= 0
+}
+
+// IsInvited checks if a character has a pending invite to the party
+func (p *Party) IsInvited(characterID string) bool {
+	return indexOf(p.Invites, characterID) >= 0
+}
+
+// Invite adds a pending invite for a character
+func (p *Party) Invite(characterID string) error {
+	if p.IsMember(characterID) {
+		return ErrAlreadyInParty
+	}
+	if len(p.Members)+len(p.Invites) >= MaxPartySize {
+		return ErrPartyFull
+	}
+	if !p.IsInvited(characterID) {
+		p.Invites = append(p.Invites, characterID)
+	}
+	return nil
+}
+
+// Join turns a character's invite into membership
+func (p *Party) Join(characterID string) error {
+	i := indexOf(p.Invites, characterID)
+	if i < 0 {
+		return ErrNotInvited
+	}
+	p.Invites = append(p.Invites[:i:i], p.Invites[i+1:]...)
+	p.Members = append(p.Members, characterID)
+	return nil
+}
+
+// Remove takes a member or invite out of the party. A leader who leaves hands
+// the party to the longest-standing member.
+func (p *Party) Remove(characterID string) {
+	if i := indexOf(p.Invites, characterID); i >= 0 {
+		p.Invites = append(p.Invites[:i:i], p.Invites[i+1:]...)
+	}
+
+	i := indexOf(p.Members, characterID)
+	if i < 0 {
+		return
+	}
+	p.Members = append(p.Members[:i:i], p.Members[i+1:]...)
+	if i < p.nextLooter {
+		p.nextLooter--
+	}
+	if p.LeaderID == characterID && len(p.Members) > 0 {
+		p.LeaderID = p.Members[0]
+	}
+}
+
+// NextLooter picks the member the next round-robin item goes to, passing over
+// members eligible rejects. It returns "" if no member is eligible.
+func (p *Party) NextLooter(eligible func(characterID string) bool) string {
+	for range p.Members {
+		if p.nextLooter >= len(p.Members) {
+			p.nextLooter = 0
+		}
+		member := p.Members[p.nextLooter]
+		p.nextLooter++
+		if eligible(member) {
+			return member
+		}
+	}
+	return ""
+}
+
+// Copy returns a copy of the party that doesn't share its member lists
+func (p *Party) Copy() Party {
+	party := *p
+	party.Members = append([]string(nil), p.Members...)
+	party.Invites = append([]string(nil), p.Invites...)
+	return party
+}
+
+// SplitExperience divides experience between characters in proportion to their
+// level. Whatever doesn't divide evenly goes to the first character.
+func SplitExperience(exp int, characters []*Character) []int {
+	shares := make([]int, len(characters))
+	if len(characters) == 0 {
+		return shares
+	}
+
+	totalLevels := 0
+	for _, character := range characters {
+		totalLevels += max(character.Level, 1)
+	}
+
+	given := 0
+	for i, character := range characters {
+		shares[i] = exp * max(character.Level, 1) / totalLevels
+		given += shares[i]
+	}
+	shares[0] += exp - given
+	return shares
+}
+
+// indexOf returns the position of id in ids, or -1
+func indexOf(ids []string, id string) int {
+	for i, other := range ids {
+		if other == id {
+			return i
+		}
+	}
+	return -1
+}
@@ -0,0 +1,88 @@
+package models
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPartyInviteAndJoin(t *testing.T) {
+	party := NewParty("leader")
+	assert.Equal(t, []string{"leader"}, party.Members)
+	assert.Equal(t, LootFreeForAll, party.LootRule)
+
+	assert.ErrorIs(t, party.Invite("leader"), ErrAlreadyInParty)
+	assert.ErrorIs(t, party.Join("stranger"), ErrNotInvited)
+
+	require.NoError(t, party.Invite("friend"))
+	require.NoError(t, party.Invite("friend"), "Inviting twice is harmless")
+	assert.Equal(t, []string{"friend"}, party.Invites)
+
+	require.NoError(t, party.Join("friend"))
+	assert.True(t, party.IsMember("friend"))
+	assert.False(t, party.IsInvited("friend"))
+
+	// Invites count toward the size limit
+	require.NoError(t, party.Invite("third"))
+	require.NoError(t, party.Invite("fourth"))
+	assert.ErrorIs(t, party.Invite("fifth"), ErrPartyFull)
+}
+
+func TestPartyRemove(t *testing.T) {
+	party := NewParty("leader")
+	for _, id := range []string{"a", "b"} {
+		require.NoError(t, party.Invite(id))
+		require.NoError(t, party.Join(id))
+	}
+	require.NoError(t, party.Invite("invited"))
+
+	// A leader who leaves hands over to the longest-standing member
+	party.Remove("leader")
+	assert.Equal(t, []string{"a", "b"}, party.Members)
+	assert.Equal(t, "a", party.LeaderID)
+
+	party.Remove("invited")
+	assert.Empty(t, party.Invites)
+
+	// Copies don't share member lists
+	copied := party.Copy()
+	party.Remove("b")
+	assert.Equal(t, []string{"a", "b"}, copied.Members)
+}
+
+func TestPartyNextLooter(t *testing.T) {
+	party := NewParty("a")
+	for _, id := range []string{"b", "c"} {
+		require.NoError(t, party.Invite(id))
+		require.NoError(t, party.Join(id))
+	}
+
+	all := func(string) bool { return true }
+	assert.Equal(t, "a", party.NextLooter(all))
+	assert.Equal(t, "b", party.NextLooter(all))
+	assert.Equal(t, "c", party.NextLooter(all))
+	assert.Equal(t, "a", party.NextLooter(all))
+
+	// Members who aren't around are passed over
+	notB := func(id string) bool { return id != "b" }
+	assert.Equal(t, "c", party.NextLooter(notB))
+	assert.Empty(t, party.NextLooter(func(string) bool { return false }))
+}
+
+func TestSplitExperience(t *testing.T) {
+	low := NewCharacter("Low", Warrior)
+	high := NewCharacter("High", Mage)
+	high.Level = 3
+
+	// Shares follow level, with the remainder going to the first character
+	assert.Equal(t, []int{26, 75}, SplitExperience(101, []*Character{low, high}))
+	assert.Equal(t, []int{40}, SplitExperience(40, []*Character{low}))
+	assert.Empty(t, SplitExperience(40, nil))
+}
+
+func TestIsLootRule(t *testing.T) {
+	assert.True(t, IsLootRule(LootRoundRobin))
+	assert.True(t, IsLootRule(LootNeedGreed))
+	assert.False(t, IsLootRule("finders keepers"))
+}
@@ -0,0 +1,122 @@
+package models
+
+import (
+	"github.com/google/uuid"
+)
+
+// PuzzleKind is the mechanism that keeps a puzzle room's reward sealed
+type PuzzleKind string
+
+const (
+	PuzzleLevers PuzzleKind = "levers" // Every lever must be up; pulling one also flips the levers linked to it
+	PuzzlePlates PuzzleKind = "plates" // Pressure plates must be stepped on in a hidden order
+)
+
+// Lever is a lever in a puzzle room
+type Lever struct {
+	ID       string   `json:"id"`
+	Position Position `json:"position"`
+	Up       bool     `json:"up"`
+	Links    []int    `json:"links,omitempty"` // Other levers flipped when this one is pulled; never shown to players
+}
+
+// PressurePlate is a pressure plate in a puzzle room
+type PressurePlate struct {
+	ID       string   `json:"id"`
+	Position Position `json:"position"`
+	Pressed  bool     `json:"pressed"`
+}
+
+// Puzzle seals a reward alcove in a puzzle room until it is solved
+type Puzzle struct {
+	ID       string           `json:"id"`
+	RoomID   string           `json:"roomId"`
+	Kind     PuzzleKind       `json:"kind"`
+	Level    int              `json:"level"`
+	Levers   []*Lever         `json:"levers,omitempty"`
+	Plates   []*PressurePlate `json:"plates,omitempty"`
+	Sequence []int            `json:"sequence,omitempty"` // Order the plates must be pressed in; never shown to players
+	Progress int              `json:"progress"`           // Plates pressed in order so far
+	DoorID   string           `json:"doorId"`             // Sealed door to the reward alcove
+	Solved   bool             `json:"solved"`
+}
+
+// NewPuzzle creates an unsolved puzzle for a room
+func NewPuzzle(kind PuzzleKind, roomID string, level int) *Puzzle {
+	return &Puzzle{
+		ID:     uuid.New().String(),
+		RoomID: roomID,
+		Kind:   kind,
+		Level:  level,
+	}
+}
+
+// LeverAt returns the index of the lever at a position
+func (p *Puzzle) LeverAt(pos Position) (int, bool) {
+	for i, lever := range p.Levers {
+		if lever.Position == pos {
+			return i, true
+		}
+	}
+	return 0, false
+}
+
+// PlateAt returns the index of the pressure plate at a position
+func (p *Puzzle) PlateAt(pos Position) (int, bool) {
+	for i, plate := range p.Plates {
+		if plate.Position == pos {
+			return i, true
+		}
+	}
+	return 0, false
+}
+
+// PullLever flips a lever and the levers linked to it
+func (p *Puzzle) PullLever(index int) {
+	lever := p.Levers[index]
+	lever.Up = !lever.Up
+	for _, link := range lever.Links {
+		p.Levers[link].Up = !p.Levers[link].Up
+	}
+}
+
+// PressPlate presses a pressure plate. The right plate in the sequence stays down;
+// the wrong one lets every plate back up. Returns false if the plate was pressed
+// out of order.
+func (p *Puzzle) PressPlate(index int) bool {
+	if p.Progress >= len(p.Sequence) || p.Plates[index].Pressed {
+		return true
+	}
+	if p.Sequence[p.Progress] == index {
+		p.Plates[index].Pressed = true
+		p.Progress++
+		return true
+	}
+
+	for _, plate := range p.Plates {
+		plate.Pressed = false
+	}
+	p.Progress = 0
+	return false
+}
+
+// IsSolved checks if the puzzle's mechanism is in its solved state
+func (p *Puzzle) IsSolved() bool {
+	switch p.Kind {
+	case PuzzleLevers:
+		for _, lever := range p.Levers {
+			if !lever.Up {
+				return false
+			}
+		}
+		return len(p.Levers) > 0
+	case PuzzlePlates:
+		return len(p.Sequence) > 0 && p.Progress >= len(p.Sequence)
+	}
+	return false
+}
+
+// Experience returns the experience for solving the puzzle
+func (p *Puzzle) Experience() int {
+	return 25 + 10*p.Level
+}
@@ -0,0 +1,69 @@
+package models
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPuzzleLevers(t *testing.T) {
+	puzzle := NewPuzzle(PuzzleLevers, "room", 2)
+	puzzle.Levers = []*Lever{
+		{ID: "a", Position: Position{X: 1, Y: 1}, Up: true, Links: []int{1}},
+		{ID: "b", Position: Position{X: 3, Y: 1}, Up: true},
+		{ID: "c", Position: Position{X: 5, Y: 1}, Up: true, Links: []int{0, 1}},
+	}
+	assert.True(t, puzzle.IsSolved())
+
+	index, exists := puzzle.LeverAt(Position{X: 5, Y: 1})
+	require.True(t, exists)
+	assert.Equal(t, 2, index)
+	_, exists = puzzle.LeverAt(Position{X: 2, Y: 1})
+	assert.False(t, exists)
+
+	// Pulling a lever flips the levers linked to it
+	puzzle.PullLever(2)
+	assert.False(t, puzzle.Levers[0].Up)
+	assert.False(t, puzzle.Levers[1].Up)
+	assert.False(t, puzzle.Levers[2].Up)
+	assert.False(t, puzzle.IsSolved())
+
+	// Pulling it again puts them back
+	puzzle.PullLever(2)
+	assert.True(t, puzzle.IsSolved())
+
+	puzzle.PullLever(0)
+	assert.False(t, puzzle.Levers[0].Up)
+	assert.False(t, puzzle.Levers[1].Up)
+	assert.True(t, puzzle.Levers[2].Up)
+}
+
+func TestPuzzlePlates(t *testing.T) {
+	puzzle := NewPuzzle(PuzzlePlates, "room", 3)
+	for i := 0; i < 3; i++ {
+		puzzle.Plates = append(puzzle.Plates, &PressurePlate{ID: string(rune('a' + i)), Position: Position{X: i, Y: 0}})
+	}
+	puzzle.Sequence = []int{2, 0, 1}
+
+	index, exists := puzzle.PlateAt(Position{X: 1, Y: 0})
+	require.True(t, exists)
+	assert.Equal(t, 1, index)
+
+	assert.True(t, puzzle.PressPlate(2))
+	assert.True(t, puzzle.Plates[2].Pressed)
+	assert.Equal(t, 1, puzzle.Progress)
+
+	// A plate out of order lets them all back up
+	assert.False(t, puzzle.PressPlate(1))
+	assert.Zero(t, puzzle.Progress)
+	assert.False(t, puzzle.Plates[2].Pressed)
+
+	assert.True(t, puzzle.PressPlate(2))
+	assert.True(t, puzzle.PressPlate(2), "Pressing a plate that is already down changes nothing")
+	assert.True(t, puzzle.PressPlate(0))
+	assert.False(t, puzzle.IsSolved())
+	assert.True(t, puzzle.PressPlate(1))
+	assert.True(t, puzzle.IsSolved())
+	assert.Equal(t, 55, puzzle.Experience())
+}
@@ -0,0 +1,117 @@
+package models
+
+import (
+	"errors"
+	"time"
+)
+
+const (
+	SellBackPercent  = 50 // Share of an item's value a shopkeeper pays for it
+	HaggleDiscount   = 20 // Percent off every price after a successful Persuasion check
+	HaggleDifficulty = 15 // Persuasion DC to talk a shopkeeper down
+)
+
+// Errors returned by shop actions
+var (
+	ErrNotInStock     = errors.New("the shopkeeper doesn't have that item")
+	ErrNotEnoughGold  = errors.New("you can't afford that")
+	ErrTooHeavy       = errors.New("you can't carry that much weight")
+	ErrNotInInventory = errors.New("you don't have that item")
+	ErrItemEquipped   = errors.New("unequip that item before selling it")
+	ErrWorthlessItem  = errors.New("the shopkeeper has no use for that")
+	ErrAlreadyHaggled = errors.New("the shopkeeper won't haggle with you again until they restock")
+)
+
+// Shop is the stock of a shop room and who has haggled with its shopkeeper
+type Shop struct {
+	RoomID      string          `json:"roomId"`
+	Level       int             `json:"level"` // Floor the shop is on, which scales its stock
+	Stock       []*Item         `json:"stock"`
+	RestockedAt time.Time       `json:"restockedAt"`
+	Haggled     map[string]bool `json:"haggled,omitempty"` // Characters who haggled since the last restock, and whether it worked
+}
+
+// NewShop creates an empty shop for a room
+func NewShop(roomID string, level int) *Shop {
+	return &Shop{
+		RoomID:  roomID,
+		Level:   level,
+		Stock:   make([]*Item, 0),
+		Haggled: make(map[string]bool),
+	}
+}
+
+// Restock replaces the shop's stock and lets everyone haggle again
+func (s *Shop) Restock(stock []*Item, now time.Time) {
+	s.Stock = stock
+	s.RestockedAt = now
+	s.Haggled = make(map[string]bool)
+}
+
+// Find returns the stocked item with the given ID
+func (s *Shop) Find(itemID string) (*Item, bool) {
+	for _, item := range s.Stock {
+		if item.ID == itemID {
+			return item, true
+		}
+	}
+	return nil, false
+}
+
+// Take removes an item from the stock
+func (s *Shop) Take(itemID string) (*Item, bool) {
+	for i, item := range s.Stock {
+		if item.ID == itemID {
+			s.Stock = append(s.Stock[:i], s.Stock[i+1:]...)
+			return item, true
+		}
+	}
+	return nil, false
+}
+
+// Add puts an item a player sold into the stock until the next restock
+func (s *Shop) Add(item *Item) {
+	item.Equipped = false
+	item.ReservedFor = ""
+	s.Stock = append(s.Stock, item)
+}
+
+// HasHaggled checks if a character has haggled since the last restock
+func (s *Shop) HasHaggled(characterID string) bool {
+	_, haggled := s.Haggled[characterID]
+	return haggled
+}
+
+// Discount returns the percent a character gets off the shop's prices
+func (s *Shop) Discount(characterID string) int {
+	if s.Haggled[characterID] {
+		return HaggleDiscount
+	}
+	return 0
+}
+
+// BuyPrice returns what a character pays for an item, never less than 1 gold
+func (s *Shop) BuyPrice(item *Item, characterID string) int {
+	return max(item.Value*(100-s.Discount(characterID))/100, 1)
+}
+
+// SellPrice returns what a shopkeeper pays for an item
+func SellPrice(item *Item) int {
+	return item.Value * SellBackPercent / 100
+}
+
+// Haggle has a character try to talk the shopkeeper down with a Persuasion check.
+// Each character gets one try per restock.
+func (s *Shop) Haggle(character *Character) (bool, error) {
+	if s.HasHaggled(character.ID) {
+		return false, ErrAlreadyHaggled
+	}
+	if s.Haggled == nil {
+		s.Haggled = make(map[string]bool)
+	}
+
+	success := character.Skills != nil &&
+		character.Skills.PerformSkillCheck(SkillPersuasion, character.Attributes, HaggleDifficulty)
+	s.Haggled[character.ID] = success
+	return success, nil
+}
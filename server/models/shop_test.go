@@ -0,0 +1,82 @@
+package models
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestShopStock(t *testing.T) {
+	shop := NewShop("room", 2)
+	sword := NewWeapon("Sword", 5, 40, 1, nil)
+	potion := NewPotion("Health Potion", 10, 10)
+	shop.Restock([]*Item{sword, potion}, time.Now())
+
+	item, exists := shop.Find(potion.ID)
+	require.True(t, exists)
+	assert.Same(t, potion, item)
+
+	taken, exists := shop.Take(sword.ID)
+	require.True(t, exists)
+	assert.Same(t, sword, taken)
+	_, exists = shop.Find(sword.ID)
+	assert.False(t, exists)
+	_, exists = shop.Take(sword.ID)
+	assert.False(t, exists)
+
+	// Sold items are stocked, no longer equipped or reserved
+	sword.Equipped = true
+	sword.ReservedFor = "someone"
+	shop.Add(sword)
+	assert.Len(t, shop.Stock, 2)
+	assert.False(t, sword.Equipped)
+	assert.Empty(t, sword.ReservedFor)
+}
+
+func TestShopPrices(t *testing.T) {
+	shop := NewShop("room", 1)
+	sword := NewWeapon("Sword", 5, 45, 1, nil)
+	trinket := NewPotion("Trinket", 0, 1)
+
+	assert.Equal(t, 45, shop.BuyPrice(sword, "buyer"))
+	assert.Equal(t, 22, SellPrice(sword), "Shopkeepers pay half")
+	assert.Equal(t, 0, SellPrice(trinket))
+
+	shop.Haggled["buyer"] = true
+	shop.Haggled["loser"] = false
+	assert.Equal(t, 36, shop.BuyPrice(sword, "buyer"))
+	assert.Equal(t, 1, shop.BuyPrice(trinket, "buyer"), "Nothing is free")
+	assert.Equal(t, 45, shop.BuyPrice(sword, "loser"), "A failed haggle gets no discount")
+}
+
+func TestShopHaggle(t *testing.T) {
+	original := randomRoll
+	defer func() { randomRoll = original }()
+
+	shop := NewShop("room", 1)
+	bard := NewCharacter("Bard", Bard)
+	warrior := NewCharacter("Warrior", Warrior)
+
+	randomRoll = func(int) int { return 19 } // A natural 20
+	success, err := shop.Haggle(bard)
+	require.NoError(t, err)
+	assert.True(t, success)
+	assert.Equal(t, HaggleDiscount, shop.Discount(bard.ID))
+	assert.Positive(t, bard.Skills.SkillList[SkillPersuasion].Experience, "Haggling trains Persuasion")
+
+	randomRoll = func(int) int { return 0 } // A natural 1
+	success, err = shop.Haggle(warrior)
+	require.NoError(t, err)
+	assert.False(t, success)
+	assert.Zero(t, shop.Discount(warrior.ID))
+
+	// One try each until the shop restocks
+	_, err = shop.Haggle(warrior)
+	assert.ErrorIs(t, err, ErrAlreadyHaggled)
+
+	shop.Restock(nil, time.Now())
+	assert.False(t, shop.HasHaggled(warrior.ID))
+	assert.Zero(t, shop.Discount(bard.ID), "Discounts end when the shop restocks")
+}
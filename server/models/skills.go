@@ -208,22 +208,11 @@ func (s *Skills) PerformSkillCheck(skillType SkillType, attrs Attributes, diffic
 		return false
 	}
 
-	// Get the attribute modifiers
-	attrInfo, exists := SkillAttribute[skillType]
+	totalBonus, exists := s.checkBonus(skillType, attrs)
 	if !exists {
 		return false
 	}
 
-	primaryAttr := GetAttributeValue(attrs, attrInfo.Primary)
-	secondaryAttr := GetAttributeValue(attrs, attrInfo.Secondary)
-
-	// Calculate primary and secondary attribute modifiers
-	primaryMod := GetModifier(primaryAttr)
-	secondaryMod := GetModifier(secondaryAttr) / 2 // Secondary attribute has half effect
-
-	// Calculate total bonus: skill bonus + primary modifier + half of secondary modifier
-	totalBonus := s.GetSkillBonus(skillType) + primaryMod + secondaryMod
-
 	// Roll a d20 + bonus and compare to DC
 	roll := randomRoll(20) + 1 // 1-20
 	result := roll + totalBonus
@@ -252,6 +241,31 @@ func (s *Skills) PerformSkillCheck(skillType SkillType, attrs Attributes, diffic
 	return result >= difficultyClass
 }
 
+// PassiveScore returns the result of a skill check made without rolling: 10 plus the
+// bonus a roll would get. It is used for things a character notices without trying,
+// and doesn't train the skill.
+func (s *Skills) PassiveScore(skillType SkillType, attrs Attributes) int {
+	if _, exists := s.SkillList[skillType]; !exists {
+		return 0
+	}
+	bonus, _ := s.checkBonus(skillType, attrs)
+	return 10 + bonus
+}
+
+// checkBonus returns what a skill check adds to the roll: the skill bonus, the primary
+// attribute modifier and half the secondary attribute modifier
+func (s *Skills) checkBonus(skillType SkillType, attrs Attributes) (int, bool) {
+	attrInfo, exists := SkillAttribute[skillType]
+	if !exists {
+		return 0, false
+	}
+
+	primaryMod := GetModifier(GetAttributeValue(attrs, attrInfo.Primary))
+	secondaryMod := GetModifier(GetAttributeValue(attrs, attrInfo.Secondary)) / 2 // Secondary attribute has half effect
+
+	return s.GetSkillBonus(skillType) + primaryMod + secondaryMod, true
+}
+
 // GetSkillCheckDifficulty returns a descriptive string for a difficulty class
 func GetSkillCheckDifficulty(dc int) string {
 	switch {
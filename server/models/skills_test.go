@@ -117,6 +117,25 @@ func TestSkillChecks(t *testing.T) {
 	}
 }
 
+func TestPassiveScore(t *testing.T) {
+	attrs := Attributes{
+		Strength:     14, // +2 modifier
+		Dexterity:    16, // +3 modifier
+		Constitution: 12, // +1 modifier
+		Intelligence: 10, // +0 modifier
+		Wisdom:       8,  // -1 modifier
+		Charisma:     10, // +0 modifier
+	}
+
+	skills := NewSkills(Warrior)
+	skills.SkillList[SkillMelee].Level = 5      // +2 bonus
+	skills.SkillList[SkillPerception].Level = 1 // +0 bonus
+
+	assert.Equal(t, 15, skills.PassiveScore(SkillMelee, attrs), "10 + 2 (skill) + 2 (STR) + 1 (DEX/2)")
+	assert.Equal(t, 9, skills.PassiveScore(SkillPerception, attrs), "10 + 0 (skill) - 1 (WIS) + 0 (INT/2)")
+	assert.Equal(t, 0, skills.PassiveScore(SkillType("juggling"), attrs), "Unknown skills have no passive score")
+}
+
 func TestSkillLeveling(t *testing.T) {
 	// Create skills
 	skills := NewSkills(Warrior)
@@ -0,0 +1,208 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+)
+
+// StatusType is a kind of lasting effect on a character or mob
+type StatusType string
+
+const (
+	StatusPoison       StatusType = "poison"
+	StatusBurn         StatusType = "burn"
+	StatusStun         StatusType = "stun"
+	StatusRegeneration StatusType = "regeneration"
+	StatusHaste        StatusType = "haste"
+)
+
+// StackRule decides what happens when an effect is applied to a target that already has it
+type StackRule string
+
+const (
+	StackRefresh   StackRule = "refresh"   // Keep one copy with the longer duration and stronger potency
+	StackIntensity StackRule = "intensity" // Add a stack, up to MaxStacks, and refresh the duration
+)
+
+// StatusEffect is an effect lasting a number of turns
+type StatusEffect struct {
+	Type     StatusType `json:"type"`
+	Duration int        `json:"duration"`         // Turns left
+	Potency  int        `json:"potency"`          // Damage or healing per turn for each stack
+	Stacks   int        `json:"stacks,omitempty"` // Defaults to 1
+	Source   string     `json:"source,omitempty"` // What applied the effect
+}
+
+// StatModifiers are changes to combat stats
+type StatModifiers struct {
+	AC       int `json:"ac,omitempty"`
+	Accuracy int `json:"accuracy,omitempty"` // Added to the attack bonus for hit chance
+	Damage   int `json:"damage,omitempty"`
+}
+
+// StatusTurn is what status effects did to their target in one turn
+type StatusTurn struct {
+	Damage  int          `json:"damage,omitempty"`
+	Healing int          `json:"healing,omitempty"`
+	Expired []StatusType `json:"expired,omitempty"`
+}
+
+// StatusDefinition describes how a type of status effect behaves
+type StatusDefinition struct {
+	Stacking  StackRule
+	MaxStacks int
+	SkipsTurn bool                                    // The target loses its turns while affected
+	Modifiers func(effect StatusEffect) StatModifiers // Stat changes while active
+	OnTurn    func(effect StatusEffect) StatusTurn    // Runs once each turn before the duration counts down
+}
+
+// StatusDefinitions holds the behaviour of every status type
+var StatusDefinitions = map[StatusType]StatusDefinition{
+	StatusPoison: {
+		Stacking:  StackIntensity,
+		MaxStacks: 5,
+		Modifiers: func(effect StatusEffect) StatModifiers { return StatModifiers{Damage: -effect.stacks()} },
+		OnTurn:    func(effect StatusEffect) StatusTurn { return StatusTurn{Damage: effect.Potency * effect.stacks()} },
+	},
+	StatusBurn: {
+		Stacking:  StackRefresh,
+		Modifiers: func(effect StatusEffect) StatModifiers { return StatModifiers{AC: -1} },
+		OnTurn:    func(effect StatusEffect) StatusTurn { return StatusTurn{Damage: effect.Potency} },
+	},
+	StatusStun: {
+		Stacking:  StackRefresh,
+		SkipsTurn: true,
+		Modifiers: func(effect StatusEffect) StatModifiers { return StatModifiers{AC: -4} },
+	},
+	StatusRegeneration: {
+		Stacking: StackRefresh,
+		OnTurn:   func(effect StatusEffect) StatusTurn { return StatusTurn{Healing: effect.Potency} },
+	},
+	StatusHaste: {
+		Stacking:  StackRefresh,
+		Modifiers: func(effect StatusEffect) StatModifiers { return StatModifiers{AC: 2, Accuracy: 2} },
+	},
+}
+
+// stacks returns the number of stacks of the effect
+func (e StatusEffect) stacks() int {
+	return max(e.Stacks, 1)
+}
+
+// validate checks an effect given in a data file
+func (e StatusEffect) validate() error {
+	var errs []error
+	if _, exists := StatusDefinitions[e.Type]; !exists {
+		errs = append(errs, fmt.Errorf("status %q is unknown", e.Type))
+	}
+	if e.Duration <= 0 {
+		errs = append(errs, errors.New("status duration must be positive"))
+	}
+	if e.Potency < 0 || e.Stacks < 0 {
+		errs = append(errs, errors.New("status potency and stacks can't be negative"))
+	}
+	return errors.Join(errs...)
+}
+
+// StatusEffects are the effects active on a character or mob
+type StatusEffects []StatusEffect
+
+// Apply adds an effect following its type's stacking rule and returns the effect as it now stands.
+// The effects are copied rather than changed in place, so copies of the target being sent
+// to clients don't change underneath them.
+func (s *StatusEffects) Apply(effect StatusEffect) StatusEffect {
+	definition := StatusDefinitions[effect.Type]
+	effect.Stacks = effect.stacks()
+	*s = append(make(StatusEffects, 0, len(*s)+1), *s...)
+
+	for i := range *s {
+		existing := &(*s)[i]
+		if existing.Type != effect.Type {
+			continue
+		}
+
+		if definition.Stacking == StackIntensity {
+			existing.Stacks = min(existing.stacks()+effect.Stacks, max(definition.MaxStacks, 1))
+		}
+		existing.Duration = max(existing.Duration, effect.Duration)
+		existing.Potency = max(existing.Potency, effect.Potency)
+		existing.Source = effect.Source
+		return *existing
+	}
+
+	if definition.Stacking == StackIntensity {
+		effect.Stacks = min(effect.Stacks, max(definition.MaxStacks, 1))
+	}
+	*s = append(*s, effect)
+	return effect
+}
+
+// Has checks if an effect of the given type is active
+func (s StatusEffects) Has(statusType StatusType) bool {
+	for _, effect := range s {
+		if effect.Type == statusType {
+			return true
+		}
+	}
+	return false
+}
+
+// Remove ends every effect of the given type
+func (s *StatusEffects) Remove(statusType StatusType) {
+	kept := make(StatusEffects, 0, len(*s))
+	for _, effect := range *s {
+		if effect.Type != statusType {
+			kept = append(kept, effect)
+		}
+	}
+	*s = kept
+}
+
+// SkipsTurn checks if an active effect stops the target from acting
+func (s StatusEffects) SkipsTurn() bool {
+	for _, effect := range s {
+		if StatusDefinitions[effect.Type].SkipsTurn {
+			return true
+		}
+	}
+	return false
+}
+
+// Modifiers adds up the stat changes of the active effects
+func (s StatusEffects) Modifiers() StatModifiers {
+	total := StatModifiers{}
+	for _, effect := range s {
+		definition := StatusDefinitions[effect.Type]
+		if definition.Modifiers == nil {
+			continue
+		}
+		modifiers := definition.Modifiers(effect)
+		total.AC += modifiers.AC
+		total.Accuracy += modifiers.Accuracy
+		total.Damage += modifiers.Damage
+	}
+	return total
+}
+
+// Tick runs the per-turn hooks of every effect, counts their durations down and
+// removes the ones that ran out. The caller applies the damage and healing.
+func (s *StatusEffects) Tick() StatusTurn {
+	turn := StatusTurn{}
+	kept := make(StatusEffects, 0, len(*s))
+	for _, effect := range *s {
+		if definition := StatusDefinitions[effect.Type]; definition.OnTurn != nil {
+			result := definition.OnTurn(effect)
+			turn.Damage += result.Damage
+			turn.Healing += result.Healing
+		}
+
+		effect.Duration--
+		if effect.Duration > 0 {
+			kept = append(kept, effect)
+		} else {
+			turn.Expired = append(turn.Expired, effect.Type)
+		}
+	}
+	*s = kept
+	return turn
+}
@@ -0,0 +1,107 @@
+package models
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStatusEffectsApplyStacking(t *testing.T) {
+	var effects StatusEffects
+
+	// Poison stacks in intensity up to its cap
+	for i := 0; i < 7; i++ {
+		effects.Apply(StatusEffect{Type: StatusPoison, Duration: 3, Potency: 2})
+	}
+	require.Len(t, effects, 1)
+	assert.Equal(t, StatusDefinitions[StatusPoison].MaxStacks, effects[0].Stacks)
+
+	// Burn refreshes to the longer duration and stronger potency
+	effects.Apply(StatusEffect{Type: StatusBurn, Duration: 5, Potency: 1})
+	applied := effects.Apply(StatusEffect{Type: StatusBurn, Duration: 2, Potency: 3})
+	require.Len(t, effects, 2)
+	assert.Equal(t, 5, applied.Duration)
+	assert.Equal(t, 3, applied.Potency)
+	assert.Equal(t, 1, applied.Stacks)
+}
+
+func TestStatusEffectsApplyCopies(t *testing.T) {
+	var effects StatusEffects
+	effects.Apply(StatusEffect{Type: StatusBurn, Duration: 2, Potency: 1})
+	snapshot := effects
+
+	effects.Apply(StatusEffect{Type: StatusBurn, Duration: 4, Potency: 1})
+	assert.Equal(t, 2, snapshot[0].Duration, "Earlier copies should not change")
+	assert.Equal(t, 4, effects[0].Duration)
+}
+
+func TestStatusEffectsTick(t *testing.T) {
+	var effects StatusEffects
+	effects.Apply(StatusEffect{Type: StatusPoison, Duration: 2, Potency: 2, Stacks: 2})
+	effects.Apply(StatusEffect{Type: StatusRegeneration, Duration: 1, Potency: 3})
+
+	turn := effects.Tick()
+	assert.Equal(t, 4, turn.Damage, "Poison deals its potency for each stack")
+	assert.Equal(t, 3, turn.Healing)
+	assert.Equal(t, []StatusType{StatusRegeneration}, turn.Expired)
+	require.Len(t, effects, 1)
+	assert.Equal(t, 1, effects[0].Duration)
+
+	turn = effects.Tick()
+	assert.Equal(t, []StatusType{StatusPoison}, turn.Expired)
+	assert.Empty(t, effects)
+}
+
+func TestStatusEffectsModifiers(t *testing.T) {
+	var effects StatusEffects
+	assert.False(t, effects.SkipsTurn())
+
+	effects.Apply(StatusEffect{Type: StatusHaste, Duration: 3})
+	effects.Apply(StatusEffect{Type: StatusStun, Duration: 1})
+	assert.True(t, effects.SkipsTurn())
+	assert.True(t, effects.Has(StatusStun))
+	assert.Equal(t, StatModifiers{AC: -2, Accuracy: 2}, effects.Modifiers())
+
+	effects.Remove(StatusStun)
+	assert.False(t, effects.Has(StatusStun))
+	assert.False(t, effects.SkipsTurn())
+}
+
+func TestStatusEffectsChangeCombatStats(t *testing.T) {
+	character := NewCharacter("Hasted", Warrior)
+	baseAC := character.CalculateTotalAC()
+	baseHit := character.CalculateHitChance(10)
+
+	character.StatusEffects.Apply(StatusEffect{Type: StatusHaste, Duration: 3})
+	assert.Equal(t, baseAC+2, character.CalculateTotalAC())
+	assert.Greater(t, character.CalculateHitChance(10), baseHit)
+
+	mob := NewMob(MobGoblin, VariantNormal, 1)
+	baseDamage := mob.CalculateDamage()
+	mob.StatusEffects.Apply(StatusEffect{Type: StatusPoison, Duration: 3, Potency: 1, Stacks: 2})
+	assert.Equal(t, max(baseDamage-2, 0), mob.CalculateDamage())
+}
+
+func TestUseItemAppliesEffect(t *testing.T) {
+	character := NewCharacter("Drinker", Warrior)
+	potion := NewPotion("Potion of Regeneration", 5, 10)
+	potion.Effect = &StatusEffect{Type: StatusRegeneration, Duration: 5, Potency: 3}
+	character.AddToInventory(potion)
+
+	require.True(t, character.UseItem(potion.ID))
+	require.Len(t, character.StatusEffects, 1)
+	assert.Equal(t, "Potion of Regeneration", character.StatusEffects[0].Source)
+
+	data, err := json.Marshal(character)
+	require.NoError(t, err)
+	assert.Contains(t, string(data), `"statusEffects":[{"type":"regeneration"`)
+}
+
+func TestStatusEffectValidation(t *testing.T) {
+	assert.NoError(t, StatusEffect{Type: StatusBurn, Duration: 2, Potency: 1}.validate())
+	assert.Error(t, StatusEffect{Type: "frozen", Duration: 2}.validate())
+	assert.Error(t, StatusEffect{Type: StatusBurn}.validate())
+	assert.Error(t, StatusEffect{Type: StatusBurn, Duration: 2, Potency: -1}.validate())
+}
@@ -0,0 +1,212 @@
+package models
+
+import (
+	"fmt"
+)
+
+// Theme sets how a dungeon's floors are shaped, who lives in them and what they hold
+type Theme string
+
+const (
+	ThemeClassic  Theme = "classic"  // A bit of everything
+	ThemeCrypt    Theme = "crypt"    // Pillared tombs full of the undead
+	ThemeCaverns  Theme = "caverns"  // Ragged caves full of beasts
+	ThemeFortress Theme = "fortress" // Pillared halls held by goblins, orcs and ogres
+	ThemeInfernal Theme = "infernal" // Scorched caves full of fire
+)
+
+// Themes lists every dungeon theme
+var Themes = []Theme{ThemeClassic, ThemeCrypt, ThemeCaverns, ThemeFortress, ThemeInfernal}
+
+// Layout is the algorithm the map generator lays a floor's rooms and passages out with
+type Layout string
+
+const (
+	LayoutRooms   Layout = "rooms"   // Rooms scattered at random, joined by L-shaped corridors
+	LayoutBSP     Layout = "bsp"     // Space split into a tree of partitions, one room in each
+	LayoutCaves   Layout = "caves"   // Caverns grown by a cellular automaton around clearings
+	LayoutTunnels Layout = "tunnels" // Winding tunnels dug by a drunkard's walk between rooms
+)
+
+// Layouts lists every layout
+var Layouts = []Layout{LayoutRooms, LayoutBSP, LayoutCaves, LayoutTunnels}
+
+// RoomShape is how the map generator carves a theme's rooms
+type RoomShape string
+
+const (
+	ShapeRectangle RoomShape = "rectangle" // Plain rectangular rooms
+	ShapeCave      RoomShape = "cave"      // Rooms with ragged, eroded edges
+	ShapePillared  RoomShape = "pillared"  // Rooms with rows of pillars in larger ones
+)
+
+// TileStyle is how clients draw a type of tile
+type TileStyle struct {
+	Symbol string `json:"symbol"`
+	Color  string `json:"color"`
+}
+
+// Palette maps tile types to how clients draw them
+type Palette map[TileType]TileStyle
+
+// ThemeMob is a monster a theme spawns, from the given floor down
+type ThemeMob struct {
+	Type     MobType
+	MinDepth int
+}
+
+// ThemeHazard is a kind of trap a theme hides, from the given floor down
+type ThemeHazard struct {
+	Type     TrapType
+	MinDepth int
+}
+
+// ThemeDefinition describes how the map generator builds a theme's floors
+type ThemeDefinition struct {
+	Theme     Theme
+	Layout    Layout
+	Shape     RoomShape
+	Mobs      []MobType     // Monsters that spawn at random, when the catalog lets them spawn on the floor; empty means all of them
+	Bosses    []ThemeMob    // Boss monsters, the deepest one a floor allows being used
+	Hazards   []ThemeHazard // Traps hidden in the theme's rooms
+	TrapBonus int           // Percent added to the chance of a standard room hiding a trap
+	Palette   Palette       // How clients draw the theme's tiles; empty means their defaults
+}
+
+// themes holds the definition of every theme
+var themes = map[Theme]*ThemeDefinition{
+	ThemeClassic: {
+		Theme:   ThemeClassic,
+		Layout:  LayoutRooms,
+		Shape:   ShapeRectangle,
+		Bosses:  []ThemeMob{{MobOgre, 1}, {MobDragon, 10}},
+		Hazards: []ThemeHazard{{TrapSpike, 1}, {TrapAlarm, 1}, {TrapPoison, 2}, {TrapTeleport, 3}},
+	},
+	ThemeCrypt: {
+		Theme:   ThemeCrypt,
+		Layout:  LayoutBSP,
+		Shape:   ShapePillared,
+		Mobs:    []MobType{MobSkeleton, MobRatman, MobOoze, MobWraith, MobLich},
+		Bosses:  []ThemeMob{{MobWraith, 1}, {MobLich, 10}},
+		Hazards: []ThemeHazard{{TrapPoison, 1}, {TrapSpike, 1}, {TrapAlarm, 3}},
+		Palette: Palette{
+			TileWall:  {Symbol: "#", Color: "#5A5A6E"},
+			TileFloor: {Symbol: ".", Color: "#3C3C46"},
+			TileDoor:  {Symbol: "+", Color: "#6E6E82"},
+		},
+	},
+	ThemeCaverns: {
+		Theme:   ThemeCaverns,
+		Layout:  LayoutCaves,
+		Shape:   ShapeCave,
+		Mobs:    []MobType{MobGoblin, MobRatman, MobOoze, MobTroll, MobDrake},
+		Bosses:  []ThemeMob{{MobTroll, 1}, {MobDragon, 10}},
+		Hazards: []ThemeHazard{{TrapSpike, 1}, {TrapPoison, 1}, {TrapTeleport, 3}},
+		Palette: Palette{
+			TileWall:  {Symbol: "#", Color: "#6B4F2A"},
+			TileFloor: {Symbol: ",", Color: "#4A3B28"},
+		},
+	},
+	ThemeFortress: {
+		Theme:     ThemeFortress,
+		Layout:    LayoutBSP,
+		Shape:     ShapePillared,
+		Mobs:      []MobType{MobGoblin, MobSkeleton, MobOrc, MobTroll, MobOgre},
+		Bosses:    []ThemeMob{{MobOrc, 1}, {MobOgre, 8}},
+		Hazards:   []ThemeHazard{{TrapAlarm, 1}, {TrapSpike, 1}, {TrapPoison, 4}},
+		TrapBonus: 10,
+		Palette: Palette{
+			TileWall:  {Symbol: "#", Color: "#8C8C8C"},
+			TileFloor: {Symbol: ".", Color: "#5C5C5C"},
+			TileDoor:  {Symbol: "+", Color: "#A0522D"},
+		},
+	},
+	ThemeInfernal: {
+		Theme:   ThemeInfernal,
+		Layout:  LayoutTunnels,
+		Shape:   ShapeCave,
+		Mobs:    []MobType{MobGoblin, MobSkeleton, MobWraith, MobDrake, MobElemental},
+		Bosses:  []ThemeMob{{MobDrake, 1}, {MobDragon, 10}},
+		Hazards: []ThemeHazard{{TrapFire, 1}, {TrapSpike, 1}, {TrapTeleport, 3}},
+		Palette: Palette{
+			TileWall:  {Symbol: "#", Color: "#8B1A1A"},
+			TileFloor: {Symbol: ".", Color: "#4A1010"},
+			TileDoor:  {Symbol: "+", Color: "#B8860B"},
+		},
+	},
+}
+
+// ParseTheme checks a theme given in a request. An empty theme is classic.
+func ParseTheme(value string) (Theme, error) {
+	if value == "" {
+		return ThemeClassic, nil
+	}
+	if _, exists := themes[Theme(value)]; !exists {
+		return "", fmt.Errorf("unknown theme %q", value)
+	}
+	return Theme(value), nil
+}
+
+// ParseLayout checks a layout given in a request
+func ParseLayout(value string) (Layout, error) {
+	for _, layout := range Layouts {
+		if Layout(value) == layout {
+			return layout, nil
+		}
+	}
+	return "", fmt.Errorf("unknown layout %q", value)
+}
+
+// Definition returns how the theme's floors are built. Unknown themes, such as
+// those of dungeons saved before themes existed, are built as classic.
+func (t Theme) Definition() *ThemeDefinition {
+	if definition, exists := themes[t]; exists {
+		return definition
+	}
+	return themes[ThemeClassic]
+}
+
+// MobsAt returns the mob types that spawn at random on a floor of the theme, in
+// catalog order. Floors the theme has no monsters for use the whole catalog.
+func (d *ThemeDefinition) MobsAt(catalog *MonsterCatalog, floorLevel int) []MobType {
+	spawnable := catalog.SpawnableAt(floorLevel)
+	if len(d.Mobs) == 0 {
+		return spawnable
+	}
+
+	types := make([]MobType, 0, len(spawnable))
+	for _, mobType := range spawnable {
+		for _, themed := range d.Mobs {
+			if mobType == themed {
+				types = append(types, mobType)
+				break
+			}
+		}
+	}
+	if len(types) == 0 {
+		return spawnable
+	}
+	return types
+}
+
+// BossAt returns the boss monster for a floor of the theme
+func (d *ThemeDefinition) BossAt(floorLevel int) MobType {
+	boss := d.Bosses[0].Type
+	for _, candidate := range d.Bosses {
+		if floorLevel >= candidate.MinDepth {
+			boss = candidate.Type
+		}
+	}
+	return boss
+}
+
+// HazardsAt returns the kinds of trap hidden on a floor of the theme
+func (d *ThemeDefinition) HazardsAt(floorLevel int) []TrapType {
+	types := make([]TrapType, 0, len(d.Hazards))
+	for _, hazard := range d.Hazards {
+		if floorLevel >= hazard.MinDepth {
+			types = append(types, hazard.Type)
+		}
+	}
+	return types
+}
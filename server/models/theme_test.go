@@ -0,0 +1,87 @@
+package models
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseTheme(t *testing.T) {
+	theme, err := ParseTheme("")
+	require.NoError(t, err)
+	assert.Equal(t, ThemeClassic, theme, "Dungeons are classic unless asked otherwise")
+
+	theme, err = ParseTheme("infernal")
+	require.NoError(t, err)
+	assert.Equal(t, ThemeInfernal, theme)
+
+	_, err = ParseTheme("candyland")
+	assert.EqualError(t, err, `unknown theme "candyland"`)
+
+	// Dungeons saved before themes existed are built as classic
+	assert.Equal(t, ThemeClassic, Theme("").Definition().Theme)
+}
+
+func TestParseLayout(t *testing.T) {
+	layout, err := ParseLayout("caves")
+	require.NoError(t, err)
+	assert.Equal(t, LayoutCaves, layout)
+
+	_, err = ParseLayout("")
+	assert.EqualError(t, err, `unknown layout ""`)
+}
+
+func TestThemeDefinitions(t *testing.T) {
+	catalog := DefaultMonsterCatalog()
+	for _, theme := range Themes {
+		definition := theme.Definition()
+		assert.Equal(t, theme, definition.Theme)
+		assert.Contains(t, Layouts, definition.Layout, "%s needs a layout", theme)
+		require.NotEmpty(t, definition.Bosses, "%s needs a boss", theme)
+		assert.NotEmpty(t, definition.HazardsAt(1), "%s needs traps on the first floor", theme)
+
+		// Themes only name monsters the catalog defines
+		for _, mobType := range definition.Mobs {
+			_, exists := catalog.Definition(mobType)
+			assert.True(t, exists, "%s spawns undefined monster %q", theme, mobType)
+		}
+		for _, boss := range definition.Bosses {
+			_, exists := catalog.Definition(boss.Type)
+			assert.True(t, exists, "%s has undefined boss %q", theme, boss.Type)
+		}
+		for tileType, style := range definition.Palette {
+			assert.Len(t, style.Symbol, 1, "%s %q", theme, tileType)
+			assert.Regexp(t, colorPattern, style.Color, "%s %q", theme, tileType)
+		}
+	}
+}
+
+func TestThemeDefinitionMobsAt(t *testing.T) {
+	catalog := DefaultMonsterCatalog()
+
+	// Classic floors spawn everything the catalog allows
+	assert.Equal(t, catalog.SpawnableAt(5), ThemeClassic.Definition().MobsAt(catalog, 5))
+
+	// Themed floors only spawn their own monsters, once they are deep enough
+	crypt := ThemeCrypt.Definition()
+	assert.Equal(t, []MobType{MobSkeleton, MobRatman}, crypt.MobsAt(catalog, 1))
+	assert.Equal(t, []MobType{MobSkeleton, MobRatman, MobOoze, MobWraith, MobLich}, crypt.MobsAt(catalog, 10))
+
+	// A floor none of the theme's monsters can spawn on falls back to the catalog
+	themed := &ThemeDefinition{Mobs: []MobType{MobLich}}
+	assert.Equal(t, catalog.SpawnableAt(1), themed.MobsAt(catalog, 1))
+}
+
+func TestThemeDefinitionBossAndHazardsAt(t *testing.T) {
+	classic := ThemeClassic.Definition()
+	assert.Equal(t, MobOgre, classic.BossAt(1))
+	assert.Equal(t, MobOgre, classic.BossAt(9))
+	assert.Equal(t, MobDragon, classic.BossAt(10))
+	assert.Equal(t, []TrapType{TrapSpike, TrapAlarm}, classic.HazardsAt(1))
+	assert.Equal(t, []TrapType{TrapSpike, TrapAlarm, TrapPoison, TrapTeleport}, classic.HazardsAt(3))
+
+	infernal := ThemeInfernal.Definition()
+	assert.Equal(t, MobDrake, infernal.BossAt(5))
+	assert.Contains(t, infernal.HazardsAt(1), TrapFire)
+}
@@ -0,0 +1,70 @@
+package models
+
+import (
+	"github.com/google/uuid"
+)
+
+// TrapType is what a trap does to whoever sets it off
+type TrapType string
+
+const (
+	TrapSpike    TrapType = "spike"    // Deals damage
+	TrapPoison   TrapType = "poison"   // Poisons whoever sets it off
+	TrapTeleport TrapType = "teleport" // Sends whoever sets it off somewhere else on the floor
+	TrapAlarm    TrapType = "alarm"    // Calls the mobs nearby to the trap
+	TrapFire     TrapType = "fire"     // Deals damage and sets whoever sets it off alight
+)
+
+// TrapTypes lists every kind of trap
+var TrapTypes = []TrapType{TrapSpike, TrapPoison, TrapTeleport, TrapAlarm, TrapFire}
+
+const (
+	trapBaseDC = 10 // Perception and Traps DC of traps on the first floor
+	maxTrapDC  = 25 // Traps never get harder to spot or disarm than this
+)
+
+// Trap is a hidden hazard on a floor tile
+type Trap struct {
+	ID       string        `json:"id"`
+	Type     TrapType      `json:"type"`
+	Position Position      `json:"position"`
+	Level    int           `json:"level"`
+	Damage   int           `json:"damage,omitempty"` // Damage dealt by spike and fire traps
+	Effect   *StatusEffect `json:"effect,omitempty"` // Effect applied by poison and fire traps
+	DetectDC int           `json:"detectDc"`         // Passive Perception needed to spot the trap
+	DisarmDC int           `json:"disarmDc"`         // Traps check needed to disarm the trap
+	Revealed bool          `json:"revealed"`         // Someone has spotted or set off the trap
+}
+
+// NewTrap creates a hidden trap scaled for a floor
+func NewTrap(trapType TrapType, level int) *Trap {
+	dc := min(trapBaseDC+level/2, maxTrapDC)
+	trap := &Trap{
+		ID:       uuid.New().String(),
+		Type:     trapType,
+		Level:    level,
+		DetectDC: dc,
+		DisarmDC: min(dc+2, maxTrapDC),
+	}
+
+	switch trapType {
+	case TrapSpike:
+		trap.Damage = 4 + 2*level
+	case TrapPoison:
+		trap.Effect = &StatusEffect{Type: StatusPoison, Duration: 3 + level/3, Potency: 1 + level/4, Source: "poison trap"}
+	case TrapFire:
+		trap.Damage = 2 + level
+		trap.Effect = &StatusEffect{Type: StatusBurn, Duration: 2 + level/4, Potency: 1 + level/4, Source: "fire trap"}
+	}
+	return trap
+}
+
+// Name returns how the trap is described to players
+func (t *Trap) Name() string {
+	return string(t.Type) + " trap"
+}
+
+// Experience returns the experience for disarming the trap
+func (t *Trap) Experience() int {
+	return 10 + 5*t.Level
+}
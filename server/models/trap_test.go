@@ -0,0 +1,39 @@
+package models
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewTrap(t *testing.T) {
+	spike := NewTrap(TrapSpike, 4)
+	assert.NotEmpty(t, spike.ID)
+	assert.Equal(t, 12, spike.DetectDC)
+	assert.Equal(t, 14, spike.DisarmDC)
+	assert.Equal(t, 12, spike.Damage)
+	assert.Nil(t, spike.Effect)
+	assert.False(t, spike.Revealed, "New traps are hidden")
+	assert.Equal(t, "spike trap", spike.Name())
+	assert.Equal(t, 30, spike.Experience())
+
+	poison := NewTrap(TrapPoison, 6)
+	require.NotNil(t, poison.Effect)
+	assert.Equal(t, StatusPoison, poison.Effect.Type)
+	assert.Equal(t, 5, poison.Effect.Duration)
+	assert.Equal(t, 2, poison.Effect.Potency)
+	assert.Zero(t, poison.Damage)
+
+	fire := NewTrap(TrapFire, 4)
+	assert.Equal(t, 6, fire.Damage)
+	require.NotNil(t, fire.Effect)
+	assert.Equal(t, StatusBurn, fire.Effect.Type)
+	assert.Equal(t, 3, fire.Effect.Duration)
+	assert.Equal(t, 2, fire.Effect.Potency)
+
+	// The deepest traps are capped
+	deep := NewTrap(TrapAlarm, 100)
+	assert.Equal(t, maxTrapDC, deep.DetectDC)
+	assert.Equal(t, maxTrapDC, deep.DisarmDC)
+}
@@ -0,0 +1,259 @@
+package pathfinding
+
+import (
+	"fmt"
+	"slices"
+	"sync"
+
+	"github.com/jchauncey/TheDeeps/server/models"
+)
+
+// maxCachedMaps is how many Dijkstra maps a cache keeps for one floor before
+// starting over
+const maxCachedMaps = 32
+
+// Map is a Dijkstra map: the cost of the cheapest path from every tile to the
+// nearest of its goals. Maps are worked out from the floor's terrain alone, since
+// mobs and characters move too often to be worth planning around; travellers
+// step around them as they go.
+type Map struct {
+	width  int
+	height int
+	costs  []int // Cost of getting from each tile to a goal; -1 where no goal can be reached
+}
+
+// NewMap works out a Dijkstra map to a set of goals. Occupants and Blocked in the
+// options are ignored.
+func NewMap(floor *models.Floor, goals []models.Position, opts Options) *Map {
+	return newMap(floor.Width, floor.Height, terrainOf(floor, opts), goals, opts.MaxCost)
+}
+
+// newMap works out a Dijkstra map over a floor's terrain, the cost of stepping
+// onto each tile with 0 where paths can't go
+func newMap(width, height int, terrain []int, goals []models.Position, maxCost int) *Map {
+	m := &Map{
+		width:  width,
+		height: height,
+		costs:  make([]int, width*height),
+	}
+	for i := range m.costs {
+		m.costs[i] = -1
+	}
+
+	// Spread out from the goals, charging each tile what it costs to step from it
+	// onto the tile it was reached from
+	open := &queue{}
+	for _, goal := range goals {
+		if goal.X < 0 || goal.X >= width || goal.Y < 0 || goal.Y >= height {
+			continue
+		}
+		index := goal.Y*width + goal.X
+		m.costs[index] = 0
+		open.add(index, 0, 0)
+	}
+	for open.Len() > 0 {
+		current := open.pop()
+		if current.cost > m.costs[current.index] {
+			continue
+		}
+		x, y := current.index%width, current.index/width
+		for _, dir := range directions {
+			next := models.Position{X: x + dir.X, Y: y + dir.Y}
+			if next.X < 0 || next.X >= width || next.Y < 0 || next.Y >= height {
+				continue
+			}
+			index := next.Y*width + next.X
+			if terrain[index] == 0 || terrain[current.index] == 0 {
+				continue
+			}
+
+			cost := current.cost + terrain[current.index]
+			if (maxCost > 0 && cost > maxCost) || (m.costs[index] >= 0 && m.costs[index] <= cost) {
+				continue
+			}
+			m.costs[index] = cost
+			open.add(index, cost, cost)
+		}
+	}
+
+	return m
+}
+
+// terrainOf works out the cost of stepping onto every tile of a floor
+func terrainOf(floor *models.Floor, opts Options) []int {
+	terrain := make([]int, floor.Width*floor.Height)
+	for y := 0; y < floor.Height; y++ {
+		for x := 0; x < floor.Width; x++ {
+			if cost, passable := terrainCost(floor, models.Position{X: x, Y: y}, opts); passable {
+				terrain[y*floor.Width+x] = cost
+			}
+		}
+	}
+	return terrain
+}
+
+// Cost returns the cost of the cheapest path from a position to a goal, and
+// false if no goal can be reached from it
+func (m *Map) Cost(pos models.Position) (int, bool) {
+	if pos.X < 0 || pos.X >= m.width || pos.Y < 0 || pos.Y >= m.height {
+		return 0, false
+	}
+	cost := m.costs[pos.Y*m.width+pos.X]
+	return cost, cost >= 0
+}
+
+// Next returns the step from a position that heads downhill toward a goal the
+// fastest, among the neighbouring tiles free reports a traveller can enter. It
+// returns false at a goal, or when every step closer is taken.
+func (m *Map) Next(pos models.Position, free func(pos models.Position) bool) (models.Position, bool) {
+	current, reachable := m.Cost(pos)
+	if !reachable {
+		return pos, false
+	}
+
+	best, bestCost := pos, current
+	for _, dir := range directions {
+		next := models.Position{X: pos.X + dir.X, Y: pos.Y + dir.Y}
+		cost, reachable := m.Cost(next)
+		if !reachable || cost >= bestCost || !free(next) {
+			continue
+		}
+		best, bestCost = next, cost
+	}
+	return best, best != pos
+}
+
+// Cache keeps the Dijkstra maps of each floor, so travellers heading to the same
+// goals share one map. Once a floor's tiles are marked as changed, the terrain of
+// those tiles is checked again the next time a map is asked for, and the maps
+// worked out from terrain that is now different are dropped. Floors are kept
+// until they are forgotten.
+type Cache struct {
+	mu     sync.Mutex
+	floors map[*models.Floor]*floorMaps
+}
+
+// floorMaps holds the maps cached for one floor
+type floorMaps struct {
+	tileChanges uint64               // The floor's tile changes when its terrain was last checked
+	terrains    map[terrainKey][]int // The floor's terrain under each set of options
+	maps        map[mapKey]*Map
+}
+
+// terrainKey identifies the options that change a floor's terrain
+type terrainKey struct {
+	doors       bool
+	avoidStairs bool
+}
+
+// mapKey identifies a cached map by its goals and the options that shape it
+type mapKey struct {
+	terrain terrainKey
+	goals   string
+	maxCost int
+}
+
+// NewCache creates an empty cache
+func NewCache() *Cache {
+	return &Cache{floors: make(map[*models.Floor]*floorMaps)}
+}
+
+// Map returns the Dijkstra map of a floor to a set of goals, working it out if
+// the cache doesn't have one or the floor's terrain changed since it was.
+// Occupants and Blocked in the options are ignored.
+func (c *Cache) Map(floor *models.Floor, goals []models.Position, opts Options) *Map {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry, exists := c.floors[floor]
+	if !exists {
+		entry = &floorMaps{
+			tileChanges: floor.TileChanges(),
+			terrains:    make(map[terrainKey][]int),
+			maps:        make(map[mapKey]*Map),
+		}
+		c.floors[floor] = entry
+	}
+	if entry.tileChanges != floor.TileChanges() {
+		entry.checkTerrain(floor)
+	}
+
+	tk := terrainKey{doors: opts.Doors, avoidStairs: opts.AvoidStairs}
+	key := mapKey{terrain: tk, goals: fmt.Sprint(goals), maxCost: opts.MaxCost}
+	if m, exists := entry.maps[key]; exists {
+		return m
+	}
+
+	terrain, exists := entry.terrains[tk]
+	if !exists {
+		terrain = terrainOf(floor, opts)
+		entry.terrains[tk] = terrain
+	}
+	if len(entry.maps) >= maxCachedMaps {
+		entry.maps = make(map[mapKey]*Map)
+	}
+	m := newMap(floor.Width, floor.Height, terrain, goals, opts.MaxCost)
+	entry.maps[key] = m
+	return m
+}
+
+// checkTerrain works out the terrain of the tiles marked as changed again, or of
+// the whole floor if it doesn't remember them all, and drops the maps worked out
+// from terrain that has changed
+func (f *floorMaps) checkTerrain(floor *models.Floor) {
+	changed, known := floor.TilesChangedSince(f.tileChanges)
+	f.tileChanges = floor.TileChanges()
+	for tk, terrain := range f.terrains {
+		opts := Options{Doors: tk.doors, AvoidStairs: tk.avoidStairs}
+		if known {
+			if !updateTerrain(floor, terrain, changed, opts) {
+				continue
+			}
+		} else {
+			rescanned := terrainOf(floor, opts)
+			if slices.Equal(terrain, rescanned) {
+				continue
+			}
+			f.terrains[tk] = rescanned
+		}
+		for key := range f.maps {
+			if key.terrain == tk {
+				delete(f.maps, key)
+			}
+		}
+	}
+}
+
+// updateTerrain works out the cost of stepping onto some of a floor's tiles again
+// and reports whether any of them changed
+func updateTerrain(floor *models.Floor, terrain []int, positions []models.Position, opts Options) bool {
+	changed := false
+	for _, pos := range positions {
+		if pos.X < 0 || pos.X >= floor.Width || pos.Y < 0 || pos.Y >= floor.Height {
+			continue
+		}
+		cost, passable := terrainCost(floor, pos, opts)
+		if !passable {
+			cost = 0
+		}
+		if index := pos.Y*floor.Width + pos.X; terrain[index] != cost {
+			terrain[index] = cost
+			changed = true
+		}
+	}
+	return changed
+}
+
+// Forget drops every map cached for a floor
+func (c *Cache) Forget(floor *models.Floor) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.floors, floor)
+}
+
+// Floors counts the floors the cache holds maps for
+func (c *Cache) Floors() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.floors)
+}
@@ -0,0 +1,146 @@
+package pathfinding
+
+import (
+	"testing"
+
+	"github.com/jchauncey/TheDeeps/server/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMap(t *testing.T) {
+	floor := newFloor(10, 10)
+	addWall(floor, 3, 1, 7)
+	goal := models.Position{X: 1, Y: 1}
+	m := NewMap(floor, []models.Position{goal}, Options{})
+
+	cost, reachable := m.Cost(goal)
+	assert.True(t, reachable)
+	assert.Zero(t, cost)
+
+	// Costs match the cheapest path, walls and all
+	for _, pos := range []models.Position{{X: 2, Y: 5}, {X: 5, Y: 1}, {X: 8, Y: 8}} {
+		path, found := FindPath(floor, pos, goal, Options{Occupants: true})
+		require.True(t, found)
+		cost, reachable := m.Cost(pos)
+		assert.True(t, reachable)
+		assert.Equal(t, len(path), cost, "Cost from %v", pos)
+	}
+
+	_, reachable = m.Cost(models.Position{X: 3, Y: 3})
+	assert.False(t, reachable, "Walls can't reach anywhere")
+	_, reachable = m.Cost(models.Position{X: -1, Y: 3})
+	assert.False(t, reachable)
+
+	// Maps ignore occupants, leaving travellers to step around them
+	floor.Tiles[8][3].MobID = "goblin"
+	m = NewMap(floor, []models.Position{goal}, Options{})
+	_, reachable = m.Cost(models.Position{X: 5, Y: 1})
+	assert.True(t, reachable)
+}
+
+func TestMapNext(t *testing.T) {
+	floor := newFloor(10, 10)
+	m := NewMap(floor, []models.Position{{X: 1, Y: 1}, {X: 8, Y: 8}}, Options{})
+
+	// Travellers head for the nearest goal
+	free := func(models.Position) bool { return true }
+	next, moved := m.Next(models.Position{X: 7, Y: 6}, free)
+	assert.True(t, moved)
+	cost, _ := m.Cost(next)
+	assert.Equal(t, 2, cost)
+
+	// Taken tiles are stepped around while there is another way closer
+	taken := models.Position{X: 2, Y: 2}
+	next, moved = m.Next(models.Position{X: 2, Y: 3}, func(pos models.Position) bool { return pos != taken })
+	assert.True(t, moved)
+	assert.Equal(t, models.Position{X: 1, Y: 3}, next)
+
+	_, moved = m.Next(models.Position{X: 2, Y: 1}, func(models.Position) bool { return false })
+	assert.False(t, moved, "Nowhere to go when every step closer is taken")
+	_, moved = m.Next(models.Position{X: 1, Y: 1}, free)
+	assert.False(t, moved, "Nowhere to go at a goal")
+}
+
+func TestCache(t *testing.T) {
+	floor := newFloor(10, 10)
+	other := newFloor(10, 10)
+	cache := NewCache()
+	goals := []models.Position{{X: 1, Y: 1}}
+
+	// Maps are shared until the floor's terrain changes
+	m := cache.Map(floor, goals, Options{})
+	assert.Same(t, m, cache.Map(floor, goals, Options{}))
+	assert.Same(t, m, cache.Map(floor, goals, Options{Occupants: true}), "Occupants don't change maps")
+	assert.NotSame(t, m, cache.Map(floor, goals, Options{AvoidStairs: true}))
+	assert.NotSame(t, m, cache.Map(floor, []models.Position{{X: 2, Y: 2}}, Options{}))
+	assert.NotSame(t, m, cache.Map(other, goals, Options{}))
+
+	// Mobs moving about mark tiles without changing the terrain
+	floor.Tiles[4][4].MobID = "goblin"
+	floor.MarkTiles(models.Position{X: 4, Y: 4})
+	assert.Same(t, m, cache.Map(floor, goals, Options{}))
+
+	// Changes nobody marked aren't noticed
+	floor.Tiles[1][2] = models.Tile{Type: models.TileWall}
+	assert.Same(t, m, cache.Map(floor, goals, Options{}))
+
+	floor.MarkTiles(models.Position{X: 2, Y: 1})
+	changed := cache.Map(floor, goals, Options{})
+	assert.NotSame(t, m, changed)
+	cost, _ := changed.Cost(models.Position{X: 3, Y: 1})
+	assert.Equal(t, 4, cost, "The new wall is walked around")
+
+	// Changes further back than the floor remembers are found by checking every tile
+	floor.Tiles[1][2] = models.Tile{Type: models.TileFloor, Walkable: true}
+	floor.MarkTiles(models.Position{X: 2, Y: 1})
+	for i := 0; i < models.MaxMarkedTiles; i++ {
+		floor.MarkTiles(models.Position{X: 4, Y: 4})
+	}
+	reopened := cache.Map(floor, goals, Options{})
+	assert.NotSame(t, changed, reopened)
+	cost, _ = reopened.Cost(models.Position{X: 3, Y: 1})
+	assert.Equal(t, 2, cost)
+
+	// Forgetting a floor drops its maps
+	assert.Equal(t, 2, cache.Floors())
+	cache.Forget(floor)
+	assert.Equal(t, 1, cache.Floors())
+	assert.NotSame(t, reopened, cache.Map(floor, goals, Options{}))
+}
+
+func BenchmarkNewMap(b *testing.B) {
+	floor := newSerpentine(100, 100)
+	goals := []models.Position{{X: 98, Y: 98}}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		NewMap(floor, goals, Options{})
+	}
+}
+
+func BenchmarkCacheMap(b *testing.B) {
+	floor := newSerpentine(100, 100)
+	goals := []models.Position{{X: 98, Y: 98}}
+	cache := NewCache()
+	cache.Map(floor, goals, Options{})
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		cache.Map(floor, goals, Options{})
+	}
+}
+
+func BenchmarkCacheMapAfterMove(b *testing.B) {
+	floor := newSerpentine(100, 100)
+	goals := []models.Position{{X: 98, Y: 98}}
+	cache := NewCache()
+	cache.Map(floor, goals, Options{})
+
+	// Something moving each time makes the cache check the terrain again
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		floor.MarkTiles(models.Position{X: 1, Y: 1})
+		cache.Map(floor, goals, Options{})
+	}
+}
@@ -0,0 +1,239 @@
+// Package pathfinding finds paths across dungeon floors, with A* searches for
+// single trips and Dijkstra maps for many travellers heading to the same places.
+// Paths move orthogonally, the way characters and mobs do.
+package pathfinding
+
+import (
+	"github.com/jchauncey/TheDeeps/server/models"
+)
+
+const (
+	StepCost = 1  // Cost of stepping onto an open tile
+	DoorCost = 2  // Cost of stepping through a closed door, opening it on the way
+	TrapCost = 10 // Cost of stepping onto a revealed trap, so paths go around them when they can
+)
+
+// directions are the steps a path can take, matching character and mob movement
+var directions = []models.Position{
+	{X: 0, Y: -1}, {X: 1, Y: 0}, {X: 0, Y: 1}, {X: -1, Y: 0},
+}
+
+// Options sets which tiles a path may cross
+type Options struct {
+	Doors       bool // Cross closed doors that open without a key
+	AvoidStairs bool // Keep off stairs, as mobs do
+	Occupants   bool // Cross tiles mobs and characters stand on
+	MaxCost     int  // Give up on paths costing more than this; 0 searches the whole floor
+
+	// Blocked marks further tiles the path can't cross, such as where characters stand
+	Blocked func(pos models.Position) bool
+}
+
+// Cost returns what stepping onto a tile costs, and false if the path can't cross it
+func Cost(floor *models.Floor, pos models.Position, opts Options) (int, bool) {
+	cost, passable := terrainCost(floor, pos, opts)
+	if !passable || occupied(floor, pos, opts) {
+		return 0, false
+	}
+	return cost, true
+}
+
+// terrainCost returns what stepping onto a tile costs for its terrain alone,
+// ignoring whoever stands on it
+func terrainCost(floor *models.Floor, pos models.Position, opts Options) (int, bool) {
+	if pos.X < 0 || pos.X >= floor.Width || pos.Y < 0 || pos.Y >= floor.Height {
+		return 0, false
+	}
+
+	tile := floor.Tiles[pos.Y][pos.X]
+	if !tile.Walkable {
+		door, exists := floor.Doors[tile.DoorID]
+		if opts.Doors && exists && !door.Open && !door.Sealed && !door.Lock.IsLocked() {
+			return DoorCost, true
+		}
+		return 0, false
+	}
+
+	switch {
+	case opts.AvoidStairs && (tile.Type == models.TileUpStairs || tile.Type == models.TileDownStairs):
+		return 0, false
+	case tile.Type == models.TileTrap:
+		// Hidden traps look like any other floor, so only revealed ones are avoided
+		return TrapCost, true
+	default:
+		return StepCost, true
+	}
+}
+
+// occupied checks if someone stands on a tile the path isn't allowed through
+func occupied(floor *models.Floor, pos models.Position, opts Options) bool {
+	if opts.Blocked != nil && opts.Blocked(pos) {
+		return true
+	}
+	tile := floor.Tiles[pos.Y][pos.X]
+	return !opts.Occupants && (tile.MobID != "" || tile.Character != "")
+}
+
+// FindPath finds the cheapest path between two positions with an A* search. The
+// path lists every step after the start, ending at the goal; it is empty when
+// the start is the goal. The goal may be occupied or blocked, since travellers
+// often head for whoever stands there.
+func FindPath(floor *models.Floor, from, to models.Position, opts Options) ([]models.Position, bool) {
+	return search(floor, from, opts, true,
+		func(pos models.Position) bool { return pos == to },
+		func(pos models.Position) int { return StepCost * (abs(pos.X-to.X) + abs(pos.Y-to.Y)) },
+	)
+}
+
+// Nearest finds the cheapest path to the closest tile matching a test, such as
+// the nearest unexplored tile or the nearest one out of a monster's reach. The
+// start itself is never a match.
+func Nearest(floor *models.Floor, from models.Position, opts Options, match func(pos models.Position) bool) ([]models.Position, bool) {
+	return search(floor, from, opts, false,
+		func(pos models.Position) bool { return pos != from && match(pos) },
+		func(models.Position) int { return 0 },
+	)
+}
+
+// search runs a best-first search from a position until it reaches a goal,
+// ranking tiles by their cost so far plus the estimate of what is left.
+// With no estimate it is Dijkstra's algorithm.
+func search(floor *models.Floor, from models.Position, opts Options, occupiedGoal bool, goal func(models.Position) bool, estimate func(models.Position) int) ([]models.Position, bool) {
+	if goal(from) {
+		return []models.Position{}, true
+	}
+	if from.X < 0 || from.X >= floor.Width || from.Y < 0 || from.Y >= floor.Height {
+		return nil, false
+	}
+
+	costs := make([]int, floor.Width*floor.Height)
+	parents := make([]int, floor.Width*floor.Height)
+	for i := range costs {
+		costs[i] = -1
+	}
+	start := from.Y*floor.Width + from.X
+	costs[start] = 0
+
+	open := &queue{}
+	open.add(start, 0, estimate(from))
+	for open.Len() > 0 {
+		current := open.pop()
+		if current.cost > costs[current.index] {
+			continue // A cheaper way here was already explored
+		}
+		pos := models.Position{X: current.index % floor.Width, Y: current.index / floor.Width}
+		if goal(pos) {
+			return tracePath(floor.Width, parents, start, current.index), true
+		}
+
+		for _, dir := range directions {
+			next := models.Position{X: pos.X + dir.X, Y: pos.Y + dir.Y}
+			step, passable := terrainCost(floor, next, opts)
+			if !passable || (occupied(floor, next, opts) && !(occupiedGoal && goal(next))) {
+				continue
+			}
+
+			cost := current.cost + step
+			index := next.Y*floor.Width + next.X
+			if (opts.MaxCost > 0 && cost > opts.MaxCost) || (costs[index] >= 0 && costs[index] <= cost) {
+				continue
+			}
+			costs[index] = cost
+			parents[index] = current.index
+			open.add(index, cost, cost+estimate(next))
+		}
+	}
+
+	return nil, false
+}
+
+// tracePath follows the parents of a search back from where it ended
+func tracePath(width int, parents []int, start, end int) []models.Position {
+	path := make([]models.Position, 0)
+	for index := end; index != start; index = parents[index] {
+		path = append(path, models.Position{X: index % width, Y: index / width})
+	}
+	for i, j := 0, len(path)-1; i < j; i, j = i+1, j-1 {
+		path[i], path[j] = path[j], path[i]
+	}
+	return path
+}
+
+// node is a tile waiting in a search's queue
+type node struct {
+	index    int // Tile index, y * width + x
+	cost     int // Cost of the cheapest path to the tile found so far
+	priority int // Cost plus the estimate of what is left
+	order    int // When it was queued, so ties break the same way every time
+}
+
+// queue is a priority queue of tiles, cheapest first, kept as a binary heap
+type queue struct {
+	nodes []node
+	added int
+}
+
+// Len returns how many tiles are waiting
+func (q *queue) Len() int { return len(q.nodes) }
+
+// add queues a tile
+func (q *queue) add(index, cost, priority int) {
+	q.nodes = append(q.nodes, node{index: index, cost: cost, priority: priority, order: q.added})
+	q.added++
+
+	// Sift the new tile up past any dearer parents
+	i := len(q.nodes) - 1
+	for i > 0 {
+		parent := (i - 1) / 2
+		if !q.less(i, parent) {
+			break
+		}
+		q.nodes[i], q.nodes[parent] = q.nodes[parent], q.nodes[i]
+		i = parent
+	}
+}
+
+// pop takes the cheapest tile off the queue
+func (q *queue) pop() node {
+	first := q.nodes[0]
+	last := len(q.nodes) - 1
+	q.nodes[0] = q.nodes[last]
+	q.nodes = q.nodes[:last]
+
+	// Sift the moved tile down past any cheaper children
+	i := 0
+	for {
+		cheapest := i
+		for _, child := range []int{2*i + 1, 2*i + 2} {
+			if child < len(q.nodes) && q.less(child, cheapest) {
+				cheapest = child
+			}
+		}
+		if cheapest == i {
+			return first
+		}
+		q.nodes[i], q.nodes[cheapest] = q.nodes[cheapest], q.nodes[i]
+		i = cheapest
+	}
+}
+
+// less checks if one queued tile should be explored before another
+func (q *queue) less(i, j int) bool {
+	a, b := q.nodes[i], q.nodes[j]
+	if a.priority != b.priority {
+		return a.priority < b.priority
+	}
+	if a.cost != b.cost {
+		// Prefer tiles further along, which are closer to the goal
+		return a.cost > b.cost
+	}
+	return a.order < b.order
+}
+
+// abs returns the absolute value of an integer
+func abs(x int) int {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
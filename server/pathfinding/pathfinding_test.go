@@ -0,0 +1,226 @@
+package pathfinding
+
+import (
+	"testing"
+
+	"github.com/jchauncey/TheDeeps/server/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newFloor creates an open floor surrounded by walls
+func newFloor(width, height int) *models.Floor {
+	floor := &models.Floor{
+		Level:  1,
+		Width:  width,
+		Height: height,
+		Tiles:  make([][]models.Tile, height),
+		Mobs:   make(map[string]*models.Mob),
+		Items:  make(map[string]models.Item),
+		Doors:  make(map[string]*models.Door),
+	}
+	for y := 0; y < height; y++ {
+		floor.Tiles[y] = make([]models.Tile, width)
+		for x := 0; x < width; x++ {
+			if x == 0 || y == 0 || x == width-1 || y == height-1 {
+				floor.Tiles[y][x] = models.Tile{Type: models.TileWall}
+			} else {
+				floor.Tiles[y][x] = models.Tile{Type: models.TileFloor, Walkable: true}
+			}
+		}
+	}
+	return floor
+}
+
+// newSerpentine creates a floor split by walls into lanes joined at alternate
+// ends, so crossing it means winding through every lane
+func newSerpentine(width, height int) *models.Floor {
+	floor := newFloor(width, height)
+	for x := 2; x < width-2; x += 2 {
+		gap := 1
+		if (x/2)%2 == 1 {
+			gap = height - 2
+		}
+		for y := 1; y < height-1; y++ {
+			if y != gap {
+				floor.Tiles[y][x] = models.Tile{Type: models.TileWall}
+			}
+		}
+	}
+	return floor
+}
+
+// addWall walls off a column of tiles
+func addWall(floor *models.Floor, x, y1, y2 int) {
+	for y := y1; y <= y2; y++ {
+		floor.Tiles[y][x] = models.Tile{Type: models.TileWall}
+	}
+}
+
+// addDoor hangs a closed door on a tile
+func addDoor(floor *models.Floor, x, y int) *models.Door {
+	door := models.NewDoor(models.Position{X: x, Y: y})
+	floor.Doors[door.ID] = door
+	floor.Tiles[y][x] = models.Tile{Type: models.TileDoor, DoorID: door.ID}
+	return door
+}
+
+func TestFindPath(t *testing.T) {
+	floor := newFloor(10, 10)
+	from := models.Position{X: 1, Y: 1}
+
+	path, found := FindPath(floor, from, models.Position{X: 4, Y: 1}, Options{})
+	require.True(t, found)
+	assert.Equal(t, []models.Position{{X: 2, Y: 1}, {X: 3, Y: 1}, {X: 4, Y: 1}}, path)
+
+	path, found = FindPath(floor, from, from, Options{})
+	assert.True(t, found)
+	assert.Empty(t, path, "Nowhere to go when already there")
+
+	// Walls are walked around
+	addWall(floor, 3, 1, 7)
+	path, found = FindPath(floor, from, models.Position{X: 5, Y: 1}, Options{})
+	require.True(t, found)
+	assert.Len(t, path, 18)
+	assert.Contains(t, path, models.Position{X: 3, Y: 8})
+	for i, step := range path {
+		previous := from
+		if i > 0 {
+			previous = path[i-1]
+		}
+		assert.Equal(t, 1, abs(step.X-previous.X)+abs(step.Y-previous.Y), "Paths move one tile at a time")
+	}
+
+	// Nothing gets through a solid wall, and long trips can be cut short
+	_, found = FindPath(floor, from, models.Position{X: 5, Y: 1}, Options{MaxCost: 10})
+	assert.False(t, found)
+	addWall(floor, 3, 8, 8)
+	_, found = FindPath(floor, from, models.Position{X: 5, Y: 1}, Options{})
+	assert.False(t, found)
+}
+
+func TestFindPathDoors(t *testing.T) {
+	floor := newFloor(10, 5)
+	addWall(floor, 5, 1, 3)
+	door := addDoor(floor, 5, 2)
+	from, to := models.Position{X: 1, Y: 2}, models.Position{X: 8, Y: 2}
+
+	// Closed doors only open for travellers who can open them
+	_, found := FindPath(floor, from, to, Options{})
+	assert.False(t, found)
+	path, found := FindPath(floor, from, to, Options{Doors: true})
+	require.True(t, found)
+	assert.Contains(t, path, door.Position)
+
+	cost, passable := Cost(floor, door.Position, Options{Doors: true})
+	assert.True(t, passable)
+	assert.Equal(t, DoorCost, cost)
+
+	// Locked and sealed doors stay shut
+	door.Lock = models.NewLock(1)
+	_, found = FindPath(floor, from, to, Options{Doors: true})
+	assert.False(t, found)
+	door.Lock = nil
+	door.Sealed = true
+	_, found = FindPath(floor, from, to, Options{Doors: true})
+	assert.False(t, found)
+
+	// Open doors are walked through like any floor
+	door.Sealed = false
+	door.Open = true
+	floor.Tiles[2][5].Walkable = true
+	_, found = FindPath(floor, from, to, Options{})
+	assert.True(t, found)
+}
+
+func TestFindPathOccupants(t *testing.T) {
+	floor := newFloor(5, 5)
+	addWall(floor, 2, 1, 2)
+	floor.Tiles[3][2].MobID = "goblin"
+	from, to := models.Position{X: 1, Y: 1}, models.Position{X: 3, Y: 1}
+
+	// The only way through is blocked by a mob
+	_, found := FindPath(floor, from, to, Options{})
+	assert.False(t, found)
+	_, found = FindPath(floor, from, to, Options{Occupants: true})
+	assert.True(t, found)
+
+	// Whoever stands at the goal doesn't stop a path reaching them
+	path, found := FindPath(floor, from, models.Position{X: 2, Y: 3}, Options{})
+	require.True(t, found)
+	assert.Equal(t, models.Position{X: 2, Y: 3}, path[len(path)-1])
+
+	// Callers can block tiles the floor doesn't know are taken
+	floor.Tiles[3][2].MobID = ""
+	blocked := func(pos models.Position) bool { return pos == models.Position{X: 2, Y: 3} }
+	_, found = FindPath(floor, from, to, Options{Blocked: blocked})
+	assert.False(t, found)
+}
+
+func TestFindPathCosts(t *testing.T) {
+	floor := newFloor(7, 5)
+	from, to := models.Position{X: 1, Y: 2}, models.Position{X: 5, Y: 2}
+
+	// A revealed trap is worth a detour, a hidden one isn't known about
+	floor.Tiles[2][3] = models.Tile{Type: models.TileTrap, Walkable: true, TrapID: "spikes"}
+	path, found := FindPath(floor, from, to, Options{})
+	require.True(t, found)
+	assert.NotContains(t, path, models.Position{X: 3, Y: 2})
+	assert.Len(t, path, 6)
+
+	floor.Tiles[2][3].Type = models.TileFloor
+	path, found = FindPath(floor, from, to, Options{})
+	require.True(t, found)
+	assert.Len(t, path, 4)
+
+	// Mobs keep off the stairs
+	floor.Tiles[2][3].Type = models.TileDownStairs
+	path, _ = FindPath(floor, from, to, Options{AvoidStairs: true})
+	assert.NotContains(t, path, models.Position{X: 3, Y: 2})
+}
+
+func TestNearest(t *testing.T) {
+	floor := newFloor(10, 10)
+	floor.Tiles[1][6].Explored = true
+	floor.Tiles[5][1].Explored = true
+	floor.Tiles[1][2].MobID = "goblin"
+	from := models.Position{X: 1, Y: 1}
+
+	explored := func(pos models.Position) bool { return floor.Tiles[pos.Y][pos.X].Explored }
+	path, found := Nearest(floor, from, Options{}, explored)
+	require.True(t, found)
+	assert.Equal(t, models.Position{X: 1, Y: 5}, path[len(path)-1], "The mob makes the other tile further away")
+	assert.Len(t, path, 4)
+
+	// Occupied tiles are never picked
+	floor.Tiles[5][1].MobID = "ogre"
+	path, found = Nearest(floor, from, Options{}, explored)
+	require.True(t, found)
+	assert.Equal(t, models.Position{X: 6, Y: 1}, path[len(path)-1])
+
+	_, found = Nearest(floor, from, Options{MaxCost: 3}, explored)
+	assert.False(t, found)
+}
+
+func BenchmarkFindPath(b *testing.B) {
+	floor := newSerpentine(100, 100)
+	from, to := models.Position{X: 1, Y: 1}, models.Position{X: 98, Y: 98}
+	if _, found := FindPath(floor, from, to, Options{}); !found {
+		b.Fatal("No path across the floor")
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		FindPath(floor, from, to, Options{})
+	}
+}
+
+func BenchmarkFindPathOpen(b *testing.B) {
+	floor := newFloor(100, 100)
+	from, to := models.Position{X: 1, Y: 1}, models.Position{X: 98, Y: 98}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		FindPath(floor, from, to, Options{})
+	}
+}
@@ -0,0 +1,81 @@
+package repositories
+
+import (
+	"errors"
+	"strings"
+	"sync"
+
+	"github.com/jchauncey/TheDeeps/server/models"
+)
+
+// AccountRepository handles storage and retrieval of accounts
+type AccountRepository struct {
+	accounts   map[string]*models.Account
+	byUsername map[string]string // Lowercased username to account ID
+	usernames  map[string]string // Account ID to the username key it was saved under
+	mutex      sync.RWMutex
+}
+
+// NewAccountRepository creates a new account repository
+func NewAccountRepository() *AccountRepository {
+	return &AccountRepository{
+		accounts:   make(map[string]*models.Account),
+		byUsername: make(map[string]string),
+		usernames:  make(map[string]string),
+	}
+}
+
+// GetByID returns an account by ID
+func (r *AccountRepository) GetByID(id string) (*models.Account, error) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	account, exists := r.accounts[id]
+	if !exists {
+		return nil, errors.New("account not found")
+	}
+
+	return account, nil
+}
+
+// GetByUsername returns an account by username, ignoring case
+func (r *AccountRepository) GetByUsername(username string) (*models.Account, error) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	id, exists := r.byUsername[strings.ToLower(username)]
+	if !exists {
+		return nil, errors.New("account not found")
+	}
+
+	return r.accounts[id], nil
+}
+
+// Save saves an account. Usernames must be unique.
+func (r *AccountRepository) Save(account *models.Account) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	key := strings.ToLower(account.Username)
+	if id, exists := r.byUsername[key]; exists && id != account.ID {
+		return errors.New("username already taken")
+	}
+
+	// Drop the old username if it changed
+	if previous, exists := r.usernames[account.ID]; exists {
+		delete(r.byUsername, previous)
+	}
+
+	r.accounts[account.ID] = account
+	r.byUsername[key] = account.ID
+	r.usernames[account.ID] = key
+	return nil
+}
+
+// Count returns the number of accounts
+func (r *AccountRepository) Count() int {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	return len(r.accounts)
+}
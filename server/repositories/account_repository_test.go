@@ -0,0 +1,54 @@
+package repositories
+
+import (
+	"testing"
+
+	"github.com/jchauncey/TheDeeps/server/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewAccountRepository(t *testing.T) {
+	repo := NewAccountRepository()
+	assert.NotNil(t, repo, "Repository should not be nil")
+	assert.Equal(t, 0, repo.Count(), "Repository should be empty")
+}
+
+func TestAccountRepositorySaveAndGet(t *testing.T) {
+	repo := NewAccountRepository()
+	account := models.NewAccount("Player", "hash")
+
+	require.NoError(t, repo.Save(account), "Save should not return an error")
+	assert.Equal(t, 1, repo.Count())
+
+	byID, err := repo.GetByID(account.ID)
+	require.NoError(t, err)
+	assert.Equal(t, account, byID)
+
+	byName, err := repo.GetByUsername("player")
+	require.NoError(t, err, "Usernames should be matched case-insensitively")
+	assert.Equal(t, account, byName)
+
+	_, err = repo.GetByID("missing")
+	assert.Error(t, err)
+	_, err = repo.GetByUsername("missing")
+	assert.Error(t, err)
+}
+
+func TestAccountRepositoryUniqueUsernames(t *testing.T) {
+	repo := NewAccountRepository()
+	account := models.NewAccount("Player", "hash")
+	require.NoError(t, repo.Save(account))
+
+	// A different account can't take the same name
+	duplicate := models.NewAccount("PLAYER", "hash")
+	assert.Error(t, repo.Save(duplicate), "Duplicate usernames should be rejected")
+
+	// Renaming frees up the old name
+	account.Username = "Renamed"
+	require.NoError(t, repo.Save(account))
+	require.NoError(t, repo.Save(duplicate), "The old username should be available again")
+
+	_, err := repo.GetByUsername("renamed")
+	assert.NoError(t, err)
+}
@@ -0,0 +1,428 @@
+package repositories
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jchauncey/TheDeeps/server/log"
+	"github.com/jchauncey/TheDeeps/server/models"
+	bolt "go.etcd.io/bbolt"
+)
+
+// Bucket names used by the bolt storage backend
+var (
+	accountsBucket   = []byte("accounts")
+	charactersBucket = []byte("characters")
+	dungeonsBucket   = []byte("dungeons")
+	floorsBucket     = []byte("floors")
+	itemsBucket      = []byte("items")
+)
+
+// OpenBoltDB opens the bolt database at path, creating the file and buckets if needed
+func OpenBoltDB(path string) (*bolt.DB, error) {
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: 1 * time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("failed to open database %s: %w", path, err)
+	}
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, bucket := range [][]byte{accountsBucket, charactersBucket, dungeonsBucket, floorsBucket, itemsBucket} {
+			if _, err := tx.CreateBucketIfNotExists(bucket); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to create buckets: %w", err)
+	}
+
+	return db, nil
+}
+
+// BoltAccountRepository stores accounts in a bolt database
+type BoltAccountRepository struct {
+	*AccountRepository
+	db *bolt.DB
+}
+
+// NewBoltAccountRepository creates an account repository and loads any saved accounts
+func NewBoltAccountRepository(db *bolt.DB) (*BoltAccountRepository, error) {
+	repo := &BoltAccountRepository{
+		AccountRepository: NewAccountRepository(),
+		db:                db,
+	}
+
+	err := db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(accountsBucket).ForEach(func(key, value []byte) error {
+			account := &models.Account{}
+			if err := json.Unmarshal(value, account); err != nil {
+				return fmt.Errorf("failed to load account %s: %w", key, err)
+			}
+			return repo.AccountRepository.Save(account)
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return repo, nil
+}
+
+// Save saves an account
+func (r *BoltAccountRepository) Save(account *models.Account) error {
+	// Check the username first so a rejected account never reaches disk
+	if err := r.AccountRepository.Save(account); err != nil {
+		return err
+	}
+	return putJSON(r.db, accountsBucket, account.ID, account)
+}
+
+// BoltCharacterRepository stores characters in a bolt database.
+// Characters are cached in memory and written through to disk on every change,
+// so callers keep the same pointer semantics as the in-memory repository.
+type BoltCharacterRepository struct {
+	*CharacterRepository
+	db *bolt.DB
+}
+
+// NewBoltCharacterRepository creates a character repository and loads any saved characters
+func NewBoltCharacterRepository(db *bolt.DB) (*BoltCharacterRepository, error) {
+	repo := &BoltCharacterRepository{
+		CharacterRepository: NewCharacterRepository(),
+		db:                  db,
+	}
+
+	err := db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(charactersBucket).ForEach(func(key, value []byte) error {
+			character := &models.Character{}
+			if err := json.Unmarshal(value, character); err != nil {
+				return fmt.Errorf("failed to load character %s: %w", key, err)
+			}
+			relinkEquipment(character)
+			repo.characters[character.ID] = character
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return repo, nil
+}
+
+// Save saves a character
+func (r *BoltCharacterRepository) Save(character *models.Character) error {
+	if err := putJSON(r.db, charactersBucket, character.ID, character); err != nil {
+		return err
+	}
+	return r.CharacterRepository.Save(character)
+}
+
+// Delete deletes a character
+func (r *BoltCharacterRepository) Delete(id string) error {
+	if err := r.CharacterRepository.Delete(id); err != nil {
+		return err
+	}
+	return r.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(charactersBucket).Delete([]byte(id))
+	})
+}
+
+// BoltDungeonRepository stores dungeons in a bolt database.
+// Dungeon metadata and each floor are stored under separate keys so saving a
+// single floor doesn't rewrite the whole dungeon.
+type BoltDungeonRepository struct {
+	*DungeonRepository
+	db *bolt.DB
+}
+
+// NewBoltDungeonRepository creates a dungeon repository and loads any saved dungeons
+func NewBoltDungeonRepository(db *bolt.DB) (*BoltDungeonRepository, error) {
+	repo := &BoltDungeonRepository{
+		DungeonRepository: NewDungeonRepository(),
+		db:                db,
+	}
+
+	err := db.View(func(tx *bolt.Tx) error {
+		err := tx.Bucket(dungeonsBucket).ForEach(func(key, value []byte) error {
+			dungeon := &models.Dungeon{}
+			if err := json.Unmarshal(value, dungeon); err != nil {
+				return fmt.Errorf("failed to load dungeon %s: %w", key, err)
+			}
+			dungeon.FloorData = make(map[int]*models.Floor)
+			if dungeon.Characters == nil {
+				dungeon.Characters = make(map[string]string)
+			}
+			repo.dungeons[dungeon.ID] = dungeon
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		return tx.Bucket(floorsBucket).ForEach(func(key, value []byte) error {
+			dungeonID, level, err := parseFloorKey(string(key))
+			if err != nil {
+				return err
+			}
+
+			dungeon, exists := repo.dungeons[dungeonID]
+			if !exists {
+				log.Warn("Skipping floor %s for missing dungeon", key)
+				return nil
+			}
+
+			floor := &models.Floor{}
+			if err := json.Unmarshal(value, floor); err != nil {
+				return fmt.Errorf("failed to load floor %s: %w", key, err)
+			}
+			dungeon.FloorData[level] = floor
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return repo, nil
+}
+
+// Save saves a dungeon along with all of its floors
+func (r *BoltDungeonRepository) Save(dungeon *models.Dungeon) error {
+	err := r.db.Update(func(tx *bolt.Tx) error {
+		if err := putDungeon(tx, dungeon); err != nil {
+			return err
+		}
+		for level, floor := range dungeon.FloorData {
+			if err := putFloor(tx, dungeon.ID, level, floor); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	return r.DungeonRepository.Save(dungeon)
+}
+
+// Delete deletes a dungeon and its floors
+func (r *BoltDungeonRepository) Delete(id string) error {
+	if err := r.DungeonRepository.Delete(id); err != nil {
+		return err
+	}
+	return r.db.Update(func(tx *bolt.Tx) error {
+		if err := tx.Bucket(dungeonsBucket).Delete([]byte(id)); err != nil {
+			return err
+		}
+
+		// Collect the keys first; deleting while iterating skips entries
+		prefix := []byte(id + "/")
+		var keys [][]byte
+		cursor := tx.Bucket(floorsBucket).Cursor()
+		for key, _ := cursor.Seek(prefix); key != nil && bytes.HasPrefix(key, prefix); key, _ = cursor.Next() {
+			keys = append(keys, append([]byte(nil), key...))
+		}
+		for _, key := range keys {
+			if err := tx.Bucket(floorsBucket).Delete(key); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// SaveFloor saves a floor for a dungeon
+func (r *BoltDungeonRepository) SaveFloor(dungeonID string, floorLevel int, floor *models.Floor) error {
+	if err := r.DungeonRepository.SaveFloor(dungeonID, floorLevel, floor); err != nil {
+		return err
+	}
+	return r.db.Update(func(tx *bolt.Tx) error {
+		return putFloor(tx, dungeonID, floorLevel, floor)
+	})
+}
+
+// AddCharacterToDungeon adds a character to a dungeon
+func (r *BoltDungeonRepository) AddCharacterToDungeon(dungeonID string, characterID string) error {
+	if err := r.DungeonRepository.AddCharacterToDungeon(dungeonID, characterID); err != nil {
+		return err
+	}
+	return r.persistDungeon(dungeonID)
+}
+
+// RemoveCharacterFromDungeon removes a character from a dungeon
+func (r *BoltDungeonRepository) RemoveCharacterFromDungeon(dungeonID string, characterID string) error {
+	if err := r.DungeonRepository.RemoveCharacterFromDungeon(dungeonID, characterID); err != nil {
+		return err
+	}
+	return r.persistDungeon(dungeonID)
+}
+
+// SetCharacterFloor sets the floor level for a character in a dungeon
+func (r *BoltDungeonRepository) SetCharacterFloor(dungeonID string, characterID string, floor int) error {
+	if err := r.DungeonRepository.SetCharacterFloor(dungeonID, characterID, floor); err != nil {
+		return err
+	}
+	return r.persistDungeon(dungeonID)
+}
+
+// persistDungeon writes a dungeon's metadata (without floors) to disk
+func (r *BoltDungeonRepository) persistDungeon(dungeonID string) error {
+	dungeon, err := r.DungeonRepository.GetByID(dungeonID)
+	if err != nil {
+		return err
+	}
+	return r.db.Update(func(tx *bolt.Tx) error {
+		return putDungeon(tx, dungeon)
+	})
+}
+
+// BoltInventoryRepository stores items in a bolt database
+type BoltInventoryRepository struct {
+	*InventoryRepository
+	db *bolt.DB
+}
+
+// NewBoltInventoryRepository creates an inventory repository and loads any saved items
+func NewBoltInventoryRepository(db *bolt.DB) (*BoltInventoryRepository, error) {
+	repo := &BoltInventoryRepository{
+		InventoryRepository: NewInventoryRepository(),
+		db:                  db,
+	}
+
+	err := db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(itemsBucket).ForEach(func(key, value []byte) error {
+			item := &models.Item{}
+			if err := json.Unmarshal(value, item); err != nil {
+				return fmt.Errorf("failed to load item %s: %w", key, err)
+			}
+			repo.items[item.ID] = item
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return repo, nil
+}
+
+// SaveItem saves an item to the repository
+func (r *BoltInventoryRepository) SaveItem(item *models.Item) error {
+	if err := putJSON(r.db, itemsBucket, item.ID, item); err != nil {
+		return err
+	}
+	return r.InventoryRepository.SaveItem(item)
+}
+
+// DeleteItem removes an item from the repository
+func (r *BoltInventoryRepository) DeleteItem(itemID string) bool {
+	if !r.InventoryRepository.DeleteItem(itemID) {
+		return false
+	}
+
+	err := r.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(itemsBucket).Delete([]byte(itemID))
+	})
+	if err != nil {
+		log.Error("Failed to delete item %s: %v", itemID, err)
+	}
+	return true
+}
+
+// GenerateRandomItems generates a specified number of random items based on floor level
+func (r *BoltInventoryRepository) GenerateRandomItems(count int, floorLevel int) []*models.Item {
+	items := make([]*models.Item, 0, count)
+	for i := 0; i < count; i++ {
+		item := models.GenerateRandomItem(floorLevel)
+		if err := r.SaveItem(item); err != nil {
+			log.Error("Failed to save generated item: %v", err)
+			continue
+		}
+		items = append(items, item)
+	}
+	return items
+}
+
+// Ensure the bolt repositories satisfy the storage interfaces
+var (
+	_ AccountStore   = (*BoltAccountRepository)(nil)
+	_ CharacterStore = (*BoltCharacterRepository)(nil)
+	_ DungeonStore   = (*BoltDungeonRepository)(nil)
+	_ InventoryStore = (*BoltInventoryRepository)(nil)
+)
+
+// Helper functions
+
+// putJSON marshals value and stores it under key in bucket
+func putJSON(db *bolt.DB, bucket []byte, key string, value interface{}) error {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	return db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(bucket).Put([]byte(key), data)
+	})
+}
+
+// putDungeon stores a dungeon's metadata; floors are stored separately
+func putDungeon(tx *bolt.Tx, dungeon *models.Dungeon) error {
+	data, err := json.Marshal(dungeon)
+	if err != nil {
+		return err
+	}
+	return tx.Bucket(dungeonsBucket).Put([]byte(dungeon.ID), data)
+}
+
+// putFloor stores a single floor of a dungeon
+func putFloor(tx *bolt.Tx, dungeonID string, level int, floor *models.Floor) error {
+	data, err := json.Marshal(floor)
+	if err != nil {
+		return err
+	}
+	return tx.Bucket(floorsBucket).Put([]byte(floorKey(dungeonID, level)), data)
+}
+
+// floorKey builds the storage key for a floor
+func floorKey(dungeonID string, level int) string {
+	return dungeonID + "/" + strconv.Itoa(level)
+}
+
+// parseFloorKey splits a floor storage key into its dungeon ID and level
+func parseFloorKey(key string) (string, int, error) {
+	separator := strings.LastIndex(key, "/")
+	if separator < 0 {
+		return "", 0, fmt.Errorf("invalid floor key %q", key)
+	}
+
+	level, err := strconv.Atoi(key[separator+1:])
+	if err != nil {
+		return "", 0, fmt.Errorf("invalid floor key %q: %w", key, err)
+	}
+
+	return key[:separator], level, nil
+}
+
+// relinkEquipment points equipment slots back at the matching inventory items.
+// JSON decoding creates separate copies, but the character methods expect an
+// equipped item to be the same object as its inventory entry.
+func relinkEquipment(character *models.Character) {
+	relink := func(slot **models.Item) {
+		if *slot == nil {
+			return
+		}
+		if item, found := character.GetInventoryItem((*slot).ID); found {
+			*slot = item
+		}
+	}
+
+	relink(&character.Equipment.Weapon)
+	relink(&character.Equipment.Armor)
+	relink(&character.Equipment.Accessory)
+}
@@ -0,0 +1,174 @@
+package repositories
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/jchauncey/TheDeeps/server/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	bolt "go.etcd.io/bbolt"
+)
+
+// openTestDB opens a bolt database in a temporary directory
+func openTestDB(t *testing.T, path string) *bolt.DB {
+	db, err := OpenBoltDB(path)
+	require.NoError(t, err, "OpenBoltDB should not return an error")
+	return db
+}
+
+func TestBoltAccountRepositoryPersists(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.db")
+
+	db := openTestDB(t, path)
+	repo, err := NewBoltAccountRepository(db)
+	require.NoError(t, err)
+
+	account := models.NewAccount("Player", "hash")
+	require.NoError(t, repo.Save(account))
+	assert.Error(t, repo.Save(models.NewAccount("player", "hash")), "Duplicate usernames should be rejected")
+	require.NoError(t, db.Close())
+
+	// Reopen and verify the account survived the restart
+	db = openTestDB(t, path)
+	defer db.Close()
+	repo, err = NewBoltAccountRepository(db)
+	require.NoError(t, err)
+
+	assert.Equal(t, 1, repo.Count(), "Only the saved account should be loaded")
+	loaded, err := repo.GetByUsername("player")
+	require.NoError(t, err)
+	assert.Equal(t, account.ID, loaded.ID)
+	assert.Equal(t, "hash", loaded.PasswordHash, "Password hashes should be persisted")
+}
+
+func TestBoltCharacterRepositoryPersists(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.db")
+
+	db := openTestDB(t, path)
+	repo, err := NewBoltCharacterRepository(db)
+	require.NoError(t, err)
+
+	character := models.NewCharacter("Persistent", models.Warrior)
+	sword := models.NewWeapon("Sword", 5, 10, 1, nil)
+	require.True(t, character.AddToInventory(sword))
+	require.True(t, character.EquipItem(sword.ID))
+	require.NoError(t, repo.Save(character))
+
+	deleted := models.NewCharacter("Deleted", models.Mage)
+	require.NoError(t, repo.Save(deleted))
+	require.NoError(t, repo.Delete(deleted.ID))
+	require.NoError(t, db.Close())
+
+	// Reopen and verify the character survived the restart
+	db = openTestDB(t, path)
+	defer db.Close()
+	repo, err = NewBoltCharacterRepository(db)
+	require.NoError(t, err)
+
+	assert.Equal(t, 1, repo.Count(), "Only the saved character should be loaded")
+	loaded, err := repo.GetByID(character.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "Persistent", loaded.Name)
+	assert.Equal(t, character.MaxHP, loaded.MaxHP)
+
+	// Equipped items should still be the same object as the inventory entry
+	require.NotNil(t, loaded.Equipment.Weapon)
+	item, found := loaded.GetInventoryItem(sword.ID)
+	require.True(t, found)
+	assert.Same(t, item, loaded.Equipment.Weapon, "Equipment should point at the inventory item")
+
+	_, err = repo.GetByID(deleted.ID)
+	assert.Error(t, err, "Deleted characters should not be loaded")
+}
+
+func TestBoltDungeonRepositoryPersists(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.db")
+
+	db := openTestDB(t, path)
+	repo, err := NewBoltDungeonRepository(db)
+	require.NoError(t, err)
+
+	dungeon := models.NewDungeon("Persistent", 3, 12345)
+	require.NoError(t, repo.Save(dungeon))
+	require.NoError(t, repo.AddCharacterToDungeon(dungeon.ID, "character-1"))
+	require.NoError(t, repo.SetCharacterFloor(dungeon.ID, "character-1", 2))
+
+	floor := &models.Floor{Level: 2, Width: 3, Height: 1, Tiles: [][]models.Tile{{
+		{Type: models.TileWall},
+		{Type: models.TileFloor, Walkable: true},
+		{Type: models.TileDownStairs, Walkable: true},
+	}}}
+	require.NoError(t, repo.SaveFloor(dungeon.ID, 2, floor))
+
+	deleted := models.NewDungeon("Deleted", 1, 1)
+	require.NoError(t, repo.Save(deleted))
+	require.NoError(t, repo.SaveFloor(deleted.ID, 1, floor))
+	require.NoError(t, repo.Delete(deleted.ID))
+	require.NoError(t, db.Close())
+
+	// Reopen and verify the dungeon and floor survived the restart
+	db = openTestDB(t, path)
+	defer db.Close()
+	repo, err = NewBoltDungeonRepository(db)
+	require.NoError(t, err)
+
+	assert.Len(t, repo.GetAll(), 1, "Only the saved dungeon should be loaded")
+	loaded, err := repo.GetByID(dungeon.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "Persistent", loaded.Name)
+
+	level, err := repo.GetCharacterFloor(dungeon.ID, "character-1")
+	require.NoError(t, err)
+	assert.Equal(t, 2, level, "Character floor should be restored")
+
+	loadedFloor, err := repo.GetFloor(dungeon.ID, 2)
+	require.NoError(t, err)
+	assert.Equal(t, floor.Tiles, loadedFloor.Tiles, "Floor tiles should be restored")
+
+	_, err = repo.GetByID(deleted.ID)
+	assert.Error(t, err, "Deleted dungeons should not be loaded")
+}
+
+func TestBoltInventoryRepositoryPersists(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.db")
+
+	db := openTestDB(t, path)
+	repo, err := NewBoltInventoryRepository(db)
+	require.NoError(t, err)
+
+	potion := models.NewPotion("Health Potion", 20, 5)
+	require.NoError(t, repo.SaveItem(potion))
+	generated := repo.GenerateRandomItems(2, 1)
+	require.Len(t, generated, 2)
+	assert.True(t, repo.DeleteItem(generated[1].ID))
+	require.NoError(t, db.Close())
+
+	// Reopen and verify the items survived the restart
+	db = openTestDB(t, path)
+	defer db.Close()
+	repo, err = NewBoltInventoryRepository(db)
+	require.NoError(t, err)
+
+	assert.Len(t, repo.GetAllItems(), 2, "Saved and generated items should be loaded")
+	loaded, found := repo.GetItem(potion.ID)
+	require.True(t, found)
+	assert.Equal(t, "Health Potion", loaded.Name)
+
+	_, found = repo.GetItem(generated[0].ID)
+	assert.True(t, found, "Generated items should be persisted")
+	_, found = repo.GetItem(generated[1].ID)
+	assert.False(t, found, "Deleted items should not be loaded")
+}
+
+func TestParseFloorKey(t *testing.T) {
+	dungeonID, level, err := parseFloorKey(floorKey("abc-123", 7))
+	require.NoError(t, err)
+	assert.Equal(t, "abc-123", dungeonID)
+	assert.Equal(t, 7, level)
+
+	_, _, err = parseFloorKey("no-separator")
+	assert.Error(t, err)
+	_, _, err = parseFloorKey("abc/notanumber")
+	assert.Error(t, err)
+}
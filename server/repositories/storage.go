@@ -0,0 +1,53 @@
+package repositories
+
+import (
+	"github.com/jchauncey/TheDeeps/server/models"
+)
+
+// AccountStore is the storage interface for player accounts
+type AccountStore interface {
+	GetByID(id string) (*models.Account, error)
+	GetByUsername(username string) (*models.Account, error)
+	Save(account *models.Account) error
+	Count() int
+}
+
+// CharacterStore is the storage interface for characters
+type CharacterStore interface {
+	GetAll() []*models.Character
+	GetByID(id string) (*models.Character, error)
+	Save(character *models.Character) error
+	Delete(id string) error
+	Count() int
+}
+
+// DungeonStore is the storage interface for dungeons and their floors
+type DungeonStore interface {
+	GetAll() []*models.Dungeon
+	GetByID(id string) (*models.Dungeon, error)
+	Save(dungeon *models.Dungeon) error
+	Delete(id string) error
+	GetFloor(dungeonID string, level int) (*models.Floor, error)
+	SaveFloor(dungeonID string, floorLevel int, floor *models.Floor) error
+	AddCharacterToDungeon(dungeonID string, characterID string) error
+	RemoveCharacterFromDungeon(dungeonID string, characterID string) error
+	GetCharacterFloor(dungeonID string, characterID string) (int, error)
+	SetCharacterFloor(dungeonID string, characterID string, floor int) error
+}
+
+// InventoryStore is the storage interface for items
+type InventoryStore interface {
+	SaveItem(item *models.Item) error
+	GetItem(itemID string) (*models.Item, bool)
+	DeleteItem(itemID string) bool
+	GetAllItems() []*models.Item
+	GenerateRandomItems(count int, floorLevel int) []*models.Item
+}
+
+// Ensure the in-memory repositories satisfy the storage interfaces
+var (
+	_ AccountStore   = (*AccountRepository)(nil)
+	_ CharacterStore = (*CharacterRepository)(nil)
+	_ DungeonStore   = (*DungeonRepository)(nil)
+	_ InventoryStore = (*InventoryRepository)(nil)
+)
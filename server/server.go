@@ -1,72 +1,174 @@
 package main
 
 import (
+	"fmt"
 	"net/http"
 
 	"github.com/gorilla/mux"
+	"github.com/jchauncey/TheDeeps/server/auth"
 	"github.com/jchauncey/TheDeeps/server/game"
 	"github.com/jchauncey/TheDeeps/server/handlers"
 	"github.com/jchauncey/TheDeeps/server/log"
 	"github.com/jchauncey/TheDeeps/server/repositories"
+	bolt "go.etcd.io/bbolt"
 )
 
+// Storage backends supported by the server
+const (
+	StorageMemory = "memory"
+	StorageBolt   = "bolt"
+)
+
+// StorageOptions selects where the server keeps its data
+type StorageOptions struct {
+	Backend string // StorageMemory or StorageBolt
+	Path    string // Database file used by the bolt backend
+}
+
 // Server represents the game server
 type Server struct {
 	router           *mux.Router
-	characterRepo    *repositories.CharacterRepository
-	dungeonRepo      *repositories.DungeonRepository
-	inventoryRepo    *repositories.InventoryRepository
+	db               *bolt.DB
+	accountRepo      repositories.AccountStore
+	characterRepo    repositories.CharacterStore
+	dungeonRepo      repositories.DungeonStore
+	inventoryRepo    repositories.InventoryStore
+	tokens           *auth.TokenManager
 	gameManager      *game.GameManager
+	authHandler      *handlers.AuthHandler
 	characterHandler *handlers.CharacterHandler
 	dungeonHandler   *handlers.DungeonHandler
 	combatHandler    *handlers.CombatHandler
+	partyHandler     *handlers.PartyHandler
+	shopHandler      *handlers.ShopHandler
 	inventoryHandler *handlers.InventoryHandler
+	adminHandler     *handlers.AdminHandler
 }
 
-// NewServer creates a new server instance
-func NewServer() *Server {
+// stores holds the repositories for a storage backend
+type stores struct {
+	db            *bolt.DB
+	accountRepo   repositories.AccountStore
+	characterRepo repositories.CharacterStore
+	dungeonRepo   repositories.DungeonStore
+	inventoryRepo repositories.InventoryStore
+}
+
+// NewServer creates a new server instance using the given storage backend.
+// Session tokens are signed with tokenSecret, and the accounts with the admins
+// IDs may use the admin routes.
+func NewServer(storage StorageOptions, tokenSecret []byte, admins []string) (*Server, error) {
 	// Create repositories
-	characterRepo := repositories.NewCharacterRepository()
-	dungeonRepo := repositories.NewDungeonRepository()
-	inventoryRepo := repositories.NewInventoryRepository()
+	var repos *stores
+	switch storage.Backend {
+	case StorageMemory, "":
+		repos = &stores{
+			accountRepo:   repositories.NewAccountRepository(),
+			characterRepo: repositories.NewCharacterRepository(),
+			dungeonRepo:   repositories.NewDungeonRepository(),
+			inventoryRepo: repositories.NewInventoryRepository(),
+		}
+	case StorageBolt:
+		var err error
+		repos, err = openBoltStores(storage.Path)
+		if err != nil {
+			return nil, err
+		}
+		log.Info("Using bolt storage at %s", storage.Path)
+	default:
+		return nil, fmt.Errorf("unknown storage backend: %s", storage.Backend)
+	}
+
+	tokens := auth.NewTokenManager(tokenSecret)
 
 	// Create game manager
-	gameManager := game.NewGameManager(characterRepo, dungeonRepo)
+	gameManager := game.NewGameManager(repos.characterRepo, repos.dungeonRepo)
+
+	// Start processing client registrations and broadcasts
+	go gameManager.Start()
 
 	// Create handlers
-	characterHandler := handlers.NewCharacterHandler(characterRepo)
-	dungeonHandler := handlers.NewDungeonHandler(dungeonRepo, characterRepo)
-	combatHandler := handlers.NewCombatHandler(characterRepo, dungeonRepo, gameManager)
-	inventoryHandler := handlers.NewInventoryHandler(characterRepo, inventoryRepo)
+	authHandler := handlers.NewAuthHandler(repos.accountRepo, tokens)
+	characterHandler := handlers.NewCharacterHandler(repos.characterRepo, repos.dungeonRepo, gameManager)
+	dungeonHandler := handlers.NewDungeonHandler(repos.dungeonRepo, repos.characterRepo, gameManager)
+	combatHandler := handlers.NewCombatHandler(repos.characterRepo, repos.dungeonRepo, gameManager)
+	partyHandler := handlers.NewPartyHandler(repos.characterRepo, gameManager.Parties)
+	shopHandler := handlers.NewShopHandler(repos.characterRepo, gameManager.Shops)
+	inventoryHandler := handlers.NewInventoryHandler(repos.characterRepo, repos.inventoryRepo)
+	adminHandler := handlers.NewAdminHandler(admins, repos.dungeonRepo)
 
 	// Create server
 	server := &Server{
 		router:           mux.NewRouter(),
-		characterRepo:    characterRepo,
-		dungeonRepo:      dungeonRepo,
-		inventoryRepo:    inventoryRepo,
+		db:               repos.db,
+		accountRepo:      repos.accountRepo,
+		characterRepo:    repos.characterRepo,
+		dungeonRepo:      repos.dungeonRepo,
+		inventoryRepo:    repos.inventoryRepo,
+		tokens:           tokens,
 		gameManager:      gameManager,
+		authHandler:      authHandler,
 		characterHandler: characterHandler,
 		dungeonHandler:   dungeonHandler,
 		combatHandler:    combatHandler,
+		partyHandler:     partyHandler,
+		shopHandler:      shopHandler,
 		inventoryHandler: inventoryHandler,
+		adminHandler:     adminHandler,
 	}
 
 	// Setup routes
 	server.SetupRoutes()
 
-	return server
+	return server, nil
+}
+
+// openBoltStores opens the bolt database and loads each repository from it
+func openBoltStores(path string) (*stores, error) {
+	db, err := repositories.OpenBoltDB(path)
+	if err != nil {
+		return nil, err
+	}
+
+	repos := &stores{db: db}
+	if repos.accountRepo, err = repositories.NewBoltAccountRepository(db); err != nil {
+		db.Close()
+		return nil, err
+	}
+	if repos.characterRepo, err = repositories.NewBoltCharacterRepository(db); err != nil {
+		db.Close()
+		return nil, err
+	}
+	if repos.dungeonRepo, err = repositories.NewBoltDungeonRepository(db); err != nil {
+		db.Close()
+		return nil, err
+	}
+	if repos.inventoryRepo, err = repositories.NewBoltInventoryRepository(db); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return repos, nil
 }
 
 // SetupRoutes configures the server routes
 func (s *Server) SetupRoutes() {
+	// Attach the caller's account to every request
+	s.router.Use(auth.Middleware(s.tokens, s.accountRepo))
+
+	// Account routes
+	s.router.HandleFunc("/auth/register", s.authHandler.Register).Methods("POST")
+	s.router.HandleFunc("/auth/login", s.authHandler.Login).Methods("POST")
+	s.router.HandleFunc("/auth/me", s.authHandler.GetAccount).Methods("GET")
+
 	// Character routes
 	s.router.HandleFunc("/characters", s.characterHandler.GetCharacters).Methods("GET")
 	s.router.HandleFunc("/characters", s.characterHandler.CreateCharacter).Methods("POST")
 	s.router.HandleFunc("/characters/{id}", s.characterHandler.GetCharacter).Methods("GET")
 	s.router.HandleFunc("/characters/{id}", s.characterHandler.DeleteCharacter).Methods("DELETE")
-	s.router.HandleFunc("/characters/{id}/save", s.characterHandler.SaveCharacter).Methods("POST")
+	s.router.HandleFunc("/characters/{id}/checkpoint", s.characterHandler.Checkpoint).Methods("POST")
 	s.router.HandleFunc("/characters/{id}/floor", s.characterHandler.GetCharacterFloor).Methods("GET")
+	s.router.HandleFunc("/characters/{id}/abilities", s.characterHandler.GetCharacterAbilities).Methods("GET")
 
 	// Dungeon routes
 	s.router.HandleFunc("/dungeons", s.dungeonHandler.GetDungeons).Methods("GET")
@@ -80,9 +182,27 @@ func (s *Server) SetupRoutes() {
 	s.router.HandleFunc("/characters/{id}/combat", s.combatHandler.GetCombatState).Methods("GET")
 	s.router.HandleFunc("/ws/combat", s.combatHandler.HandleCombat).Methods("GET")
 
+	// Party routes
+	s.router.HandleFunc("/characters/{id}/party", s.partyHandler.GetParty).Methods("GET")
+	s.router.HandleFunc("/characters/{id}/party/invite", s.partyHandler.Invite).Methods("POST")
+	s.router.HandleFunc("/characters/{id}/party/accept", s.partyHandler.Accept).Methods("POST")
+	s.router.HandleFunc("/characters/{id}/party/leave", s.partyHandler.Leave).Methods("POST")
+	s.router.HandleFunc("/characters/{id}/party/kick", s.partyHandler.Kick).Methods("POST")
+	s.router.HandleFunc("/characters/{id}/party/loot", s.partyHandler.SetLootRule).Methods("PUT")
+
+	// Shop routes
+	s.router.HandleFunc("/characters/{id}/shop", s.shopHandler.GetShop).Methods("GET")
+	s.router.HandleFunc("/characters/{id}/shop/buy", s.shopHandler.Buy).Methods("POST")
+	s.router.HandleFunc("/characters/{id}/shop/sell", s.shopHandler.Sell).Methods("POST")
+	s.router.HandleFunc("/characters/{id}/shop/haggle", s.shopHandler.Haggle).Methods("POST")
+
 	// Inventory routes
 	s.inventoryHandler.RegisterRoutes(s.router)
 
+	// Admin routes
+	s.router.HandleFunc("/admin/monsters", s.adminHandler.GetMonsters).Methods("GET")
+	s.router.HandleFunc("/admin/dungeons/{id}/floors/{level}/stats", s.adminHandler.GetFloorStats).Methods("GET")
+
 	// WebSocket route for real-time game updates
 	s.router.HandleFunc("/ws/game", s.gameManager.HandleConnection)
 }
@@ -92,3 +212,11 @@ func (s *Server) Start(addr string) error {
 	log.Info("Starting server on %s", addr)
 	return http.ListenAndServe(addr, s.router)
 }
+
+// Close releases the server's storage
+func (s *Server) Close() error {
+	if s.db != nil {
+		return s.db.Close()
+	}
+	return nil
+}